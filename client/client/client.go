@@ -7,6 +7,7 @@ import (
 	"github.com/tangrc99/MemTable/server/global"
 	"github.com/tangrc99/MemTable/utils/readline"
 	"net"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +19,11 @@ type Client struct {
 	parser *resp.Parser // 命令解析器
 	flag   int          // 客户端标识
 	quit   bool         // 退出标识
+
+	// 会话状态，断线重连之后会重新发送
+	db    int      // 当前选择的数据库
+	auth  []string // 最近一次成功执行的 AUTH 参数
+	hello []string // 最近一次成功执行的 HELLO 参数
 }
 
 func NewClient(options ...Option) *Client {
@@ -51,11 +57,20 @@ func (c *Client) Quit() {
 }
 
 func (c *Client) Call(msg []byte) (string, error) {
+	reply, err := c.call(msg)
+	if err != nil {
+		return "", err
+	}
+	return resp.FormatReply(reply, 0), nil
+}
+
+// call 发送 msg 并返回解析后的回复
+func (c *Client) call(msg []byte) (resp.RedisData, error) {
 	for i := 0; i < len(msg); {
 		n, err := c.conn.Write(msg[i:])
 		if err != nil {
 			c.toDisconnected()
-			return "", errors.New(fmt.Sprintf("Could not connect to Redis at %s: %s", c.url, err.Error()))
+			return nil, errors.New(fmt.Sprintf("Could not connect to Redis at %s: %s", c.url, err.Error()))
 		}
 		i += n
 	}
@@ -63,19 +78,137 @@ func (c *Client) Call(msg []byte) (string, error) {
 	if echo.Abort {
 	} else if echo.Err != nil {
 		c.toDisconnected()
-		return "", echo.Err
+		return nil, echo.Err
 	}
-	return resp.ToReadableString(echo.Data, ""), nil
+	return echo.Data, nil
 }
 
 func (c *Client) WaitResponse() (string, error) {
+	return resp.FormatReply(c.waitReply(), 0), nil
+}
+
+// waitReply 阻塞等待服务端推送的回复
+func (c *Client) waitReply() resp.RedisData {
 	echo := c.parser.Parse()
 	if echo.Abort {
 		c.toDisconnected()
 	} else if echo.Err != nil {
 
 	}
-	return resp.ToReadableString(echo.Data, ""), nil
+	return echo.Data
+}
+
+// loadCommandCompletions 使用 COMMAND DOCS 的结果补充命令补全，已经注册的命令会保留原有的帮助信息
+func (c *Client) loadCommandCompletions(completer *readline.Completer) {
+
+	reply, err := c.Do("command", "docs")
+	if err != nil {
+		return
+	}
+
+	array, ok := reply.(*resp.ArrayData)
+	if !ok {
+		return
+	}
+
+	for i := 0; i+1 < len(array.Data()); i += 2 {
+		name, err := String(array.Data()[i], nil)
+		if err != nil || completer.Exist(name) {
+			continue
+		}
+		completer.Register(readline.NewHint(name, ""))
+	}
+}
+
+// execute 发送交互模式中输入的命令。连接断开时会重新连接并恢复会话状态，然后重试一次命令。
+// 事务中的命令不会重试，因为服务端已经丢弃了之前入队的命令
+func (c *Client) execute(command [][]byte) (resp.RedisData, error) {
+
+	msg := resp.PlainDataToResp(command).ToBytes()
+	// 需要在修改状态之前判断，EXEC 与 DISCARD 同样属于事务中的命令
+	queued := c.isInTx() && !strings.EqualFold(string(command[0]), "multi")
+	c.maybeChangeStatus(command)
+	// 连接断开时状态会被清空，重试时恢复为执行该命令之后的状态
+	status := c.flag
+
+	ret, err := c.call(msg)
+	if err != nil && !c.isConnected() {
+		fmt.Println("Reconnecting...")
+		if err = c.reconnect(); err != nil {
+			return nil, err
+		}
+		if queued {
+			return nil, errors.New("connection lost, transaction discarded")
+		}
+		c.flag = status
+		ret, err = c.call(msg)
+	}
+
+	if err == nil {
+		c.rememberSession(command, ret)
+	}
+	return ret, err
+}
+
+// rememberSession 记录执行成功的 SELECT、AUTH、HELLO 命令，事务中的命令只是入队，不会改变会话状态
+func (c *Client) rememberSession(command [][]byte, ret resp.RedisData) {
+
+	if _, failed := ret.(*resp.ErrorData); failed || c.isInTx() {
+		return
+	}
+
+	args := make([]string, len(command)-1)
+	for i := range args {
+		args[i] = string(command[i+1])
+	}
+
+	switch strings.ToLower(string(command[0])) {
+	case "select":
+		if len(args) == 1 {
+			c.db, _ = strconv.Atoi(args[0])
+		}
+	case "auth":
+		c.auth = args
+	case "hello":
+		c.hello = args
+	}
+}
+
+// reconnect 重新建立连接，并依次发送 AUTH、HELLO、SELECT 恢复会话状态。事务以及阻塞状态不会恢复
+func (c *Client) reconnect() error {
+
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+	c.toDisconnected()
+	if err := c.Dial(); err != nil {
+		return err
+	}
+
+	commands := make([][]string, 0, 3)
+	if c.auth != nil {
+		commands = append(commands, append([]string{"auth"}, c.auth...))
+	}
+	if c.hello != nil {
+		commands = append(commands, append([]string{"hello"}, c.hello...))
+	}
+	if c.db != 0 {
+		commands = append(commands, []string{"select", strconv.Itoa(c.db)})
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	replies, err := c.Pipeline(commands...)
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if e, ok := reply.(*resp.ErrorData); ok {
+			return Error(e.Error())
+		}
+	}
+	return nil
 }
 
 func (c *Client) maybeChangeStatus(command [][]byte) {
@@ -99,6 +232,10 @@ func (c *Client) RunInteractiveMode() {
 	completer := readline.NewCompleter()
 	AddRedisCompletions(completer)
 
+	if c.isConnected() {
+		c.loadCommandCompletions(completer)
+	}
+
 	t := readline.NewTerminal().WithHistoryLimitation(20).WithCompleter(completer)
 
 	for !c.quit {
@@ -116,6 +253,8 @@ func (c *Client) RunInteractiveMode() {
 		command, abort := t.ReadLine()
 
 		if abort {
+			// 退出命令会关闭连接
+			_ = c.Close()
 			return
 		}
 
@@ -129,28 +268,22 @@ func (c *Client) RunInteractiveMode() {
 				fmt.Printf("%s\n", err.Error())
 				continue
 			}
+			c.loadCommandCompletions(completer)
 		}
 
-		c.maybeChangeStatus(command)
-
-		r := resp.PlainDataToResp(command)
-
-		ret, err := c.Call(r.ToBytes())
+		// 终端的输入以及历史记录不受重新连接的影响
+		ret, err := c.execute(command)
 
 		if err != nil {
 			// TODO : 这里应该有选择地报错
 			fmt.Printf("%s\n", err.Error())
 		} else {
-			fmt.Printf("%s\n", ret)
+			fmt.Printf("%s\n", colorReply(ret, resp.FormatReply(ret, 0)))
 		}
 
 		for c.isConnected() && c.isBlocked() {
-			ret, err = c.WaitResponse()
-			if err != nil {
-				fmt.Printf("%s\n", err.Error())
-			} else {
-				fmt.Printf("%s\n", ret)
-			}
+			ret = c.waitReply()
+			fmt.Printf("%s\n", colorReply(ret, resp.FormatReply(ret, 0)))
 		}
 	}
 }
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/resp"
+	"testing"
+)
+
+func TestClientReconnect(t *testing.T) {
+	addr := startServer(t)
+
+	c, err := Dial(addr)
+	assert.Nil(t, err)
+	defer c.Close()
+	admin, err := Dial(addr)
+	assert.Nil(t, err)
+	defer admin.Close()
+
+	execute := func(args ...string) resp.RedisData {
+		command := make([][]byte, len(args))
+		for i := range args {
+			command[i] = []byte(args[i])
+		}
+		ret, err := c.execute(command)
+		assert.Nil(t, err)
+		return ret
+	}
+
+	_, err = admin.Do("acl", "setuser", "alice", "on", ">secret", "~.*", "+@all")
+	assert.Nil(t, err)
+
+	_, ok := execute("auth", "alice", "secret").(*resp.ErrorData)
+	assert.False(t, ok)
+	_, ok = execute("hello", "2", "setname", "repl").(*resp.ArrayData)
+	assert.True(t, ok)
+	execute("select", "2")
+	execute("set", "k", "v")
+
+	// 服务端断开连接之后，下一条命令会重新连接并恢复会话状态
+	_, err = admin.Do("client", "kill", c.conn.LocalAddr().String())
+	assert.Nil(t, err)
+
+	s, err := String(execute("get", "k"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", s)
+
+	s, err = String(execute("acl", "whoami"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", s)
+
+	list, err := String(admin.Do("client", "list"))
+	assert.Nil(t, err)
+	assert.Contains(t, list, "addr="+c.conn.LocalAddr().String()+" name=repl db=2 ")
+
+	// 事务中断开连接时不会重试，之前入队的命令已经被服务端丢弃
+	execute("multi")
+	execute("set", "k", "queued")
+	_, err = admin.Do("client", "kill", c.conn.LocalAddr().String())
+	assert.Nil(t, err)
+
+	command := [][]byte{[]byte("set"), []byte("k"), []byte("lost")}
+	_, err = c.execute(command)
+	assert.NotNil(t, err)
+	assert.False(t, c.isInTx())
+
+	s, err = String(execute("get", "k"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", s)
+
+	// EXEC 同样不会在新的连接上重试
+	execute("multi")
+	execute("set", "k", "queued")
+	_, err = admin.Do("client", "kill", c.conn.LocalAddr().String())
+	assert.Nil(t, err)
+
+	_, err = c.execute([][]byte{[]byte("exec")})
+	assert.EqualError(t, err, "connection lost, transaction discarded")
+	assert.False(t, c.isInTx())
+
+	s, err = String(execute("get", "k"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", s)
+}
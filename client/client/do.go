@@ -0,0 +1,101 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tangrc99/MemTable/resp"
+	"net"
+	"strconv"
+)
+
+// Error 是服务端返回的错误回复
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Dial 连接到 addr 并返回一个客户端，addr 的格式为 host:port
+func Dial(addr string) (*Client, error) {
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid port %s", portStr))
+	}
+
+	c := NewClient(WithHost(host), WithPort(port))
+	if err = c.Dial(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close 关闭客户端的连接
+func (c *Client) Close() error {
+	if !c.isConnected() {
+		return nil
+	}
+	c.toDisconnected()
+	return c.conn.Close()
+}
+
+// Do 发送一条命令并等待回复，如果服务端返回错误回复，会同时返回 Error
+func (c *Client) Do(args ...string) (resp.RedisData, error) {
+
+	replies, err := c.Pipeline(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := replies[0].(*resp.ErrorData); ok {
+		return replies[0], Error(e.Error())
+	}
+	return replies[0], nil
+}
+
+// Pipeline 一次性发送多条命令，然后按照顺序读取每一条命令的回复。服务端的错误回复不会中断读取，需要调用者检查
+func (c *Client) Pipeline(commands ...[]string) ([]resp.RedisData, error) {
+
+	if !c.isConnected() {
+		return nil, errors.New("not connected")
+	}
+
+	msg := make([]byte, 0)
+	for _, command := range commands {
+		if len(command) == 0 {
+			return nil, errors.New("empty command")
+		}
+		lines := make([]resp.RedisData, len(command))
+		for i := range command {
+			lines[i] = resp.MakeBulkData([]byte(command[i]))
+		}
+		msg = append(msg, resp.MakeArrayData(lines).ToBytes()...)
+	}
+
+	for i := 0; i < len(msg); {
+		n, err := c.conn.Write(msg[i:])
+		if err != nil {
+			c.toDisconnected()
+			return nil, err
+		}
+		i += n
+	}
+
+	replies := make([]resp.RedisData, len(commands))
+	for i := range replies {
+		parsed := c.parser.Parse()
+		if parsed.Abort {
+			c.toDisconnected()
+			return nil, errors.New("connection closed")
+		} else if parsed.Err != nil {
+			c.toDisconnected()
+			return nil, parsed.Err
+		}
+		replies[i] = parsed.Data
+	}
+	return replies, nil
+}
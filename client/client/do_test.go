@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/config"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/server"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startServer 在随机端口上启动一个服务端，并返回服务端地址
+func startServer(t *testing.T) string {
+	_ = logger.Init("", "", logger.WARNING)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	_ = l.Close()
+
+	config.Conf.Host = "127.0.0.1"
+	config.Conf.Port = port
+	config.Conf.AppendOnly = false
+	config.Conf.Dir = t.TempDir()
+
+	s := server.NewServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = s.StartContext(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	return addr
+}
+
+func TestClientDo(t *testing.T) {
+	addr := startServer(t)
+
+	c, err := Dial(addr)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	s, err := String(c.Do("set", "k", "v"))
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", s)
+
+	s, err = String(c.Do("get", "k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", s)
+
+	_, err = c.Do("set", "counter", "0")
+	assert.Nil(t, err)
+
+	n, err := Int64(c.Do("incr", "counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	n, err = Int64(c.Do("incrby", "counter", "10"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), n)
+
+	// 服务端的错误回复会转换为 Error
+	_, err = c.Do("incr", "k")
+	_, ok := err.(Error)
+	assert.True(t, ok)
+
+	_, err = c.Do("rpush", "list", "a", "b")
+	assert.Nil(t, err)
+	values, err := Strings(c.Do("lrange", "list", "0", "-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, values)
+
+	// 空数组回复
+	_, err = Strings(c.Do("lrange", "none", "0", "-1"))
+	assert.Equal(t, ErrNil, err)
+}
+
+func TestClientPipeline(t *testing.T) {
+	addr := startServer(t)
+
+	c, err := Dial(addr)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	replies, err := c.Pipeline(
+		[]string{"set", "k", "1"},
+		[]string{"incr", "k"},
+		[]string{"nosuchcommand"},
+		[]string{"get", "k"},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(replies))
+
+	s, err := String(replies[0], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", s)
+
+	n, err := Int64(replies[1], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	n, err = Int64(replies[3], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	_, err = c.Pipeline([]string{})
+	assert.NotNil(t, err)
+
+	_ = c.Close()
+	_, err = c.Do("get", "k")
+	assert.NotNil(t, err)
+}
+
+func TestClientDialError(t *testing.T) {
+	_, err := Dial("127.0.0.1")
+	assert.NotNil(t, err)
+}
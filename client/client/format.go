@@ -0,0 +1,13 @@
+package client
+
+import (
+	"github.com/tangrc99/MemTable/resp"
+)
+
+// colorReply 在交互模式下将错误回复显示为红色
+func colorReply(data resp.RedisData, formatted string) string {
+	if _, ok := data.(*resp.ErrorData); ok {
+		return "\033[31m" + formatted + "\033[0m"
+	}
+	return formatted
+}
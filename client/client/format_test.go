@@ -0,0 +1,16 @@
+package client
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/resp"
+	"testing"
+)
+
+func TestColorReply(t *testing.T) {
+
+	err := resp.MakeErrorData("ERR wrong")
+	assert.Equal(t, "\033[31m(error) ERR wrong\033[0m", colorReply(err, resp.FormatReply(err, 0)))
+
+	ok := resp.MakeStringData("OK")
+	assert.Equal(t, "OK", colorReply(ok, resp.FormatReply(ok, 0)))
+}
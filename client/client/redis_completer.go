@@ -9,10 +9,17 @@ func AddRedisCompletions(completer *readline.Completer) {
 	completer.Register(readline.NewHint("del", "del key [key ...]"))
 	completer.Register(readline.NewHint("exists", "exists key [key ...]"))
 	completer.Register(readline.NewHint("keys", "keys [pattern]"))
+	completer.Register(readline.NewHint("scan", "scan cursor [MATCH pattern] [COUNT count] [TYPE type]"))
 	completer.Register(readline.NewHint("ttl", "ttl key"))
-	completer.Register(readline.NewHint("expire", "expire key seconds"))
-	completer.Register(readline.NewHint("pexpire", "pexpire key milliseconds"))
+	completer.Register(readline.NewHint("expire", "expire key seconds [NX|XX|GT|LT]"))
+	completer.Register(readline.NewHint("expireat", "expireat key unix-time-seconds [NX|XX|GT|LT]"))
+	completer.Register(readline.NewHint("pexpire", "pexpire key milliseconds [NX|XX|GT|LT]"))
+	completer.Register(readline.NewHint("pexpireat", "pexpireat key unix-time-milliseconds [NX|XX|GT|LT]"))
 	completer.Register(readline.NewHint("rename", "rename key newkey"))
+	completer.Register(readline.NewHint("dump", "dump key"))
+	completer.Register(readline.NewHint("restore", "restore key ttl serialized-value [REPLACE] [ABSTTL]"))
+	completer.Register(readline.NewHint("copy", "copy source destination [DB destination-db] [REPLACE]"))
+	completer.Register(readline.NewHint("migrate", "migrate host port key destination-db timeout [COPY] [REPLACE]"))
 	completer.Register(readline.NewHint("type", "type key"))
 	completer.Register(readline.NewHint("randomkey", "randomkey"))
 
@@ -20,13 +27,16 @@ func AddRedisCompletions(completer *readline.Completer) {
 	completer.Register(readline.NewHint("set", "set key value"))
 	completer.Register(readline.NewHint("get", "get key"))
 	completer.Register(readline.NewHint("getset", "getset key value"))
+	completer.Register(readline.NewHint("getex", "getex key [EX seconds|PX milliseconds|EXAT timestamp|PXAT timestamp|PERSIST]"))
 	completer.Register(readline.NewHint("strlen", "strlen key"))
 	completer.Register(readline.NewHint("getrange", "getrange key start end"))
 	completer.Register(readline.NewHint("setrange", "setrange key offset value"))
 	completer.Register(readline.NewHint("mget", "mget key [key ...]"))
+	completer.Register(readline.NewHint("lcs", "lcs key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]"))
 	completer.Register(readline.NewHint("mset", "mset key value [key value ...]"))
 	completer.Register(readline.NewHint("incr", "incr key"))
 	completer.Register(readline.NewHint("incrby", "incrby key increment"))
+	completer.Register(readline.NewHint("incrbyfloat", "incrbyfloat key increment"))
 	completer.Register(readline.NewHint("decr", "decr key"))
 	completer.Register(readline.NewHint("decrby", "decrby key decrement"))
 	completer.Register(readline.NewHint("append", "append key value"))
@@ -45,6 +55,10 @@ func AddRedisCompletions(completer *readline.Completer) {
 	completer.Register(readline.NewHint("hlen", ""))
 	completer.Register(readline.NewHint("hstrlen", ""))
 	completer.Register(readline.NewHint("hrandfield", ""))
+	completer.Register(readline.NewHint("hexpire", "hexpire key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]"))
+	completer.Register(readline.NewHint("hexpireat", "hexpireat key unix-time-seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]"))
+	completer.Register(readline.NewHint("httl", "httl key FIELDS numfields field [field ...]"))
+	completer.Register(readline.NewHint("hpersist", "hpersist key FIELDS numfields field [field ...]"))
 
 	/////////////// list /////////////////
 	completer.Register(readline.NewHint("llen", "llen key"))
@@ -96,7 +110,8 @@ func AddRedisCompletions(completer *readline.Completer) {
 	completer.Register(readline.NewHint("setbit", "setbit key offset value"))
 	completer.Register(readline.NewHint("getbit", "getbit key offset"))
 	completer.Register(readline.NewHint("bitcount", "bitcount key [start end]"))
-	completer.Register(readline.NewHint("bitpos", "bitpos key bit [start] [end]"))
+	completer.Register(readline.NewHint("bitpos", "bitpos key bit [start [end [BYTE|BIT]]]"))
+	completer.Register(readline.NewHint("bitfield", "bitfield key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]"))
 
 	/////////////// bloom_filter /////////////////
 	completer.Register(readline.NewHint("bf.add", ""))
@@ -117,6 +132,7 @@ func AddRedisCompletions(completer *readline.Completer) {
 	completer.Register(readline.NewHint("ping", "ping [message]"))
 	completer.Register(readline.NewHint("quit", "quit -"))
 	completer.Register(readline.NewHint("select", "select index"))
+	completer.Register(readline.NewHint("reset", "reset"))
 	completer.Register(readline.NewHint("monitor", "monitor -"))
 
 	/////////////// pubsub /////////////////
@@ -131,6 +147,8 @@ func AddRedisCompletions(completer *readline.Completer) {
 	completer.Register(readline.NewHint("psync", "psync replicationid offset"))
 	completer.Register(readline.NewHint("replconf", "replconf"))
 	completer.Register(readline.NewHint("slaveof", "slaveof host port"))
+	completer.Register(readline.NewHint("wait", "wait numreplicas timeout"))
+	completer.Register(readline.NewHint("role", "role"))
 
 	/////////////// script /////////////////
 	completer.Register(readline.NewHint("eval", "eval script numkeys key [key ...] arg [arg ...]"))
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tangrc99/MemTable/resp"
+	"strconv"
+)
+
+// ErrNil 代表服务端返回了空回复
+var ErrNil = errors.New("nil reply")
+
+// String 将回复转换为 string，可以直接接收 Do 的返回值
+func String(reply resp.RedisData, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	switch r := reply.(type) {
+	case *resp.BulkData:
+		if r.Data() == nil {
+			return "", ErrNil
+		}
+		return string(r.Data()), nil
+	case *resp.StringData:
+		return r.Data(), nil
+	case *resp.PlainData:
+		return r.Data(), nil
+	case *resp.IntData:
+		return strconv.FormatInt(r.Data(), 10), nil
+	}
+	return "", errors.New(fmt.Sprintf("unexpected reply type %T for String", reply))
+}
+
+// Int64 将回复转换为 int64，字符串回复会被解析为整数
+func Int64(reply resp.RedisData, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	if r, ok := reply.(*resp.IntData); ok {
+		return r.Data(), nil
+	}
+
+	s, err := String(reply, nil)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// Float64 将回复转换为 float64
+func Float64(reply resp.RedisData, err error) (float64, error) {
+	s, err := String(reply, err)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Strings 将数组回复转换为 []string，数组中的空回复会被转换为空字符串
+func Strings(reply resp.RedisData, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	array, ok := reply.(*resp.ArrayData)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unexpected reply type %T for Strings", reply))
+	}
+	if array.Data() == nil {
+		return nil, ErrNil
+	}
+
+	values := make([]string, len(array.Data()))
+	for i, data := range array.Data() {
+		s, err := String(data, nil)
+		if err != nil && err != ErrNil {
+			return nil, err
+		}
+		values[i] = s
+	}
+	return values, nil
+}
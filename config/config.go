@@ -21,6 +21,7 @@ type Config struct {
 	CertFile   string
 	KeyFile    string
 	CaCertFile string
+	UnixSocket string
 	LogDir     string
 	LogLevel   string
 
@@ -30,7 +31,7 @@ type Config struct {
 	Dir         string
 	MaxClients  int
 	MaxMemory   uint64
-	AppendFsync bool
+	AppendFsync string // aof 刷盘策略，always、everysec 或 no
 	AppendOnly  bool
 	GoPool      bool
 	GoPoolSize  int
@@ -47,7 +48,32 @@ type Config struct {
 	SlowLogMaxLen     int
 	SlowLogSlowerThan int64
 
+	LatencyMonitorThreshold int64 // 延迟尖峰的阈值，单位为毫秒，为 0 时不记录
+
+	Hz int // 每秒执行定时任务的次数
+
 	ACLFile string
+
+	ProxyProtocol bool
+
+	ClientMaxInflight int64 // 单个连接中尚未执行的命令最多占用的字节数，小于等于 0 时不限制
+
+	TCPKeepAlive  int // TCP keepalive 的间隔，单位为秒，为 0 时关闭
+	KeepAlivePing int // 向空闲客户端发送 PING 的间隔，单位为秒，为 0 时不发送
+
+	StartupFile string // 启动时在接受连接之前执行的命令文件
+
+	RenameCommands [][2]string // rename-command 配置的原始名称以及新名称，新名称为空时禁用命令
+
+	EnableDebugCommand bool // 是否允许通过 DEBUG 命令修改内部参数，仅用于测试
+
+	MetricsAddr string // Prometheus 指标的 HTTP 监听地址，为空时不开启
+
+	ProtoMaxBulkLen int64 // 单个字符串允许的最大字节数
+
+	MaxReplyElements int // KEYS、SMEMBERS 等命令一次最多返回的元素数量，0 代表不限制
+
+	CommandTimeBudget int64 // SINTER 等耗时的读命令最多占用事件循环的毫秒数，0 代表不限制
 }
 
 // Conf 变量存储从配置文件读取到的配置，如果配置不存在则使用默认配置
@@ -124,15 +150,118 @@ func (cfg *Config) parseFile() error {
 
 			} else if cfgName == "tls-cert-file" {
 
-				cfg.CertFile = strings.ToLower(fields[1])
+				cfg.CertFile = fields[1]
 
 			} else if cfgName == "tls-key-file" {
 
-				cfg.KeyFile = strings.ToLower(fields[1])
+				cfg.KeyFile = fields[1]
 
 			} else if cfgName == "tls-ca-cert-file" {
 
-				cfg.CaCertFile = strings.ToLower(fields[1])
+				cfg.CaCertFile = fields[1]
+
+			} else if cfgName == "proxy-protocol" {
+
+				proxy, err := strconv.ParseBool(fields[1])
+				if err != nil {
+					return err
+				}
+				cfg.ProxyProtocol = proxy
+
+			} else if cfgName == "client-max-inflight-bytes" {
+
+				limit, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil {
+					return err
+				}
+				cfg.ClientMaxInflight = limit
+
+			} else if cfgName == "tcp-keepalive" {
+
+				period, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return err
+				}
+				if period < 0 {
+					return &Error{"tcp-keepalive < 0"}
+				}
+				cfg.TCPKeepAlive = period
+
+			} else if cfgName == "keepalive-ping" {
+
+				period, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return err
+				}
+				if period < 0 {
+					return &Error{"keepalive-ping < 0"}
+				}
+				cfg.KeepAlivePing = period
+
+			} else if cfgName == "metrics-addr" {
+
+				if _, _, err := net.SplitHostPort(fields[1]); err != nil {
+					return &Error{fmt.Sprintf("Given metrics address %s is invalid", fields[1])}
+				}
+				cfg.MetricsAddr = fields[1]
+
+			} else if cfgName == "proto-max-bulk-len" {
+
+				limit, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil {
+					return err
+				}
+				if limit <= 0 {
+					return &Error{"proto-max-bulk-len <= 0"}
+				}
+				cfg.ProtoMaxBulkLen = limit
+
+			} else if cfgName == "max-reply-elements" {
+
+				limit, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return err
+				}
+				if limit < 0 {
+					return &Error{"max-reply-elements < 0"}
+				}
+				cfg.MaxReplyElements = limit
+
+			} else if cfgName == "command-time-budget" {
+
+				budget, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil {
+					return err
+				}
+				if budget < 0 {
+					return &Error{"command-time-budget < 0"}
+				}
+				cfg.CommandTimeBudget = budget
+
+			} else if cfgName == "unixsocket" {
+
+				cfg.UnixSocket = fields[1]
+
+			} else if cfgName == "startup-file" {
+
+				cfg.StartupFile = fields[1]
+
+			} else if cfgName == "enable-debug-command" {
+
+				enable, err := strconv.ParseBool(fields[1])
+				if err != nil {
+					return err
+				}
+				cfg.EnableDebugCommand = enable
+
+			} else if cfgName == "rename-command" {
+
+				// rename-command FLUSHALL "" 代表禁用该命令
+				newName := ""
+				if len(fields) >= 3 && fields[2] != `""` {
+					newName = strings.ToLower(fields[2])
+				}
+				cfg.RenameCommands = append(cfg.RenameCommands, [2]string{strings.ToLower(fields[1]), newName})
 
 			} else if cfgName == "logdir" {
 
@@ -189,6 +318,14 @@ func (cfg *Config) parseFile() error {
 
 			} else if cfgName == "appendfsync" {
 
+				policy := strings.ToLower(fields[1])
+				switch policy {
+				case "always", "everysec", "no":
+				default:
+					return &Error{"unknown appendfsync policy " + fields[1]}
+				}
+				cfg.AppendFsync = policy
+
 			} else if cfgName == "appendonly" {
 
 				appendonly, err := strconv.ParseBool(fields[1])
@@ -253,9 +390,15 @@ func (cfg *Config) parseFile() error {
 
 				cfg.ClusterName = strings.ToLower(fields[1])
 
-			} else if cfgName == "eviction" {
+			} else if cfgName == "eviction" || cfgName == "maxmemory-policy" {
 
-				cfg.ClusterName = strings.ToLower(fields[1])
+				policy := strings.ToLower(fields[1])
+				switch policy {
+				case "no", "lru", "lfu", "noeviction", "allkeys-lru", "allkeys-lfu", "volatile-ttl":
+				default:
+					return &Error{"unknown maxmemory-policy " + fields[1]}
+				}
+				cfg.Eviction = policy
 
 			} else if cfgName == "slowlog-log-slower-than" {
 
@@ -265,6 +408,25 @@ func (cfg *Config) parseFile() error {
 				}
 				cfg.SlowLogSlowerThan = int64(slow)
 
+			} else if cfgName == "hz" {
+
+				hz, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return err
+				}
+				if hz < 1 || hz > 500 {
+					return &Error{fmt.Sprintf("hz should between 1 and 500, but %d is given.", hz)}
+				}
+				cfg.Hz = hz
+
+			} else if cfgName == "latency-monitor-threshold" {
+
+				threshold, err := strconv.Atoi(fields[1])
+				if err != nil {
+					return err
+				}
+				cfg.LatencyMonitorThreshold = int64(threshold)
+
 			} else if cfgName == "slowlog-max-len" {
 
 				max, err := strconv.Atoi(fields[1])
@@ -327,6 +489,10 @@ func (cfg *Config) parseFlags() {
 
 			cfg.LogLevel = strings.ToLower(os.Args[i+1])
 
+		} else if os.Args[i] == "--eval-file" {
+
+			cfg.StartupFile = os.Args[i+1]
+
 		}
 
 	}
@@ -346,7 +512,7 @@ var defaultConf = Config{
 	Daemonize:   false,
 	Dir:         "./",
 	MaxMemory:   1<<64 - 1,
-	AppendFsync: true,
+	AppendFsync: "everysec",
 	AppendOnly:  true,
 	GoPool:      true,
 	GoPoolSize:  10000,
@@ -357,10 +523,17 @@ var defaultConf = Config{
 	ClusterEnable: false,
 	ClusterName:   "",
 
-	Eviction: "no",
+	Eviction: "noeviction",
 
 	SlowLogMaxLen:     100,
 	SlowLogSlowerThan: 10000, // 1000 us
+
+	Hz: 10,
+
+	ClientMaxInflight: 1 << 30,
+	TCPKeepAlive:      300,
+
+	ProtoMaxBulkLen: 512 * 1024 * 1024,
 }
 
 // init 函数会在包初始化阶段将配置文件内容读取到 Conf 变量中
@@ -374,7 +547,7 @@ func init() {
 	if Conf.TLSPort == Conf.Port {
 		panic(fmt.Sprintf("Err tls-port %d == port %d", Conf.TLSPort, Conf.Port))
 	}
-	if Conf.TLSPort != 0 && Conf.CaCertFile == "" {
+	if Conf.TLSPort != 0 && Conf.AuthClient && Conf.CaCertFile == "" {
 		panic(fmt.Sprintf("Err empty tls-ca-cert-file"))
 	}
 	if Conf.TLSPort != 0 && Conf.KeyFile == "" {
@@ -12,20 +12,20 @@ const channelBasicCost = int64(unsafe.Sizeof(channel{}))
 
 // channel 是用于实现 pub/sub 功能的结构体，它维护一个订阅信息表
 type channel struct {
-	subscriber map[string]*chan []byte
+	subscriber map[string]func(msg []byte)
 	cost       int64
 }
 
 // newChannel 创建一个 channel 实例并返回指针
 func newChannel() *channel {
 	return &channel{
-		subscriber: make(map[string]*chan []byte),
+		subscriber: make(map[string]func(msg []byte)),
 		cost:       channelBasicCost,
 	}
 }
 
-// subscribe 注册一个订阅信息
-func (ch *channel) subscribe(owner string, notify *chan []byte) {
+// subscribe 注册一个订阅信息，发布消息时会调用 notify
+func (ch *channel) subscribe(owner string, notify func(msg []byte)) {
 	ch.subscriber[owner] = notify
 	ch.cost += int64(len(owner) + 8)
 }
@@ -37,10 +37,10 @@ func (ch *channel) unSubscribe(owner string) int {
 	return len(ch.subscriber)
 }
 
-// publish 将信息发布到所有的订阅者频道
+// publish 将信息发布给所有的订阅者
 func (ch *channel) publish(msg []byte) int {
-	for _, sub := range ch.subscriber {
-		*sub <- msg
+	for _, notify := range ch.subscriber {
+		notify(msg)
 	}
 	return len(ch.subscriber)
 }
@@ -96,8 +96,9 @@ func (chs *Channels) publishPath(ch string, msg []byte) int {
 	return pubs
 }
 
-// Subscribe 订阅指定的频道，如果频道是一个路径，那么同时也会接收上一级父目录发布的消息
-func (chs *Channels) Subscribe(channel string, owner string, notify *chan []byte) {
+// Subscribe 订阅指定的频道，如果频道是一个路径，那么同时也会接收上一级父目录发布的消息。
+// 发布消息时会在发布者的协程中调用 notify
+func (chs *Channels) Subscribe(channel string, owner string, notify func(msg []byte)) {
 
 	if channel[0] == '/' {
 		chs.subscribePath(channel, owner, notify)
@@ -116,7 +117,7 @@ func (chs *Channels) Subscribe(channel string, owner string, notify *chan []byte
 	chs.cost += ch.Cost()
 }
 
-func (chs *Channels) subscribePath(ch string, owner string, notify *chan []byte) {
+func (chs *Channels) subscribePath(ch string, owner string, notify func(msg []byte)) {
 
 	paths := strings.Split(ch, "/")
 
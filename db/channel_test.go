@@ -9,7 +9,7 @@ func TestChannel(t *testing.T) {
 
 	ch := newChannel()
 	receiver := make(chan []byte, 1)
-	ch.subscribe("u1", &receiver)
+	ch.subscribe("u1", func(msg []byte) { receiver <- msg })
 	assert.Equal(t, 1, ch.publish([]byte("msg")))
 	assert.Equal(t, []byte("msg"), <-receiver)
 
@@ -23,7 +23,7 @@ func TestChannelsSingle(t *testing.T) {
 	ch := NewChannels()
 	receiver := make(chan []byte, 1)
 
-	ch.Subscribe("ch1", "u1", &receiver)
+	ch.Subscribe("ch1", "u1", func(msg []byte) { receiver <- msg })
 	assert.Equal(t, 1, ch.Publish("ch1", []byte("msg")))
 	assert.Equal(t, []byte("msg"), <-receiver)
 
@@ -37,7 +37,7 @@ func TestChannelsPath(t *testing.T) {
 	ch := NewChannels()
 	receiver := make(chan []byte, 1)
 
-	ch.Subscribe("/a/b", "u1", &receiver)
+	ch.Subscribe("/a/b", "u1", func(msg []byte) { receiver <- msg })
 
 	assert.Equal(t, 1, ch.Publish("/a/b", []byte("msg")))
 	assert.Equal(t, []byte("msg"), <-receiver)
@@ -4,7 +4,9 @@ import (
 	"github.com/tangrc99/MemTable/db"
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
 	"strconv"
+	"strings"
 )
 
 func setbit(db *db.DataBase, cmd [][]byte) resp.RedisData {
@@ -24,13 +26,17 @@ func setbit(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		if err := checkType(value, STRING); err != nil {
 			return err
 		}
-		byteVal = value.(structure.Slice)
+		// 共享的整数不能在原地修改
+		byteVal = structure.Unshare(value.(structure.Slice))
 	}
 
 	pos, err := strconv.Atoi(string(cmd[2]))
-	if err != nil {
+	if err != nil || pos < 0 {
 		return resp.MakeErrorData("ERR bit offset is not an integer or out of range")
 	}
+	if err := checkStringLength(int64(pos)/8, 1); err != nil {
+		return err
+	}
 
 	bitVal, err := strconv.Atoi(string(cmd[3]))
 	if err != nil {
@@ -94,7 +100,7 @@ func bitcount(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	if len(cmd) == 3 {
-		return resp.MakeErrorData("ERR syntax error")
+		return resp.SyntaxError()
 	}
 
 	start := 0
@@ -122,6 +128,7 @@ func bitcount(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeIntData(int64(count))
 }
 
+// bitpos 命令格式： bitpos key bit [start [end [byte|bit]]]
 func bitpos(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	e, ok := checkCommandAndLength(&cmd, "bitpos", 3)
@@ -129,20 +136,13 @@ func bitpos(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
-		return resp.MakeIntData(-1)
-	}
-
-	// 进行类型检查，会自动检查过期选项
-	if err := checkType(value, STRING); err != nil {
-		return err
-	}
-
 	bitVal, err := strconv.Atoi(string(cmd[2]))
 	if err != nil {
 		return resp.MakeErrorData("ERR bit offset is not an integer or out of range")
 	}
+	if bitVal != 0 && bitVal != 1 {
+		return resp.MakeErrorData("ERR The bit argument must be 1 or 0.")
+	}
 
 	start := 0
 	end := -1
@@ -153,10 +153,10 @@ func bitpos(db *db.DataBase, cmd [][]byte) resp.RedisData {
 			return resp.MakeErrorData("ERR start is not an integer or out of range")
 		}
 		start = s
-
 	}
 
-	if len(cmd) == 5 {
+	endGiven := len(cmd) >= 5
+	if endGiven {
 		e, err := strconv.Atoi(string(cmd[4]))
 		if err != nil {
 			return resp.MakeErrorData("ERR end is not an integer or out of range")
@@ -164,155 +164,309 @@ func bitpos(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		end = e
 	}
 
-	bm := structure.NewBitMapFromBytes(value.(structure.Slice))
-
-	pos := bm.Pos(byte(bitVal), start, end)
-
-	return resp.MakeIntData(int64(pos))
-}
-
-func registerBitMapCommands() {
-	registerCommand("setbit", setbit, WR)
-	registerCommand("getbit", getbit, RD)
-	registerCommand("bitcount", bitcount, RD)
-	registerCommand("bitpos", bitpos, RD)
-}
-
-/*
-func bitfield(db *db.DataBase, cmd [][]byte) resp.RedisData {
-
-	// 进行输入类型检查
-	e, ok := checkCommandAndLength(&cmd, "bitfield", 3)
-	if !ok {
-		return e
+	isBit := false
+	if len(cmd) == 6 {
+		switch strings.ToLower(string(cmd[5])) {
+		case "byte":
+		case "bit":
+			isBit = true
+		default:
+			return resp.SyntaxError()
+		}
+	} else if len(cmd) > 6 {
+		return resp.SyntaxError()
 	}
 
 	value, ok := db.GetKey(string(cmd[1]))
 	if !ok {
-		return resp.MakeIntData(-1)
+		// 不存在的 key 视为全部为 0
+		if bitVal == 1 {
+			return resp.MakeIntData(-1)
+		}
+		return resp.MakeIntData(0)
 	}
 
 	// 进行类型检查，会自动检查过期选项
-	if errors := checkType(value, STRING); errors != nil {
-		return errors
+	if err := checkType(value, STRING); err != nil {
+		return err
 	}
 
-	if len(cmd) == 2 {
-		return resp.MakeEmptyArrayData()
-	}
+	bm := structure.NewBitMapFromBytes(value.(structure.Slice))
 
-	commands := make([][]any, 0)
+	var pos int
+	if isBit {
+		pos = bm.PosBit(byte(bitVal), start, end)
+	} else {
+		pos = bm.Pos(byte(bitVal), start, end)
+	}
 
-	// 先解析命令
-	cmdLen := len(cmd)
-	for i := 2; i < cmdLen; {
+	// 查找 0 并且没有指定 end 时，字符串右侧视为用 0 填充，因此返回字符串之后的第一个 bit
+	if pos == -1 && bitVal == 0 && !endGiven {
+		if bitposStartInRange(start, bm, isBit) {
+			pos = bm.ByteLen() * 8
+		}
+	}
 
-		if strings.ToLower(string(cmd[i])) == "get" {
+	return resp.MakeIntData(int64(pos))
+}
 
-			commands = append(commands, make([]any, 4))
-			commands[i-2][0] = "get"
+// bitposStartInRange 检查 bitpos 的 start 是否位于字符串的范围内
+func bitposStartInRange(start int, bm *structure.BitMap, isBit bool) bool {
+	maxLen := bm.ByteLen()
+	if isBit {
+		maxLen *= 8
+	}
+	if start < 0 {
+		start += maxLen
+	}
+	return start < maxLen
+}
 
-			if cmdLen-i < 3 {
-				return resp.MakeErrorData("ERR wrong number of arguments for 'bitfield' command")
-			}
+// bitfield 的整数类型，与 redis 相同，支持 i1 ~ i64 以及 u1 ~ u63
+type bitfieldType struct {
+	signed bool
+	bits   int
+}
 
-			commands[i-2][1] = string(cmd[i+1][0])
-			if commands[i-2][1] != "u" && commands[i-2][1] != "i" {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
+// bitfield 的溢出处理方式
+const (
+	bitfieldWrap = iota // 回绕
+	bitfieldSat         // 饱和到最大值或最小值
+	bitfieldFail        // 不进行修改并返回 nil
+)
 
-			nums, errors := strconv.Atoi(string(cmd[i+1][1:]))
-			if errors != nil || nums >= 64 || (commands[i-2][1] == "u" && nums == 64) {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
-			commands[i-2][2] = nums
+// bitfieldMaxOffset 是 bitfield 允许的最大 bit 位置，与 redis 中 512MB 的字符串上限相同
+const bitfieldMaxOffset = 512*1024*1024*8 - 1
 
-			pos, errors := strconv.Atoi(string(cmd[i+2]))
-			if errors != nil {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
+// bitfieldOp 是 bitfield 命令中的一个子操作
+type bitfieldOp struct {
+	op       string
+	typ      bitfieldType
+	offset   int
+	value    int64
+	overflow int
+}
 
-			commands[i-2][3] = pos
-			i += 3
+// parseBitfieldType 解析 i16、u8 形式的整数类型
+func parseBitfieldType(arg []byte) (bitfieldType, bool) {
+	t := bitfieldType{}
+	if len(arg) < 2 {
+		return t, false
+	}
+	switch arg[0] {
+	case 'i', 'I':
+		t.signed = true
+	case 'u', 'U':
+	default:
+		return t, false
+	}
+	bits, err := strconv.Atoi(string(arg[1:]))
+	if err != nil || bits < 1 || bits > 64 || (!t.signed && bits == 64) {
+		return t, false
+	}
+	t.bits = bits
+	return t, true
+}
 
-		} else if strings.ToLower(string(cmd[i])) == "set" {
+// parseBitfieldOffset 解析 bit 位置，#N 表示第 N 个该类型的整数，即 N 乘以类型的位数
+func parseBitfieldOffset(arg []byte, t bitfieldType) (int, bool) {
+	multiply := 1
+	if len(arg) > 0 && arg[0] == '#' {
+		multiply = t.bits
+		arg = arg[1:]
+	}
+	offset, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil || offset < 0 || offset > bitfieldMaxOffset/int64(multiply) {
+		return 0, false
+	}
+	offset *= int64(multiply)
+	if offset+int64(t.bits)-1 > bitfieldMaxOffset {
+		return 0, false
+	}
+	return int(offset), true
+}
 
-			commands = append(commands, make([]any, 4))
-			commands[i-2][0] = "set"
+// get 从 bitmap 中读取整数，有符号整数会进行符号扩展
+func (t bitfieldType) get(bm *structure.BitMap, offset int) int64 {
+	v := bm.GetBits(offset, t.bits)
+	if t.signed {
+		return int64(v<<(64-t.bits)) >> (64 - t.bits)
+	}
+	return int64(v)
+}
 
-			if cmdLen-i < 4 {
-				return resp.MakeErrorData("ERR wrong number of arguments for 'bitfield' command")
-			}
+// add 计算 value + incr 并按照 overflow 处理溢出，返回结果以及是否发生了溢出
+func (t bitfieldType) add(value, incr int64, overflow int) (int64, bool) {
 
-			commands[i-2][1] = string(cmd[i+1][0])
-			if commands[i-2][1] != "u" && commands[i-2][1] != "i" {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
+	var max, min int64
+	var up, down bool
 
-			nums, errors := strconv.Atoi(string(cmd[i+1][1:]))
-			if errors != nil || nums >= 64 || (commands[i-2][1] == "u" && nums == 64) {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
-			commands[i-2][2] = nums
+	if t.signed {
+		max = int64(uint64(1)<<(t.bits-1) - 1)
+		min = -max - 1
+		up = value > max || (incr > 0 && value > max-incr)
+		down = !up && (value < min || (incr < 0 && value < min-incr))
+	} else {
+		// 无符号类型的 value 按照 uint64 处理，负数的 set 会视为向上溢出
+		max = int64(uint64(1)<<t.bits - 1)
+		uv := uint64(value)
+		up = uv > uint64(max) || (incr > 0 && uint64(incr) > uint64(max)-uv)
+		down = !up && incr < 0 && uint64(-(incr+1)) >= uv
+	}
 
-			pos, errors := strconv.Atoi(string(cmd[i+2]))
-			if errors != nil {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
+	if !up && !down {
+		return value + incr, false
+	}
 
-			commands[i-2][3] = pos
+	switch overflow {
+	case bitfieldSat:
+		if up {
+			return max, true
+		}
+		return min, true
+	case bitfieldFail:
+		return 0, true
+	}
 
-			val, errors := strconv.Atoi(string(cmd[i+3]))
-			if errors != nil || (commands[i-2][1] == "u" && 2^pos < val) ||
-				(commands[i-2][1] == "i" && float64(2^(pos-1)) < amath.Abs(float64(val))) {
-				return resp.MakeErrorData("ERR value is not an integer or out of range")
-			}
-			commands[i-2][3] = val
+	// 回绕只需要保留低位，有符号整数还需要进行符号扩展
+	wrapped := uint64(value) + uint64(incr)
+	if t.signed {
+		return int64(wrapped<<(64-t.bits)) >> (64 - t.bits), true
+	}
+	return int64(wrapped & uint64(max)), true
+}
 
-			i += 4
+// bitfield 命令格式： bitfield key [get type offset] [set type offset value] [incrby type offset increment] [overflow wrap|sat|fail]
+func bitfield(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := checkCommandAndLength(&cmd, "bitfield", 2)
+	if !ok {
+		return e
+	}
 
-		} else if strings.ToLower(string(cmd[i])) == "incrby" {
+	// 先解析全部的子操作，有错误时不会进行任何修改
+	ops := make([]bitfieldOp, 0)
+	overflow := bitfieldWrap
+	write := false
+
+	for i := 2; i < len(cmd); {
+
+		op := strings.ToLower(string(cmd[i]))
+		args := 0
+
+		switch op {
+		case "get":
+			args = 2
+		case "set", "incrby":
+			args = 3
+			write = true
+		case "overflow":
+			args = 1
+		default:
+			return resp.SyntaxError()
+		}
 
-			commands = append(commands, make([]any, 4))
-			commands[i-2][0] = "set"
+		if i+args >= len(cmd) {
+			return resp.SyntaxError()
+		}
 
-			if cmdLen-i < 4 {
-				return resp.MakeErrorData("ERR wrong number of arguments for 'bitfield' command")
+		if op == "overflow" {
+			switch strings.ToLower(string(cmd[i+1])) {
+			case "wrap":
+				overflow = bitfieldWrap
+			case "sat":
+				overflow = bitfieldSat
+			case "fail":
+				overflow = bitfieldFail
+			default:
+				return resp.MakeErrorData("ERR Invalid OVERFLOW type specified")
 			}
+			i += 2
+			continue
+		}
 
-			commands[i-2][1] = string(cmd[i+1][0])
-			if commands[i-2][1] != "u" && commands[i-2][1] != "i" {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
+		t, ok := parseBitfieldType(cmd[i+1])
+		if !ok {
+			return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		offset, ok := parseBitfieldOffset(cmd[i+2], t)
+		if !ok {
+			return resp.MakeErrorData("ERR bit offset is not an integer or out of range")
+		}
 
-			nums, errors := strconv.Atoi(string(cmd[i+1][1:]))
-			if errors != nil || nums >= 64 || (commands[i-2][1] == "u" && nums == 64) {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		var value int64
+		if args == 3 {
+			v, err := global.ParseInteger(cmd[i+3])
+			if err != nil {
+				return resp.MakeErrorData(err.Error())
 			}
-			commands[i-2][2] = nums
+			value = v
+		}
 
-			pos, errors := strconv.Atoi(string(cmd[i+2]))
-			if errors != nil {
-				return resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
-			}
+		ops = append(ops, bitfieldOp{op: op, typ: t, offset: offset, value: value, overflow: overflow})
+		i += args + 1
+	}
 
-			commands[i-2][3] = pos
+	var byteVal []byte
+	value, ok := db.GetKey(string(cmd[1]))
+	if ok {
+		// 进行类型检查，会自动检查过期选项
+		if err := checkType(value, STRING); err != nil {
+			return err
+		}
+		byteVal = value.(structure.Slice)
+	}
 
-			val, errors := strconv.Atoi(string(cmd[i+3]))
-			if errors != nil || (commands[i-2][1] == "u" && 2^pos < val) ||
-				(commands[i-2][1] == "i" && float64(2^(pos-1)) < amath.Abs(float64(val))) {
-				return resp.MakeErrorData("ERR value is not an integer or out of range")
-			}
-			commands[i-2][3] = val
+	// 写操作需要复制一份，防止修改其他位置引用的内容
+	if write {
+		byteVal = append(make([]byte, 0, len(byteVal)), byteVal...)
+	}
 
-			i += 4
+	bm := structure.NewBitMapFromBytes(byteVal)
+	res := make([]resp.RedisData, len(ops))
+	changed := false
+
+	for i, op := range ops {
+
+		old := op.typ.get(bm, op.offset)
+
+		switch op.op {
+		case "get":
+			res[i] = resp.MakeIntData(old)
 
-		} else {
-			return resp.MakeErrorData("ERR syntax error")
+		case "set":
+			v, overflowed := op.typ.add(op.value, 0, op.overflow)
+			if overflowed && op.overflow == bitfieldFail {
+				res[i] = resp.MakeStringData("nil")
+				continue
+			}
+			bm.SetBits(op.offset, op.typ.bits, uint64(v))
+			changed = true
+			res[i] = resp.MakeIntData(old)
+
+		case "incrby":
+			v, overflowed := op.typ.add(old, op.value, op.overflow)
+			if overflowed && op.overflow == bitfieldFail {
+				res[i] = resp.MakeStringData("nil")
+				continue
+			}
+			bm.SetBits(op.offset, op.typ.bits, uint64(v))
+			changed = true
+			res[i] = resp.MakeIntData(v)
 		}
+	}
 
+	if changed {
+		db.SetKey(string(cmd[1]), (structure.Slice)(*bm))
 	}
 
-	bm := structure.NewBitMapFromBytes(value.([]byte))
+	return resp.MakeArrayData(res)
+}
 
-}*/
+func registerBitMapCommands() {
+	registerCommand("setbit", setbit, WR)
+	registerCommand("getbit", getbit, RD)
+	registerCommand("bitcount", bitcount, RD)
+	registerCommand("bitpos", bitpos, RD)
+	registerCommand("bitfield", bitfield, WR)
+}
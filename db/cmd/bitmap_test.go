@@ -3,8 +3,10 @@ package cmd
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
+	"math"
 	"testing"
 )
 
@@ -64,10 +66,10 @@ func TestCmdBitmap(t *testing.T) {
 			resp.MakeIntData(0)},
 
 		{[][]byte{[]byte("bitpos"), []byte("test"), []byte("1")},
-			resp.MakeIntData(4)},
+			resp.MakeIntData(3)},
 
 		{[][]byte{[]byte("bitpos"), []byte("test"), []byte("1"), []byte("1"), []byte("1")},
-			resp.MakeIntData(12)},
+			resp.MakeIntData(10)},
 
 		{[][]byte{[]byte("bitpos"), []byte("test"), []byte("f"), []byte("1"), []byte("1")},
 			resp.MakeErrorData("ERR bit offset is not an integer or out of range")},
@@ -88,3 +90,113 @@ func TestCmdBitmap(t *testing.T) {
 		assert.Equal(t, test.expected, ret)
 	}
 }
+
+func execArgs(database *db.DataBase, args ...string) resp.RedisData {
+	input := make([][]byte, len(args))
+	for i := range args {
+		input[i] = []byte(args[i])
+	}
+	cmd, _ := global.FindCommand(args[0])
+	return cmd.Function().(command)(database, input)
+}
+
+func TestCmdBitpos(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	// 不存在的 key 视为全部为 0
+	assert.Equal(t, resp.MakeIntData(-1), execArgs(database, "bitpos", "none", "1"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "bitpos", "none", "0"))
+	assert.Equal(t, resp.MakeErrorData("ERR The bit argument must be 1 or 0."), execArgs(database, "bitpos", "none", "2"))
+
+	// 全部为 0 的 key
+	database.SetKey("zero", structure.Slice{0x00, 0x00})
+	assert.Equal(t, resp.MakeIntData(-1), execArgs(database, "bitpos", "zero", "1"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "bitpos", "zero", "0"))
+
+	// 没有指定 end 时，查找 0 会返回字符串之后的第一个 bit；指定了 end 时返回 -1
+	database.SetKey("ones", structure.Slice{0xff, 0xff, 0xff})
+	assert.Equal(t, resp.MakeIntData(24), execArgs(database, "bitpos", "ones", "0"))
+	assert.Equal(t, resp.MakeIntData(24), execArgs(database, "bitpos", "ones", "0", "1"))
+	assert.Equal(t, resp.MakeIntData(-1), execArgs(database, "bitpos", "ones", "0", "0", "-1"))
+	assert.Equal(t, resp.MakeIntData(-1), execArgs(database, "bitpos", "ones", "0", "10"))
+
+	// 与 redis 相同，byte 的高位在前
+	database.SetKey("key", structure.Slice{0xff, 0xf0, 0x00})
+	assert.Equal(t, resp.MakeIntData(12), execArgs(database, "bitpos", "key", "0"))
+	assert.Equal(t, resp.MakeIntData(-1), execArgs(database, "bitpos", "key", "1", "2"))
+	assert.Equal(t, resp.MakeIntData(8), execArgs(database, "bitpos", "key", "1", "1", "-1", "byte"))
+	assert.Equal(t, resp.MakeIntData(9), execArgs(database, "bitpos", "key", "1", "9", "-1", "BIT"))
+	assert.Equal(t, resp.MakeIntData(12), execArgs(database, "bitpos", "key", "0", "5", "13", "bit"))
+	assert.Equal(t, resp.MakeIntData(-1), execArgs(database, "bitpos", "key", "1", "12", "-1", "bit"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "bitpos", "key", "1", "0", "1", "word"))
+
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "setbit", "key", "23", "1"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "getbit", "key", "23"))
+	assert.Equal(t, resp.MakeIntData(23), execArgs(database, "bitpos", "key", "1", "2"))
+}
+
+func TestCmdBitfield(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	// 不存在的 key 视为全部为 0，只读操作不会创建 key
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(0)}),
+		execArgs(database, "bitfield", "key", "get", "u8", "0"))
+	_, ok := database.GetKey("key")
+	assert.False(t, ok)
+
+	// set 返回旧值，#N 表示第 N 个该类型的整数
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(0), resp.MakeIntData(0), resp.MakeIntData(255)}),
+		execArgs(database, "bitfield", "key", "set", "u8", "0", "255", "set", "u8", "#1", "1", "get", "u8", "0"))
+	value, _ := database.GetKey("key")
+	assert.Equal(t, structure.Slice{0xff, 0x01}, value)
+
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(-1), resp.MakeIntData(0xff01), resp.MakeIntData(1), resp.MakeIntData(-2)}),
+		execArgs(database, "bitfield", "key", "get", "i8", "0", "get", "u16", "0", "get", "u4", "#3", "get", "i5", "4"))
+
+	// 无符号整数溢出
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(4), resp.MakeIntData(255), resp.MakeStringData("nil"), resp.MakeIntData(0)}),
+		execArgs(database, "bitfield", "key", "incrby", "u8", "0", "5",
+			"overflow", "sat", "incrby", "u8", "0", "300",
+			"overflow", "fail", "incrby", "u8", "0", "1",
+			"overflow", "sat", "incrby", "u8", "0", "-1000"))
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(250), resp.MakeIntData(250), resp.MakeIntData(255)}),
+		execArgs(database, "bitfield", "key", "incrby", "u8", "0", "-6", "set", "u8", "0", "-1", "get", "u8", "0"))
+
+	// 有符号整数溢出
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(-1), resp.MakeIntData(-128), resp.MakeIntData(-128), resp.MakeStringData("nil"), resp.MakeIntData(-128)}),
+		execArgs(database, "bitfield", "key", "set", "i8", "0", "127",
+			"incrby", "i8", "0", "1",
+			"overflow", "sat", "incrby", "i8", "0", "-1",
+			"overflow", "fail", "incrby", "i8", "0", "-1",
+			"get", "i8", "0"))
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(0), resp.MakeIntData(math.MaxInt64), resp.MakeIntData(math.MinInt64)}),
+		execArgs(database, "bitfield", "big", "set", "i64", "0", "9223372036854775807",
+			"overflow", "sat", "incrby", "i64", "0", "1",
+			"overflow", "wrap", "incrby", "i64", "0", "1"))
+
+	// 写入超出字符串长度时会自动生长
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(0)}),
+		execArgs(database, "bitfield", "grow", "set", "u16", "#2", "65535"))
+	value, _ = database.GetKey("grow")
+	assert.Equal(t, structure.Slice{0x00, 0x00, 0x00, 0x00, 0xff, 0xff}, value)
+
+	// 参数错误时不会进行任何修改
+	assert.Equal(t, resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."),
+		execArgs(database, "bitfield", "key", "get", "u64", "0"))
+	assert.Equal(t, resp.MakeErrorData("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."),
+		execArgs(database, "bitfield", "key", "set", "u8", "0", "1", "get", "f8", "0"))
+	assert.Equal(t, resp.MakeErrorData("ERR bit offset is not an integer or out of range"),
+		execArgs(database, "bitfield", "key", "get", "u8", "-1"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"),
+		execArgs(database, "bitfield", "key", "incrby", "u8", "0", "f"))
+	assert.Equal(t, resp.MakeErrorData("ERR Invalid OVERFLOW type specified"),
+		execArgs(database, "bitfield", "key", "overflow", "none"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"),
+		execArgs(database, "bitfield", "key", "get", "u8"))
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(128)}),
+		execArgs(database, "bitfield", "key", "get", "u8", "0"))
+
+	database.SetKey("list", structure.NewList())
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"),
+		execArgs(database, "bitfield", "list", "get", "u8", "0"))
+}
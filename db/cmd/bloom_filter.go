@@ -25,7 +25,7 @@ func bfAdd(base *db.DataBase, cmd [][]byte) resp.RedisData {
 
 		bloom, ok = value.(*structure.Bloom)
 		if !ok {
-			return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return resp.WrongTypeError()
 		}
 	}
 
@@ -56,7 +56,7 @@ func bfMAdd(base *db.DataBase, cmd [][]byte) resp.RedisData {
 
 		bloom, ok = value.(*structure.Bloom)
 		if !ok {
-			return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return resp.WrongTypeError()
 		}
 	}
 
@@ -87,7 +87,7 @@ func bfExists(base *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	bloom, ok := value.(*structure.Bloom)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	if exist := bloom.Has(utils.MemHash(cmd[2])); !exist {
@@ -114,7 +114,7 @@ func bfMExists(base *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	bloom, ok := value.(*structure.Bloom)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	ret := int64(0)
@@ -144,7 +144,7 @@ func bfInfo(base *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	bloom, ok := value.(*structure.Bloom)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	ret := make([]resp.RedisData, 0, 10)
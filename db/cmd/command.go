@@ -26,4 +26,5 @@ func init() {
 	registerZSetCommands()
 	registerBitMapCommands()
 	registerBloomFilterCommands()
+	registerStreamCommands()
 }
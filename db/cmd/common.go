@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
 	"strings"
+	"time"
 )
 
 type valueType int
@@ -15,6 +17,7 @@ const (
 	SET
 	ZSET
 	LIST
+	STREAM
 )
 
 func checkType(value any, vt valueType) resp.RedisData {
@@ -30,7 +33,7 @@ func checkType(value any, vt valueType) resp.RedisData {
 
 		case HASH:
 			// 复杂数据类型全部为指针
-			_, typeOk = value.(*structure.Dict)
+			_, typeOk = value.(*structure.Hash)
 
 		case LIST:
 			// 复杂数据类型全部为指针
@@ -43,16 +46,67 @@ func checkType(value any, vt valueType) resp.RedisData {
 		case ZSET:
 			// 复杂数据类型全部为指针
 			_, typeOk = value.(*structure.ZSet)
+
+		case STREAM:
+			_, typeOk = value.(*structure.Stream)
 		}
 
 		if !typeOk {
-			return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return resp.WrongTypeError()
 		}
 	}
 
 	return nil
 }
 
+// checkStringLength 检查长度为 size 的字符串再增长 grow 字节之后是否超过 proto-max-bulk-len
+func checkStringLength(size, grow int64) resp.RedisData {
+	if grow > resp.ProtoMaxBulkLen-size {
+		return resp.MakeErrorData("ERR string exceeds maximum allowed size")
+	}
+	return nil
+}
+
+// checkReplySize 检查需要处理 n 个元素的命令是否超过 max-reply-elements，超过时拒绝执行，避免长时间阻塞事件循环
+func checkReplySize(n int) resp.RedisData {
+	if global.MaxReplyElements > 0 && n > global.MaxReplyElements {
+		return resp.MakeErrorData("ERR result set too large, use SCAN")
+	}
+	return nil
+}
+
+// budgetCheckInterval 是两次检查耗时之间处理的元素数量，避免频繁地获取时间
+const budgetCheckInterval = 256
+
+// timeBudget 记录命令允许占用事件循环的时间，耗时的读命令在处理元素的过程中定期检查，超过时放弃执行
+type timeBudget struct {
+	deadline time.Time // 为零值时不限制
+	steps    int
+}
+
+// newTimeBudget 按照 command-time-budget 创建 timeBudget
+func newTimeBudget() *timeBudget {
+	b := &timeBudget{}
+	if global.CommandTimeBudget > 0 {
+		b.deadline = time.Now().Add(global.CommandTimeBudget)
+	}
+	return b
+}
+
+// exceeded 记录处理了一个元素，并返回是否已经超过允许的时间
+func (b *timeBudget) exceeded() bool {
+	if b.deadline.IsZero() {
+		return false
+	}
+	b.steps++
+	return b.steps%budgetCheckInterval == 0 && time.Now().After(b.deadline)
+}
+
+// timeBudgetError 返回超过 command-time-budget 时的错误
+func timeBudgetError(name string) resp.RedisData {
+	return resp.MakeErrorData(fmt.Sprintf("BUSY %s exceeded the command time budget, try smaller sets", name))
+}
+
 func checkCommandAndLength(cmd *[][]byte, name string, minLength int) (resp.RedisData, bool) {
 
 	if len(*cmd) == 0 {
@@ -65,7 +119,7 @@ func checkCommandAndLength(cmd *[][]byte, name string, minLength int) (resp.Redi
 	}
 
 	if len(*cmd) < minLength {
-		return resp.MakeErrorData(fmt.Sprintf("ERR wrong number of arguments for '%s' command", (*cmd)[0])), false
+		return resp.WrongArgsError(name), false
 	}
 
 	return nil, true
@@ -4,7 +4,10 @@ import (
 	"github.com/tangrc99/MemTable/db"
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 func hSet(db *db.DataBase, cmd [][]byte) resp.RedisData {
@@ -13,29 +16,18 @@ func hSet(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	oldCost := int64(0)
-
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
-		value = structure.NewDict(1)
-		db.SetKey(string(cmd[1]), value)
-	} else {
-		oldCost = value.Cost()
-	}
-
-	e = checkType(value, HASH)
-	if e != nil {
-		return e
-	}
-
-	hashVal := value.(*structure.Dict)
-
 	l := len(cmd)
 
 	if l%2 == 1 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'hset' command")
+		return resp.WrongArgsError("hset")
 	}
 
+	hashVal, err := db.GetOrCreateHash(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
+	}
+	oldCost := hashVal.Cost()
+
 	for i := 2; i < l; i += 2 {
 		hashVal.Set(string(cmd[i]), structure.Slice(cmd[i+1]))
 	}
@@ -55,7 +47,7 @@ func hMSet(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	value, ok := db.GetKey(string(cmd[1]))
 	if !ok {
-		value = structure.NewDict(1)
+		value = structure.NewHash()
 		db.SetKey(string(cmd[1]), value)
 	} else {
 		oldCost = value.Cost()
@@ -66,12 +58,12 @@ func hMSet(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
 	l := len(cmd)
 
 	if l%2 == 1 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'hmset' command")
+		return resp.WrongArgsError("hmset")
 	}
 
 	for i := 2; i < l; i += 2 {
@@ -101,7 +93,7 @@ func hGet(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
 	val, ok := hashVal.Get(string(cmd[2]))
 	if !ok {
@@ -127,7 +119,7 @@ func hMGet(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
 	res := make([]resp.RedisData, 0)
 
@@ -158,7 +150,7 @@ func hExists(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
 	_, ok = hashVal.Get(string(cmd[2]))
 	if !ok {
@@ -184,7 +176,7 @@ func hDel(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 	oldCost := hashVal.Cost()
 	deleted := 0
 
@@ -204,18 +196,18 @@ func hGetAll(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
+	hashVal, err := db.GetHash(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
+	}
+	if hashVal == nil {
 		return resp.MakeArrayData(nil)
 	}
 
-	e = checkType(value, HASH)
-	if e != nil {
+	if e := checkReplySize(hashVal.Size()); e != nil {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
-
 	dicts, n := hashVal.GetAll()
 
 	res := make([]resp.RedisData, n*2)
@@ -231,27 +223,28 @@ func hGetAll(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeArrayData(res)
 }
 
+// hKeys 返回哈希表中的所有字段，字段按照字典序排列，与 hVals 的顺序一致
 func hKeys(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	e, ok := checkCommandAndLength(&cmd, "hkeys", 2)
 	if !ok {
 		return e
 	}
 
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
-		return resp.MakeArrayData(nil)
+	hashVal, err := db.GetHash(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
+	}
+	if hashVal == nil {
+		return resp.MakeEmptyArrayData()
 	}
 
-	e = checkType(value, HASH)
-	if e != nil {
+	if e := checkReplySize(hashVal.Size()); e != nil {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
-
-	keys, n := hashVal.Keys("")
+	keys := sortedFields(hashVal)
 
-	res := make([]resp.RedisData, n)
+	res := make([]resp.RedisData, len(keys))
 
 	for i, key := range keys {
 		res[i] = resp.MakeBulkData([]byte(key))
@@ -259,6 +252,7 @@ func hKeys(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeArrayData(res)
 }
 
+// hVals 返回哈希表中的所有值，值按照对应字段的字典序排列，与 hKeys 的顺序一致
 func hVals(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	e, ok := checkCommandAndLength(&cmd, "hvals", 2)
@@ -266,32 +260,36 @@ func hVals(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
-		return resp.MakeArrayData(nil)
+	hashVal, err := db.GetHash(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
+	}
+	if hashVal == nil {
+		return resp.MakeEmptyArrayData()
 	}
 
-	e = checkType(value, HASH)
-	if e != nil {
+	if e := checkReplySize(hashVal.Size()); e != nil {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	keys := sortedFields(hashVal)
 
-	dicts, n := hashVal.GetAll()
+	res := make([]resp.RedisData, len(keys))
 
-	res := make([]resp.RedisData, n)
-
-	i := 0
-	for _, dict := range dicts {
-		for _, v := range dict {
-			res[i] = resp.MakeBulkData(v.(structure.Slice))
-			i++
-		}
+	for i, key := range keys {
+		v, _ := hashVal.Get(key)
+		res[i] = resp.MakeBulkData(v.(structure.Slice))
 	}
 	return resp.MakeArrayData(res)
 }
 
+// sortedFields 返回按照字典序排列的哈希表字段，map 的遍历顺序是随机的，排序后才能保证多次调用的顺序一致
+func sortedFields(hashVal *structure.Hash) []string {
+	keys, _ := hashVal.Keys("")
+	sort.Strings(keys)
+	return keys
+}
+
 func hIncrBy(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	e, ok := checkCommandAndLength(&cmd, "hincrby", 4)
 	if !ok {
@@ -300,7 +298,7 @@ func hIncrBy(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	value, ok := db.GetKey(string(cmd[1]))
 	if !ok {
-		value = structure.NewDict(1)
+		value = structure.NewHash()
 		db.SetKey(string(cmd[1]), value)
 	}
 
@@ -309,11 +307,11 @@ func hIncrBy(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
 	increment, err := strconv.Atoi(string(cmd[3]))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	val, ok := hashVal.Get(string(cmd[2]))
@@ -353,7 +351,7 @@ func hLen(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
 	count := hashVal.Size()
 
@@ -376,7 +374,7 @@ func hStrLen(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
 	val, ok := hashVal.Get(string(cmd[2]))
 	if !ok {
@@ -388,15 +386,35 @@ func hStrLen(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeIntData(int64(sl))
 }
 
+// hRandField 随机返回哈希表中的字段，count 为负数时返回的字段可能重复，withvalues 会在字段后附带值
 func hRandField(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	e, ok := checkCommandAndLength(&cmd, "hrandfield", 2)
 	if !ok {
 		return e
 	}
 
+	count := 1
+	withValues := false
+
+	if len(cmd) >= 3 {
+		l, err := strconv.Atoi(string(cmd[2]))
+		if err != nil {
+			return resp.NotIntegerError()
+		}
+		count = l
+	}
+	if len(cmd) == 4 && strings.ToLower(string(cmd[3])) == "withvalues" {
+		withValues = true
+	} else if len(cmd) >= 4 {
+		return resp.SyntaxError()
+	}
+
 	value, ok := db.GetKey(string(cmd[1]))
 	if !ok {
-		return resp.MakeArrayData(nil)
+		if len(cmd) == 2 {
+			return resp.MakeStringData("nil")
+		}
+		return resp.MakeEmptyArrayData()
 	}
 
 	e = checkType(value, HASH)
@@ -404,26 +422,256 @@ func hRandField(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	hashVal := value.(*structure.Dict)
+	hashVal := value.(*structure.Hash)
 
-	count := 1
+	res := make([]resp.RedisData, 0)
+	appendField := func(key string, v structure.Object) {
+		res = append(res, resp.MakeBulkData([]byte(key)))
+		if withValues {
+			res = append(res, resp.MakeBulkData(v.(structure.Slice)))
+		}
+	}
 
-	if len(cmd) >= 3 {
-		l, err := strconv.Atoi(string(cmd[2]))
-		if err != nil {
-			return resp.MakeErrorData("ERR value is not an integer or out of range")
+	if count < 0 {
+		for i := 0; i < -count && !hashVal.Empty(); i++ {
+			for key, v := range hashVal.Random(1) {
+				appendField(key, v)
+			}
+		}
+	} else {
+		for key, v := range hashVal.Random(count) {
+			appendField(key, v)
 		}
-		count = l
 	}
 
-	selected := hashVal.RandomKeys(count)
+	if len(cmd) == 2 {
+		if len(res) == 0 {
+			return resp.MakeStringData("nil")
+		}
+		return res[0]
+	}
+	return resp.MakeArrayData(res)
+}
 
-	res := make([]resp.RedisData, len(selected))
-	i := 0
-	for key := range selected {
-		res[i] = resp.MakeBulkData([]byte(key))
-		i++
+// hashFields 解析 FIELDS numfields field [field ...] 参数，pos 为 FIELDS 所在的位置
+func hashFields(cmd [][]byte, pos int) ([]string, resp.RedisData) {
+
+	if pos >= len(cmd) || strings.ToLower(string(cmd[pos])) != "fields" {
+		return nil, resp.MakeErrorData("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	if pos+1 >= len(cmd) {
+		return nil, resp.SyntaxError()
+	}
+
+	n, err := global.ParseInteger(cmd[pos+1])
+	if err != nil || n <= 0 {
+		return nil, resp.MakeErrorData("ERR Parameter `numFields` should be greater than 0")
+	}
+	if n != int64(len(cmd)-pos-2) {
+		return nil, resp.MakeErrorData("ERR The `numfields` parameter must match the number of arguments")
+	}
+
+	fields := make([]string, n)
+	for i := range fields {
+		fields[i] = string(cmd[pos+2+i])
+	}
+	return fields, nil
+}
+
+// fieldStatus 返回每一个 field 相同的状态，用于键不存在的情况
+func fieldStatus(n int, status int64) resp.RedisData {
+	res := make([]resp.RedisData, n)
+	for i := range res {
+		res[i] = resp.MakeIntData(status)
+	}
+	return resp.MakeArrayData(res)
+}
+
+// hExpire 命令格式： hexpire key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]。
+// 每一个 field 返回 -2 表示 field 不存在，0 表示条件不满足，1 表示设置成功，2 表示过期时间已经过去，field 被删除
+func hExpire(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "hexpire", 6)
+	if !ok {
+		return e
+	}
+
+	seconds, err := global.ParseInteger(cmd[2])
+	if err != nil {
+		return resp.MakeErrorData(err.Error())
+	}
+	tp := global.Now().Unix() + seconds
+	if (seconds > 0 && tp < seconds) || seconds < 0 {
+		return resp.MakeErrorData("ERR invalid expire time in 'hexpire' command")
+	}
+
+	return hashExpire(db, cmd, tp)
+}
+
+// hExpireAt 命令格式： hexpireat key unix-time-seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]。
+// 返回值与 hexpire 相同，hexpire 会以 hexpireat 的形式传播
+func hExpireAt(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "hexpireat", 6)
+	if !ok {
+		return e
+	}
+
+	tp, err := global.ParseInteger(cmd[2])
+	if err != nil {
+		return resp.MakeErrorData(err.Error())
+	}
+	if tp < 0 {
+		return resp.MakeErrorData("ERR invalid expire time in 'hexpireat' command")
+	}
+
+	return hashExpire(db, cmd, tp)
+}
+
+// hashExpire 将 cmd 中指定的 field 的过期时间设置为 tp，cmd 的格式与 hexpire 相同
+func hashExpire(db *db.DataBase, cmd [][]byte, tp int64) resp.RedisData {
+
+	pos := 3
+	nx, xx, gt, lt := false, false, false, false
+	switch strings.ToLower(string(cmd[3])) {
+	case "nx":
+		nx = true
+	case "xx":
+		xx = true
+	case "gt":
+		gt = true
+	case "lt":
+		lt = true
+	default:
+		pos = 2
+	}
+	fields, e := hashFields(cmd, pos+1)
+	if e != nil {
+		return e
+	}
+
+	key := string(cmd[1])
+	value, ok := db.GetKey(key)
+	if !ok {
+		return fieldStatus(len(fields), -2)
+	}
+	e = checkType(value, HASH)
+	if e != nil {
+		return e
 	}
+
+	hashVal := value.(*structure.Hash)
+	oldCost := hashVal.Cost()
+
+	res := make([]resp.RedisData, len(fields))
+	for i, field := range fields {
+
+		if !hashVal.Exist(field) {
+			res[i] = resp.MakeIntData(-2)
+			continue
+		}
+
+		// 没有过期时间的 field 视为永不过期
+		current, hasTTL := hashVal.FieldTTL(field)
+		if (nx && hasTTL) || (xx && !hasTTL) || (gt && (!hasTTL || tp <= current)) || (lt && hasTTL && tp >= current) {
+			res[i] = resp.MakeIntData(0)
+			continue
+		}
+
+		if tp <= global.Now().Unix() {
+			hashVal.Delete(field)
+			res[i] = resp.MakeIntData(2)
+			continue
+		}
+		hashVal.SetFieldTTL(field, tp)
+		res[i] = resp.MakeIntData(1)
+	}
+
+	if hashVal.Empty() {
+		db.DeleteKey(key)
+		return resp.MakeArrayData(res)
+	}
+	if hashVal.HasFieldTTL() {
+		db.TrackFieldTTL(key)
+	}
+	db.ReviseNotify(key, oldCost, hashVal.Cost())
+
+	return resp.MakeArrayData(res)
+}
+
+// hTTL 命令格式： httl key FIELDS numfields field [field ...]。
+// 每一个 field 返回剩余的秒数，-1 表示没有过期时间，-2 表示 field 不存在
+func hTTL(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "httl", 5)
+	if !ok {
+		return e
+	}
+
+	fields, e := hashFields(cmd, 2)
+	if e != nil {
+		return e
+	}
+
+	value, ok := db.GetKey(string(cmd[1]))
+	if !ok {
+		return fieldStatus(len(fields), -2)
+	}
+	e = checkType(value, HASH)
+	if e != nil {
+		return e
+	}
+
+	hashVal := value.(*structure.Hash)
+
+	res := make([]resp.RedisData, len(fields))
+	for i, field := range fields {
+		if !hashVal.Exist(field) {
+			res[i] = resp.MakeIntData(-2)
+		} else if ttl, ok := hashVal.FieldTTL(field); ok {
+			res[i] = resp.MakeIntData(ttl - global.Now().Unix())
+		} else {
+			res[i] = resp.MakeIntData(-1)
+		}
+	}
+	return resp.MakeArrayData(res)
+}
+
+// hPersist 命令格式： hpersist key FIELDS numfields field [field ...]。
+// 每一个 field 返回 1 表示删除了过期时间，-1 表示没有过期时间，-2 表示 field 不存在
+func hPersist(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "hpersist", 5)
+	if !ok {
+		return e
+	}
+
+	fields, e := hashFields(cmd, 2)
+	if e != nil {
+		return e
+	}
+
+	key := string(cmd[1])
+	value, ok := db.GetKey(key)
+	if !ok {
+		return fieldStatus(len(fields), -2)
+	}
+	e = checkType(value, HASH)
+	if e != nil {
+		return e
+	}
+
+	hashVal := value.(*structure.Hash)
+	oldCost := hashVal.Cost()
+
+	res := make([]resp.RedisData, len(fields))
+	for i, field := range fields {
+		if !hashVal.Exist(field) {
+			res[i] = resp.MakeIntData(-2)
+		} else if hashVal.RemoveFieldTTL(field) {
+			res[i] = resp.MakeIntData(1)
+		} else {
+			res[i] = resp.MakeIntData(-1)
+		}
+	}
+	db.ReviseNotify(key, oldCost, hashVal.Cost())
+
 	return resp.MakeArrayData(res)
 }
 
@@ -441,4 +689,8 @@ func registerHashCommands() {
 	registerCommand("hlen", hLen, RD)
 	registerCommand("hstrlen", hStrLen, RD)
 	registerCommand("hrandfield", hRandField, RD)
+	registerCommand("hexpire", hExpire, WR)
+	registerCommand("hexpireat", hExpireAt, WR)
+	registerCommand("httl", hTTL, RD)
+	registerCommand("hpersist", hPersist, WR)
 }
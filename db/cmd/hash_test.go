@@ -6,13 +6,15 @@ import (
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestCmdHash(t *testing.T) {
 
 	database := db.NewDataBase(1)
-	dict := structure.NewDict(1)
+	dict := structure.NewHash()
 	database.SetKey("test", dict)
 
 	tests := []struct {
@@ -87,7 +89,7 @@ func TestCmdHash(t *testing.T) {
 
 func TestCmdHashRand(t *testing.T) {
 	database := db.NewDataBase(1)
-	dict := structure.NewDict(1)
+	dict := structure.NewHash()
 	database.SetKey("test", dict)
 	dict.Set("k1", Slice("v1"))
 	dict.Set("k2", Slice("v2"))
@@ -104,13 +106,12 @@ func TestCmdHashRand(t *testing.T) {
 		input    [][]byte
 		expected []resp.RedisData
 	}{
-		{[][]byte{[]byte("hrandfield"), []byte("test")},
-			keys},
-
 		{[][]byte{[]byte("hrandfield"), []byte("test"), []byte("2")},
 			keys},
 	}
 
+	assert.Contains(t, keys, hRandField(database, [][]byte{[]byte("hrandfield"), []byte("test")}))
+
 	for _, test := range tests {
 		cmd, exist := global.FindCommand(string(test.input[0]))
 		assert.True(t, exist)
@@ -124,7 +125,7 @@ func TestCmdHashRand(t *testing.T) {
 
 func TestCmdHashAll(t *testing.T) {
 	database := db.NewDataBase(1)
-	dict := structure.NewDict(1)
+	dict := structure.NewHash()
 	database.SetKey("test", dict)
 	dict.Set("k1", Slice("v1"))
 	dict.Set("k2", Slice("v2"))
@@ -158,3 +159,154 @@ func TestCmdHashAll(t *testing.T) {
 	}
 
 }
+
+func TestCmdHashKeysValsOrder(t *testing.T) {
+	database := db.NewDataBase(1)
+	dict := &structure.Hash{Dict: structure.NewDict(4)}
+	database.SetKey("test", dict)
+	for i := 0; i < 100; i++ {
+		dict.Set("k"+strconv.Itoa(i), Slice("v"+strconv.Itoa(i)))
+	}
+
+	keys := hKeys(database, [][]byte{[]byte("hkeys"), []byte("test")}).(*resp.ArrayData).Data()
+	vals := hVals(database, [][]byte{[]byte("hvals"), []byte("test")}).(*resp.ArrayData).Data()
+
+	// 字段与值的顺序需要一一对应
+	assert.Equal(t, 100, len(keys))
+	assert.Equal(t, len(keys), len(vals))
+	for i := range keys {
+		field := string(keys[i].(*resp.BulkData).Data())
+		assert.Equal(t, "v"+field[1:], string(vals[i].(*resp.BulkData).Data()))
+	}
+
+	assert.Equal(t, resp.MakeEmptyArrayData(), hKeys(database, [][]byte{[]byte("hkeys"), []byte("none")}))
+	assert.Equal(t, resp.MakeEmptyArrayData(), hVals(database, [][]byte{[]byte("hvals"), []byte("none")}))
+}
+
+func TestCmdHRandField(t *testing.T) {
+	database := db.NewDataBase(1)
+	dict := structure.NewHash()
+	database.SetKey("test", dict)
+	dict.Set("k1", Slice("v1"))
+	dict.Set("k2", Slice("v2"))
+
+	keys := []resp.RedisData{resp.MakeBulkData([]byte("k1")), resp.MakeBulkData([]byte("k2"))}
+
+	// 正数 count 返回不重复的字段
+	assert.ElementsMatch(t, keys, execArgs(database, "hrandfield", "test", "5").(*resp.ArrayData).Data())
+
+	// 负数 count 返回的字段可能重复
+	ret := execArgs(database, "hrandfield", "test", "-6").(*resp.ArrayData).Data()
+	assert.Equal(t, 6, len(ret))
+	assert.Subset(t, keys, ret)
+
+	// withvalues 会在字段后附带对应的值
+	ret = execArgs(database, "hrandfield", "test", "-4", "WITHVALUES").(*resp.ArrayData).Data()
+	assert.Equal(t, 8, len(ret))
+	for i := 0; i < len(ret); i += 2 {
+		field := string(ret[i].(*resp.BulkData).Data())
+		assert.Equal(t, "v"+field[1:], string(ret[i+1].(*resp.BulkData).Data()))
+	}
+	assert.Equal(t, 4, len(execArgs(database, "hrandfield", "test", "2", "withvalues").(*resp.ArrayData).Data()))
+
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(database, "hrandfield", "none"))
+	assert.Equal(t, resp.MakeEmptyArrayData(), execArgs(database, "hrandfield", "none", "2"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "hrandfield", "test", "2", "none"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execArgs(database, "hrandfield", "test", "a"))
+}
+
+func TestCmdHashFieldTTL(t *testing.T) {
+	database := db.NewDataBase(1)
+	global.UpdateGlobalClock()
+	now := global.Now()
+	defer func() { global.SetGlobalClock(now) }()
+
+	ints := func(values ...int64) resp.RedisData {
+		res := make([]resp.RedisData, len(values))
+		for i, v := range values {
+			res[i] = resp.MakeIntData(v)
+		}
+		return resp.MakeArrayData(res)
+	}
+
+	execArgs(database, "hset", "h", "a", "1", "b", "2", "c", "3")
+
+	// 参数错误
+	assert.Equal(t, resp.MakeErrorData("ERR Parameter `numFields` should be greater than 0"),
+		execArgs(database, "hexpire", "h", "10", "fields", "0", "a"))
+	assert.Equal(t, resp.MakeErrorData("ERR The `numfields` parameter must match the number of arguments"),
+		execArgs(database, "hexpire", "h", "10", "fields", "2", "a"))
+	assert.Equal(t, ints(-2, -2), execArgs(database, "httl", "none", "fields", "2", "a", "b"))
+
+	// 设置 field 的过期时间，不存在的 field 返回 -2
+	assert.Equal(t, ints(1, -2), execArgs(database, "hexpire", "h", "10", "fields", "2", "a", "x"))
+	assert.Equal(t, ints(0), execArgs(database, "hexpire", "h", "20", "nx", "fields", "1", "a"))
+	assert.Equal(t, ints(0), execArgs(database, "hexpire", "h", "20", "xx", "fields", "1", "b"))
+	assert.Equal(t, ints(1, 0), execArgs(database, "hexpire", "h", "20", "gt", "fields", "2", "a", "b"))
+	assert.Equal(t, ints(1), execArgs(database, "hexpire", "h", "20", "fields", "1", "b"))
+	assert.Equal(t, ints(20, 20, -1, -2), execArgs(database, "httl", "h", "fields", "4", "a", "b", "c", "x"))
+
+	// hpersist 删除过期时间
+	assert.Equal(t, ints(1, -1), execArgs(database, "hpersist", "h", "fields", "2", "b", "c"))
+	assert.Equal(t, ints(-1), execArgs(database, "httl", "h", "fields", "1", "b"))
+
+	// 过期的 field 在访问时被删除
+	global.SetGlobalClock(global.Now().Add(30 * time.Second))
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(database, "hget", "h", "a"))
+	assert.Equal(t, resp.MakeIntData(2), execArgs(database, "hlen", "h"))
+
+	// 过期时间已经过去时直接删除 field
+	assert.Equal(t, ints(2), execArgs(database, "hexpire", "h", "0", "fields", "1", "b"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "hlen", "h"))
+
+	// 最后一个 field 过期后整个 hash 被删除
+	assert.Equal(t, ints(1), execArgs(database, "hexpire", "h", "5", "fields", "1", "c"))
+	global.SetGlobalClock(global.Now().Add(10 * time.Second))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "exists", "h"))
+	assert.Equal(t, 0, database.Size())
+
+	// 主动删除过期的 field
+	execArgs(database, "hset", "h2", "a", "1", "b", "2")
+	execArgs(database, "hexpire", "h2", "5", "fields", "2", "a", "b")
+	global.SetGlobalClock(global.Now().Add(10 * time.Second))
+	assert.Equal(t, 1, database.CleanExpiredFields(10))
+	assert.Equal(t, 0, database.Size())
+
+	// 覆盖 field 的值会删除过期时间
+	execArgs(database, "hset", "h3", "a", "1")
+	execArgs(database, "hexpire", "h3", "5", "fields", "1", "a")
+	execArgs(database, "hset", "h3", "a", "2")
+	assert.Equal(t, ints(-1), execArgs(database, "httl", "h3", "fields", "1", "a"))
+
+	// hexpireat 使用绝对时间
+	execArgs(database, "hset", "h4", "a", "1")
+	at := strconv.FormatInt(global.Now().Unix()+100, 10)
+	assert.Equal(t, ints(1), execArgs(database, "hexpireat", "h4", at, "fields", "1", "a"))
+	assert.Equal(t, ints(100), execArgs(database, "httl", "h4", "fields", "1", "a"))
+	assert.Equal(t, resp.MakeErrorData("ERR invalid expire time in 'hexpireat' command"),
+		execArgs(database, "hexpireat", "h4", "-1", "fields", "1", "a"))
+
+	execArgs(database, "set", "s", "v")
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"),
+		execArgs(database, "httl", "s", "fields", "1", "a"))
+}
+
+func TestCmdHashExpiredFields(t *testing.T) {
+	database := db.NewDataBase(1, db.WithEvictNotification(make(chan string, 10)))
+	global.UpdateGlobalClock()
+	now := global.Now()
+	defer func() { global.SetGlobalClock(now) }()
+
+	execArgs(database, "hset", "h", "a", "1", "b", "2")
+	execArgs(database, "hexpire", "h", "5", "fields", "1", "a")
+
+	// 重命名之后的键仍然会被主动删除过期的 field
+	execArgs(database, "rename", "h", "h2")
+	global.SetGlobalClock(global.Now().Add(10 * time.Second))
+	assert.Equal(t, 1, database.CleanExpiredFields(10))
+
+	// 只删除部分 field 时需要由服务层传播 hdel
+	assert.Equal(t, []db.ExpiredFields{{Key: "h2", Fields: []string{"a"}}}, database.PopExpiredFields())
+	assert.Empty(t, database.PopExpiredFields())
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "hlen", "h2"))
+}
@@ -6,7 +6,10 @@ import (
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
+	glob "github.com/tangrc99/MemTable/utils/pattern"
 	"strconv"
+	"strings"
+	"unsafe"
 )
 
 // del 删除多个键，并返回删除数量
@@ -50,96 +53,89 @@ func exists(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeIntData(int64(exist))
 }
 
-func expire(db *db.DataBase, cmd [][]byte) resp.RedisData {
+// expireGeneric 是 expire、pexpire、expireat 和 pexpireat 的通用实现，ms 表示时间的单位是否为毫秒，
+// absolute 表示参数是否为 unix 时间戳。命令格式： expire key time [nx|xx|gt|lt]
+func expireGeneric(db *db.DataBase, cmd [][]byte, name string, ms, absolute bool) resp.RedisData {
 
 	// 进行输入类型检查
-	e, ok := checkCommandAndLength(&cmd, "expire", 3)
+	e, ok := checkCommandAndLength(&cmd, name, 3)
 	if !ok {
 		return e
 	}
 
-	period, err := strconv.ParseInt(string(cmd[2]), 10, 64)
+	when, err := global.ParseInteger(cmd[2])
 	if err != nil {
-		return resp.MakeErrorData(fmt.Sprintf("error: %s is not int", string(cmd[2])))
+		return resp.MakeErrorData(err.Error())
 	}
 
-	tp := global.Now.Unix() + period
-
-	ok = db.SetTTL(string(cmd[1]), tp)
-
-	if ok {
-		return resp.MakeIntData(1)
-	}
-	return resp.MakeIntData(0)
-}
-
-/*
-func expireAt(db *db.DataBase, cmd [][]byte) resp.RedisData {
-
-		// 进行输入类型检查
-		e, ok := checkCommandAndLength(&cmd, "expireat", 3)
-		if !ok {
-			return e
-		}
-
-		tp, err := strconv.ParseInt(string(cmd[2]), 10, 64)
-		if err != nil {
-			return resp.MakeErrorData(fmt.Sprintf("error: %s is not int", string(cmd[2])))
+	nx, xx, gt, lt := false, false, false, false
+	for _, arg := range cmd[3:] {
+		switch strings.ToLower(string(arg)) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "gt":
+			gt = true
+		case "lt":
+			lt = true
+		default:
+			return resp.MakeErrorData(fmt.Sprintf("ERR Unsupported option %s", arg))
 		}
+	}
+	if nx && (xx || gt || lt) {
+		return resp.MakeErrorData("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return resp.MakeErrorData("ERR GT and LT options at the same time are not compatible")
+	}
 
-		ok = db.SetTTL(string(cmd[1]), tp)
-
-		if ok {
-			return resp.MakeIntData(1)
+	// ttl 的精度为秒
+	if ms {
+		when /= 1000
+	}
+	tp := when
+	if !absolute {
+		tp = global.Now().Unix() + when
+		if (when > 0 && tp < when) || (when < 0 && tp > global.Now().Unix()) {
+			return resp.MakeErrorData(fmt.Sprintf("ERR invalid expire time in '%s' command", name))
 		}
-		return resp.MakeIntData(0)
 	}
-*/
-func pExpire(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
-	// 进行输入类型检查
-	e, ok := checkCommandAndLength(&cmd, "pexpire", 3)
-	if !ok {
-		return e
+	key := string(cmd[1])
+	remain := db.GetTTL(key)
+	if remain == -2 {
+		return resp.MakeIntData(0)
 	}
 
-	period, err := strconv.ParseInt(string(cmd[2]), 10, 64)
-	if err != nil {
-		return resp.MakeErrorData(fmt.Sprintf("error: %s is not int", string(cmd[2])))
+	// 没有 ttl 的键视为永不过期
+	hasTTL := remain != -1
+	current := global.Now().Unix() + remain
+	if (nx && hasTTL) || (xx && !hasTTL) || (gt && (!hasTTL || tp <= current)) || (lt && hasTTL && tp >= current) {
+		return resp.MakeIntData(0)
 	}
 
-	tp := global.Now.Unix() + period/1000
-
-	ok = db.SetTTL(string(cmd[1]), tp)
-
-	if ok {
+	if db.SetTTL(key, tp) {
 		return resp.MakeIntData(1)
 	}
 	return resp.MakeIntData(0)
 }
 
-/*
-func pExpireAt(db *db.DataBase, cmd [][]byte) resp.RedisData {
-
-	// 进行输入类型检查
-	e, ok := checkCommandAndLength(&cmd, "pexpireat", 3)
-	if !ok {
-		return e
-	}
+func expire(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	return expireGeneric(db, cmd, "expire", false, false)
+}
 
-	tp, err := strconv.ParseInt(string(cmd[2]), 10, 64)
-	if err != nil {
-		return resp.MakeErrorData(fmt.Sprintf("error: %s is not int", string(cmd[2])))
-	}
+func expireAt(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	return expireGeneric(db, cmd, "expireat", false, true)
+}
 
-	ok = db.SetTTL(string(cmd[1]), tp)
+func pExpire(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	return expireGeneric(db, cmd, "pexpire", true, false)
+}
 
-	if ok {
-		return resp.MakeIntData(1)
-	}
-	return resp.MakeIntData(0)
+func pExpireAt(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	return expireGeneric(db, cmd, "pexpireat", true, true)
 }
-*/
 
 // keys 返回所有键，首行为个数
 func keys(db *db.DataBase, cmd [][]byte) resp.RedisData {
@@ -155,6 +151,11 @@ func keys(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		pattern = string(cmd[1])
 	}
 
+	// 匹配之前需要遍历全部的键，因此按照键的数量进行检查
+	if e := checkReplySize(db.Size()); e != nil {
+		return e
+	}
+
 	ks, size := db.KeysByte(pattern)
 
 	res := make([]resp.RedisData, size+1)
@@ -213,6 +214,80 @@ func rename(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeStringData("OK")
 }
 
+// typeName 返回值的类型名称，与 type 命令的返回值相同
+func typeName(value structure.Object) string {
+	switch value.(type) {
+	case structure.Slice:
+		return "string"
+	case *structure.List:
+		return "list"
+	case *structure.Hash:
+		return "hash"
+	case *structure.Set:
+		return "set"
+	case *structure.ZSet:
+		return "zset"
+	case *structure.Stream:
+		return "stream"
+	}
+	return ""
+}
+
+// scan 命令格式： scan cursor [MATCH pattern] [COUNT count] [TYPE type]，返回下一次遍历的游标以及本次遍历到的键。
+// 匹配与 keys 命令相同，MATCH 以及 TYPE 的过滤在遍历之后进行，因此返回的数量可能少于 count
+func scan(db *db.DataBase, cmd [][]byte) resp.RedisData {
+
+	// 进行输入类型检查
+	e, ok := checkCommandAndLength(&cmd, "scan", 2)
+	if !ok {
+		return e
+	}
+
+	cursor, err := strconv.Atoi(string(cmd[1]))
+	if err != nil || cursor < 0 {
+		return resp.MakeErrorData("ERR invalid cursor")
+	}
+
+	pattern, kind, count := "", "", 10
+	for i := 2; i < len(cmd); i += 2 {
+		if i+1 >= len(cmd) {
+			return resp.SyntaxError()
+		}
+		switch strings.ToLower(string(cmd[i])) {
+		case "match":
+			pattern = string(cmd[i+1])
+		case "count":
+			count, err = strconv.Atoi(string(cmd[i+1]))
+			if err != nil {
+				return resp.NotIntegerError()
+			}
+			if count < 1 {
+				return resp.SyntaxError()
+			}
+		case "type":
+			kind = strings.ToLower(string(cmd[i+1]))
+		default:
+			return resp.SyntaxError()
+		}
+	}
+
+	keys := make([]resp.RedisData, 0)
+	next := db.Scan(cursor, count, func(key string, value structure.Object) {
+		if kind != "" && typeName(value) != kind {
+			return
+		}
+		if pattern != "" && !glob.Match([]byte(pattern), []byte(key)) {
+			return
+		}
+		keys = append(keys, resp.MakeBulkData([]byte(key)))
+	})
+
+	return resp.MakeArrayData([]resp.RedisData{
+		resp.MakeBulkData([]byte(strconv.Itoa(next))),
+		resp.MakeArrayData(keys),
+	})
+}
+
 func typeKey(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	err, ok := checkCommandAndLength(&cmd, "type", 2)
@@ -221,27 +296,165 @@ func typeKey(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	value, ok := db.GetKey(string(cmd[1]))
+	if !ok {
+		return resp.MakeStringData("none")
+	}
 
-	typeName := ""
+	return resp.MakeStringData(typeName(value))
+}
 
+// object 命令格式： object encoding|freq|idletime key
+func object(base *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "object", 2)
 	if !ok {
-		typeName = "none"
-	} else {
+		return e
+	}
+
+	sub := strings.ToLower(string(cmd[1]))
+
+	switch sub {
+	case "encoding", "freq", "idletime":
+		if len(cmd) != 3 {
+			return resp.WrongArgsError("object|" + sub)
+		}
+	default:
+		return resp.MakeErrorData(fmt.Sprintf("ERR unknown subcommand '%s'. Try OBJECT HELP.", cmd[1]))
+	}
+
+	item, exist := base.GetItem(string(cmd[2]))
+	if !exist {
+		return resp.MakeStringData("nil")
+	}
 
-		if _, ok := value.(structure.Slice); ok {
-			typeName = "string"
-		} else if _, ok := value.(*structure.List); ok {
-			typeName = "list"
-		} else if _, ok := value.(*structure.Dict); ok {
-			typeName = "hash"
-		} else if _, ok := value.(*structure.Set); ok {
-			typeName = "set"
-		} else if _, ok := value.(*structure.ZSet); ok {
-			typeName = "zset"
+	if sub == "encoding" {
+		return resp.MakeBulkData([]byte(structure.Encoding(item.Value)))
+	}
+
+	if sub == "freq" {
+		if base.Policy() != db.EvictLFU {
+			return resp.MakeErrorData("ERR An LFU maxmemory policy is not selected, access frequency not tracked. " +
+				"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
 		}
+		return resp.MakeIntData(int64(item.Frequency()))
 	}
 
-	return resp.MakeStringData(typeName)
+	if base.Policy() == db.EvictLFU {
+		return resp.MakeErrorData("ERR An LFU maxmemory policy is selected, idle time not tracked. " +
+			"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+	}
+	return resp.MakeIntData(item.IdleTime())
+}
+
+// memory 命令格式： memory usage key [SAMPLES count]
+func memory(base *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "memory", 2)
+	if !ok {
+		return e
+	}
+
+	if strings.ToLower(string(cmd[1])) != "usage" {
+		return resp.MakeErrorData(fmt.Sprintf("ERR unknown subcommand '%s'. Try MEMORY HELP.", cmd[1]))
+	}
+
+	if len(cmd) != 3 && len(cmd) != 5 {
+		return resp.WrongArgsError("memory|usage")
+	}
+
+	samples := structure.DefaultMemorySamples
+	if len(cmd) == 5 {
+		if strings.ToLower(string(cmd[3])) != "samples" {
+			return resp.SyntaxError()
+		}
+		n, err := strconv.Atoi(string(cmd[4]))
+		if err != nil || n < 0 {
+			return resp.NotIntegerError()
+		}
+		samples = n
+	}
+
+	key := string(cmd[2])
+	item, exist := base.GetItem(key)
+	if !exist {
+		return resp.MakeStringData("nil")
+	}
+
+	// 键本身，字段结构体以及在数据库哈希表中的开销
+	overhead := int64(len(key)) + int64(unsafe.Sizeof(*item)) + structure.MapEntryCost
+
+	return resp.MakeIntData(overhead + structure.MemoryUsage(item.Value, samples))
+}
+
+// dump 命令格式： dump key，返回值的序列化数据，键不存在时返回 nil
+func dump(db_ *db.DataBase, cmd [][]byte) resp.RedisData {
+
+	// 进行输入类型检查
+	e, ok := checkCommandAndLength(&cmd, "dump", 2)
+	if !ok {
+		return e
+	}
+
+	value, ok := db_.GetKey(string(cmd[1]))
+	if !ok {
+		return resp.MakeStringData("nil")
+	}
+
+	payload, err := db.DumpObject(value)
+	if err != nil {
+		return resp.MakeErrorData(err.Error())
+	}
+	return resp.MakeBulkData(payload)
+}
+
+// restore 命令格式： restore key ttl serialized-value [REPLACE] [ABSTTL]，ttl 的单位为毫秒，为 0 时不设置过期时间，
+// ABSTTL 表示 ttl 为 unix 时间戳
+func restore(db_ *db.DataBase, cmd [][]byte) resp.RedisData {
+
+	// 进行输入类型检查
+	e, ok := checkCommandAndLength(&cmd, "restore", 4)
+	if !ok {
+		return e
+	}
+
+	ttl, err := global.ParseInteger(cmd[2])
+	if err != nil {
+		return resp.MakeErrorData(err.Error())
+	}
+	if ttl < 0 {
+		return resp.MakeErrorData("ERR Invalid TTL value, must be >= 0")
+	}
+
+	replace, absolute := false, false
+	for _, arg := range cmd[4:] {
+		switch strings.ToLower(string(arg)) {
+		case "replace":
+			replace = true
+		case "absttl":
+			absolute = true
+		default:
+			return resp.SyntaxError()
+		}
+	}
+
+	key := string(cmd[1])
+	if !replace && db_.ExistKey(key) {
+		return resp.MakeErrorData("BUSYKEY Target key name already exists.")
+	}
+
+	value, err := db.RestoreObject(cmd[3])
+	if err != nil {
+		return resp.MakeErrorData(err.Error())
+	}
+
+	// ttl 的精度为秒，不足一秒的部分向上取整
+	if ttl == 0 {
+		db_.SetKey(key, value)
+		db_.RemoveTTL(key)
+	} else if absolute {
+		db_.SetKeyWithTTL(key, value, (ttl+999)/1000)
+	} else {
+		db_.SetKeyWithTTL(key, value, global.Now().Unix()+(ttl+999)/1000)
+	}
+	return resp.MakeStringData("OK")
 }
 
 func registerKeyCommands() {
@@ -249,12 +462,17 @@ func registerKeyCommands() {
 	registerCommand("del", del, WR)
 	registerCommand("exists", exists, RD)
 	registerCommand("keys", keys, RD)
+	registerCommand("scan", scan, RD)
 	registerCommand("ttl", ttl, RD)
-	registerCommand("expire", expire, RD)
-	//registerCommand("expireat", expireAt)
-	registerCommand("pexpire", pExpire, RD)
-	//registerCommand("pexpireat", pExpireAt)
+	registerCommand("expire", expire, WR)
+	registerCommand("expireat", expireAt, WR)
+	registerCommand("pexpire", pExpire, WR)
+	registerCommand("pexpireat", pExpireAt, WR)
 	registerCommand("rename", rename, WR)
 	registerCommand("type", typeKey, RD)
 	registerCommand("randomkey", randomKey, RD)
+	registerCommand("object", object, RD)
+	registerCommand("memory", memory, RD)
+	registerCommand("dump", dump, RD)
+	registerCommand("restore", restore, WR)
 }
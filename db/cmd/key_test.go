@@ -6,7 +6,10 @@ import (
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCmdKey(t *testing.T) {
@@ -42,7 +45,7 @@ func TestCmdKey(t *testing.T) {
 			resp.MakeIntData(2)},
 
 		{[][]byte{[]byte("expire"), []byte("k1"), []byte("k3")},
-			resp.MakeErrorData("error: k3 is not int")},
+			resp.MakeErrorData("ERR value is not an integer or out of range")},
 
 		{[][]byte{[]byte("expire"), []byte("k1"), []byte("10")},
 			resp.MakeIntData(1)},
@@ -59,6 +62,15 @@ func TestCmdKey(t *testing.T) {
 		{[][]byte{[]byte("keys")},
 			resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(1), resp.MakeBulkData([]byte("k1"))})},
 
+		{[][]byte{[]byte("keys"), []byte("*")},
+			resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(1), resp.MakeBulkData([]byte("k1"))})},
+
+		{[][]byte{[]byte("keys"), []byte("k[0-9]")},
+			resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(1), resp.MakeBulkData([]byte("k1"))})},
+
+		{[][]byte{[]byte("keys"), []byte("k")},
+			resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(0)})},
+
 		{[][]byte{[]byte("randomkey")},
 			resp.MakeBulkData([]byte("k1"))},
 
@@ -69,7 +81,7 @@ func TestCmdKey(t *testing.T) {
 			resp.MakeIntData(0)},
 
 		{[][]byte{[]byte("pexpire"), []byte("k1"), []byte("ff")},
-			resp.MakeErrorData("error: ff is not int")},
+			resp.MakeErrorData("ERR value is not an integer or out of range")},
 	}
 
 	for _, test := range tests {
@@ -81,3 +93,179 @@ func TestCmdKey(t *testing.T) {
 		assert.Equal(t, test.expected, ret)
 	}
 }
+
+func TestCmdObject(t *testing.T) {
+
+	lfu := db.NewDataBase(1, db.WithEviction(db.EvictLFU))
+	lfu.SetKey("k", Slice("v"))
+	assert.Equal(t, resp.MakeIntData(5), execArgs(lfu, "object", "freq", "k"))
+
+	// 访问后计数器增长，而 object 命令本身不计入访问
+	lfu.GetKey("k")
+	assert.Equal(t, resp.MakeIntData(6), execArgs(lfu, "object", "freq", "k"))
+	assert.Equal(t, resp.MakeIntData(6), execArgs(lfu, "object", "freq", "k"))
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(lfu, "object", "freq", "none"))
+	_, isErr := execArgs(lfu, "object", "idletime", "k").(*resp.ErrorData)
+	assert.True(t, isErr)
+
+	lru := db.NewDataBase(1, db.WithEviction(db.EvictLRU))
+	lru.SetKey("k", Slice("v"))
+	global.SetGlobalClock(global.Now().Add(5 * time.Second))
+	assert.Equal(t, resp.MakeIntData(5), execArgs(lru, "object", "idletime", "k"))
+	lru.GetKey("k")
+	assert.Equal(t, resp.MakeIntData(0), execArgs(lru, "object", "idletime", "k"))
+	_, isErr = execArgs(lru, "object", "freq", "k").(*resp.ErrorData)
+	assert.True(t, isErr)
+
+	assert.Equal(t, resp.MakeErrorData("ERR unknown subcommand 'foo'. Try OBJECT HELP."), execArgs(lru, "object", "foo", "k"))
+}
+
+func TestCmdMemory(t *testing.T) {
+	database := db.NewDataBase(1)
+	database.SetKey("small", Slice("v"))
+	database.SetKey("large", Slice(strings.Repeat("v", 1001)))
+
+	small := execArgs(database, "memory", "usage", "small").(*resp.IntData).Data()
+	large := execArgs(database, "memory", "usage", "large").(*resp.IntData).Data()
+	assert.Equal(t, int64(1000), large-small)
+
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(database, "memory", "usage", "none"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "memory", "usage", "small", "foo", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"),
+		execArgs(database, "memory", "usage", "small", "samples", "-1"))
+	_, ok := execArgs(database, "memory", "usage", "small", "samples", "0").(*resp.IntData)
+	assert.True(t, ok)
+}
+
+func TestCmdExpireOptions(t *testing.T) {
+	database := db.NewDataBase(1)
+	global.UpdateGlobalClock()
+	now := global.Now().Unix()
+
+	database.SetKey("persistent", Slice("v"))
+	database.SetKey("volatile", Slice("v"))
+	database.SetTTL("volatile", now+100)
+
+	// nx 只在没有 ttl 时设置，xx 只在存在 ttl 时设置
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "expire", "volatile", "10", "nx"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "expire", "persistent", "10", "xx"))
+	assert.Equal(t, int64(-1), database.GetTTL("persistent"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "expire", "volatile", "50", "XX"))
+	assert.Equal(t, int64(50), database.GetTTL("volatile"))
+
+	// gt 只在新的过期时间更晚时设置，没有 ttl 的键视为永不过期
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "expire", "volatile", "40", "gt"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "expire", "volatile", "50", "gt"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "expire", "persistent", "40", "gt"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "pexpire", "volatile", "60000", "gt"))
+	assert.Equal(t, int64(60), database.GetTTL("volatile"))
+
+	// lt 只在新的过期时间更早时设置
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "expireat", "volatile", strconv.FormatInt(now+70, 10), "lt"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "pexpireat", "volatile", strconv.FormatInt((now+30)*1000, 10), "lt"))
+	assert.Equal(t, int64(30), database.GetTTL("volatile"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "expire", "persistent", "20", "lt"))
+	assert.Equal(t, int64(20), database.GetTTL("persistent"))
+
+	// gt 与 xx 可以同时使用
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "expire", "persistent", "25", "xx", "gt"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "expireat", "persistent", strconv.FormatInt(now+90, 10)))
+	assert.Equal(t, int64(90), database.GetTTL("persistent"))
+
+	// 不存在的键返回 0
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "expire", "none", "10", "lt"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "pexpireat", "none", "10"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR NX and XX, GT or LT options at the same time are not compatible"),
+		execArgs(database, "expire", "volatile", "10", "nx", "xx"))
+	assert.Equal(t, resp.MakeErrorData("ERR NX and XX, GT or LT options at the same time are not compatible"),
+		execArgs(database, "pexpire", "volatile", "10", "gt", "nx"))
+	assert.Equal(t, resp.MakeErrorData("ERR GT and LT options at the same time are not compatible"),
+		execArgs(database, "expireat", "volatile", "10", "gt", "lt"))
+	assert.Equal(t, resp.MakeErrorData("ERR Unsupported option keepttl"),
+		execArgs(database, "expire", "volatile", "10", "keepttl"))
+	assert.Equal(t, int64(30), database.GetTTL("volatile"))
+}
+
+func TestCmdDumpRestore(t *testing.T) {
+	database := db.NewDataBase(1)
+	global.UpdateGlobalClock()
+
+	execArgs(database, "rpush", "list", "a", "b", "c")
+	execArgs(database, "hset", "hash", "f1", "v1", "f2", "v2")
+	execArgs(database, "set", "str", "value")
+
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(database, "dump", "none"))
+
+	// 序列化之后能够恢复出相同的值
+	for _, key := range []string{"list", "hash", "str"} {
+		payload := execArgs(database, "dump", key).(*resp.BulkData).Data()
+		assert.Equal(t, resp.MakeStringData("OK"), execArgs(database, "restore", key+"2", "0", string(payload)))
+		expected, _ := database.DigestKey(key)
+		restored, _ := database.DigestKey(key + "2")
+		assert.Equal(t, expected, restored)
+		assert.Equal(t, int64(-1), database.GetTTL(key+"2"))
+	}
+
+	// 已经存在的键需要使用 REPLACE
+	payload := string(execArgs(database, "dump", "str").(*resp.BulkData).Data())
+	assert.Equal(t, resp.MakeErrorData("BUSYKEY Target key name already exists."), execArgs(database, "restore", "list", "0", payload))
+	assert.Equal(t, resp.MakeStringData("OK"), execArgs(database, "restore", "list", "10000", payload, "replace"))
+	assert.Equal(t, resp.MakeBulkData([]byte("value")), execArgs(database, "get", "list"))
+	assert.Equal(t, int64(10), database.GetTTL("list"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR Invalid TTL value, must be >= 0"), execArgs(database, "restore", "k", "-1", payload))
+	assert.Equal(t, resp.MakeErrorData("ERR DUMP payload version or checksum are wrong"), execArgs(database, "restore", "k", "0", "bad"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "restore", "k", "0", payload, "keep"))
+}
+
+func TestCmdScan(t *testing.T) {
+	database := db.NewDataBase(8)
+	global.UpdateGlobalClock()
+
+	lists := make([]string, 0)
+	for i := 0; i < 10; i++ {
+		k := strconv.Itoa(i)
+		execArgs(database, "set", "str:"+k, "v")
+		execArgs(database, "rpush", "list:"+k, "v")
+		execArgs(database, "hset", "hash:"+k, "f", "v")
+		lists = append(lists, "list:"+k)
+	}
+	// 过期的键不会被返回
+	database.SetKeyWithTTL("list:expired", structure.NewList(), global.Now().Unix()-1)
+
+	// fullScan 使用 scan 遍历整个数据库，返回全部的键以及遍历的次数
+	fullScan := func(args ...string) ([]string, int) {
+		keys := make([]string, 0)
+		cursor, calls := "0", 0
+		for {
+			ret := execArgs(database, append([]string{"scan", cursor}, args...)...).(*resp.ArrayData).Data()
+			for _, key := range ret[1].(*resp.ArrayData).Data() {
+				keys = append(keys, string(key.(*resp.BulkData).Data()))
+			}
+			calls++
+			cursor = string(ret[0].(*resp.BulkData).Data())
+			if cursor == "0" {
+				return keys, calls
+			}
+		}
+	}
+
+	all, calls := fullScan("count", "3")
+	assert.Len(t, all, 30)
+	assert.Greater(t, calls, 1)
+
+	// TYPE 只返回指定类型的键
+	keys, _ := fullScan("type", "list", "count", "3")
+	assert.ElementsMatch(t, lists, keys)
+	keys, _ = fullScan("TYPE", "zset")
+	assert.Empty(t, keys)
+
+	// 与 MATCH 组合使用
+	keys, _ = fullScan("match", "*:[0-2]", "type", "string")
+	assert.ElementsMatch(t, []string{"str:0", "str:1", "str:2"}, keys)
+
+	assert.Equal(t, resp.MakeErrorData("ERR invalid cursor"), execArgs(database, "scan", "x"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "scan", "0", "count", "0"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "scan", "0", "type"))
+}
@@ -37,23 +37,11 @@ func lPush(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	oldCost := int64(0)
-
-	value, ok := db.GetKey(string(cmd[1]))
-
-	if !ok {
-		value = structure.NewList()
-		db.SetKey(string(cmd[1]), value)
-	} else {
-		oldCost = value.Cost()
-	}
-
-	err := checkType(value, LIST)
+	listVal, err := db.GetOrCreateList(string(cmd[1]))
 	if err != nil {
-		return err
+		return resp.WrongTypeError()
 	}
-
-	listVal := value.(*structure.List)
+	oldCost := listVal.Cost()
 
 	n := 0
 
@@ -73,22 +61,11 @@ func rPush(db *db.DataBase, cmd [][]byte) resp.RedisData { // 进行输入类型
 		return e
 	}
 
-	oldCost := int64(0)
-
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
-		value = structure.NewList()
-		db.SetKey(string(cmd[1]), value)
-	} else {
-		oldCost = value.Cost()
-	}
-
-	err := checkType(value, LIST)
+	listVal, err := db.GetOrCreateList(string(cmd[1]))
 	if err != nil {
-		return err
+		return resp.WrongTypeError()
 	}
-
-	listVal := value.(*structure.List)
+	oldCost := listVal.Cost()
 
 	n := 0
 
@@ -123,7 +100,7 @@ func lPop(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		var w error
 		count, w = strconv.Atoi(string(cmd[2]))
 		if w != nil {
-			return resp.MakeErrorData("ERR value is not an integer or out of range")
+			return resp.NotIntegerError()
 		}
 	}
 	listVal := value.(*structure.List)
@@ -169,7 +146,7 @@ func rPop(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		var w error
 		count, w = strconv.Atoi(string(cmd[2]))
 		if w != nil {
-			return resp.MakeErrorData("ERR value is not an integer or out of range")
+			return resp.NotIntegerError()
 		}
 	}
 
@@ -214,7 +191,7 @@ func lIndex(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	pos, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	nodeVal, ok := listVal.Pos(pos)
@@ -225,14 +202,53 @@ func lIndex(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeBulkData(nodeVal.(structure.Slice))
 }
 
+// lPos 命令格式： lpos key element [RANK rank] [COUNT num-matches] [MAXLEN len]
 func lPos(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	e, ok := checkCommandAndLength(&cmd, "lpos", 3)
 	if !ok {
 		return e
 	}
 
+	rank, count, maxLen := 1, -1, 0
+
+	for i := 3; i < len(cmd); i += 2 {
+
+		if i+1 >= len(cmd) {
+			return resp.SyntaxError()
+		}
+
+		n, err := strconv.Atoi(string(cmd[i+1]))
+		if err != nil {
+			return resp.NotIntegerError()
+		}
+
+		switch strings.ToLower(string(cmd[i])) {
+		case "rank":
+			if n == 0 {
+				return resp.MakeErrorData("ERR RANK can't be zero: use 1 to start from the first match, " +
+					"2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "count":
+			if n < 0 {
+				return resp.MakeErrorData("ERR COUNT can't be negative")
+			}
+			count = n
+		case "maxlen":
+			if n < 0 {
+				return resp.MakeErrorData("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return resp.SyntaxError()
+		}
+	}
+
 	value, ok := db.GetKey(string(cmd[1]))
 	if !ok {
+		if count >= 0 {
+			return resp.MakeEmptyArrayData()
+		}
 		return resp.MakeStringData("nil")
 	}
 
@@ -243,17 +259,51 @@ func lPos(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	listVal := value.(*structure.List)
 
-	pos := 0
+	// rank 为负数时从尾部开始查找，但返回的下标仍然是从头部开始计算的
+	reverse := rank < 0
+	if reverse {
+		rank = -rank
+	}
 
-	for cur := listVal.FrontNode(); cur != nil; cur = cur.Next() {
-		byteVal := cur.Value.(structure.Slice)
+	cur := listVal.FrontNode()
+	pos, step := 0, 1
+	if reverse {
+		cur = listVal.BackNode()
+		pos, step = listVal.Size()-1, -1
+	}
 
-		if string(byteVal) == string(cmd[2]) {
-			return resp.MakeIntData(int64(pos))
+	res := make([]resp.RedisData, 0)
+
+	for scanned := 0; cur != nil && (maxLen == 0 || scanned < maxLen); scanned++ {
+
+		if string(cur.Value.(structure.Slice)) == string(cmd[2]) {
+			if rank > 1 {
+				rank--
+			} else {
+				res = append(res, resp.MakeIntData(int64(pos)))
+				// 未指定 count 时只需要一个结果，count 为 0 时返回全部匹配的下标
+				if count < 0 || (count > 0 && len(res) >= count) {
+					break
+				}
+			}
+		}
+
+		if reverse {
+			cur = cur.Prev()
+		} else {
+			cur = cur.Next()
+		}
+		pos += step
+	}
+
+	if count < 0 {
+		if len(res) == 0 {
+			return resp.MakeStringData("nil")
 		}
-		pos++
+		return res[0]
 	}
-	return resp.MakeStringData("nil")
+
+	return resp.MakeArrayData(res)
 }
 
 func lSet(db *db.DataBase, cmd [][]byte) resp.RedisData {
@@ -276,7 +326,7 @@ func lSet(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	pos, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	oldCost := listVal.Cost()
@@ -312,7 +362,7 @@ func lRem(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	count, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	oldCost := listVal.Cost()
@@ -357,12 +407,12 @@ func lRange(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	start, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	end, w := strconv.Atoi(string(cmd[3]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	values, n := listVal.Range(start, end)
@@ -398,12 +448,12 @@ func lTrim(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	start, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	end, w := strconv.Atoi(string(cmd[3]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	oldCost := listVal.Cost()
@@ -458,7 +508,7 @@ func lMove(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 		} else {
 
-			return resp.MakeErrorData("ERR syntax error")
+			return resp.SyntaxError()
 		}
 
 	} else if strings.ToUpper(string(cmd[3])) == "RIGHT" {
@@ -473,11 +523,11 @@ func lMove(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 		} else {
 
-			return resp.MakeErrorData("ERR syntax error")
+			return resp.SyntaxError()
 		}
 
 	} else {
-		return resp.MakeErrorData("ERR syntax error")
+		return resp.SyntaxError()
 	}
 
 	db.ReviseNotify(string(cmd[1]), 0, 0)
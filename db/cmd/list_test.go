@@ -149,3 +149,82 @@ func TestCmdList(t *testing.T) {
 		}
 	}
 }
+
+func TestCmdListPos(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	ints := func(n ...int64) resp.RedisData {
+		res := make([]resp.RedisData, len(n))
+		for i := range n {
+			res[i] = resp.MakeIntData(n[i])
+		}
+		return resp.MakeArrayData(res)
+	}
+
+	tests := []struct {
+		input    [][]byte
+		expected resp.RedisData
+	}{
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("a"), []byte("count"), []byte("1")},
+			resp.MakeEmptyArrayData()},
+
+		{[][]byte{[]byte("rpush"), []byte("test"), []byte("a"), []byte("b"), []byte("c"), []byte("1"),
+			[]byte("2"), []byte("3"), []byte("c"), []byte("c")},
+			resp.MakeIntData(8)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c")},
+			resp.MakeIntData(2)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("rank"), []byte("2")},
+			resp.MakeIntData(6)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("rank"), []byte("-1")},
+			resp.MakeIntData(7)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("rank"), []byte("-3")},
+			resp.MakeIntData(2)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("rank"), []byte("4")},
+			resp.MakeStringData("nil")},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("count"), []byte("2")},
+			ints(2, 6)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("count"), []byte("0")},
+			ints(2, 6, 7)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("rank"), []byte("-1"), []byte("count"), []byte("2")},
+			ints(7, 6)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("x"), []byte("count"), []byte("2")},
+			resp.MakeEmptyArrayData()},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("count"), []byte("0"), []byte("maxlen"), []byte("7")},
+			ints(2, 6)},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("maxlen"), []byte("2")},
+			resp.MakeStringData("nil")},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("a"), []byte("rank"), []byte("-1"), []byte("maxlen"), []byte("7")},
+			resp.MakeStringData("nil")},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("rank"), []byte("0")},
+			resp.MakeErrorData("ERR RANK can't be zero: use 1 to start from the first match, " +
+				"2 from the second ... or use negative to start from the end of the list")},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("count"), []byte("-1")},
+			resp.MakeErrorData("ERR COUNT can't be negative")},
+
+		{[][]byte{[]byte("lpos"), []byte("test"), []byte("c"), []byte("maxlen")},
+			resp.MakeErrorData("ERR syntax error")},
+	}
+
+	for _, test := range tests {
+		cmd, exist := global.FindCommand(string(test.input[0]))
+		assert.True(t, exist)
+		c := cmd.Function().(command)
+
+		ret := c(database, test.input)
+		assert.Equal(t, test.expected, ret, fmt.Sprintf("%s", test.input))
+	}
+}
@@ -15,32 +15,16 @@ func sadd(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	// get 会自动检查是否过期
-	value, ok := db.GetKey(string(cmd[1]))
-
-	if !ok {
-		set := structure.NewSet()
-
-		added := 0
-		for _, key := range cmd[2:] {
-			if set.Add(string(key)) {
-				added++
-			}
-		}
-
-		db.SetKey(string(cmd[1]), set)
-		return resp.MakeIntData(int64(added))
-	}
-
-	// 进行类型检查，会自动检查过期选项
-	if err := checkType(value, SET); err != nil {
-		return err
+	setVal, err := db.GetOrCreateSet(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
 	}
 
-	oldCost := value.Cost()
+	oldCost := setVal.Cost()
 
 	added := 0
 	for _, key := range cmd[2:] {
-		if value.(*structure.Set).Add(string(key)) {
+		if setVal.Add(string(key)) {
 			added++
 		}
 	}
@@ -48,7 +32,7 @@ func sadd(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 重置 TTL
 	db.RemoveTTL(string(cmd[1]))
 
-	db.ReviseNotify(string(cmd[1]), oldCost, value.Cost())
+	db.ReviseNotify(string(cmd[1]), oldCost, setVal.Cost())
 
 	return resp.MakeIntData(int64(added))
 }
@@ -142,17 +126,18 @@ func sMembers(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	// get 会自动检查是否过期
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
+	setVal, err := db.GetSet(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
+	}
+	if setVal == nil {
 		return resp.MakeArrayData(nil)
 	}
 
-	if err := checkType(value, SET); err != nil {
-		return err
+	if e := checkReplySize(setVal.Size()); e != nil {
+		return e
 	}
 
-	setVal := value.(*structure.Set)
-
 	res := make([]resp.RedisData, setVal.Size())
 
 	ks, _ := setVal.KeysByte("")
@@ -165,17 +150,36 @@ func sMembers(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeArrayData(res)
 }
 
+// sPop 随机删除并返回集合中的成员，没有 count 参数时返回单个成员，集合为空时会删除键
 func sPop(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
-	e, ok := checkCommandAndLength(&cmd, "spop", 3)
+	e, ok := checkCommandAndLength(&cmd, "spop", 2)
 	if !ok {
 		return e
 	}
+	if len(cmd) > 3 {
+		return resp.SyntaxError()
+	}
+
+	num := 1
+	if len(cmd) == 3 {
+		var err error
+		num, err = strconv.Atoi(string(cmd[2]))
+		if err != nil {
+			return resp.MakeErrorData("ERR value is out of range, must be positive")
+		}
+		if num < 0 {
+			return resp.MakeErrorData("ERR value is out of range, must be positive")
+		}
+	}
 
 	// get 会自动检查是否过期
 	value, ok := db.GetKey(string(cmd[1]))
 	if !ok {
-		return resp.MakeArrayData(nil)
+		if len(cmd) == 2 {
+			return resp.MakeStringData("nil")
+		}
+		return resp.MakeEmptyArrayData()
 	}
 
 	if err := checkType(value, SET); err != nil {
@@ -183,35 +187,58 @@ func sPop(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	setVal := value.(*structure.Set)
-
-	num, err := strconv.Atoi(string(cmd[2]))
-	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
-	}
+	oldCost := setVal.Cost()
 
 	ks := setVal.RandomPop(num)
 
-	res := make([]resp.RedisData, len(ks))
+	// 集合为空时需要删除键
+	if setVal.Size() == 0 {
+		db.DeleteKey(string(cmd[1]))
+	} else {
+		db.ReviseNotify(string(cmd[1]), oldCost, setVal.Cost())
+	}
 
-	i := 0
+	res := make([]resp.RedisData, 0, len(ks))
 	for k := range ks {
-		res[i] = resp.MakeBulkData([]byte(k))
-		i++
+		res = append(res, resp.MakeBulkData([]byte(k)))
+	}
+
+	if len(cmd) == 2 {
+		if len(res) == 0 {
+			return resp.MakeStringData("nil")
+		}
+		return res[0]
 	}
 	return resp.MakeArrayData(res)
 }
 
+// sRandMember 随机返回集合中的成员，count 为负数时返回的成员可能重复
 func sRandMember(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
-	e, ok := checkCommandAndLength(&cmd, "srandmember", 3)
+	e, ok := checkCommandAndLength(&cmd, "srandmember", 2)
 	if !ok {
 		return e
 	}
+	if len(cmd) > 3 {
+		return resp.SyntaxError()
+	}
+
+	num := 1
+	if len(cmd) == 3 {
+		var err error
+		num, err = strconv.Atoi(string(cmd[2]))
+		if err != nil {
+			return resp.NotIntegerError()
+		}
+	}
 
 	// get 会自动检查是否过期
 	value, ok := db.GetKey(string(cmd[1]))
 	if !ok {
-		return resp.MakeIntData(0)
+		if len(cmd) == 2 {
+			return resp.MakeStringData("nil")
+		}
+		return resp.MakeEmptyArrayData()
 	}
 
 	if err := checkType(value, SET); err != nil {
@@ -220,23 +247,32 @@ func sRandMember(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	setVal := value.(*structure.Set)
 
-	num, err := strconv.Atoi(string(cmd[2]))
-	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
-	}
-
-	ks := setVal.RandomGet(num)
+	var res []resp.RedisData
 
-	res := make([]resp.RedisData, len(ks))
+	if num < 0 {
+		ks := setVal.RandomGetRepeatable(-num)
+		res = make([]resp.RedisData, len(ks))
+		for i, k := range ks {
+			res[i] = resp.MakeBulkData([]byte(k))
+		}
+	} else {
+		ks := setVal.RandomGet(num)
+		res = make([]resp.RedisData, 0, len(ks))
+		for k := range ks {
+			res = append(res, resp.MakeBulkData([]byte(k)))
+		}
+	}
 
-	i := 0
-	for k := range ks {
-		res[i] = resp.MakeBulkData([]byte(k))
-		i++
+	if len(cmd) == 2 {
+		if len(res) == 0 {
+			return resp.MakeStringData("nil")
+		}
+		return res[0]
 	}
 	return resp.MakeArrayData(res)
 }
 
+// sMove 将成员从源集合移动到目标集合，目标集合不存在时会被创建，源集合为空时会被删除
 func sMove(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	e, ok := checkCommandAndLength(&cmd, "smove", 4)
@@ -244,8 +280,10 @@ func sMove(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
+	src, dst, member := string(cmd[1]), string(cmd[2]), string(cmd[3])
+
 	// get 会自动检查是否过期
-	value1, ok := db.GetKey(string(cmd[1]))
+	value1, ok := db.GetKey(src)
 	if !ok {
 		return resp.MakeIntData(0)
 	}
@@ -257,26 +295,44 @@ func sMove(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	setVal1 := value1.(*structure.Set)
 
 	// get 会自动检查是否过期
-	value2, ok := db.GetKey(string(cmd[2]))
-	if !ok {
-		return resp.MakeIntData(0)
+	value2, ok := db.GetKey(dst)
+	if ok {
+		if err := checkType(value2, SET); err != nil {
+			return err
+		}
 	}
 
-	if err := checkType(value2, SET); err != nil {
-		return err
+	// 源集合与目标集合相同时不需要移动
+	if src == dst {
+		if setVal1.Exist(member) {
+			return resp.MakeIntData(1)
+		}
+		return resp.MakeIntData(0)
 	}
 
-	setVal2 := value2.(*structure.Set)
+	oldCost1 := setVal1.Cost()
+	if !setVal1.Delete(member) {
+		return resp.MakeIntData(0)
+	}
 
-	if setVal1.Delete(string(cmd[3])) {
-		setVal2.Add(string(cmd[3]))
-		return resp.MakeIntData(1)
+	if setVal1.Size() == 0 {
+		db.DeleteKey(src)
+	} else {
+		db.ReviseNotify(src, oldCost1, setVal1.Cost())
 	}
 
-	db.ReviseNotify(string(cmd[1]), 0, 0)
-	db.ReviseNotify(string(cmd[2]), 0, 0)
+	if !ok {
+		setVal2 := structure.NewSet()
+		setVal2.Add(member)
+		db.SetKey(dst, setVal2)
+	} else {
+		setVal2 := value2.(*structure.Set)
+		oldCost2 := setVal2.Cost()
+		setVal2.Add(member)
+		db.ReviseNotify(dst, oldCost2, setVal2.Cost())
+	}
 
-	return resp.MakeIntData(0)
+	return resp.MakeIntData(1)
 }
 
 // sDiff 返回第一个集合中特有元素
@@ -310,11 +366,14 @@ func sDiff(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return resp.MakeArrayData(nil)
 	}
 
-	ks, n := sets[0].Keys("")
-
 	res := make([]resp.RedisData, 0)
+	budget := newTimeBudget()
+	exceeded := false
 
-	for i := 0; i < n; i++ {
+	sets[0].Range(func(key string) bool {
+		if exceeded = budget.exceeded(); exceeded {
+			return false
+		}
 		ok := true
 		for j := 1; j < sl && ok; j++ {
 
@@ -322,13 +381,17 @@ func sDiff(db *db.DataBase, cmd [][]byte) resp.RedisData {
 				continue
 			}
 
-			ok = !sets[j].Exist(ks[i])
+			ok = !sets[j].Exist(key)
 		}
 		if ok {
-			res = append(res, resp.MakeBulkData([]byte(ks[i])))
+			res = append(res, resp.MakeBulkData([]byte(key)))
 		}
-	}
+		return true
+	})
 
+	if exceeded {
+		return timeBudgetError("sdiff")
+	}
 	return resp.MakeArrayData(res)
 }
 
@@ -408,6 +471,8 @@ func sInter(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	sl := len(cmd) - 1
 
 	res := make([]resp.RedisData, 0)
+	budget := newTimeBudget()
+	exceeded := false
 
 	// 取出所有集合元素指针，如果 key 不是集合，则存储为 nil
 	for _, s := range cmd[1:] {
@@ -420,15 +485,19 @@ func sInter(db *db.DataBase, cmd [][]byte) resp.RedisData {
 			continue
 		}
 
-		s := value.(*structure.Set)
-		// 取出集合的所有元素，并放入哈希表中
-		sks, _ := s.Keys("")
-		for _, k := range sks {
-
+		// 遍历集合的所有元素，并放入哈希表中
+		value.(*structure.Set).Range(func(k string) bool {
+			if exceeded = budget.exceeded(); exceeded {
+				return false
+			}
 			if ks[k]++; ks[k] == sl {
 				// 所有集合都有该元素
 				res = append(res, resp.MakeBulkData([]byte(k)))
 			}
+			return true
+		})
+		if exceeded {
+			return timeBudgetError("sinter")
 		}
 	}
 
@@ -530,6 +599,8 @@ func sUnion(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	// 去重
 	ks := make(map[string]struct{})
+	budget := newTimeBudget()
+	exceeded := false
 
 	// 取出每个集合的元素
 	for i := 0; i < sl; i++ {
@@ -538,12 +609,16 @@ func sUnion(db *db.DataBase, cmd [][]byte) resp.RedisData {
 			continue
 		}
 
-		sks, _ := sets[i].Keys("")
-
-		for _, k := range sks {
+		sets[i].Range(func(k string) bool {
+			if exceeded = budget.exceeded(); exceeded {
+				return false
+			}
 			ks[k] = struct{}{}
+			return true
+		})
+		if exceeded {
+			return timeBudgetError("sunion")
 		}
-
 	}
 
 	res := make([]resp.RedisData, len(ks))
@@ -608,7 +683,7 @@ func registerSetCommands() {
 	registerCommand("sismember", sismember, RD)
 	registerCommand("srem", sRem, WR)
 	registerCommand("smembers", sMembers, RD)
-	registerCommand("spop", sPop, RD)
+	registerCommand("spop", sPop, WR)
 	registerCommand("srandmember", sRandMember, RD)
 	registerCommand("smove", sMove, WR)
 
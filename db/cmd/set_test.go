@@ -6,7 +6,9 @@ import (
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestCmdSet(t *testing.T) {
@@ -38,7 +40,7 @@ func TestCmdSet(t *testing.T) {
 			resp.MakeIntData(2)},
 
 		{[][]byte{[]byte("smove"), []byte("test"), []byte("k1"), []byte("k2")},
-			resp.MakeIntData(0)},
+			resp.MakeIntData(1)},
 
 		{[][]byte{[]byte("smove"), []byte("test"), []byte("k1"), []byte("k3")},
 			resp.MakeIntData(0)},
@@ -191,3 +193,190 @@ func TestCmdMultiSetStore(t *testing.T) {
 		database.DeleteKey("set3")
 	}
 }
+
+func TestCmdSPop(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	set := structure.NewSet()
+	for _, k := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		set.Add(k)
+	}
+	database.SetKey("s", set)
+
+	// 没有 count 参数时返回单个成员
+	ret, ok := execArgs(database, "spop", "s").(*resp.BulkData)
+	assert.True(t, ok)
+	assert.False(t, set.Exist(string(ret.Data())))
+	assert.Equal(t, 4, set.Size())
+
+	// 返回的成员数量不会超过集合大小
+	assert.Equal(t, 3, len(execArgs(database, "spop", "s", "3").(*resp.ArrayData).Data()))
+	assert.Equal(t, 1, set.Size())
+	assert.Equal(t, resp.MakeEmptyArrayData(), execArgs(database, "spop", "s", "0"))
+	assert.Equal(t, 1, len(execArgs(database, "spop", "s", "10").(*resp.ArrayData).Data()))
+
+	// 集合为空时删除键
+	_, exist := database.GetKey("s")
+	assert.False(t, exist)
+
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(database, "spop", "s"))
+	assert.Equal(t, resp.MakeEmptyArrayData(), execArgs(database, "spop", "s", "2"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is out of range, must be positive"), execArgs(database, "spop", "s", "-1"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "spop", "s", "1", "1"))
+
+	database.SetKey("str", Slice("v"))
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"), execArgs(database, "spop", "str"))
+}
+
+func TestCmdSRandMember(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	set := structure.NewSet()
+	set.Add("k1")
+	set.Add("k2")
+	database.SetKey("s", set)
+
+	keys := []resp.RedisData{
+		resp.MakeBulkData([]byte("k1")),
+		resp.MakeBulkData([]byte("k2")),
+	}
+
+	assert.Contains(t, keys, execArgs(database, "srandmember", "s"))
+
+	// 正数 count 返回不重复的成员
+	ret := execArgs(database, "srandmember", "s", "5").(*resp.ArrayData).Data()
+	assert.ElementsMatch(t, keys, ret)
+
+	// 负数 count 返回的成员可能重复
+	ret = execArgs(database, "srandmember", "s", "-10").(*resp.ArrayData).Data()
+	assert.Equal(t, 10, len(ret))
+	assert.Subset(t, keys, ret)
+
+	// 不会删除成员
+	assert.Equal(t, 2, set.Size())
+
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(database, "srandmember", "none"))
+	assert.Equal(t, resp.MakeEmptyArrayData(), execArgs(database, "srandmember", "none", "-3"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execArgs(database, "srandmember", "s", "a"))
+}
+
+func TestCmdSMove(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	src := structure.NewSet()
+	src.Add("m1")
+	src.Add("m2")
+	database.SetKey("src", src)
+
+	dst := structure.NewSet()
+	dst.Add("m3")
+	database.SetKey("dst", dst)
+
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "smove", "src", "dst", "m1"))
+	assert.False(t, src.Exist("m1"))
+	assert.True(t, dst.Exist("m1"))
+
+	// 成员不在源集合中时不做任何修改
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "smove", "src", "dst", "m3"))
+	assert.Equal(t, 1, src.Size())
+	assert.Equal(t, 2, dst.Size())
+
+	// 目标集合不存在时会被创建，源集合为空时会被删除
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "smove", "src", "new", "m2"))
+	_, exist := database.GetKey("src")
+	assert.False(t, exist)
+	value, exist := database.GetKey("new")
+	assert.True(t, exist)
+	assert.True(t, value.(*structure.Set).Exist("m2"))
+
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "smove", "src", "dst", "m2"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "smove", "dst", "dst", "m3"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "smove", "dst", "dst", "none"))
+
+	database.SetKey("str", Slice("v"))
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"), execArgs(database, "smove", "str", "dst", "m1"))
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"), execArgs(database, "smove", "dst", "str", "m1"))
+	assert.True(t, dst.Exist("m1"))
+}
+
+func TestCmdMaxReplyElements(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	old := global.MaxReplyElements
+	global.MaxReplyElements = 100
+	defer func() { global.MaxReplyElements = old }()
+
+	tooLarge := resp.MakeErrorData("ERR result set too large, use SCAN")
+
+	for i := 0; i < 100; i++ {
+		execArgs(database, "sadd", "set", strconv.Itoa(i))
+		execArgs(database, "hset", "hash", strconv.Itoa(i), "v")
+	}
+
+	// 元素数量恰好达到上限时正常返回
+	assert.Len(t, execArgs(database, "smembers", "set").(*resp.ArrayData).Data(), 100)
+	assert.Len(t, execArgs(database, "hgetall", "hash").(*resp.ArrayData).Data(), 200)
+
+	for i := 100; i < 1000; i++ {
+		execArgs(database, "sadd", "set", strconv.Itoa(i))
+		execArgs(database, "hset", "hash", strconv.Itoa(i), "v")
+		execArgs(database, "set", strconv.Itoa(i), "v")
+	}
+
+	assert.Equal(t, tooLarge, execArgs(database, "smembers", "set"))
+	assert.Equal(t, tooLarge, execArgs(database, "hgetall", "hash"))
+	assert.Equal(t, tooLarge, execArgs(database, "hkeys", "hash"))
+	assert.Equal(t, tooLarge, execArgs(database, "hvals", "hash"))
+	assert.Equal(t, tooLarge, execArgs(database, "keys", "^1$"))
+
+	// 不返回全部元素的命令不受影响
+	assert.Equal(t, resp.MakeIntData(1000), execArgs(database, "scard", "set"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "sismember", "set", "999"))
+
+	// 0 代表不限制
+	global.MaxReplyElements = 0
+	assert.Len(t, execArgs(database, "smembers", "set").(*resp.ArrayData).Data(), 1000)
+	assert.Len(t, execArgs(database, "hkeys", "hash").(*resp.ArrayData).Data(), 1000)
+}
+
+func TestCmdSetTimeBudget(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	old := global.CommandTimeBudget
+	defer func() { global.CommandTimeBudget = old }()
+
+	a, b := structure.NewSet(), structure.NewSet()
+	for i := 0; i < 20000; i++ {
+		a.Add(strconv.Itoa(i))
+		b.Add(strconv.Itoa(i + 10000))
+	}
+	database.SetKey("a", a)
+	database.SetKey("b", b)
+
+	// 超过时间限制时放弃执行并返回 BUSY 错误
+	global.CommandTimeBudget = time.Nanosecond
+	for _, name := range []string{"sinter", "sunion", "sdiff"} {
+		ret := execArgs(database, name, "a", "b")
+		e, ok := ret.(*resp.ErrorData)
+		assert.True(t, ok, name)
+		if ok {
+			assert.Equal(t, "BUSY "+name+" exceeded the command time budget, try smaller sets", e.Error())
+		}
+	}
+
+	// 较小的集合在第一次检查之前就已经完成
+	small := structure.NewSet()
+	for i := 0; i < 100; i++ {
+		small.Add(strconv.Itoa(i))
+	}
+	database.SetKey("small", small)
+	assert.Len(t, execArgs(database, "sinter", "small", "small").(*resp.ArrayData).Data(), 100)
+
+	// 时间充足以及不限制时返回完整的结果
+	for _, budget := range []time.Duration{time.Minute, 0} {
+		global.CommandTimeBudget = budget
+		assert.Len(t, execArgs(database, "sinter", "a", "b").(*resp.ArrayData).Data(), 10000)
+		assert.Len(t, execArgs(database, "sunion", "a", "b").(*resp.ArrayData).Data(), 30000)
+		assert.Len(t, execArgs(database, "sdiff", "a", "b").(*resp.ArrayData).Data(), 10000)
+	}
+}
@@ -0,0 +1,469 @@
+package cmd
+
+import (
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// streamEntriesToResp 将消息转换为 [id, [field, value ...]] 格式的数组
+func streamEntriesToResp(entries []*structure.StreamEntry) resp.RedisData {
+	res := make([]resp.RedisData, len(entries))
+	for i, entry := range entries {
+		if entry.Fields == nil {
+			// 已被删除的消息
+			res[i] = resp.MakeArrayData([]resp.RedisData{
+				resp.MakeBulkData([]byte(entry.ID.String())),
+				resp.MakeArrayData(nil),
+			})
+			continue
+		}
+		fields := make([]resp.RedisData, len(entry.Fields))
+		for j, f := range entry.Fields {
+			fields[j] = resp.MakeBulkData(f)
+		}
+		res[i] = resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte(entry.ID.String())),
+			resp.MakeArrayData(fields),
+		})
+	}
+	return resp.MakeArrayData(res)
+}
+
+// xAdd 命令格式： xadd key *|id field value [field value ...]
+func xAdd(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "xadd", 5)
+	if !ok {
+		return e
+	}
+
+	if (len(cmd)-3)%2 != 0 {
+		return resp.WrongArgsError("xadd")
+	}
+
+	value, exist := db.GetKey(string(cmd[1]))
+	if err := checkType(value, STREAM); err != nil {
+		return err
+	}
+
+	stream := structure.NewStream()
+	if exist {
+		stream = value.(*structure.Stream)
+	}
+
+	var id structure.StreamID
+	idStr := string(cmd[2])
+
+	if idStr == "*" {
+
+		id = stream.NextID(uint64(global.Now().UnixMilli()))
+
+	} else if strings.HasSuffix(idStr, "-*") {
+
+		msVal, err := strconv.ParseUint(strings.TrimSuffix(idStr, "-*"), 10, 64)
+		if err != nil {
+			return resp.MakeErrorData("ERR Invalid stream ID specified as stream command argument")
+		}
+		id, ok = stream.NextSeqID(msVal)
+		if !ok {
+			return resp.MakeErrorData("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+
+	} else {
+
+		var err error
+		id, err = structure.ParseStreamID(idStr, 0)
+		if err != nil {
+			return resp.MakeErrorData(err.Error())
+		}
+		if id.IsZero() {
+			return resp.MakeErrorData("ERR The ID specified in XADD must be greater than 0-0")
+		}
+	}
+
+	fields := make([][]byte, len(cmd)-3)
+	copy(fields, cmd[3:])
+
+	oldCost := stream.Cost()
+
+	if !stream.Append(id, fields) {
+		return resp.MakeErrorData("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+
+	if !exist {
+		db.SetKey(string(cmd[1]), stream)
+	} else {
+		db.ReviseNotify(string(cmd[1]), oldCost, stream.Cost())
+	}
+
+	return resp.MakeBulkData([]byte(id.String()))
+}
+
+func xLen(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "xlen", 2)
+	if !ok {
+		return e
+	}
+
+	stream, err := db.GetStream(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
+	}
+	if stream == nil {
+		return resp.MakeIntData(0)
+	}
+
+	return resp.MakeIntData(int64(stream.Size()))
+}
+
+// xRange 命令格式： xrange key start end [COUNT count]，start 与 end 都是闭区间
+func xRange(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "xrange", 4)
+	if !ok {
+		return e
+	}
+
+	start := structure.MinStreamID
+	if s := string(cmd[2]); s != "-" {
+		id, err := structure.ParseStreamID(s, 0)
+		if err != nil {
+			return resp.MakeErrorData(err.Error())
+		}
+		start = id
+	}
+
+	end := structure.MaxStreamID
+	if s := string(cmd[3]); s != "+" {
+		id, err := structure.ParseStreamID(s, math.MaxUint64)
+		if err != nil {
+			return resp.MakeErrorData(err.Error())
+		}
+		end = id
+	}
+
+	count := 0
+	if len(cmd) == 6 && strings.ToLower(string(cmd[4])) == "count" {
+		c, err := strconv.Atoi(string(cmd[5]))
+		if err != nil {
+			return resp.NotIntegerError()
+		}
+		if c <= 0 {
+			return resp.MakeEmptyArrayData()
+		}
+		count = c
+	} else if len(cmd) != 4 {
+		return resp.SyntaxError()
+	}
+
+	value, ok := db.GetKey(string(cmd[1]))
+	if !ok {
+		return resp.MakeEmptyArrayData()
+	}
+
+	if err := checkType(value, STREAM); err != nil {
+		return err
+	}
+
+	return streamEntriesToResp(value.(*structure.Stream).Range(start, end, count))
+}
+
+// xRead 命令格式： xread [COUNT count] STREAMS key [key ...] id [id ...]，该命令不会阻塞
+func xRead(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "xread", 4)
+	if !ok {
+		return e
+	}
+
+	count := 0
+	pos := 1
+	if strings.ToLower(string(cmd[pos])) == "count" {
+		c, err := strconv.Atoi(string(cmd[pos+1]))
+		if err != nil {
+			return resp.NotIntegerError()
+		}
+		count = c
+		pos += 2
+	}
+
+	if pos >= len(cmd) || strings.ToLower(string(cmd[pos])) != "streams" {
+		return resp.SyntaxError()
+	}
+	pos++
+
+	args := cmd[pos:]
+	if len(args) == 0 || len(args)%2 != 0 {
+		return resp.MakeErrorData("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+
+	n := len(args) / 2
+	res := make([]resp.RedisData, 0, n)
+
+	for i := 0; i < n; i++ {
+
+		key := args[i]
+		value, exist := db.GetKey(string(key))
+		if err := checkType(value, STREAM); err != nil {
+			return err
+		}
+
+		var start structure.StreamID
+		if s := string(args[n+i]); s == "$" {
+			if !exist {
+				continue
+			}
+			start = value.(*structure.Stream).LastID()
+		} else {
+			id, err := structure.ParseStreamID(s, 0)
+			if err != nil {
+				return resp.MakeErrorData(err.Error())
+			}
+			start = id
+		}
+
+		if !exist {
+			continue
+		}
+
+		entries := value.(*structure.Stream).After(start, count)
+		if len(entries) == 0 {
+			continue
+		}
+
+		res = append(res, resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData(key),
+			streamEntriesToResp(entries),
+		}))
+	}
+
+	if len(res) == 0 {
+		return resp.MakeArrayData(nil)
+	}
+
+	return resp.MakeArrayData(res)
+}
+
+// xGroup 命令格式： xgroup create key group id|$ [MKSTREAM] 或 xgroup destroy key group
+func xGroup(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "xgroup", 4)
+	if !ok {
+		return e
+	}
+
+	key := string(cmd[2])
+	group := string(cmd[3])
+
+	value, exist := db.GetKey(key)
+	if err := checkType(value, STREAM); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(string(cmd[1])) {
+
+	case "create":
+
+		if len(cmd) != 5 && len(cmd) != 6 {
+			return resp.SyntaxError()
+		}
+		mkStream := len(cmd) == 6
+		if mkStream && strings.ToLower(string(cmd[5])) != "mkstream" {
+			return resp.SyntaxError()
+		}
+
+		if !exist {
+			if !mkStream {
+				return resp.MakeErrorData("ERR The XGROUP subcommand requires the key to exist. " +
+					"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+			}
+			value = structure.NewStream()
+		}
+		stream := value.(*structure.Stream)
+
+		var id structure.StreamID
+		if s := string(cmd[4]); s == "$" {
+			id = stream.LastID()
+		} else {
+			parsed, err := structure.ParseStreamID(s, 0)
+			if err != nil {
+				return resp.MakeErrorData(err.Error())
+			}
+			id = parsed
+		}
+
+		oldCost := stream.Cost()
+		if !stream.CreateGroup(group, id) {
+			return resp.MakeErrorData("BUSYGROUP Consumer Group name already exists")
+		}
+
+		if !exist {
+			db.SetKey(key, stream)
+		} else {
+			db.ReviseNotify(key, oldCost, stream.Cost())
+		}
+		return resp.MakeStringData("OK")
+
+	case "destroy":
+
+		if !exist {
+			return resp.MakeErrorData("ERR The XGROUP subcommand requires the key to exist.")
+		}
+		stream := value.(*structure.Stream)
+		oldCost := stream.Cost()
+		if !stream.DestroyGroup(group) {
+			return resp.MakeIntData(0)
+		}
+		db.ReviseNotify(key, oldCost, stream.Cost())
+		return resp.MakeIntData(1)
+	}
+
+	return resp.MakeErrorData("ERR unknown subcommand '" + string(cmd[1]) + "'")
+}
+
+// xReadGroup 命令格式： xreadgroup GROUP group consumer [COUNT count] [NOACK] STREAMS key [key ...] id [id ...]
+// id 为 ">" 时读取组内尚未投递的消息，否则读取该消费者待确认列表中的消息
+func xReadGroup(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "xreadgroup", 7)
+	if !ok {
+		return e
+	}
+
+	if strings.ToLower(string(cmd[1])) != "group" {
+		return resp.SyntaxError()
+	}
+	group := string(cmd[2])
+	consumer := string(cmd[3])
+
+	count := 0
+	noAck := false
+	pos := 4
+	for ; pos < len(cmd); pos++ {
+		opt := strings.ToLower(string(cmd[pos]))
+		if opt == "count" && pos+1 < len(cmd) {
+			c, err := strconv.Atoi(string(cmd[pos+1]))
+			if err != nil {
+				return resp.NotIntegerError()
+			}
+			count = c
+			pos++
+		} else if opt == "noack" {
+			noAck = true
+		} else {
+			break
+		}
+	}
+
+	if pos >= len(cmd) || strings.ToLower(string(cmd[pos])) != "streams" {
+		return resp.SyntaxError()
+	}
+	pos++
+
+	args := cmd[pos:]
+	if len(args) == 0 || len(args)%2 != 0 {
+		return resp.MakeErrorData("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+	}
+
+	n := len(args) / 2
+	res := make([]resp.RedisData, 0, n)
+	now := global.Now().UnixMilli()
+
+	for i := 0; i < n; i++ {
+
+		key := string(args[i])
+		value, exist := db.GetKey(key)
+		if err := checkType(value, STREAM); err != nil {
+			return err
+		}
+
+		var stream *structure.Stream
+		var g *structure.StreamGroup
+		if exist {
+			stream = value.(*structure.Stream)
+			g, exist = stream.Group(group)
+		}
+		if !exist {
+			return resp.MakeErrorData("NOGROUP No such key '" + key + "' or consumer group '" + group + "' in XREADGROUP with GROUP option")
+		}
+
+		oldCost := stream.Cost()
+
+		var entries []*structure.StreamEntry
+		if s := string(args[n+i]); s == ">" {
+			entries = g.ReadNew(stream, consumer, count, now, noAck)
+			if len(entries) == 0 {
+				db.ReviseNotify(key, oldCost, stream.Cost())
+				continue
+			}
+		} else {
+			id, err := structure.ParseStreamID(s, 0)
+			if err != nil {
+				return resp.MakeErrorData(err.Error())
+			}
+			entries = g.ReadPending(stream, consumer, id, count, now)
+		}
+
+		db.ReviseNotify(key, oldCost, stream.Cost())
+
+		res = append(res, resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData(args[i]),
+			streamEntriesToResp(entries),
+		}))
+	}
+
+	if len(res) == 0 {
+		return resp.MakeArrayData(nil)
+	}
+
+	return resp.MakeArrayData(res)
+}
+
+// xAck 命令格式： xack key group id [id ...]
+func xAck(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	e, ok := checkCommandAndLength(&cmd, "xack", 4)
+	if !ok {
+		return e
+	}
+
+	key := string(cmd[1])
+
+	ids := make([]structure.StreamID, len(cmd)-3)
+	for i, raw := range cmd[3:] {
+		id, err := structure.ParseStreamID(string(raw), 0)
+		if err != nil {
+			return resp.MakeErrorData(err.Error())
+		}
+		ids[i] = id
+	}
+
+	value, exist := db.GetKey(key)
+	if !exist {
+		return resp.MakeIntData(0)
+	}
+	if err := checkType(value, STREAM); err != nil {
+		return err
+	}
+
+	stream := value.(*structure.Stream)
+	g, exist := stream.Group(string(cmd[2]))
+	if !exist {
+		return resp.MakeIntData(0)
+	}
+
+	oldCost := stream.Cost()
+	acked := g.Ack(ids...)
+	db.ReviseNotify(key, oldCost, stream.Cost())
+
+	return resp.MakeIntData(int64(acked))
+}
+
+func registerStreamCommands() {
+	registerCommand("xadd", xAdd, WR)
+	registerCommand("xlen", xLen, RD)
+	registerCommand("xrange", xRange, RD)
+	registerCommand("xread", xRead, RD)
+	registerCommand("xgroup", xGroup, WR)
+	registerCommand("xreadgroup", xReadGroup, WR)
+	registerCommand("xack", xAck, WR)
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
+	"testing"
+)
+
+func TestCmdStream(t *testing.T) {
+	database := db.NewDataBase(1)
+	database.SetKey("s", structure.Slice("v"))
+
+	entry := func(id string, fields ...string) resp.RedisData {
+		fs := make([]resp.RedisData, len(fields))
+		for i, f := range fields {
+			fs[i] = resp.MakeBulkData([]byte(f))
+		}
+		return resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte(id)),
+			resp.MakeArrayData(fs),
+		})
+	}
+
+	tests := []struct {
+		input    [][]byte
+		expected resp.RedisData
+	}{
+		{[][]byte{[]byte("xadd"), []byte("x"), []byte("1-1"), []byte("f1"), []byte("v1")},
+			resp.MakeBulkData([]byte("1-1"))},
+
+		{[][]byte{[]byte("xadd"), []byte("x"), []byte("1-1"), []byte("f1"), []byte("v1")},
+			resp.MakeErrorData("ERR The ID specified in XADD is equal or smaller than the target stream top item")},
+
+		{[][]byte{[]byte("xadd"), []byte("x"), []byte("0-0"), []byte("f1"), []byte("v1")},
+			resp.MakeErrorData("ERR The ID specified in XADD must be greater than 0-0")},
+
+		{[][]byte{[]byte("xadd"), []byte("x"), []byte("1-*"), []byte("f2"), []byte("v2")},
+			resp.MakeBulkData([]byte("1-2"))},
+
+		{[][]byte{[]byte("xadd"), []byte("x"), []byte("3"), []byte("f3"), []byte("v3")},
+			resp.MakeBulkData([]byte("3-0"))},
+
+		{[][]byte{[]byte("xadd"), []byte("x"), []byte("2-0"), []byte("f3")},
+			resp.MakeErrorData("ERR wrong number of arguments for 'xadd' command")},
+
+		{[][]byte{[]byte("xadd"), []byte("s"), []byte("*"), []byte("f"), []byte("v")},
+			resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")},
+
+		{[][]byte{[]byte("xlen"), []byte("x")},
+			resp.MakeIntData(3)},
+
+		{[][]byte{[]byte("xlen"), []byte("none")},
+			resp.MakeIntData(0)},
+
+		{[][]byte{[]byte("xrange"), []byte("x"), []byte("1-2"), []byte("3-0")},
+			resp.MakeArrayData([]resp.RedisData{entry("1-2", "f2", "v2"), entry("3-0", "f3", "v3")})},
+
+		{[][]byte{[]byte("xrange"), []byte("x"), []byte("-"), []byte("1")},
+			resp.MakeArrayData([]resp.RedisData{entry("1-1", "f1", "v1"), entry("1-2", "f2", "v2")})},
+
+		{[][]byte{[]byte("xrange"), []byte("x"), []byte("-"), []byte("+"), []byte("count"), []byte("1")},
+			resp.MakeArrayData([]resp.RedisData{entry("1-1", "f1", "v1")})},
+
+		{[][]byte{[]byte("xrange"), []byte("x"), []byte("4"), []byte("+")},
+			resp.MakeArrayData([]resp.RedisData{})},
+
+		{[][]byte{[]byte("xrange"), []byte("none"), []byte("-"), []byte("+")},
+			resp.MakeEmptyArrayData()},
+
+		{[][]byte{[]byte("xread"), []byte("streams"), []byte("x"), []byte("1-2")},
+			resp.MakeArrayData([]resp.RedisData{resp.MakeArrayData([]resp.RedisData{
+				resp.MakeBulkData([]byte("x")),
+				resp.MakeArrayData([]resp.RedisData{entry("3-0", "f3", "v3")}),
+			})})},
+
+		{[][]byte{[]byte("xread"), []byte("count"), []byte("1"), []byte("streams"), []byte("x"), []byte("0")},
+			resp.MakeArrayData([]resp.RedisData{resp.MakeArrayData([]resp.RedisData{
+				resp.MakeBulkData([]byte("x")),
+				resp.MakeArrayData([]resp.RedisData{entry("1-1", "f1", "v1")}),
+			})})},
+
+		{[][]byte{[]byte("xread"), []byte("streams"), []byte("x"), []byte("$")},
+			resp.MakeArrayData(nil)},
+
+		{[][]byte{[]byte("xread"), []byte("streams"), []byte("x"), []byte("none"), []byte("0")},
+			resp.MakeErrorData("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")},
+	}
+
+	for _, test := range tests {
+		cmd, exist := global.FindCommand(string(test.input[0]))
+		assert.True(t, exist)
+		c := cmd.Function().(command)
+
+		ret := c(database, test.input)
+		assert.Equal(t, test.expected, ret, string(test.input[0]))
+	}
+}
+
+func TestCmdStreamAutoID(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	global.UpdateGlobalClock()
+
+	// 同一毫秒内或时钟回退时，自动生成的 id 仍然严格递增
+	last := ""
+	for i := 0; i < 100; i++ {
+		ret, ok := execArgs(database, "xadd", "x", "*", "f", "v").(*resp.BulkData)
+		assert.True(t, ok)
+		if i > 0 {
+			assert.NotEqual(t, last, string(ret.ByteData()))
+		}
+		last = string(ret.ByteData())
+	}
+	assert.Equal(t, resp.MakeIntData(100), execArgs(database, "xlen", "x"))
+
+	// 手动写入一个未来的 id 后，自动 id 需要在其基础上递增
+	execArgs(database, "xadd", "y", "99999999999999-5", "f", "v")
+	assert.Equal(t, resp.MakeBulkData([]byte("99999999999999-6")), execArgs(database, "xadd", "y", "*", "f", "v"))
+}
+
+func TestCmdStreamGroup(t *testing.T) {
+	database := db.NewDataBase(1)
+	ids := func(ret resp.RedisData) []string {
+		res := make([]string, 0)
+		arr, ok := ret.(*resp.ArrayData)
+		if !ok || arr.Data() == nil {
+			return res
+		}
+		for _, entry := range arr.Data()[0].(*resp.ArrayData).Data()[1].(*resp.ArrayData).Data() {
+			res = append(res, string(entry.(*resp.ArrayData).Data()[0].ByteData()))
+		}
+		return res
+	}
+
+	assert.Equal(t, resp.MakeErrorData("ERR The XGROUP subcommand requires the key to exist. "+
+		"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."),
+		execArgs(database, "xgroup", "create", "x", "g", "$"))
+	assert.Equal(t, resp.MakeStringData("OK"), execArgs(database, "xgroup", "create", "x", "g", "$", "mkstream"))
+	assert.Equal(t, resp.MakeErrorData("BUSYGROUP Consumer Group name already exists"), execArgs(database, "xgroup", "create", "x", "g", "0"))
+	assert.Equal(t, resp.MakeErrorData("NOGROUP No such key 'x' or consumer group 'none' in XREADGROUP with GROUP option"),
+		execArgs(database, "xreadgroup", "group", "none", "c1", "streams", "x", ">"))
+
+	for i := 1; i <= 4; i++ {
+		execArgs(database, "xadd", "x", strconv.Itoa(i), "f", "v")
+	}
+
+	// 两个消费者分摊组内的消息
+	assert.Equal(t, []string{"1-0", "2-0"}, ids(execArgs(database, "xreadgroup", "group", "g", "c1", "count", "2", "streams", "x", ">")))
+	assert.Equal(t, []string{"3-0", "4-0"}, ids(execArgs(database, "xreadgroup", "group", "g", "c2", "streams", "x", ">")))
+	assert.Equal(t, resp.MakeArrayData(nil), execArgs(database, "xreadgroup", "group", "g", "c1", "streams", "x", ">"))
+
+	// 显式 id 读取的是各自的待确认列表
+	assert.Equal(t, []string{"1-0", "2-0"}, ids(execArgs(database, "xreadgroup", "group", "g", "c1", "streams", "x", "0")))
+	assert.Equal(t, []string{"4-0"}, ids(execArgs(database, "xreadgroup", "group", "g", "c2", "streams", "x", "3-0")))
+
+	// xack 清除待确认列表
+	assert.Equal(t, resp.MakeIntData(2), execArgs(database, "xack", "x", "g", "1-0", "3-0"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "xack", "x", "g", "1-0"))
+	assert.Equal(t, []string{"2-0"}, ids(execArgs(database, "xreadgroup", "group", "g", "c1", "streams", "x", "0")))
+	assert.Equal(t, []string{"4-0"}, ids(execArgs(database, "xreadgroup", "group", "g", "c2", "streams", "x", "0")))
+	assert.Equal(t, resp.MakeIntData(2), execArgs(database, "xack", "x", "g", "2-0", "4-0"))
+	assert.Equal(t, []string{}, ids(execArgs(database, "xreadgroup", "group", "g", "c1", "streams", "x", "0")))
+
+	// noack 不会加入待确认列表
+	execArgs(database, "xadd", "x", "5", "f", "v")
+	assert.Equal(t, []string{"5-0"}, ids(execArgs(database, "xreadgroup", "group", "g", "c1", "noack", "streams", "x", ">")))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "xack", "x", "g", "5-0"))
+
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "xgroup", "destroy", "x", "g"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "xgroup", "destroy", "x", "g"))
+}
@@ -4,11 +4,15 @@ import (
 	"github.com/tangrc99/MemTable/db"
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"math"
 	"strconv"
+	"strings"
 )
 
 type Slice = structure.Slice
 
+// set 命令格式： set key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT timestamp|KEEPTTL]
 func set(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	e, ok := checkCommandAndLength(&cmd, "set", 3)
@@ -16,20 +20,91 @@ func set(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	value, ok := db.GetKey(string(cmd[1]))
+	nx, xx, get, keepTTL := false, false, false, false
+	// 过期时间以秒为单位保存，为 0 时代表不设置过期时间
+	var tp int64 = 0
+
+	for i := 3; i < len(cmd); i++ {
+		switch option := strings.ToLower(string(cmd[i])); option {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "get":
+			get = true
+		case "keepttl":
+			if tp != 0 {
+				return resp.SyntaxError()
+			}
+			keepTTL = true
+		case "ex", "px", "exat", "pxat":
+			if keepTTL || tp != 0 || i+1 >= len(cmd) {
+				return resp.SyntaxError()
+			}
+			i++
+			n, err := global.ParseInteger(cmd[i])
+			if err != nil {
+				return resp.NotIntegerError()
+			}
+			if n <= 0 {
+				return resp.MakeErrorData("ERR invalid expire time in 'set' command")
+			}
+			tp = absoluteExpireTime(option, n)
+		default:
+			return resp.SyntaxError()
+		}
+	}
+	if nx && xx {
+		return resp.SyntaxError()
+	}
+
+	value, exist := db.GetKey(string(cmd[1]))
 
 	// 进行类型检查，会自动检查过期选项
 	if err := checkType(value, STRING); err != nil {
 		return err
 	}
 
+	// GET 选项返回旧的值，键不存在时返回 nil
+	reply := resp.RedisData(resp.MakeStringData("OK"))
+	if get {
+		reply = resp.MakeStringData("nil")
+		if exist {
+			reply = resp.MakeBulkData(value.(Slice))
+		}
+	}
+
+	if (nx && exist) || (xx && !exist) {
+		if get {
+			return reply
+		}
+		return resp.MakeStringData("nil")
+	}
+
 	// 键值对设置
-	db.SetKey(string(cmd[1]), Slice(cmd[2]))
+	db.SetKey(string(cmd[1]), structure.ShareInteger(cmd[2]))
 
 	// 重置 TTL
-	db.RemoveTTL(string(cmd[1]))
+	if tp > 0 {
+		db.SetTTL(string(cmd[1]), tp)
+	} else if !keepTTL {
+		db.RemoveTTL(string(cmd[1]))
+	}
 
-	return resp.MakeStringData("OK")
+	return reply
+}
+
+// absoluteExpireTime 将 EX、PX、EXAT、PXAT 选项转换为秒级的过期时间戳，毫秒向上取整，避免键被立即删除
+func absoluteExpireTime(option string, n int64) int64 {
+	switch option {
+	case "ex":
+		return global.Now().Unix() + n
+	case "px":
+		return global.Now().Unix() + (n+999)/1000
+	case "pxat":
+		return (n + 999) / 1000
+	}
+	return n
 }
 
 func get(db *db.DataBase, cmd [][]byte) resp.RedisData {
@@ -39,14 +114,12 @@ func get(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
-		return resp.MakeStringData("nil")
+	byteVal, exist, err := db.GetString(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
 	}
-
-	byteVal, ok := value.(Slice)
-	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+	if !exist {
+		return resp.MakeStringData("nil")
 	}
 
 	return resp.MakeBulkData(byteVal)
@@ -70,11 +143,78 @@ func getset(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	// 重置 TTL
-	db.SetKey(string(cmd[1]), Slice(cmd[2]))
+	db.SetKey(string(cmd[1]), structure.ShareInteger(cmd[2]))
 	db.RemoveTTL(string(cmd[1]))
 	return resp.MakeStringData("OK")
 }
 
+// getex 返回键的值，并且根据选项修改键的过期时间，没有选项时不会修改过期时间
+func getex(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := checkCommandAndLength(&cmd, "getex", 2)
+	if !ok {
+		return e
+	}
+
+	// 过期时间以秒为单位保存，tp 为 -1 代表移除过期时间
+	var tp int64 = 0
+
+	if len(cmd) > 2 {
+		option := strings.ToLower(string(cmd[2]))
+
+		if option == "persist" {
+			if len(cmd) != 3 {
+				return resp.SyntaxError()
+			}
+			tp = -1
+
+		} else {
+			if len(cmd) != 4 {
+				return resp.SyntaxError()
+			}
+
+			n, err := strconv.ParseInt(string(cmd[3]), 10, 64)
+			if err != nil {
+				return resp.NotIntegerError()
+			}
+			if n <= 0 {
+				return resp.MakeErrorData("ERR invalid expire time in 'getex' command")
+			}
+
+			switch option {
+			case "ex":
+				tp = global.Now().Unix() + n
+			case "px":
+				tp = global.Now().Unix() + n/1000
+			case "exat":
+				tp = n
+			case "pxat":
+				tp = n / 1000
+			default:
+				return resp.SyntaxError()
+			}
+		}
+	}
+
+	value, ok := db.GetKey(string(cmd[1]))
+	if !ok {
+		return resp.MakeStringData("nil")
+	}
+
+	byteVal, ok := value.(Slice)
+	if !ok {
+		return resp.WrongTypeError()
+	}
+
+	if tp == -1 {
+		db.RemoveTTL(string(cmd[1]))
+	} else if tp > 0 {
+		db.SetTTL(string(cmd[1]), tp)
+	}
+
+	return resp.MakeBulkData(byteVal)
+}
+
 func strlen(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	e, ok := checkCommandAndLength(&cmd, "strlen", 2)
@@ -95,7 +235,7 @@ func strlen(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	strVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	return resp.MakeIntData(int64(len(strVal)))
@@ -115,16 +255,16 @@ func getRange(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	byteVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	start, err := strconv.Atoi(string(cmd[2]))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 	end, err := strconv.Atoi(string(cmd[3]))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	l := len(byteVal)
@@ -154,12 +294,18 @@ func setRange(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	byteVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	start, err := strconv.Atoi(string(cmd[2]))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
+	}
+	if start < 0 {
+		return resp.MakeErrorData("ERR offset is out of range")
+	}
+	if err := checkStringLength(int64(start), int64(len(cmd[3]))); err != nil {
+		return err
 	}
 
 	ol := len(byteVal)
@@ -221,11 +367,11 @@ func mset(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	if len(cmd)%2 == 0 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'mset' command")
+		return resp.WrongArgsError("mset")
 	}
 
 	for i := 1; i < len(cmd); i += 2 {
-		db.SetKey(string(cmd[i]), Slice(cmd[i+1]))
+		db.SetKey(string(cmd[i]), structure.ShareInteger(cmd[i+1]))
 		// 重置 TTL
 		db.RemoveTTL(string(cmd[i]))
 	}
@@ -246,16 +392,16 @@ func incr(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	byteVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	intVal, err := strconv.Atoi(string(byteVal))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	intVal++
-	db.SetKey(string(cmd[1]), Slice(strconv.Itoa(intVal)))
+	db.SetKey(string(cmd[1]), structure.IntegerSlice(int64(intVal)))
 
 	return resp.MakeIntData(int64(intVal))
 }
@@ -273,25 +419,78 @@ func incrby(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	byteVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	intVal, err := strconv.Atoi(string(byteVal))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	increment, err := strconv.Atoi(string(cmd[2]))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	intVal += increment
-	db.SetKey(string(cmd[1]), Slice(strconv.Itoa(intVal)))
+	db.SetKey(string(cmd[1]), structure.IntegerSlice(int64(intVal)))
 
 	return resp.MakeIntData(int64(intVal))
 }
 
+// incrbyfloat 将键的值增加一个浮点数，不存在的键会被视为 0
+func incrbyfloat(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := checkCommandAndLength(&cmd, "incrbyfloat", 3)
+	if !ok {
+		return e
+	}
+
+	floatVal := 0.0
+
+	value, ok := db.GetKey(string(cmd[1]))
+	if ok {
+		byteVal, ok := value.(Slice)
+		if !ok {
+			return resp.WrongTypeError()
+		}
+
+		var valid bool
+		if floatVal, valid = parseFloat(byteVal); !valid {
+			return resp.MakeErrorData("ERR value is not a valid float")
+		}
+	}
+
+	increment, valid := parseFloat(cmd[2])
+	if !valid {
+		return resp.MakeErrorData("ERR value is not a valid float")
+	}
+
+	floatVal += increment
+	if math.IsNaN(floatVal) || math.IsInf(floatVal, 0) {
+		return resp.MakeErrorData("ERR increment would produce NaN or Infinity")
+	}
+
+	str := formatFloat(floatVal)
+	db.SetKey(string(cmd[1]), Slice(str))
+
+	return resp.MakeBulkData([]byte(str))
+}
+
+// parseFloat 解析浮点数，不接受 NaN 以及 Infinity
+func parseFloat(data []byte) (float64, bool) {
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// formatFloat 使用最短的十进制表示格式化浮点数，不会使用科学计数法并且会去除末尾的 0
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
 func decr(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	e, ok := checkCommandAndLength(&cmd, "decr", 2)
@@ -305,16 +504,16 @@ func decr(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	byteVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	intVal, err := strconv.Atoi(string(byteVal))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	intVal--
-	db.SetKey(string(cmd[1]), Slice(strconv.Itoa(intVal)))
+	db.SetKey(string(cmd[1]), structure.IntegerSlice(int64(intVal)))
 
 	return resp.MakeIntData(int64(intVal))
 
@@ -333,21 +532,21 @@ func decrby(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	byteVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
 	}
 
 	intVal, err := strconv.Atoi(string(byteVal))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	decrement, err := strconv.Atoi(string(cmd[2]))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	intVal -= decrement
-	db.SetKey(string(cmd[1]), Slice(strconv.Itoa(intVal)))
+	db.SetKey(string(cmd[1]), structure.IntegerSlice(int64(intVal)))
 
 	return resp.MakeIntData(int64(intVal))
 
@@ -368,7 +567,11 @@ func appendStr(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	byteVal, ok := value.(Slice)
 	if !ok {
-		return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return resp.WrongTypeError()
+	}
+
+	if err := checkStringLength(int64(len(byteVal)), int64(len(cmd[2]))); err != nil {
+		return err
 	}
 
 	byteVal = append(byteVal, cmd[2]...)
@@ -378,11 +581,153 @@ func appendStr(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	return resp.MakeIntData(int64(len(byteVal)))
 }
 
+// lcsMaxTable 是 lcs 命令动态规划表的最大元素数量，防止两个超长字符串占用过多的内存
+const lcsMaxTable = 1 << 28
+
+// lcs 命令格式： lcs key1 key2 [len] [idx] [minmatchlen min-match-len] [withmatchlen]
+func lcs(db *db.DataBase, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := checkCommandAndLength(&cmd, "lcs", 3)
+	if !ok {
+		return e
+	}
+
+	getLen, getIdx, withMatchLen := false, false, false
+	minMatchLen := 0
+
+	for i := 3; i < len(cmd); i++ {
+		option := strings.ToLower(string(cmd[i]))
+		if option == "len" {
+			getLen = true
+		} else if option == "idx" {
+			getIdx = true
+		} else if option == "withmatchlen" {
+			withMatchLen = true
+		} else if option == "minmatchlen" && i+1 < len(cmd) {
+			n, err := strconv.Atoi(string(cmd[i+1]))
+			if err != nil {
+				return resp.NotIntegerError()
+			}
+			if n > 0 {
+				minMatchLen = n
+			}
+			i++
+		} else {
+			return resp.SyntaxError()
+		}
+	}
+
+	if getLen && getIdx {
+		return resp.MakeErrorData("ERR If you want both the length and indexes, please just use IDX.")
+	}
+
+	// 不存在的键视为空字符串
+	values := [2]Slice{}
+	for i := range values {
+		value, ok := db.GetKey(string(cmd[1+i]))
+		if !ok {
+			continue
+		}
+		if values[i], ok = value.(Slice); !ok {
+			return resp.WrongTypeError()
+		}
+	}
+	a, b := values[0], values[1]
+	alen, blen := len(a), len(b)
+
+	if (alen+1)*(blen+1) > lcsMaxTable {
+		return resp.MakeErrorData("ERR Insufficient memory, transient memory for LCS exceeds the limit")
+	}
+
+	// table[i][j] 是 a[:i] 与 b[:j] 的最长公共子序列长度
+	table := make([]uint32, (alen+1)*(blen+1))
+	at := func(i, j int) uint32 { return table[j*(alen+1)+i] }
+	for i := 1; i <= alen; i++ {
+		for j := 1; j <= blen; j++ {
+			if a[i-1] == b[j-1] {
+				table[j*(alen+1)+i] = at(i-1, j-1) + 1
+			} else if l1, l2 := at(i-1, j), at(i, j-1); l1 > l2 {
+				table[j*(alen+1)+i] = l1
+			} else {
+				table[j*(alen+1)+i] = l2
+			}
+		}
+	}
+
+	idx := int(at(alen, blen))
+	if getLen {
+		return resp.MakeIntData(int64(idx))
+	}
+
+	// 从表的末尾回溯得到公共子序列，同时记录两个字符串中连续匹配的区间
+	result := make([]byte, idx)
+	matches := make([]resp.RedisData, 0)
+	aStart, aEnd, bStart, bEnd := alen, 0, 0, 0
+
+	for i, j := alen, blen; i > 0 && j > 0; {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if aStart == alen {
+				// 开始一个新的区间
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			} else if aStart == i && bStart == j {
+				// 区间是连续的，向前扩展
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			// 匹配到了某个字符串的第一个字符，之后不会再有匹配
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if at(i-1, j) > at(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			if aStart != alen {
+				emit = true
+			}
+		}
+
+		if !emit {
+			continue
+		}
+		matchLen := aEnd - aStart + 1
+		if getIdx && matchLen >= minMatchLen {
+			match := []resp.RedisData{
+				resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(int64(aStart)), resp.MakeIntData(int64(aEnd))}),
+				resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(int64(bStart)), resp.MakeIntData(int64(bEnd))}),
+			}
+			if withMatchLen {
+				match = append(match, resp.MakeIntData(int64(matchLen)))
+			}
+			matches = append(matches, resp.MakeArrayData(match))
+		}
+		aStart = alen
+	}
+
+	if getIdx {
+		return resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte("matches")), resp.MakeArrayData(matches),
+			resp.MakeBulkData([]byte("len")), resp.MakeIntData(int64(len(result))),
+		})
+	}
+	return resp.MakeBulkData(result)
+}
+
 func registerStringCommands() {
 
 	registerCommand("set", set, WR)
 	registerCommand("get", get, RD)
 	registerCommand("getset", getset, WR)
+	registerCommand("getex", getex, WR)
 	registerCommand("strlen", strlen, RD)
 	registerCommand("getrange", getRange, RD)
 	registerCommand("setrange", setRange, WR)
@@ -390,8 +735,10 @@ func registerStringCommands() {
 	registerCommand("mset", mset, WR)
 	registerCommand("incr", incr, WR)
 	registerCommand("incrby", incrby, WR)
+	registerCommand("incrbyfloat", incrbyfloat, WR)
 	registerCommand("decr", decr, WR)
 	registerCommand("decrby", decrby, WR)
 	registerCommand("append", appendStr, WR)
+	registerCommand("lcs", lcs, RD)
 
 }
@@ -3,8 +3,10 @@ package cmd
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
 	"testing"
 )
 
@@ -96,3 +98,221 @@ func TestCmdString(t *testing.T) {
 		assert.Equal(t, test.expected, ret)
 	}
 }
+
+func TestCmdGetex(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	global.UpdateGlobalClock()
+
+	database.SetKey("k", Slice("v"))
+	now := global.Now().Unix()
+
+	// 没有选项时不会修改过期时间
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execArgs(database, "getex", "k"))
+	assert.Equal(t, int64(-1), database.GetTTL("k"))
+
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execArgs(database, "getex", "k", "EX", "100"))
+	assert.Equal(t, int64(100), database.GetTTL("k"))
+
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execArgs(database, "getex", "k", "px", "50000"))
+	assert.Equal(t, int64(50), database.GetTTL("k"))
+
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execArgs(database, "getex", "k", "exat", strconv.FormatInt(now+200, 10)))
+	assert.Equal(t, int64(200), database.GetTTL("k"))
+
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execArgs(database, "getex", "k", "pxat", strconv.FormatInt((now+300)*1000, 10)))
+	assert.Equal(t, int64(300), database.GetTTL("k"))
+
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execArgs(database, "getex", "k", "persist"))
+	assert.Equal(t, int64(-1), database.GetTTL("k"))
+
+	// 不存在的键不会设置过期时间
+	assert.Equal(t, resp.MakeStringData("nil"), execArgs(database, "getex", "none", "ex", "100"))
+	assert.Equal(t, int64(-2), database.GetTTL("none"))
+
+	database.SetKey("list", structure.NewList())
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"), execArgs(database, "getex", "list", "ex", "100"))
+	assert.Equal(t, int64(-1), database.GetTTL("list"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "getex", "k", "ex"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "getex", "k", "persist", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "getex", "k", "none", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execArgs(database, "getex", "k", "ex", "a"))
+	assert.Equal(t, resp.MakeErrorData("ERR invalid expire time in 'getex' command"), execArgs(database, "getex", "k", "ex", "0"))
+}
+
+func TestCmdSetOptions(t *testing.T) {
+	database := db.NewDataBase(1)
+	global.UpdateGlobalClock()
+
+	ok := resp.MakeStringData("OK")
+	null := resp.MakeStringData("nil")
+
+	// NX 只在键不存在时写入，XX 只在键存在时写入
+	assert.Equal(t, null, execArgs(database, "set", "k", "v", "xx"))
+	assert.Equal(t, ok, execArgs(database, "set", "k", "v", "NX"))
+	assert.Equal(t, null, execArgs(database, "set", "k", "v2", "nx"))
+	assert.Equal(t, ok, execArgs(database, "set", "k", "v2", "xx"))
+
+	// GET 返回旧的值
+	assert.Equal(t, resp.MakeBulkData([]byte("v2")), execArgs(database, "set", "k", "v3", "get"))
+	assert.Equal(t, null, execArgs(database, "set", "none", "v", "get", "xx"))
+	assert.Equal(t, resp.MakeBulkData([]byte("v3")), execArgs(database, "set", "k", "v4", "nx", "get"))
+	assert.Equal(t, resp.MakeBulkData([]byte("v3")), execArgs(database, "get", "k"))
+
+	// 过期时间选项，KEEPTTL 保留原来的过期时间，没有选项时移除过期时间
+	assert.Equal(t, ok, execArgs(database, "set", "k", "v", "ex", "100"))
+	assert.Equal(t, int64(100), database.GetTTL("k"))
+	assert.Equal(t, ok, execArgs(database, "set", "k", "v", "keepttl"))
+	assert.Equal(t, int64(100), database.GetTTL("k"))
+	assert.Equal(t, ok, execArgs(database, "set", "k", "v", "px", "1500"))
+	assert.Equal(t, int64(2), database.GetTTL("k"))
+	assert.Equal(t, ok, execArgs(database, "set", "k", "v", "exat", strconv.FormatInt(global.Now().Unix()+50, 10)))
+	assert.Equal(t, int64(50), database.GetTTL("k"))
+	assert.Equal(t, ok, execArgs(database, "set", "k", "v"))
+	assert.Equal(t, int64(-1), database.GetTTL("k"))
+
+	// 冲突的选项返回语法错误，并且不会修改键
+	for _, args := range [][]string{
+		{"set", "k", "x", "nx", "xx"},
+		{"set", "k", "x", "ex", "10", "px", "100"},
+		{"set", "k", "x", "ex", "10", "keepttl"},
+		{"set", "k", "x", "ex"},
+		{"set", "k", "x", "foo"},
+	} {
+		assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, args...), args)
+	}
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execArgs(database, "set", "k", "x", "ex", "a"))
+	assert.Equal(t, resp.MakeErrorData("ERR invalid expire time in 'set' command"), execArgs(database, "set", "k", "x", "px", "0"))
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execArgs(database, "get", "k"))
+}
+
+func TestCmdStringIntEncoding(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	encoding := func(key string) resp.RedisData {
+		return execArgs(database, "object", "encoding", key)
+	}
+
+	execArgs(database, "set", "int", "123")
+	execArgs(database, "set", "str", "abc")
+	execArgs(database, "set", "padded", "0123")
+	assert.Equal(t, resp.MakeBulkData([]byte("int")), encoding("int"))
+	assert.Equal(t, resp.MakeBulkData([]byte("embstr")), encoding("str"))
+	assert.Equal(t, resp.MakeBulkData([]byte("embstr")), encoding("padded"))
+
+	// 追加内容之后不再是整数
+	assert.Equal(t, resp.MakeIntData(6), execArgs(database, "append", "int", "abc"))
+	assert.Equal(t, resp.MakeBulkData([]byte("embstr")), encoding("int"))
+	assert.Equal(t, resp.MakeBulkData([]byte("123abc")), execArgs(database, "get", "int"))
+
+	// 较小的整数是共享的，修改一个键不会影响其他的键
+	execArgs(database, "set", "a", "10")
+	execArgs(database, "set", "b", "10")
+	va, _ := database.GetKey("a")
+	assert.True(t, structure.IsShared(va.(Slice)))
+	execArgs(database, "setbit", "a", "6", "1")
+	assert.Equal(t, resp.MakeBulkData([]byte("30")), execArgs(database, "get", "a"))
+	assert.Equal(t, resp.MakeBulkData([]byte("10")), execArgs(database, "get", "b"))
+	assert.Equal(t, Slice("10"), structure.IntegerSlice(10))
+
+	assert.Equal(t, resp.MakeIntData(31), execArgs(database, "incr", "a"))
+	assert.Equal(t, resp.MakeBulkData([]byte("int")), encoding("a"))
+	execArgs(database, "append", "b", "0")
+	assert.Equal(t, resp.MakeBulkData([]byte("100")), execArgs(database, "get", "b"))
+	assert.Equal(t, Slice("10"), structure.IntegerSlice(10))
+}
+
+func TestCmdStringMaxBulkLen(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	old := resp.ProtoMaxBulkLen
+	resp.ProtoMaxBulkLen = 16
+	defer func() { resp.ProtoMaxBulkLen = old }()
+
+	tooLarge := resp.MakeErrorData("ERR string exceeds maximum allowed size")
+
+	execArgs(database, "set", "k", "abc")
+
+	// 长度恰好达到上限时允许写入
+	assert.Equal(t, resp.MakeIntData(16), execArgs(database, "setrange", "k", "15", "x"))
+	assert.Equal(t, tooLarge, execArgs(database, "setrange", "k", "16", "x"))
+	assert.Equal(t, tooLarge, execArgs(database, "setrange", "k", "10", "1234567"))
+	assert.Equal(t, resp.MakeErrorData("ERR offset is out of range"), execArgs(database, "setrange", "k", "-1", "x"))
+	assert.Equal(t, tooLarge, execArgs(database, "setrange", "k", "100", ""))
+	assert.Equal(t, tooLarge, execArgs(database, "setrange", "k", "9223372036854775807", "x"))
+
+	assert.Equal(t, tooLarge, execArgs(database, "append", "k", "x"))
+	assert.Equal(t, resp.MakeIntData(16), execArgs(database, "strlen", "k"))
+
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "setbit", "bits", "127", "1"))
+	assert.Equal(t, tooLarge, execArgs(database, "setbit", "bits", "128", "1"))
+}
+
+func TestCmdIncrbyfloat(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	// 不存在的键会被视为 0
+	assert.Equal(t, resp.MakeBulkData([]byte("3")), execArgs(database, "incrbyfloat", "k", "3.0"))
+	assert.Equal(t, resp.MakeBulkData([]byte("3.1")), execArgs(database, "incrbyfloat", "k", "0.10"))
+	v, _ := database.GetKey("k")
+	assert.Equal(t, Slice("3.1"), v)
+
+	// redis 文档中的示例
+	database.SetKey("mykey", Slice("10.50"))
+	assert.Equal(t, resp.MakeBulkData([]byte("10.6")), execArgs(database, "incrbyfloat", "mykey", "0.1"))
+	assert.Equal(t, resp.MakeBulkData([]byte("5.6")), execArgs(database, "incrbyfloat", "mykey", "-5"))
+	database.SetKey("mykey", Slice("5.0e3"))
+	assert.Equal(t, resp.MakeBulkData([]byte("5200")), execArgs(database, "incrbyfloat", "mykey", "2.0e2"))
+
+	database.SetKey("str", Slice("abc"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not a valid float"), execArgs(database, "incrbyfloat", "str", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not a valid float"), execArgs(database, "incrbyfloat", "k", "abc"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not a valid float"), execArgs(database, "incrbyfloat", "k", "inf"))
+	database.SetKey("big", Slice("1.7e308"))
+	assert.Equal(t, resp.MakeErrorData("ERR increment would produce NaN or Infinity"), execArgs(database, "incrbyfloat", "big", "1.7e308"))
+
+	database.SetKey("list", structure.NewList())
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"), execArgs(database, "incrbyfloat", "list", "1"))
+}
+
+func TestCmdLcs(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	r := func(start, end int64) resp.RedisData {
+		return resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(start), resp.MakeIntData(end)})
+	}
+
+	// redis 文档中的示例
+	database.SetKey("key1", Slice("ohmytext"))
+	database.SetKey("key2", Slice("mynewtext"))
+	assert.Equal(t, resp.MakeBulkData([]byte("mytext")), execArgs(database, "lcs", "key1", "key2"))
+	assert.Equal(t, resp.MakeIntData(6), execArgs(database, "lcs", "key1", "key2", "LEN"))
+
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{
+		resp.MakeBulkData([]byte("matches")),
+		resp.MakeArrayData([]resp.RedisData{
+			resp.MakeArrayData([]resp.RedisData{r(4, 7), r(5, 8)}),
+			resp.MakeArrayData([]resp.RedisData{r(2, 3), r(0, 1)}),
+		}),
+		resp.MakeBulkData([]byte("len")), resp.MakeIntData(6),
+	}), execArgs(database, "lcs", "key1", "key2", "IDX"))
+
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{
+		resp.MakeBulkData([]byte("matches")),
+		resp.MakeArrayData([]resp.RedisData{
+			resp.MakeArrayData([]resp.RedisData{r(4, 7), r(5, 8), resp.MakeIntData(4)}),
+		}),
+		resp.MakeBulkData([]byte("len")), resp.MakeIntData(6),
+	}), execArgs(database, "lcs", "key1", "key2", "idx", "minmatchlen", "4", "withmatchlen"))
+
+	// 不存在的键视为空字符串
+	assert.Equal(t, resp.MakeBulkData([]byte("")), execArgs(database, "lcs", "key1", "none"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "lcs", "none", "none", "len"))
+
+	database.SetKey("list", structure.NewList())
+	assert.Equal(t, resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"), execArgs(database, "lcs", "key1", "list"))
+	assert.Equal(t, resp.MakeErrorData("ERR If you want both the length and indexes, please just use IDX."), execArgs(database, "lcs", "key1", "key2", "len", "idx"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execArgs(database, "lcs", "key1", "key2", "minmatchlen"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execArgs(database, "lcs", "key1", "key2", "minmatchlen", "x"))
+}
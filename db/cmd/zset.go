@@ -17,40 +17,9 @@ func zADD(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	// get 会自动检查是否过期
-	value, ok := db.GetKey(string(cmd[1]))
-
 	l := len(cmd)
 	if l%2 == 1 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'zadd' command")
-	}
-
-	if !ok {
-		zset := structure.NewZSet()
-
-		added := 0
-
-		for i := 2; i < l; i += 2 {
-
-			score, err := strconv.ParseFloat(string(cmd[i]), 32)
-			if err != nil {
-				return resp.MakeErrorData("ERR value is not a valid float")
-			}
-
-			if zset.AddIfNotExist(structure.Float32(score), string(cmd[i+1])) {
-				added++
-			}
-		}
-
-		db.SetKey(string(cmd[1]), zset)
-		db.ReviseNotify(string(cmd[1]), 0, zset.Cost())
-
-		return resp.MakeIntData(int64(added))
-	}
-
-	// 进行类型检查，会自动检查过期选项
-	if err := checkType(value, ZSET); err != nil {
-		return err
+		return resp.WrongArgsError("zadd")
 	}
 
 	scores := make([]structure.Float32, l/2-1)
@@ -66,7 +35,11 @@ func zADD(db *db.DataBase, cmd [][]byte) resp.RedisData {
 		members[i/2-1] = cmd[i+1]
 	}
 
-	zsetVal := value.(*structure.ZSet)
+	// get 会自动检查是否过期
+	zsetVal, err := db.GetOrCreateZSet(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
+	}
 
 	oldCost := zsetVal.Cost()
 
@@ -127,18 +100,14 @@ func zCard(db *db.DataBase, cmd [][]byte) resp.RedisData {
 	}
 
 	// get 会自动检查是否过期
-	value, ok := db.GetKey(string(cmd[1]))
-	if !ok {
-		return resp.MakeIntData(0)
+	zsetVal, err := db.GetZSet(string(cmd[1]))
+	if err != nil {
+		return resp.WrongTypeError()
 	}
-
-	// 进行类型检查，会自动检查过期选项
-	if err := checkType(value, ZSET); err != nil {
-		return err
+	if zsetVal == nil {
+		return resp.MakeIntData(0)
 	}
 
-	zsetVal := value.(*structure.ZSet)
-
 	count := zsetVal.Size()
 
 	return resp.MakeIntData(int64(count))
@@ -249,12 +218,12 @@ func zRange(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	start, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	end, w := strconv.Atoi(string(cmd[3]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	keys, n := zsetVal.Pos(start, end)
@@ -287,12 +256,12 @@ func zRevRange(db *db.DataBase, cmd [][]byte) resp.RedisData { // 进行输入
 
 	start, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	end, w := strconv.Atoi(string(cmd[3]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	keys, n := zsetVal.Pos(start, end)
@@ -415,12 +384,12 @@ func zRemRangeByRank(db *db.DataBase, cmd [][]byte) resp.RedisData {
 
 	start, w := strconv.Atoi(string(cmd[2]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	end, w := strconv.Atoi(string(cmd[3]))
 	if w != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	oldCost := zsetVal.Cost()
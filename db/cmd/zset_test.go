@@ -132,3 +132,19 @@ func TestCmdZSet(t *testing.T) {
 		}
 	}
 }
+
+func TestCmdZAddInvalid(t *testing.T) {
+	database := db.NewDataBase(1)
+
+	// 参数错误时不会创建空的键
+	assert.Equal(t, resp.MakeErrorData("ERR value is not a valid float"), execArgs(database, "zadd", "z", "1", "a", "x", "b"))
+	assert.Equal(t, resp.WrongArgsError("hset"), execArgs(database, "hset", "h", "a", "1", "b"))
+	assert.Equal(t, 0, database.Size())
+
+	database.SetKey("s", Slice("v"))
+	assert.Equal(t, resp.WrongTypeError(), execArgs(database, "zadd", "s", "1", "a"))
+	assert.Equal(t, resp.WrongTypeError(), execArgs(database, "zcard", "s"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "zadd", "z", "1", "a"))
+	assert.Equal(t, resp.MakeIntData(1), execArgs(database, "zcard", "z"))
+	assert.Equal(t, resp.MakeIntData(0), execArgs(database, "zcard", "none"))
+}
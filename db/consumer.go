@@ -69,9 +69,13 @@ func (c *blockMap) unregister(key string, id uuid.UUID) {
 	for n := l.FrontNode(); n != nil; n = n.Next() {
 		if n.Value.(*consumer).id == id {
 			l.RemoveNode(n)
-			return
+			break
 		}
 	}
+	if l.Empty() {
+		delete(c.consumers, key)
+		c.keyCost -= int64(len(key))
+	}
 }
 
 func (c *blockMap) tryConsume(key string, message []byte) bool {
@@ -87,7 +91,7 @@ func (c *blockMap) tryConsume(key string, message []byte) bool {
 			return false
 		}
 		n := v.(*consumer)
-		if n.deadline < 0 || n.deadline > global.Now.Unix() {
+		if n.deadline < 0 || n.deadline > global.Now().Unix() {
 			n.notifier <- message
 			break
 		}
@@ -62,7 +62,7 @@ func TestConsumerMapDeadLine(t *testing.T) {
 
 	assert.False(t, c.tryConsume("123", []byte("1")))
 
-	c.register("123", id, notifier1, global.Now.Unix()+1)
+	c.register("123", id, notifier1, global.Now().Unix()+1)
 	assert.True(t, c.tryConsume("123", []byte("2")))
 
 }
@@ -78,7 +78,7 @@ func TestConsumerMapDeadLine2(t *testing.T) {
 	c.register("123", uuid.Must(uuid.NewV1()), notifier1, 1)
 	c.register("123", uuid.Must(uuid.NewV1()), notifier2, 1)
 	c.register("123", uuid.Must(uuid.NewV1()), notifier3, -1)
-	c.register("123", uuid.Must(uuid.NewV1()), notifier4, global.Now.Unix()+1)
+	c.register("123", uuid.Must(uuid.NewV1()), notifier4, global.Now().Unix()+1)
 
 	assert.True(t, c.tryConsume("123", []byte("1")))
 	assert.True(t, c.tryConsume("123", []byte("2")))
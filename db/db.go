@@ -7,6 +7,7 @@ import (
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/server/global"
 	"math"
+	"sync"
 	"unsafe"
 )
 
@@ -17,29 +18,54 @@ const databaseBasicCost = int64(unsafe.Sizeof(DataBase{}))
 
 // DataBase 代表一个内存数据库，包含键值对，ttl，watch等信息。同一个 DataBase 实例中键值不能重复，
 // 不同的实例键值可以重复。
+//
+// 并发模型：DataBase 使用一个读写锁保护键空间以及所有的值对象，除特别说明外 DataBase 的方法本身不会加锁。
+//   - 事件循环中会修改数据的命令通过 Update 执行，Update 持有写锁；CleanExpiredKeys 与 Evict 会自行获取写锁；
+//   - 事件循环中的只读命令通过 Lookup 执行，由于 GetKey 会删除过期键并更新访问信息，Lookup 同样持有写锁，
+//     并在执行期间统计键的命中情况；
+//   - 后台协程（例如 BGSAVE、主从复制）需要通过 View 执行，View 只持有读锁，并且只能使用不会修改数据的方法，
+//     例如 Peek、Size、TTLSize、Encode；GetKey、Keys 等方法会更新访问信息或删除过期键，不能在读锁下使用；
+//   - 需要长时间遍历数据的后台协程应该使用 Snapshot，快照不需要持有锁，也不会阻塞写操作。
 type DataBase struct {
+	mu sync.RWMutex // 保护键空间以及值对象
+
+	snapshots  int                 // 尚未释放的快照数量
+	owned      map[string]struct{} // 快照存在期间已经复制过值对象的键
+	dictShared []bool              // 与快照共享的 dict 分片
+	ttlShared  []bool              // 与快照共享的 ttlKeys 分片
+
 	dict    *structure.Dict // 存储键值对
 	ttlKeys *structure.Dict // 存储过期键
 	watches *watcher        // 存储监视键
-	blocked *blockMap       // 阻塞命令
+
+	fieldTTLKeys  map[string]struct{} // 设置了 field 过期时间的 hash 键
+	expiredFields []ExpiredFields     // 等待服务层传播的过期 field
+	blocked       *blockMap           // 阻塞命令
 
 	rookies     *eviction.RookieList // 预备表，优先从预备表中淘汰
 	evict       eviction.Eviction
-	enableEvict bool // 是否开启
+	enableEvict bool        // 是否开启
+	policy      EvictPolicy // 内存不足时的淘汰策略
 
 	notifies           chan<- string // 通知服务层发送驱逐命令
 	enableNotification bool          // 是否开启了服务层通知
+
+	countLookups bool  // 是否统计 GetKey 的命中情况，只在执行只读命令时开启
+	hits         int64 // 只读命令查询到键的次数
+	misses       int64 // 只读命令没有查询到键的次数
 }
 
 // NewDataBase 创建一个新 DataBase 实例，并返回指针
 func NewDataBase(slot int, ops ...Option) *DataBase {
 	db := &DataBase{
-		dict:        structure.NewDict(slot),
-		ttlKeys:     structure.NewDict(1),
-		watches:     newWatcher(),
-		evict:       eviction.NewNoEviction(),
-		blocked:     newBlockMap(),
-		enableEvict: false,
+		dict:         structure.NewDict(slot),
+		ttlKeys:      structure.NewDict(1),
+		watches:      newWatcher(),
+		fieldTTLKeys: make(map[string]struct{}),
+		evict:        eviction.NewNoEviction(),
+		blocked:      newBlockMap(),
+		enableEvict:  false,
+		policy:       NoEviction,
 	}
 	for _, op := range ops {
 		op(db)
@@ -47,6 +73,38 @@ func NewDataBase(slot int, ops ...Option) *DataBase {
 	return db
 }
 
+// Update 持有写锁并执行 f，事件循环中修改 DataBase 的命令需要通过 Update 执行
+func (db_ *DataBase) Update(f func()) {
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
+	f()
+}
+
+// Lookup 持有写锁并执行只读命令 f，f 中通过 GetKey 查询键的结果会计入命中统计
+func (db_ *DataBase) Lookup(f func()) {
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
+	db_.countLookups = true
+	defer func() { db_.countLookups = false }()
+	f()
+}
+
+// View 持有读锁并执行 f，用于后台协程读取一致的数据，f 中不能修改 DataBase
+func (db_ *DataBase) View(f func()) {
+	db_.mu.RLock()
+	defer db_.mu.RUnlock()
+	f()
+}
+
+// Peek 返回键对应的值，不检查键是否过期也不记录访问信息，可以在读锁下使用
+func (db_ *DataBase) Peek(key string) (Object, bool) {
+	item, exist := db_.dict.Get(key)
+	if !exist {
+		return nil, false
+	}
+	return item.(*eviction.Item).Value, true
+}
+
 // checkNotExpired 检查键是否过期，如果过期则会自动删除键值对并返回 false
 func (db_ *DataBase) checkNotExpired(key string) bool {
 
@@ -55,7 +113,7 @@ func (db_ *DataBase) checkNotExpired(key string) bool {
 		return true
 	}
 
-	if ttl.(structure.Int64).Value() > global.Now.Unix() {
+	if ttl.(structure.Int64).Value() > global.Now().Unix() {
 		// 如果没有过期
 		return true
 	}
@@ -80,8 +138,37 @@ func (db_ *DataBase) StopEvictNotification() {
 	db_.enableNotification = false
 }
 
+// SwapDataBase 交换 dbs 中序号为 i 与 j 的数据库，用于 swapdb 命令，交换期间会持有两个数据库的写锁。
+// 阻塞的客户端、监视键以及驱逐通知与数据库序号对应，不会随数据一起交换，两个数据库中被监视的键都视为发生了修改
+func SwapDataBase(dbs []*DataBase, i, j int) {
+	if i == j {
+		return
+	}
+	// 按照序号顺序加锁
+	if i > j {
+		i, j = j, i
+	}
+	a, b := dbs[i], dbs[j]
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	a.watches.reviseNotifyAll()
+	b.watches.reviseNotifyAll()
+
+	a.watches, b.watches = b.watches, a.watches
+	a.blocked, b.blocked = b.blocked, a.blocked
+	a.enableNotification, b.enableNotification = b.enableNotification, a.enableNotification
+	a.notifies, b.notifies = b.notifies, a.notifies
+	a.expiredFields, b.expiredFields = b.expiredFields, a.expiredFields
+
+	dbs[i], dbs[j] = b, a
+}
+
 // RemoveTTL 删除键的 TTL 信息，如果 TTL 则返回 false
 func (db_ *DataBase) RemoveTTL(key string) bool {
+	db_.beforeWrite(key)
 	return db_.ttlKeys.Delete(key)
 }
 
@@ -92,9 +179,10 @@ func (db_ *DataBase) GetTTL(key string) int64 {
 	ttl, exist := db_.ttlKeys.Get(key)
 	if exist {
 		// 如果存在 ttl，检查过期时间
-		now := global.Now.Unix()
+		now := global.Now().Unix()
 		r := ttl.(Int64).Value() - now
 		if r < 0 {
+			db_.beforeWrite(key)
 			db_.ttlKeys.Delete(key)
 			db_.dict.Delete(key)
 			if db_.enableNotification {
@@ -118,28 +206,69 @@ func (db_ *DataBase) GetTTL(key string) int64 {
 func (db_ *DataBase) GetKey(key string) (Object, bool) {
 	ok := db_.checkNotExpired(key)
 	if !ok {
+		db_.lookupMissed()
 		return nil, false
 	}
-	item, exist := db_.dict.Get(key)
+	v, exist := db_.dict.Get(key)
 	if exist {
+		if !db_.checkFieldsNotExpired(key, v.(*eviction.Item)) {
+			db_.lookupMissed()
+			return nil, false
+		}
+		if db_.countLookups {
+			db_.hits++
+		}
+		v, _ = db_.dict.Get(key)
 		if db_.rookies != nil {
 			db_.rookies.Hit(key)
 		}
-		db_.evict.KeyUsed(key, item.(*eviction.Item))
-		return item.(*eviction.Item).Value, true
+		// 调用者可能会原地修改值对象，因此快照存在时需要先复制
+		item := db_.ownValue(key, v.(*eviction.Item))
+		item.Touch()
+		db_.evict.KeyUsed(key, item)
+		return item.Value, true
 	}
+	db_.lookupMissed()
 	return nil, false
 }
 
+// lookupMissed 记录一次没有命中的查询
+func (db_ *DataBase) lookupMissed() {
+	if db_.countLookups {
+		db_.misses++
+	}
+}
+
+// KeyspaceStats 返回通过 Lookup 执行的只读命令查询键时命中与未命中的次数
+func (db_ *DataBase) KeyspaceStats() (hits, misses int64) {
+	return db_.hits, db_.misses
+}
+
+// GetItem 返回键对应的字段，用于查看访问时间等元信息，该操作不会被记录为一次访问
+func (db_ *DataBase) GetItem(key string) (*eviction.Item, bool) {
+	ok := db_.checkNotExpired(key)
+	if !ok {
+		return nil, false
+	}
+	item, exist := db_.dict.Get(key)
+	if !exist {
+		return nil, false
+	}
+	return item.(*eviction.Item), true
+}
+
 // SetKey 将键值对插入到 DataBase 中，该操作可能会覆盖旧键。
 func (db_ *DataBase) SetKey(key string, value Object) bool {
-	item := &eviction.Item{Value: value}
+	item := eviction.NewItem(value)
+	db_.beforeWrite(key)
 	db_.dict.Set(key, item)
+	db_.markOwned(key)
 	db_.evict.KeyUsed(key, item)
 	if db_.rookies != nil {
 		db_.rookies.NewOne(key)
 	}
 	db_.ReviseNotify(key, 0, 0)
+	db_.trackFieldTTL(key, value)
 	return true
 }
 
@@ -148,26 +277,31 @@ func (db_ *DataBase) SetTTL(key string, ttl int64) bool {
 	if !db_.dict.Exist(key) {
 		return false
 	}
+	db_.beforeWrite(key)
 	db_.ttlKeys.Set(key, Int64(ttl))
 	return true
 }
 
 // SetKeyWithTTL 将键值对插入到 DataBase 中，并设置 TTL 信息，该操作可能会覆盖旧键。
 func (db_ *DataBase) SetKeyWithTTL(key string, value Object, ttl int64) bool {
-	item := &eviction.Item{Value: value}
+	item := eviction.NewItem(value)
+	db_.beforeWrite(key)
 	db_.dict.Set(key, item)
+	db_.markOwned(key)
 	db_.ttlKeys.Set(key, Int64(ttl))
 	db_.evict.KeyUsed(key, item)
 	if db_.rookies != nil {
 		db_.rookies.NewOne(key)
 	}
 	db_.ReviseNotify(key, 0, 0)
+	db_.trackFieldTTL(key, value)
 	return true
 }
 
 // DeleteKey 将会删除 DataBase 中对应的键值对，若键不存在，返回 false
 func (db_ *DataBase) DeleteKey(key string) bool {
 
+	db_.beforeWrite(key)
 	db_.ttlKeys.Delete(key)
 	if db_.rookies != nil {
 		db_.rookies.RemoveOne(key)
@@ -183,19 +317,22 @@ func (db_ *DataBase) DeleteKey(key string) bool {
 func (db_ *DataBase) RenameKey(old, new string) bool {
 
 	// 顺带检查 ttl 是否过期
-	value, ok := db_.GetKey(old)
+	item, ok := db_.GetItem(old)
 	if !ok {
 		return false
 	}
 
+	db_.beforeWrite(old)
+	db_.beforeWrite(new)
 	ttl, ok := db_.ttlKeys.Get(old)
 	db_.ttlKeys.Delete(old)
 	db_.dict.Delete(old)
 
-	db_.dict.Set(new, &eviction.Item{Value: value})
+	db_.dict.Set(new, item)
 	if ttl != nil {
 		db_.ttlKeys.Set(new, ttl)
 	}
+	db_.trackFieldTTL(new, item.Value)
 
 	db_.ReviseNotify(old, 0, 0)
 	db_.ReviseNotify(new, 0, 0)
@@ -211,19 +348,34 @@ func (db_ *DataBase) ExistKey(key string) bool {
 		return false
 	}
 
-	return db_.dict.Exist(key)
+	v, exist := db_.dict.Get(key)
+	return exist && db_.checkFieldsNotExpired(key, v.(*eviction.Item))
 }
 
 // Keys 返回 DataBase 中通过正则表达式匹配的所有键
 func (db_ *DataBase) Keys(pattern string) (keys []string, nums int) {
+	// 遍历时会删除过期键
+	db_.beforeWriteAll()
 	return db_.dict.KeysWithTTL(db_.ttlKeys, pattern)
 }
 
 // KeysByte 返回 DataBase 中通过正则表达式匹配的所有键，键以 []byte 类型存储
 func (db_ *DataBase) KeysByte(pattern string) (keys [][]byte, nums int) {
+	db_.beforeWriteAll()
 	return db_.dict.KeysWithTTLByte(db_.ttlKeys, pattern)
 }
 
+// Scan 从 cursor 开始遍历数据库中未过期的键，用于 scan 命令。返回下一次遍历的游标，遍历结束时返回 0
+func (db_ *DataBase) Scan(cursor, count int, f func(key string, value structure.Object)) int {
+	now := global.Now().Unix()
+	return db_.dict.Scan(cursor, count, func(key string, value structure.Object) {
+		if ttl, ok := db_.ttlKeys.Get(key); ok && ttl.(Int64).Value() < now {
+			return
+		}
+		f(key, value.(*eviction.Item).Value)
+	})
+}
+
 // RandomKey 随机返回一个键，如果 DataBase 不存在键值对，将会返回空字符串
 func (db_ *DataBase) RandomKey() (string, bool) {
 	keys := db_.dict.Random(1)
@@ -233,16 +385,20 @@ func (db_ *DataBase) RandomKey() (string, bool) {
 	return "", false
 }
 
-// CleanExpiredKeys 在 db 中随机抽取 samples 个数的 ttl key，如果过期则删除，并返回删除掉的个数
+// CleanExpiredKeys 在 db 中随机抽取 samples 个数的 ttl key，如果过期则删除，并返回删除掉的个数。该操作会获取写锁
 func (db_ *DataBase) CleanExpiredKeys(samples int) int {
 
-	now := global.Now.Unix()
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
 
-	ttls := db_.ttlKeys.Random(samples)
+	now := global.Now().Unix()
+
+	ttls := db_.ttlKeys.Sample(samples)
 	deleted := 0
 	for key, expire := range ttls {
 		if expire.(Int64).Value() < now {
 			deleted++
+			db_.beforeWrite(key)
 			db_.ttlKeys.Delete(key)
 			db_.dict.Delete(key)
 			if db_.enableNotification {
@@ -258,6 +414,18 @@ func (db_ *DataBase) CleanExpiredKeys(samples int) int {
 func (db_ *DataBase) Clear() {
 	db_.dict = structure.NewDict(db_.dict.ShardNum())
 	db_.ttlKeys = structure.NewDict(db_.ttlKeys.ShardNum())
+	db_.fieldTTLKeys = make(map[string]struct{})
+	db_.dictShared, db_.ttlShared = nil, nil
+}
+
+// Flush 清空 DataBase 中的所有键值对，淘汰策略、阻塞的客户端以及驱逐通知等设置保持不变，
+// 被 watch 的键都视为发生了修改。用于 flushdb、flushall 命令，该操作会获取写锁
+func (db_ *DataBase) Flush() {
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
+
+	db_.watches.reviseNotifyAll()
+	db_.Clear()
 }
 
 // Size 返回数据库中键值对数量，函数不会检查键值对的过期情况。
@@ -287,7 +455,7 @@ func (db_ *DataBase) ReviseNotify(key string, oldCost, newCost int64) {
 	db_.watches.reviseNotify(key)
 }
 
-// ReviseNotifyAll 通知所有被 watch 的键修改，用于 flushdb 和 flushall 命令
+// ReviseNotifyAll 通知所有被 watch 的键修改
 func (db_ *DataBase) ReviseNotifyAll() {
 	db_.watches.reviseNotifyAll()
 }
@@ -301,6 +469,11 @@ func (db_ *DataBase) RegisterBlocked(key string, id uuid.UUID, n chan<- []byte,
 	db_.blocked.register(key, id, n, ddl)
 }
 
+// UnregisterBlocked 取消客户端在键上的阻塞等待
+func (db_ *DataBase) UnregisterBlocked(key string, id uuid.UUID) {
+	db_.blocked.unregister(key, id)
+}
+
 func (db_ *DataBase) SlotCount(slotSeq int) int {
 	return db_.dict.ShardCount(slotSeq)
 }
@@ -317,115 +490,90 @@ func (db_ *DataBase) IsKeyPermitted(key string) int64 {
 	return db_.evict.Estimate(key)
 }
 
-func (db_ *DataBase) evictKeys(access, roomNeeded int64) (evicted []string, accepted bool) {
+// Policy 返回数据库的淘汰策略
+func (db_ *DataBase) Policy() EvictPolicy {
+	return db_.policy
+}
 
-	victims := make([]string, 0, roomNeeded)
+// evictSamples 是每次选择淘汰键时的采样数量
+const evictSamples = 16
 
-	for room := int64(0); room < roomNeeded; {
-		var minKey string
-		var minEvict = int64(math.MaxInt64)
-		for k, v := range db_.dict.Random(10) {
-			if v.(*eviction.Item).Evict < minEvict {
-				minKey = k
-			}
-		}
+// evictCandidate 按照淘汰策略从采样的键中选出最应该被淘汰的键
+func (db_ *DataBase) evictCandidate() (string, *eviction.Item, bool) {
 
-		// 不满足驱逐条件
-		if db_.evict.Estimate(minKey) > access {
-			return victims, false
+	var victim string
+	var victimItem *eviction.Item
+
+	if db_.policy == EvictVolatileTTL {
+		// 选择最早过期的键
+		minTTL := int64(math.MaxInt64)
+		for k, ttl := range db_.ttlKeys.Sample(evictSamples) {
+			if ttl.(Int64).Value() < minTTL {
+				if v, exist := db_.dict.Get(k); exist {
+					minTTL = ttl.(Int64).Value()
+					victim, victimItem = k, v.(*eviction.Item)
+				}
+			}
 		}
-		db_.DeleteKey(minKey)
-		victims = append(victims, minKey)
-		room++
+		return victim, victimItem, victimItem != nil
 	}
-	return victims, true
-}
-
-func (db_ *DataBase) evictRookies(_, roomNeeded int64) (evicted []string, accepted bool) {
 
-	victims := make([]string, 0, roomNeeded)
+	samples := db_.dict.Sample(evictSamples)
 
-	for room := int64(0); room < roomNeeded; {
-		var minKey string
-		var minEvict = int64(math.MaxInt64)
-
-		// 从非活跃中选择出少部分
+	// 预备表中长时间未被访问的键同样作为候选
+	if db_.rookies != nil {
 		for _, k := range db_.rookies.Candidates(5) {
-
-			v, _ := db_.dict.Get(k)
-			if v.(*eviction.Item).Evict < minEvict {
-				minKey = k
+			if v, exist := db_.dict.Get(k); exist {
+				samples[k] = v
 			}
 		}
-
-		db_.DeleteKey(minKey)
-
-		victims = append(victims, minKey)
-		room++
 	}
-	return victims, true
-}
-
-func (db_ *DataBase) evictTTLKeys(access, roomNeeded int64) (evicted []string, accepted bool) {
-
-	victims := make([]string, 0, roomNeeded)
-
-	for room := int64(0); room < roomNeeded; {
-		var minKey string
-		var minEvict = int64(math.MaxInt64)
-
-		// 选择一个价值最小的键或一个过期的键
-		for k, ttl := range db_.ttlKeys.Random(10) {
 
-			if ttl.(Int64).Value() < global.Now.Unix() {
-				minKey = k
-				break
+	for k, v := range samples {
+		item := v.(*eviction.Item)
+		if victimItem == nil {
+			victim, victimItem = k, item
+			continue
+		}
+		switch db_.policy {
+		case EvictLRU:
+			if item.Access < victimItem.Access {
+				victim, victimItem = k, item
 			}
-			v, _ := db_.dict.Get(k)
-			if v.(*eviction.Item).Evict < minEvict {
-				minKey = k
+		case EvictLFU:
+			freq, victimFreq := item.Frequency(), victimItem.Frequency()
+			if freq < victimFreq || (freq == victimFreq && item.Access < victimItem.Access) {
+				victim, victimItem = k, item
 			}
 		}
-
-		// 不满足驱逐条件
-		if db_.evict.Estimate(minKey) > access {
-			return victims, false
-		}
-
-		db_.DeleteKey(minKey)
-
-		victims = append(victims, minKey)
-		room++
 	}
-	return victims, true
+	return victim, victimItem, victimItem != nil
 }
 
-func (db_ *DataBase) Evict(access, roomNeeded int64) (evicted []string, accepted bool) {
+// Evict 按照淘汰策略删除键值对，直到释放的空间不少于 roomNeeded 或没有可以淘汰的键，返回被淘汰的键以及释放的空间。
+// 被淘汰的键不会通过 notifies 通知，由调用者负责传播。该操作会获取写锁
+func (db_ *DataBase) Evict(roomNeeded int64) (evicted []string, freed int64) {
 
-	if !db_.enableEvict {
-		return []string{}, false
-	}
-
-	// 首先考虑带有过期时间的数据
-	evicted, accepted = db_.evictTTLKeys(access, roomNeeded)
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
 
-	// 其次考虑 rookies 中的数据
-	if !accepted && db_.rookies != nil {
-		evicted, accepted = db_.evictRookies(access, roomNeeded)
-	}
+	evicted = make([]string, 0)
 
-	// 最后考虑非过期时间数据
-	if !accepted {
-		victims, _ := db_.evictKeys(access, roomNeeded)
-		evicted = append(evicted, victims...)
+	if !db_.enableEvict || db_.policy == NoEviction {
+		return evicted, 0
 	}
 
-	// 驱逐通知
-	for i := range evicted {
-		db_.notifies <- evicted[i]
+	for freed < roomNeeded {
+		key, item, ok := db_.evictCandidate()
+		if !ok {
+			break
+		}
+		freed += item.Cost() + int64(len(key))
+		db_.DeleteKey(key)
+		evicted = append(evicted, key)
 	}
 
-	return evicted, accepted
+	return evicted, freed
 }
 
 func (db_ *DataBase) Cost() int64 {
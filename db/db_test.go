@@ -1,9 +1,13 @@
 package db
 
 import (
+	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/tangrc99/MemTable/db/eviction"
+	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -39,26 +43,26 @@ func TestDataBaseTTL(t *testing.T) {
 
 	db := NewDataBase(1)
 
-	assert.True(t, db.SetKeyWithTTL("key", Int64(1), global.Now.Unix()+1))
+	assert.True(t, db.SetKeyWithTTL("key", Int64(1), global.Now().Unix()+1))
 	assert.True(t, db.SetKey("k1", Int64(1)))
-	assert.True(t, db.SetTTL("k1", global.Now.Unix()+2))
+	assert.True(t, db.SetTTL("k1", global.Now().Unix()+2))
 
 	assert.Equal(t, int64(2), db.GetTTL("k1"))
 
-	global.Now = global.Now.Add(time.Second)
+	global.SetGlobalClock(global.Now().Add(time.Second))
 	assert.Equal(t, int64(0), db.GetTTL("key"))
 	assert.True(t, db.ExistKey("k1"))
 
-	global.Now = global.Now.Add(time.Second)
+	global.SetGlobalClock(global.Now().Add(time.Second))
 	assert.Equal(t, int64(-2), db.GetTTL("key"))
 
 	assert.False(t, db.ExistKey("key"))
-	global.Now = global.Now.Add(time.Second)
+	global.SetGlobalClock(global.Now().Add(time.Second))
 
 	assert.False(t, db.ExistKey("k1"))
 
 	assert.False(t, db.RemoveTTL("k1"))
-	assert.True(t, db.SetKeyWithTTL("key", Int64(1), global.Now.Unix()+1))
+	assert.True(t, db.SetKeyWithTTL("key", Int64(1), global.Now().Unix()+1))
 	assert.True(t, db.RemoveTTL("key"))
 
 }
@@ -79,13 +83,39 @@ func TestDataBaseWatch(t *testing.T) {
 
 }
 
+func TestSwapDataBase(t *testing.T) {
+
+	dbs := []*DataBase{NewDataBase(1), NewDataBase(1)}
+	first, second := dbs[0], dbs[1]
+
+	first.SetKey("a", structure.Slice("0"))
+	revised := false
+	first.Watch("a", &revised)
+	first.RegisterBlocked("list", uuid.Must(uuid.NewV1()), make(chan []byte, 1), -1)
+
+	SwapDataBase(dbs, 1, 0)
+
+	// 数据随数据库交换，监视键与阻塞的客户端保留在原来的序号上
+	assert.Same(t, second, dbs[0])
+	assert.Same(t, first, dbs[1])
+	_, ok := dbs[1].GetKey("a")
+	assert.True(t, ok)
+	assert.True(t, revised)
+	assert.Equal(t, 1, dbs[0].WatchSize())
+	assert.Len(t, dbs[0].blocked.consumers, 1)
+	assert.Empty(t, dbs[1].blocked.consumers)
+
+	dbs[0].UnWatch("a", &revised)
+	assert.Equal(t, 0, dbs[0].WatchSize())
+}
+
 func TestDataBaseRandom(t *testing.T) {
 
 	db := NewDataBase(1)
-	db.SetKeyWithTTL("k1", Int64(1), global.Now.Unix()+1)
-	db.SetKeyWithTTL("k2", Int64(1), global.Now.Unix()+1)
-	db.SetKeyWithTTL("k3", Int64(1), global.Now.Unix()+1)
-	db.SetKeyWithTTL("k4", Int64(1), global.Now.Unix()+1)
+	db.SetKeyWithTTL("k1", Int64(1), global.Now().Unix()+1)
+	db.SetKeyWithTTL("k2", Int64(1), global.Now().Unix()+1)
+	db.SetKeyWithTTL("k3", Int64(1), global.Now().Unix()+1)
+	db.SetKeyWithTTL("k4", Int64(1), global.Now().Unix()+1)
 
 	keys := []string{"k1", "k2", "k3", "k4"}
 
@@ -93,11 +123,11 @@ func TestDataBaseRandom(t *testing.T) {
 	assert.True(t, ok)
 	assert.Subset(t, keys, []string{key})
 
-	ks, n := db.Keys(".*")
+	ks, n := db.Keys("*")
 	assert.Equal(t, 4, n)
 	assert.Subset(t, keys, ks)
 
-	global.Now = global.Now.Add(2 * time.Second)
+	global.SetGlobalClock(global.Now().Add(2 * time.Second))
 
 	n = db.CleanExpiredKeys(4)
 	assert.Equal(t, 4, n)
@@ -122,3 +152,136 @@ func TestDataBaseOptions(t *testing.T) {
 	db5 := NewDataBase(1, WithRookies())
 	assert.NotNil(t, db5.rookies)
 }
+
+func TestDataBaseEvict(t *testing.T) {
+
+	keys := []string{"k0", "k1", "k2", "k3", "k4"}
+
+	// 计算淘汰指定键能够释放的空间
+	room := func(db *DataBase, victims ...string) int64 {
+		var r int64
+		for _, k := range victims {
+			item, _ := db.GetItem(k)
+			r += item.Cost() + int64(len(k))
+		}
+		return r
+	}
+
+	// noeviction 不会淘汰任何键
+	db := NewDataBase(1, WithEviction(NoEviction))
+	for _, k := range keys {
+		db.SetKey(k, structure.Slice("value"))
+	}
+	evicted, freed := db.Evict(1 << 20)
+	assert.Empty(t, evicted)
+	assert.Equal(t, int64(0), freed)
+	assert.Equal(t, 5, db.Size())
+
+	// allkeys-lru 淘汰最久未被访问的键
+	db = NewDataBase(1, WithEviction(EvictLRU))
+	for _, k := range keys {
+		db.SetKey(k, structure.Slice("value"))
+	}
+	global.SetGlobalClock(global.Now().Add(10 * time.Second))
+	db.GetKey("k0")
+	db.GetKey("k1")
+	evicted, _ = db.Evict(room(db, "k2", "k3", "k4"))
+	assert.ElementsMatch(t, []string{"k2", "k3", "k4"}, evicted)
+	assert.True(t, db.ExistKey("k0"))
+	assert.True(t, db.ExistKey("k1"))
+
+	// allkeys-lfu 淘汰访问频率最低的键
+	db = NewDataBase(1, WithEviction(EvictLFU))
+	for _, k := range keys {
+		db.SetKey(k, structure.Slice("value"))
+	}
+	for i := 0; i < 50; i++ {
+		db.GetKey("k3")
+		db.GetKey("k4")
+	}
+	evicted, _ = db.Evict(room(db, "k0", "k1", "k2"))
+	assert.ElementsMatch(t, []string{"k0", "k1", "k2"}, evicted)
+	assert.Equal(t, 2, db.Size())
+
+	// volatile-ttl 只淘汰带有过期时间的键，并优先淘汰最早过期的键
+	db = NewDataBase(1, WithEviction(EvictVolatileTTL))
+	now := global.Now().Unix()
+	db.SetKeyWithTTL("k0", structure.Slice("value"), now+300)
+	db.SetKeyWithTTL("k1", structure.Slice("value"), now+100)
+	db.SetKeyWithTTL("k2", structure.Slice("value"), now+200)
+	db.SetKey("k3", structure.Slice("value"))
+	db.SetKey("k4", structure.Slice("value"))
+
+	evicted, _ = db.Evict(room(db, "k1"))
+	assert.Equal(t, []string{"k1"}, evicted)
+
+	evicted, freed = db.Evict(1 << 20)
+	assert.Equal(t, []string{"k2", "k0"}, evicted)
+	assert.Equal(t, 2*room(db, "k3"), freed)
+	assert.Equal(t, 2, db.Size())
+}
+
+func TestDataBaseConcurrentAccess(t *testing.T) {
+
+	db := NewDataBase(8)
+	db.SetKey("l", structure.NewList())
+
+	const writes = 2000
+	wg := sync.WaitGroup{}
+
+	// 写者在一次 Update 中同时修改多个键以及集合类型的值
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= writes; i++ {
+			db.Update(func() {
+				v := structure.Slice(strconv.Itoa(i))
+				db.SetKey("a", v)
+				db.SetKey("b", v)
+				l, _ := db.GetKey("l")
+				l.(*structure.List).PushBack(v)
+				db.SetKeyWithTTL("ttl"+strconv.Itoa(i), v, global.Now().Unix()-1)
+			})
+		}
+	}()
+
+	// 内存淘汰以及过期键清理同样在写锁下执行
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes/10; i++ {
+			db.CleanExpiredKeys(20)
+		}
+	}()
+
+	// 读者在读锁下看到的数据总是一致的
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes/4; i++ {
+				db.View(func() {
+					a, ok1 := db.Peek("a")
+					b, ok2 := db.Peek("b")
+					assert.Equal(t, ok1, ok2)
+					assert.Equal(t, a, b)
+
+					l, _ := db.Peek("l")
+					n := l.(*structure.List).Size()
+					if ok1 {
+						assert.Equal(t, strconv.Itoa(n), string(a.(structure.Slice)))
+					} else {
+						assert.Equal(t, 0, n)
+					}
+					db.TTLSize()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	v, ok := db.Peek("a")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice(strconv.Itoa(writes)), v)
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"github.com/tangrc99/MemTable/db/eviction"
+	"github.com/tangrc99/MemTable/db/structure"
+	"strconv"
+)
+
+// Digest 是数据的 sha1 摘要，逻辑内容相同的数据库摘要一定相同，用于检查持久化以及主从复制的一致性
+type Digest [sha1.Size]byte
+
+// String 返回摘要的十六进制表示
+func (d Digest) String() string {
+	return fmt.Sprintf("%x", d[:])
+}
+
+// xor 将 data 的 sha1 摘要异或到 d 中，结果与调用顺序无关，用于无序集合
+func (d *Digest) xor(data []byte) {
+	h := sha1.Sum(data)
+	for i := range d {
+		d[i] ^= h[i]
+	}
+}
+
+// mix 将 data 混合到 d 中，结果与调用顺序有关，用于有序的数据
+func (d *Digest) mix(data []byte) {
+	d.xor(data)
+	*d = sha1.Sum(d[:])
+}
+
+// 值类型的标识，参与摘要的计算
+const (
+	digestString = iota
+	digestList
+	digestSet
+	digestZSet
+	digestHash
+	digestStream
+)
+
+// Digest 计算整个数据库的摘要，包括全部的键、值以及是否设置了过期时间，数据库为空时返回全零的摘要
+func (db_ *DataBase) Digest() (d Digest) {
+
+	db_.mu.RLock()
+	defer db_.mu.RUnlock()
+
+	dicts, _ := db_.dict.GetAll()
+	for _, dict := range dicts {
+		for k, v := range dict {
+			_, ttl := db_.ttlKeys.Get(k)
+			kd := digestKey(k, v.(*eviction.Item).Value, ttl)
+			// 键之间使用异或，因此与遍历顺序无关
+			for i := range d {
+				d[i] ^= kd[i]
+			}
+		}
+	}
+	return d
+}
+
+// DigestAll 计算多个数据库的摘要，相同的键位于不同的数据库中时摘要不同，全部数据库为空时返回全零的摘要
+func DigestAll(dbs []*DataBase) (d Digest) {
+
+	for i, database := range dbs {
+		dd := database.Digest()
+		if dd == (Digest{}) {
+			continue
+		}
+		d.mix(digestType(uint32(i)))
+		d.mix(dd[:])
+	}
+	return d
+}
+
+// DigestKey 计算单个键的值的摘要，键不存在时返回 false
+func (db_ *DataBase) DigestKey(key string) (Digest, bool) {
+
+	db_.mu.RLock()
+	defer db_.mu.RUnlock()
+
+	v, ok := db_.dict.Get(key)
+	if !ok {
+		return Digest{}, false
+	}
+	return digestValue(v.(*eviction.Item).Value), true
+}
+
+// digestKey 计算一个键值对的摘要
+func digestKey(key string, v structure.Object, ttl bool) (d Digest) {
+
+	d.mix([]byte(key))
+	vd := digestValue(v)
+	d.mix(vd[:])
+	if ttl {
+		d.mix([]byte("!!expire!!"))
+	}
+	return d
+}
+
+// digestValue 计算值的摘要，有序的数据结构按照顺序混合，无序的数据结构使用异或
+func digestValue(v structure.Object) (d Digest) {
+
+	switch v := v.(type) {
+	case structure.Slice:
+		d.mix(digestType(digestString))
+		d.mix(v)
+
+	case *structure.List:
+		d.mix(digestType(digestList))
+		values, _ := v.Range(0, -1)
+		for _, value := range values {
+			d.mix(value.(structure.Slice))
+		}
+
+	case *structure.Set:
+		d.mix(digestType(digestSet))
+		members, _ := v.KeysByte("")
+		for _, member := range members {
+			d.xor(member)
+		}
+
+	case *structure.ZSet:
+		d.mix(digestType(digestZSet))
+		members, _ := v.Pos(0, -1)
+		for _, member := range members {
+			m := string(member.(structure.String))
+			score, _ := v.GetScoreByKey(m)
+			var ed Digest
+			ed.mix([]byte(m))
+			ed.mix([]byte(strconv.FormatFloat(float64(score), 'g', -1, 32)))
+			d.xor(ed[:])
+		}
+
+	case *structure.Hash:
+		d.mix(digestType(digestHash))
+		kvs, _ := v.GetAll()
+		for _, kv := range kvs {
+			for field, value := range kv {
+				var ed Digest
+				ed.mix([]byte(field))
+				ed.mix(value.(structure.Slice))
+				// field 的过期时间同样是数据的一部分
+				if ttl, ok := v.FieldTTL(field); ok {
+					ed.mix([]byte(strconv.FormatInt(ttl, 10)))
+				}
+				d.xor(ed[:])
+			}
+		}
+
+	case *structure.Stream:
+		d.mix(digestType(digestStream))
+		for _, entry := range v.After(structure.StreamID{}, 0) {
+			d.mix([]byte(entry.ID.String()))
+			for _, field := range entry.Fields {
+				d.mix(field)
+			}
+		}
+
+	default:
+		panic(fmt.Sprintf("Unexpected type %T", v))
+	}
+
+	return d
+}
+
+func digestType(t uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, t)
+}
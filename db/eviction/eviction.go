@@ -2,12 +2,41 @@ package eviction
 
 import (
 	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/server/global"
 )
 
 // Item 是数据库中存储的字段
 type Item struct {
-	Value structure.Object // 真实值
-	Evict int64            // 淘汰策略用值，越大越好
+	Value  structure.Object // 真实值
+	Evict  int64            // 淘汰策略用值，越大越好
+	Access int64            // 最近一次访问的 unix 时间戳，用于 LRU 以及 OBJECT IDLETIME
+	Freq   uint8            // 对数形式的访问频率计数器，用于 LFU 以及 OBJECT FREQ
+}
+
+// NewItem 创建一个新的字段，访问时间为当前时间
+func NewItem(value structure.Object) *Item {
+	return &Item{
+		Value:  value,
+		Access: global.Now().Unix(),
+		Freq:   LFUInitVal,
+	}
+}
+
+// Touch 记录一次访问，更新访问时间以及访问频率
+func (item *Item) Touch() {
+	now := global.Now().Unix()
+	item.Freq = lfuLogIncr(lfuDecr(item.Freq, now-item.Access))
+	item.Access = now
+}
+
+// IdleTime 返回距离上一次访问经过的秒数
+func (item *Item) IdleTime() int64 {
+	return global.Now().Unix() - item.Access
+}
+
+// Frequency 返回衰减后的访问频率计数器
+func (item *Item) Frequency() uint8 {
+	return lfuDecr(item.Freq, item.IdleTime())
 }
 
 func (item *Item) Cost() int64 {
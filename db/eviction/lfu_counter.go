@@ -0,0 +1,42 @@
+package eviction
+
+import (
+	"math/rand"
+)
+
+const (
+	// LFUInitVal 是新键的访问频率初始值，防止新键刚写入就被淘汰
+	LFUInitVal = 5
+	// lfuLogFactor 决定计数器增长的速度，值越大计数器增长越慢
+	lfuLogFactor = 10
+	// lfuDecayTime 是计数器衰减的周期，单位为分钟
+	lfuDecayTime = 1
+)
+
+// lfuLogIncr 以对数概率的方式增加计数器，计数器越大增长的概率越小
+func lfuLogIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(counter) - LFUInitVal
+	if base < 0 {
+		base = 0
+	}
+	p := 1.0 / (base*lfuLogFactor + 1)
+	if rand.Float64() < p {
+		counter++
+	}
+	return counter
+}
+
+// lfuDecr 根据距离上一次访问经过的时间衰减计数器，elapsed 单位为秒
+func lfuDecr(counter uint8, elapsed int64) uint8 {
+	periods := elapsed / 60 / lfuDecayTime
+	if periods <= 0 {
+		return counter
+	}
+	if periods > int64(counter) {
+		return 0
+	}
+	return counter - uint8(periods)
+}
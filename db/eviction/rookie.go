@@ -18,7 +18,7 @@ type rookie struct {
 
 func newRookie() *rookie {
 	return &rookie{
-		Tp:     global.Now,
+		Tp:     global.Now(),
 		Access: 1,
 	}
 }
@@ -57,7 +57,7 @@ func (l *RookieList) Candidates(num int) []string {
 	victims := make([]string, 0, num)
 	max := 20
 	for key, rookie := range l.rookies {
-		if global.Now.Sub(rookie.Tp) > rookiePeriod {
+		if global.Now().Sub(rookie.Tp) > rookiePeriod {
 			victims = append(victims, key)
 		}
 		if len(victims) == num || max < 0 {
@@ -71,7 +71,7 @@ func (l *RookieList) Candidates(num int) []string {
 // InProtection 用于确定一个键是否正处于保护期内
 func (l *RookieList) InProtection(key string) bool {
 	if rookie, exist := l.rookies[key]; exist {
-		if global.Now.Sub(rookie.Tp) <= rookiePeriod {
+		if global.Now().Sub(rookie.Tp) <= rookiePeriod {
 			return true
 		}
 	}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"github.com/tangrc99/MemTable/db/eviction"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/server/global"
+)
+
+// TrackFieldTTL 记录设置了 field 过期时间的 hash 键，用于主动删除过期的 field
+func (db_ *DataBase) TrackFieldTTL(key string) {
+	db_.fieldTTLKeys[key] = struct{}{}
+}
+
+// trackFieldTTL 在写入的值是设置了 field 过期时间的 hash 时记录该键，用于复制、重命名以及加载的键
+func (db_ *DataBase) trackFieldTTL(key string, value Object) {
+	if hash, ok := value.(*structure.Hash); ok && hash.HasFieldTTL() {
+		db_.TrackFieldTTL(key)
+	}
+}
+
+// checkFieldsNotExpired 删除 hash 中已经过期的 field，如果全部 field 都过期，会删除整个键并返回 false
+func (db_ *DataBase) checkFieldsNotExpired(key string, item *eviction.Item) bool {
+
+	now := global.Now().Unix()
+	hash, ok := item.Value.(*structure.Hash)
+	if !ok || !hash.HasExpiredField(now) {
+		return true
+	}
+
+	// 快照存在时不能原地修改共享的值对象
+	hash = db_.ownValue(key, item).Value.(*structure.Hash)
+	oldCost := hash.Cost()
+	fields := hash.ExpireFields(now)
+
+	if hash.Empty() {
+		db_.DeleteKey(key)
+		if db_.enableNotification {
+			db_.notifies <- key
+		}
+		return false
+	}
+	if db_.enableNotification {
+		db_.expiredFields = append(db_.expiredFields, ExpiredFields{Key: key, Fields: fields})
+	}
+	db_.ReviseNotify(key, oldCost, hash.Cost())
+	return true
+}
+
+// ExpiredFields 记录一个 hash 键中过期删除的 field，全部 field 过期时会通过删除通知传播，不会记录在这里
+type ExpiredFields struct {
+	Key    string
+	Fields []string
+}
+
+// PopExpiredFields 返回并清空开启通知以来过期删除的 field，服务层需要将其以 hdel 命令的形式传播。该操作会获取写锁
+func (db_ *DataBase) PopExpiredFields() []ExpiredFields {
+
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
+
+	expired := db_.expiredFields
+	db_.expiredFields = nil
+	return expired
+}
+
+// CleanExpiredFields 从设置了 field 过期时间的 hash 中抽取 samples 个，删除其中过期的 field，
+// 返回存在过期 field 的 hash 数量。该操作会获取写锁
+func (db_ *DataBase) CleanExpiredFields(samples int) int {
+
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
+
+	cleaned := 0
+	for key := range db_.fieldTTLKeys {
+		if samples <= 0 {
+			break
+		}
+		samples--
+
+		v, exist := db_.dict.Get(key)
+		if !exist {
+			delete(db_.fieldTTLKeys, key)
+			continue
+		}
+		item := v.(*eviction.Item)
+		if hash, ok := item.Value.(*structure.Hash); !ok || !hash.HasFieldTTL() {
+			delete(db_.fieldTTLKeys, key)
+			continue
+		}
+
+		if hash := item.Value.(*structure.Hash); hash.HasExpiredField(global.Now().Unix()) {
+			cleaned++
+			if !db_.checkFieldsNotExpired(key, item) {
+				delete(db_.fieldTTLKeys, key)
+			}
+		}
+	}
+	return cleaned
+}
@@ -10,24 +10,43 @@ const (
 	EvictLRU EvictPolicy = iota
 	EvictLFU
 	NoEviction
+	EvictVolatileTTL
 )
 
+// ParseEvictPolicy 将配置文件中的淘汰策略名称转换为 EvictPolicy，同时兼容旧的 no lru lfu 写法
+func ParseEvictPolicy(name string) (EvictPolicy, bool) {
+	switch name {
+	case "noeviction", "no":
+		return NoEviction, true
+	case "allkeys-lru", "lru":
+		return EvictLRU, true
+	case "allkeys-lfu", "lfu":
+		return EvictLFU, true
+	case "volatile-ttl":
+		return EvictVolatileTTL, true
+	}
+	return NoEviction, false
+}
+
 func WithEviction(policy EvictPolicy) Option {
 	switch policy {
-	case EvictLRU:
+	case EvictLRU, EvictVolatileTTL:
 		return func(db *DataBase) {
 			db.enableEvict = true
+			db.policy = policy
 			db.evict = eviction.NewSampleLRU()
 		}
 	case EvictLFU:
 		return func(db *DataBase) {
 			db.enableEvict = true
+			db.policy = policy
 			db.evict = eviction.NewTinyLFU(100)
 		}
 	}
 
 	return func(db *DataBase) {
 		db.enableEvict = false
+		db.policy = NoEviction
 		db.evict = eviction.NewNoEviction()
 	}
 }
@@ -1,116 +1,412 @@
 package db
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/hdt3213/rdb/core"
 	"github.com/hdt3213/rdb/encoder"
 	"github.com/hdt3213/rdb/model"
+	"github.com/hdt3213/rdb/parser"
 	"github.com/tangrc99/MemTable/db/eviction"
 	"github.com/tangrc99/MemTable/db/structure"
 )
 
-// Encode 将阻塞地将 DataBase 中的全部键值对写入到 rdb 文件中，如果写入过程发生错误将返回 error
-func (db_ *DataBase) Encode(enc *core.Encoder) error {
+// Encode 将阻塞地将 DataBase 中的全部键值对写入到 rdb 文件编号为 index 的数据库中，如果写入过程发生错误将返回 error。
+// 写入期间会持有读锁，因此可以在后台协程中调用。无法使用 rdb 对象表示的值需要在写入任何数据库之前通过 EncodeAux 写入
+func (db_ *DataBase) Encode(enc *core.Encoder, index int) error {
+
+	db_.mu.RLock()
+	defer db_.mu.RUnlock()
+
+	return encode(enc, index, db_.dict, db_.ttlKeys)
+}
+
+// EncodeAux 将 DataBase 中无法使用 rdb 对象表示的键值对写入到辅助字段中
+func (db_ *DataBase) EncodeAux(enc *core.Encoder, index int) error {
+
+	db_.mu.RLock()
+	defer db_.mu.RUnlock()
+
+	return encodeAux(enc, index, db_.dict, db_.ttlKeys)
+}
+
+// encode 将 dict 中可以使用 rdb 对象表示的键值对写入到编号为 index 的数据库中，ttlKeys 是记录过期时间的字典。
+// 没有需要写入的键值对时不会写入数据库头部
+func encode(enc *core.Encoder, index int, dict, ttlKeys *structure.Dict) error {
 
 	var err error = nil
 
-	dicts, _ := db_.dict.GetAll()
+	dicts, _ := dict.GetAll()
 
 	keys := 0
 	ttls := 0
+	objects := 0
+	objectTTLs := 0
 
 	for _, dict := range dicts {
 		for k, v := range dict {
+			keys++
+			_, expire := ttlKeys.Get(k)
+			if expire {
+				ttls++
+			}
+			if _, _, ok := auxPayload(v.(*eviction.Item).Value); !ok {
+				objects++
+				if expire {
+					objectTTLs++
+				}
+			}
+		}
+	}
 
-			v = v.(*eviction.Item).Value
+	if ttls != ttlKeys.Size() {
+		return errors.New(fmt.Sprintf("DB TTL Size Not Matched, Expected %d But %d", ttlKeys.Size(), ttls))
+	}
+	if keys != dict.Size() {
+		return errors.New(fmt.Sprintf("DB Size Not Matched, Expected %d But %d", dict.Size(), keys))
+	}
+	if objects == 0 {
+		return nil
+	}
 
-			keys++
-			var ttl uint64 = 0
+	err = enc.WriteDBHeader(uint(index), uint64(objects), uint64(objectTTLs))
+	if err != nil {
+		return err
+	}
 
-			if expiredAt, ok := db_.ttlKeys.Get(k); ok {
+	for _, dict := range dicts {
+		for k, v := range dict {
 
-				ttl = uint64(expiredAt.(Int64) * 1000)
-				ttls++
+			v = v.(*eviction.Item).Value
+			if _, _, ok := auxPayload(v); ok {
+				continue
 			}
 
-			if str, ok := v.(structure.Slice); ok {
+			var ttl uint64 = 0
 
-				if ttl > 0 {
-					err = enc.WriteStringObject(k, str, encoder.WithTTL(ttl))
-				} else {
-					err = enc.WriteStringObject(k, str)
-				}
+			if expiredAt, ok := ttlKeys.Get(k); ok {
+				ttl = uint64(expiredAt.(Int64) * 1000)
+			}
 
-			} else if list, ok := v.(*structure.List); ok {
+			err = encodeObject(enc, k, v, ttl)
 
-				values, n := list.Range(0, -1)
-				listVal := make([][]byte, n)
-				for i, value := range values {
-					listVal[i] = value.(structure.Slice)
-				}
-				if ttl > 0 {
-					err = enc.WriteListObject(k, listVal, encoder.WithTTL(ttl))
-				} else {
-					err = enc.WriteListObject(k, listVal)
-				}
-
-			} else if set, ok := v.(*structure.Set); ok {
+			if err != nil {
+				return err
+			}
+		}
+	}
 
-				members, _ := set.KeysByte("")
-				if ttl > 0 {
-					err = enc.WriteSetObject(k, members, encoder.WithTTL(ttl))
-				} else {
-					err = enc.WriteSetObject(k, members)
-				}
+	return err
+}
 
-			} else if zset, ok := v.(*structure.ZSet); ok {
+// rdb 编码库不支持 stream 类型，也无法保存 hash 中 field 的过期时间，这些值会序列化后写入辅助字段。
+// 字段值依次为数据库编号、以秒为单位的过期时间戳、键以及序列化后的值
+const (
+	streamAuxKey = "memtable-stream"
+	hashAuxKey   = "memtable-hash"
+)
 
-				members, n := zset.Pos(0, -1)
-				entrys := make([]*model.ZSetEntry, n)
-				for i, member := range members {
-					score, _ := zset.GetScoreByKey(string(member.(structure.String)))
-					entrys[i] = &model.ZSetEntry{
-						Score:  float64(score),
-						Member: string(member.(structure.String)),
-					}
-				}
-				if ttl > 0 {
-					err = enc.WriteZSetObject(k, entrys, encoder.WithTTL(ttl))
-				} else {
-					err = enc.WriteZSetObject(k, entrys)
-				}
+// auxPayload 返回值对应的辅助字段名以及序列化后的值，值可以使用 rdb 对象表示时返回 false
+func auxPayload(v structure.Object) (string, []byte, bool) {
+	switch v := v.(type) {
+	case *structure.Stream:
+		return streamAuxKey, v.Marshal(), true
+	case *structure.Hash:
+		if v.HasFieldTTL() {
+			return hashAuxKey, v.Marshal(), true
+		}
+	}
+	return "", nil, false
+}
 
-			} else if hash, ok := v.(*structure.Dict); ok {
+// encodeAux 将 dict 中无法使用 rdb 对象表示的值写入到辅助字段中，辅助字段必须在任何数据库之前写入
+func encodeAux(enc *core.Encoder, index int, dict, ttlKeys *structure.Dict) error {
 
-				kvs, _ := hash.GetAll()
-				entrys := make(map[string][]byte)
-				for key, value := range (kvs)[0] {
-					entrys[key] = value.(structure.Slice)
-				}
+	dicts, _ := dict.GetAll()
 
-				if ttl > 0 {
-					err = enc.WriteHashMapObject(k, entrys, encoder.WithTTL(ttl))
-				} else {
-					err = enc.WriteHashMapObject(k, entrys)
-				}
-			} else {
+	for _, dict := range dicts {
+		for k, v := range dict {
 
-				panic(fmt.Sprintf("Unexpected type %T", v))
+			auxKey, payload, ok := auxPayload(v.(*eviction.Item).Value)
+			if !ok {
+				continue
+			}
 
+			var ttl int64 = 0
+			if expiredAt, ok := ttlKeys.Get(k); ok {
+				ttl = expiredAt.(Int64).Value()
 			}
 
-			if err != nil {
+			buf := binary.AppendUvarint(nil, uint64(index))
+			buf = binary.AppendVarint(buf, ttl)
+			buf = binary.AppendUvarint(buf, uint64(len(k)))
+			buf = append(buf, k...)
+			buf = append(buf, payload...)
+
+			if err := enc.WriteAux(auxKey, string(buf)); err != nil {
 				return err
 			}
 		}
 	}
+	return nil
+}
+
+// DecodeAux 将 rdb 文件中由 EncodeAux 写入的辅助字段还原到对应的数据库中，其他辅助字段会被忽略。
+// 数据库编号超出范围时会跳过该字段
+func DecodeAux(dbs []*DataBase, o *model.AuxObject) error {
+
+	if o.GetKey() != streamAuxKey && o.GetKey() != hashAuxKey {
+		return nil
+	}
+
+	data := []byte(o.Value)
+	index, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errBadAux
+	}
+	data = data[n:]
+	ttl, n := binary.Varint(data)
+	if n <= 0 {
+		return errBadAux
+	}
+	data = data[n:]
+	keyLen, n := binary.Uvarint(data)
+	if n <= 0 || keyLen > uint64(len(data[n:])) {
+		return errBadAux
+	}
+	data = data[n:]
+	key := string(data[:keyLen])
 
-	if ttls != db_.TTLSize() {
-		return errors.New(fmt.Sprintf("DB TTL Size Not Matched, Expected %d But %d", db_.TTLSize(), ttls))
+	var value structure.Object
+	var err error
+	if o.GetKey() == streamAuxKey {
+		value, err = structure.UnmarshalStream(data[keyLen:])
+	} else {
+		value, err = structure.UnmarshalHash(data[keyLen:])
 	}
-	if keys != db_.Size() {
-		return errors.New(fmt.Sprintf("DB Size Not Matched, Expected %d But %d", db_.Size(), keys))
+	if err != nil {
+		return err
+	}
+	if index >= uint64(len(dbs)) {
+		return nil
+	}
+
+	dbs[index].restore(key, value, ttl)
+	return nil
+}
+
+// 辅助字段无法解析时返回的错误
+var errBadAux = errors.New("bad aux field")
+
+// encodeObject 将一个键值对写入到 rdb 文件中，ttl 是以毫秒为单位的过期时间戳，为 0 时代表不会过期
+func encodeObject(enc *core.Encoder, k string, v structure.Object, ttl uint64) error {
+
+	var err error = nil
+
+	if str, ok := v.(structure.Slice); ok {
+
+		if ttl > 0 {
+			err = enc.WriteStringObject(k, str, encoder.WithTTL(ttl))
+		} else {
+			err = enc.WriteStringObject(k, str)
+		}
+
+	} else if list, ok := v.(*structure.List); ok {
+
+		values, n := list.Range(0, -1)
+		listVal := make([][]byte, n)
+		for i, value := range values {
+			listVal[i] = value.(structure.Slice)
+		}
+		if ttl > 0 {
+			err = enc.WriteListObject(k, listVal, encoder.WithTTL(ttl))
+		} else {
+			err = enc.WriteListObject(k, listVal)
+		}
+
+	} else if set, ok := v.(*structure.Set); ok {
+
+		members, _ := set.KeysByte("")
+		if ttl > 0 {
+			err = enc.WriteSetObject(k, members, encoder.WithTTL(ttl))
+		} else {
+			err = enc.WriteSetObject(k, members)
+		}
+
+	} else if zset, ok := v.(*structure.ZSet); ok {
+
+		members, n := zset.Pos(0, -1)
+		entrys := make([]*model.ZSetEntry, n)
+		for i, member := range members {
+			score, _ := zset.GetScoreByKey(string(member.(structure.String)))
+			entrys[i] = &model.ZSetEntry{
+				Score:  float64(score),
+				Member: string(member.(structure.String)),
+			}
+		}
+		if ttl > 0 {
+			err = enc.WriteZSetObject(k, entrys, encoder.WithTTL(ttl))
+		} else {
+			err = enc.WriteZSetObject(k, entrys)
+		}
+
+	} else if hash, ok := v.(*structure.Hash); ok {
+
+		kvs, _ := hash.GetAll()
+		entrys := make(map[string][]byte)
+		for key, value := range (kvs)[0] {
+			entrys[key] = value.(structure.Slice)
+		}
+
+		if ttl > 0 {
+			err = enc.WriteHashMapObject(k, entrys, encoder.WithTTL(ttl))
+		} else {
+			err = enc.WriteHashMapObject(k, entrys)
+		}
+	} else if _, ok := v.(*structure.Stream); ok {
+
+		// stream 只能通过 encodeAux 写入辅助字段
+		err = errors.New("stream can not be encoded as rdb object")
+
+	} else {
+
+		panic(fmt.Sprintf("Unexpected type %T", v))
+
 	}
+
 	return err
 }
+
+// Decode 将 rdb 文件中解析出的一个对象写入到 DataBase 中，已经存在的键会被覆盖。对象的类型不支持时返回 false
+func (db_ *DataBase) Decode(o model.RedisObject) bool {
+
+	value, ok := decodeObject(o)
+	if !ok {
+		return false
+	}
+
+	var ttl int64 = 0
+	if expiration := o.GetExpiration(); expiration != nil {
+		ttl = expiration.Unix()
+	}
+	db_.restore(o.GetKey(), value, ttl)
+	return true
+}
+
+// restore 写入从 rdb 文件中解析出的键值对，ttl 是以秒为单位的过期时间戳，为 0 时代表不会过期
+func (db_ *DataBase) restore(key string, value structure.Object, ttl int64) {
+
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
+
+	if ttl > 0 {
+		db_.SetKeyWithTTL(key, value, ttl)
+	} else {
+		db_.SetKey(key, value)
+		db_.RemoveTTL(key)
+	}
+}
+
+// decodeObject 将 rdb 文件中的对象转换为对应的数据结构，与 encodeObject 相对应
+func decodeObject(o model.RedisObject) (structure.Object, bool) {
+
+	switch o := o.(type) {
+	case *model.StringObject:
+		return structure.Slice(o.Value), true
+
+	case *model.ListObject:
+		list := structure.NewList()
+		for _, v := range o.Values {
+			list.PushBack(structure.Slice(v))
+		}
+		return list, true
+
+	case *model.SetObject:
+		set := structure.NewSet()
+		for _, m := range o.Members {
+			set.Add(string(m))
+		}
+		return set, true
+
+	case *model.ZSetObject:
+		zset := structure.NewZSet()
+		for _, e := range o.Entries {
+			zset.Add(structure.Float32(e.Score), e.Member)
+		}
+		return zset, true
+
+	case *model.HashObject:
+		hash := structure.NewHash()
+		for k, v := range o.Hash {
+			hash.Set(k, structure.Slice(v))
+		}
+		return hash, true
+	}
+
+	return nil, false
+}
+
+// SerializedLength 返回值按照 rdb 格式编码后的长度，不包含键以及过期时间
+func SerializedLength(v structure.Object) int {
+
+	if _, payload, ok := auxPayload(v); ok {
+		return len(payload)
+	}
+
+	buf := &bytes.Buffer{}
+	enc := core.NewEncoder(buf)
+	if enc.WriteHeader() != nil || enc.WriteDBHeader(0, 1, 0) != nil {
+		return 0
+	}
+	base := buf.Len()
+
+	// 空键会占用一个字节的长度标识
+	if encodeObject(enc, "", v, 0) != nil {
+		return 0
+	}
+	return buf.Len() - base - 1
+}
+
+// 序列化数据无法解析时返回的错误信息，与 redis 相同
+var errBadPayload = errors.New("ERR DUMP payload version or checksum are wrong")
+
+// DumpObject 将值编码为只包含一个对象的 rdb 数据，用于 dump 以及 migrate 命令。与 redis 的格式不兼容，只能由 RestoreObject 解析
+func DumpObject(v structure.Object) ([]byte, error) {
+
+	if _, ok := v.(*structure.Stream); ok {
+		return nil, errors.New("ERR DUMP is not supported for stream")
+	}
+
+	buf := &bytes.Buffer{}
+	enc := core.NewEncoder(buf)
+	if err := enc.WriteHeader(); err != nil {
+		return nil, err
+	}
+	if err := enc.WriteDBHeader(0, 1, 0); err != nil {
+		return nil, err
+	}
+	if err := encodeObject(enc, "", v, 0); err != nil {
+		return nil, err
+	}
+	if err := enc.WriteEnd(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RestoreObject 解析 DumpObject 编码的数据，数据中必须恰好包含一个对象
+func RestoreObject(payload []byte) (v structure.Object, err error) {
+
+	objects := 0
+	err = parser.NewDecoder(bytes.NewReader(payload)).Parse(func(o model.RedisObject) bool {
+		objects++
+		v, _ = decodeObject(o)
+		return true
+	})
+	if err != nil || objects != 1 || v == nil {
+		return nil, errBadPayload
+	}
+	return v, nil
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"github.com/hdt3213/rdb/core"
+	"github.com/tangrc99/MemTable/db/eviction"
+	"github.com/tangrc99/MemTable/db/structure"
+)
+
+// Snapshot 是 DataBase 在某一时刻的只读视图，创建快照的复杂度为 O(分片数)。
+// 快照创建后 DataBase 仍然可以被修改，修改不会反映到快照中，因此后台协程可以在不加锁的情况下遍历快照，
+// 不会阻塞事件循环中的写操作。
+//
+// 快照存在期间，DataBase 的分片在第一次被修改时复制，值对象在第一次通过 GetKey 访问时复制。
+// 如果同时存在多个快照，新的快照创建后，旧快照仍然保持共享的分片不会再被修改。
+type Snapshot struct {
+	db       *DataBase
+	dict     *structure.Dict
+	ttlKeys  *structure.Dict
+	released bool
+}
+
+// Snapshot 创建一个快照，快照使用完毕后需要调用 Release 释放
+func (db_ *DataBase) Snapshot() *Snapshot {
+	db_.mu.Lock()
+	defer db_.mu.Unlock()
+
+	db_.snapshots++
+	db_.owned = make(map[string]struct{})
+	db_.dictShared = sharedShards(db_.dict.ShardNum())
+	db_.ttlShared = sharedShards(db_.ttlKeys.ShardNum())
+
+	return &Snapshot{
+		db:      db_,
+		dict:    db_.dict.Snapshot(),
+		ttlKeys: db_.ttlKeys.Snapshot(),
+	}
+}
+
+func sharedShards(n int) []bool {
+	shared := make([]bool, n)
+	for i := range shared {
+		shared[i] = true
+	}
+	return shared
+}
+
+// ownShard 如果键所在的分片与快照共享，先复制该分片
+func ownShard(dict *structure.Dict, shared []bool, key string) {
+	if shared == nil {
+		return
+	}
+	if pos := dict.ShardOf(key); shared[pos] {
+		dict.CopyShard(pos)
+		shared[pos] = false
+	}
+}
+
+// beforeWrite 需要在修改键对应的键值对或 TTL 之前调用，保证修改不会影响快照
+func (db_ *DataBase) beforeWrite(key string) {
+	ownShard(db_.dict, db_.dictShared, key)
+	ownShard(db_.ttlKeys, db_.ttlShared, key)
+}
+
+// beforeWriteAll 需要在修改任意键值对之前调用，会复制所有与快照共享的分片
+func (db_ *DataBase) beforeWriteAll() {
+	for pos, shared := range db_.dictShared {
+		if shared {
+			db_.dict.CopyShard(pos)
+		}
+	}
+	for pos, shared := range db_.ttlShared {
+		if shared {
+			db_.ttlKeys.CopyShard(pos)
+		}
+	}
+	db_.dictShared, db_.ttlShared = nil, nil
+}
+
+// ownValue 在快照存在时复制键对应的值对象，使之后的原地修改不会影响快照，每个键在一个快照周期内只会复制一次
+func (db_ *DataBase) ownValue(key string, item *eviction.Item) *eviction.Item {
+	if db_.snapshots == 0 {
+		return item
+	}
+	if _, ok := db_.owned[key]; ok {
+		return item
+	}
+	c := *item
+	c.Value = structure.Clone(item.Value)
+	db_.beforeWrite(key)
+	db_.dict.Set(key, &c)
+	db_.owned[key] = struct{}{}
+	return &c
+}
+
+// markOwned 标记键对应的值对象不与快照共享
+func (db_ *DataBase) markOwned(key string) {
+	if db_.snapshots > 0 {
+		db_.owned[key] = struct{}{}
+	}
+}
+
+// Get 返回快照中键对应的值，不检查键是否过期
+func (s *Snapshot) Get(key string) (Object, bool) {
+	item, exist := s.dict.Get(key)
+	if !exist {
+		return nil, false
+	}
+	return item.(*eviction.Item).Value, true
+}
+
+// TTL 返回快照中键的过期时间戳，如果键没有设置过期时间，返回 false
+func (s *Snapshot) TTL(key string) (int64, bool) {
+	ttl, exist := s.ttlKeys.Get(key)
+	if !exist {
+		return 0, false
+	}
+	return ttl.(Int64).Value(), true
+}
+
+// Size 返回快照中键值对的数量
+func (s *Snapshot) Size() int {
+	return s.dict.Size()
+}
+
+// TTLSize 返回快照中具有 TTL 信息的键值对数量
+func (s *Snapshot) TTLSize() int {
+	return s.ttlKeys.Size()
+}
+
+// Encode 将快照中的键值对写入到 rdb 文件编号为 index 的数据库中
+func (s *Snapshot) Encode(enc *core.Encoder, index int) error {
+	return encode(enc, index, s.dict, s.ttlKeys)
+}
+
+// EncodeAux 将快照中无法使用 rdb 对象表示的键值对写入到辅助字段中，必须在写入任何数据库之前调用
+func (s *Snapshot) EncodeAux(enc *core.Encoder, index int) error {
+	return encodeAux(enc, index, s.dict, s.ttlKeys)
+}
+
+// Release 释放快照，重复调用不会产生影响
+func (s *Snapshot) Release() {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.released {
+		return
+	}
+	s.released = true
+	s.db.snapshots--
+	if s.db.snapshots == 0 {
+		s.db.dictShared, s.db.ttlShared = nil, nil
+		s.db.owned = nil
+	}
+}
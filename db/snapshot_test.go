@@ -0,0 +1,105 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	future := global.Now().Unix() + 100
+
+	db := NewDataBase(4)
+	db.SetKey("s", structure.Slice("v1"))
+	db.SetKeyWithTTL("ttl", structure.Slice("v"), future)
+	db.SetKey("del", structure.Slice("v"))
+	l := structure.NewList()
+	l.PushBack(structure.Slice("a"))
+	db.SetKey("l", l)
+
+	snapshot := db.Snapshot()
+
+	// 修改数据库
+	db.SetKey("s", structure.Slice("v2"))
+	db.SetKey("new", structure.Slice("v"))
+	db.DeleteKey("del")
+	db.SetTTL("ttl", future+100)
+	value, _ := db.GetKey("l")
+	value.(*structure.List).PushBack(structure.Slice("b"))
+
+	// 快照中是修改之前的数据
+	v, ok := snapshot.Get("s")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice("v1"), v)
+	_, ok = snapshot.Get("new")
+	assert.False(t, ok)
+	_, ok = snapshot.Get("del")
+	assert.True(t, ok)
+	ttl, ok := snapshot.TTL("ttl")
+	assert.True(t, ok)
+	assert.Equal(t, future, ttl)
+	v, _ = snapshot.Get("l")
+	assert.Equal(t, 1, v.(*structure.List).Size())
+	assert.Equal(t, 4, snapshot.Size())
+	assert.Equal(t, 1, snapshot.TTLSize())
+
+	// 数据库中是修改之后的数据
+	v, _ = db.GetKey("s")
+	assert.Equal(t, structure.Slice("v2"), v)
+	v, _ = db.GetKey("l")
+	assert.Equal(t, 2, v.(*structure.List).Size())
+	assert.Equal(t, int64(200), db.GetTTL("ttl"))
+	assert.Equal(t, 4, db.Size())
+
+	// 清空数据库不影响快照
+	db.Clear()
+	assert.Equal(t, 4, snapshot.Size())
+
+	snapshot.Release()
+	snapshot.Release()
+	assert.Equal(t, 0, db.snapshots)
+	assert.Nil(t, db.owned)
+}
+
+func TestSnapshotConcurrentWrite(t *testing.T) {
+
+	db := NewDataBase(16)
+	for i := 0; i < 1000; i++ {
+		db.SetKey(strconv.Itoa(i), structure.Slice("old"))
+	}
+	db.SetKey("l", structure.NewList())
+
+	snapshot := db.Snapshot()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// 后台协程遍历快照时不需要加锁
+		for i := 0; i < 1000; i++ {
+			v, ok := snapshot.Get(strconv.Itoa(i))
+			assert.True(t, ok)
+			assert.Equal(t, structure.Slice("old"), v)
+		}
+		v, _ := snapshot.Get("l")
+		assert.Equal(t, 0, v.(*structure.List).Size())
+	}()
+
+	for i := 0; i < 1000; i++ {
+		db.Update(func() {
+			db.SetKey(strconv.Itoa(i), structure.Slice("new"))
+			l, _ := db.GetKey("l")
+			l.(*structure.List).PushBack(structure.Slice("v"))
+		})
+	}
+
+	wg.Wait()
+	snapshot.Release()
+
+	v, _ := db.GetKey("l")
+	assert.Equal(t, 1000, v.(*structure.List).Size())
+}
@@ -25,7 +25,7 @@ func (b *BitMap) ByteLen() int {
 	return len(*b)
 }
 
-// Get 获取指定位置上的 bit 值
+// Get 获取指定位置上的 bit 值，与 redis 相同，byte 中的高位在前
 func (b *BitMap) Get(pos int) byte {
 	// 第几个 byte
 	byteSeq := pos / 8
@@ -36,7 +36,7 @@ func (b *BitMap) Get(pos int) byte {
 		return 0
 	}
 
-	return ((*b)[byteSeq] >> bitSeq) & 0x01
+	return ((*b)[byteSeq] >> (7 - bitSeq)) & 0x01
 }
 
 // Set 修改指定位置上的 bit 值
@@ -53,9 +53,9 @@ func (b *BitMap) Set(pos int, val byte) {
 	}
 
 	if val == 1 {
-		(*b)[byteSeq] |= byte(1 << bitSeq)
+		(*b)[byteSeq] |= byte(0x80 >> bitSeq)
 	} else {
-		(*b)[byteSeq] &^= byte(1 << bitSeq)
+		(*b)[byteSeq] &^= byte(0x80 >> bitSeq)
 	}
 }
 
@@ -66,10 +66,8 @@ func (b *BitMap) GetSet(pos int, val byte) byte {
 	return old
 }
 
-// Count 返回 byte 范围内 bit 值为 1 的 bit 数量； start 和 end 都是 byte 的位置，而不是 bit 位置
-func (b *BitMap) Count(start, end int) int {
-	// 位置检查
-	maxLen := b.ByteLen()
+// normalizeRange 处理负数位置并将范围截断到 [0, maxLen)，范围为空时返回 false
+func normalizeRange(start, end, maxLen int) (int, int, bool) {
 	if start < 0 {
 		start += maxLen
 	}
@@ -78,7 +76,7 @@ func (b *BitMap) Count(start, end int) int {
 	}
 
 	if start > end || end < 0 || start >= maxLen {
-		return 0
+		return 0, 0, false
 	}
 	if start < 0 {
 		start = 0
@@ -86,6 +84,15 @@ func (b *BitMap) Count(start, end int) int {
 	if end >= maxLen {
 		end = maxLen - 1
 	}
+	return start, end, true
+}
+
+// Count 返回 byte 范围内 bit 值为 1 的 bit 数量； start 和 end 都是 byte 的位置，而不是 bit 位置
+func (b *BitMap) Count(start, end int) int {
+	start, end, ok := normalizeRange(start, end, b.ByteLen())
+	if !ok {
+		return 0
+	}
 
 	count := 0
 	for _, byteVal := range (*b)[start : end+1] {
@@ -99,45 +106,62 @@ func (b *BitMap) Count(start, end int) int {
 	return count
 }
 
-// Pos 返回 byte 范围内 bit 值为 val 的起始位置； start 和 end 都是 byte 的位置，而不是 bit 位置
+// Pos 返回 byte 范围内第一个 bit 值为 val 的 bit 位置，不存在时返回 -1； start 和 end 都是 byte 的位置，而不是 bit 位置
 func (b *BitMap) Pos(val byte, start, end int) int {
-	// 位置检查
-	maxLen := b.ByteLen()
-	if start < 0 {
-		start += maxLen
-	}
-	if end < 0 {
-		end += maxLen
+	start, end, ok := normalizeRange(start, end, b.ByteLen())
+	if !ok {
+		return -1
 	}
+	return b.pos(val, start*8, end*8+7)
+}
 
-	if start > end || end < 0 || start >= maxLen {
+// PosBit 与 Pos 相同，但是 start 和 end 都是 bit 位置
+func (b *BitMap) PosBit(val byte, start, end int) int {
+	start, end, ok := normalizeRange(start, end, b.ByteLen()*8)
+	if !ok {
 		return -1
 	}
-	if start < 0 {
-		start = 0
-	}
-	if end >= maxLen {
-		end = maxLen - 1
-	}
-
-	pos := start * 8
-
-	for _, byteVal := range (*b)[start : end+1] {
-
-		for i := 7; i >= 0; i-- {
+	return b.pos(val, start, end)
+}
 
-			if byteVal>>i != val {
+// pos 在 bit 范围 [start, end] 内查找第一个值为 val 的 bit
+func (b *BitMap) pos(val byte, start, end int) int {
 
-				pos++
+	// 整个 byte 都不满足时可以直接跳过
+	skip := byte(0x00)
+	if val == 0 {
+		skip = 0xff
+	}
 
-			} else {
-				return pos
-			}
+	for i := start; i <= end; {
+		if i%8 == 0 && end-i >= 7 && (*b)[i/8] == skip {
+			i += 8
+			continue
 		}
+		if b.Get(i) == val {
+			return i
+		}
+		i++
 	}
 	return -1
 }
 
+// GetBits 读取从 offset 开始的 bits 个 bit，按照高位在前组成无符号整数，超出长度的部分视为 0
+func (b *BitMap) GetBits(offset, bits int) uint64 {
+	var v uint64
+	for i := 0; i < bits; i++ {
+		v = v<<1 | uint64(b.Get(offset+i))
+	}
+	return v
+}
+
+// SetBits 将 v 的低 bits 位按照高位在前写入到从 offset 开始的位置，长度不够时会自动生长
+func (b *BitMap) SetBits(offset, bits int, v uint64) {
+	for i := 0; i < bits; i++ {
+		b.Set(offset+i, byte(v>>(bits-1-i))&0x01)
+	}
+}
+
 func (b *BitMap) RangeSet(val byte, start, end int) {
 	maxLen := b.ByteLen() * 8
 	if start < 0 {
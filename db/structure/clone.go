@@ -0,0 +1,66 @@
+package structure
+
+// Clone 返回对象的深拷贝，修改拷贝不会影响原对象。不可变的基础类型会直接返回
+func Clone(obj Object) Object {
+
+	switch v := obj.(type) {
+
+	case Slice:
+		c := make(Slice, len(v))
+		copy(c, v)
+		return c
+
+	case *Dict:
+		return v.clone()
+
+	case *Hash:
+		return v.clone()
+
+	case *Set:
+		return &Set{dict: v.dict.clone()}
+
+	case *ZSet:
+		c := NewZSet()
+		for _, shard := range v.dict.shards {
+			for key, score := range shard {
+				c.Add(score.(Float32), key)
+			}
+		}
+		return c
+
+	case *List:
+		c := NewList()
+		for node := v.FrontNode(); node != nil; node = node.Next() {
+			c.PushBack(Clone(node.Value))
+		}
+		return c
+
+	case *Stream:
+		return v.clone()
+
+	case *Bloom:
+		c := *v
+		c.bitset = make([]uint64, len(v.bitset))
+		copy(c.bitset, v.bitset)
+		return &c
+	}
+
+	return obj
+}
+
+// clone 返回 Dict 的深拷贝
+func (dict *Dict) clone() *Dict {
+	c := &Dict{
+		shards: make([]Shard, dict.size),
+		size:   dict.size,
+		count:  dict.count,
+		cost:   dict.cost,
+	}
+	for i, shard := range dict.shards {
+		c.shards[i] = make(Shard, len(shard))
+		for k, v := range shard {
+			c.shards[i][k] = Clone(v)
+		}
+	}
+	return c
+}
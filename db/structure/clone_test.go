@@ -0,0 +1,89 @@
+package structure
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+
+	s := Slice("abc")
+	cs := Clone(s).(Slice)
+	cs[0] = 'x'
+	assert.Equal(t, Slice("abc"), s)
+
+	l := NewList()
+	l.PushBack(Slice("a"))
+	cl := Clone(l).(*List)
+	cl.PushBack(Slice("b"))
+	cl.Front().(Slice)[0] = 'x'
+	assert.Equal(t, 1, l.Size())
+	assert.Equal(t, Slice("a"), l.Front())
+	assert.Equal(t, 2, cl.Size())
+
+	d := NewDict(4)
+	d.Set("f", Slice("v"))
+	cd := Clone(d).(*Dict)
+	cd.Set("f", Slice("v2"))
+	cd.Set("g", Slice("v"))
+	v, _ := d.Get("f")
+	assert.Equal(t, Slice("v"), v)
+	assert.Equal(t, 1, d.Size())
+	assert.Equal(t, 2, cd.Size())
+
+	set := NewSet()
+	set.Add("a")
+	cset := Clone(set).(*Set)
+	cset.Add("b")
+	assert.False(t, set.Exist("b"))
+	assert.True(t, cset.Exist("a"))
+
+	z := NewZSet()
+	z.Add(1, "a")
+	cz := Clone(z).(*ZSet)
+	cz.Add(2, "a")
+	cz.Add(3, "b")
+	score, _ := z.GetScoreByKey("a")
+	assert.Equal(t, Float32(1), score)
+	score, _ = cz.GetScoreByKey("a")
+	assert.Equal(t, Float32(2), score)
+
+	st := NewStream()
+	st.Append(StreamID{1, 0}, [][]byte{[]byte("f"), []byte("v")})
+	st.CreateGroup("g", StreamID{})
+	cst := Clone(st).(*Stream)
+	cst.Append(StreamID{2, 0}, [][]byte{[]byte("f"), []byte("v")})
+	g, _ := cst.Group("g")
+	g.ReadNew(cst, "c", 0, 0, false)
+	assert.Equal(t, 1, st.Size())
+	assert.Equal(t, 2, cst.Size())
+	g, _ = st.Group("g")
+	assert.Equal(t, 0, g.PendingSize())
+}
+
+func TestDictSnapshot(t *testing.T) {
+
+	d := NewDict(4)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		d.Set(k, Slice(k))
+	}
+
+	snapshot := d.Snapshot()
+	for _, k := range []string{"a", "b", "e"} {
+		d.CopyShard(d.ShardOf(k))
+	}
+	d.Set("a", Slice("x"))
+	d.Delete("b")
+	d.SetIfNotExist("e", Slice("e"))
+
+	v, _ := snapshot.Get("a")
+	assert.Equal(t, Slice("a"), v)
+	assert.True(t, snapshot.Exist("b"))
+	assert.False(t, snapshot.Exist("e"))
+	assert.Equal(t, 4, snapshot.Size())
+
+	v, _ = d.Get("a")
+	assert.Equal(t, Slice("x"), v)
+	assert.False(t, d.Exist("b"))
+	assert.Equal(t, 4, d.Size())
+}
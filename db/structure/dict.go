@@ -2,11 +2,9 @@
 package structure
 
 import (
-	"github.com/tangrc99/MemTable/logger"
 	"github.com/tangrc99/MemTable/server/global"
+	glob "github.com/tangrc99/MemTable/utils/pattern"
 	"hash/fnv"
-	"math/rand"
-	"regexp"
 	"unsafe"
 )
 
@@ -56,6 +54,29 @@ func (dict *Dict) countShard(key string) *Shard {
 	return &dict.shards[pos]
 }
 
+// ShardOf 返回键值对应的分片号
+func (dict *Dict) ShardOf(key string) int {
+	return hashKey(key) % dict.size
+}
+
+// CopyShard 将指定分片替换为一份拷贝，之后对该分片的修改不会影响到共享原分片的快照
+func (dict *Dict) CopyShard(pos int) {
+	shard := make(Shard, len(dict.shards[pos]))
+	for k, v := range dict.shards[pos] {
+		shard[k] = v
+	}
+	dict.shards[pos] = shard
+}
+
+// Snapshot 返回与 Dict 共享全部分片的只读快照，复杂度为 O(分片数)。调用者需要保证修改 Dict 的分片之前先通过
+// CopyShard 复制该分片，并且不会原地修改快照中的值，这样快照的内容才不会改变。
+func (dict *Dict) Snapshot() *Dict {
+	snapshot := *dict
+	snapshot.shards = make([]Shard, dict.size)
+	copy(snapshot.shards, dict.shards)
+	return &snapshot
+}
+
 func (dict *Dict) ShardNum() int {
 	return dict.size
 }
@@ -165,22 +186,14 @@ func (dict *Dict) Clear() {
 	dict.cost = dictBasicCost + shardBasicCost*int64(dict.size)
 }
 
-// Keys 返回匹配正则表达式全部键以及数量
+// Keys 返回匹配 glob 模式的全部键以及数量，pattern 为空时返回全部键
 func (dict *Dict) Keys(pattern string) ([]string, int) {
 	keys := make([]string, dict.count)
 	i := 0
 	for _, shard := range dict.shards {
 		for key := range shard {
 
-			ok := true
-			var err error
-			if pattern != "" {
-				ok, err = regexp.MatchString(pattern, key)
-				if err != nil {
-					logger.Error(err)
-					continue
-				}
-			}
+			ok := pattern == "" || glob.Match([]byte(pattern), []byte(key))
 			if ok {
 				keys[i] = key
 				i++
@@ -191,22 +204,14 @@ func (dict *Dict) Keys(pattern string) ([]string, int) {
 	return keys, i
 }
 
-// KeysByte 返回匹配正则表达式全部键以及数量，键值以[]byte形式返回
+// KeysByte 返回匹配 glob 模式的全部键以及数量，pattern 为空时返回全部键，键值以[]byte形式返回
 func (dict *Dict) KeysByte(pattern string) ([][]byte, int) {
 	keys := make([][]byte, dict.count)
 	i := 0
 	for _, shard := range dict.shards {
 		for key := range shard {
 
-			ok := true
-			var err error
-			if pattern != "" {
-				ok, err = regexp.MatchString(pattern, key)
-				if err != nil {
-					logger.Error(err)
-					continue
-				}
-			}
+			ok := pattern == "" || glob.Match([]byte(pattern), []byte(key))
 			if ok {
 				keys[i] = []byte(key)
 				i++
@@ -220,7 +225,7 @@ func (dict *Dict) KeysByte(pattern string) ([][]byte, int) {
 // KeysWithTTL 返回全部未过期键，ttl 为记录过期时间的字典
 func (dict *Dict) KeysWithTTL(ttl *Dict, pattern string) ([]string, int) {
 
-	now := global.Now.Unix()
+	now := global.Now().Unix()
 
 	keys := make([]string, 0, dict.count)
 	i := 0
@@ -234,18 +239,11 @@ func (dict *Dict) KeysWithTTL(ttl *Dict, pattern string) ([]string, int) {
 				v, _ := shard[key]
 				dict.cost -= v.Cost() + int64(len(key))
 				delete(shard, key)
+				dict.count--
 				ttl.Delete(key)
 			} else {
 
-				ok := true
-				var err error
-				if pattern != "" {
-					ok, err = regexp.MatchString(pattern, key)
-					if err != nil {
-						logger.Error(err)
-						continue
-					}
-				}
+				ok := pattern == "" || glob.Match([]byte(pattern), []byte(key))
 				if ok {
 					keys = append(keys, key)
 					i++
@@ -261,7 +259,7 @@ func (dict *Dict) KeysWithTTL(ttl *Dict, pattern string) ([]string, int) {
 // KeysWithTTLByte 返回全部未过期键，ttl 为记录过期时间的字典，键值以[]byte形式返回
 func (dict *Dict) KeysWithTTLByte(ttl *Dict, pattern string) ([][]byte, int) {
 
-	now := global.Now.Unix()
+	now := global.Now().Unix()
 
 	keys := make([][]byte, dict.count)
 	i := 0
@@ -275,18 +273,11 @@ func (dict *Dict) KeysWithTTLByte(ttl *Dict, pattern string) ([][]byte, int) {
 				v, _ := shard[key]
 				dict.cost -= v.Cost() + int64(len(key))
 				delete(shard, key)
+				dict.count--
 				ttl.Delete(key)
 			} else {
 
-				ok := true
-				var err error
-				if pattern != "" {
-					ok, err = regexp.MatchString(pattern, key)
-					if err != nil {
-						logger.Error(err)
-						continue
-					}
-				}
+				ok := pattern == "" || glob.Match([]byte(pattern), []byte(key))
 				if ok {
 					keys[i] = []byte(key)
 					i++
@@ -307,7 +298,7 @@ func (dict *Dict) Exist(key string) bool {
 	return exist
 }
 
-// Random 随机返回 Dict 中指定数量的键值对
+// Random 均匀随机地返回 Dict 中指定数量的键值对，需要遍历全部的键值对
 func (dict *Dict) Random(num int) map[string]Object {
 
 	selected := make(map[string]Object)
@@ -322,22 +313,80 @@ func (dict *Dict) Random(num int) map[string]Object {
 		return selected
 	}
 
-	for len(selected) < num {
+	if randomFixed() {
+		for _, key := range dict.randomSorted(num) {
+			selected[key] = (*dict.countShard(key))[key]
+		}
+		return selected
+	}
+
+	// 使用蓄水池抽样遍历所有键值对，每一个键值对被选中的概率都是 num/n
+	keys := make([]string, 0, num)
+	values := make([]Object, 0, num)
+	seen := 0
+	for _, shard := range dict.shards {
+		for k, v := range shard {
+			if len(keys) < num {
+				keys = append(keys, k)
+				values = append(values, v)
+			} else if j := randomIntn(seen + 1); j < num {
+				keys[j], values[j] = k, v
+			}
+			seen++
+		}
+	}
+	for i, k := range keys {
+		selected[k] = values[i]
+	}
+
+	return selected
+}
+
+// Sample 近似随机地返回 Dict 中指定数量的键值对，复杂度与键值对总数无关，但是每一个键值对被选中的概率不一定相同。
+// 用于过期键清理以及内存淘汰等只需要近似随机采样的场景
+func (dict *Dict) Sample(num int) map[string]Object {
+
+	selected := make(map[string]Object)
+
+	if num >= dict.count {
+		for _, shard := range dict.shards {
+			for key, value := range shard {
+				selected[key] = value
+			}
+		}
+		return selected
+	}
 
+	if randomFixed() {
+		for _, key := range dict.randomSorted(num) {
+			selected[key] = (*dict.countShard(key))[key]
+		}
+		return selected
+	}
+
+	// 从随机的分片开始，按照分片大小的比例从每一个分片中选取键值对。map 的遍历起点是随机的，
+	// 因此只需要取遍历的前几个元素，复杂度为 O(num + 分片数)，与键值对总数无关
+	start := randomIntn(dict.size)
+	for quota := true; len(selected) < num; quota = false {
 		for i := 0; i < dict.size && len(selected) < num; i++ {
-			for k, v := range dict.shards[i] {
-				// 使用概率选择法，每一个 key 被选择的概率都是 1/n
-				n := rand.Int() % dict.count
-				if n == 0 {
-					// 成功被选择
-					selected[k] = v
+			shard := dict.shards[(start+i)%dict.size]
+			take := len(shard)
+			if quota {
+				take = num * len(shard) / dict.count
+				if take == 0 && len(shard) > 0 {
+					take = 1
 				}
-				if len(selected) < num {
+			}
+			for k, v := range shard {
+				if take == 0 || len(selected) >= num {
 					break
 				}
+				if _, exist := selected[k]; !exist {
+					selected[k] = v
+					take--
+				}
 			}
 		}
-
 	}
 
 	return selected
@@ -357,12 +406,19 @@ func (dict *Dict) RandomKeys(num int) map[string]struct{} {
 		return selected
 	}
 
+	if randomFixed() {
+		for _, key := range dict.randomSorted(num) {
+			selected[key] = struct{}{}
+		}
+		return selected
+	}
+
 	for len(selected) < num {
 
 		for i := 0; i < dict.size && len(selected) < num; i++ {
 			for k := range dict.shards[i] {
 				// 使用概率选择法，每一个 key 被选择的概率都是 1/n
-				n := rand.Int() % dict.count
+				n := randomIntn(dict.count)
 				if n == 0 {
 					// 成功被选择
 					selected[k] = struct{}{}
@@ -381,6 +437,22 @@ func (dict *Dict) GetAll() ([]map[string]Object, int) {
 	return dict.shards, dict.count
 }
 
+// Scan 从 cursor 指定的分片开始遍历键值对，每次遍历完整的分片，直到遍历的数量不少于 count。
+// 返回下一次遍历的游标，遍历结束时返回 0
+func (dict *Dict) Scan(cursor, count int, f func(key string, value Object)) int {
+	visited := 0
+	for ; cursor < len(dict.shards); cursor++ {
+		if visited >= count {
+			return cursor
+		}
+		for key, value := range dict.shards[cursor] {
+			f(key, value)
+			visited++
+		}
+	}
+	return 0
+}
+
 // ShardCount 返回指定分片中的键值对数量
 func (dict *Dict) ShardCount(shardSeq int) int {
 	return len(dict.shards[shardSeq])
@@ -3,6 +3,7 @@ package structure
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
 	"testing"
 )
 
@@ -102,7 +103,7 @@ func TestDictTTL(t *testing.T) {
 	ttl.Set("k1", Int64(0))
 
 	dict.Set("k2", Int64(2))
-	ttl.Set("k2", Int64(global.Now.Unix()+10))
+	ttl.Set("k2", Int64(global.Now().Unix()+10))
 
 	dict.Set("k3", Int64(3))
 
@@ -142,4 +143,27 @@ func TestDictRandom(t *testing.T) {
 		{"k1": Int64(1), "k2": Int64(2), "k3": Int64(3)},
 	}, []map[string]Object{dict.Random(100)})
 
+	// 多分片时采样数量应该严格等于 num
+	dict = NewDict(16)
+	for i := 0; i < 1000; i++ {
+		dict.Set(strconv.Itoa(i), Int64(i))
+	}
+	assert.Equal(t, 20, len(dict.Random(20)))
+	assert.Equal(t, 20, len(dict.Sample(20)))
+
+	// 键值对分布不均匀时每一个键被选中的次数应该接近
+	dict = NewDict(16)
+	for i := 0; i < 10; i++ {
+		dict.Set(strconv.Itoa(i), Int64(i))
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 20000; i++ {
+		for key := range dict.Random(1) {
+			counts[key]++
+		}
+	}
+	assert.Len(t, counts, 10)
+	for _, count := range counts {
+		assert.InDelta(t, 2000, count, 300)
+	}
 }
@@ -0,0 +1,121 @@
+package structure
+
+import "strconv"
+
+// 紧凑编码的阈值，元素数量以及元素长度均不超过阈值时，集合类型使用紧凑编码，与 rdb 文件中的编码方式保持一致
+var (
+	ListpackMaxEntries = 128 // listpack 编码的最大元素数量
+	ListpackMaxValue   = 64  // listpack 编码的最大元素长度
+	IntsetMaxEntries   = 512 // intset 编码的最大元素数量
+)
+
+// embstrMaxLen 是 embstr 编码的最大长度
+const embstrMaxLen = 44
+
+// Encoding 返回对象的编码方式
+func Encoding(obj Object) string {
+
+	switch v := obj.(type) {
+
+	case Slice:
+		if _, ok := IsInteger(v); ok {
+			return "int"
+		}
+		if len(v) <= embstrMaxLen {
+			return "embstr"
+		}
+		return "raw"
+
+	case *List:
+		if v.Size() <= ListpackMaxEntries && listFitsListpack(v) {
+			return "listpack"
+		}
+		return "quicklist"
+
+	case *Set:
+		if v.Size() > IntsetMaxEntries && v.Size() > ListpackMaxEntries {
+			return "hashtable"
+		}
+		members, n := v.Keys("")
+		if n <= IntsetMaxEntries && allIntegers(members) {
+			return "intset"
+		}
+		if n <= ListpackMaxEntries && allShorterThan(members, ListpackMaxValue) {
+			return "listpack"
+		}
+		return "hashtable"
+
+	case *ZSet:
+		if v.Size() <= ListpackMaxEntries && zsetFitsListpack(v) {
+			return "listpack"
+		}
+		return "skiplist"
+
+	case *Dict:
+		if v.Size() <= ListpackMaxEntries && dictFitsListpack(v) {
+			return "listpack"
+		}
+		return "hashtable"
+
+	case *Hash:
+		return Encoding(v.Dict)
+
+	case *Stream:
+		return "stream"
+	}
+
+	return "unknown"
+}
+
+func listFitsListpack(list *List) bool {
+	values, _ := list.Range(0, -1)
+	for _, value := range values {
+		if s, ok := value.(Slice); ok && len(s) > ListpackMaxValue {
+			return false
+		}
+	}
+	return true
+}
+
+func zsetFitsListpack(zset *ZSet) bool {
+	members, _ := zset.Pos(0, -1)
+	for _, member := range members {
+		if s, ok := member.(String); ok && len(s) > ListpackMaxValue {
+			return false
+		}
+	}
+	return true
+}
+
+func dictFitsListpack(dict *Dict) bool {
+	kvs, _ := dict.GetAll()
+	for _, kv := range kvs {
+		for k, v := range kv {
+			if len(k) > ListpackMaxValue {
+				return false
+			}
+			if s, ok := v.(Slice); ok && len(s) > ListpackMaxValue {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func allIntegers(members []string) bool {
+	for _, member := range members {
+		if _, err := strconv.ParseInt(member, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func allShorterThan(members []string, max int) bool {
+	for _, member := range members {
+		if len(member) > max {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package structure
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+
+	assert.Equal(t, "embstr", Encoding(Slice("v")))
+	assert.Equal(t, "int", Encoding(Slice("-123")))
+	assert.Equal(t, "embstr", Encoding(Slice("+123")))
+	assert.Equal(t, "embstr", Encoding(Slice("99999999999999999999")))
+	assert.Equal(t, "raw", Encoding(Slice(strings.Repeat("v", 45))))
+
+	list := NewList()
+	list.PushBack(Slice("v"))
+	assert.Equal(t, "listpack", Encoding(list))
+	list.PushBack(Slice(strings.Repeat("v", ListpackMaxValue+1)))
+	assert.Equal(t, "quicklist", Encoding(list))
+
+	set := NewSet()
+	for i := 0; i < IntsetMaxEntries; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+	assert.Equal(t, "intset", Encoding(set))
+	set.Add("member")
+	assert.Equal(t, "hashtable", Encoding(set))
+
+	small := NewSet()
+	small.Add("member")
+	assert.Equal(t, "listpack", Encoding(small))
+
+	zset := NewZSet()
+	zset.Add(1, "member")
+	assert.Equal(t, "listpack", Encoding(zset))
+	for i := 0; i < ListpackMaxEntries; i++ {
+		zset.Add(Float32(i), strconv.Itoa(i))
+	}
+	assert.Equal(t, "skiplist", Encoding(zset))
+
+	hash := NewDict(1)
+	hash.Set("field", Slice("v"))
+	assert.Equal(t, "listpack", Encoding(hash))
+	hash.Set("long", Slice(strings.Repeat("v", ListpackMaxValue+1)))
+	assert.Equal(t, "hashtable", Encoding(hash))
+}
@@ -0,0 +1,168 @@
+package structure
+
+import "encoding/binary"
+
+// fieldTTLCost 是每一个 field 过期时间的大致内存占用
+const fieldTTLCost = 16
+
+// Hash 是 hash 类型的值，在 Dict 的基础上记录每一个 field 的过期时间
+type Hash struct {
+	*Dict
+	fieldTTL map[string]int64 // field 的过期时间，只在设置了过期时间后创建
+	ttlCost  int64            // 过期时间消耗的内存
+}
+
+// NewHash 创建一个空的 Hash 并返回指针
+func NewHash() *Hash {
+	return &Hash{Dict: NewDict(1)}
+}
+
+// Set 设置 field 的值，覆盖已经存在的 field 时会删除其过期时间
+func (hash *Hash) Set(field string, value Object) bool {
+	hash.RemoveFieldTTL(field)
+	return hash.Dict.Set(field, value)
+}
+
+// SetIfExist 只在 field 存在时设置 field 的值，并删除其过期时间
+func (hash *Hash) SetIfExist(field string, value Object) bool {
+	if !hash.Dict.SetIfExist(field, value) {
+		return false
+	}
+	hash.RemoveFieldTTL(field)
+	return true
+}
+
+// Update 与 Set 相同
+func (hash *Hash) Update(field string, value Object) bool {
+	return hash.Set(field, value)
+}
+
+// Delete 删除 field 及其过期时间，field 不存在时返回 false
+func (hash *Hash) Delete(field string) bool {
+	hash.RemoveFieldTTL(field)
+	return hash.Dict.Delete(field)
+}
+
+// DeleteGet 删除 field 及其过期时间，并返回 field 的值
+func (hash *Hash) DeleteGet(field string) Object {
+	hash.RemoveFieldTTL(field)
+	return hash.Dict.DeleteGet(field)
+}
+
+// Clear 删除全部 field 以及过期时间
+func (hash *Hash) Clear() {
+	hash.Dict.Clear()
+	hash.fieldTTL = nil
+	hash.ttlCost = 0
+}
+
+func (hash *Hash) Cost() int64 {
+	return hash.Dict.Cost() + hash.ttlCost
+}
+
+// clone 返回 Hash 的深拷贝
+func (hash *Hash) clone() *Hash {
+	c := &Hash{Dict: hash.Dict.clone(), ttlCost: hash.ttlCost}
+	if hash.fieldTTL != nil {
+		c.fieldTTL = make(map[string]int64, len(hash.fieldTTL))
+		for k, v := range hash.fieldTTL {
+			c.fieldTTL[k] = v
+		}
+	}
+	return c
+}
+
+// SetFieldTTL 设置 field 的过期时间，ttl 为 unix 时间戳。field 不存在时返回 false
+func (hash *Hash) SetFieldTTL(field string, ttl int64) bool {
+	if !hash.Exist(field) {
+		return false
+	}
+	if hash.fieldTTL == nil {
+		hash.fieldTTL = make(map[string]int64)
+	}
+	if _, exist := hash.fieldTTL[field]; !exist {
+		hash.ttlCost += int64(len(field)) + fieldTTLCost
+	}
+	hash.fieldTTL[field] = ttl
+	return true
+}
+
+// FieldTTL 返回 field 的过期时间，没有设置过期时间时返回 false
+func (hash *Hash) FieldTTL(field string) (int64, bool) {
+	ttl, exist := hash.fieldTTL[field]
+	return ttl, exist
+}
+
+// RemoveFieldTTL 删除 field 的过期时间，没有设置过期时间时返回 false
+func (hash *Hash) RemoveFieldTTL(field string) bool {
+	if _, exist := hash.fieldTTL[field]; !exist {
+		return false
+	}
+	delete(hash.fieldTTL, field)
+	hash.ttlCost -= int64(len(field)) + fieldTTLCost
+	return true
+}
+
+// HasFieldTTL 判断是否存在设置了过期时间的 field
+func (hash *Hash) HasFieldTTL() bool {
+	return len(hash.fieldTTL) > 0
+}
+
+// ExpireFields 删除过期时间不晚于 now 的 field，返回删除的 field
+func (hash *Hash) ExpireFields(now int64) []string {
+	deleted := make([]string, 0)
+	for field, ttl := range hash.fieldTTL {
+		if ttl <= now {
+			hash.Delete(field)
+			deleted = append(deleted, field)
+		}
+	}
+	return deleted
+}
+
+// HasExpiredField 判断是否存在过期时间不晚于 now 的 field
+func (hash *Hash) HasExpiredField(now int64) bool {
+	for _, ttl := range hash.fieldTTL {
+		if ttl <= now {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal 将 Hash 中的 field、值以及过期时间序列化为字节数组，可以通过 UnmarshalHash 还原
+func (hash *Hash) Marshal() []byte {
+
+	buf := binary.AppendUvarint(nil, uint64(hash.Size()))
+
+	kvs, _ := hash.GetAll()
+	for _, kv := range kvs {
+		for field, value := range kv {
+			ttl, _ := hash.FieldTTL(field)
+			buf = appendStreamBytes(buf, []byte(field))
+			buf = appendStreamBytes(buf, value.(Slice))
+			buf = binary.AppendVarint(buf, ttl)
+		}
+	}
+	return buf
+}
+
+// UnmarshalHash 解析 Marshal 序列化的数据，数据不完整时返回错误
+func UnmarshalHash(data []byte) (*Hash, error) {
+
+	r := &streamReader{data: data}
+	hash := NewHash()
+
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		field := string(r.bytes())
+		hash.Set(field, Slice(r.bytes()))
+		if ttl := r.int(); ttl > 0 {
+			hash.SetFieldTTL(field, ttl)
+		}
+	}
+
+	if r.err != nil || len(r.data) != 0 {
+		return nil, errBadPayload
+	}
+	return hash, nil
+}
@@ -0,0 +1,61 @@
+package structure
+
+import "strconv"
+
+// sharedIntegers 是共享整数的数量，与 redis 相同，[0, sharedIntegers) 之间的整数值共用同一个 Slice
+const sharedIntegers = 10000
+
+var shared = func() []Slice {
+	s := make([]Slice, sharedIntegers)
+	for i := range s {
+		v := strconv.Itoa(i)
+		// 容量与长度相同，追加内容时一定会重新分配内存
+		s[i] = Slice(v)[:len(v):len(v)]
+	}
+	return s
+}()
+
+// IsInteger 判断 Slice 是否为 64 位整数的标准十进制表示，即没有前导零、正号以及空白字符
+func IsInteger(s Slice) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(s), 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != string(s) {
+		return 0, false
+	}
+	return n, true
+}
+
+// IntegerSlice 返回整数的十进制表示，较小的非负整数会返回共享的 Slice
+func IntegerSlice(n int64) Slice {
+	if n >= 0 && n < sharedIntegers {
+		return shared[n]
+	}
+	return strconv.AppendInt(nil, n, 10)
+}
+
+// ShareInteger 在 s 为较小的非负整数时返回共享的 Slice，否则返回 s 本身
+func ShareInteger(s Slice) Slice {
+	if len(s) > 4 {
+		return s
+	}
+	if n, ok := IsInteger(s); ok && n >= 0 && n < sharedIntegers {
+		return shared[n]
+	}
+	return s
+}
+
+// IsShared 判断 s 是否为共享的整数
+func IsShared(s Slice) bool {
+	n, ok := IsInteger(s)
+	return ok && n >= 0 && n < sharedIntegers && &s[0] == &shared[n][0]
+}
+
+// Unshare 在原地修改 Slice 之前调用，共享的整数会被复制，其他的 Slice 直接返回
+func Unshare(s Slice) Slice {
+	if len(s) > 0 && len(s) <= 4 && IsShared(s) {
+		return append(Slice{}, s...)
+	}
+	return s
+}
@@ -0,0 +1,118 @@
+package structure
+
+import "unsafe"
+
+const (
+	// stringHeaderCost 是 string 以及 []byte 头部的大小
+	stringHeaderCost = int64(unsafe.Sizeof(""))
+	// sliceHeaderCost 是切片头部的大小
+	sliceHeaderCost = int64(unsafe.Sizeof([]byte{}))
+	// interfaceCost 是接口值的大小
+	interfaceCost = int64(unsafe.Sizeof(Object(nil)))
+	// MapEntryCost 是哈希表中每个键值对除键值本身之外的额外开销，包含键的 string 头部，值的接口以及桶中的 tophash
+	MapEntryCost = stringHeaderCost + interfaceCost + 8
+)
+
+// DefaultMemorySamples 是估算集合类型内存占用时默认的采样数量
+const DefaultMemorySamples = 5
+
+// MemoryUsage 估算对象占用的内存大小。对于集合类型，会采样 samples 个元素计算平均大小再乘以元素数量，
+// samples 为 0 时会遍历全部元素
+func MemoryUsage(obj Object, samples int) int64 {
+
+	switch v := obj.(type) {
+
+	case Slice:
+		return sliceHeaderCost + int64(len(v))
+
+	case String:
+		return stringHeaderCost + int64(len(v))
+
+	case *Dict:
+		return dictMemoryUsage(v, samples)
+
+	case *Hash:
+		return dictMemoryUsage(v.Dict, samples) + v.ttlCost
+
+	case *Set:
+		return setBasicCost + dictMemoryUsage(v.dict, samples)
+
+	case *ZSet:
+		return dictMemoryUsage(v.dict, samples) + skipListMemoryUsage(v.skipList, samples)
+
+	case *List:
+		return listMemoryUsage(v, samples)
+	}
+
+	return obj.Cost()
+}
+
+// extrapolate 根据采样得到的总大小推算全部元素的大小
+func extrapolate(sampled int64, sampledNum, total int) int64 {
+	if sampledNum == 0 {
+		return 0
+	}
+	if sampledNum == total {
+		return sampled
+	}
+	return sampled / int64(sampledNum) * int64(total)
+}
+
+func dictMemoryUsage(dict *Dict, samples int) int64 {
+
+	usage := dictBasicCost + shardBasicCost*int64(dict.size)
+
+	entryCost := func(key string, value Object) int64 {
+		return MapEntryCost + int64(len(key)) + MemoryUsage(value, samples)
+	}
+
+	var sampled int64
+	n := 0
+
+	if samples <= 0 || samples >= dict.count {
+		for _, shard := range dict.shards {
+			for key, value := range shard {
+				sampled += entryCost(key, value)
+				n++
+			}
+		}
+	} else {
+		for key, value := range dict.Sample(samples) {
+			sampled += entryCost(key, value)
+			n++
+		}
+	}
+
+	return usage + extrapolate(sampled, n, dict.count)
+}
+
+func skipListMemoryUsage(sl *SkipList, samples int) int64 {
+
+	usage := skipListBasicCost + int64(sl.level)*8
+
+	var sampled int64
+	n := 0
+
+	for node := sl.head.next[0]; node != nil && (samples <= 0 || n < samples); node = node.next[0] {
+		// 节点结构体，每一层的前向指针以及值
+		sampled += skipListNodeBasicCost + int64(node.height)*8 + MemoryUsage(node.value, samples)
+		n++
+	}
+
+	return usage + extrapolate(sampled, n, sl.size)
+}
+
+func listMemoryUsage(list *List, samples int) int64 {
+
+	usage := listBasicCost
+
+	var sampled int64
+	n := 0
+
+	for node := list.FrontNode(); node != nil && (samples <= 0 || n < samples); node = node.Next() {
+		sampled += int64(unsafe.Sizeof(ListNode{})) + MemoryUsage(node.Value, samples)
+		n++
+	}
+
+	return usage + extrapolate(sampled, n, list.size)
+}
@@ -0,0 +1,57 @@
+package structure
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMemoryUsage(t *testing.T) {
+
+	// 估算值随字符串长度增长
+	small := MemoryUsage(Slice("v"), DefaultMemorySamples)
+	large := MemoryUsage(Slice(strings.Repeat("v", 1000)), DefaultMemorySamples)
+	assert.Equal(t, int64(999), large-small)
+
+	// 集合类型的估算值随元素数量增长
+	list := NewList()
+	set := NewSet()
+	zset := NewZSet()
+	prev := []int64{MemoryUsage(list, 0), MemoryUsage(set, 0), MemoryUsage(zset, 0)}
+	for i := 0; i < 10; i++ {
+		list.PushBack(Slice("value" + strconv.Itoa(i)))
+		set.Add("member" + strconv.Itoa(i))
+		zset.Add(Float32(i), "member"+strconv.Itoa(i))
+
+		cur := []int64{MemoryUsage(list, 0), MemoryUsage(set, 0), MemoryUsage(zset, 0)}
+		for j := range cur {
+			assert.Greater(t, cur[j], prev[j])
+		}
+		prev = cur
+	}
+}
+
+func TestMemoryUsageSamples(t *testing.T) {
+
+	hash := NewDict(1)
+	for i := 0; i < 10000; i++ {
+		hash.Set("field"+strconv.Itoa(i), Slice(strings.Repeat("v", 100)))
+	}
+
+	exact := MemoryUsage(hash, 0)
+	sampled := MemoryUsage(hash, DefaultMemorySamples)
+
+	// 所有字段大小相近，采样估算的误差应当很小
+	assert.InEpsilon(t, exact, sampled, 0.05)
+
+	// 采样数量超过元素数量时等价于精确计算
+	assert.Equal(t, exact, MemoryUsage(hash, 20000))
+
+	// 更大的值会得到更大的估算结果
+	bigger := NewDict(1)
+	for i := 0; i < 10000; i++ {
+		bigger.Set("field"+strconv.Itoa(i), Slice(strings.Repeat("v", 200)))
+	}
+	assert.Greater(t, MemoryUsage(bigger, DefaultMemorySamples), sampled)
+}
@@ -0,0 +1,67 @@
+package structure
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// random 是随机命令使用的随机数生成器。默认使用时间作为种子，并且依赖 map 的遍历顺序选取元素；
+// 设置了固定的随机源之后按照字典序选取元素，使 RANDOMKEY、SPOP、SRANDMEMBER、HRANDFIELD 等命令的结果可以复现
+var random = struct {
+	mu    sync.Mutex
+	r     *rand.Rand
+	fixed bool
+}{r: rand.New(rand.NewSource(time.Now().UnixNano()))} //nolint:gosec
+
+// SetRandomSource 设置随机命令使用的随机源，source 为 nil 时恢复为使用时间作为种子的随机源
+func SetRandomSource(source rand.Source) {
+	random.mu.Lock()
+	defer random.mu.Unlock()
+
+	random.fixed = source != nil
+	if source == nil {
+		source = rand.NewSource(time.Now().UnixNano())
+	}
+	random.r = rand.New(source) //nolint:gosec
+}
+
+// randomIntn 返回 [0, n) 之间的随机数
+func randomIntn(n int) int {
+	random.mu.Lock()
+	defer random.mu.Unlock()
+	return random.r.Intn(n)
+}
+
+// randomFixed 返回是否设置了固定的随机源
+func randomFixed() bool {
+	random.mu.Lock()
+	defer random.mu.Unlock()
+	return random.fixed
+}
+
+// sortedKeys 按照字典序返回 Dict 中全部的键
+func (dict *Dict) sortedKeys() []string {
+	keys := make([]string, 0, dict.count)
+	for _, shard := range dict.shards {
+		for key := range shard {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// randomSorted 从按照字典序排列的键中不重复地选取 num 个键，选取结果只由随机源决定，复杂度为 O(n log n)
+func (dict *Dict) randomSorted(num int) []string {
+	keys := dict.sortedKeys()
+	if num > len(keys) {
+		num = len(keys)
+	}
+	for i := 0; i < num; i++ {
+		j := i + randomIntn(len(keys)-i)
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys[:num]
+}
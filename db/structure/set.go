@@ -29,6 +29,17 @@ func (set *Set) Exist(key string) bool {
 	return set.dict.Exist(key)
 }
 
+// Range 遍历集合中的所有键，f 返回 false 时停止遍历，遍历期间不能修改集合
+func (set *Set) Range(f func(key string) bool) {
+	for _, shard := range set.dict.shards {
+		for key := range shard {
+			if !f(key) {
+				return
+			}
+		}
+	}
+}
+
 // Size 返回集合键数量
 func (set *Set) Size() int {
 	return set.dict.count
@@ -63,6 +74,21 @@ func (set *Set) RandomGet(nums int) map[string]struct{} {
 	return keys
 }
 
+// RandomGetRepeatable 随机获取集合中指定数量的键，返回的键可能重复
+func (set *Set) RandomGetRepeatable(nums int) []string {
+	keys := make([]string, 0, nums)
+	if set.dict.Empty() {
+		return keys
+	}
+
+	for len(keys) < nums {
+		for key := range set.dict.Random(1) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 // RandomPop 随机删除集合中指定数量的键，返回被删除的键
 func (set *Set) RandomPop(nums int) map[string]struct{} {
 	if set.dict.Empty() {
@@ -59,7 +59,7 @@ func TestSet(t *testing.T) {
 	assert.Equal(t, 2, n)
 	assert.Subset(t, keys, ks)
 
-	ks, n = set.Keys(".*")
+	ks, n = set.Keys("*")
 	assert.Equal(t, 2, n)
 	assert.Subset(t, keys, ks)
 
@@ -67,7 +67,21 @@ func TestSet(t *testing.T) {
 	assert.Equal(t, 0, n)
 
 	keysb := [][]byte{[]byte("k1"), []byte("k2"), []byte("k3"), []byte("k4")}
-	ksb, n := set.KeysByte(".*")
+	ksb, n := set.KeysByte("*")
 	assert.Equal(t, 2, n)
 	assert.Subset(t, keysb, ksb)
+	// Range 在 f 返回 false 时停止遍历
+	visited := make([]string, 0)
+	set.Range(func(key string) bool {
+		visited = append(visited, key)
+		return true
+	})
+	ks, _ = set.Keys("")
+	assert.ElementsMatch(t, ks, visited)
+	calls := 0
+	set.Range(func(string) bool {
+		calls++
+		return false
+	})
+	assert.Equal(t, 1, calls)
 }
@@ -0,0 +1,542 @@
+package structure
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const streamBasicCost = int64(unsafe.Sizeof(Stream{}))
+const streamEntryBasicCost = int64(unsafe.Sizeof(StreamEntry{}))
+
+// StreamID 是 Stream 中消息的唯一标识，由毫秒时间戳和序列号组成
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MinStreamID 与 MaxStreamID 分别代表 "-" 与 "+"
+var (
+	MinStreamID = StreamID{0, 0}
+	MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+)
+
+// ParseStreamID 解析 "ms-seq" 或 "ms" 格式的 id，若只给出 ms，seq 将被设置为 defaultSeq
+func ParseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+
+	ms, seq, found := strings.Cut(s, "-")
+
+	msVal, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return StreamID{}, errors.New("ERR Invalid stream ID specified as stream command argument")
+	}
+	if !found {
+		return StreamID{msVal, defaultSeq}, nil
+	}
+
+	seqVal, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return StreamID{}, errors.New("ERR Invalid stream ID specified as stream command argument")
+	}
+	return StreamID{msVal, seqVal}, nil
+}
+
+// Less 判断 id 是否小于 other
+func (id StreamID) Less(other StreamID) bool {
+	if id.Ms == other.Ms {
+		return id.Seq < other.Seq
+	}
+	return id.Ms < other.Ms
+}
+
+// Equal 判断两个 id 是否相等
+func (id StreamID) Equal(other StreamID) bool {
+	return id.Ms == other.Ms && id.Seq == other.Seq
+}
+
+// IsZero 判断 id 是否为 0-0
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// StreamEntry 是 Stream 中的一条消息
+type StreamEntry struct {
+	ID     StreamID
+	Fields [][]byte // field value 交替存储
+}
+
+func (entry *StreamEntry) Cost() int64 {
+	cost := streamEntryBasicCost
+	for _, f := range entry.Fields {
+		cost += int64(len(f)) + 24
+	}
+	return cost
+}
+
+// Stream 是一个只允许追加的消息队列，消息按照 id 严格递增的顺序存储，因此可以使用二分查找进行范围查询
+type Stream struct {
+	entries []*StreamEntry
+	lastID  StreamID // 最后一次写入的 id，删除消息后仍然保留
+	cost    int64
+	groups  map[string]*StreamGroup // 消费者组
+}
+
+// NewStream 创建一个 Stream 并返回指针
+func NewStream() *Stream {
+	return &Stream{
+		entries: make([]*StreamEntry, 0),
+		cost:    streamBasicCost,
+	}
+}
+
+// LastID 返回最后一次写入的 id
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// NextID 根据毫秒时间戳生成一个新的 id，当时钟回退或同一毫秒内多次写入时会递增序列号
+func (s *Stream) NextID(ms uint64) StreamID {
+	if ms > s.lastID.Ms {
+		return StreamID{ms, 0}
+	}
+	if s.lastID.Seq == math.MaxUint64 {
+		return StreamID{s.lastID.Ms + 1, 0}
+	}
+	return StreamID{s.lastID.Ms, s.lastID.Seq + 1}
+}
+
+// NextSeqID 生成指定毫秒时间戳下的下一个 id，用于 "ms-*" 格式，如果无法生成返回 false
+func (s *Stream) NextSeqID(ms uint64) (StreamID, bool) {
+	if ms > s.lastID.Ms {
+		if ms == 0 {
+			return StreamID{0, 1}, true
+		}
+		return StreamID{ms, 0}, true
+	}
+	if ms < s.lastID.Ms || s.lastID.Seq == math.MaxUint64 {
+		return StreamID{}, false
+	}
+	return StreamID{ms, s.lastID.Seq + 1}, true
+}
+
+// Append 追加一条消息，id 必须大于最后一次写入的 id，否则返回 false
+func (s *Stream) Append(id StreamID, fields [][]byte) bool {
+	if !s.lastID.Less(id) {
+		return false
+	}
+	entry := &StreamEntry{ID: id, Fields: fields}
+	s.entries = append(s.entries, entry)
+	s.lastID = id
+	s.cost += entry.Cost() + 8
+	return true
+}
+
+// Size 返回 Stream 中的消息数量
+func (s *Stream) Size() int {
+	return len(s.entries)
+}
+
+// search 返回第一个 id >= target 的消息下标
+func (s *Stream) search(target StreamID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].ID.Less(target)
+	})
+}
+
+// Range 返回 id 位于 [start, end] 之间的消息，count <= 0 代表不限制数量
+func (s *Stream) Range(start, end StreamID, count int) []*StreamEntry {
+
+	if end.Less(start) {
+		return []*StreamEntry{}
+	}
+
+	res := make([]*StreamEntry, 0)
+	for i := s.search(start); i < len(s.entries); i++ {
+		if end.Less(s.entries[i].ID) || (count > 0 && len(res) >= count) {
+			break
+		}
+		res = append(res, s.entries[i])
+	}
+	return res
+}
+
+// After 返回 id 严格大于 start 的消息，count <= 0 代表不限制数量
+func (s *Stream) After(start StreamID, count int) []*StreamEntry {
+
+	res := make([]*StreamEntry, 0)
+	for i := s.search(start); i < len(s.entries); i++ {
+		if s.entries[i].ID.Equal(start) {
+			continue
+		}
+		if count > 0 && len(res) >= count {
+			break
+		}
+		res = append(res, s.entries[i])
+	}
+	return res
+}
+
+func (s *Stream) Cost() int64 {
+	cost := s.cost
+	for _, g := range s.groups {
+		cost += g.cost
+	}
+	return cost
+}
+
+// Get 返回指定 id 的消息，如果不存在返回 nil
+func (s *Stream) Get(id StreamID) *StreamEntry {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID.Equal(id) {
+		return s.entries[i]
+	}
+	return nil
+}
+
+// CreateGroup 创建一个消费者组，组内从 id 之后的消息开始投递，如果组已经存在返回 false
+func (s *Stream) CreateGroup(name string, id StreamID) bool {
+	if s.groups == nil {
+		s.groups = make(map[string]*StreamGroup)
+	}
+	if _, exist := s.groups[name]; exist {
+		return false
+	}
+	s.groups[name] = newStreamGroup(name, id)
+	return true
+}
+
+// DestroyGroup 删除一个消费者组，如果组不存在返回 false
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, exist := s.groups[name]; !exist {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Group 返回指定名称的消费者组
+func (s *Stream) Group(name string) (*StreamGroup, bool) {
+	g, exist := s.groups[name]
+	return g, exist
+}
+
+// clone 返回 Stream 的深拷贝，消息本身不会被修改，因此与原 Stream 共享
+func (s *Stream) clone() *Stream {
+	c := &Stream{
+		entries: make([]*StreamEntry, len(s.entries)),
+		lastID:  s.lastID,
+		cost:    s.cost,
+	}
+	copy(c.entries, s.entries)
+	if s.groups != nil {
+		c.groups = make(map[string]*StreamGroup, len(s.groups))
+		for name, g := range s.groups {
+			c.groups[name] = g.clone()
+		}
+	}
+	return c
+}
+
+// StreamPending 是消费者组中一条已投递但未确认的消息
+type StreamPending struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  int64 // 最后一次投递的毫秒时间戳
+	DeliveryCount int
+}
+
+const streamPendingCost = int64(unsafe.Sizeof(StreamPending{})) + 16
+
+// StreamConsumer 是消费者组中的一个消费者，记录该消费者的待确认列表
+type StreamConsumer struct {
+	Name    string
+	pending map[StreamID]*StreamPending
+}
+
+// Pending 按照 id 递增的顺序返回消费者待确认列表中 id 大于 start 的消息，count <= 0 代表不限制数量
+func (c *StreamConsumer) Pending(start StreamID, count int) []*StreamPending {
+	res := make([]*StreamPending, 0, len(c.pending))
+	for id, p := range c.pending {
+		if start.Less(id) {
+			res = append(res, p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID.Less(res[j].ID)
+	})
+	if count > 0 && len(res) > count {
+		res = res[:count]
+	}
+	return res
+}
+
+// StreamGroup 是 Stream 的消费者组，组内的每条消息只会投递给一个消费者
+type StreamGroup struct {
+	Name          string
+	lastDelivered StreamID                    // 最后一次投递给组内消费者的 id
+	pel           map[StreamID]*StreamPending // 组内所有待确认消息
+	consumers     map[string]*StreamConsumer
+	cost          int64
+}
+
+func newStreamGroup(name string, id StreamID) *StreamGroup {
+	return &StreamGroup{
+		Name:          name,
+		lastDelivered: id,
+		pel:           make(map[StreamID]*StreamPending),
+		consumers:     make(map[string]*StreamConsumer),
+		cost:          int64(len(name)),
+	}
+}
+
+// clone 返回消费者组的深拷贝，消费者的待确认列表与组的待确认列表共享同一份 StreamPending
+func (g *StreamGroup) clone() *StreamGroup {
+	c := newStreamGroup(g.Name, g.lastDelivered)
+	c.cost = g.cost
+	for id, p := range g.pel {
+		pending := *p
+		c.pel[id] = &pending
+	}
+	for name, consumer := range g.consumers {
+		cc := &StreamConsumer{Name: name, pending: make(map[StreamID]*StreamPending, len(consumer.pending))}
+		for id := range consumer.pending {
+			cc.pending[id] = c.pel[id]
+		}
+		c.consumers[name] = cc
+	}
+	return c
+}
+
+// Consumer 返回指定名称的消费者，如果不存在将会创建
+func (g *StreamGroup) Consumer(name string) *StreamConsumer {
+	c, exist := g.consumers[name]
+	if !exist {
+		c = &StreamConsumer{Name: name, pending: make(map[StreamID]*StreamPending)}
+		g.consumers[name] = c
+		g.cost += int64(len(name)) + 16
+	}
+	return c
+}
+
+// ReadNew 将 Stream 中尚未投递给本组的消息投递给 consumer，noAck 为 true 时不会加入待确认列表
+func (g *StreamGroup) ReadNew(s *Stream, consumer string, count int, now int64, noAck bool) []*StreamEntry {
+
+	c := g.Consumer(consumer)
+
+	entries := s.After(g.lastDelivered, count)
+	for _, entry := range entries {
+		g.lastDelivered = entry.ID
+		if noAck {
+			continue
+		}
+		p := &StreamPending{ID: entry.ID, Consumer: consumer, DeliveryTime: now, DeliveryCount: 1}
+		g.pel[entry.ID] = p
+		c.pending[entry.ID] = p
+		g.cost += streamPendingCost
+	}
+	return entries
+}
+
+// ReadPending 重新读取 consumer 待确认列表中 id 大于 start 的消息，并增加投递次数
+func (g *StreamGroup) ReadPending(s *Stream, consumer string, start StreamID, count int, now int64) []*StreamEntry {
+
+	c := g.Consumer(consumer)
+
+	pending := c.Pending(start, count)
+	entries := make([]*StreamEntry, len(pending))
+	for i, p := range pending {
+		p.DeliveryTime = now
+		p.DeliveryCount++
+		if entry := s.Get(p.ID); entry != nil {
+			entries[i] = entry
+		} else {
+			// 消息已经被删除，只返回 id
+			entries[i] = &StreamEntry{ID: p.ID}
+		}
+	}
+	return entries
+}
+
+// Ack 确认消息并将其从待确认列表中移除，返回成功确认的数量
+func (g *StreamGroup) Ack(ids ...StreamID) int {
+	acked := 0
+	for _, id := range ids {
+		p, exist := g.pel[id]
+		if !exist {
+			continue
+		}
+		delete(g.pel, id)
+		if c, ok := g.consumers[p.Consumer]; ok {
+			delete(c.pending, id)
+		}
+		g.cost -= streamPendingCost
+		acked++
+	}
+	return acked
+}
+
+// PendingSize 返回组内待确认消息的数量
+func (g *StreamGroup) PendingSize() int {
+	return len(g.pel)
+}
+
+// LastDelivered 返回最后一次投递的 id
+func (g *StreamGroup) LastDelivered() StreamID {
+	return g.lastDelivered
+}
+
+// errBadPayload 是 stream 以及 hash 的序列化数据无法解析时返回的错误
+var errBadPayload = errors.New("bad payload")
+
+// Marshal 将 Stream 中的消息、最后写入的 id 以及消费者组序列化为字节数组，可以通过 UnmarshalStream 还原
+func (s *Stream) Marshal() []byte {
+
+	buf := appendStreamID(nil, s.lastID)
+
+	buf = binary.AppendUvarint(buf, uint64(len(s.entries)))
+	for _, entry := range s.entries {
+		buf = appendStreamID(buf, entry.ID)
+		buf = binary.AppendUvarint(buf, uint64(len(entry.Fields)))
+		for _, f := range entry.Fields {
+			buf = appendStreamBytes(buf, f)
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(s.groups)))
+	for _, g := range s.groups {
+		buf = appendStreamBytes(buf, []byte(g.Name))
+		buf = appendStreamID(buf, g.lastDelivered)
+
+		// 没有待确认消息的消费者同样需要保存
+		buf = binary.AppendUvarint(buf, uint64(len(g.consumers)))
+		for name := range g.consumers {
+			buf = appendStreamBytes(buf, []byte(name))
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(len(g.pel)))
+		for _, p := range g.pel {
+			buf = appendStreamID(buf, p.ID)
+			buf = appendStreamBytes(buf, []byte(p.Consumer))
+			buf = binary.AppendVarint(buf, p.DeliveryTime)
+			buf = binary.AppendUvarint(buf, uint64(p.DeliveryCount))
+		}
+	}
+	return buf
+}
+
+// UnmarshalStream 解析 Marshal 序列化的数据，数据不完整时返回错误
+func UnmarshalStream(data []byte) (*Stream, error) {
+
+	r := &streamReader{data: data}
+	s := NewStream()
+
+	lastID := r.id()
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		id := r.id()
+		fields := make([][]byte, r.count())
+		for i := range fields {
+			fields[i] = r.bytes()
+		}
+		if r.err == nil && !s.Append(id, fields) {
+			return nil, errBadPayload
+		}
+	}
+	s.lastID = lastID
+
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		name := string(r.bytes())
+		s.CreateGroup(name, r.id())
+		g := s.groups[name]
+
+		for m := r.count(); m > 0 && r.err == nil; m-- {
+			g.Consumer(string(r.bytes()))
+		}
+		for m := r.count(); m > 0 && r.err == nil; m-- {
+			p := &StreamPending{ID: r.id(), Consumer: string(r.bytes())}
+			p.DeliveryTime = r.int()
+			p.DeliveryCount = int(r.uint())
+			g.pel[p.ID] = p
+			g.Consumer(p.Consumer).pending[p.ID] = p
+			g.cost += streamPendingCost
+		}
+	}
+
+	if r.err != nil || len(r.data) != 0 {
+		return nil, errBadPayload
+	}
+	return s, nil
+}
+
+func appendStreamID(buf []byte, id StreamID) []byte {
+	buf = binary.AppendUvarint(buf, id.Ms)
+	return binary.AppendUvarint(buf, id.Seq)
+}
+
+func appendStreamBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// streamReader 用于解析 Stream 以及 Hash 的 Marshal 序列化的数据，出现错误后的读取都会返回零值
+type streamReader struct {
+	data []byte
+	err  error
+}
+
+func (r *streamReader) uint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errBadPayload
+		r.data = nil
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count 读取一个元素数量，每个元素至少占用一个字节，因此数量不会超过剩余数据的长度
+func (r *streamReader) count() uint64 {
+	n := r.uint()
+	if n > uint64(len(r.data)) {
+		r.err = errBadPayload
+		r.data = nil
+		return 0
+	}
+	return n
+}
+
+func (r *streamReader) int() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errBadPayload
+		r.data = nil
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *streamReader) id() StreamID {
+	return StreamID{r.uint(), r.uint()}
+}
+
+func (r *streamReader) bytes() []byte {
+	n := r.uint()
+	if n > uint64(len(r.data)) {
+		r.err = errBadPayload
+		r.data = nil
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data)
+	r.data = r.data[n:]
+	return b
+}
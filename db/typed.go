@@ -0,0 +1,124 @@
+package db
+
+import (
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/server/global"
+)
+
+// GetString 返回键对应的字符串，键不存在或者已经过期时 exist 为 false，值不是字符串时返回 global.ErrWrongType
+func (db_ *DataBase) GetString(key string) (value structure.Slice, exist bool, err error) {
+	v, ok := db_.GetKey(key)
+	if !ok {
+		return nil, false, nil
+	}
+	value, ok = v.(structure.Slice)
+	if !ok {
+		return nil, true, global.ErrWrongType
+	}
+	return value, true, nil
+}
+
+// GetList 返回键对应的链表，键不存在时返回 nil，值不是链表时返回 global.ErrWrongType
+func (db_ *DataBase) GetList(key string) (*structure.List, error) {
+	v, ok := db_.GetKey(key)
+	if !ok {
+		return nil, nil
+	}
+	value, ok := v.(*structure.List)
+	if !ok {
+		return nil, global.ErrWrongType
+	}
+	return value, nil
+}
+
+// GetHash 返回键对应的哈希表，键不存在时返回 nil，值不是哈希表时返回 global.ErrWrongType
+func (db_ *DataBase) GetHash(key string) (*structure.Hash, error) {
+	v, ok := db_.GetKey(key)
+	if !ok {
+		return nil, nil
+	}
+	value, ok := v.(*structure.Hash)
+	if !ok {
+		return nil, global.ErrWrongType
+	}
+	return value, nil
+}
+
+// GetSet 返回键对应的集合，键不存在时返回 nil，值不是集合时返回 global.ErrWrongType
+func (db_ *DataBase) GetSet(key string) (*structure.Set, error) {
+	v, ok := db_.GetKey(key)
+	if !ok {
+		return nil, nil
+	}
+	value, ok := v.(*structure.Set)
+	if !ok {
+		return nil, global.ErrWrongType
+	}
+	return value, nil
+}
+
+// GetZSet 返回键对应的有序集合，键不存在时返回 nil，值不是有序集合时返回 global.ErrWrongType
+func (db_ *DataBase) GetZSet(key string) (*structure.ZSet, error) {
+	v, ok := db_.GetKey(key)
+	if !ok {
+		return nil, nil
+	}
+	value, ok := v.(*structure.ZSet)
+	if !ok {
+		return nil, global.ErrWrongType
+	}
+	return value, nil
+}
+
+// GetStream 返回键对应的 Stream，键不存在时返回 nil，值不是 Stream 时返回 global.ErrWrongType
+func (db_ *DataBase) GetStream(key string) (*structure.Stream, error) {
+	v, ok := db_.GetKey(key)
+	if !ok {
+		return nil, nil
+	}
+	value, ok := v.(*structure.Stream)
+	if !ok {
+		return nil, global.ErrWrongType
+	}
+	return value, nil
+}
+
+// GetOrCreateList 返回键对应的链表，键不存在时创建一个空链表并写入，值不是链表时返回 global.ErrWrongType
+func (db_ *DataBase) GetOrCreateList(key string) (*structure.List, error) {
+	value, err := db_.GetList(key)
+	if err == nil && value == nil {
+		value = structure.NewList()
+		db_.SetKey(key, value)
+	}
+	return value, err
+}
+
+// GetOrCreateHash 返回键对应的哈希表，键不存在时创建一个空哈希表并写入，值不是哈希表时返回 global.ErrWrongType
+func (db_ *DataBase) GetOrCreateHash(key string) (*structure.Hash, error) {
+	value, err := db_.GetHash(key)
+	if err == nil && value == nil {
+		value = structure.NewHash()
+		db_.SetKey(key, value)
+	}
+	return value, err
+}
+
+// GetOrCreateSet 返回键对应的集合，键不存在时创建一个空集合并写入，值不是集合时返回 global.ErrWrongType
+func (db_ *DataBase) GetOrCreateSet(key string) (*structure.Set, error) {
+	value, err := db_.GetSet(key)
+	if err == nil && value == nil {
+		value = structure.NewSet()
+		db_.SetKey(key, value)
+	}
+	return value, err
+}
+
+// GetOrCreateZSet 返回键对应的有序集合，键不存在时创建一个空有序集合并写入，值不是有序集合时返回 global.ErrWrongType
+func (db_ *DataBase) GetOrCreateZSet(key string) (*structure.ZSet, error) {
+	value, err := db_.GetZSet(key)
+	if err == nil && value == nil {
+		value = structure.NewZSet()
+		db_.SetKey(key, value)
+	}
+	return value, err
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/server/global"
+	"testing"
+)
+
+func TestDataBaseTypedGet(t *testing.T) {
+
+	db := NewDataBase(1)
+	db.SetKey("string", structure.Slice("v"))
+	db.SetKey("list", structure.NewList())
+	db.SetKey("hash", structure.NewHash())
+	db.SetKey("set", structure.NewSet())
+	db.SetKey("zset", structure.NewZSet())
+	db.SetKey("stream", structure.NewStream())
+	db.SetKeyWithTTL("expired", structure.NewList(), global.Now().Unix()-1)
+
+	s, exist, err := db.GetString("string")
+	assert.Equal(t, structure.Slice("v"), s)
+	assert.True(t, exist)
+	assert.Nil(t, err)
+	_, exist, err = db.GetString("none")
+	assert.False(t, exist)
+	assert.Nil(t, err)
+	_, exist, err = db.GetString("list")
+	assert.True(t, exist)
+	assert.Equal(t, global.ErrWrongType, err)
+
+	l, err := db.GetList("list")
+	assert.NotNil(t, l)
+	assert.Nil(t, err)
+	h, err := db.GetHash("hash")
+	assert.NotNil(t, h)
+	assert.Nil(t, err)
+	set, err := db.GetSet("set")
+	assert.NotNil(t, set)
+	assert.Nil(t, err)
+	z, err := db.GetZSet("zset")
+	assert.NotNil(t, z)
+	assert.Nil(t, err)
+	stream, err := db.GetStream("stream")
+	assert.NotNil(t, stream)
+	assert.Nil(t, err)
+
+	// 不存在以及已经过期的键返回 nil
+	for _, key := range []string{"none", "expired"} {
+		l, err = db.GetList(key)
+		assert.Nil(t, l)
+		assert.Nil(t, err)
+		h, err = db.GetHash(key)
+		assert.Nil(t, h)
+		assert.Nil(t, err)
+		set, err = db.GetSet(key)
+		assert.Nil(t, set)
+		assert.Nil(t, err)
+		z, err = db.GetZSet(key)
+		assert.Nil(t, z)
+		assert.Nil(t, err)
+		stream, err = db.GetStream(key)
+		assert.Nil(t, stream)
+		assert.Nil(t, err)
+	}
+	assert.False(t, db.ExistKey("expired"))
+
+	_, err = db.GetList("string")
+	assert.Equal(t, global.ErrWrongType, err)
+	_, err = db.GetHash("list")
+	assert.Equal(t, global.ErrWrongType, err)
+	_, err = db.GetSet("hash")
+	assert.Equal(t, global.ErrWrongType, err)
+	_, err = db.GetZSet("set")
+	assert.Equal(t, global.ErrWrongType, err)
+	_, err = db.GetStream("zset")
+	assert.Equal(t, global.ErrWrongType, err)
+}
+
+func TestDataBaseTypedGetOrCreate(t *testing.T) {
+
+	db := NewDataBase(1)
+	db.SetKey("string", structure.Slice("v"))
+
+	// 不存在时创建并写入
+	l, err := db.GetOrCreateList("list")
+	assert.Nil(t, err)
+	l.PushBack(structure.Slice("a"))
+	h, err := db.GetOrCreateHash("hash")
+	assert.Nil(t, err)
+	h.Set("f", structure.Slice("v"))
+	set, err := db.GetOrCreateSet("set")
+	assert.Nil(t, err)
+	set.Add("m")
+	z, err := db.GetOrCreateZSet("zset")
+	assert.Nil(t, err)
+	z.Add(1, "m")
+	assert.Equal(t, 5, db.Size())
+
+	// 存在时返回已有的值
+	l2, err := db.GetOrCreateList("list")
+	assert.Nil(t, err)
+	assert.Same(t, l, l2)
+	h2, err := db.GetOrCreateHash("hash")
+	assert.Nil(t, err)
+	assert.Same(t, h, h2)
+	set2, err := db.GetOrCreateSet("set")
+	assert.Nil(t, err)
+	assert.Same(t, set, set2)
+	z2, err := db.GetOrCreateZSet("zset")
+	assert.Nil(t, err)
+	assert.Same(t, z, z2)
+
+	// 类型错误时不会覆盖原有的值
+	_, err = db.GetOrCreateList("string")
+	assert.Equal(t, global.ErrWrongType, err)
+	_, err = db.GetOrCreateHash("string")
+	assert.Equal(t, global.ErrWrongType, err)
+	_, err = db.GetOrCreateSet("string")
+	assert.Equal(t, global.ErrWrongType, err)
+	_, err = db.GetOrCreateZSet("string")
+	assert.Equal(t, global.ErrWrongType, err)
+	s, _, _ := db.GetString("string")
+	assert.Equal(t, structure.Slice("v"), s)
+	assert.Equal(t, 5, db.Size())
+}
@@ -61,6 +61,10 @@ func StringToLogLevel(level string) LogLevel {
 
 // Init 用于初始化日志运行配置
 func Init(dir string, filename string, level LogLevel) error {
+	// 测试中会重复初始化，此时可能还有其他协程在写日志
+	logMu.Lock()
+	defer logMu.Unlock()
+
 	var err error
 	logcfg = &LogConfig{
 		Path:  dir,
@@ -92,6 +96,8 @@ func Init(dir string, filename string, level LogLevel) error {
 
 // Disable 用于禁止日志输出
 func Disable() {
+	logMu.Lock()
+	defer logMu.Unlock()
 	logger.SetOutput(io.Discard)
 }
 
@@ -107,110 +113,110 @@ func setPrefix(level LogLevel) {
 
 // Debug 写入 DEBUG 等级日志
 func Debug(v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > DEBUG {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(DEBUG)
 	logger.Println(v...)
 }
 
 // Debugf 写入 DEBUG 等级日志
 func Debugf(format string, v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > DEBUG {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(DEBUG)
 	logger.Printf(format, v...)
 }
 
 // Info 写入 INFO 等级日志
 func Info(v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > INFO {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(INFO)
 	logger.Println(v...)
 }
 
 // Infof 写入 INFO 等级日志
 func Infof(format string, v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > INFO {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(INFO)
 	logger.Printf(format, v...)
 }
 
 // Warning 写入 WARNING 等级日志
 func Warning(v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > WARNING {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(WARNING)
 	logger.Println(v...)
 }
 
 // Warningf 写入 WARNING 等级日志
 func Warningf(format string, v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > WARNING {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(WARNING)
 	logger.Printf(format, v...)
 }
 
 // Error 写入 ERROR 等级日志
 func Error(v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > ERROR {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(ERROR)
 	logger.Println(v...)
 }
 
 // Errorf 写入 ERROR 等级日志
 func Errorf(format string, v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > ERROR {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(ERROR)
 	logger.Printf(format, v...)
 }
 
 // Panic 写入 PANIC 等级日志
 func Panic(v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > PANIC {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(PANIC)
 	logger.Fatal(v...)
 }
 
 // Panicf 写入 PANIC 等级日志
 func Panicf(format string, v ...any) {
+	logMu.Lock()
+	defer logMu.Unlock()
 	if logcfg.Level > PANIC {
 		return
 	}
-	logMu.Lock()
-	defer logMu.Unlock()
 	setPrefix(PANIC)
 	logger.Fatalf(format, v...)
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/tangrc99/MemTable/config"
 	"github.com/tangrc99/MemTable/logger"
 	"github.com/tangrc99/MemTable/server"
+	"github.com/tangrc99/MemTable/server/global"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -29,6 +30,7 @@ func Help() {
 	fmt.Printf(format, "port <port>", "Start server with port.")
 	fmt.Printf(format, "tls-port <tls port>", "Start server with tls-port.")
 	fmt.Printf(format, "log-level <level>", "Start server with log level debug, info, warning, error or panic.")
+	fmt.Printf(format, "eval-file <filename>", "Execute commands in file before accepting connections.")
 	fmt.Printf(format, "pprof <host:port>", "Run pprof tool with host:port.")
 
 	fmt.Printf(format, "help", "Output this help and exit.")
@@ -103,6 +105,7 @@ func Daemon() (int, error) {
 func main() {
 
 	parseFlags()
+	global.Version = Version
 
 	// check if is daemonize
 	if config.Conf.Daemonize {
@@ -124,8 +127,14 @@ func main() {
 		panic(err.Error())
 	}
 
+	// 重命名需要在恢复数据之前完成，aof 中记录的是重命名之后的命令
+	if err = server.RenameCommands(config.Conf.RenameCommands); err != nil {
+		panic(err.Error())
+	}
+
 	s := server.NewServer()
 	s.InitModules()
 	s.TryRecover()
+	s.RunStartupFile(config.Conf.StartupFile)
 	s.Start()
 }
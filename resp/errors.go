@@ -0,0 +1,49 @@
+package resp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 错误回复的信息与 redis 相同，server/global 中的错误同样使用这里的信息
+const (
+	WrongTypeMessage  = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	NotIntegerMessage = "ERR value is not an integer or out of range"
+	NotFloatMessage   = "ERR value is not a valid float"
+	SyntaxMessage     = "ERR syntax error"
+)
+
+// unknownCommandArgsLimit 是 unknown command 错误中展示的参数总长度上限，与 redis 相同
+const unknownCommandArgsLimit = 128
+
+// WrongTypeError 返回对类型不匹配的键进行操作时的错误
+func WrongTypeError() *ErrorData {
+	return MakeErrorData(WrongTypeMessage)
+}
+
+// WrongArgsError 返回参数数量错误时的错误，子命令使用 "command|subcommand" 的格式
+func WrongArgsError(cmd string) *ErrorData {
+	return MakeErrorData(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
+
+// UnknownCommandError 返回命令不存在时的错误，错误中会展示命令的前几个参数
+func UnknownCommandError(cmd string, args [][]byte) *ErrorData {
+	b := strings.Builder{}
+	for _, arg := range args {
+		if b.Len() >= unknownCommandArgsLimit {
+			break
+		}
+		b.WriteString(fmt.Sprintf("'%.*s' ", unknownCommandArgsLimit-b.Len(), arg))
+	}
+	return MakeErrorData(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", cmd, b.String()))
+}
+
+// NotIntegerError 返回参数不是整数或者超出范围时的错误
+func NotIntegerError() *ErrorData {
+	return MakeErrorData(NotIntegerMessage)
+}
+
+// SyntaxError 返回命令格式错误时的错误
+func SyntaxError() *ErrorData {
+	return MakeErrorData(SyntaxMessage)
+}
@@ -0,0 +1,25 @@
+package resp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+
+	assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", string(WrongTypeError().ToBytes()))
+	assert.Equal(t, "-ERR wrong number of arguments for 'get' command\r\n", string(WrongArgsError("GET").ToBytes()))
+	assert.Equal(t, "-ERR wrong number of arguments for 'client|kill' command\r\n", string(WrongArgsError("client|kill").ToBytes()))
+	assert.Equal(t, "-ERR value is not an integer or out of range\r\n", string(NotIntegerError().ToBytes()))
+	assert.Equal(t, "-ERR syntax error\r\n", string(SyntaxError().ToBytes()))
+
+	assert.Equal(t, "-ERR unknown command 'foo', with args beginning with: \r\n", string(UnknownCommandError("foo", nil).ToBytes()))
+	assert.Equal(t, "-ERR unknown command 'foo', with args beginning with: 'a' 'b' \r\n",
+		string(UnknownCommandError("foo", [][]byte{[]byte("a"), []byte("b")}).ToBytes()))
+
+	// 展示的参数总长度不超过上限
+	long := strings.Repeat("x", 200)
+	assert.Equal(t, "-ERR unknown command 'foo', with args beginning with: '"+long[:unknownCommandArgsLimit]+"' \r\n",
+		string(UnknownCommandError("foo", [][]byte{[]byte(long), []byte("b")}).ToBytes()))
+}
@@ -1,8 +1,11 @@
 package resp
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"testing"
 )
 
@@ -105,3 +108,171 @@ func TestToReadableString(t *testing.T) {
 	fmt.Printf("%s\n", ToReadableString(adata2, ""))
 
 }
+
+func TestFormatReply(t *testing.T) {
+
+	tests := []struct {
+		data     RedisData
+		expected string
+	}{
+		{MakeStringData("OK"), "OK"},
+		{MakeStringData("nil"), "(nil)"},
+		{MakeErrorData("ERR wrong"), "(error) ERR wrong"},
+		{MakeIntData(10), "(integer) 10"},
+		{MakeBulkData([]byte("v")), "\"v\""},
+		{MakeBulkData(nil), "(nil)"},
+		{MakeArrayData(nil), "(nil)"},
+		{MakeEmptyArrayData(), "(empty array)"},
+		{MakePlainData("plain"), "plain"},
+		{MakeArrayData([]RedisData{
+			MakeBulkData([]byte("a")),
+			MakeIntData(1),
+		}), "1) \"a\"\n2) (integer) 1"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, FormatReply(test.data, 0))
+	}
+}
+
+func TestFormatReplyNested(t *testing.T) {
+
+	inner := MakeArrayData([]RedisData{
+		MakeBulkData([]byte("x")),
+		MakeBulkData([]byte("y")),
+	})
+
+	data := make([]RedisData, 10)
+	for i := range data {
+		data[i] = MakeIntData(int64(i))
+	}
+	data[9] = inner
+
+	expected := " 1) (integer) 0\n 2) (integer) 1\n 3) (integer) 2\n 4) (integer) 3\n 5) (integer) 4\n" +
+		" 6) (integer) 5\n 7) (integer) 6\n 8) (integer) 7\n 9) (integer) 8\n10) 1) \"x\"\n    2) \"y\""
+	assert.Equal(t, expected, FormatReply(MakeArrayData(data), 0))
+}
+
+func TestFormatReplyDeepNested(t *testing.T) {
+
+	data := MakeArrayData([]RedisData{
+		MakeStringData("OK"),
+		MakeArrayData([]RedisData{
+			MakeIntData(-1),
+			MakeArrayData([]RedisData{
+				MakeBulkData([]byte("deep")),
+				MakeBulkData(nil),
+				MakeEmptyArrayData(),
+			}),
+		}),
+		MakeErrorData("ERR inner"),
+	})
+
+	expected := "1) OK\n" +
+		"2) 1) (integer) -1\n" +
+		"   2) 1) \"deep\"\n" +
+		"      2) (nil)\n" +
+		"      3) (empty array)\n" +
+		"3) (error) ERR inner"
+	assert.Equal(t, expected, FormatReply(data, 0))
+}
+
+func TestFormatReplyQuote(t *testing.T) {
+
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{"plain", `"plain"`},
+		{"", `""`},
+		{"a\nb", `"a\nb"`},
+		{"\r\t\a\b", `"\r\t\a\b"`},
+		{"say \"hi\"", `"say \"hi\""`},
+		{"back\\slash", `"back\\slash"`},
+		{"\x00\x1f\x7f", `"\x00\x1f\x7f"`},
+		{"中文", `"中文"`},
+		{"\xff\xfe", `"\xff\xfe"`},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, FormatReply(MakeBulkData([]byte(test.data)), 0))
+	}
+}
+
+// maxWriter 记录单次写入的最大长度
+type maxWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *maxWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.max = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriteTo(t *testing.T) {
+
+	datas := []RedisData{
+		MakeStringData("OK"),
+		MakeBulkData(nil),
+		MakeBulkData([]byte("value")),
+		MakeArrayData(nil),
+		MakeEmptyArrayData(),
+		MakeMapData([]RedisData{MakeBulkData([]byte("k")), MakeIntData(1)}),
+		MakeMultiData([]RedisData{MakeStringData("a"), MakeIntData(2)}),
+		MakePushData([]RedisData{MakeBulkData([]byte("invalidate")), MakeArrayData([]RedisData{MakeBulkData([]byte("k"))})}),
+		MakeArrayData([]RedisData{MakeArrayData([]RedisData{MakeBulkData([]byte("nested"))}), MakeErrorData("ERR")}),
+	}
+
+	for _, data := range datas {
+		buf := &bytes.Buffer{}
+		n, err := WriteTo(buf, data)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(data.ToBytes())), n)
+		assert.Equal(t, data.ToBytes(), buf.Bytes())
+	}
+}
+
+func TestWriteToLargeArray(t *testing.T) {
+
+	elements := make([]RedisData, 100000)
+	for i := range elements {
+		elements[i] = MakeBulkData([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	data := MakeArrayData(elements)
+
+	// 元素是逐个写入的，单次写入的长度与数组大小无关
+	w := &maxWriter{}
+	n, err := WriteTo(w, data)
+	assert.Nil(t, err)
+	assert.Equal(t, data.ToBytes(), w.Bytes())
+	assert.Equal(t, int64(w.Len()), n)
+	assert.LessOrEqual(t, w.max, 32)
+}
+
+func BenchmarkWriteTo(b *testing.B) {
+
+	elements := make([]RedisData, 100000)
+	for i := range elements {
+		elements[i] = MakeBulkData([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	data := MakeArrayData(elements)
+
+	b.Run("ToBytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = io.Discard.Write(data.ToBytes())
+		}
+	})
+
+	b.Run("WriteTo", func(b *testing.B) {
+		b.ReportAllocs()
+		w := bufio.NewWriterSize(io.Discard, 16*1024)
+		for i := 0; i < b.N; i++ {
+			_, _ = WriteTo(w, data)
+			_ = w.Flush()
+		}
+	})
+}
@@ -2,17 +2,22 @@ package resp
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/tangrc99/MemTable/logger"
 	"io"
 	"reflect"
 	"strconv"
+	"sync/atomic"
 )
 
 // resp package for parsing redis serialization protocol.
 // Check https://redis.io/docs/reference/protocol-spec/ for the protocol details.
 
+// ProtoMaxBulkLen 是单个字符串允许的最大字节数，由 proto-max-bulk-len 配置，超过该长度的 bulk 视为协议错误，APPEND 等命令增长字符串时同样不能超过该值
+var ProtoMaxBulkLen int64 = 512 * 1024 * 1024
+
 type ParsedRes struct {
 	Data  RedisData
 	Err   error
@@ -25,12 +30,40 @@ type readState struct {
 	multiLine bool
 	arrayData *ArrayData
 	inArray   bool
+	parents   []arrayFrame // 嵌套数组中外层尚未解析完毕的数组
+}
+
+// arrayFrame 记录一个尚未解析完毕的数组
+type arrayFrame struct {
+	data   *ArrayData
+	length int
+}
+
+// appendToArray 将 res 加入到当前数组中，如果最外层的数组解析完毕，返回该数组以及 true
+func (state *readState) appendToArray(res RedisData) (*ArrayData, bool) {
+
+	state.arrayData.data = append(state.arrayData.data, res)
+
+	for len(state.arrayData.data) == state.arrayLen {
+
+		if len(state.parents) == 0 {
+			return state.arrayData, true
+		}
+
+		// 内层数组解析完毕，回到外层数组
+		completed := state.arrayData
+		parent := state.parents[len(state.parents)-1]
+		state.parents = state.parents[:len(state.parents)-1]
+		state.arrayData, state.arrayLen = parent.data, parent.length
+		state.arrayData.data = append(state.arrayData.data, completed)
+	}
+	return nil, false
 }
 
 type Parser struct {
 	bufReader *bufio.Reader
 	state     *readState
-	exit      bool
+	exit      atomic.Bool // 由事件循环写入，解析协程读取
 }
 
 func NewParser(reader io.Reader) *Parser {
@@ -42,7 +75,7 @@ func NewParser(reader io.Reader) *Parser {
 
 // Stop 并不会直接终止解析，而是需要手动关闭连接
 func (parser *Parser) Stop() {
-	parser.exit = true
+	parser.exit.Store(true)
 }
 
 // Parse 将会阻塞地读取数据流，并且尝试解析出 RESP 包
@@ -54,7 +87,7 @@ func (parser *Parser) Parse() *ParsedRes {
 		var msg []byte
 		msg, err = readLine(parser.bufReader, parser.state)
 
-		if parser.exit {
+		if parser.exit.Load() {
 			// 返回空消息
 			return &ParsedRes{
 				Data:  nil,
@@ -99,6 +132,13 @@ func (parser *Parser) Parse() *ParsedRes {
 			// parse single line: no bulk string
 
 			if msg[0] == '*' {
+				// 嵌套数组需要保存外层数组的状态
+				if parser.state.inArray {
+					parser.state.parents = append(parser.state.parents, arrayFrame{
+						data:   parser.state.arrayData,
+						length: parser.state.arrayLen,
+					})
+				}
 				err := parseArrayHeader(msg, parser.state)
 				if err != nil {
 					logger.Error(err)
@@ -107,6 +147,23 @@ func (parser *Parser) Parse() *ParsedRes {
 					return &ParsedRes{
 						Err: err,
 					}
+				} else if len(parser.state.parents) > 0 && parser.state.arrayLen <= 0 {
+					// 嵌套的空数组直接加入外层数组中
+					var nested *ArrayData
+					if parser.state.arrayLen == -1 {
+						nested = MakeArrayData(nil)
+					} else {
+						nested = MakeArrayData([]RedisData{})
+					}
+					parent := parser.state.parents[len(parser.state.parents)-1]
+					parser.state.parents = parser.state.parents[:len(parser.state.parents)-1]
+					parser.state.arrayData, parser.state.arrayLen = parent.data, parent.length
+					if array, ok := parser.state.appendToArray(nested); ok {
+						*parser.state = readState{}
+						return &ParsedRes{
+							Data: array,
+						}
+					}
 				} else {
 					if parser.state.arrayLen == -1 {
 						// null array
@@ -141,11 +198,10 @@ func (parser *Parser) Parse() *ParsedRes {
 						parser.state.bulkLen = 0
 						res = MakeBulkData(nil)
 						if parser.state.inArray {
-							parser.state.arrayData.data = append(parser.state.arrayData.data, res)
-							if len(parser.state.arrayData.data) == parser.state.arrayLen {
-
+							if array, ok := parser.state.appendToArray(res); ok {
+								*parser.state = readState{}
 								return &ParsedRes{
-									Data: parser.state.arrayData,
+									Data: array,
 									Err:  nil,
 								}
 							}
@@ -179,10 +235,10 @@ func (parser *Parser) Parse() *ParsedRes {
 
 		// Struct parsed data as an array or a single data, and put it into channel.
 		if parser.state.inArray {
-			parser.state.arrayData.data = append(parser.state.arrayData.data, res)
-			if len(parser.state.arrayData.data) == parser.state.arrayLen {
+			if array, ok := parser.state.appendToArray(res); ok {
+				*parser.state = readState{}
 				return &ParsedRes{
-					Data: parser.state.arrayData,
+					Data: array,
 					Err:  nil,
 				}
 			}
@@ -208,8 +264,7 @@ func readLine(reader *bufio.Reader, state *readState) ([]byte, error) {
 	var err error
 	if state.multiLine && state.bulkLen >= 0 {
 		// read bulk line, binary safety.
-		msg = make([]byte, state.bulkLen+2)
-		_, err = io.ReadFull(reader, msg)
+		msg, err = readBulk(reader, state.bulkLen+2)
 		if err != nil {
 			return nil, err
 		}
@@ -231,7 +286,36 @@ func readLine(reader *bufio.Reader, state *readState) ([]byte, error) {
 	return msg, nil
 }
 
+// bulkPreallocSize 是读取 bulk string 时预先分配的最大内存，更长的内容随着数据的到达逐步分配，
+// 避免只发送了头部的请求占用大量内存
+const bulkPreallocSize = 64 * 1024
+
+// readBulk 从 reader 中读取 n 个字节
+func readBulk(reader *bufio.Reader, n int64) ([]byte, error) {
+	if n <= bulkPreallocSize {
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, bulkPreallocSize))
+	// 与 io.ReadFull 相同，读取了部分数据之后遇到 EOF 时返回 io.ErrUnexpectedEOF
+	if copied, err := io.CopyN(buf, reader, n); err != nil {
+		if err == io.EOF && copied > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func parseSingleLine(msg []byte) (RedisData, error) {
+	// 只有 "\r\n" 的空行作为空的 inline 命令
+	if len(msg) <= 2 {
+		return MakePlainData(""), nil
+	}
 	// discard "\r\n"
 	msgType := msg[0]
 	msgData := string(msg[1 : len(msg)-2])
@@ -289,6 +373,10 @@ func parseBulkHeader(msg []byte, state *readState) error {
 	if err != nil || bulkLen < -1 {
 		return errors.New("Protocol error: " + string(msg))
 	}
+	// 与 redis 相同，超过 proto-max-bulk-len 的长度视为协议错误
+	if bulkLen > ProtoMaxBulkLen {
+		return errors.New("Protocol error: invalid bulk length")
+	}
 	state.bulkLen = bulkLen
 	state.multiLine = true
 	return nil
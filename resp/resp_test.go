@@ -3,7 +3,11 @@ package resp
 import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tangrc99/MemTable/logger"
+	"io"
 	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -25,6 +29,26 @@ func TestRespBasic(t *testing.T) {
 	assert.Equal(t, [][]byte{[]byte("set"), []byte("key"), []byte("value")}, ret.Data.(*ArrayData).ToCommand())
 }
 
+func TestRespBinarySafe(t *testing.T) {
+	rd, wr, err := os.Pipe()
+	assert.Nil(t, err)
+
+	parser := NewParser(rd)
+
+	// 批量字符串按照长度读取，内容中的 NUL、CRLF 以及非 UTF-8 的字节不会影响解析
+	value := []byte("\x00\r\n$1\r\n\xff\x00")
+	msg := PlainDataToResp([][]byte{[]byte("set"), []byte("k"), value}).ToBytes()
+	assert.Equal(t, append(append([]byte("*3\r\n$3\r\nset\r\n$1\r\nk\r\n$9\r\n"), value...), "\r\n"...), msg)
+
+	_, err = wr.Write(msg)
+	assert.Nil(t, err)
+
+	ret := parser.Parse()
+	assert.Nil(t, ret.Err)
+	assert.Equal(t, [][]byte{[]byte("set"), []byte("k"), value}, ret.Data.(*ArrayData).ToCommand())
+	assert.Equal(t, msg, ret.Data.ToBytes())
+}
+
 func TestRespBasic2(t *testing.T) {
 	rd, wr, err := os.Pipe()
 	assert.Nil(t, err)
@@ -43,6 +67,27 @@ func TestRespBasic2(t *testing.T) {
 	assert.Equal(t, [][]byte{[]byte("set"), []byte("1"), []byte("value"), []byte("err")}, ret.Data.(*ArrayData).ToCommand())
 }
 
+// TestRespNestedArray 测试嵌套数组以及数组之后的普通回复
+func TestRespNestedArray(t *testing.T) {
+	rd, wr, err := os.Pipe()
+	assert.Nil(t, err)
+
+	parser := NewParser(rd)
+
+	msg1 := "*3\r\n*2\r\n:1\r\n*1\r\n$1\r\na\r\n*0\r\n*-1\r\n"
+	msg2 := "+OK\r\n"
+	_, err = wr.WriteString(msg1 + msg2)
+	assert.Nil(t, err)
+
+	ret := parser.Parse()
+	assert.Nil(t, ret.Err)
+	assert.Equal(t, []byte(msg1), ret.Data.ToBytes())
+
+	ret = parser.Parse()
+	assert.Nil(t, ret.Err)
+	assert.Equal(t, []byte(msg2), ret.Data.ToBytes())
+}
+
 // TestRespReadBroken 读取一个关闭的 fd 应该报错
 func TestRespReadBroken(t *testing.T) {
 	rd, wr, err := os.Pipe()
@@ -303,3 +348,31 @@ func TestRespError9(t *testing.T) {
 	assert.False(t, ret1.Abort)
 
 }
+
+func TestRespBulkLength(t *testing.T) {
+
+	_ = logger.Init("", "", logger.PANIC)
+
+	// 超过 proto-max-bulk-len 的长度是协议错误
+	parser := NewParser(strings.NewReader("*1\r\n$536870913\r\n"))
+	ret := parser.Parse()
+	assert.NotNil(t, ret.Err)
+	assert.Equal(t, "Protocol error: invalid bulk length", ret.Err.Error())
+
+	// 只发送头部的请求不会按照头部的长度分配内存
+	before := runtime.MemStats{}
+	runtime.ReadMemStats(&before)
+	parser = NewParser(strings.NewReader("*1\r\n$268435456\r\nabc"))
+	ret = parser.Parse()
+	after := runtime.MemStats{}
+	runtime.ReadMemStats(&after)
+	assert.Equal(t, io.ErrUnexpectedEOF, ret.Err)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20))
+
+	// 较长的内容随着数据的到达读取
+	value := strings.Repeat("v", 200*1024)
+	parser = NewParser(strings.NewReader("*1\r\n$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"))
+	ret = parser.Parse()
+	assert.Nil(t, ret.Err)
+	assert.Equal(t, [][]byte{[]byte(value)}, ret.Data.(*ArrayData).ToCommand())
+}
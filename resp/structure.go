@@ -1,6 +1,7 @@
 package resp
 
 import (
+	"io"
 	"strconv"
 	"strings"
 )
@@ -16,6 +17,34 @@ type RedisData interface {
 	ByteData() []byte // return byte data
 }
 
+// WriteTo 将 data 编码后写入到 w 中。实现了 io.WriterTo 的类型会分段写入，不需要先生成完整的回包，
+// 因此大数组等回包占用的内存不会超过 w 的缓冲区大小
+func WriteTo(w io.Writer, data RedisData) (int64, error) {
+	if wt, ok := data.(io.WriterTo); ok {
+		return wt.WriteTo(w)
+	}
+	n, err := w.Write(data.ToBytes())
+	return int64(n), err
+}
+
+// writeAggregate 依次写入聚合类型的头部以及每一个元素
+func writeAggregate(w io.Writer, header string, data []RedisData) (int64, error) {
+	n, err := io.WriteString(w, header)
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	for _, v := range data {
+		m, err := WriteTo(w, v)
+		total += m
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
 type StringData struct {
 	data string
 }
@@ -41,6 +70,21 @@ type PlainData struct {
 	data string
 }
 
+// MapData 是 RESP3 中的 map 类型，key 与 value 交替存储
+type MapData struct {
+	data []RedisData
+}
+
+// PushData 是 RESP3 中的 push 类型，用于服务端主动发送的消息，例如 client tracking 的失效通知
+type PushData struct {
+	data []RedisData
+}
+
+// MultiData 由多个连续的回复组成，用于一条命令需要返回多个回复的情况
+type MultiData struct {
+	data []RedisData
+}
+
 // MakeBulkData 返回值在客户端中是有 "" 的
 func MakeBulkData(data []byte) *BulkData {
 	return &BulkData{
@@ -61,6 +105,24 @@ func (r *BulkData) ToBytes() []byte {
 	return []byte("$" + strconv.Itoa(len(r.data)) + CRLF + string(r.data) + CRLF)
 }
 
+// WriteTo 分别写入头部、内容以及结尾，避免复制大的 value
+func (r *BulkData) WriteTo(w io.Writer) (int64, error) {
+	if r.data == nil {
+		n, err := io.WriteString(w, "$-1\r\n")
+		return int64(n), err
+	}
+
+	total := int64(0)
+	for _, seg := range [][]byte{[]byte("$" + strconv.Itoa(len(r.data)) + CRLF), r.data, []byte(CRLF)} {
+		n, err := w.Write(seg)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
 func (r *BulkData) Data() []byte {
 	return r.data
 }
@@ -148,6 +210,15 @@ func (r *ArrayData) ToBytes() []byte {
 	}
 	return res
 }
+
+func (r *ArrayData) WriteTo(w io.Writer) (int64, error) {
+	if r.data == nil {
+		n, err := io.WriteString(w, "*-1\r\n")
+		return int64(n), err
+	}
+	return writeAggregate(w, "*"+strconv.Itoa(len(r.data))+CRLF, r.data)
+}
+
 func (r *ArrayData) Data() []RedisData {
 	return r.data
 }
@@ -169,6 +240,109 @@ func (r *ArrayData) ByteData() []byte {
 	return res
 }
 
+// MakeMapData 返回值在 RESP3 客户端中是一个 map，data 中 key 与 value 交替存储
+func MakeMapData(data []RedisData) *MapData {
+	return &MapData{
+		data: data,
+	}
+}
+
+func (r *MapData) ToBytes() []byte {
+	res := []byte("%" + strconv.Itoa(len(r.data)/2) + CRLF)
+	for _, v := range r.data {
+		res = append(res, v.ToBytes()...)
+	}
+	return res
+}
+
+func (r *MapData) WriteTo(w io.Writer) (int64, error) {
+	return writeAggregate(w, "%"+strconv.Itoa(len(r.data)/2)+CRLF, r.data)
+}
+
+func (r *MapData) Data() []RedisData {
+	return r.data
+}
+
+func (r *MapData) ByteData() []byte {
+	res := make([]byte, 0)
+	for _, v := range r.data {
+		res = append(res, v.ByteData()...)
+	}
+	return res
+}
+
+// ToArray 将 map 转换为 RESP2 中 key value 交替的数组
+func (r *MapData) ToArray() *ArrayData {
+	return MakeArrayData(r.data)
+}
+
+// MakePushData 返回值在 RESP3 客户端中是一个 push 消息，不会被当作命令的回复
+func MakePushData(data []RedisData) *PushData {
+	return &PushData{
+		data: data,
+	}
+}
+
+func (r *PushData) ToBytes() []byte {
+	res := []byte(">" + strconv.Itoa(len(r.data)) + CRLF)
+	for _, v := range r.data {
+		res = append(res, v.ToBytes()...)
+	}
+	return res
+}
+
+func (r *PushData) WriteTo(w io.Writer) (int64, error) {
+	return writeAggregate(w, ">"+strconv.Itoa(len(r.data))+CRLF, r.data)
+}
+
+func (r *PushData) Data() []RedisData {
+	return r.data
+}
+
+func (r *PushData) ByteData() []byte {
+	res := make([]byte, 0)
+	for _, v := range r.data {
+		res = append(res, v.ByteData()...)
+	}
+	return res
+}
+
+// ToArray 将 push 消息转换为 RESP2 中的数组
+func (r *PushData) ToArray() *ArrayData {
+	return MakeArrayData(r.data)
+}
+
+// MakeMultiData 返回值在客户端中是多个独立的回复，例如 subscribe 多个频道时每个频道对应一个回复
+func MakeMultiData(data []RedisData) *MultiData {
+	return &MultiData{
+		data: data,
+	}
+}
+
+func (r *MultiData) ToBytes() []byte {
+	res := make([]byte, 0)
+	for _, v := range r.data {
+		res = append(res, v.ToBytes()...)
+	}
+	return res
+}
+
+func (r *MultiData) WriteTo(w io.Writer) (int64, error) {
+	return writeAggregate(w, "", r.data)
+}
+
+func (r *MultiData) Data() []RedisData {
+	return r.data
+}
+
+func (r *MultiData) ByteData() []byte {
+	res := make([]byte, 0)
+	for _, v := range r.data {
+		res = append(res, v.ByteData()...)
+	}
+	return res
+}
+
 func MakePlainData(data string) *PlainData {
 	return &PlainData{
 		data: data,
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"unicode/utf8"
 )
 
 // PlainDataToResp 将 redis-pipeline 类型数据转化为 RESP 类型数据
@@ -52,3 +53,95 @@ func ToReadableString(data RedisData, prefix string) string {
 	}
 	return ""
 }
+
+// FormatReply 将回复转换为 redis-cli 风格的可读字符串，indent 是嵌套数组中每一行的缩进
+func FormatReply(data RedisData, indent int) string {
+
+	switch r := data.(type) {
+
+	case *StringData:
+		// 服务端使用 +nil 代表空值
+		if r.Data() == "nil" {
+			return "(nil)"
+		}
+		return r.Data()
+
+	case *ErrorData:
+		return "(error) " + r.Error()
+
+	case *IntData:
+		return fmt.Sprintf("(integer) %d", r.Data())
+
+	case *BulkData:
+		if r.Data() == nil {
+			return "(nil)"
+		}
+		return quoteBulk(r.Data())
+
+	case *ArrayData:
+		if r.Data() == nil {
+			return "(nil)"
+		}
+		if len(r.Data()) == 0 {
+			return "(empty array)"
+		}
+
+		// 序号需要对齐
+		width := len(fmt.Sprintf("%d", len(r.Data())))
+		lines := make([]string, len(r.Data()))
+		for i, d := range r.Data() {
+			prefix := fmt.Sprintf("%*d) ", width, i+1)
+			lines[i] = prefix + FormatReply(d, indent+len(prefix))
+			if i > 0 {
+				lines[i] = strings.Repeat(" ", indent) + lines[i]
+			}
+		}
+		return strings.Join(lines, "\n")
+
+	case *PlainData:
+		return r.Data()
+	}
+
+	return ""
+}
+
+// quoteBulk 使用双引号包裹批量字符串，控制字符以及不可打印的字节会被转义
+func quoteBulk(data []byte) string {
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString("\\n")
+		case '\r':
+			b.WriteString("\\r")
+		case '\t':
+			b.WriteString("\\t")
+		case '\a':
+			b.WriteString("\\a")
+		case '\b':
+			b.WriteString("\\b")
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, "\\x%02x", c)
+			} else if c < utf8.RuneSelf {
+				b.WriteByte(c)
+			} else if r, n := utf8.DecodeRune(data[i:]); r != utf8.RuneError {
+				// 合法的 utf-8 字符直接输出
+				b.Write(data[i : i+n])
+				i += n
+				continue
+			} else {
+				fmt.Fprintf(&b, "\\x%02x", c)
+			}
+		}
+		i++
+	}
+	b.WriteByte('"')
+	return b.String()
+}
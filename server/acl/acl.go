@@ -6,6 +6,7 @@ import (
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/logger"
 	"github.com/tangrc99/MemTable/server/errors"
+	"github.com/tangrc99/MemTable/server/global"
 	"io"
 	"os"
 	"regexp"
@@ -161,17 +162,29 @@ func (a *ACL) SetupUser(name string, options [][]byte) error {
 	if !exist {
 		user = NewUser(name)
 	}
-	oldVal := *user
+	oldVal := user.clone()
 	err := a.setupUser(user, options)
 	if err != nil {
 		*user = oldVal
+		return err
 	}
-	return err
+	// 不存在的用户在设置成功之后创建
+	if !exist {
+		a.users[name] = user
+	}
+	return nil
 }
 
 func (a *ACL) setupUser(user *User, options [][]byte) error {
 	for _, s := range options {
-		seg := strings.ToLower(string(s))
+		if len(s) == 0 {
+			return errors.ErrorUnKnownSubCommand("")
+		}
+		// 密码以及键的模式区分大小写
+		seg := string(s)
+		if s[0] != '>' && s[0] != '<' && s[0] != '~' {
+			seg = strings.ToLower(seg)
+		}
 		prefix := seg[1:]
 
 		switch seg[0] {
@@ -189,7 +202,10 @@ func (a *ACL) setupUser(user *User, options [][]byte) error {
 
 		case byte('+'):
 			// permit command
-			if prefix[0] != '@' {
+			if len(prefix) == 0 || prefix[0] != '@' {
+				if global.GetCommandId(prefix) < 0 {
+					return errors.ErrorCommandNotExist(prefix)
+				}
 				user.WithPermittedCommand([]string{prefix})
 
 			} else {
@@ -203,7 +219,10 @@ func (a *ACL) setupUser(user *User, options [][]byte) error {
 
 		case byte('-'):
 			// forbid command
-			if prefix[0] != '@' {
+			if len(prefix) == 0 || prefix[0] != '@' {
+				if global.GetCommandId(prefix) < 0 {
+					return errors.ErrorCommandNotExist(prefix)
+				}
 				user.WithForbiddenCommand([]string{prefix})
 
 			} else {
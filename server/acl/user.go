@@ -154,11 +154,12 @@ func (user *User) IsCommandAllowed(command string) bool {
 		return false
 	}
 
-	if user.allowed.Get(c.GetId()) == 1 {
-		return true
-	}
+	return user.IsAllowed(c)
+}
 
-	return false
+// IsAllowed 判断用户是否有权限执行命令 c
+func (user *User) IsAllowed(c global.Command) bool {
+	return user.allowed.Get(c.GetId()) == 1
 }
 
 func (user *User) IsKeyAccessible(key string) bool {
@@ -294,6 +295,17 @@ func (user *User) ToStringWithoutSha256() string {
 	return b.String()
 }
 
+// clone 返回用户的深拷贝，用于设置失败时回滚
+func (user *User) clone() User {
+	c := *user
+	allowed := append(structure.BitMap{}, *user.allowed...)
+	c.allowed = &allowed
+	c.passwords = append([]string{}, user.passwords...)
+	c.patterns = append([]*regexp.Regexp{}, user.patterns...)
+	c.profiles = append([]string{}, user.profiles...)
+	return c
+}
+
 func (user *User) Reset() {
 	user.allowed = structure.NewBitMap(1024)
 	user.flag = 0x00000001
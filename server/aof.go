@@ -4,10 +4,23 @@ import (
 	"fmt"
 	"github.com/tangrc99/MemTable/logger"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
 	"os"
 	"strconv"
+	"time"
 )
 
+// aofWaiter 记录一个阻塞在 WAITAOF 或者 WAIT 命令上的客户端
+type aofWaiter struct {
+	cli          *Client
+	numLocal     int
+	numReplicas  int
+	localOffset  int64     // 需要写入硬盘的 aof 偏移量
+	replOffset   uint64    // 需要从节点确认的复制偏移量
+	deadline     time.Time // 超时时间，为零值时一直阻塞
+	replicasOnly bool      // WAIT 命令只等待从节点，回复为确认的从节点数量
+}
+
 func (s *Server) appendAOF(event *Event) {
 
 	if s.aof == nil || !s.aofEnabled {
@@ -29,6 +42,65 @@ func (s *Server) appendAOF(event *Event) {
 	s.aof.append(event.raw)
 }
 
+// checkAOFWaiter 返回 WAITAOF 的回包，以及等待条件是否已经满足
+func (s *Server) checkAOFWaiter(w *aofWaiter) (resp.RedisData, bool) {
+
+	local := 0
+	if s.aof != nil && s.aof.synced() >= w.localOffset {
+		local = 1
+	}
+
+	replicas := 0
+	if s.role == Master {
+		for cli := range s.onLineSlaves {
+			if cli.offset >= w.replOffset {
+				replicas++
+			}
+		}
+	}
+
+	if w.replicasOnly {
+		return resp.MakeIntData(int64(replicas)), replicas >= w.numReplicas
+	}
+
+	ret := resp.MakeArrayData([]resp.RedisData{
+		resp.MakeIntData(int64(local)),
+		resp.MakeIntData(int64(replicas)),
+	})
+	return ret, local >= w.numLocal && replicas >= w.numReplicas
+}
+
+// handleAOFWaiters 唤醒条件已经满足或者已经超时的 WAITAOF 客户端
+func (s *Server) handleAOFWaiters() {
+
+	if len(s.aofWaiters) == 0 {
+		return
+	}
+
+	remain := s.aofWaiters[:0]
+	for _, w := range s.aofWaiters {
+		ret, ok := s.checkAOFWaiter(w)
+		if ok || (!w.deadline.IsZero() && !global.Now().Before(w.deadline)) {
+			w.cli.blocked = false
+			w.cli.res <- &ret
+			continue
+		}
+		remain = append(remain, w)
+	}
+	s.aofWaiters = remain
+}
+
+// removeAOFWaiters 删除客户端阻塞在 WAITAOF 以及 WAIT 上的记录，用于关闭的客户端
+func (s *Server) removeAOFWaiters(cli *Client) {
+	remain := s.aofWaiters[:0]
+	for _, w := range s.aofWaiters {
+		if w.cli != cli {
+			remain = append(remain, w)
+		}
+	}
+	s.aofWaiters = remain
+}
+
 func (s *Server) recoverFromAOF(filename string) {
 
 	reader, err := os.OpenFile(filename, os.O_RDONLY, 777)
@@ -2,13 +2,26 @@ package server
 
 import (
 	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/server/global"
 	"os"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const bufferPageSize = 3
 const maxBufferPageCapacity = 65536
 
+// aof 刷盘策略
+const (
+	// fsyncAlways 每一次写命令执行后都会同步刷盘
+	fsyncAlways = "always"
+	// fsyncEverySec 由后台协程每秒刷盘一次
+	fsyncEverySec = "everysec"
+	// fsyncNo 由后台协程每秒写入 os 缓冲区，由操作系统决定何时写入硬盘
+	fsyncNo = "no"
+)
+
 // appendResult 是 bufferPage.append 函数的返回值类型
 type appendResult int
 
@@ -63,6 +76,15 @@ func (buff *bufferPage) append(bytes []byte) appendResult {
 	return appendSuccess
 }
 
+// size 返回 page 中待写入的字节数
+func (buff *bufferPage) size() int {
+	n := buff.pos
+	for i := range buff.appendix {
+		n += len(buff.appendix[i])
+	}
+	return n
+}
+
 // flush 返回失败代表当前 page 有待写入内容
 func (buff *bufferPage) flush(writer *os.File) bool {
 
@@ -95,21 +117,39 @@ func (buff *bufferPage) flush(writer *os.File) bool {
 }
 
 // aofBuffer 是维护了 AOF 缓冲区，它内部是一个 link_buffer 结构的缓冲区。缓冲区的硬盘写入操作是异步的，所有的操作保证成功，或抛出异常。
+// event loop 只会写入 appendSeq 对应的页，后台协程只会写出 flushSeq 对应的页，写出文件时不需要持有锁。
 type aofBuffer struct {
 	writer *os.File
 
-	flushSeq  int64 // 当前刷盘序列号
-	appendSeq int64 // 当前写入序列号
+	mu        sync.Mutex // 保护页的切换以及序列号
+	flushMu   sync.Mutex // 保证同一时刻只有一个协程写出文件
+	flushSeq  int64      // 当前刷盘序列号
+	appendSeq int64      // 当前写入序列号
 	pages     []*bufferPage
 	pageSize  int64
 
 	writing      int32         // 是否正在写入
 	notification chan struct{} // 刷盘通知标志
-	quitFlag     chan struct{}
+	quitFlag     chan struct{} // 关闭后后台协程退出
+	quitOnce     sync.Once
+	done         chan struct{} // 后台协程退出后关闭
+
+	policy        string        // 刷盘策略
+	interval      time.Duration // 后台刷盘周期，为 0 时只响应刷盘通知
+	appendOffset  int64         // 写入缓冲区的字节数
+	writtenOffset int64         // 写入 os 缓冲区的字节数
+	syncedOffset  int64         // 已经写入硬盘的字节数
+	fsyncs        int64         // 刷盘次数
+	syncFailed    int32         // 最近一次刷盘是否失败
 }
 
 // newAOFBuffer 会创建一个 AOF 缓冲区，缓冲区的将会采取一定策略写入到 filename 文件中
 func newAOFBuffer(filename string) *aofBuffer {
+	return newAOFBufferWithPolicy(filename, fsyncEverySec, global.TEAOF)
+}
+
+// newAOFBufferWithPolicy 会创建一个使用 policy 刷盘策略的 AOF 缓冲区，后台协程每隔 interval 将缓冲区写入到文件中
+func newAOFBufferWithPolicy(filename string, policy string, interval time.Duration) *aofBuffer {
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
 	if err != nil {
 		logger.Error("Aof:", err.Error())
@@ -124,13 +164,17 @@ func newAOFBuffer(filename string) *aofBuffer {
 		writing:      0,
 		notification: make(chan struct{}),
 		quitFlag:     make(chan struct{}),
+		done:         make(chan struct{}),
 	}
+	buffers.policy = policy
+	buffers.interval = interval
 
 	for i := range buffers.pages {
 		buffers.pages[i] = newBufferPage(maxBufferPageCapacity)
 	}
 
 	go func() {
+		defer close(buffers.done)
 		buffers.asyncTask()
 		logger.Info("AOF: AOF Goroutine exits")
 	}()
@@ -139,6 +183,14 @@ func newAOFBuffer(filename string) *aofBuffer {
 }
 
 func (buff *aofBuffer) asyncTask() {
+
+	var tick <-chan time.Time
+	if buff.interval > 0 {
+		ticker := time.NewTicker(buff.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
 	q := false
 	for !q {
 		select {
@@ -154,6 +206,16 @@ func (buff *aofBuffer) asyncTask() {
 
 			// 完成刷盘工作
 			atomic.StoreInt32(&buff.writing, 0)
+		// 周期性刷盘，event loop 的写入不会被阻塞
+		case <-tick:
+			atomic.StoreInt32(&buff.writing, 1)
+			buff.flushAll()
+
+			if buff.policy != fsyncNo {
+				atomic.StoreInt32(&buff.writing, 2)
+				buff.syncToDisk()
+			}
+			atomic.StoreInt32(&buff.writing, 0)
 		// 控制退出
 		case <-buff.quitFlag:
 			q = true
@@ -161,43 +223,90 @@ func (buff *aofBuffer) asyncTask() {
 	}
 }
 
-// flushBuffer 会将当前页写入到硬盘中
-func (buff *aofBuffer) flushBuffer() {
+// flushBuffer 会将当前页写入到 os 缓冲区中，如果没有需要写入的内容返回 false
+func (buff *aofBuffer) flushBuffer() bool {
 
 	if buff.writer == nil {
-		return
+		return false
 	}
 
-	buff.pages[buff.flushSeq%buff.pageSize].flush(buff.writer)
+	buff.flushMu.Lock()
+	defer buff.flushMu.Unlock()
+
+	buff.mu.Lock()
+	page := buff.pages[buff.flushSeq%buff.pageSize]
 	if buff.flushSeq == buff.appendSeq {
-		return
+		if page.size() == 0 {
+			buff.mu.Unlock()
+			return false
+		}
+		// 当前页正在被写入，需要封存当前页，之后的写入会转移到下一页
+		buff.appendSeq++
 	}
+	buff.mu.Unlock()
+
+	n := page.size()
+	page.flush(buff.writer)
+	buff.writtenOffset += int64(n)
+
+	buff.mu.Lock()
 	buff.flushSeq++
+	buff.mu.Unlock()
+
+	return true
 }
 
-func (buff *aofBuffer) syncToDisk() {
-	err := buff.writer.Sync()
-	if err != nil {
-		return
+// flushAll 会将全部缓冲区写入到 os 缓冲区中
+func (buff *aofBuffer) flushAll() {
+	for buff.flushBuffer() {
 	}
 }
 
-// quit 会阻塞直至清空所有的缓冲区
-func (buff *aofBuffer) quit() {
+func (buff *aofBuffer) syncToDisk() {
 
 	if buff.writer == nil {
 		return
 	}
 
-	for buff.flushSeq < buff.appendSeq {
-		// 通知协程进行写入操作
-		buff.notification <- struct{}{}
+	buff.flushMu.Lock()
+	defer buff.flushMu.Unlock()
+
+	if buff.writtenOffset == atomic.LoadInt64(&buff.syncedOffset) {
+		return
 	}
 
-	// 追上时也要刷盘一次
-	buff.notification <- struct{}{}
+	err := buff.writer.Sync()
+	if err != nil {
+		logger.Errorf("Aof: %s", err.Error())
+		atomic.StoreInt32(&buff.syncFailed, 1)
+		return
+	}
+	atomic.StoreInt32(&buff.syncFailed, 0)
+	atomic.StoreInt64(&buff.syncedOffset, buff.writtenOffset)
+	atomic.AddInt64(&buff.fsyncs, 1)
+}
 
-	buff.quitFlag <- struct{}{}
+// lastWriteOK 返回最近一次刷盘是否成功
+func (buff *aofBuffer) lastWriteOK() bool {
+	return atomic.LoadInt32(&buff.syncFailed) == 0
+}
+
+// sync 会阻塞地将全部缓冲区写入到硬盘中
+func (buff *aofBuffer) sync() {
+	buff.flushAll()
+	buff.syncToDisk()
+}
+
+// quit 会阻塞直至清空所有的缓冲区，并等待后台协程退出，重复调用不会产生影响
+func (buff *aofBuffer) quit() {
+
+	buff.quitOnce.Do(func() {
+		if buff.writer != nil {
+			buff.sync()
+		}
+		close(buff.quitFlag)
+	})
+	<-buff.done
 }
 
 // flush 通知协程进行持久化操作
@@ -210,14 +319,21 @@ func (buff *aofBuffer) flush() {
 // append 将内容写入到 AOF 缓冲区中，如果当前缓冲区已满，函数会阻塞直到刷盘清理出一部分可写入的缓冲区
 func (buff *aofBuffer) append(bytes []byte) {
 
+	buff.mu.Lock()
+	defer buff.mu.Unlock()
+
+	buff.appendOffset += int64(len(bytes))
+
 	result := buff.pages[buff.appendSeq%buff.pageSize].append(bytes)
 
 	if result != appendSuccess {
 		buff.appendSeq++
 
-		// 如果自加后追赶上刷盘
+		// 如果自加后追赶上刷盘，需要等待最早的一页写出
 		if buff.appendSeq-buff.flushSeq == buff.pageSize {
+			buff.mu.Unlock()
 			buff.flushBuffer()
+			buff.mu.Lock()
 		}
 
 		// 如果在上一页中插入失败，需要再一次尝试写入当前页
@@ -226,3 +342,15 @@ func (buff *aofBuffer) append(bytes []byte) {
 		}
 	}
 }
+
+// offset 返回已经写入缓冲区的字节数
+func (buff *aofBuffer) offset() int64 {
+	buff.mu.Lock()
+	defer buff.mu.Unlock()
+	return buff.appendOffset
+}
+
+// synced 返回已经写入硬盘的字节数
+func (buff *aofBuffer) synced() int64 {
+	return atomic.LoadInt64(&buff.syncedOffset)
+}
@@ -4,8 +4,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tangrc99/MemTable/logger"
 	"os"
+	"path"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // TestAOFBufferPage 测试 page 能否正常写入
@@ -145,3 +147,68 @@ func TestAOFBufferAsyncQuit(t *testing.T) {
 	bytes, _ := os.ReadFile("TestAOFBufferAsyncQuit.aof")
 	assert.Equal(t, []byte("1234567890"), bytes)
 }
+
+func TestAOFBufferQuitWithoutFile(t *testing.T) {
+
+	_ = logger.Init("", "", logger.WARNING)
+
+	// 文件无法打开时后台协程同样需要退出
+	aof := newAOFBuffer(path.Join(t.TempDir(), "none", "appendonly.aof"))
+	assert.Nil(t, aof.writer)
+
+	aof.quit()
+	aof.quit()
+
+	select {
+	case <-aof.done:
+	default:
+		t.Fatal("aof goroutine is still running")
+	}
+}
+
+func TestAOFBufferFsyncEverySec(t *testing.T) {
+
+	_ = logger.Init("", "", logger.WARNING)
+
+	filename := path.Join(t.TempDir(), "TestAOFBufferFsyncEverySec.aof")
+	aof := newAOFBufferWithPolicy(filename, fsyncEverySec, 50*time.Millisecond)
+
+	// 持续写入期间，刷盘只会由后台协程按照周期完成
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		aof.append([]byte("12345"))
+		time.Sleep(time.Millisecond)
+	}
+	fsyncs := atomic.LoadInt64(&aof.fsyncs)
+	assert.GreaterOrEqual(t, fsyncs, int64(3))
+	assert.LessOrEqual(t, fsyncs, int64(11))
+
+	// 停止写入后，下一个周期会将剩余内容写入硬盘
+	assert.Eventually(t, func() bool {
+		return aof.synced() == aof.offset()
+	}, time.Second, 10*time.Millisecond)
+
+	bytes, _ := os.ReadFile(filename)
+	assert.Equal(t, aof.offset(), int64(len(bytes)))
+
+	aof.quit()
+}
+
+func TestAOFBufferFsyncNo(t *testing.T) {
+
+	_ = logger.Init("", "", logger.WARNING)
+
+	filename := path.Join(t.TempDir(), "TestAOFBufferFsyncNo.aof")
+	aof := newAOFBufferWithPolicy(filename, fsyncNo, 20*time.Millisecond)
+
+	aof.append([]byte("12345"))
+
+	// 内容会写入 os 缓冲区，但是不会主动刷盘
+	assert.Eventually(t, func() bool {
+		bytes, _ := os.ReadFile(filename)
+		return string(bytes) == "12345"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&aof.fsyncs))
+
+	aof.quit()
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWaitAOF(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.aofEnabled = false
+	cli := NewFakeClient()
+
+	// 未开启 aof 时不能等待本地刷盘
+	assert.Equal(t, resp.MakeErrorData("ERR WAITAOF cannot be used when numlocal is set but appendonly is disabled."),
+		waitAOF(s, cli, [][]byte{[]byte("waitaof"), []byte("1"), []byte("0"), []byte("0")}))
+	assert.Equal(t, resp.MakeErrorData("ERR timeout is negative"),
+		waitAOF(s, cli, [][]byte{[]byte("waitaof"), []byte("0"), []byte("0"), []byte("-1")}))
+
+	s.aofEnabled = true
+	s.aof = newAOFBufferWithPolicy(path.Join(t.TempDir(), "appendonly.aof"), fsyncEverySec, 100*time.Millisecond)
+	defer s.aof.quit()
+
+	s.aof.append([]byte("*3\r\n$3\r\nset\r\n$1\r\na\r\n$1\r\nb\r\n"))
+
+	// 数据尚未刷盘，客户端会被阻塞
+	assert.Nil(t, waitAOF(s, cli, [][]byte{[]byte("waitaof"), []byte("1"), []byte("0"), []byte("0")}))
+	assert.True(t, cli.blocked)
+
+	var ret *resp.RedisData
+	assert.Eventually(t, func() bool {
+		global.UpdateGlobalClock()
+		s.handleAOFWaiters()
+		select {
+		case ret = <-cli.res:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	assert.False(t, cli.blocked)
+	assert.Equal(t, s.aof.offset(), s.aof.synced())
+	assert.Equal(t, []byte("*2\r\n:1\r\n:0\r\n"), (*ret).ToBytes())
+
+	// 已经刷盘的数据会直接返回
+	assert.Equal(t, []byte("*2\r\n:1\r\n:0\r\n"),
+		waitAOF(s, cli, [][]byte{[]byte("waitaof"), []byte("1"), []byte("0"), []byte("0")}).ToBytes())
+
+	// 没有从节点时等待超时
+	global.UpdateGlobalClock()
+	assert.Nil(t, waitAOF(s, cli, [][]byte{[]byte("waitaof"), []byte("1"), []byte("1"), []byte("50")}))
+	time.Sleep(60 * time.Millisecond)
+	global.UpdateGlobalClock()
+	s.handleAOFWaiters()
+	ret = <-cli.res
+	assert.Equal(t, []byte("*2\r\n:1\r\n:0\r\n"), (*ret).ToBytes())
+	assert.Empty(t, s.aofWaiters)
+
+	// 客户端断开后不再保留一直阻塞的等待记录
+	assert.Nil(t, waitAOF(s, cli, [][]byte{[]byte("waitaof"), []byte("1"), []byte("1"), []byte("0")}))
+	assert.Len(t, s.aofWaiters, 1)
+	s.shutdownClient(cli)
+	assert.Empty(t, s.aofWaiters)
+}
+
+func TestRewriteForPropagation(t *testing.T) {
+
+	raw := []byte("raw")
+
+	// 确定性的命令不会被改写
+	assert.Equal(t, raw, rewriteForPropagation([][]byte{[]byte("set"), []byte("k"), []byte("v")}, resp.MakeStringData("OK"), raw, global.Now()))
+
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("srem"), []byte("s"), []byte("m1")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("SPOP"), []byte("s")}, resp.MakeBulkData([]byte("m1")), raw, global.Now()))
+
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("srem"), []byte("s"), []byte("m1"), []byte("m2")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("spop"), []byte("s"), []byte("2")}, resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte("m1")), resp.MakeBulkData([]byte("m2")),
+		}), raw, global.Now()))
+
+	// 没有弹出成员时不需要传播
+	assert.Nil(t, rewriteForPropagation([][]byte{[]byte("spop"), []byte("s")}, resp.MakeStringData("nil"), raw, global.Now()))
+	assert.Nil(t, rewriteForPropagation([][]byte{[]byte("spop"), []byte("s"), []byte("2")}, resp.MakeEmptyArrayData(), raw, global.Now()))
+
+	// xadd 使用实际写入的 id 进行传播
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("xadd"), []byte("x"), []byte("5-0"), []byte("f"), []byte("v")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("xadd"), []byte("x"), []byte("*"), []byte("f"), []byte("v")}, resp.MakeBulkData([]byte("5-0")), raw, global.Now()))
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("xadd"), []byte("x"), []byte("5-3"), []byte("f"), []byte("v")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("xadd"), []byte("x"), []byte("5-*"), []byte("f"), []byte("v")}, resp.MakeBulkData([]byte("5-3")), raw, global.Now()))
+
+	// hexpire 改写为使用绝对时间的 hexpireat
+	now := time.Unix(1000, 0)
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("hexpireat"), []byte("h"), []byte("1010"), []byte("fields"), []byte("1"), []byte("a")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("hexpire"), []byte("h"), []byte("10"), []byte("fields"), []byte("1"), []byte("a")}, resp.MakeArrayData(nil), raw, now))
+
+	// expire 以及 pexpire 改写为使用绝对时间的 pexpireat
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("pexpireat"), []byte("k"), []byte("1010000")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("expire"), []byte("k"), []byte("10")}, resp.MakeIntData(1), raw, now))
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("pexpireat"), []byte("k"), []byte("1002000"), []byte("nx")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("PEXPIRE"), []byte("k"), []byte("2500"), []byte("nx")}, resp.MakeIntData(1), raw, now))
+	assert.Nil(t, rewriteForPropagation([][]byte{[]byte("expire"), []byte("k"), []byte("10")}, resp.MakeIntData(0), raw, now))
+
+	// set 的 EX 以及 PX 选项改写为使用绝对时间的 PXAT
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("set"), []byte("k"), []byte("v"), []byte("nx"), []byte("pxat"), []byte("1010000")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("set"), []byte("k"), []byte("v"), []byte("nx"), []byte("EX"), []byte("10")}, resp.MakeStringData("OK"), raw, now))
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("set"), []byte("k"), []byte("v"), []byte("pxat"), []byte("1002000")}).ToBytes(),
+		rewriteForPropagation([][]byte{[]byte("set"), []byte("k"), []byte("v"), []byte("px"), []byte("1500")}, resp.MakeStringData("OK"), raw, now))
+
+	// 使用相对 ttl 的 restore 改写为 ABSTTL
+	restore := [][]byte{[]byte("restore"), []byte("k"), []byte("1500"), []byte("payload"), []byte("replace")}
+	assert.Equal(t, resp.PlainDataToResp([][]byte{[]byte("restore"), []byte("k"), []byte("1002000"), []byte("payload"), []byte("replace"), []byte("ABSTTL")}).ToBytes(),
+		rewriteForPropagation(restore, resp.MakeStringData("OK"), raw, now))
+	absolute := [][]byte{[]byte("restore"), []byte("k"), []byte("5000"), []byte("payload"), []byte("absttl")}
+	assert.Equal(t, resp.PlainDataToResp(absolute).ToBytes(), rewriteForPropagation(absolute, resp.MakeStringData("OK"), raw, now))
+	persistent := [][]byte{[]byte("restore"), []byte("k"), []byte("0"), []byte("payload")}
+	assert.Equal(t, resp.PlainDataToResp(persistent).ToBytes(), rewriteForPropagation(persistent, resp.MakeStringData("OK"), raw, now))
+}
+
+func TestWait(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.aofEnabled = false
+	cli := NewFakeClient()
+
+	// 单机模式下直接返回
+	assert.Equal(t, resp.MakeIntData(0), execCmd(s, cli, "wait", "1", "0"))
+	assert.False(t, cli.blocked)
+
+	assert.Equal(t, resp.MakeErrorData("ERR timeout is negative"), execCmd(s, cli, "wait", "1", "-1"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execCmd(s, cli, "wait", "a", "0"))
+
+	// 模拟一个落后于主节点的从节点
+	s.role = Master
+	s.offset = 100
+	slave := NewFakeClient()
+	slave.offset = 50
+	s.onLineSlaves = map[*Client]struct{}{slave: {}}
+
+	// 从节点没有确认时等待超时
+	global.UpdateGlobalClock()
+	assert.Nil(t, execCmd(s, cli, "wait", "1", "50"))
+	assert.True(t, cli.blocked)
+
+	s.handleAOFWaiters()
+	assert.Equal(t, 1, len(s.aofWaiters))
+
+	time.Sleep(60 * time.Millisecond)
+	global.UpdateGlobalClock()
+	s.handleAOFWaiters()
+	ret := <-cli.res
+	assert.Equal(t, resp.MakeIntData(0), *ret)
+	assert.False(t, cli.blocked)
+	assert.Empty(t, s.aofWaiters)
+
+	// 从节点确认之后唤醒客户端
+	assert.Nil(t, execCmd(s, cli, "wait", "1", "0"))
+	slave.offset = 100
+	s.handleAOFWaiters()
+	ret = <-cli.res
+	assert.Equal(t, resp.MakeIntData(1), *ret)
+
+	assert.Equal(t, resp.MakeIntData(1), execCmd(s, cli, "wait", "1", "0"))
+	assert.Equal(t, resp.MakeIntData(1), execCmd(s, cli, "wait", "0", "0"))
+
+	s.role = Slave
+	assert.Equal(t, resp.MakeErrorData("ERR WAIT cannot be used with replica instances."), execCmd(s, cli, "wait", "1", "0"))
+}
+
+func TestPropagateExpiredFields(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.InitModules()
+	s.standAloneToMaster()
+	s.StartEvictionNotification()
+	start := s.backLog.HighWaterLevel()
+
+	hash := structure.NewHash()
+	hash.Set("a", structure.Slice("1"))
+	hash.Set("b", structure.Slice("2"))
+	hash.SetFieldTTL("a", global.Now().Unix()-1)
+	s.dbs[0].Update(func() {
+		s.dbs[0].SetKey("h", hash)
+	})
+
+	// 部分 field 过期时以 hdel 的形式传播
+	assert.Equal(t, 1, s.dbs[0].CleanExpiredFields(10))
+	s.handleEvictionNotification()
+	assert.Equal(t, "*2\r\n$6\r\nselect\r\n$1\r\n0\r\n*3\r\n$4\r\nhdel\r\n$1\r\nh\r\n$1\r\na\r\n", string(s.backLog.ReadSince(start)))
+}
+
+func TestPropagateExpire(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.InitModules()
+	s.standAloneToMaster()
+	cli := NewFakeClient()
+
+	s.ProcessCommand(cli, [][]byte{[]byte("set"), []byte("k"), []byte("v")})
+	start := s.backLog.HighWaterLevel()
+
+	// 传播的过期时间是命令执行时计算出的绝对时间
+	assert.Equal(t, resp.MakeIntData(1), s.ProcessCommand(cli, [][]byte{[]byte("expire"), []byte("k"), []byte("100")}))
+	deadline := strconv.FormatInt((s.dbs[0].GetTTL("k")+global.Now().Unix())*1000, 10)
+	assert.Equal(t, "*2\r\n$6\r\nselect\r\n$1\r\n0\r\n*3\r\n$9\r\npexpireat\r\n$1\r\nk\r\n$"+strconv.Itoa(len(deadline))+"\r\n"+deadline+"\r\n",
+		string(s.backLog.ReadSince(start)))
+}
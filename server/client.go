@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"github.com/gofrs/uuid"
 	"github.com/tangrc99/MemTable/db"
 	"github.com/tangrc99/MemTable/db/structure"
@@ -9,6 +10,7 @@ import (
 	"github.com/tangrc99/MemTable/server/acl"
 	"github.com/tangrc99/MemTable/server/global"
 	"net"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -22,6 +24,9 @@ const (
 	ERROR
 )
 
+// clientSeq 用于生成客户端的整数编号，连接协程中同样会创建客户端
+var clientSeq atomic.Int64
+
 type Client struct {
 	parser *resp.Parser
 
@@ -29,62 +34,97 @@ type Client struct {
 	raw []byte               // 当前命令的 resp 格式
 	res chan *resp.RedisData // 回包
 
-	cnn   net.Conn  // 连接实例
-	id    uuid.UUID // Cli 编号
-	tp    time.Time // 通信时间戳
-	dbSeq int
+	cnn       net.Conn     // 连接实例
+	addr      string       // 客户端地址，开启 PROXY 协议时为代理转发的真实地址
+	id        uuid.UUID    // Cli 编号
+	seq       int64        // 递增的整数编号，HELLO 返回的 id
+	tp        time.Time    // 通信时间戳
+	pingAt    time.Time    // 最近一次发送 keepalive PING 的时间
+	pongAt    atomic.Int64 // 最近一次收到 PING 回复的时间，由连接协程写入
+	keepAlive bool         // 是否接收服务端的 keepalive PING，由 client keepalive on 开启
+	dbSeq     int
+	name      string // 客户端名称
+
+	protocol int // 客户端使用的 resp 协议版本，2 或 3
 
-	status ClientStatus // 状态 0 等待连接 1 正常 -1 退出 -2 异常
+	status atomic.Int32 // 状态 0 等待连接 1 正常 -1 退出 -2 异常，连接协程出错时会写入
 
 	pipelined bool
+	quit      bool // 是否执行了 quit 命令，之后到达的命令不会被执行
 
 	user *acl.User // 当前客户端的登录用户，默认为 default
 	auth bool      // 当前用户是否完成了授权
 
 	// 发布订阅
-	chs map[string]struct{} //订阅频道
-	msg chan []byte         // 用于订阅通知
+	chs  map[string]struct{} //订阅频道
+	msg  chan []byte         // 阻塞命令的结果，由连接协程写入 socket
+	push atomic.Bool         // 订阅通知是否使用 resp3 的 push 类型
 
 	// 事务
 	inTx    bool             // 是否处于事务中
 	tx      [][][]byte       // 用于解析后的命令
 	txRaw   [][]byte         // 解析前的命令
+	txDirty bool             // 入队时是否发生了错误，为 true 时 EXEC 会放弃整个事务
 	watched map[int][]string //记录监控的键值
 	revised bool             //监控是否被修改
 
+	// 客户端缓存
+	tracking trackingState
+
 	// 阻塞监听
-	blocked   bool // 客户端是否执行阻塞等待的命令
-	monitored bool
+	blocked     bool     // 客户端是否执行阻塞等待的命令
+	blockedKeys []string // blpop 等命令阻塞等待的键，用于 client unblock 取消等待
+	monitored   bool
 
 	// 主从复制
 	SlaveStatus
 }
 
 func NewClient(conn net.Conn) *Client {
-	return &Client{
-		parser:  resp.NewParser(conn),
-		cnn:     conn,
-		id:      uuid.Must(uuid.NewV1()),
-		tp:      global.Now,
-		status:  WAIT,
-		dbSeq:   0,
-		res:     make(chan *resp.RedisData, 10),
-		user:    acl.DefaultUser(),
-		auth:    false,
-		blocked: false,
+	cli := &Client{
+		parser:   resp.NewParser(conn),
+		cnn:      conn,
+		id:       uuid.Must(uuid.NewV1()),
+		seq:      clientSeq.Add(1),
+		tp:       global.Now(),
+		dbSeq:    0,
+		protocol: 2,
+		res:      make(chan *resp.RedisData, 10),
+		msg:      make(chan []byte, 10),
+		user:     acl.DefaultUser(),
+		auth:     false,
+		blocked:  false,
 	}
+	if conn != nil {
+		cli.addr = conn.RemoteAddr().String()
+	}
+	return cli
 }
 
 // NewFakeClient 创建一个无连接的，具有最高权限的客户端
 func NewFakeClient() *Client {
-	return &Client{
-		id:     uuid.Must(uuid.NewV1()),
-		status: CONNECTED,
-		dbSeq:  0,
-		res:    make(chan *resp.RedisData, 10),
-		auth:   true,
-		user:   acl.ManageUser(),
+	cli := &Client{
+		id:       uuid.Must(uuid.NewV1()),
+		seq:      clientSeq.Add(1),
+		dbSeq:    0,
+		protocol: 2,
+		res:      make(chan *resp.RedisData, 10),
+		msg:      make(chan []byte, 10),
+		auth:     true,
+		user:     acl.ManageUser(),
 	}
+	cli.setStatus(CONNECTED)
+	return cli
+}
+
+// getStatus 返回客户端当前的状态
+func (cli *Client) getStatus() ClientStatus {
+	return ClientStatus(cli.status.Load())
+}
+
+// setStatus 修改客户端的状态
+func (cli *Client) setStatus(status ClientStatus) {
+	cli.status.Store(int32(status))
 }
 
 func (cli *Client) ParseStream() *resp.ParsedRes {
@@ -99,10 +139,10 @@ func (cli *Client) Subscribe(chs *db.Channels, channel string) int {
 
 	if cli.chs == nil {
 		cli.chs = make(map[string]struct{})
-		cli.msg = make(chan []byte, 10)
 	}
+	cli.push.Store(cli.protocol == 3)
 
-	chs.Subscribe(channel, cli.id.String(), &cli.msg)
+	chs.Subscribe(channel, cli.id.String(), cli.deliver)
 	cli.chs[channel] = struct{}{}
 	return len(cli.chs)
 }
@@ -120,8 +160,45 @@ func (cli *Client) UnSubscribeAll(chs *db.Channels) {
 	cli.chs = make(map[string]struct{})
 }
 
+// pubSubMessage 按照订阅时的协议版本返回订阅通知的格式。发布的消息是 resp2 的数组格式，
+// resp3 客户端使用 push 类型，两者只有类型标识不同
+func (cli *Client) pubSubMessage(msg []byte) []byte {
+	if !cli.push.Load() || len(msg) == 0 || msg[0] != '*' {
+		return msg
+	}
+	pushed := make([]byte, len(msg))
+	copy(pushed, msg)
+	pushed[0] = '>'
+	return pushed
+}
+
+// deliver 将订阅通知放入回包队列。通知与命令的回复使用同一个队列，因此会按照在事件循环中产生的顺序写入 socket。
+// 收到通知的客户端视为活跃，会更新通信时间戳
+func (cli *Client) deliver(msg []byte) {
+	cli.tp = global.Now()
+	reply := resp.RedisData(pubSubReply(cli.pubSubMessage(msg)))
+	cli.res <- &reply
+}
+
+// pubSubReply 是已经编码完成的订阅通知
+type pubSubReply []byte
+
+func (r pubSubReply) ToBytes() []byte {
+	return r
+}
+
+func (r pubSubReply) ByteData() []byte {
+	return r
+}
+
+// subscribed 判断客户端是否处于 resp2 的订阅状态，此时只允许执行订阅相关的命令
+func (cli *Client) subscribed() bool {
+	return len(cli.chs) > 0 && cli.protocol != 3
+}
+
 func (cli *Client) InitTX() {
 	cli.inTx = true
+	cli.txDirty = false
 	cli.tx = make([][][]byte, 0, 20)
 	cli.txRaw = make([][]byte, 0, 20)
 }
@@ -143,6 +220,46 @@ func (cli *Client) IsRemovable() bool {
 	return !cli.inTx && !cli.monitored && cli.slaveStatus == slaveNot
 }
 
+// waiting 判断客户端是否在等待订阅通知或者阻塞命令的结果，这类客户端长时间没有发送命令也不是空闲的
+func (cli *Client) waiting() bool {
+	return cli.blocked || len(cli.chs) > 0
+}
+
+// flags 返回 client list 命令中的客户端标识，与 redis 相同：b 阻塞等待，x 处于事务中，P 订阅了频道，
+// O 执行了 monitor，S 是从节点，没有任何标识时为 N
+func (cli *Client) flags() string {
+	flags := ""
+	if cli.blocked {
+		flags += "b"
+	}
+	if cli.inTx {
+		flags += "x"
+	}
+	if len(cli.chs) > 0 {
+		flags += "P"
+	}
+	if cli.monitored {
+		flags += "O"
+	}
+	if cli.slaveStatus != slaveNot {
+		flags += "S"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	return flags
+}
+
+// info 返回 client list 命令中的一行客户端信息
+func (cli *Client) info() string {
+	multi := -1
+	if cli.inTx {
+		multi = len(cli.tx)
+	}
+	return fmt.Sprintf("id=%s addr=%s name=%s db=%d idle=%d flags=%s sub=%d multi=%d", cli.id.String(), cli.addr,
+		cli.name, cli.dbSeq, int64(global.Now().Sub(cli.tp).Seconds()), cli.flags(), len(cli.chs), multi)
+}
+
 func (cli *Client) Cost() int64 {
 	return int64(unsafe.Sizeof(Client{}))
 }
@@ -150,6 +267,7 @@ func (cli *Client) Cost() int64 {
 type ClientList struct {
 	list    *structure.List
 	UUIDSet map[uuid.UUID]*structure.ListNode // 用于判断是否为新链接
+	size    atomic.Int64                      // 链表长度，接收连接的协程也会读取
 }
 
 func NewClientList() *ClientList {
@@ -171,21 +289,28 @@ func (clients *ClientList) AddClientIfNotExist(cli *Client) bool {
 		return false
 	}
 
-	cli.status = CONNECTED
+	cli.setStatus(CONNECTED)
 	// 将客户端加入到链表头
 	clients.list.PushFront(cli)
 	clients.UUIDSet[cli.id] = clients.list.FrontNode()
+	clients.size.Store(int64(clients.list.Size()))
 	return true
 }
 
 // removeClientWithPosition 给定客户端指针和链表位置，删除逻辑最终定位到这里
 func (clients *ClientList) removeClientWithPosition(cli *Client, node *structure.ListNode) {
 	logger.Debug("ClientList: Remove Client", cli.id)
-	cli.status = EXIT
-	cli.parser.Stop()
+	cli.setStatus(EXIT)
 	clients.list.RemoveNode(node)
+	clients.size.Store(int64(clients.list.Size()))
 	delete(clients.UUIDSet, cli.id)
-	_ = cli.cnn.Close()
+	// 无连接的客户端没有解析器以及连接实例
+	if cli.parser != nil {
+		cli.parser.Stop()
+	}
+	if cli.cnn != nil {
+		_ = cli.cnn.Close()
+	}
 }
 
 // RemoveClient 不知道具体位置时，需要遍历
@@ -204,10 +329,11 @@ func (clients *ClientList) RemoveClient(cli *Client) {
 }
 
 // RemoveLongNotUsed 会尝试移除活跃时大于 d 的客户端连接，在遍历 maxTraverse 或删除 maxRemove 后函数停止。
+// 订阅了频道以及处于阻塞等待的客户端不会被移除
 func (clients *ClientList) RemoveLongNotUsed(maxRemove, maxTraverse int, d time.Duration) {
 
 	// 早于该时间的视为过期
-	expired := global.Now.Add(-1 * d)
+	expired := global.Now().Add(-1 * d)
 
 	// 客户端列表尾端的时间戳会减小
 	for node := clients.list.BackNode(); node != nil && maxRemove >= 0 && maxTraverse >= 0; {
@@ -218,9 +344,10 @@ func (clients *ClientList) RemoveLongNotUsed(maxRemove, maxTraverse int, d time.
 			logger.Error("ClientList: type is not Client")
 			prev := node.Prev()
 			clients.list.RemoveNode(node)
+			clients.size.Store(int64(clients.list.Size()))
 			node = prev
 
-		} else if cli.IsRemovable() && cli.tp.Before(expired) {
+		} else if cli.IsRemovable() && !cli.waiting() && cli.tp.Before(expired) {
 			// 清理过期和失效客户端
 			prev := node.Prev()
 			clients.removeClientWithPosition(cli, node)
@@ -235,7 +362,7 @@ func (clients *ClientList) RemoveLongNotUsed(maxRemove, maxTraverse int, d time.
 }
 
 func (clients *ClientList) Size() int {
-	return clients.list.Size()
+	return int(clients.size.Load())
 }
 
 func (clients *ClientList) UpdateTimestamp(cli *Client) {
@@ -250,7 +377,7 @@ func (clients *ClientList) UpdateTimestamp(cli *Client) {
 	}
 
 	// 更新客户端列表，并且将其移动到首部
-	cli.tp = global.Now
+	cli.tp = global.Now()
 	clients.list.RemoveNode(node)
 	clients.list.PushFront(cli)
 }
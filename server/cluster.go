@@ -35,8 +35,8 @@ func acceptNewClusterNode(conn net.Conn) *clusterNode {
 		name:     conn.RemoteAddr().String(),
 		alive:    true,
 		peer:     NewClient(conn),
-		pingTime: global.Now,
-		pongTime: global.Now,
+		pingTime: global.Now(),
+		pongTime: global.Now(),
 		slaves:   make([]*clusterNode, 0),
 	}
 	return node
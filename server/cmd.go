@@ -1,8 +1,8 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
-	"github.com/tangrc99/MemTable/config"
 	"github.com/tangrc99/MemTable/db"
 	_ "github.com/tangrc99/MemTable/db/cmd"
 	"github.com/tangrc99/MemTable/logger"
@@ -28,6 +28,16 @@ func RegisterCommand(name string, cmd Command, status ExecStatus) {
 	global.RegisterServerCommand(name, cmd, status)
 }
 
+// RenameCommands 根据 rename-command 配置重命名或者禁用命令，需要在接受连接之前调用
+func RenameCommands(renames [][2]string) error {
+	for _, r := range renames {
+		if !global.RenameCommand(r[0], r[1]) {
+			return fmt.Errorf("rename-command: can not rename '%s' to '%s'", r[0], r[1])
+		}
+	}
+	return nil
+}
+
 func init() {
 	registerPubSubCommands()
 	registerConnectionCommands()
@@ -37,10 +47,29 @@ func init() {
 	registerScriptCommands()
 	registerClusterCommand()
 	registerAuthCommands()
+	registerDebugCommands()
 }
 
 func execCommand(c global.Command, server *Server, cli *Client, cmds [][]byte) resp.RedisData {
 
+	server.sts.totalCommandsProcessed.Add(1)
+
+	// 具有子命令的命令自动支持 HELP 子命令
+	if len(cmds) == 2 && strings.ToLower(string(cmds[1])) == "help" {
+		if help := c.Help(); help != nil {
+			lines := make([]resp.RedisData, len(help))
+			for i := range help {
+				lines[i] = resp.MakeStringData(help[i])
+			}
+			return resp.MakeArrayData(lines)
+		}
+	}
+
+	// 参数格式错误时在执行之前返回统一的错误信息
+	if err := c.CheckArgs(cmds); err != nil {
+		return resp.MakeErrorData(err.Error())
+	}
+
 	f := c.Function()
 
 	if c.Type() == CTDatabase {
@@ -49,7 +78,17 @@ func execCommand(c global.Command, server *Server, cli *Client, cmds [][]byte) r
 			logger.Errorf("Error command type %d with %s", c.Type(), reflect.TypeOf(c.Function()).String())
 			return resp.MakeErrorData("Err Server Error")
 		}
-		return df(server.dbs[cli.dbSeq], cmds)
+		// 数据库命令在持有写锁的情况下执行，保证后台协程读取到的数据是一致的，只读命令会统计键的命中情况
+		var ret resp.RedisData
+		dataBase := server.dbs[cli.dbSeq]
+		run := dataBase.Lookup
+		if c.IsWriteCommand() {
+			run = dataBase.Update
+		}
+		run(func() {
+			ret = df(dataBase, cmds)
+		})
+		return ret
 
 	} else if c.Type() == CTServer {
 
@@ -69,12 +108,37 @@ func execCommand(c global.Command, server *Server, cli *Client, cmds [][]byte) r
 func ExecCommand(server *Server, cli *Client, cmds [][]byte, raw []byte) (ret resp.RedisData, dirty bool) {
 
 	if len(cmds) == 0 {
-		return resp.MakeErrorData("error: empty command"), false
+		return rejectInTx(cli, resp.MakeErrorData("error: empty command"))
+	}
+
+	// 空白的命令名称统一显示为空字符串
+	if len(bytes.TrimSpace(cmds[0])) == 0 {
+		return rejectInTx(cli, resp.UnknownCommandError("", cmds[1:]))
+	}
+
+	// 判断命令是否存在
+	c, ok := global.FindCommand(strings.ToLower(string(cmds[0])))
+
+	if !ok {
+		return rejectInTx(cli, resp.UnknownCommandError(string(cmds[0]), cmds[1:]))
+	}
+
+	// 通过 rename-command 重命名的命令在执行时使用原始名称，执行完毕后恢复，保证写入 aof 的命令能够被重新执行
+	commandName := c.Name()
+	if name := cmds[0]; string(name) != commandName {
+		cmds[0] = []byte(commandName)
+		defer func() { cmds[0] = name }()
+	}
+
+	// resp2 客户端在订阅状态下只能执行订阅相关的命令
+	if cli.subscribed() && !subscribedCommands[commandName] {
+		return rejectInTx(cli, resp.MakeErrorData(fmt.Sprintf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / "+
+			"(P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", commandName)))
 	}
 
 	// 判断是否需要转移错误
 	if allowed, err := checkCommandRunnableInCluster(server, cli, cmds); !allowed {
-		return err, false
+		return rejectInTx(cli, err)
 	}
 
 	// 判断是否允许在脚本环境下运行
@@ -82,55 +146,62 @@ func ExecCommand(server *Server, cli *Client, cmds [][]byte, raw []byte) (ret re
 		return resp.MakeErrorData("BUSY running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE"), false
 	}
 
-	commandName := strings.ToLower(string(cmds[0]))
-
-	// 判断命令是否存在
-	c, ok := global.FindCommand(commandName)
-
-	if !ok {
-		return resp.MakeErrorData("error: unsupported command"), false
-	}
-
 	// 判断是否有权限访问
-	passed := checkAuthority(cli, commandName)
-	if !passed {
-		return resp.MakeErrorData("ERR operation not permitted"), false
+	passed := checkAuthority(cli, c)
+	if !passed || !checkKeyAuthority(cli, c, cmds) {
+		return rejectInTx(cli, resp.MakeErrorData("ERR operation not permitted"))
 	}
 
 	writeAllowed := !(server.role == Slave && cli != server.Master)
 
 	if c.IsWriteCommand() && !writeAllowed {
-		return resp.MakeErrorData("ERR READONLY You can't write against a read only slave"), false
+		return rejectInTx(cli, resp.MakeErrorData("ERR READONLY You can't write against a read only slave"))
 	}
 
-	// 如果正在事务中
-	if cli.inTx && NotTxCommand(strings.ToLower(string(cmds[0]))) {
+	// 如果正在事务中，参数数量错误在入队时就能够发现，其余错误在执行时返回
+	if cli.inTx && NotTxCommand(commandName) {
+		if !c.CheckArity(len(cmds)) {
+			return rejectInTx(cli, resp.WrongArgsError(commandName))
+		}
 		cli.tx = append(cli.tx, cmds)
 		cli.txRaw = append(cli.txRaw, raw)
 		return resp.MakeStringData("QUEUED"), false
 	}
 
-	// check before write
-	access := int64(0)
-	if server.full && c.IsWriteCommand() {
-		access = server.dbs[cli.dbSeq].IsKeyPermitted(string(cmds[1]))
-		if access == -1 {
-			// 拒绝写入
-			return resp.MakeErrorData("ERR database is full"), false
+	// 内存不足时，在执行写命令之前按照淘汰策略释放内存
+	if server.full && c.IsWriteCommand() && !oomAllowedCommands[commandName] {
+		if !server.freeMemoryIfNeeded(cli.dbSeq) {
+			return resp.MakeErrorData("OOM command not allowed when used memory > 'maxmemory'."), false
 		}
 	}
 
 	ret = execCommand(c, server, cli, cmds)
 
+	// 通知 client tracking 的客户端
+	server.trackCommand(c, cli, cmds, ret)
+
 	// 更新 cost
 	server.collectCost()
-	if server.full {
-		server.dbs[cli.dbSeq].Evict(access, server.cost-int64(config.Conf.MaxMemory))
-	}
 
 	return ret, c.IsWriteCommand()
 }
 
+// subscribedCommands 是 resp2 客户端在订阅状态下允许执行的命令
+var subscribedCommands = map[string]bool{
+	"subscribe":   true,
+	"unsubscribe": true,
+	"ping":        true,
+	"quit":        true,
+	"reset":       true,
+}
+
+// oomAllowedCommands 是内存不足时仍然允许执行的写命令，这些命令只会释放内存
+var oomAllowedCommands = map[string]bool{
+	"del":      true,
+	"flushdb":  true,
+	"flushall": true,
+}
+
 func CheckCommandAndLength(cmd [][]byte, name string, minLength int) (resp.RedisData, bool) {
 	cmdName := strings.ToLower(string((cmd)[0]))
 	if cmdName != name {
@@ -138,14 +209,22 @@ func CheckCommandAndLength(cmd [][]byte, name string, minLength int) (resp.Redis
 	}
 
 	if len(cmd) < minLength {
-		return resp.MakeErrorData(fmt.Sprintf("ERR wrong number of arguments for '%s' command", (cmd)[0])), false
+		return resp.WrongArgsError(name), false
 	}
 
 	return nil, true
 }
 
-func checkAuthority(cli *Client, commandName string) bool {
-	if commandName == "auth" {
+// rejectInTx 返回命令入队之前发现的错误，事务中发生这类错误时整个事务会在 EXEC 时被放弃
+func rejectInTx(cli *Client, err resp.RedisData) (resp.RedisData, bool) {
+	if cli.inTx {
+		cli.txDirty = true
+	}
+	return err, false
+}
+
+func checkAuthority(cli *Client, c global.Command) bool {
+	if c.Name() == "auth" || c.Name() == "hello" {
 		return true
 	}
 
@@ -153,11 +232,34 @@ func checkAuthority(cli *Client, commandName string) bool {
 		// 防止无密码账号修改密码，影响登录状态
 		cli.auth = true
 		// 已经授权，检查是否符合条件
-		return cli.user.IsCommandAllowed(commandName)
+		return cli.user.IsAllowed(c)
 	}
 	return false
 }
 
+// checkKeyAuthority 检查用户是否能够访问命令中的全部键
+func checkKeyAuthority(cli *Client, c global.Command, cmds [][]byte) bool {
+	for _, key := range commandKeys(c, cmds) {
+		if !cli.user.IsKeyAccessible(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// commandKeys 返回命令中的全部键
+func commandKeys(c global.Command, cmds [][]byte) []string {
+	positions, ok := c.GetKeys(cmds)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, len(positions))
+	for i, pos := range positions {
+		keys[i] = string(cmds[pos])
+	}
+	return keys
+}
+
 func NotTxCommand(cmd string) bool {
-	return cmd != "exec" && cmd != "discard" && cmd != "watch" && cmd != "multi"
+	return cmd != "exec" && cmd != "discard" && cmd != "watch" && cmd != "multi" && cmd != "reset"
 }
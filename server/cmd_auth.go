@@ -99,7 +99,7 @@ func aclCat() {
 
 func aclDelUser(server *Server, cmd [][]byte) resp.RedisData {
 	if len(cmd) < 3 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'acl getuser' command")
+		return resp.WrongArgsError("acl getuser")
 	}
 	userName := string(cmd[2])
 
@@ -116,7 +116,7 @@ func aclDelUser(server *Server, cmd [][]byte) resp.RedisData {
 // aclDryRun 是 acl dryrun 命令的实现，用于判断一个命令能否在当前用户下执行
 func aclDryRun(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	if len(cmd) < 3 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'acl getuser' command")
+		return resp.WrongArgsError("acl getuser")
 	}
 	if !cli.user.IsOn() {
 
@@ -138,7 +138,7 @@ func aclGenPass() {
 
 func aclGetUser(server *Server, cmd [][]byte) resp.RedisData {
 	if len(cmd) < 3 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'acl getuser' command")
+		return resp.WrongArgsError("acl getuser")
 	}
 	userName := string(cmd[2])
 	user, exist := server.acl.FindUser(userName)
@@ -181,7 +181,7 @@ func aclSave(server *Server) resp.RedisData {
 func aclSetUser(server *Server, cmd [][]byte) resp.RedisData {
 	args := cmd[2:]
 	if len(args) == 0 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'acl setuser' command")
+		return resp.WrongArgsError("acl setuser")
 	}
 	userName := strings.ToLower(string(args[0]))
 	if err := server.acl.SetupUser(userName, args[1:]); err != nil {
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/utils"
+	"testing"
+)
+
+func TestACLSetUser(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+
+	admin := NewFakeClient()
+	cli := NewClient(nil)
+
+	// 创建只读用户，密码以及键的模式区分大小写
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, admin, "acl", "setuser", "reader", "on", ">Secret", "~^app:", "+@read"))
+	assert.Contains(t, string(execCmd(s, admin, "acl", "list").ToBytes()),
+		"user reader on #"+utils.Sha256String([]byte("Secret"))+" ~^app: +@read\r\n")
+
+	assert.Equal(t, resp.MakeErrorData("ERR invalid password"), execCmd(s, cli, "auth", "reader", "secret"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "auth", "reader", "Secret"))
+	assert.Equal(t, resp.MakeBulkData([]byte("reader")), execCmd(s, cli, "acl", "whoami"))
+
+	// 只允许读命令以及匹配模式的键
+	assert.Equal(t, resp.MakeStringData("nil"), execCmd(s, cli, "get", "app:1"))
+	assert.Equal(t, resp.MakeErrorData("ERR operation not permitted"), execCmd(s, cli, "set", "app:1", "v"))
+	assert.Equal(t, resp.MakeErrorData("ERR operation not permitted"), execCmd(s, cli, "get", "other"))
+	assert.Equal(t, resp.MakeErrorData("ERR operation not permitted"), execCmd(s, cli, "mget", "app:1", "other"))
+
+	// 修改权限之后立即生效
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, admin, "acl", "setuser", "reader", "+set"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "set", "app:1", "v"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, admin, "acl", "setuser", "reader", "-set"))
+	assert.Equal(t, resp.MakeErrorData("ERR operation not permitted"), execCmd(s, cli, "set", "app:1", "v"))
+
+	// 设置失败时不会修改或者创建用户
+	assert.Equal(t, resp.MakeErrorData("Err command not exists 'nosuchcommand'"), execCmd(s, admin, "acl", "setuser", "reader", "+set", "+nosuchcommand"))
+	assert.Equal(t, resp.MakeErrorData("ERR operation not permitted"), execCmd(s, cli, "set", "app:1", "v"))
+	assert.Equal(t, resp.MakeErrorData("Err category not exists 'none'"), execCmd(s, admin, "acl", "setuser", "other", "+@none"))
+	assert.Equal(t, resp.MakeEmptyArrayData(), execCmd(s, admin, "acl", "getuser", "other"))
+
+	// 关闭的用户无法登录
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, admin, "acl", "setuser", "reader", "off"))
+	assert.Equal(t, resp.MakeErrorData("Err user not exists 'reader'"), execCmd(s, NewClient(nil), "auth", "reader", "Secret"))
+}
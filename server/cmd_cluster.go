@@ -17,7 +17,7 @@ func cluster(s *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	}
 
 	if s.clusterStatus.state == ClusterNone {
-		return resp.MakeErrorData("ERR This instance has cluster support disabled")
+		return clusterStandalone(s, cmd)
 	}
 
 	switch strings.ToLower(string(cmd[1])) {
@@ -42,13 +42,50 @@ func cluster(s *Server, _ *Client, cmd [][]byte) resp.RedisData {
 
 }
 
+// clusterStandalone 在未开启集群时回复 cluster 命令。部分客户端在连接时会探测集群信息，
+// 因此 info 以及 slots 需要返回单机模式下的结果，而不是报错
+func clusterStandalone(s *Server, cmd [][]byte) resp.RedisData {
+
+	switch strings.ToLower(string(cmd[1])) {
+
+	case "info":
+		return resp.MakeBulkData([]byte("cluster_enabled:0\r\n" +
+			"cluster_state:ok\r\n" +
+			"cluster_slots_assigned:0\r\n" +
+			"cluster_slots_ok:0\r\n" +
+			"cluster_known_nodes:1\r\n" +
+			"cluster_size:0\r\n"))
+
+	case "slots", "shards":
+		return resp.MakeEmptyArrayData()
+
+	case "keyslot":
+		return clusterKeySlot(s, cmd)
+	}
+
+	return resp.MakeErrorData("ERR This instance has cluster support disabled")
+}
+
+// asking 以及 readonly、readwrite 只在集群模式中有意义，这里作为空操作以兼容客户端
+func asking(_ *Server, _ *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, strings.ToLower(string(cmd[0])), 1)
+	if !ok {
+		return e
+	}
+	return resp.MakeStringData("OK")
+}
+
 func registerClusterCommand() {
 	RegisterCommand("cluster", cluster, RD)
+	RegisterCommand("asking", asking, RD)
+	RegisterCommand("readonly", asking, RD)
+	RegisterCommand("readwrite", asking, RD)
 }
 
 // clusterForbiddenTable 记录集群中不允许运行的命令
 var clusterForbiddenTable = map[string]struct{}{
-	"keys": {}, "select": {}, "mget": {}, "mset": {}, "randomkey": {},
+	"keys": {}, "select": {}, "mget": {}, "mset": {}, "randomkey": {}, "swapdb": {}, "move": {},
 }
 
 func clusterInfo(s *Server, _ [][]byte) resp.RedisData {
@@ -69,7 +106,7 @@ func clusterNodes(s *Server, _ [][]byte) resp.RedisData {
 func clusterKeySlot(s *Server, cmd [][]byte) resp.RedisData {
 
 	if len(cmd) < 3 {
-		return resp.MakeErrorData(fmt.Sprintf("ERR wrong number of arguments for '%s' command", (cmd)[1]))
+		return resp.WrongArgsError(string(cmd[1]))
 	}
 
 	return resp.MakeIntData(int64(s.getSlot(string(cmd[2]))))
@@ -78,7 +115,7 @@ func clusterKeySlot(s *Server, cmd [][]byte) resp.RedisData {
 func clusterCountKeysInSlot(s *Server, cmd [][]byte) resp.RedisData {
 
 	if len(cmd) < 3 {
-		return resp.MakeErrorData(fmt.Sprintf("ERR wrong number of arguments for '%s' command", (cmd)[1]))
+		return resp.WrongArgsError(string(cmd[1]))
 	}
 
 	slotSeq, err := strconv.Atoi(string(cmd[2]))
@@ -99,7 +136,7 @@ func clusterCountKeysInSlot(s *Server, cmd [][]byte) resp.RedisData {
 func clusterGetKeysInSlot(s *Server, cmd [][]byte) resp.RedisData {
 
 	if len(cmd) < 3 {
-		return resp.MakeErrorData(fmt.Sprintf("ERR wrong number of arguments for '%s' command", (cmd)[1]))
+		return resp.WrongArgsError(string(cmd[1]))
 	}
 
 	slotSeq, err := strconv.Atoi(string(cmd[2]))
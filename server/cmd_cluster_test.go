@@ -0,0 +1,28 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/utils"
+	"strings"
+	"testing"
+)
+
+func TestClusterStandalone(t *testing.T) {
+	s := newExecServer(t)
+
+	info, ok := execCmd(s, nil, "cluster", "info").(*resp.BulkData)
+	assert.True(t, ok)
+	assert.True(t, strings.HasPrefix(string(info.Data()), "cluster_enabled:0\r\n"))
+	assert.Contains(t, string(info.Data()), "cluster_state:ok\r\n")
+
+	assert.Equal(t, resp.MakeEmptyArrayData(), execCmd(s, nil, "cluster", "slots"))
+	assert.Equal(t, resp.MakeEmptyArrayData(), execCmd(s, nil, "CLUSTER", "SHARDS"))
+	assert.Equal(t, resp.MakeIntData(int64(utils.HashKey("k")%slotNum)), execCmd(s, nil, "cluster", "keyslot", "k"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR This instance has cluster support disabled"), execCmd(s, nil, "cluster", "nodes"))
+
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, nil, "asking"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, nil, "readonly"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, nil, "readwrite"))
+}
@@ -1,8 +1,14 @@
 package server
 
 import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/tangrc99/MemTable/config"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/acl"
+	"github.com/tangrc99/MemTable/server/global"
 	"strconv"
+	"strings"
 )
 
 func ping(_ *Server, _ *Client, cmd [][]byte) resp.RedisData {
@@ -26,9 +32,26 @@ func quit(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	server.clis.RemoveClient(cli)
+	// 没有连接的客户端可以直接移除
+	if cli.cnn == nil {
+		server.clis.RemoveClient(cli)
+		return resp.MakeStringData("OK")
+	}
+
+	// 之前的回包发送完毕之后再由连接协程关闭连接，之后到达的命令不会再执行
+	cli.quit = true
+	return &quitReply{resp.MakeStringData("OK")}
+}
 
-	return resp.MakeStringData("")
+// quitReply 是 quit 命令的回复，连接协程写入该回复之后会关闭连接
+type quitReply struct {
+	resp.RedisData
+}
+
+// isQuitReply 判断回复是否为 quit 命令的回复
+func isQuitReply(data resp.RedisData) bool {
+	_, ok := data.(*quitReply)
+	return ok
 }
 
 func selectDB(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
@@ -40,7 +63,7 @@ func selectDB(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 
 	dbSeq, err := strconv.Atoi(string(cmd[1]))
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	if dbSeq >= server.dbNum {
@@ -52,8 +75,247 @@ func selectDB(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	return resp.MakeStringData("OK")
 }
 
+// hello 命令格式： hello [protover [AUTH username password] [SETNAME clientname]]
+func hello(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "hello", 1)
+	if !ok {
+		return e
+	}
+
+	protocol := cli.protocol
+	name := cli.name
+	var credentials [][]byte
+
+	if len(cmd) > 1 {
+		ver, err := strconv.Atoi(string(cmd[1]))
+		if err != nil {
+			return resp.MakeErrorData("ERR Protocol version is not an integer or out of range")
+		}
+		if ver != 2 && ver != 3 {
+			return resp.MakeErrorData("NOPROTO unsupported protocol version")
+		}
+		protocol = ver
+	}
+
+	// 先检查所有的选项，全部合法之后才会修改客户端的状态
+	for i := 2; i < len(cmd); i++ {
+
+		opt := strings.ToLower(string(cmd[i]))
+
+		if opt == "auth" && i+2 < len(cmd) {
+
+			credentials = cmd[i+1 : i+3]
+			i += 2
+
+		} else if opt == "setname" && i+1 < len(cmd) {
+
+			name = string(cmd[i+1])
+			if strings.ContainsAny(name, " \n") {
+				return resp.MakeErrorData("ERR Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+
+		} else {
+			return resp.MakeErrorData("ERR Syntax error in HELLO option '" + string(cmd[i]) + "'")
+		}
+	}
+
+	if credentials != nil {
+		ret := auth(server, cli, [][]byte{[]byte("auth"), credentials[0], credentials[1]})
+		if err, isErr := ret.(*resp.ErrorData); isErr {
+			return err
+		}
+	} else if !cli.auth && cli.user.HasPassword() {
+		return resp.MakeErrorData("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+
+	cli.protocol = protocol
+	cli.name = name
+
+	mode := "standalone"
+	if config.Conf.ClusterEnable {
+		mode = "cluster"
+	}
+	role := "master"
+	if server.role == Slave {
+		role = "slave"
+	}
+
+	m := resp.MakeMapData([]resp.RedisData{
+		resp.MakeBulkData([]byte("server")), resp.MakeBulkData([]byte("memtable")),
+		resp.MakeBulkData([]byte("version")), resp.MakeBulkData([]byte(global.Version)),
+		resp.MakeBulkData([]byte("proto")), resp.MakeIntData(int64(protocol)),
+		resp.MakeBulkData([]byte("id")), resp.MakeIntData(cli.seq),
+		resp.MakeBulkData([]byte("mode")), resp.MakeBulkData([]byte(mode)),
+		resp.MakeBulkData([]byte("role")), resp.MakeBulkData([]byte(role)),
+		resp.MakeBulkData([]byte("modules")), resp.MakeEmptyArrayData(),
+	})
+
+	// RESP2 客户端没有 map 类型，使用 key value 交替的数组代替
+	if protocol == 2 {
+		return m.ToArray()
+	}
+	return m
+}
+
+// client 命令格式： client list | client kill ip:port | client kill addr ip:port | client tracking on|off [options]
+func client(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "client", 2)
+	if !ok {
+		return e
+	}
+
+	switch strings.ToLower(string(cmd[1])) {
+	case "list":
+		if len(cmd) != 2 {
+			return resp.SyntaxError()
+		}
+		b := strings.Builder{}
+		for node := server.clis.list.FrontNode(); node != nil; node = node.Next() {
+			b.WriteString(node.Value.(*Client).info())
+			b.WriteString("\n")
+		}
+		return resp.MakeBulkData([]byte(b.String()))
+
+	case "kill":
+		var addr string
+		if len(cmd) == 3 {
+			addr = string(cmd[2])
+		} else if len(cmd) == 4 && strings.ToLower(string(cmd[2])) == "addr" {
+			addr = string(cmd[3])
+		} else {
+			return resp.SyntaxError()
+		}
+
+		for node := server.clis.list.FrontNode(); node != nil; node = node.Next() {
+			if c := node.Value.(*Client); c.addr == addr {
+				server.clis.removeClientWithPosition(c, node)
+				return resp.MakeStringData("OK")
+			}
+		}
+		return resp.MakeErrorData("ERR No such client")
+
+	case "tracking":
+		return clientTracking(server, cli, cmd)
+
+	case "unblock":
+		return clientUnblock(server, cmd)
+
+	case "keepalive":
+		return clientKeepAlive(cli, cmd)
+
+	case "pause":
+		return clientPause(server, cmd)
+
+	case "unpause":
+		return clientUnpause(server, cmd)
+	}
+
+	return resp.MakeErrorData(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", cmd[1]))
+}
+
+// clientKeepAlive 命令格式： client keepalive on|off。开启后服务端会在连接空闲时发送 PING，客户端需要回复 PONG，
+// 否则会在错过 keepalive 窗口之后被断开。没有开启的客户端不会收到 PING，只依赖 TCP keepalive 检测失效的连接
+func clientKeepAlive(cli *Client, cmd [][]byte) resp.RedisData {
+
+	if len(cmd) != 3 {
+		return resp.WrongArgsError("client|keepalive")
+	}
+
+	switch strings.ToLower(string(cmd[2])) {
+	case "on":
+		cli.keepAlive = true
+	case "off":
+		cli.keepAlive = false
+	default:
+		return resp.SyntaxError()
+	}
+	return resp.MakeStringData("OK")
+}
+
+// clientUnblock 命令格式： client unblock id [TIMEOUT|ERROR]，唤醒阻塞在 blpop 等命令上的客户端。
+// TIMEOUT 时客户端收到与超时相同的回复，ERROR 时收到 UNBLOCKED 错误。客户端没有阻塞时返回 0
+func clientUnblock(server *Server, cmd [][]byte) resp.RedisData {
+
+	if len(cmd) != 3 && len(cmd) != 4 {
+		return resp.WrongArgsError("client|unblock")
+	}
+
+	reply := resp.RedisData(resp.MakeArrayData(nil))
+	if len(cmd) == 4 {
+		switch strings.ToLower(string(cmd[3])) {
+		case "timeout":
+		case "error":
+			reply = resp.MakeErrorData("UNBLOCKED client unblocked via CLIENT UNBLOCK")
+		default:
+			return resp.MakeErrorData("ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+		}
+	}
+
+	id, err := uuid.FromString(string(cmd[2]))
+	if err != nil {
+		return resp.MakeIntData(0)
+	}
+	node, ok := server.clis.UUIDSet[id]
+	if !ok {
+		return resp.MakeIntData(0)
+	}
+
+	if server.unblockClient(node.Value.(*Client), reply) {
+		return resp.MakeIntData(1)
+	}
+	return resp.MakeIntData(0)
+}
+
+// reset 将客户端恢复到刚建立连接时的状态，用于连接池复用连接
+func reset(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "reset", 1)
+	if !ok {
+		return e
+	}
+	if len(cmd) != 1 {
+		return resp.WrongArgsError("reset")
+	}
+
+	// 放弃事务以及监控的键
+	cli.inTx = false
+	cli.txDirty = false
+	cli.tx = make([][][]byte, 0)
+	cli.txRaw = make([][]byte, 0)
+	for dbSeq, keys := range cli.watched {
+		for _, key := range keys {
+			server.dbs[dbSeq].UnWatch(key, &cli.revised)
+		}
+	}
+	cli.ClearWatchers()
+
+	cli.UnSubscribeAll(server.Chs)
+	server.tracking.disable(cli)
+
+	cli.dbSeq = 0
+	cli.name = ""
+	cli.protocol = 2
+	cli.keepAlive = false
+
+	// 网络客户端需要重新以默认用户登录，无连接的内部客户端保持原有权限
+	if cli.cnn != nil {
+		cli.user = acl.DefaultUser()
+		cli.auth = false
+	}
+
+	return resp.MakeStringData("RESET")
+}
+
 func registerConnectionCommands() {
 	RegisterCommand("ping", ping, RD)
 	RegisterCommand("quit", quit, RD)
 	RegisterCommand("select", selectDB, RD)
+	RegisterCommand("hello", hello, RD)
+	RegisterCommand("client", client, RD)
+	RegisterCommand("reset", reset, RD)
 }
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHello(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+	s := NewServer()
+	cli := NewFakeClient()
+
+	// 无参数时返回当前设置，RESP2 下使用数组代替 map
+	r := hello(s, cli, [][]byte{[]byte("hello")})
+	arr, ok := r.(*resp.ArrayData)
+	assert.True(t, ok)
+	assert.Equal(t, 14, len(arr.Data()))
+	assert.Equal(t, "server", string(arr.Data()[0].ByteData()))
+	assert.Equal(t, "proto", string(arr.Data()[4].ByteData()))
+	assert.Equal(t, resp.MakeIntData(2), arr.Data()[5])
+	assert.True(t, strings.HasPrefix(string(r.ToBytes()), "*14\r\n"))
+
+	assert.Equal(t, resp.MakeErrorData("NOPROTO unsupported protocol version"),
+		hello(s, cli, [][]byte{[]byte("hello"), []byte("4")}))
+	assert.Equal(t, 2, cli.protocol)
+
+	// 切换到 RESP3 后返回 map
+	r = hello(s, cli, [][]byte{[]byte("hello"), []byte("3"), []byte("setname"), []byte("c1")})
+	m, ok := r.(*resp.MapData)
+	assert.True(t, ok)
+	assert.Equal(t, resp.MakeIntData(3), m.Data()[5])
+	assert.True(t, strings.HasPrefix(string(r.ToBytes()), "%7\r\n"))
+	assert.Equal(t, 3, cli.protocol)
+	assert.Equal(t, "c1", cli.name)
+
+	_, ok = hello(s, cli, [][]byte{[]byte("hello")}).(*resp.MapData)
+	assert.True(t, ok)
+
+	assert.Equal(t, resp.MakeErrorData("ERR Syntax error in HELLO option 'foo'"),
+		hello(s, cli, [][]byte{[]byte("hello"), []byte("2"), []byte("foo")}))
+	assert.Equal(t, 3, cli.protocol)
+
+	// 与 redis 相同，id 是整数
+	assert.Equal(t, resp.MakeIntData(cli.seq), m.Data()[7])
+
+	// 任意一个选项不合法时不会完成授权
+	r, _ = ExecCommand(s, NewFakeClient(), [][]byte{[]byte("acl"), []byte("setuser"), []byte("alice"), []byte("on"),
+		[]byte(">secret"), []byte("+@all")}, nil)
+	assert.Equal(t, resp.MakeStringData("OK"), r)
+	other := NewClient(nil)
+	assert.Equal(t, resp.MakeErrorData("ERR Syntax error in HELLO option 'foo'"), hello(s, other, [][]byte{[]byte("hello"),
+		[]byte("3"), []byte("auth"), []byte("alice"), []byte("secret"), []byte("setname"), []byte("c2"), []byte("foo")}))
+	assert.False(t, other.auth)
+	assert.Equal(t, "", other.name)
+	assert.Equal(t, 2, other.protocol)
+
+	_, ok = hello(s, other, [][]byte{[]byte("hello"), []byte("3"), []byte("auth"), []byte("alice"), []byte("secret"),
+		[]byte("setname"), []byte("c2")}).(*resp.MapData)
+	assert.True(t, ok)
+	assert.True(t, other.auth)
+	assert.Equal(t, "c2", other.name)
+}
+
+func TestReset(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+	s := NewServer()
+	cli := NewFakeClient()
+
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "select", "2"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "watch", "k1", "k2"))
+	execCmd(s, cli, "hello", "3", "setname", "pooled")
+	execCmd(s, cli, "subscribe", "ch1", "ch2")
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "multi"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "set", "k1", "v"))
+
+	assert.Equal(t, 2, s.dbs[2].WatchSize())
+	assert.Equal(t, 2, len(cli.chs))
+
+	// 事务中同样会立即执行
+	assert.Equal(t, resp.MakeStringData("RESET"), execCmd(s, cli, "reset"))
+
+	assert.Equal(t, 0, cli.dbSeq)
+	assert.False(t, cli.inTx)
+	assert.Equal(t, 0, len(cli.tx))
+	assert.Nil(t, cli.watched)
+	assert.Equal(t, 0, s.dbs[2].WatchSize())
+	assert.Equal(t, 0, len(cli.chs))
+	assert.Equal(t, "", cli.name)
+	assert.Equal(t, 2, cli.protocol)
+
+	// 事务中的命令被丢弃
+	assert.Equal(t, resp.MakeErrorData("ERR EXEC without MULTI"), execCmd(s, cli, "exec"))
+	assert.Equal(t, resp.MakeStringData("nil"), execCmd(s, cli, "get", "k1"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR wrong number of arguments for 'reset' command"), execCmd(s, cli, "reset", "1"))
+}
+
+func TestQuitPipeline(t *testing.T) {
+	s := newExecServer(t)
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go s.handleRead(server)
+
+	reader := bufio.NewReader(client)
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// quit 之前的回包全部发送之后才会关闭连接，quit 之后的命令不会执行
+	go func() {
+		_, _ = client.Write([]byte("*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nQUIT\r\n*3\r\n$3\r\nset\r\n$1\r\nk\r\n$1\r\nv\r\n*1\r\n$4\r\nPING\r\n"))
+	}()
+
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+pong\r\n", line)
+
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+OK\r\n", line)
+
+	_, err = reader.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+
+	assert.Equal(t, resp.MakeStringData("nil"), s.Exec(0, [][]byte{[]byte("get"), []byte("k")}))
+}
+
+func TestClientUnblock(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+	s := NewServer()
+
+	admin := NewFakeClient()
+	blocked := NewFakeClient()
+	s.clis.AddClientIfNotExist(admin)
+	s.clis.AddClientIfNotExist(blocked)
+	id := blocked.id.String()
+
+	assert.NotContains(t, string(execCmd(s, admin, "client", "list").ByteData()), " flags=b ")
+
+	// 阻塞的客户端在 client list 中的标识为 b
+	assert.Nil(t, execCmd(s, blocked, "blpop", "l1", "l2", "0"))
+	assert.True(t, blocked.blocked)
+	assert.Contains(t, string(execCmd(s, admin, "client", "list").ByteData()), " flags=b ")
+	assert.Contains(t, blocked.info(), " flags=b ")
+
+	// 以超时的方式唤醒
+	assert.Equal(t, resp.MakeIntData(1), execCmd(s, admin, "client", "unblock", id))
+	assert.Equal(t, resp.MakeArrayData(nil), *<-blocked.res)
+	assert.False(t, blocked.blocked)
+	assert.Empty(t, blocked.blockedKeys)
+
+	// 没有阻塞的客户端无法唤醒
+	assert.Equal(t, resp.MakeIntData(0), execCmd(s, admin, "client", "unblock", id))
+	assert.Equal(t, resp.MakeIntData(0), execCmd(s, admin, "client", "unblock", "unknown"))
+
+	// 以错误的方式唤醒
+	assert.Nil(t, execCmd(s, blocked, "brpop", "l1", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR"),
+		execCmd(s, admin, "client", "unblock", id, "nil"))
+	assert.True(t, blocked.blocked)
+	assert.Equal(t, resp.MakeIntData(1), execCmd(s, admin, "client", "unblock", id, "ERROR"))
+	assert.Equal(t, resp.MakeErrorData("UNBLOCKED client unblocked via CLIENT UNBLOCK"), *<-blocked.res)
+	assert.False(t, blocked.blocked)
+}
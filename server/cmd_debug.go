@@ -0,0 +1,200 @@
+package server
+
+import (
+	"fmt"
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/utils/pattern"
+	"math"
+	"math/rand"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// debug 命令格式： debug object key | debug listpack-entries [n] | debug listpack-value [n] |
+// debug quicklist-packed-threshold [n] | debug intset-entries [n] | debug digest | debug digest-value key [key ...] |
+// debug reload | debug set-random-seed [seed] | debug stringmatch-len pattern string
+func debug(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "debug", 2)
+	if !ok {
+		return e
+	}
+
+	sub := strings.ToLower(string(cmd[1]))
+
+	switch sub {
+	case "object":
+		if len(cmd) != 3 {
+			return resp.WrongArgsError("debug|object")
+		}
+		return debugObject(server.dbs[cli.dbSeq], string(cmd[2]))
+
+	case "digest":
+		if len(cmd) != 2 {
+			return resp.WrongArgsError("debug|digest")
+		}
+		return resp.MakeStringData(db.DigestAll(server.dbs).String())
+
+	case "digest-value":
+		res := make([]resp.RedisData, 0, len(cmd)-2)
+		for _, key := range cmd[2:] {
+			// 不存在的键返回全零的摘要
+			d, _ := server.dbs[cli.dbSeq].DigestKey(string(key))
+			res = append(res, resp.MakeStringData(d.String()))
+		}
+		return resp.MakeArrayData(res)
+
+	case "reload":
+		if len(cmd) != 2 {
+			return resp.WrongArgsError("debug|reload")
+		}
+		return debugReload(server)
+
+	case "listpack-entries":
+		return debugThreshold(server, cmd, &structure.ListpackMaxEntries)
+
+	case "listpack-value", "quicklist-packed-threshold":
+		return debugThreshold(server, cmd, &structure.ListpackMaxValue)
+
+	case "intset-entries":
+		return debugThreshold(server, cmd, &structure.IntsetMaxEntries)
+
+	case "set-random-seed":
+		return debugRandomSeed(server, cmd)
+
+	case "change-repl-id":
+		if len(cmd) != 2 {
+			return resp.WrongArgsError("debug|change-repl-id")
+		}
+		server.changeReplicationID()
+		return resp.MakeStringData("OK")
+
+	case "stringmatch-len":
+		if len(cmd) != 4 {
+			return resp.WrongArgsError("debug|stringmatch-len")
+		}
+		if pattern.Match(cmd[2], cmd[3]) {
+			return resp.MakeIntData(1)
+		}
+		return resp.MakeIntData(0)
+	}
+
+	return resp.MakeErrorData(fmt.Sprintf("ERR unknown subcommand '%s'. Try DEBUG HELP.", cmd[1]))
+}
+
+// debugObject 返回键的编码方式、序列化长度以及集合中的元素数量
+func debugObject(dataBase *db.DataBase, key string) (ret resp.RedisData) {
+
+	dataBase.Update(func() {
+
+		item, exist := dataBase.GetItem(key)
+		if !exist {
+			ret = resp.MakeErrorData("ERR no such key")
+			return
+		}
+
+		// 与 redis 相同，共享的整数的引用计数为 INT_MAX
+		refcount := 1
+		if v, ok := item.Value.(structure.Slice); ok && structure.IsShared(v) {
+			refcount = math.MaxInt32
+		}
+
+		info := fmt.Sprintf("Value at:%p refcount:%d encoding:%s serializedlength:%d lru_seconds_idle:%d",
+			item, refcount, structure.Encoding(item.Value), db.SerializedLength(item.Value), item.IdleTime())
+
+		switch v := item.Value.(type) {
+		case *structure.List:
+			// 链表的每一个元素都是一个节点
+			info += fmt.Sprintf(" ql_nodes:%d", v.Size())
+		case *structure.Set:
+			info += fmt.Sprintf(" entries:%d", v.Size())
+		case *structure.ZSet:
+			info += fmt.Sprintf(" entries:%d", v.Size())
+		case *structure.Hash:
+			info += fmt.Sprintf(" entries:%d", v.Size())
+		}
+
+		ret = resp.MakeStringData(info)
+	})
+
+	return ret
+}
+
+// debugReload 同步地保存 rdb 文件，然后清空全部数据库并从该文件中重新加载，用于检查数据在 rdb 编码前后是否一致
+func debugReload(server *Server) resp.RedisData {
+
+	if server.rdbFile == "" {
+		return resp.MakeErrorData("ERR DEBUG RELOAD requires rdb persistence to be configured")
+	}
+
+	file := path.Join(server.dir, server.rdbFile)
+	if !server.RDB(file) {
+		return resp.MakeErrorData("ERR Error trying to save the DB")
+	}
+
+	for _, database := range server.dbs {
+		database.Flush()
+	}
+
+	if err := server.loadRDB(file); err != nil {
+		logger.Error("DEBUG RELOAD:", err.Error())
+		return resp.MakeErrorData("ERR Error trying to load the RDB dump")
+	}
+
+	return resp.MakeStringData("OK")
+}
+
+// debugThreshold 返回或者修改紧凑编码的转换阈值，修改只会影响之后的编码判断，用于测试中快速触发编码转换
+func debugThreshold(server *Server, cmd [][]byte, threshold *int) resp.RedisData {
+
+	if len(cmd) == 2 {
+		return resp.MakeIntData(int64(*threshold))
+	} else if len(cmd) != 3 {
+		return resp.WrongArgsError("debug|" + string(cmd[1]))
+	}
+
+	if !server.debugEnabled {
+		return resp.MakeErrorData(fmt.Sprintf("ERR DEBUG %s is not allowed. Set enable-debug-command to true to enable it.", strings.ToUpper(string(cmd[1]))))
+	}
+
+	n, err := strconv.Atoi(string(cmd[2]))
+	if err != nil || n <= 0 {
+		return resp.MakeErrorData("ERR value is out of range, must be positive")
+	}
+	*threshold = n
+
+	return resp.MakeStringData("OK")
+}
+
+// debugRandomSeed 为随机命令设置固定的随机种子，使其结果可以复现；没有指定种子时恢复使用时间作为种子
+func debugRandomSeed(server *Server, cmd [][]byte) resp.RedisData {
+
+	if len(cmd) > 3 {
+		return resp.WrongArgsError("debug|set-random-seed")
+	}
+
+	if !server.debugEnabled {
+		return resp.MakeErrorData("ERR DEBUG SET-RANDOM-SEED is not allowed. Set enable-debug-command to true to enable it.")
+	}
+
+	if len(cmd) == 2 {
+		structure.SetRandomSource(nil)
+		return resp.MakeStringData("OK")
+	}
+
+	seed, err := strconv.ParseInt(string(cmd[2]), 10, 64)
+	if err != nil {
+		return resp.NotIntegerError()
+	}
+	structure.SetRandomSource(rand.NewSource(seed))
+
+	return resp.MakeStringData("OK")
+}
+
+func registerDebugCommands() {
+	RegisterCommand("debug", debug, RD)
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/resp"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDebugObject(t *testing.T) {
+	s := newExecServer(t)
+
+	debugField := func(info, field string) string {
+		matched := regexp.MustCompile(field + `:(\S+)`).FindStringSubmatch(info)
+		if len(matched) != 2 {
+			return ""
+		}
+		return matched[1]
+	}
+
+	execString(s, "set", "str", "value")
+	info := execString(s, "debug", "object", "str")
+	assert.Equal(t, "embstr", debugField(info, "encoding"))
+	assert.Equal(t, "1", debugField(info, "refcount"))
+	// 一个字节的类型，一个字节的长度以及内容
+	assert.Equal(t, "7", debugField(info, "serializedlength"))
+
+	tests := []struct {
+		size   int
+		list   string
+		set    string
+		hash   string
+		intSet string
+	}{
+		{size: 3, list: "listpack", set: "listpack", hash: "listpack", intSet: "intset"},
+		{size: 200, list: "quicklist", set: "hashtable", hash: "hashtable", intSet: "intset"},
+		{size: 600, list: "quicklist", set: "hashtable", hash: "hashtable", intSet: "hashtable"},
+	}
+
+	for _, test := range tests {
+		size := strconv.Itoa(test.size)
+		for i := 0; i < test.size; i++ {
+			execString(s, "rpush", "list"+size, "v"+strconv.Itoa(i))
+			execString(s, "sadd", "set"+size, "m"+strconv.Itoa(i))
+			execString(s, "sadd", "intset"+size, strconv.Itoa(i))
+			execString(s, "hset", "hash"+size, "f"+strconv.Itoa(i), "v")
+		}
+
+		info = execString(s, "debug", "object", "list"+size)
+		assert.Equal(t, test.list, debugField(info, "encoding"))
+		assert.Equal(t, size, debugField(info, "ql_nodes"))
+		assert.Equal(t, test.list, execString(s, "object", "encoding", "list"+size))
+
+		info = execString(s, "debug", "object", "set"+size)
+		assert.Equal(t, test.set, debugField(info, "encoding"))
+		assert.Equal(t, size, debugField(info, "entries"))
+
+		info = execString(s, "debug", "object", "intset"+size)
+		assert.Equal(t, test.intSet, debugField(info, "encoding"))
+		assert.Equal(t, size, debugField(info, "entries"))
+
+		info = execString(s, "debug", "object", "hash"+size)
+		assert.Equal(t, test.hash, debugField(info, "encoding"))
+		assert.Equal(t, size, debugField(info, "entries"))
+	}
+
+	assert.Equal(t, resp.MakeErrorData("ERR no such key"), s.Exec(0, [][]byte{[]byte("debug"), []byte("object"), []byte("none")}))
+	assert.Equal(t, resp.MakeErrorData("ERR unknown subcommand 'foo'. Try DEBUG HELP."), s.Exec(0, [][]byte{[]byte("debug"), []byte("foo")}))
+}
+
+func TestDebugThreshold(t *testing.T) {
+	s := newExecServer(t)
+
+	entries, value := structure.ListpackMaxEntries, structure.ListpackMaxValue
+	defer func() {
+		structure.ListpackMaxEntries, structure.ListpackMaxValue = entries, value
+	}()
+
+	execString(s, "hset", "hash", "f1", "v", "f2", "v", "f3", "v")
+	execString(s, "rpush", "list", "aa", "bb", "cc")
+	assert.Equal(t, "listpack", execString(s, "object", "encoding", "hash"))
+
+	// 没有开启时不允许修改
+	assert.Equal(t, resp.MakeErrorData("ERR DEBUG LISTPACK-ENTRIES is not allowed. Set enable-debug-command to true to enable it."),
+		s.Exec(0, [][]byte{[]byte("debug"), []byte("listpack-entries"), []byte("2")}))
+	assert.Equal(t, resp.MakeIntData(int64(entries)), s.Exec(0, [][]byte{[]byte("debug"), []byte("listpack-entries")}))
+
+	// 降低阈值之后编码发生变化
+	s.debugEnabled = true
+	assert.Equal(t, "OK", execString(s, "debug", "listpack-entries", "2"))
+	assert.Equal(t, resp.MakeIntData(2), s.Exec(0, [][]byte{[]byte("debug"), []byte("listpack-entries")}))
+	assert.Equal(t, "hashtable", execString(s, "object", "encoding", "hash"))
+	assert.Equal(t, "quicklist", execString(s, "object", "encoding", "list"))
+
+	assert.Equal(t, "OK", execString(s, "debug", "listpack-entries", "128"))
+	assert.Equal(t, "listpack", execString(s, "object", "encoding", "hash"))
+
+	// 元素长度超过阈值
+	assert.Equal(t, "OK", execString(s, "debug", "quicklist-packed-threshold", "1"))
+	assert.Equal(t, "quicklist", execString(s, "object", "encoding", "list"))
+	assert.Equal(t, "hashtable", execString(s, "object", "encoding", "hash"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR value is out of range, must be positive"),
+		s.Exec(0, [][]byte{[]byte("debug"), []byte("listpack-value"), []byte("0")}))
+}
+
+func TestDebugDigest(t *testing.T) {
+	s := newExecServer(t)
+	s.dir = t.TempDir()
+
+	empty := strings.Repeat("0", 40)
+	assert.Equal(t, empty, execString(s, "debug", "digest"))
+
+	execString(s, "set", "str", "value")
+	execString(s, "rpush", "list", "a", "b", "c")
+	execString(s, "sadd", "set", "a", "b", "c")
+	execString(s, "zadd", "zset", "1", "a", "2.5", "b")
+	execString(s, "hset", "hash", "f1", "v1", "f2", "v2")
+	execString(s, "set", "ttl", "value")
+	execString(s, "expire", "ttl", "1000")
+	s.dbs[1].Update(func() {
+		s.dbs[1].SetKey("other", structure.Slice("value"))
+	})
+
+	digest := execString(s, "debug", "digest")
+	assert.NotEqual(t, empty, digest)
+
+	// 键的顺序以及集合内部的顺序不会影响摘要
+	execString(s, "del", "set")
+	execString(s, "sadd", "set", "c", "a", "b")
+	assert.Equal(t, digest, execString(s, "debug", "digest"))
+
+	// 列表元素的顺序、过期时间以及所在的数据库都会影响摘要
+	execString(s, "rpush", "list2", "a", "b")
+	before := execString(s, "debug", "digest")
+	execString(s, "del", "list2")
+	execString(s, "rpush", "list2", "b", "a")
+	assert.NotEqual(t, before, execString(s, "debug", "digest"))
+	execString(s, "del", "list2")
+
+	execString(s, "getex", "ttl", "persist")
+	assert.NotEqual(t, digest, execString(s, "debug", "digest"))
+	execString(s, "expire", "ttl", "1000")
+	assert.Equal(t, digest, execString(s, "debug", "digest"))
+
+	values := s.Exec(0, [][]byte{[]byte("debug"), []byte("digest-value"), []byte("str"), []byte("none")}).(*resp.ArrayData).Data()
+	assert.Equal(t, 2, len(values))
+	assert.NotEqual(t, empty, string(values[0].ByteData()))
+	assert.Equal(t, empty, string(values[1].ByteData()))
+
+	// 经过 rdb 保存以及加载之后摘要保持不变
+	rdbFile := path.Join(s.dir, "digest.rdb")
+	assert.True(t, s.RDB(rdbFile))
+
+	loaded := NewServer()
+	assert.Nil(t, loaded.loadRDB(rdbFile))
+	assert.Equal(t, digest, db.DigestAll(loaded.dbs).String())
+}
+
+func TestDebugReload(t *testing.T) {
+	s := newExecServer(t)
+	s.dir = t.TempDir()
+
+	execString(s, "set", "str", "value")
+	execString(s, "rpush", "list", "a", "b", "c")
+	execString(s, "sadd", "set", "a", "b", "c")
+	execString(s, "zadd", "zset", "1", "a", "2.5", "b")
+	execString(s, "hset", "hash", "f1", "v1", "f2", "v2")
+	execString(s, "set", "ttl", "value")
+	execString(s, "expire", "ttl", "1000")
+	s.dbs[1].Update(func() {
+		s.dbs[1].SetKey("other", structure.Slice("value"))
+	})
+
+	digest := execString(s, "debug", "digest")
+	ttl := s.Exec(0, [][]byte{[]byte("ttl"), []byte("ttl")})
+
+	assert.Equal(t, "OK", execString(s, "debug", "reload"))
+	assert.Equal(t, digest, execString(s, "debug", "digest"))
+	assert.Equal(t, ttl, s.Exec(0, [][]byte{[]byte("ttl"), []byte("ttl")}))
+	assert.Equal(t, "value", execString(s, "get", "str"))
+
+	// 之后写入的数据同样会在下一次 reload 中保存
+	execString(s, "set", "new", "value")
+	assert.Equal(t, "OK", execString(s, "debug", "reload"))
+	assert.Equal(t, "value", execString(s, "get", "new"))
+
+	// stream 同样会被保存，只包含 stream 的数据库也能够正常加载
+	execString(s, "xadd", "stream", "*", "f1", "v1")
+	execString(s, "xadd", "stream", "*", "f2", "v2")
+	s.dbs[1].Update(func() {
+		s.dbs[1].Clear()
+	})
+	s.Exec(1, [][]byte{[]byte("xadd"), []byte("stream"), []byte("*"), []byte("f"), []byte("v")})
+	assert.Equal(t, "OK", execString(s, "debug", "reload"))
+	assert.Equal(t, resp.MakeIntData(2), s.Exec(0, [][]byte{[]byte("xlen"), []byte("stream")}))
+	assert.Equal(t, resp.MakeIntData(1), s.Exec(1, [][]byte{[]byte("xlen"), []byte("stream")}))
+
+	// hash 中 field 的过期时间同样会被保存
+	execString(s, "hset", "fields", "a", "1", "b", "2")
+	execString(s, "hexpire", "fields", "100", "fields", "1", "a")
+	httl := s.Exec(0, [][]byte{[]byte("httl"), []byte("fields"), []byte("fields"), []byte("2"), []byte("a"), []byte("b")})
+	assert.Equal(t, "OK", execString(s, "debug", "reload"))
+	assert.Equal(t, httl, s.Exec(0, [][]byte{[]byte("httl"), []byte("fields"), []byte("fields"), []byte("2"), []byte("a"), []byte("b")}))
+	assert.Equal(t, "2", execString(s, "hget", "fields", "b"))
+
+	// 没有配置 rdb 文件时返回错误
+	s.rdbFile = ""
+	assert.Equal(t, "ERR DEBUG RELOAD requires rdb persistence to be configured", execString(s, "debug", "reload"))
+}
+
+func TestDebugRandomSeed(t *testing.T) {
+	s := newExecServer(t)
+	defer structure.SetRandomSource(nil)
+
+	assert.Equal(t, resp.MakeErrorData("ERR DEBUG SET-RANDOM-SEED is not allowed. Set enable-debug-command to true to enable it."),
+		s.Exec(0, [][]byte{[]byte("debug"), []byte("set-random-seed"), []byte("1")}))
+	s.debugEnabled = true
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"),
+		s.Exec(0, [][]byte{[]byte("debug"), []byte("set-random-seed"), []byte("a")}))
+
+	members := []string{"sadd", "set"}
+	for i := 0; i < 20; i++ {
+		members = append(members, "m"+strconv.Itoa(i))
+	}
+	// sequence 在固定的种子下依次执行随机命令，返回全部的结果
+	sequence := func(seed string) []string {
+		execString(s, "flushdb")
+		execString(s, members...)
+		execString(s, "hset", "hash", "f1", "v", "f2", "v", "f3", "v", "f4", "v")
+		execString(s, "set", "k1", "v")
+		execString(s, "set", "k2", "v")
+		assert.Equal(t, "OK", execString(s, "debug", "set-random-seed", seed))
+
+		ret := make([]string, 0)
+		for i := 0; i < 10; i++ {
+			ret = append(ret, execString(s, "spop", "set"))
+		}
+		ret = append(ret, string(s.Exec(0, [][]byte{[]byte("srandmember"), []byte("set"), []byte("-5")}).ToBytes()))
+		ret = append(ret, string(s.Exec(0, [][]byte{[]byte("hrandfield"), []byte("hash"), []byte("-5")}).ToBytes()))
+		ret = append(ret, execString(s, "randomkey"))
+		return ret
+	}
+
+	// 相同的种子得到相同的结果
+	first := sequence("42")
+	assert.Equal(t, first, sequence("42"))
+	assert.NotEqual(t, first, sequence("7"))
+
+	// spop 返回的元素不重复
+	popped := make(map[string]struct{})
+	for _, member := range first[:10] {
+		popped[member] = struct{}{}
+	}
+	assert.Len(t, popped, 10)
+
+	assert.Equal(t, "OK", execString(s, "debug", "set-random-seed"))
+}
+
+func TestDebugStringMatchLen(t *testing.T) {
+	s := newExecServer(t)
+
+	match := func(pattern, str string) resp.RedisData {
+		return s.Exec(0, [][]byte{[]byte("debug"), []byte("stringmatch-len"), []byte(pattern), []byte(str)})
+	}
+
+	assert.Equal(t, resp.MakeIntData(1), match("h[ae]llo", "hello"))
+	assert.Equal(t, resp.MakeIntData(0), match("h[^e]llo", "hello"))
+	assert.Equal(t, resp.MakeIntData(1), match("user:*", "user:1"))
+	assert.Equal(t, resp.MakeErrorData("ERR wrong number of arguments for 'debug|stringmatch-len' command"),
+		s.Exec(0, [][]byte{[]byte("debug"), []byte("stringmatch-len"), []byte("*")}))
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"bytes"
+	"github.com/tangrc99/MemTable/db"
 	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
+	"sort"
 	"strconv"
 )
 
@@ -24,6 +27,21 @@ func publish(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	return resp.MakeIntData(int64(notified))
 }
 
+// subscribeReply 返回订阅相关命令的回复，格式为 [kind, channel, count]，count 为客户端当前订阅的频道总数。
+// resp3 客户端使用 push 类型
+func subscribeReply(cli *Client, kind string, channel []byte, count int) resp.RedisData {
+	reply := []resp.RedisData{
+		resp.MakeBulkData([]byte(kind)),
+		resp.MakeBulkData(channel),
+		resp.MakeIntData(int64(count)),
+	}
+	if cli.protocol == 3 {
+		return resp.MakePushData(reply)
+	}
+	return resp.MakeArrayData(reply)
+}
+
+// subscribe 命令格式： subscribe channel [channel ...]，每一个频道对应一个回复
 func subscribe(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	e, ok := CheckCommandAndLength(cmd, "subscribe", 2)
@@ -31,31 +49,44 @@ func subscribe(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	res := make([]resp.RedisData, (len(cmd)-1)*3)
+	res := make([]resp.RedisData, len(cmd)-1)
 
 	for i, channel := range cmd[1:] {
 		subscribed := cli.Subscribe(server.Chs, string(channel))
-		res[i*3] = resp.MakeIntData(int64(subscribed))
-		res[i*3+1] = resp.MakeBulkData([]byte("subscribe"))
-		res[i*3+2] = resp.MakeBulkData(channel)
+		res[i] = subscribeReply(cli, "subscribe", channel, subscribed)
 	}
-	return resp.MakeArrayData(res)
+	return resp.MakeMultiData(res)
 }
 
+// unsubscribe 命令格式： unsubscribe [channel ...]，没有参数时取消所有订阅，每一个频道对应一个回复
 func unsubscribe(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
-	e, ok := CheckCommandAndLength(cmd, "subscribe", 2)
+	e, ok := CheckCommandAndLength(cmd, "unsubscribe", 1)
 	if !ok {
 		return e
 	}
-	subscribed := cli.UnSubscribe(server.Chs, string(cmd[1]))
 
-	res := make([]resp.RedisData, 3)
-	res[0] = resp.MakeIntData(int64(subscribed))
-	res[1] = resp.MakeBulkData([]byte("unsubscribe"))
-	res[2] = resp.MakeBulkData(cmd[1])
+	channels := cmd[1:]
+	if len(channels) == 0 {
+		// 没有订阅任何频道时，返回一个空频道的回复
+		if len(cli.chs) == 0 {
+			return resp.MakeMultiData([]resp.RedisData{subscribeReply(cli, "unsubscribe", nil, 0)})
+		}
+		for channel := range cli.chs {
+			channels = append(channels, []byte(channel))
+		}
+		sort.Slice(channels, func(i, j int) bool {
+			return bytes.Compare(channels[i], channels[j]) < 0
+		})
+	}
+
+	res := make([]resp.RedisData, len(channels))
 
-	return resp.MakeArrayData(res)
+	for i, channel := range channels {
+		subscribed := cli.UnSubscribe(server.Chs, string(channel))
+		res[i] = subscribeReply(cli, "unsubscribe", channel, subscribed)
+	}
+	return resp.MakeMultiData(res)
 }
 
 func bLPop(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
@@ -67,35 +98,20 @@ func bLPop(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	for i := 1; i < len(cmd)-1; i++ {
-		value, ok := dataBase.GetKey(string(cmd[i]))
-		if !ok {
-			continue
-		}
-		// 如果可以取出，则直接取出
-		listVal, ok := value.(*structure.List)
-		if !ok {
-			return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
-		}
-		if !listVal.Empty() {
-			v, _ := listVal.PopFront().(structure.Slice)
-			return resp.MakeBulkData(v)
-		}
+	// 如果可以取出，则直接取出
+	if ret := popAvailable(dataBase, cmd[1:len(cmd)-1], true); ret != nil {
+		return ret
 	}
 
 	timeout, w := strconv.Atoi(string(cmd[len(cmd)-1]))
 	if w != nil {
 		return resp.MakeErrorData("ERR timeout is not an integer or out of range")
 	}
-	deadline := global.Now.Unix() + int64(timeout)
+	deadline := global.Now().Unix() + int64(timeout)
 	if timeout == 0 {
 		deadline = -1
 	}
-	for i := 1; i < len(cmd)-1; i++ {
-		dataBase.RegisterBlocked(string(cmd[i]), cli.id, cli.msg, deadline)
-	}
-
-	cli.blocked = true
+	blockOnKeys(dataBase, cli, cmd[1:len(cmd)-1], deadline)
 	return nil
 }
 
@@ -108,36 +124,77 @@ func bRPop(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 		return e
 	}
 
-	for i := 1; i < len(cmd)-1; i++ {
-		value, ok := dataBase.GetKey(string(cmd[i]))
-		if !ok {
-			continue
-		}
-		// 如果可以取出，则直接取出
-		listVal, ok := value.(*structure.List)
-		if !ok {
-			return resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value")
-		}
-		if !listVal.Empty() {
-			v, _ := listVal.PopBack().(structure.Slice)
-			return resp.MakeBulkData(v)
-		}
+	// 如果可以取出，则直接取出
+	if ret := popAvailable(dataBase, cmd[1:len(cmd)-1], false); ret != nil {
+		return ret
 	}
 
 	timeout, w := strconv.Atoi(string(cmd[len(cmd)-1]))
 	if w != nil {
 		return resp.MakeErrorData("ERR timeout is not an integer or out of range")
 	}
-	deadline := global.Now.Unix() + int64(timeout)
+	deadline := global.Now().Unix() + int64(timeout)
 	if timeout == 0 {
 		deadline = -1
 	}
-	for i := 1; i < len(cmd)-1; i++ {
-		dataBase.RegisterBlocked(string(cmd[i]), cli.id, cli.msg, deadline)
-	}
+	blockOnKeys(dataBase, cli, cmd[1:len(cmd)-1], deadline)
+	return nil
+}
 
+// blockOnKeys 在数据库中注册阻塞等待的键，并记录在客户端中，用于 client unblock 取消等待
+func blockOnKeys(dataBase *db.DataBase, cli *Client, keys [][]byte, deadline int64) {
+	cli.blockedKeys = cli.blockedKeys[:0]
+	for _, key := range keys {
+		dataBase.RegisterBlocked(string(key), cli.id, cli.msg, deadline)
+		cli.blockedKeys = append(cli.blockedKeys, string(key))
+	}
 	cli.blocked = true
-	return nil
+}
+
+// unblockClient 取消客户端在键上的阻塞等待，客户端没有阻塞在键上时返回 false。reply 为 nil 时不发送回复
+func (s *Server) unblockClient(cli *Client, reply resp.RedisData) bool {
+	if !cli.blocked || len(cli.blockedKeys) == 0 {
+		return false
+	}
+	for _, key := range cli.blockedKeys {
+		s.dbs[cli.dbSeq].UnregisterBlocked(key, cli.id)
+	}
+	cli.blockedKeys = nil
+	cli.blocked = false
+
+	if reply != nil {
+		cli.res <- &reply
+	}
+	return true
+}
+
+// popAvailable 从第一个非空的列表中弹出元素，如果所有列表都为空，返回 nil
+func popAvailable(dataBase *db.DataBase, keys [][]byte, front bool) (ret resp.RedisData) {
+	dataBase.Update(func() {
+		for _, key := range keys {
+			value, ok := dataBase.GetKey(string(key))
+			if !ok {
+				continue
+			}
+			listVal, ok := value.(*structure.List)
+			if !ok {
+				ret = resp.WrongTypeError()
+				return
+			}
+			if listVal.Empty() {
+				continue
+			}
+			var v structure.Object
+			if front {
+				v = listVal.PopFront()
+			} else {
+				v = listVal.PopBack()
+			}
+			ret = resp.MakeBulkData(v.(structure.Slice))
+			return
+		}
+	})
+	return ret
 }
 
 func registerPubSubCommands() {
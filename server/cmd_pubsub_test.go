@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribeReply(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	cli := NewFakeClient()
+
+	reply := func(kind, channel string, count int64) resp.RedisData {
+		var ch []byte
+		if channel != "" {
+			ch = []byte(channel)
+		}
+		return resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte(kind)), resp.MakeBulkData(ch), resp.MakeIntData(count),
+		})
+	}
+
+	// 每一个频道对应一个回复，count 为当前订阅总数
+	assert.Equal(t, resp.MakeMultiData([]resp.RedisData{
+		reply("subscribe", "a", 1), reply("subscribe", "b", 2), reply("subscribe", "c", 3),
+	}), execCmd(s, cli, "subscribe", "a", "b", "c"))
+
+	// 重复订阅不会增加计数
+	assert.Equal(t, resp.MakeMultiData([]resp.RedisData{reply("subscribe", "a", 3)}), execCmd(s, cli, "subscribe", "a"))
+
+	assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$1\r\nd\r\n:4\r\n*3\r\n$9\r\nsubscribe\r\n$1\r\ne\r\n:5\r\n",
+		string(execCmd(s, cli, "subscribe", "d", "e").ToBytes()))
+
+	assert.Equal(t, resp.MakeMultiData([]resp.RedisData{
+		reply("unsubscribe", "b", 4), reply("unsubscribe", "none", 4),
+	}), execCmd(s, cli, "unsubscribe", "b", "none"))
+
+	// 没有参数时取消所有订阅，每一个频道对应一个回复
+	assert.Equal(t, resp.MakeMultiData([]resp.RedisData{
+		reply("unsubscribe", "a", 3), reply("unsubscribe", "c", 2),
+		reply("unsubscribe", "d", 1), reply("unsubscribe", "e", 0),
+	}), execCmd(s, cli, "unsubscribe"))
+
+	assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n", string(execCmd(s, cli, "unsubscribe").ToBytes()))
+}
+
+func TestSubscribeProtocol(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+
+	// received 返回客户端收到的订阅消息，格式与写入 socket 时相同
+	received := func(cli *Client) string {
+		return string((*<-cli.res).ToBytes())
+	}
+
+	legacy := NewFakeClient()
+	modern := NewFakeClient()
+	modern.protocol = 3
+	publisher := NewFakeClient()
+
+	// 订阅的回复在 resp3 中为 push 类型
+	assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n", string(execCmd(s, legacy, "subscribe", "ch").ToBytes()))
+	assert.Equal(t, ">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n", string(execCmd(s, modern, "subscribe", "ch").ToBytes()))
+
+	assert.Equal(t, resp.MakeIntData(2), execCmd(s, publisher, "publish", "ch", "hello"))
+	assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n", received(legacy))
+	assert.Equal(t, ">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n", received(modern))
+
+	// resp2 客户端在订阅状态下只能执行订阅相关的命令，resp3 客户端不受限制
+	assert.Equal(t, resp.MakeErrorData("ERR Can't execute 'set': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / "+
+		"PING / QUIT / RESET are allowed in this context"), execCmd(s, legacy, "set", "k", "v"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, modern, "set", "k", "v"))
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execCmd(s, modern, "get", "k"))
+
+	// 取消全部订阅之后不再受限制
+	execCmd(s, legacy, "unsubscribe")
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), execCmd(s, legacy, "get", "k"))
+}
+
+func TestSubscribeDeliveryOrder(t *testing.T) {
+	s := newExecServer(t)
+	s.uds = path.Join(s.dir, "memtable.sock")
+	assert.Nil(t, s.listen())
+
+	conn, err := net.DialTimeout("unix", s.uds, time.Second)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// resp3 客户端订阅之后可以继续执行命令，订阅的消息与命令的回复交替产生
+	var input []byte
+	for _, cmd := range []string{"hello 3", "subscribe ch", "publish ch m1", "set k v", "publish ch m2"} {
+		input = append(input, resp.PlainDataToResp(bytes.Split([]byte(cmd), []byte(" "))).ToBytes()...)
+	}
+	// 命令一次性发送，事件循环依次执行，连接协程需要按照产生的顺序写回
+	_, err = conn.Write(input)
+	assert.Nil(t, err)
+
+	expected := ">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n" +
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nm1\r\n:1\r\n" +
+		"+OK\r\n" +
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nm2\r\n:1\r\n"
+
+	received := ""
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	for !strings.HasSuffix(received, expected) {
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		received += string(buf[:n])
+	}
+	assert.True(t, strings.HasSuffix(received, expected), received)
+}
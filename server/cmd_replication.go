@@ -3,9 +3,12 @@ package server
 import (
 	"github.com/tangrc99/MemTable/logger"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
 	"io"
+	"net"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -72,7 +75,7 @@ func psync(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	replID := string(cmd[1])
 	replOffset, err := strconv.ParseInt(string(cmd[2]), 10, 64)
 	if err != nil {
-		return resp.MakeErrorData("ERR value is not an integer or out of range")
+		return resp.NotIntegerError()
 	}
 
 	server.registerSlave(cli)
@@ -159,7 +162,7 @@ func replconf(_ *Server, cli *Client, cmd [][]byte) resp.RedisData {
 
 			offset, err := strconv.ParseInt(value, 10, 64)
 			if err != nil {
-				return resp.MakeErrorData("ERR value is not an integer or out of range")
+				return resp.NotIntegerError()
 			}
 			cli.offset = uint64(offset)
 			return resp.MakePlainData("")
@@ -199,9 +202,177 @@ func slaveof(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	return resp.MakeStringData("OK")
 }
 
+func waitAOF(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "waitaof", 4)
+	if !ok {
+		return e
+	}
+
+	numLocal, err := strconv.Atoi(string(cmd[1]))
+	if err != nil || numLocal < 0 {
+		return resp.NotIntegerError()
+	}
+	numReplicas, err := strconv.Atoi(string(cmd[2]))
+	if err != nil || numReplicas < 0 {
+		return resp.NotIntegerError()
+	}
+	timeout, err := strconv.ParseInt(string(cmd[3]), 10, 64)
+	if err != nil {
+		return resp.MakeErrorData("ERR timeout is not an integer or out of range")
+	} else if timeout < 0 {
+		return resp.MakeErrorData("ERR timeout is negative")
+	}
+
+	if server.role == Slave {
+		return resp.MakeErrorData("ERR WAITAOF cannot be used with replica instances.")
+	}
+	if numLocal > 0 && (!server.aofEnabled || server.aof == nil) {
+		return resp.MakeErrorData("ERR WAITAOF cannot be used when numlocal is set but appendonly is disabled.")
+	}
+
+	w := &aofWaiter{
+		cli:         cli,
+		numLocal:    numLocal,
+		numReplicas: numReplicas,
+		replOffset:  server.offset,
+	}
+	if server.aof != nil {
+		w.localOffset = server.aof.offset()
+	}
+	if ret, ok := server.checkAOFWaiter(w); ok {
+		return ret
+	}
+	if timeout > 0 {
+		w.deadline = global.Now().Add(time.Duration(timeout) * time.Millisecond)
+	}
+
+	// 在定时任务中检查条件是否满足
+	cli.blocked = true
+	server.aofWaiters = append(server.aofWaiters, w)
+	return nil
+}
+
+// wait 命令格式： wait numreplicas timeout，阻塞直到指定数量的从节点确认了当前的复制偏移量或者超时，
+// 返回已经确认的从节点数量
+func wait(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "wait", 3)
+	if !ok {
+		return e
+	}
+
+	numReplicas, err := strconv.Atoi(string(cmd[1]))
+	if err != nil || numReplicas < 0 {
+		return resp.NotIntegerError()
+	}
+	timeout, err := strconv.ParseInt(string(cmd[2]), 10, 64)
+	if err != nil {
+		return resp.MakeErrorData("ERR timeout is not an integer or out of range")
+	} else if timeout < 0 {
+		return resp.MakeErrorData("ERR timeout is negative")
+	}
+
+	if server.role == Slave {
+		return resp.MakeErrorData("ERR WAIT cannot be used with replica instances.")
+	}
+
+	// 单机模式下不会有从节点，不需要等待
+	if server.role != Master {
+		return resp.MakeIntData(0)
+	}
+
+	w := &aofWaiter{
+		cli:          cli,
+		numReplicas:  numReplicas,
+		replOffset:   server.offset,
+		replicasOnly: true,
+	}
+	if ret, ok := server.checkAOFWaiter(w); ok {
+		return ret
+	}
+	if timeout > 0 {
+		w.deadline = global.Now().Add(time.Duration(timeout) * time.Millisecond)
+	}
+
+	// 在定时任务中检查条件是否满足
+	cli.blocked = true
+	server.aofWaiters = append(server.aofWaiters, w)
+	return nil
+}
+
+// splitAddr 将地址拆分为主机和端口，无法解析时端口为 0
+func splitAddr(addr string) (string, int64) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	p, _ := strconv.ParseInt(port, 10, 64)
+	return host, p
+}
+
+// role 命令格式： role，返回当前节点在复制中的角色。主节点返回 master、复制偏移量以及从节点列表；
+// 从节点返回 slave、主节点地址、连接状态以及复制偏移量。单机模式下视为没有从节点的主节点
+func role(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "role", 1)
+	if !ok {
+		return e
+	}
+
+	if server.role == Slave && server.Master != nil {
+
+		host, port := "", int64(0)
+		if server.Master.cnn != nil {
+			host, port = splitAddr(server.Master.cnn.RemoteAddr().String())
+		}
+		state := "connect"
+		if server.masterAlive {
+			state = "connected"
+		}
+
+		return resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte("slave")),
+			resp.MakeBulkData([]byte(host)),
+			resp.MakeIntData(port),
+			resp.MakeBulkData([]byte(state)),
+			resp.MakeIntData(int64(server.offset)),
+		})
+	}
+
+	slaves := make([]*Client, 0, len(server.onLineSlaves))
+	if server.role == Master {
+		for cli := range server.onLineSlaves {
+			slaves = append(slaves, cli)
+		}
+	}
+	sort.Slice(slaves, func(i, j int) bool {
+		return slaves[i].addr < slaves[j].addr
+	})
+
+	replicas := make([]resp.RedisData, len(slaves))
+	for i, cli := range slaves {
+		host, port := splitAddr(cli.addr)
+		replicas[i] = resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte(host)),
+			resp.MakeBulkData([]byte(strconv.FormatInt(port, 10))),
+			resp.MakeBulkData([]byte(strconv.FormatUint(cli.offset, 10))),
+		})
+	}
+
+	return resp.MakeArrayData([]resp.RedisData{
+		resp.MakeBulkData([]byte("master")),
+		resp.MakeIntData(int64(server.offset)),
+		resp.MakeArrayData(replicas),
+	})
+}
+
 func registerReplicationCommands() {
 	RegisterCommand("sync", syncCMD, RD)
 	RegisterCommand("psync", psync, RD)
 	RegisterCommand("replconf", replconf, RD)
 	RegisterCommand("slaveof", slaveof, RD)
+	RegisterCommand("waitaof", waitAOF, RD)
+	RegisterCommand("wait", wait, RD)
+	RegisterCommand("role", role, RD)
 }
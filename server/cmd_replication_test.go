@@ -0,0 +1,47 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestRole(t *testing.T) {
+	s := newExecServer(t)
+
+	// 单机模式下视为没有从节点的主节点
+	assert.Equal(t, "*3\r\n$6\r\nmaster\r\n:0\r\n*0\r\n", string(execCmd(s, nil, "role").ToBytes()))
+
+	// 主节点返回从节点列表
+	s.role = Master
+	s.offset = 100
+	slave := NewFakeClient()
+	slave.addr = "127.0.0.1:6380"
+	slave.offset = 90
+	s.onLineSlaves = map[*Client]struct{}{slave: {}}
+
+	assert.Equal(t, "*3\r\n$6\r\nmaster\r\n:100\r\n*1\r\n*3\r\n$9\r\n127.0.0.1\r\n$4\r\n6380\r\n$2\r\n90\r\n",
+		string(execCmd(s, nil, "role").ToBytes()))
+
+	// 从节点返回主节点的地址以及连接状态
+	lsn, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer lsn.Close()
+	conn, err := net.Dial("tcp", lsn.Addr().String())
+	assert.Nil(t, err)
+
+	port := strconv.Itoa(lsn.Addr().(*net.TCPAddr).Port)
+	s.onLineSlaves = nil
+	s.standAloneToSlave(NewClient(conn), "runid", 50)
+
+	expected := "*5\r\n$5\r\nslave\r\n$9\r\n127.0.0.1\r\n:" + port + "\r\n$9\r\nconnected\r\n:50\r\n"
+	assert.Equal(t, expected, string(execCmd(s, nil, "role").ToBytes()))
+
+	s.masterAlive = false
+	expected = "*5\r\n$5\r\nslave\r\n$9\r\n127.0.0.1\r\n:" + port + "\r\n$7\r\nconnect\r\n:50\r\n"
+	assert.Equal(t, expected, string(execCmd(s, nil, "role").ToBytes()))
+
+	s.slaveToStandAlone()
+	assert.Equal(t, "*3\r\n$6\r\nmaster\r\n:50\r\n*0\r\n", string(execCmd(s, nil, "role").ToBytes()))
+}
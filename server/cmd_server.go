@@ -3,12 +3,18 @@ package server
 import (
 	"fmt"
 	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"github.com/tangrc99/MemTable/utils/pattern"
+	"net"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 func save(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
@@ -19,7 +25,7 @@ func save(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	}
 
 	if len(cmd) == 2 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'save' command")
+		return resp.WrongArgsError("save")
 
 	}
 
@@ -36,7 +42,7 @@ func bgsave(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	}
 
 	if len(cmd) == 2 {
-		return resp.MakeErrorData("ERR wrong number of arguments for 'save' command")
+		return resp.WrongArgsError("save")
 
 	}
 
@@ -71,8 +77,7 @@ func flushdb(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	}
 
 	//TODO: 异步操作
-	server.dbs[cli.dbSeq].ReviseNotifyAll()
-	server.dbs[cli.dbSeq] = db.NewDataBase(slotNum)
+	server.dbs[cli.dbSeq].Flush()
 
 	return resp.MakeStringData("OK")
 }
@@ -85,13 +90,297 @@ func flushall(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	}
 
 	for i := 0; i < server.dbNum; i++ {
-		server.dbs[i].ReviseNotifyAll()
-		server.dbs[i] = db.NewDataBase(slotNum)
+		server.dbs[i].Flush()
 	}
 
 	return resp.MakeStringData("OK")
 }
 
+// swapdb 命令格式： swapdb index1 index2
+func swapdb(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "swapdb", 3)
+	if !ok {
+		return e
+	}
+
+	if len(cmd) > 3 {
+		return resp.WrongArgsError("swapdb")
+	}
+
+	i, err := strconv.Atoi(string(cmd[1]))
+	if err != nil {
+		return resp.MakeErrorData("ERR invalid first DB index")
+	}
+	j, err := strconv.Atoi(string(cmd[2]))
+	if err != nil {
+		return resp.MakeErrorData("ERR invalid second DB index")
+	}
+
+	if i < 0 || j < 0 || i >= server.dbNum || j >= server.dbNum {
+		return resp.MakeErrorData("ERR DB index is out of range")
+	}
+
+	if i == j {
+		return resp.MakeStringData("OK")
+	}
+
+	db.SwapDataBase(server.dbs, i, j)
+
+	return resp.MakeStringData("OK")
+}
+
+// move 命令格式： move key db
+func move(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "move", 3)
+	if !ok {
+		return e
+	}
+
+	if len(cmd) > 3 {
+		return resp.WrongArgsError("move")
+	}
+
+	dbSeq, err := strconv.Atoi(string(cmd[2]))
+	if err != nil {
+		return resp.NotIntegerError()
+	}
+
+	if dbSeq < 0 || dbSeq >= server.dbNum {
+		return resp.MakeErrorData("ERR DB index is out of range")
+	}
+
+	if dbSeq == cli.dbSeq {
+		return resp.MakeErrorData("ERR source and destination objects are the same")
+	}
+
+	key := string(cmd[1])
+	src := server.dbs[cli.dbSeq]
+	dst := server.dbs[dbSeq]
+
+	moved := false
+
+	src.Update(func() {
+		value, exist := src.GetKey(key)
+		if !exist {
+			return
+		}
+		ttl := src.GetTTL(key)
+
+		dst.Update(func() {
+			if dst.ExistKey(key) {
+				return
+			}
+			// GetTTL 返回的是剩余时间，需要转换为时间戳
+			if ttl >= 0 {
+				dst.SetKeyWithTTL(key, value, global.Now().Unix()+ttl)
+			} else {
+				dst.SetKey(key, value)
+			}
+			moved = true
+		})
+
+		if moved {
+			src.DeleteKey(key)
+		}
+	})
+
+	if !moved {
+		return resp.MakeIntData(0)
+	}
+	return resp.MakeIntData(1)
+}
+
+// copy 命令格式： copy source destination [DB destination-db] [REPLACE]。值会被深拷贝，
+// 之后修改源键或目标键不会影响另一方，过期时间随值一起复制
+func copyCommand(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "copy", 3)
+	if !ok {
+		return e
+	}
+
+	dbSeq := cli.dbSeq
+	replace := false
+	for i := 3; i < len(cmd); i++ {
+		switch strings.ToLower(string(cmd[i])) {
+		case "db":
+			if i+1 >= len(cmd) {
+				return resp.SyntaxError()
+			}
+			seq, err := strconv.Atoi(string(cmd[i+1]))
+			if err != nil {
+				return resp.NotIntegerError()
+			}
+			if seq < 0 || seq >= server.dbNum {
+				return resp.MakeErrorData("ERR DB index is out of range")
+			}
+			dbSeq = seq
+			i++
+		case "replace":
+			replace = true
+		default:
+			return resp.SyntaxError()
+		}
+	}
+
+	srcKey, dstKey := string(cmd[1]), string(cmd[2])
+	if dbSeq == cli.dbSeq && srcKey == dstKey {
+		return resp.MakeErrorData("ERR source and destination objects are the same")
+	}
+
+	src := server.dbs[cli.dbSeq]
+	dst := server.dbs[dbSeq]
+
+	copied := false
+	write := func(value structure.Object, ttl int64) {
+		if dst.ExistKey(dstKey) {
+			if !replace {
+				return
+			}
+			dst.DeleteKey(dstKey)
+		}
+		// GetTTL 返回的是剩余时间，需要转换为时间戳
+		if ttl >= 0 {
+			dst.SetKeyWithTTL(dstKey, value, global.Now().Unix()+ttl)
+		} else {
+			dst.SetKey(dstKey, value)
+		}
+		copied = true
+	}
+
+	src.Update(func() {
+		value, exist := src.GetKey(srcKey)
+		if !exist {
+			return
+		}
+		ttl := src.GetTTL(srcKey)
+		value = structure.Clone(value)
+
+		// 同一个数据库时已经持有锁
+		if dst == src {
+			write(value, ttl)
+		} else {
+			dst.Update(func() { write(value, ttl) })
+		}
+	})
+
+	if !copied {
+		return resp.MakeIntData(0)
+	}
+	return resp.MakeIntData(1)
+}
+
+// migrate 命令格式： migrate host port key destination-db timeout [COPY] [REPLACE]，timeout 的单位为毫秒。
+// 通过 restore 命令将键写入到目标实例中，没有 COPY 时写入成功后删除本地的键
+func migrate(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "migrate", 6)
+	if !ok {
+		return e
+	}
+
+	if _, err := strconv.Atoi(string(cmd[4])); err != nil {
+		return resp.NotIntegerError()
+	}
+	timeout, err := strconv.ParseInt(string(cmd[5]), 10, 64)
+	if err != nil {
+		return resp.NotIntegerError()
+	}
+	if timeout <= 0 {
+		timeout = 1000
+	}
+
+	copied, replace := false, false
+	for _, arg := range cmd[6:] {
+		switch strings.ToLower(string(arg)) {
+		case "copy":
+			copied = true
+		case "replace":
+			replace = true
+		default:
+			return resp.SyntaxError()
+		}
+	}
+
+	key := string(cmd[3])
+	dataBase := server.dbs[cli.dbSeq]
+
+	var payload []byte
+	ttl := int64(-2)
+	dataBase.Update(func() {
+		value, exist := dataBase.GetKey(key)
+		if !exist {
+			return
+		}
+		ttl = dataBase.GetTTL(key)
+		payload, err = db.DumpObject(value)
+	})
+	if ttl == -2 {
+		return resp.MakeStringData("NOKEY")
+	}
+	if err != nil {
+		return resp.MakeErrorData(err.Error())
+	}
+
+	// restore 的 ttl 单位为毫秒，0 表示不会过期
+	restoreTTL := int64(0)
+	if ttl > 0 {
+		restoreTTL = ttl * 1000
+	} else if ttl == 0 {
+		restoreTTL = 1
+	}
+	restoreCmd := [][]byte{[]byte("restore"), cmd[3], []byte(strconv.FormatInt(restoreTTL, 10)), payload}
+	if replace {
+		restoreCmd = append(restoreCmd, []byte("replace"))
+	}
+
+	addr := net.JoinHostPort(string(cmd[1]), string(cmd[2]))
+	reply := migrateCall(addr, time.Duration(timeout)*time.Millisecond, [][][]byte{
+		{[]byte("select"), cmd[4]}, restoreCmd,
+	})
+	if reply != nil {
+		return reply
+	}
+
+	if !copied {
+		dataBase.Update(func() {
+			dataBase.DeleteKey(key)
+		})
+	}
+	return resp.MakeStringData("OK")
+}
+
+// migrateCall 连接目标实例并依次执行命令，全部命令执行成功时返回 nil，否则返回 migrate 命令的错误回复
+func migrateCall(addr string, timeout time.Duration, cmds [][][]byte) resp.RedisData {
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return resp.MakeErrorData("IOERR error or timeout connecting to the client")
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	for _, c := range cmds {
+		if _, err = conn.Write(resp.PlainDataToResp(c).ToBytes()); err != nil {
+			return resp.MakeErrorData("IOERR error or timeout writing to target instance")
+		}
+	}
+
+	parser := resp.NewParser(conn)
+	for range cmds {
+		parsed := parser.Parse()
+		if parsed.Err != nil {
+			return resp.MakeErrorData("IOERR error or timeout reading to target instance")
+		}
+		if e, ok := parsed.Data.(*resp.ErrorData); ok {
+			return resp.MakeErrorData("ERR Target instance replied with error: " + e.Error())
+		}
+	}
+	return nil
+}
+
 func dbsize(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	// 进行输入类型检查
 	e, ok := CheckCommandAndLength(cmd, "dbsize", 1)
@@ -103,7 +392,7 @@ func dbsize(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
 
 		dbSeq, err := strconv.Atoi(string(cmd[1]))
 		if err != nil {
-			return resp.MakeErrorData("ERR value is not an integer or out of range")
+			return resp.NotIntegerError()
 		}
 
 		if dbSeq >= server.dbNum {
@@ -134,12 +423,12 @@ func slowlog(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	case "get":
 
 		if len(cmd) < 3 {
-			return resp.MakeErrorData("ERR wrong number of arguments for 'slowlog get' command")
+			return resp.WrongArgsError("slowlog get")
 		}
 
 		limit, err := strconv.Atoi(string(cmd[2]))
 		if err != nil {
-			return resp.MakeErrorData("ERR value is not an integer or out of range")
+			return resp.NotIntegerError()
 		}
 		return server.slowlog.getEntries(limit)
 
@@ -170,13 +459,141 @@ func info(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
 	return resp.MakeStringData(server.Information(section))
 }
 
+// command 命令格式： command count|docs [command-name ...] | command getkeys command [arg ...] |
+// command list [filterby module name|aclcat category|pattern pattern]
+func command(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "command", 2)
+	if !ok {
+		return e
+	}
+
+	switch strings.ToLower(string(cmd[1])) {
+	case "count":
+		if len(cmd) != 2 {
+			return resp.WrongArgsError("command|count")
+		}
+		n := 0
+		global.ForAnyCommands(func(string, global.Command) { n++ })
+		return resp.MakeIntData(int64(n))
+
+	case "docs":
+		names := make([]string, 0)
+		if len(cmd) == 2 {
+			global.ForAnyCommands(func(name string, _ global.Command) {
+				names = append(names, name)
+			})
+			sort.Strings(names)
+		} else {
+			for _, name := range cmd[2:] {
+				names = append(names, strings.ToLower(string(name)))
+			}
+		}
+
+		ret := make([]resp.RedisData, 0, 2*len(names))
+		for _, name := range names {
+			c, exist := global.FindCommand(name)
+			if !exist {
+				continue
+			}
+			group := "server"
+			if c.Type() == CTDatabase {
+				group = "database"
+			}
+			ret = append(ret, resp.MakeBulkData([]byte(name)), resp.MakeArrayData([]resp.RedisData{
+				resp.MakeBulkData([]byte("group")), resp.MakeBulkData([]byte(group)),
+			}))
+		}
+		return resp.MakeArrayData(ret)
+
+	case "getkeys":
+		return commandGetKeys(cmd[2:])
+
+	case "list":
+		return commandList(server, cmd[2:])
+	}
+
+	return resp.MakeErrorData(fmt.Sprintf("ERR unknown subcommand '%s'. Try COMMAND HELP.", cmd[1]))
+}
+
+// commandList 返回按照名称排序的命令列表，args 为空时返回全部命令，否则按照 filterby 条件进行过滤
+func commandList(server *Server, args [][]byte) resp.RedisData {
+
+	filter := func(string, global.Command) bool { return true }
+
+	if len(args) == 3 && strings.ToLower(string(args[0])) == "filterby" {
+		value := string(args[2])
+		switch strings.ToLower(string(args[1])) {
+		case "module":
+			// 不支持加载模块，因此没有属于模块的命令
+			filter = func(string, global.Command) bool { return false }
+		case "aclcat":
+			c, exist := server.acl.FindCategory(strings.ToLower(value))
+			filter = func(_ string, cmd global.Command) bool { return exist && c.IsPermitted(cmd.GetId()) }
+		case "pattern":
+			p := []byte(strings.ToLower(value))
+			filter = func(name string, _ global.Command) bool { return pattern.Match(p, []byte(name)) }
+		default:
+			return resp.SyntaxError()
+		}
+	} else if len(args) != 0 {
+		return resp.SyntaxError()
+	}
+
+	names := make([]string, 0)
+	global.ForAnyCommands(func(name string, cmd global.Command) {
+		if filter(name, cmd) {
+			names = append(names, name)
+		}
+	})
+	sort.Strings(names)
+
+	ret := make([]resp.RedisData, len(names))
+	for i, name := range names {
+		ret[i] = resp.MakeBulkData([]byte(name))
+	}
+	return resp.MakeArrayData(ret)
+}
+
+// commandGetKeys 根据命令的键参数描述返回 args 中的键参数，args 的第一个元素为命令名称
+func commandGetKeys(args [][]byte) resp.RedisData {
+
+	if len(args) == 0 {
+		return resp.WrongArgsError("command|getkeys")
+	}
+
+	c, exist := global.FindCommand(strings.ToLower(string(args[0])))
+	if !exist {
+		return resp.MakeErrorData("ERR Invalid command specified")
+	} else if !c.CheckArity(len(args)) {
+		return resp.MakeErrorData("ERR Invalid number of arguments specified for command")
+	}
+
+	positions, ok := c.GetKeys(args)
+	if !ok || len(positions) == 0 {
+		return resp.MakeErrorData("ERR The command has no key arguments")
+	}
+
+	keys := make([]resp.RedisData, len(positions))
+	for i, pos := range positions {
+		keys[i] = resp.MakeBulkData(args[pos])
+	}
+	return resp.MakeArrayData(keys)
+}
+
 func registerServerCommand() {
 	RegisterCommand("shutdown", shutdown, RD)
 	RegisterCommand("flushdb", flushdb, WR)
 	RegisterCommand("flushall", flushall, WR)
+	RegisterCommand("swapdb", swapdb, WR)
+	RegisterCommand("move", move, WR)
+	RegisterCommand("copy", copyCommand, WR)
+	RegisterCommand("migrate", migrate, WR)
 	RegisterCommand("dbsize", dbsize, RD)
 	RegisterCommand("save", save, RD)
 	RegisterCommand("bgsave", bgsave, RD)
 	RegisterCommand("slowlog", slowlog, RD)
+	RegisterCommand("latency", latency, RD)
 	RegisterCommand("info", info, RD)
+	RegisterCommand("command", command, RD)
 }
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSwapDB(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	cli := NewFakeClient()
+
+	s.dbs[0].SetKey("a", structure.Slice("0"))
+	s.dbs[0].SetKeyWithTTL("ttl", structure.Slice("0"), global.Now().Unix()+100)
+	s.dbs[1].SetKey("b", structure.Slice("1"))
+
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "swapdb", "0", "1"))
+
+	v, ok := s.dbs[1].GetKey("a")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice("0"), v)
+	assert.True(t, s.dbs[1].GetTTL("ttl") > 0)
+	assert.Equal(t, 1, s.dbs[1].TTLSize())
+
+	v, ok = s.dbs[0].GetKey("b")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice("1"), v)
+	_, ok = s.dbs[0].GetKey("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, s.dbs[0].TTLSize())
+
+	// 当前选中 0 号数据库的客户端在下一条命令中看到交换后的数据
+	ret, _ := ExecCommand(s, cli, [][]byte{[]byte("get"), []byte("b")}, nil)
+	assert.Equal(t, resp.MakeBulkData([]byte("1")), ret)
+
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "swapdb", "1", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR DB index is out of range"), execCmd(s, cli, "swapdb", "0", "100"))
+	assert.Equal(t, resp.MakeErrorData("ERR DB index is out of range"), execCmd(s, cli, "swapdb", "-1", "0"))
+	assert.Equal(t, resp.MakeErrorData("ERR invalid first DB index"), execCmd(s, cli, "swapdb", "a", "0"))
+	assert.Equal(t, resp.MakeErrorData("ERR wrong number of arguments for 'swapdb' command"), execCmd(s, cli, "swapdb", "0"))
+}
+
+func TestMove(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	cli := NewFakeClient()
+
+	s.dbs[0].SetKey("a", structure.Slice("0"))
+	s.dbs[0].SetKeyWithTTL("ttl", structure.Slice("0"), global.Now().Unix()+100)
+	s.dbs[0].SetKey("exist", structure.Slice("0"))
+	s.dbs[1].SetKey("exist", structure.Slice("1"))
+
+	assert.Equal(t, resp.MakeIntData(1), execCmd(s, cli, "move", "a", "1"))
+	_, ok := s.dbs[0].GetKey("a")
+	assert.False(t, ok)
+	v, ok := s.dbs[1].GetKey("a")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice("0"), v)
+	assert.Equal(t, int64(-1), s.dbs[1].GetTTL("a"))
+
+	// 不存在的键以及目标数据库已经存在的键都不会移动
+	assert.Equal(t, resp.MakeIntData(0), execCmd(s, cli, "move", "none", "1"))
+	assert.Equal(t, resp.MakeIntData(0), execCmd(s, cli, "move", "exist", "1"))
+	v, _ = s.dbs[0].GetKey("exist")
+	assert.Equal(t, structure.Slice("0"), v)
+	v, _ = s.dbs[1].GetKey("exist")
+	assert.Equal(t, structure.Slice("1"), v)
+
+	// ttl 随键一起移动
+	assert.Equal(t, resp.MakeIntData(1), execCmd(s, cli, "move", "ttl", "1"))
+	assert.Equal(t, 0, s.dbs[0].TTLSize())
+	assert.Equal(t, 1, s.dbs[1].TTLSize())
+	ttl := s.dbs[1].GetTTL("ttl")
+	assert.True(t, ttl > 0 && ttl <= 100)
+
+	assert.Equal(t, resp.MakeErrorData("ERR DB index is out of range"), execCmd(s, cli, "move", "exist", "100"))
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execCmd(s, cli, "move", "exist", "a"))
+	assert.Equal(t, resp.MakeErrorData("ERR source and destination objects are the same"), execCmd(s, cli, "move", "exist", "0"))
+}
+
+func TestMigrate(t *testing.T) {
+
+	source := newExecServer(t)
+	target := newExecServer(t)
+
+	// 目标实例通过 tcp 接收 restore 命令
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go target.handleRead(conn)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	get := func(s *Server, dbSeq int, key string) resp.RedisData {
+		return s.Exec(dbSeq, [][]byte{[]byte("get"), []byte(key)})
+	}
+
+	execCmd(source, nil, "set", "k", "v")
+	execCmd(source, nil, "set", "ttl", "v")
+	execCmd(source, nil, "expire", "ttl", "100")
+	execCmd(source, nil, "rpush", "list", "a", "b")
+
+	// 迁移之后本地的键被删除
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(source, nil, "migrate", host, port, "k", "1", "1000"))
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), get(target, 1, "k"))
+	assert.Equal(t, resp.MakeStringData("nil"), get(source, 0, "k"))
+
+	// 过期时间同样会被迁移
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(source, nil, "migrate", host, port, "ttl", "0", "1000"))
+	assert.Equal(t, int64(100), target.dbs[0].GetTTL("ttl"))
+
+	// COPY 时保留本地的键，已经存在的键需要使用 REPLACE
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(source, nil, "migrate", host, port, "list", "0", "1000", "copy"))
+	assert.Equal(t, 1, source.dbs[0].Size())
+	assert.Equal(t, resp.MakeErrorData("ERR Target instance replied with error: BUSYKEY Target key name already exists."),
+		execCmd(source, nil, "migrate", host, port, "list", "0", "1000", "copy"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(source, nil, "migrate", host, port, "list", "0", "1000", "replace"))
+	assert.Equal(t, 0, source.dbs[0].Size())
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{resp.MakeBulkData([]byte("a")), resp.MakeBulkData([]byte("b"))}),
+		target.Exec(0, [][]byte{[]byte("lrange"), []byte("list"), []byte("0"), []byte("-1")}))
+
+	assert.Equal(t, resp.MakeStringData("NOKEY"), execCmd(source, nil, "migrate", host, port, "none", "0", "1000"))
+
+	// 无法连接时返回 IOERR，本地的键不会被删除
+	execCmd(source, nil, "set", "k", "v")
+	_ = listener.Close()
+	assert.Equal(t, resp.MakeErrorData("IOERR error or timeout connecting to the client"), execCmd(source, nil, "migrate", host, port, "k", "0", "100"))
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), get(source, 0, "k"))
+
+	// 只有删除了本地键的迁移需要传播
+	cmd := [][]byte{[]byte("migrate"), []byte(host), []byte(port), []byte("k"), []byte("0"), []byte("100")}
+	assert.Equal(t, "*2\r\n$3\r\ndel\r\n$1\r\nk\r\n", string(rewriteForPropagation(cmd, resp.MakeStringData("OK"), nil, global.Now())))
+	assert.Nil(t, rewriteForPropagation(append(cmd, []byte("COPY")), resp.MakeStringData("OK"), nil, global.Now()))
+	assert.Nil(t, rewriteForPropagation(cmd, resp.MakeStringData("NOKEY"), nil, global.Now()))
+}
+
+func TestCommandDocs(t *testing.T) {
+	s := newExecServer(t)
+
+	count, ok := execCmd(s, nil, "command", "count").(*resp.IntData)
+	assert.True(t, ok)
+	assert.True(t, count.Data() > 0)
+
+	docs, ok := execCmd(s, nil, "command", "docs").(*resp.ArrayData)
+	assert.True(t, ok)
+	assert.Equal(t, int(count.Data())*2, len(docs.Data()))
+
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{
+		resp.MakeBulkData([]byte("get")),
+		resp.MakeArrayData([]resp.RedisData{resp.MakeBulkData([]byte("group")), resp.MakeBulkData([]byte("database"))}),
+		resp.MakeBulkData([]byte("save")),
+		resp.MakeArrayData([]resp.RedisData{resp.MakeBulkData([]byte("group")), resp.MakeBulkData([]byte("server"))}),
+	}), execCmd(s, nil, "command", "docs", "GET", "save", "none"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR unknown subcommand 'none'. Try COMMAND HELP."), execCmd(s, nil, "command", "none"))
+}
+
+func TestCommandGetKeys(t *testing.T) {
+	s := newExecServer(t)
+
+	assert.Equal(t, "*1\r\n$3\r\nkey\r\n", string(execCmd(s, nil, "command", "getkeys", "get", "key").ToBytes()))
+	assert.Equal(t, "*3\r\n$2\r\nk1\r\n$2\r\nk2\r\n$2\r\nk3\r\n", string(execCmd(s, nil, "command", "getkeys", "MSET", "k1", "v1", "k2", "v2", "k3", "v3").ToBytes()))
+	assert.Equal(t, "*1\r\n$4\r\nzset\r\n", string(execCmd(s, nil, "command", "getkeys", "zadd", "zset", "NX", "1", "a", "2", "b").ToBytes()))
+	assert.Equal(t, "*2\r\n$2\r\nk1\r\n$2\r\nk2\r\n", string(execCmd(s, nil, "command", "getkeys", "blpop", "k1", "k2", "0").ToBytes()))
+	assert.Equal(t, "*2\r\n$2\r\nk1\r\n$2\r\nk2\r\n", string(execCmd(s, nil, "command", "getkeys", "eval", "return 1", "2", "k1", "k2", "arg").ToBytes()))
+
+	assert.Equal(t, "-ERR The command has no key arguments\r\n", string(execCmd(s, nil, "command", "getkeys", "ping").ToBytes()))
+	assert.Equal(t, "-ERR The command has no key arguments\r\n", string(execCmd(s, nil, "command", "getkeys", "eval", "return 1", "0").ToBytes()))
+	assert.Equal(t, "-ERR Invalid command specified\r\n", string(execCmd(s, nil, "command", "getkeys", "none", "key").ToBytes()))
+	assert.Equal(t, "-ERR Invalid number of arguments specified for command\r\n", string(execCmd(s, nil, "command", "getkeys", "get").ToBytes()))
+	assert.Equal(t, "-ERR The command has no key arguments\r\n", string(execCmd(s, nil, "command", "getkeys", "eval", "return 1", "3", "k1").ToBytes()))
+}
+
+func TestSubcommandHelp(t *testing.T) {
+	s := newExecServer(t)
+
+	// HELP 回复中列出了全部子命令
+	reply, ok := execCmd(s, nil, "object", "HELP").(*resp.ArrayData)
+	assert.True(t, ok)
+	lines := make([]string, 0)
+	for _, line := range reply.Data() {
+		lines = append(lines, line.(*resp.StringData).Data())
+	}
+	assert.Equal(t, "OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:", lines[0])
+	assert.Contains(t, lines, "ENCODING <key>")
+	assert.Contains(t, lines, "FREQ <key>")
+	assert.Contains(t, lines, "IDLETIME <key>")
+	assert.Equal(t, "HELP", lines[len(lines)-2])
+
+	for _, name := range []string{"client", "command", "slowlog", "latency", "debug"} {
+		_, ok = execCmd(s, nil, name, "help").(*resp.ArrayData)
+		assert.True(t, ok, name)
+	}
+
+	// 没有子命令的命令不受影响
+	assert.Equal(t, "+nil\r\n", string(execCmd(s, nil, "get", "help").ToBytes()))
+}
+
+func TestCommandList(t *testing.T) {
+	s := newExecServer(t)
+
+	c := func(args ...string) []string {
+		reply, ok := execCmd(s, nil, args...).(*resp.ArrayData)
+		assert.True(t, ok)
+		names := make([]string, 0)
+		for _, name := range reply.Data() {
+			names = append(names, string(name.ByteData()))
+		}
+		return names
+	}
+
+	count := s.Exec(0, [][]byte{[]byte("command"), []byte("count")}).(*resp.IntData)
+	all := c("command", "list")
+	assert.Equal(t, int(count.Data()), len(all))
+	assert.True(t, sort.StringsAreSorted(all))
+	assert.Contains(t, all, "get")
+	assert.Contains(t, all, "command")
+
+	// 按照名称过滤
+	assert.Equal(t, []string{"hget", "hgetall"}, c("command", "list", "FILTERBY", "PATTERN", "hget*"))
+	assert.Equal(t, []string{"get", "set"}, c("command", "list", "filterby", "pattern", "?et"))
+	assert.Equal(t, []string{}, c("command", "list", "filterby", "pattern", "none*"))
+
+	// 按照权限组过滤
+	write := c("command", "list", "filterby", "aclcat", "write")
+	assert.Contains(t, write, "set")
+	assert.NotContains(t, write, "get")
+	assert.Equal(t, []string{}, c("command", "list", "filterby", "aclcat", "none"))
+	assert.Equal(t, []string{}, c("command", "list", "filterby", "module", "any"))
+
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), s.Exec(0, [][]byte{[]byte("command"), []byte("list"), []byte("filterby")}))
+}
+
+func TestFlushAll(t *testing.T) {
+	s := newExecServer(t)
+
+	s.Exec(0, [][]byte{[]byte("set"), []byte("a"), []byte("0")})
+	s.Exec(1, [][]byte{[]byte("set"), []byte("b"), []byte("1")})
+	dbs := append([]*db.DataBase(nil), s.dbs...)
+
+	// 清空数据时保留原来的数据库实例，淘汰策略等设置不会丢失
+	assert.Equal(t, resp.MakeStringData("OK"), s.Exec(1, [][]byte{[]byte("flushdb")}))
+	assert.Equal(t, 1, s.dbs[0].Size())
+	assert.Equal(t, 0, s.dbs[1].Size())
+
+	assert.Equal(t, resp.MakeStringData("OK"), s.Exec(0, [][]byte{[]byte("flushall")}))
+	for i := range dbs {
+		assert.Same(t, dbs[i], s.dbs[i])
+		assert.Equal(t, 0, s.dbs[i].Size())
+	}
+}
+
+func TestCopy(t *testing.T) {
+	s := newExecServer(t)
+
+	// 分别覆盖紧凑编码以及普通编码
+	for _, n := range []int{4, 1000} {
+
+		execString(s, "flushdb")
+		for i := 0; i < n; i++ {
+			v := strconv.Itoa(i)
+			execString(s, "hset", "hash", "f"+v, v)
+			execString(s, "rpush", "list", v)
+			execString(s, "sadd", "set", v)
+			execString(s, "sadd", "strset", "m"+v)
+			execString(s, "zadd", "zset", v, "m"+v)
+			execString(s, "xadd", "stream", "*", "f", v)
+		}
+		execString(s, "set", "string", strings.Repeat("s", n))
+
+		keys := []string{"string", "hash", "list", "set", "strset", "zset", "stream"}
+		encodings := make(map[string]string)
+		for _, key := range keys {
+			assert.Equal(t, "1", execString(s, "copy", key, key+"-copy"))
+			encodings[key] = execString(s, "object", "encoding", key)
+			assert.Equal(t, encodings[key], execString(s, "object", "encoding", key+"-copy"))
+		}
+
+		// 修改源键之后目标键保持不变
+		execString(s, "append", "string", "x")
+		execString(s, "setrange", "string", "0", "y")
+		execString(s, "hset", "hash", "f0", "changed", "new", strings.Repeat("v", 100))
+		execString(s, "hdel", "hash", "f1")
+		execString(s, "lset", "list", "0", "changed")
+		execString(s, "rpush", "list", strings.Repeat("v", 100))
+		execString(s, "sadd", "set", "member")
+		execString(s, "srem", "set", "1", "2")
+		execString(s, "srem", "strset", "m1")
+		execString(s, "zadd", "zset", "100", "m0")
+		execString(s, "zrem", "zset", "m1")
+		execString(s, "xadd", "stream", "*", "f", "new")
+		execString(s, "xtrim", "stream", "maxlen", "0")
+
+		assert.Equal(t, strings.Repeat("s", n), execString(s, "get", "string-copy"))
+		assert.Equal(t, strconv.Itoa(n), execString(s, "hlen", "hash-copy"))
+		assert.Equal(t, "0", execString(s, "hget", "hash-copy", "f0"))
+		assert.Equal(t, "1", execString(s, "hget", "hash-copy", "f1"))
+		assert.Equal(t, strconv.Itoa(n), execString(s, "llen", "list-copy"))
+		assert.Equal(t, "0", execString(s, "lindex", "list-copy", "0"))
+		assert.Equal(t, strconv.Itoa(n), execString(s, "scard", "set-copy"))
+		assert.Equal(t, "1", execString(s, "sismember", "set-copy", "1"))
+		assert.Equal(t, "0", execString(s, "sismember", "set-copy", "member"))
+		assert.Equal(t, strconv.Itoa(n), execString(s, "scard", "strset-copy"))
+		assert.Equal(t, strconv.Itoa(n), execString(s, "zcard", "zset-copy"))
+		assert.Equal(t, "0.000000", execString(s, "zscore", "zset-copy", "m0"))
+		assert.Equal(t, "1.000000", execString(s, "zscore", "zset-copy", "m1"))
+		assert.Equal(t, strconv.Itoa(n), execString(s, "xlen", "stream-copy"))
+
+		for _, key := range keys {
+			assert.Equal(t, encodings[key], execString(s, "object", "encoding", key+"-copy"))
+		}
+
+		// 修改目标键同样不会影响源键
+		execString(s, "hset", "hash-copy", "f2", "changed")
+		assert.Equal(t, "2", execString(s, "hget", "hash", "f2"))
+		execString(s, "rpop", "list-copy")
+		assert.Equal(t, strconv.Itoa(n+1), execString(s, "llen", "list"))
+	}
+
+	// 目标键已经存在时需要 REPLACE，过期时间随值一起复制
+	execString(s, "set", "src", "a")
+	execString(s, "expire", "src", "100")
+	execString(s, "set", "dst", "b")
+	assert.Equal(t, "0", execString(s, "copy", "src", "dst"))
+	assert.Equal(t, "b", execString(s, "get", "dst"))
+	assert.Equal(t, "1", execString(s, "copy", "src", "dst", "replace"))
+	assert.Equal(t, "a", execString(s, "get", "dst"))
+	ttl, err := strconv.Atoi(execString(s, "ttl", "dst"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 100)
+
+	// 复制到其他数据库
+	assert.Equal(t, "1", execString(s, "copy", "hash", "hash", "db", "1"))
+	assert.Equal(t, "1", string(s.Exec(1, [][]byte{[]byte("exists"), []byte("hash")}).ByteData()))
+	execString(s, "del", "hash")
+	assert.Equal(t, "1", string(s.Exec(1, [][]byte{[]byte("exists"), []byte("hash")}).ByteData()))
+
+	assert.Equal(t, "0", execString(s, "copy", "none", "dst"))
+	assert.Equal(t, "ERR source and destination objects are the same", execString(s, "copy", "src", "src"))
+	assert.Equal(t, "ERR DB index is out of range", execString(s, "copy", "src", "dst", "db", "100"))
+	assert.Equal(t, "ERR syntax error", execString(s, "copy", "src", "dst", "db"))
+	assert.Equal(t, "ERR syntax error", execString(s, "copy", "src", "dst", "bad"))
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/config"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExecCommandMaxMemory(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	maxMemory, policy := config.Conf.MaxMemory, config.Conf.Eviction
+	defer func() {
+		config.Conf.MaxMemory, config.Conf.Eviction = maxMemory, policy
+	}()
+
+	value := strings.Repeat("v", 100)
+	set := func(s *Server, cli *Client, key string) resp.RedisData {
+		ret, _ := ExecCommand(s, cli, [][]byte{[]byte("set"), []byte(key), []byte(value)}, nil)
+		return ret
+	}
+
+	// noeviction 在内存不足时拒绝写入，但允许删除
+	config.Conf.Eviction = "noeviction"
+	s := NewServer()
+	cli := NewFakeClient()
+	s.collectCost()
+	config.Conf.MaxMemory = uint64(s.cost) + 2000
+
+	var ret resp.RedisData
+	for i := 0; i < 100; i++ {
+		ret = set(s, cli, "k"+strconv.Itoa(i))
+	}
+	assert.Equal(t, resp.MakeErrorData("OOM command not allowed when used memory > 'maxmemory'."), ret)
+	ret, _ = ExecCommand(s, cli, [][]byte{[]byte("del"), []byte("k0")}, nil)
+	assert.Equal(t, resp.MakeIntData(1), ret)
+
+	// allkeys-lru 在写入前淘汰旧键，写入总是成功
+	config.Conf.Eviction = "allkeys-lru"
+	s = NewServer()
+	s.collectCost()
+	config.Conf.MaxMemory = uint64(s.cost) + 2000
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, resp.MakeStringData("OK"), set(s, cli, "k"+strconv.Itoa(i)))
+	}
+	assert.Less(t, s.dbs[0].Size(), 100)
+	assert.True(t, s.dbs[0].ExistKey("k99"))
+}
+
+func TestRenameCommands(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	cli := NewFakeClient()
+
+	RegisterCommand("disabled-for-test", func(_ *Server, _ *Client, _ [][]byte) resp.RedisData {
+		return resp.MakeStringData("OK")
+	}, RD)
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "disabled-for-test"))
+
+	assert.Nil(t, RenameCommands([][2]string{{"disabled-for-test", ""}, {"get", "myget"}}))
+	defer func() {
+		assert.Nil(t, RenameCommands([][2]string{{"myget", "get"}}))
+	}()
+
+	// 禁用的命令不存在
+	assert.Equal(t, resp.UnknownCommandError("disabled-for-test", nil), execCmd(s, cli, "disabled-for-test"))
+
+	// 重命名之后只能通过新名称调用
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "set", "k", "hello"))
+	assert.Equal(t, resp.MakeErrorData("ERR unknown command 'get', with args beginning with: 'k' "), execCmd(s, cli, "get", "k"))
+	assert.Equal(t, resp.MakeBulkData([]byte("hello")), execCmd(s, cli, "MYGET", "k"))
+
+	// 事务中执行时同样生效，并且不会修改原始命令
+	cmd := [][]byte{[]byte("myget"), []byte("k")}
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "multi"))
+	ret, _ := ExecCommand(s, cli, cmd, nil)
+	assert.Equal(t, resp.MakeStringData("QUEUED"), ret)
+	assert.Equal(t, "myget", string(cmd[0]))
+	assert.Equal(t, "*1\r\n$5\r\nhello\r\n", string(execCmd(s, cli, "exec").ToBytes()))
+
+	// 命令不存在或者新名称已经被占用
+	assert.NotNil(t, RenameCommands([][2]string{{"not-exist", "new"}}))
+	assert.NotNil(t, RenameCommands([][2]string{{"myget", "ping"}}))
+}
+
+func TestCheckArgs(t *testing.T) {
+	s := newExecServer(t)
+
+	tests := []struct {
+		cmd      string
+		expected string
+	}{
+		{"expire k abc", "-ERR value is not an integer or out of range\r\n"},
+		{"expire k 1.5", "-ERR value is not an integer or out of range\r\n"},
+		{"getrange k 0 x", "-ERR value is not an integer or out of range\r\n"},
+		{"incrbyfloat k nan", "-ERR value is not a valid float\r\n"},
+		{"zincrby z x m", "-ERR value is not a valid float\r\n"},
+		{"lmove src dst LEFT UP", "-ERR syntax error\r\n"},
+		{"select one", "-ERR value is not an integer or out of range\r\n"},
+		{"set k v ex abc", "-ERR value is not an integer or out of range\r\n"},
+		{"set k v nx px", "-ERR syntax error\r\n"},
+		{"set k v keepttl sometimes", "-ERR syntax error\r\n"},
+		// 参数数量错误时仍然返回原来的错误
+		{"lrange k 0", "-ERR wrong number of arguments for 'lrange' command\r\n"},
+		{"lmove src dst left RIGHT", "+nil\r\n"},
+	}
+
+	for _, test := range tests {
+		args := strings.Split(test.cmd, " ")
+		assert.Equal(t, test.expected, string(execCmd(s, nil, args...).ToBytes()), test.cmd)
+	}
+
+	// 参数格式错误时命令不会被执行
+	execString(s, "rpush", "src", "a")
+	assert.Equal(t, "ERR syntax error", execString(s, "lmove", "src", "dst", "left", "middle"))
+	assert.Equal(t, "0", string(s.Exec(0, [][]byte{[]byte("exists"), []byte("dst")}).ByteData()))
+}
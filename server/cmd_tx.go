@@ -3,6 +3,7 @@ package server
 import (
 	"fmt"
 	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
 	"strconv"
 )
 
@@ -35,6 +36,7 @@ func execTX(server *Server, cli *Client, cmds [][]byte) resp.RedisData {
 
 	defer func() {
 		cli.inTx = false
+		cli.txDirty = false
 		cli.tx = make([][][]byte, 0)
 
 		for dbSeq, keys := range cli.watched {
@@ -46,6 +48,10 @@ func execTX(server *Server, cli *Client, cmds [][]byte) resp.RedisData {
 		cli.revised = false
 	}()
 
+	if cli.txDirty {
+		return resp.MakeErrorData("EXECABORT Transaction discarded because of previous errors.")
+	}
+
 	if cli.revised {
 
 		return resp.MakeStringData("nil")
@@ -61,22 +67,18 @@ func execTX(server *Server, cli *Client, cmds [][]byte) resp.RedisData {
 		res, isWriteCommand := ExecCommand(server, cli, c, nil)
 
 		// 写命令需要完成aof持久化
-		if isWriteCommand {
+		if raw := rewriteForPropagation(c, res, cli.txRaw[i], global.Now()); isWriteCommand && len(raw) > 0 {
 
 			if cli.dbSeq != 0 {
 				// 多数据库场景需要加入数据库选择语句
 				dbStr := strconv.Itoa(cli.dbSeq)
 				server.aof.append([]byte(fmt.Sprintf("*2\r\n$6\r\nselect\r\n$%d\r\n%s\r\n", len(dbStr), dbStr)))
 			}
-			server.aof.append(cli.txRaw[i])
+			server.aof.append(raw)
 		}
 
+		// 执行时发生的错误不会影响之后的命令，错误会作为回复返回
 		reses[i] = res
-
-		if fmt.Sprintf("%T", res) == "*resp.ErrorData" {
-
-			return resp.MakeArrayData(reses[0 : i+1])
-		}
 	}
 
 	return resp.MakeArrayData(reses)
@@ -117,6 +119,7 @@ func discard(_ *Server, cli *Client, cmd [][]byte) resp.RedisData {
 	}
 
 	cli.inTx = false
+	cli.txDirty = false
 	cli.tx = make([][][]byte, 0)
 	cli.watched = make(map[int][]string)
 	cli.revised = false
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"testing"
+)
+
+func TestExecRuntimeError(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.aofEnabled = false
+	cli := NewFakeClient()
+
+	execCmd(s, cli, "set", "str", "value")
+
+	// 执行时的错误不会中断事务，所有命令都会被执行
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "multi"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "set", "a", "1"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "lpush", "str", "v"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "incr", "a"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "get", "a"))
+
+	ret, ok := execCmd(s, cli, "exec").(*resp.ArrayData)
+	assert.True(t, ok)
+	assert.Equal(t, []resp.RedisData{
+		resp.MakeStringData("OK"),
+		resp.MakeErrorData("WRONGTYPE Operation against a key holding the wrong kind of value"),
+		resp.MakeIntData(2),
+		resp.MakeBulkData([]byte("2")),
+	}, ret.Data())
+	assert.Equal(t, resp.MakeBulkData([]byte("2")), execCmd(s, cli, "get", "a"))
+}
+
+func TestExecAbortOnQueueError(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.aofEnabled = false
+	cli := NewFakeClient()
+
+	// 参数数量错误以及不存在的命令在入队时返回错误，整个事务会被放弃
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "multi"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "set", "a", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR wrong number of arguments for 'get' command"), execCmd(s, cli, "get", "a", "b"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "set", "b", "1"))
+	assert.Equal(t, resp.MakeErrorData("EXECABORT Transaction discarded because of previous errors."), execCmd(s, cli, "exec"))
+	assert.Equal(t, resp.MakeStringData("nil"), execCmd(s, cli, "get", "a"))
+	assert.Equal(t, resp.MakeStringData("nil"), execCmd(s, cli, "get", "b"))
+
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "multi"))
+	assert.Equal(t, resp.UnknownCommandError("notexist", nil), execCmd(s, cli, "notexist"))
+	assert.Equal(t, resp.MakeErrorData("EXECABORT Transaction discarded because of previous errors."), execCmd(s, cli, "exec"))
+
+	// 新的事务不受之前错误的影响
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "multi"))
+	assert.Equal(t, resp.MakeErrorData("ERR wrong number of arguments for 'set' command"), execCmd(s, cli, "set", "a"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "discard"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, cli, "multi"))
+	assert.Equal(t, resp.MakeStringData("QUEUED"), execCmd(s, cli, "set", "a", "1"))
+	assert.Equal(t, "*1\r\n+OK\r\n", string(execCmd(s, cli, "exec").ToBytes()))
+}
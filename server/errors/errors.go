@@ -20,3 +20,7 @@ func ErrorUserNotExist(args string) error {
 func ErrorPasswordNotExist(args string) error {
 	return errors.New(fmt.Sprintf("Err password not exists '%s'", args))
 }
+
+func ErrorCommandNotExist(args string) error {
+	return errors.New(fmt.Sprintf("Err command not exists '%s'", args))
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"github.com/tangrc99/MemTable/resp"
+	"strings"
+)
+
+// execRejectedCommands 是会阻塞客户端或者持续推送消息的命令，Exec 无法等待这些命令的回复
+var execRejectedCommands = map[string]struct{}{
+	"blpop": {}, "brpop": {}, "wait": {}, "waitaof": {}, "subscribe": {}, "monitor": {}, "sync": {}, "psync": {},
+}
+
+// Exec 在 db 为 dbIndex 的情况下执行一条命令，并阻塞等待事件循环返回结果。命令不经过网络连接，
+// 可以用于嵌入以及基准测试。调用前必须已经启动事件循环，阻塞类命令会直接返回错误。
+func (s *Server) Exec(dbIndex int, cmd [][]byte) resp.RedisData {
+
+	if dbIndex < 0 || dbIndex >= s.dbNum {
+		return resp.MakeErrorData("ERR DB index is out of range")
+	}
+	if len(cmd) == 0 {
+		return resp.MakeErrorData("error: empty command")
+	}
+	if name := strings.ToLower(string(cmd[0])); execRejected(name) {
+		return resp.MakeErrorData("ERR command '" + name + "' can't be used by Exec")
+	}
+
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	// 客户端被清理后需要重新创建
+	if s.execCli == nil || s.execCli.getStatus() == EXIT {
+		s.execCli = NewFakeClient()
+	}
+
+	cli := s.execCli
+	cli.dbSeq = dbIndex
+	cli.cmd = cmd
+	cli.raw = nil
+	// 写命令的 resp 格式会在事件循环中生成
+	cli.pipelined = true
+
+	s.events <- ePool.newEvent(cli)
+
+	return *<-cli.res
+}
+
+// execRejected 检查命令是否不能通过 Exec 执行
+func execRejected(name string) bool {
+	_, rejected := execRejectedCommands[name]
+	return rejected
+}
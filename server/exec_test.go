@@ -0,0 +1,95 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"strconv"
+	"testing"
+)
+
+func newExecServer(tb testing.TB) *Server {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = ""
+	s.dir = tb.TempDir()
+	s.aofEnabled = false
+
+	go s.eventLoop()
+	tb.Cleanup(s.stop)
+
+	return s
+}
+
+// toBytesSlice 将字符串参数转换为命令
+func toBytesSlice(strs ...string) [][]byte {
+	ret := make([][]byte, len(strs))
+	for i := range strs {
+		ret[i] = []byte(strs[i])
+	}
+	return ret
+}
+
+// execCmd 以 cli 的身份执行一条命令，cli 为 nil 时通过 Exec 在 0 号数据库中执行
+func execCmd(s *Server, cli *Client, args ...string) resp.RedisData {
+	if cli == nil {
+		return s.Exec(0, toBytesSlice(args...))
+	}
+	ret, _ := ExecCommand(s, cli, toBytesSlice(args...), nil)
+	return ret
+}
+
+// execString 执行命令，并将返回的状态回复转换为字符串
+func execString(s *Server, args ...string) string {
+	return string(execCmd(s, nil, args...).ByteData())
+}
+
+func TestServerExec(t *testing.T) {
+	s := newExecServer(t)
+
+	assert.Equal(t, resp.MakeStringData("OK"), s.Exec(0, [][]byte{[]byte("set"), []byte("k"), []byte("v")}))
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), s.Exec(0, [][]byte{[]byte("get"), []byte("k")}))
+
+	// 不同的数据库之间是隔离的
+	assert.Equal(t, resp.MakeStringData("nil"), s.Exec(1, [][]byte{[]byte("get"), []byte("k")}))
+	assert.Equal(t, 1, s.dbs[0].Size())
+	assert.Equal(t, 0, s.dbs[1].Size())
+
+	assert.Equal(t, resp.MakeErrorData("ERR DB index is out of range"), s.Exec(s.dbNum, [][]byte{[]byte("get"), []byte("k")}))
+	assert.Equal(t, resp.UnknownCommandError("nosuchcommand", nil), s.Exec(0, [][]byte{[]byte("nosuchcommand")}))
+
+	// 阻塞类命令直接返回错误，之后的命令可以正常执行
+	assert.Equal(t, resp.MakeErrorData("ERR command 'blpop' can't be used by Exec"),
+		s.Exec(0, [][]byte{[]byte("BLPOP"), []byte("l"), []byte("0")}))
+	assert.Equal(t, resp.MakeErrorData("ERR command 'subscribe' can't be used by Exec"),
+		s.Exec(0, [][]byte{[]byte("subscribe"), []byte("ch")}))
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), s.Exec(0, [][]byte{[]byte("get"), []byte("k")}))
+}
+
+func BenchmarkServerExecSet(b *testing.B) {
+	s := newExecServer(b)
+
+	cmd := [][]byte{[]byte("set"), nil, []byte("value")}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cmd[1] = []byte(strconv.Itoa(i % 10000))
+		s.Exec(0, cmd)
+	}
+}
+
+func BenchmarkServerExecGet(b *testing.B) {
+	s := newExecServer(b)
+
+	for i := 0; i < 10000; i++ {
+		s.Exec(0, [][]byte{[]byte("set"), []byte(strconv.Itoa(i)), []byte("value")})
+	}
+	cmd := [][]byte{[]byte("get"), nil}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cmd[1] = []byte(strconv.Itoa(i % 10000))
+		s.Exec(0, cmd)
+	}
+}
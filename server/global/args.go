@@ -0,0 +1,105 @@
+package global
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// argKind 是参数的类型约束
+type argKind int
+
+const (
+	argInteger argKind = iota // 64 位有符号整数
+	argFloat                  // 浮点数，不能为 NaN
+	argKeyword                // words 中的一个关键字，不区分大小写
+	argOptions                // 从 pos 开始的所有参数都是 words 中的选项，values 中的选项之后需要跟随一个整数
+)
+
+// argSpec 描述命令中一个位置参数的约束，pos 包括命令名称本身
+type argSpec struct {
+	pos    int
+	kind   argKind
+	words  []string
+	values []string
+}
+
+// ParseInteger 将参数解析为 64 位整数，失败时返回 ErrNotInteger
+func ParseInteger(arg []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	return n, nil
+}
+
+// ParseFloat 将参数解析为浮点数，失败或者结果为 NaN 时返回 ErrNotFloat
+func ParseFloat(arg []byte) (float64, error) {
+	f, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, ErrNotFloat
+	}
+	return f, nil
+}
+
+// check 检查参数是否满足约束
+func (spec *argSpec) check(arg []byte) error {
+	var err error
+	switch spec.kind {
+	case argInteger:
+		_, err = ParseInteger(arg)
+	case argFloat:
+		_, err = ParseFloat(arg)
+	case argKeyword:
+		if !containsFold(spec.words, arg) {
+			err = ErrSyntax
+		}
+	}
+	return err
+}
+
+// checkOptions 检查从 pos 开始的选项参数，选项之间的冲突仍然由命令自身检查
+func (spec *argSpec) checkOptions(args [][]byte) error {
+	for i := spec.pos; i < len(args); i++ {
+		if containsFold(spec.words, args[i]) {
+			continue
+		}
+		if !containsFold(spec.values, args[i]) || i+1 >= len(args) {
+			return ErrSyntax
+		}
+		i++
+		if _, err := ParseInteger(args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsFold 判断 arg 是否为 words 中的一个，不区分大小写
+func containsFold(words []string, arg []byte) bool {
+	for _, word := range words {
+		if strings.EqualFold(word, string(arg)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckArgs 在命令执行前检查位置参数的格式，args 包括命令名称本身。不存在的参数不做检查，由参数数量的检查负责
+func (c *Command) CheckArgs(args [][]byte) error {
+	for i := range c.args {
+		if c.args[i].pos >= len(args) {
+			continue
+		}
+		var err error
+		if c.args[i].kind == argOptions {
+			err = c.args[i].checkOptions(args)
+		} else {
+			err = c.args[i].check(args[c.args[i].pos])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
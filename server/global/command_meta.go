@@ -0,0 +1,209 @@
+package global
+
+// commandArity 记录命令的参数数量，包括命令名称本身。正数代表参数数量固定，负数代表参数数量至少为其绝对值，
+// 与 redis 中的定义相同。没有记录的命令不做检查
+var commandArity = map[string]int{
+	"acl": -2, "append": 3, "asking": 1, "auth": -2,
+	"bf.add": 3, "bf.exists": 3, "bf.info": -2, "bf.madd": -3, "bf.mexists": -3, "bf.reserve": -4,
+	"bgsave": -1, "bitcount": -2, "bitfield": -2, "bitpos": -3, "blpop": -3, "brpop": -3,
+	"client": -2, "cluster": -2, "command": -1, "dbsize": 1, "debug": -2,
+	"decr": 2, "decrby": 3, "del": -2, "discard": 1, "dump": 2, "eval": -3, "exec": 1, "exists": -2,
+	"expire": -3, "expireat": -3, "flushall": -1, "flushdb": -1,
+	"get": 2, "getbit": 3, "getex": -2, "getrange": 4, "getset": 3,
+	"hdel": -3, "hello": -1, "hexists": 3, "hexpire": -6, "hexpireat": -6, "hget": 3, "hgetall": 2,
+	"hincrby": 4, "hkeys": 2, "hlen": 2, "hmget": -3, "hmset": -4, "hpersist": -5, "hrandfield": -2, "hset": -4, "hstrlen": 3,
+	"httl": -5, "hvals": 2,
+	"incr": 2, "incrby": 3, "incrbyfloat": 3, "info": -1, "keys": 2, "latency": -2, "lcs": -3,
+	"lindex": 3, "llen": 2, "lmove": 5, "lpop": -2, "lpos": -3, "lpush": -3, "lrange": 4, "lrem": 4,
+	"lset": 4, "ltrim": 4, "memory": -2, "mget": -2, "migrate": -6, "move": 3, "copy": -3, "mset": -3, "multi": 1,
+	"object": -2, "pexpire": -3, "pexpireat": -3, "ping": -1, "psync": -3, "publish": 3, "quit": -1,
+	"randomkey": 1, "readonly": 1, "readwrite": 1, "rename": 3, "replconf": -1, "reset": 1, "restore": -4, "role": 1,
+	"rpop": -2, "rpush": -3, "sadd": -3, "save": 1, "scan": -2, "scard": 2, "script": -2, "sdiff": -2, "sdiffstore": -3,
+	"select": 2, "set": -3, "setbit": 4, "setrange": 4, "shutdown": -1, "sinter": -2, "sinterstore": -3,
+	"sismember": 3, "slaveof": 3, "slowlog": -2, "smembers": 2, "smove": 4, "spop": -2, "srandmember": -2,
+	"srem": -3, "strlen": 2, "subscribe": -2, "sunion": -2, "sunionstore": -3, "swapdb": 3, "sync": 1,
+	"ttl": 2, "type": 2, "unsubscribe": -1, "wait": 3, "waitaof": 4, "watch": -2,
+	"xack": -4, "xadd": -5, "xgroup": -2, "xlen": 2, "xrange": -4, "xread": -4, "xreadgroup": -7,
+	"zadd": -4, "zcard": 2, "zcount": 4, "zincrby": 4, "zrange": -4, "zrangebyscore": -4, "zrank": -3,
+	"zrem": -3, "zremrangebyrank": 4, "zremrangebyscore": 4, "zrevrange": -4, "zrevrangebyscore": -4,
+	"zrevrank": -3, "zscore": 3,
+}
+
+// keySpec 描述命令中键参数的位置，first、last 以及 step 与 redis 中的定义相同，last 为负数时从参数末尾开始计算。
+// numKeys 不为 0 时，键的数量由该位置的参数指定，例如 eval
+type keySpec struct {
+	first   int
+	last    int
+	step    int
+	numKeys int
+}
+
+// commandKeySpecs 记录包含键参数的命令，没有记录的命令视为没有键参数
+var commandKeySpecs = map[string]keySpec{
+	"append": {1, 1, 1, 0}, "bitcount": {1, 1, 1, 0}, "bitfield": {1, 1, 1, 0}, "bitpos": {1, 1, 1, 0},
+	"bf.add": {1, 1, 1, 0}, "bf.exists": {1, 1, 1, 0}, "bf.info": {1, 1, 1, 0}, "bf.madd": {1, 1, 1, 0},
+	"bf.mexists": {1, 1, 1, 0}, "bf.reserve": {1, 1, 1, 0},
+	"blpop": {1, -2, 1, 0}, "brpop": {1, -2, 1, 0},
+	"decr": {1, 1, 1, 0}, "decrby": {1, 1, 1, 0}, "del": {1, -1, 1, 0}, "dump": {1, 1, 1, 0}, "exists": {1, -1, 1, 0},
+	"eval": {3, 0, 1, 2}, "expire": {1, 1, 1, 0}, "expireat": {1, 1, 1, 0}, "pexpire": {1, 1, 1, 0}, "pexpireat": {1, 1, 1, 0},
+	"get": {1, 1, 1, 0}, "getbit": {1, 1, 1, 0}, "getex": {1, 1, 1, 0}, "getrange": {1, 1, 1, 0}, "getset": {1, 1, 1, 0},
+	"hdel": {1, 1, 1, 0}, "hexists": {1, 1, 1, 0}, "hexpire": {1, 1, 1, 0}, "hexpireat": {1, 1, 1, 0}, "hget": {1, 1, 1, 0},
+	"hgetall": {1, 1, 1, 0}, "hincrby": {1, 1, 1, 0}, "hkeys": {1, 1, 1, 0}, "hlen": {1, 1, 1, 0}, "hmget": {1, 1, 1, 0},
+	"hmset": {1, 1, 1, 0}, "hpersist": {1, 1, 1, 0}, "hrandfield": {1, 1, 1, 0}, "hset": {1, 1, 1, 0},
+	"hstrlen": {1, 1, 1, 0}, "httl": {1, 1, 1, 0}, "hvals": {1, 1, 1, 0},
+	"incr": {1, 1, 1, 0}, "incrby": {1, 1, 1, 0}, "incrbyfloat": {1, 1, 1, 0},
+	"lcs": {1, 2, 1, 0}, "lindex": {1, 1, 1, 0}, "llen": {1, 1, 1, 0}, "lmove": {1, 2, 1, 0}, "lpop": {1, 1, 1, 0},
+	"lpos": {1, 1, 1, 0}, "lpush": {1, 1, 1, 0}, "lrange": {1, 1, 1, 0}, "lrem": {1, 1, 1, 0},
+	"lset": {1, 1, 1, 0}, "ltrim": {1, 1, 1, 0},
+	"mget": {1, -1, 1, 0}, "migrate": {3, 3, 1, 0}, "mset": {1, -1, 2, 0}, "move": {1, 1, 1, 0}, "copy": {1, 2, 1, 0}, "object": {2, 2, 1, 0},
+	"rename": {1, 2, 1, 0}, "restore": {1, 1, 1, 0}, "rpop": {1, 1, 1, 0}, "rpush": {1, 1, 1, 0},
+	"sadd": {1, 1, 1, 0}, "scard": {1, 1, 1, 0}, "sdiff": {1, -1, 1, 0}, "sdiffstore": {1, -1, 1, 0},
+	"set": {1, 1, 1, 0}, "setbit": {1, 1, 1, 0}, "setrange": {1, 1, 1, 0}, "sinter": {1, -1, 1, 0},
+	"sinterstore": {1, -1, 1, 0}, "sismember": {1, 1, 1, 0}, "smembers": {1, 1, 1, 0}, "smove": {1, 2, 1, 0},
+	"spop": {1, 1, 1, 0}, "srandmember": {1, 1, 1, 0}, "srem": {1, 1, 1, 0}, "strlen": {1, 1, 1, 0},
+	"sunion": {1, -1, 1, 0}, "sunionstore": {1, -1, 1, 0},
+	"ttl": {1, 1, 1, 0}, "type": {1, 1, 1, 0}, "watch": {1, -1, 1, 0},
+	"xack": {1, 1, 1, 0}, "xadd": {1, 1, 1, 0}, "xgroup": {2, 2, 1, 0}, "xlen": {1, 1, 1, 0}, "xrange": {1, 1, 1, 0},
+	"zadd": {1, 1, 1, 0}, "zcard": {1, 1, 1, 0}, "zcount": {1, 1, 1, 0}, "zincrby": {1, 1, 1, 0},
+	"zrange": {1, 1, 1, 0}, "zrangebyscore": {1, 1, 1, 0}, "zrank": {1, 1, 1, 0}, "zrem": {1, 1, 1, 0},
+	"zremrangebyrank": {1, 1, 1, 0}, "zremrangebyscore": {1, 1, 1, 0}, "zrevrange": {1, 1, 1, 0},
+	"zrevrangebyscore": {1, 1, 1, 0}, "zrevrank": {1, 1, 1, 0}, "zscore": {1, 1, 1, 0},
+}
+
+// positions 返回参数数量为 argc 的命令中键参数的位置，numKeys 为 eval 等命令中指定的键数量
+func (spec *keySpec) positions(argc int, numKeys int) []int {
+
+	last := spec.last
+	if spec.numKeys != 0 {
+		last = spec.first + numKeys - 1
+	} else if last < 0 {
+		last = argc + last
+	}
+
+	keys := make([]int, 0)
+	for i := spec.first; i <= last && i < argc; i += spec.step {
+		keys = append(keys, i)
+	}
+	return keys
+}
+
+var (
+	integerArg   = func(pos int) argSpec { return argSpec{pos: pos, kind: argInteger} }
+	floatArg     = func(pos int) argSpec { return argSpec{pos: pos, kind: argFloat} }
+	directionArg = func(pos int) argSpec {
+		return argSpec{pos: pos, kind: argKeyword, words: []string{"left", "right"}}
+	}
+	optionsArg = func(pos int, words []string, values []string) argSpec {
+		return argSpec{pos: pos, kind: argOptions, words: words, values: values}
+	}
+)
+
+// commandArgSpecs 记录命令位置参数的格式约束，命令执行前会先进行检查，使各个命令返回统一的错误信息。
+// 位置固定的参数只检查格式；选项参数只检查关键字以及选项值的格式，选项之间的冲突仍然由命令自身检查
+var commandArgSpecs = map[string][]argSpec{
+	"decrby":          {integerArg(2)},
+	"expire":          {integerArg(2)},
+	"expireat":        {integerArg(2)},
+	"getrange":        {integerArg(2), integerArg(3)},
+	"hexpire":         {integerArg(2)},
+	"hexpireat":       {integerArg(2)},
+	"hincrby":         {integerArg(3)},
+	"incrby":          {integerArg(2)},
+	"incrbyfloat":     {floatArg(2)},
+	"lindex":          {integerArg(2)},
+	"lmove":           {directionArg(3), directionArg(4)},
+	"lrange":          {integerArg(2), integerArg(3)},
+	"lrem":            {integerArg(2)},
+	"lset":            {integerArg(2)},
+	"ltrim":           {integerArg(2), integerArg(3)},
+	"migrate":         {integerArg(2), integerArg(4), integerArg(5)},
+	"pexpire":         {integerArg(2)},
+	"pexpireat":       {integerArg(2)},
+	"restore":         {integerArg(2)},
+	"select":          {integerArg(1)},
+	"set":             {optionsArg(3, []string{"nx", "xx", "get", "keepttl"}, []string{"ex", "px", "exat", "pxat"})},
+	"setrange":        {integerArg(2)},
+	"zincrby":         {floatArg(2)},
+	"zrange":          {integerArg(2), integerArg(3)},
+	"zremrangebyrank": {integerArg(2), integerArg(3)},
+	"zrevrange":       {integerArg(2), integerArg(3)},
+}
+
+// commandSubcommands 记录具有子命令的命令的帮助信息，每个子命令占用两行，第一行为格式，第二行为说明。
+// 这些命令会自动支持 HELP 子命令
+var commandSubcommands = map[string][]string{
+	"object": {
+		"ENCODING <key>",
+		"    Return the kind of internal representation used in order to store the value associated with a <key>.",
+		"FREQ <key>",
+		"    Return the access frequency index of the <key>. The returned integer is proportional to the logarithm of the recent access frequency of the key.",
+		"IDLETIME <key>",
+		"    Return the idle time of the <key>, that is the approximated number of seconds elapsed since the last access to the key.",
+	},
+	"client": {
+		"LIST",
+		"    Return information about client connections.",
+		"KILL <ip:port> | KILL ADDR <ip:port>",
+		"    Kill connection made from <ip:port>.",
+		"TRACKING (ON|OFF) [REDIRECT <id>] [BCAST] [PREFIX <prefix> ...]",
+		"    Control server assisted client side caching.",
+		"UNBLOCK <clientid> [TIMEOUT|ERROR]",
+		"    Unblock the specified blocked client.",
+		"KEEPALIVE (ON|OFF)",
+		"    Control whether the server sends PING to the idle connection, the client must reply PONG.",
+		"PAUSE <timeout> [WRITE|ALL]",
+		"    Suspend all, or just write, clients for <timeout> milliseconds.",
+		"UNPAUSE",
+		"    Stop the current client pause, resuming traffic.",
+	},
+	"command": {
+		"COUNT",
+		"    Return the total number of commands in this server.",
+		"DOCS [<command-name> ...]",
+		"    Return documentary information about commands.",
+		"GETKEYS <full-command>",
+		"    Return the keys from a full command.",
+		"LIST [FILTERBY (MODULE <module-name>|ACLCAT <category>|PATTERN <pattern>)]",
+		"    Return a list of all commands in this server.",
+	},
+	"debug": {
+		"OBJECT <key>",
+		"    Show low level info about the <key> and associated value.",
+		"DIGEST",
+		"    Output a hex signature representing the current DB content.",
+		"DIGEST-VALUE <key> [<key> ...]",
+		"    Output a hex signature of the values of all the specified keys.",
+		"RELOAD",
+		"    Save the RDB on disk and reload it back to memory.",
+		"LISTPACK-ENTRIES [<n>]",
+		"    Show or set the max number of entries of the listpack encoding.",
+		"LISTPACK-VALUE [<n>] | QUICKLIST-PACKED-THRESHOLD [<n>]",
+		"    Show or set the max length of an element of the listpack encoding.",
+		"INTSET-ENTRIES [<n>]",
+		"    Show or set the max number of entries of the intset encoding.",
+		"SET-RANDOM-SEED [<seed>]",
+		"    Use a fixed seed for random commands, or a time based seed if no seed is given.",
+		"CHANGE-REPL-ID",
+		"    Change the replication ID of the instance.",
+		"STRINGMATCH-LEN <pattern> <string>",
+		"    Return 1 if the glob-style <pattern> matches <string>, otherwise 0.",
+	},
+	"slowlog": {
+		"GET <count>",
+		"    Return top <count> entries from the slowlog.",
+		"LEN",
+		"    Return the length of the slowlog.",
+		"RESET",
+		"    Reset the slowlog.",
+	},
+	"latency": {
+		"HISTORY <event>",
+		"    Return time-latency samples for the <event> class.",
+		"LATEST",
+		"    Return the latest latency samples for all events.",
+		"HISTOGRAM [<command> ...]",
+		"    Return a cumulative distribution of latencies in the format of a histogram for the specified command names.",
+		"RESET [<event> ...]",
+		"    Reset latency data of one or more <event> classes.",
+	},
+}
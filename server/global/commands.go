@@ -1,5 +1,11 @@
 package global
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // ExecStatus 标识一个 command 是否为写操作
 type ExecStatus int
 
@@ -19,16 +25,68 @@ const (
 )
 
 type Command struct {
-	id int         // 命令 id
-	es ExecStatus  // 命令读写类型
-	ct CommandType // 命令类型
-	f  any         // 命令函数，为了防止包循环引用，因此使用 any 接口
+	id    int         // 命令 id
+	name  string      // 注册时的原始名称
+	arity int         // 参数数量，为 0 时不做检查
+	keys  *keySpec    // 键参数的位置，为空时没有键参数
+	args  []argSpec   // 位置参数的格式约束
+	es    ExecStatus  // 命令读写类型
+	ct    CommandType // 命令类型
+	f     any         // 命令函数，为了防止包循环引用，因此使用 any 接口
 }
 
 func (c *Command) GetId() int {
 	return c.id
 }
 
+// Name 返回命令注册时的原始名称，命令被重命名后不会改变
+func (c *Command) Name() string {
+	return c.name
+}
+
+// CheckArity 判断参数数量 argc 是否符合命令的要求，argc 包括命令名称本身
+func (c *Command) CheckArity(argc int) bool {
+	if c.arity >= 0 {
+		return c.arity == 0 || argc == c.arity
+	}
+	return argc >= -c.arity
+}
+
+// GetKeys 返回命令参数 args 中键参数的位置，args 包括命令名称本身。命令没有键参数或者键的数量不合法时返回 false
+func (c *Command) GetKeys(args [][]byte) ([]int, bool) {
+	if c.keys == nil {
+		return nil, false
+	}
+
+	numKeys := 0
+	if c.keys.numKeys != 0 {
+		if c.keys.numKeys >= len(args) {
+			return nil, false
+		}
+		n, err := strconv.Atoi(string(args[c.keys.numKeys]))
+		if err != nil || n < 0 || c.keys.first+n > len(args) {
+			return nil, false
+		}
+		numKeys = n
+	}
+
+	return c.keys.positions(len(args), numKeys), true
+}
+
+// Help 返回命令 HELP 子命令的回复内容，命令没有子命令时返回空值
+func (c *Command) Help() []string {
+	subcommands, ok := commandSubcommands[c.name]
+	if !ok {
+		return nil
+	}
+
+	lines := make([]string, 0, len(subcommands)+3)
+	lines = append(lines, fmt.Sprintf("%s <subcommand> [<arg> [value] [opt] ...]. Subcommands are:", strings.ToUpper(c.name)))
+	lines = append(lines, subcommands...)
+	lines = append(lines, "HELP", "    Print this help.")
+	return lines
+}
+
 func (c *Command) Type() CommandType {
 	return c.ct
 }
@@ -46,6 +104,12 @@ var commandTable = make(map[string]Command)
 
 func registerCommand(name string, cmd Command) {
 	cmd.id = id
+	cmd.name = name
+	cmd.arity = commandArity[name]
+	if spec, ok := commandKeySpecs[name]; ok {
+		cmd.keys = &spec
+	}
+	cmd.args = commandArgSpecs[name]
 	id++
 	commandTable[name] = cmd
 }
@@ -68,6 +132,24 @@ func RegisterServerCommand(name string, cmd any, status ExecStatus) {
 	registerCommand(name, c)
 }
 
+// RenameCommand 将命令 name 重命名为 newName，newName 为空时禁用该命令。命令不存在或者新名称已经被占用时返回 false，
+// 需要在接受连接之前调用
+func RenameCommand(name, newName string) bool {
+	cmd, exist := commandTable[name]
+	if !exist {
+		return false
+	}
+	if _, occupied := commandTable[newName]; occupied && newName != name {
+		return false
+	}
+
+	delete(commandTable, name)
+	if newName != "" {
+		commandTable[newName] = cmd
+	}
+	return true
+}
+
 func FindCommand(name string) (cmd Command, exist bool) {
 	cmd, exist = commandTable[name]
 	return cmd, exist
@@ -12,14 +12,25 @@ const (
 
 const (
 	TECleanClients = 10 * time.Second
-	TEExpireKey    = time.Second
 	TEAOF          = time.Second
 	TEBgSave       = 5 * time.Second
 	TEUpdateStatus = time.Second
+	TEStatsSample  = 100 * time.Millisecond
 	TEReplica      = 200 * time.Millisecond
 	TECluster      = 200 * time.Millisecond
 )
 
+/* ---------------------------------------------------------------------------
+* Expire
+* ------------------------------------------------------------------------- */
+
+const (
+	ExpireCycleSamples     = 20   // 每一轮抽样的键数量
+	ExpireCycleAcceptable  = 25   // 一轮抽样中过期键所占百分比超过该值时继续抽样
+	ExpireCycleMaxLoops    = 1000 // 每一个数据库最多抽样的轮数
+	ExpireCycleTimePercent = 25   // 每一次过期清理最多占用定时任务周期的百分比
+)
+
 const (
 	RsMaxIdle    = 10
 	RsBackLogCap = 1 << 20
@@ -0,0 +1,14 @@
+package global
+
+import (
+	"errors"
+	"github.com/tangrc99/MemTable/resp"
+)
+
+// 命令执行失败时返回的错误，错误信息定义在 resp 包中
+var (
+	ErrWrongType  = errors.New(resp.WrongTypeMessage)
+	ErrNotInteger = errors.New(resp.NotIntegerMessage)
+	ErrNotFloat   = errors.New(resp.NotFloatMessage)
+	ErrSyntax     = errors.New(resp.SyntaxMessage)
+)
@@ -2,6 +2,15 @@ package global
 
 import "time"
 
+// Version 是服务器的版本号，由 main 包在启动时设置
+var Version = "unknown"
+
+// MaxReplyElements 是 KEYS 等命令一次最多返回的元素数量，由 max-reply-elements 配置，0 代表不限制
+var MaxReplyElements = 0
+
+// CommandTimeBudget 是 SINTER 等耗时的读命令最多占用事件循环的时间，由 command-time-budget 配置，0 代表不限制
+var CommandTimeBudget time.Duration = 0
+
 func init() {
-	Now = time.Now()
+	UpdateGlobalClock()
 }
@@ -1,12 +1,25 @@
 package global
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
-// Now 是全局时钟，由于使用精准时钟是一个非常耗时的操作，所以使用一个全局时钟。
-// 每一次 EventLoop 会更新一次全局时钟。
-var Now time.Time
+// now 是全局时钟，由于使用精准时钟是一个非常耗时的操作，所以使用一个全局时钟。
+// 每一次 EventLoop 会更新一次全局时钟，事件循环之外的协程也会读取，所以需要原子地替换。
+var now atomic.Pointer[time.Time]
 
-// UpdateGlobalClock 更新全局时钟 global.Now
+// Now 返回全局时钟
+func Now() time.Time {
+	return *now.Load()
+}
+
+// UpdateGlobalClock 使用当前时间更新全局时钟
 func UpdateGlobalClock() {
-	Now = time.Now()
+	SetGlobalClock(time.Now())
+}
+
+// SetGlobalClock 将全局时钟设置为指定的时间，可以在测试中模拟时间的流逝
+func SetGlobalClock(t time.Time) {
+	now.Store(&t)
 }
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"github.com/tangrc99/MemTable/resp"
+	"io"
+	"sync/atomic"
+)
+
+// errInflightExceeded 代表连接中尚未执行的命令占用的字节数超过了上限
+var errInflightExceeded = errors.New("ERR client exceeded the max inflight bytes limit, closing connection")
+
+// inflightReader 统计连接中已经读取但尚未交给事件循环执行的字节数，超过上限时读取会返回错误。
+// 这样单个客户端发送的超大命令或者大量未执行的命令不会耗尽服务器的内存
+type inflightReader struct {
+	r        io.Reader
+	limit    int64        // 上限，小于等于 0 时不做限制
+	inflight atomic.Int64 // 已经读取但是还没有释放的字节数
+	total    int64        // 读取的总字节数，只会在解析协程中访问
+	consumed int64        // 最近一次解析出完整命令时读取的总字节数
+}
+
+// inflightRequest 是解析协程发送给连接协程的命令，size 是命令占用的字节数
+type inflightRequest struct {
+	parsed *resp.ParsedRes
+	size   int64
+}
+
+func newInflightReader(r io.Reader, limit int64) *inflightReader {
+	return &inflightReader{
+		r:     r,
+		limit: limit,
+	}
+}
+
+func (r *inflightReader) Read(p []byte) (int, error) {
+
+	if r.limit > 0 {
+		remain := r.limit - r.inflight.Load()
+		if remain <= 0 {
+			return 0, errInflightExceeded
+		}
+		// 不会读取超过上限的数据
+		if int64(len(p)) > remain {
+			p = p[:remain]
+		}
+	}
+
+	n, err := r.r.Read(p)
+	r.inflight.Add(int64(n))
+	r.total += int64(n)
+	return n, err
+}
+
+// parsed 返回自上一次调用以来读取的字节数，需要在解析出一条完整的命令之后调用
+func (r *inflightReader) parsed() int64 {
+	n := r.total - r.consumed
+	r.consumed = r.total
+	return n
+}
+
+// release 在命令交给事件循环之后调用，释放命令占用的字节数
+func (r *inflightReader) release(n int64) {
+	r.inflight.Add(-n)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInflightReader(t *testing.T) {
+
+	r := newInflightReader(strings.NewReader(strings.Repeat("a", 100)), 30)
+
+	buf := make([]byte, 100)
+	n, err := r.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, n)
+
+	// 上限已满时读取会返回错误
+	_, err = r.Read(buf)
+	assert.Equal(t, errInflightExceeded, err)
+
+	// 释放之后可以继续读取
+	assert.Equal(t, int64(30), r.parsed())
+	r.release(20)
+	n, err = r.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, n)
+	assert.Equal(t, int64(20), r.parsed())
+	assert.Equal(t, int64(0), r.parsed())
+
+	// 上限小于等于 0 时不做限制
+	r = newInflightReader(strings.NewReader(strings.Repeat("a", 100)), 0)
+	n, err = r.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, n)
+}
+
+func TestHandleReadInflightLimit(t *testing.T) {
+	s := newExecServer(t)
+	s.maxInflight = 64
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go s.handleRead(server)
+
+	reader := bufio.NewReader(client)
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// 未超过上限的命令可以正常执行
+	_, err := client.Write([]byte("*3\r\n$3\r\nset\r\n$1\r\nk\r\n$1\r\nv\r\n"))
+	assert.Nil(t, err)
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+OK\r\n", line)
+
+	// 超过上限的命令会导致连接被关闭
+	go func() {
+		_, _ = client.Write([]byte("*3\r\n$3\r\nset\r\n$1\r\nk\r\n$200\r\n" + strings.Repeat("v", 200) + "\r\n"))
+	}()
+
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "-"+errInflightExceeded.Error()+"\r\n", line)
+
+	_, err = reader.ReadString('\n')
+	assert.Equal(t, io.EOF, err)
+}
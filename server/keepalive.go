@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/tls"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"net"
+	"strings"
+	"time"
+)
+
+// keepAliveConn 是可以设置 TCP keepalive 的连接，*net.TCPConn 实现了该接口
+type keepAliveConn interface {
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
+}
+
+// setKeepAlive 设置连接的 TCP keepalive，period 为 0 时关闭。unix socket 等不支持 keepalive 的连接会被忽略
+func setKeepAlive(conn net.Conn, period time.Duration) error {
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+
+	kc, ok := conn.(keepAliveConn)
+	if !ok {
+		return nil
+	}
+
+	if period <= 0 {
+		return kc.SetKeepAlive(false)
+	}
+	if err := kc.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return kc.SetKeepAlivePeriod(period)
+}
+
+// keepAlivePing 是发送给空闲客户端的 PING 消息
+var keepAlivePing resp.RedisData = resp.MakeArrayData([]resp.RedisData{resp.MakeBulkData([]byte("PING"))})
+
+// isKeepAlivePong 判断对端发送的消息是否为 PING 的回复
+func isKeepAlivePong(data resp.RedisData) bool {
+	str, ok := data.(*resp.StringData)
+	return ok && strings.ToUpper(str.Data()) == "PONG"
+}
+
+// lastActive 返回客户端最近一次通信的时间，回复 PING 同样视为通信
+func (cli *Client) lastActive() time.Time {
+	if pong := time.Unix(0, cli.pongAt.Load()); pong.After(cli.tp) {
+		return pong
+	}
+	return cli.tp
+}
+
+// PingIdle 向空闲时间超过 d 并且通过 client keepalive on 开启了 PING 的客户端发送 PING。对端失效时写入会失败，连接会被关闭并清理；
+// 发送 PING 之后超过 d 仍然没有回复的客户端会被直接移除。函数最多遍历 maxTraverse 个客户端
+func (clients *ClientList) PingIdle(maxTraverse int, d time.Duration) {
+
+	idle := global.Now().Add(-1 * d)
+
+	for node := clients.list.BackNode(); node != nil && maxTraverse > 0; maxTraverse-- {
+
+		cli, ok := node.Value.(*Client)
+		prev := node.Prev()
+
+		if !ok || !cli.keepAlive || !cli.IsRemovable() || cli.blocked || cli.cnn == nil || !cli.lastActive().Before(idle) {
+			node = prev
+			continue
+		}
+
+		if cli.pingAt.Before(cli.lastActive()) {
+			// 发送 PING，不能阻塞事件循环
+			select {
+			case cli.res <- &keepAlivePing:
+				cli.pingAt = global.Now()
+			default:
+			}
+
+		} else if cli.pingAt.Before(idle) {
+			// 错过了 keepalive 窗口
+			logger.Info("Client", cli.addr, "Missed Keepalive, Closing Connection")
+			clients.removeClientWithPosition(cli, node)
+		}
+
+		node = prev
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// keepAliveMockConn 记录 keepalive 的设置
+type keepAliveMockConn struct {
+	net.Conn
+	keepAlive bool
+	period    time.Duration
+}
+
+func (c *keepAliveMockConn) SetKeepAlive(keepalive bool) error {
+	c.keepAlive = keepalive
+	return nil
+}
+
+func (c *keepAliveMockConn) SetKeepAlivePeriod(d time.Duration) error {
+	c.period = d
+	return nil
+}
+
+func TestSetKeepAlive(t *testing.T) {
+
+	conn := &keepAliveMockConn{}
+	assert.Nil(t, setKeepAlive(conn, 10*time.Second))
+	assert.True(t, conn.keepAlive)
+	assert.Equal(t, 10*time.Second, conn.period)
+
+	assert.Nil(t, setKeepAlive(conn, 0))
+	assert.False(t, conn.keepAlive)
+
+	// 不支持 keepalive 的连接会被忽略
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	assert.Nil(t, setKeepAlive(server, 10*time.Second))
+}
+
+func TestKeepAlivePing(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = ""
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	s.keepAlivePing = 100 * time.Millisecond
+	go s.eventLoop()
+	t.Cleanup(s.stop)
+
+	connect := func(keepAlive bool) (net.Conn, *bufio.Reader) {
+		server, client := net.Pipe()
+		go s.handleRead(&keepAliveMockConn{Conn: server})
+		t.Cleanup(func() { _ = client.Close() })
+
+		_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+		reader := bufio.NewReader(client)
+
+		// 客户端在发送第一条命令之后才会加入客户端列表
+		_, err := client.Write([]byte("*1\r\n$4\r\nping\r\n"))
+		assert.Nil(t, err)
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err)
+		assert.Equal(t, "+pong\r\n", line)
+
+		// 只有开启了 keepalive 的客户端会收到 PING
+		if keepAlive {
+			_, err = client.Write([]byte("*3\r\n$6\r\nclient\r\n$9\r\nkeepalive\r\n$2\r\non\r\n"))
+			assert.Nil(t, err)
+			line, err = reader.ReadString('\n')
+			assert.Nil(t, err)
+			assert.Equal(t, "+OK\r\n", line)
+		}
+		return client, reader
+	}
+
+	alive, aliveReader := connect(true)
+	_, deadReader := connect(true)
+	plain, plainReader := connect(false)
+
+	// 回复 PONG 的客户端不会被断开
+	go func() {
+		for {
+			line, err := aliveReader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "PING\r\n" {
+				_, _ = alive.Write([]byte("+PONG\r\n"))
+			}
+		}
+	}()
+
+	// 不回复的客户端会在错过 keepalive 窗口之后被断开
+	pinged := false
+	for {
+		line, err := deadReader.ReadString('\n')
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+		if line == "PING\r\n" {
+			pinged = true
+		}
+	}
+	assert.True(t, pinged)
+
+	time.Sleep(300 * time.Millisecond)
+	_, err := alive.Write([]byte("*1\r\n$4\r\nping\r\n"))
+	assert.Nil(t, err)
+
+	// 没有开启 keepalive 的客户端不会收到 PING，之后的第一条回复就是命令的回复
+	_, err = plain.Write([]byte("*1\r\n$4\r\nping\r\n"))
+	assert.Nil(t, err)
+	line, err := plainReader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+pong\r\n", line)
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"fmt"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	latencyHistoryLen = 160 // 每一种事件最多保留的延迟尖峰数量
+	latencyBuckets    = 32  // 直方图的桶数量，第 i 个桶记录延迟小于 2^i 微秒的事件
+)
+
+// 事件循环中记录延迟的事件类型
+const (
+	latencyEventCommand     = "command"
+	latencyEventExpireCycle = "expire-cycle"
+)
+
+// latencySample 是一次延迟尖峰，记录发生的时间戳以及延迟毫秒数
+type latencySample struct {
+	timestamp int64
+	latency   int64
+}
+
+// latencyEvent 记录一种事件的延迟直方图以及最近的延迟尖峰
+type latencyEvent struct {
+	calls     int64
+	histogram [latencyBuckets]int64
+	samples   []latencySample // 环形缓冲区
+	next      int
+	max       int64
+}
+
+// addSpike 将一次延迟尖峰写入环形缓冲区，缓冲区已满时覆盖最旧的记录
+func (e *latencyEvent) addSpike(sample latencySample) {
+	if len(e.samples) < latencyHistoryLen {
+		e.samples = append(e.samples, sample)
+	} else {
+		e.samples[e.next] = sample
+	}
+	e.next = (e.next + 1) % latencyHistoryLen
+	if sample.latency > e.max {
+		e.max = sample.latency
+	}
+}
+
+// history 按照时间顺序返回所有的延迟尖峰
+func (e *latencyEvent) history() []latencySample {
+	if len(e.samples) < latencyHistoryLen {
+		return e.samples
+	}
+	return append(append([]latencySample{}, e.samples[e.next:]...), e.samples[:e.next]...)
+}
+
+// latencyMonitor 按照事件类型统计事件循环中的延迟。所有事件都会计入直方图，
+// 延迟不低于 threshold 毫秒的事件会被记录为一次尖峰，threshold 为 0 时不记录尖峰
+type latencyMonitor struct {
+	threshold int64
+	events    map[string]*latencyEvent
+}
+
+func newLatencyMonitor(threshold int64) *latencyMonitor {
+	return &latencyMonitor{
+		threshold: threshold,
+		events:    make(map[string]*latencyEvent),
+	}
+}
+
+// addSample 记录一次事件的延迟
+func (lm *latencyMonitor) addSample(event string, d time.Duration) {
+
+	e, ok := lm.events[event]
+	if !ok {
+		e = &latencyEvent{}
+		lm.events[event] = e
+	}
+
+	e.calls++
+	bucket := bits.Len64(uint64(d.Microseconds()))
+	if bucket >= latencyBuckets {
+		bucket = latencyBuckets - 1
+	}
+	e.histogram[bucket]++
+
+	if ms := d.Milliseconds(); lm.threshold > 0 && ms >= lm.threshold {
+		e.addSpike(latencySample{timestamp: global.Now().Unix(), latency: ms})
+	}
+}
+
+// history 返回事件最近的延迟尖峰，每一项格式为 [timestamp, latency]
+func (lm *latencyMonitor) history(event string) resp.RedisData {
+	e, ok := lm.events[event]
+	if !ok {
+		return resp.MakeEmptyArrayData()
+	}
+
+	samples := e.history()
+	ret := make([]resp.RedisData, len(samples))
+	for i, sample := range samples {
+		ret[i] = resp.MakeArrayData([]resp.RedisData{
+			resp.MakeIntData(sample.timestamp),
+			resp.MakeIntData(sample.latency),
+		})
+	}
+	return resp.MakeArrayData(ret)
+}
+
+// latest 返回每一种事件最近一次的延迟尖峰，每一项格式为 [event, timestamp, latest, max]
+func (lm *latencyMonitor) latest() resp.RedisData {
+	ret := make([]resp.RedisData, 0, len(lm.events))
+	for _, event := range lm.eventNames() {
+		e := lm.events[event]
+		if len(e.samples) == 0 {
+			continue
+		}
+		last := e.samples[(e.next+latencyHistoryLen-1)%latencyHistoryLen]
+		ret = append(ret, resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte(event)),
+			resp.MakeIntData(last.timestamp),
+			resp.MakeIntData(last.latency),
+			resp.MakeIntData(e.max),
+		}))
+	}
+	return resp.MakeArrayData(ret)
+}
+
+// histogram 返回事件的延迟直方图，events 为空时返回所有事件。每一项格式为
+// [event, [calls, n, histogram_usec, [bucket, count ...]]]，count 为延迟不超过 bucket 微秒的累计事件数
+func (lm *latencyMonitor) histogram(events []string) resp.RedisData {
+	if len(events) == 0 {
+		events = lm.eventNames()
+	}
+
+	ret := make([]resp.RedisData, 0, len(events))
+	for _, event := range events {
+		e, ok := lm.events[event]
+		if !ok {
+			continue
+		}
+		buckets := make([]resp.RedisData, 0)
+		var total int64 = 0
+		for i, count := range e.histogram {
+			if count == 0 {
+				continue
+			}
+			total += count
+			buckets = append(buckets, resp.MakeIntData(int64(1)<<i), resp.MakeIntData(total))
+		}
+		ret = append(ret, resp.MakeBulkData([]byte(event)), resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte("calls")), resp.MakeIntData(e.calls),
+			resp.MakeBulkData([]byte("histogram_usec")), resp.MakeArrayData(buckets),
+		}))
+	}
+	return resp.MakeArrayData(ret)
+}
+
+// reset 清除事件的统计数据，events 为空时清除所有事件，返回被清除的事件数量
+func (lm *latencyMonitor) reset(events []string) int {
+	if len(events) == 0 {
+		n := len(lm.events)
+		lm.events = make(map[string]*latencyEvent)
+		return n
+	}
+
+	n := 0
+	for _, event := range events {
+		if _, ok := lm.events[event]; ok {
+			delete(lm.events, event)
+			n++
+		}
+	}
+	return n
+}
+
+func (lm *latencyMonitor) eventNames() []string {
+	names := make([]string, 0, len(lm.events))
+	for event := range lm.events {
+		names = append(names, event)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// latency 命令格式： latency history event | latency latest | latency histogram [event ...] | latency reset [event ...]
+func latency(server *Server, _ *Client, cmd [][]byte) resp.RedisData {
+	// 进行输入类型检查
+	e, ok := CheckCommandAndLength(cmd, "latency", 2)
+	if !ok {
+		return e
+	}
+
+	events := make([]string, 0, len(cmd)-2)
+	for _, event := range cmd[2:] {
+		events = append(events, string(event))
+	}
+
+	switch strings.ToLower(string(cmd[1])) {
+	case "history":
+		if len(cmd) != 3 {
+			return resp.WrongArgsError("latency history")
+		}
+		return server.latency.history(events[0])
+
+	case "latest":
+		return server.latency.latest()
+
+	case "histogram":
+		return server.latency.histogram(events)
+
+	case "reset":
+		return resp.MakeIntData(int64(server.latency.reset(events)))
+	}
+
+	return resp.MakeErrorData(fmt.Sprintf("ERR unknown subcommand '%s'. Try LATENCY HELP.", cmd[1]))
+}
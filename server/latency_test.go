@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyMonitor(t *testing.T) {
+	lm := newLatencyMonitor(10)
+
+	lm.addSample(latencyEventCommand, time.Millisecond)
+	lm.addSample(latencyEventCommand, 3*time.Microsecond)
+	assert.Equal(t, resp.MakeEmptyArrayData(), lm.history(latencyEventCommand))
+	assert.Equal(t, resp.MakeEmptyArrayData(), lm.history("none"))
+
+	// 低于阈值的事件只计入直方图
+	hist := lm.histogram(nil).(*resp.ArrayData).Data()
+	assert.Equal(t, 2, len(hist))
+	assert.Equal(t, resp.MakeArrayData([]resp.RedisData{
+		resp.MakeBulkData([]byte("calls")), resp.MakeIntData(2),
+		resp.MakeBulkData([]byte("histogram_usec")), resp.MakeArrayData([]resp.RedisData{
+			resp.MakeIntData(4), resp.MakeIntData(1), resp.MakeIntData(1024), resp.MakeIntData(2),
+		}),
+	}), hist[1])
+
+	lm.addSample(latencyEventCommand, 20*time.Millisecond)
+	lm.addSample(latencyEventCommand, 15*time.Millisecond)
+	samples := lm.history(latencyEventCommand).(*resp.ArrayData).Data()
+	assert.Equal(t, 2, len(samples))
+	assert.Equal(t, resp.MakeIntData(20), samples[0].(*resp.ArrayData).Data()[1])
+	assert.Equal(t, resp.MakeIntData(15), samples[1].(*resp.ArrayData).Data()[1])
+
+	latest := lm.latest().(*resp.ArrayData).Data()
+	assert.Equal(t, 1, len(latest))
+	assert.Equal(t, resp.MakeBulkData([]byte("command")), latest[0].(*resp.ArrayData).Data()[0])
+	assert.Equal(t, resp.MakeIntData(15), latest[0].(*resp.ArrayData).Data()[2])
+	assert.Equal(t, resp.MakeIntData(20), latest[0].(*resp.ArrayData).Data()[3])
+
+	// 超过容量后覆盖最旧的记录
+	for i := 0; i < latencyHistoryLen; i++ {
+		lm.addSample(latencyEventCommand, time.Duration(100+i)*time.Millisecond)
+	}
+	samples = lm.history(latencyEventCommand).(*resp.ArrayData).Data()
+	assert.Equal(t, latencyHistoryLen, len(samples))
+	assert.Equal(t, resp.MakeIntData(100), samples[0].(*resp.ArrayData).Data()[1])
+	assert.Equal(t, resp.MakeIntData(100+latencyHistoryLen-1), samples[latencyHistoryLen-1].(*resp.ArrayData).Data()[1])
+
+	lm.addSample(latencyEventExpireCycle, time.Millisecond)
+	assert.Equal(t, 0, lm.reset([]string{"none"}))
+	assert.Equal(t, 1, lm.reset([]string{latencyEventCommand}))
+	assert.Equal(t, resp.MakeEmptyArrayData(), lm.history(latencyEventCommand))
+	assert.Equal(t, 1, lm.reset(nil))
+
+	// 阈值为 0 时不记录尖峰
+	lm = newLatencyMonitor(0)
+	lm.addSample(latencyEventCommand, time.Second)
+	assert.Equal(t, resp.MakeEmptyArrayData(), lm.history(latencyEventCommand))
+}
+
+func TestLatencySlowCommand(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = ""
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	s.uds = path.Join(s.dir, "memtable.sock")
+	s.latency = newLatencyMonitor(1)
+	for i := 0; i < 20000; i++ {
+		s.dbs[0].SetKey("key"+strconv.Itoa(i), structure.Slice("v"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = s.StartContext(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("unix", s.uds); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	// send 发送命令并读取 n 行回复
+	send := func(n int, cmd ...string) []string {
+		_, err := conn.Write(resp.PlainDataToResp(toBytesSlice(cmd...)).ToBytes())
+		assert.Nil(t, err)
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i], err = reader.ReadString('\n')
+			assert.Nil(t, err)
+		}
+		return lines
+	}
+
+	// 遍历大量的键制造一个慢命令
+	assert.Equal(t, []string{"*1\r\n", ":0\r\n"}, send(2, "keys", "^none$"))
+
+	lines := send(4, "latency", "history", "command")
+	assert.Equal(t, []string{"*1\r\n", "*2\r\n"}, lines[:2])
+	ms, err := strconv.Atoi(strings.TrimSpace(lines[3][1:]))
+	assert.Nil(t, err)
+	assert.True(t, ms >= 1)
+
+	assert.Equal(t, []string{":1\r\n"}, send(1, "latency", "reset", "command"))
+	assert.Equal(t, []string{"*0\r\n"}, send(1, "latency", "history", "command"))
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// metricsPrefix 是导出的 Prometheus 指标名称的前缀
+const metricsPrefix = "memtable_"
+
+// listenMetrics 在 metricsAddr 上启动 Prometheus 指标的 HTTP 服务，指标位于 /metrics。服务运行在单独的协程中，
+// 指标通过 Exec 在事件循环中读取，因此不会与命令的执行产生竞争
+func (s *Server) listenMetrics() (net.Listener, error) {
+
+	listener, err := net.Listen("tcp", s.metricsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(s.prometheusMetrics()))
+	})
+
+	s.metrics = &http.Server{Handler: mux}
+	go func() {
+		_ = s.metrics.Serve(listener)
+	}()
+
+	return listener, nil
+}
+
+// prometheusMetrics 将 info 中的数值字段、每一个数据库的键数量以及每一个命令的执行统计转换为 Prometheus 文本格式。
+// stats 部分中累计的字段为 counter，其余字段为 gauge，非数值的字段不会导出
+func (s *Server) prometheusMetrics() string {
+
+	b := strings.Builder{}
+
+	info := string(s.Exec(0, [][]byte{[]byte("info")}).ByteData())
+	section := ""
+	for _, line := range strings.Split(info, "\n") {
+
+		if strings.HasPrefix(line, "# ") {
+			section = strings.ToLower(strings.TrimPrefix(line, "# "))
+			continue
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			continue
+		}
+
+		kind := "gauge"
+		if section == "stats" && !strings.HasPrefix(field, "instantaneous_") {
+			kind = "counter"
+		}
+		b.WriteString(fmt.Sprintf("# TYPE %s%s %s\n", metricsPrefix, field, kind))
+		b.WriteString(fmt.Sprintf("%s%s %s\n", metricsPrefix, field, value))
+	}
+
+	b.WriteString(fmt.Sprintf("# TYPE %sdb_keys gauge\n", metricsPrefix))
+	for i := 0; i < s.dbNum; i++ {
+		size := s.Exec(0, [][]byte{[]byte("dbsize"), []byte(strconv.Itoa(i))}).ByteData()
+		b.WriteString(fmt.Sprintf("%sdb_keys{db=\"%d\"} %s\n", metricsPrefix, i, size))
+	}
+
+	// 每一个命令的统计使用 cmd 标签区分
+	stats := string(s.Exec(0, [][]byte{[]byte("info"), []byte("commandstats")}).ByteData())
+	commands := make(map[string][]string)
+	for _, line := range strings.Split(stats, "\n") {
+		name, fields, ok := strings.Cut(strings.TrimPrefix(line, "cmdstat_"), ":")
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Split(fields, ",") {
+			key, value, _ := strings.Cut(field, "=")
+			if key == "usec_per_call" {
+				continue
+			}
+			commands[key] = append(commands[key], fmt.Sprintf("%scommand_%s_total{cmd=\"%s\"} %s\n", metricsPrefix, key, name, value))
+		}
+	}
+	for _, key := range []string{"calls", "usec", "failed_calls"} {
+		b.WriteString(fmt.Sprintf("# TYPE %scommand_%s_total counter\n", metricsPrefix, key))
+		for _, line := range commands[key] {
+			b.WriteString(line)
+		}
+	}
+
+	return b.String()
+}
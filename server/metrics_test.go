@@ -0,0 +1,59 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	s := newExecServer(t)
+	s.metricsAddr = "127.0.0.1:0"
+
+	listener, err := s.listenMetrics()
+	assert.Nil(t, err)
+
+	execString(s, "set", "a", "1")
+	execString(s, "set", "b", "1")
+	execString(s, "get", "a")
+	execString(s, "get", "none")
+	execString(s, "hget", "a", "f")
+
+	res, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, res.Header.Get("Content-Type"), "text/plain")
+
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	metrics := string(body)
+
+	assert.Contains(t, metrics, "# TYPE memtable_total_commands_processed counter\n")
+	assert.Regexp(t, regexp.MustCompile(`(?m)^memtable_total_commands_processed [1-9]\d*$`), metrics)
+	assert.Contains(t, metrics, "# TYPE memtable_connected_clients gauge\n")
+	assert.Regexp(t, regexp.MustCompile(`(?m)^memtable_used_memory \d+$`), metrics)
+	assert.Contains(t, metrics, "memtable_db_keys{db=\"0\"} 2\n")
+	assert.Contains(t, metrics, "memtable_db_keys{db=\"1\"} 0\n")
+	assert.Contains(t, metrics, "# TYPE memtable_keyspace_hits counter\n")
+	assert.Contains(t, metrics, "memtable_keyspace_hits 2\n")
+	assert.Contains(t, metrics, "memtable_keyspace_misses 1\n")
+
+	// 每一个命令的统计
+	assert.Contains(t, metrics, "# TYPE memtable_command_calls_total counter\n")
+	assert.Contains(t, metrics, "memtable_command_calls_total{cmd=\"set\"} 2\n")
+	assert.Contains(t, metrics, "memtable_command_calls_total{cmd=\"get\"} 2\n")
+	assert.Contains(t, metrics, "memtable_command_failed_calls_total{cmd=\"hget\"} 1\n")
+	assert.Regexp(t, regexp.MustCompile(`(?m)^memtable_command_usec_total\{cmd="get"\} \d+$`), metrics)
+
+	// 非数值的字段不会导出
+	assert.NotContains(t, metrics, "used_memory_human")
+
+	// 其他路径不存在
+	res, err = http.Get("http://" + listener.Addr().String() + "/")
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
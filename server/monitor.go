@@ -27,14 +27,7 @@ func NewMonitor() *Monitor {
 		for msg := range m.commands {
 			for n := m.monitors.FrontNode(); n != nil; n = n.Next() {
 				cli := n.Value.(*Client)
-				content := msg.ToBytes()
-				for wr := 0; wr < len(content); {
-					nn, err := cli.cnn.Write(msg.ToBytes())
-					if err != nil {
-						break
-					}
-					wr += nn
-				}
+				_ = writeFull(cli.cnn, msg.ToBytes())
 			}
 		}
 	}()
@@ -58,12 +51,12 @@ func (m *Monitor) NotifyAll(event *Event) {
 
 		b := strings.Builder{}
 
-		if event.cli.cnn == nil {
-			b.WriteString(fmt.Sprintf("%d [%d %s]", global.Now.Unix(), event.cli.dbSeq, "none"))
+		if event.cli.addr == "" {
+			b.WriteString(fmt.Sprintf("%d [%d %s]", global.Now().Unix(), event.cli.dbSeq, "none"))
 
 		} else {
 
-			b.WriteString(fmt.Sprintf("%d [%d %s]", global.Now.Unix(), event.cli.dbSeq, event.cli.cnn.RemoteAddr().String()))
+			b.WriteString(fmt.Sprintf("%d [%d %s]", global.Now().Unix(), event.cli.dbSeq, event.cli.addr))
 		}
 
 		for _, cmd := range event.cmd {
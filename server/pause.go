@@ -0,0 +1,138 @@
+package server
+
+import (
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pauseState 记录 client pause 的状态。暂停期间被暂停的命令按照到达的顺序保存，暂停结束之后依次执行。
+// 客户端有命令被暂停之后，它之后的命令也会被暂停，保证同一个客户端的命令按顺序执行
+type pauseState struct {
+	end   time.Time            // 暂停的结束时间，零值表示没有暂停
+	all   bool                 // 为 false 时只暂停写命令
+	queue []*Event             // 被暂停的命令
+	held  map[*Client]struct{} // 有命令被暂停的客户端
+}
+
+// active 判断当前是否处于暂停状态
+func (p *pauseState) active() bool {
+	return !p.end.IsZero()
+}
+
+// pause 开始暂停，已经处于暂停状态时使用更晚的结束时间以及更严格的模式
+func (p *pauseState) pause(end time.Time, all bool) {
+	if end.After(p.end) {
+		p.end = end
+	}
+	p.all = p.all || all
+}
+
+// pauses 判断命令是否需要被暂停。WRITE 模式下脚本同样会被暂停，因为脚本可能修改数据，
+// 事务中包含写命令时 exec 也会被暂停；client 命令不会被暂停，从而能够执行 client unpause
+func (p *pauseState) pauses(cli *Client, cmd [][]byte) bool {
+	if len(cmd) == 0 {
+		return false
+	}
+	c, ok := global.FindCommand(strings.ToLower(string(cmd[0])))
+	if !ok || c.Name() == "client" {
+		return false
+	}
+	if c.Name() == "exec" && cli.inTx {
+		for _, queued := range cli.tx {
+			if p.pauses(cli, queued) {
+				return true
+			}
+		}
+	}
+	return p.all || c.IsWriteCommand() || c.Name() == "eval" || c.Name() == "evalsha"
+}
+
+// hold 在暂停期间保存需要被暂停的命令，返回命令是否被暂停。主节点发送的命令不会被暂停
+func (p *pauseState) hold(server *Server, event *Event) bool {
+
+	if !p.active() {
+		return false
+	}
+
+	cli := event.cli
+	if _, held := p.held[cli]; !held && (cli == server.Master || !p.pauses(cli, event.cmd)) {
+		return false
+	}
+
+	if p.held == nil {
+		p.held = make(map[*Client]struct{})
+	}
+	p.held[cli] = struct{}{}
+	p.queue = append(p.queue, event)
+	return true
+}
+
+// resumePaused 在暂停结束之后按照到达的顺序执行被暂停的命令
+func (s *Server) resumePaused() {
+
+	if !s.pause.active() || global.Now().Before(s.pause.end) {
+		return
+	}
+
+	queue := s.pause.queue
+	s.pause = pauseState{}
+
+	for _, event := range queue {
+		cli := event.cli
+		// 暂停期间关闭的客户端不再执行
+		if cli.getStatus() == ERROR || cli.getStatus() == EXIT || cli.quit {
+			ePool.putEvent(event)
+			continue
+		}
+		// 恢复执行的命令中可能再次执行了 client pause
+		if s.pause.hold(s, event) {
+			continue
+		}
+		s.processEvent(event)
+	}
+}
+
+// clientPause 命令格式： client pause timeout [WRITE|ALL]，timeout 的单位为毫秒，默认暂停全部的命令
+func clientPause(server *Server, cmd [][]byte) resp.RedisData {
+
+	if len(cmd) != 3 && len(cmd) != 4 {
+		return resp.WrongArgsError("client|pause")
+	}
+
+	timeout, err := strconv.ParseInt(string(cmd[2]), 10, 64)
+	if err != nil {
+		return resp.MakeErrorData("ERR timeout is not an integer or out of range")
+	}
+	if timeout < 0 {
+		return resp.MakeErrorData("ERR timeout is negative")
+	}
+
+	all := true
+	if len(cmd) == 4 {
+		switch strings.ToLower(string(cmd[3])) {
+		case "all":
+		case "write":
+			all = false
+		default:
+			return resp.SyntaxError()
+		}
+	}
+
+	server.pause.pause(global.Now().Add(time.Duration(timeout)*time.Millisecond), all)
+	return resp.MakeStringData("OK")
+}
+
+// clientUnpause 命令格式： client unpause，立即结束暂停，被暂停的命令在当前命令执行完毕后恢复执行
+func clientUnpause(server *Server, cmd [][]byte) resp.RedisData {
+
+	if len(cmd) != 2 {
+		return resp.WrongArgsError("client|unpause")
+	}
+	if server.pause.active() {
+		server.pause.end = global.Now()
+	}
+	return resp.MakeStringData("OK")
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"testing"
+	"time"
+)
+
+func TestClientPause(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+
+	// send 模拟事件循环处理一条命令
+	send := func(cli *Client, cmd ...string) {
+		cli.cmd = toBytesSlice(cmd...)
+		if event := ePool.newEvent(cli); !s.pause.hold(s, event) {
+			s.processEvent(event)
+		}
+	}
+	// replies 返回客户端已经收到的回包
+	replies := func(cli *Client) []resp.RedisData {
+		res := make([]resp.RedisData, 0)
+		for {
+			select {
+			case r := <-cli.res:
+				res = append(res, *r)
+			default:
+				return res
+			}
+		}
+	}
+
+	admin := NewFakeClient()
+	writer := NewFakeClient()
+	reader := NewFakeClient()
+
+	assert.Equal(t, resp.MakeErrorData("ERR timeout is negative"), execCmd(s, admin, "client", "pause", "-1"))
+	assert.Equal(t, resp.MakeErrorData("ERR syntax error"), execCmd(s, admin, "client", "pause", "10", "read"))
+
+	// WRITE 模式下只暂停写命令，同一个客户端之后的命令也会被暂停
+	global.UpdateGlobalClock()
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, admin, "client", "pause", "50", "write"))
+	send(writer, "set", "k", "1")
+	send(writer, "get", "k")
+	send(writer, "incr", "k")
+	send(reader, "get", "k")
+	assert.Empty(t, replies(writer))
+	assert.Equal(t, []resp.RedisData{resp.MakeStringData("nil")}, replies(reader))
+
+	// 暂停结束之前不会执行
+	s.resumePaused()
+	assert.Empty(t, replies(writer))
+
+	// 暂停结束之后按照顺序执行
+	time.Sleep(60 * time.Millisecond)
+	global.UpdateGlobalClock()
+	s.resumePaused()
+	assert.Equal(t, []resp.RedisData{
+		resp.MakeStringData("OK"), resp.MakeBulkData([]byte("1")), resp.MakeIntData(2),
+	}, replies(writer))
+	assert.False(t, s.pause.active())
+
+	// ALL 模式下暂停全部的命令，client unpause 可以提前结束暂停
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, admin, "client", "pause", "100000"))
+	send(reader, "get", "k")
+	send(writer, "set", "k", "3")
+	send(admin, "client", "unpause")
+	assert.Equal(t, []resp.RedisData{resp.MakeStringData("OK")}, replies(admin))
+	assert.Empty(t, replies(reader))
+
+	s.resumePaused()
+	assert.Equal(t, []resp.RedisData{resp.MakeBulkData([]byte("2"))}, replies(reader))
+	assert.Equal(t, []resp.RedisData{resp.MakeStringData("OK")}, replies(writer))
+	assert.Equal(t, resp.MakeBulkData([]byte("3")), execCmd(s, reader, "get", "k"))
+
+	// WRITE 模式下包含写命令的事务会在 exec 时被暂停，只读事务不会被暂停
+	send(writer, "multi")
+	send(writer, "set", "k", "4")
+	send(reader, "multi")
+	send(reader, "get", "k")
+	replies(writer)
+	replies(reader)
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, admin, "client", "pause", "100000", "write"))
+	send(writer, "exec")
+	send(reader, "exec")
+	assert.Empty(t, replies(writer))
+	assert.Equal(t, []resp.RedisData{resp.MakeArrayData([]resp.RedisData{resp.MakeBulkData([]byte("3"))})}, replies(reader))
+	assert.Equal(t, resp.MakeBulkData([]byte("3")), execCmd(s, reader, "get", "k"))
+
+	send(admin, "client", "unpause")
+	replies(admin)
+	s.resumePaused()
+	assert.Equal(t, []resp.RedisData{resp.MakeArrayData([]resp.RedisData{resp.MakeStringData("OK")})}, replies(writer))
+	assert.Equal(t, resp.MakeBulkData([]byte("4")), execCmd(s, reader, "get", "k"))
+}
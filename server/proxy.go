@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyHeaderMaxLen 是 PROXY 协议 v1 头部的最大长度，包括末尾的 \r\n
+const proxyHeaderMaxLen = 107
+
+// proxyHeaderTimeout 是等待 PROXY 协议头部的最长时间
+const proxyHeaderTimeout = 5 * time.Second
+
+var errProxyHeader = errors.New("invalid PROXY protocol header")
+
+// readProxyHeader 从连接中读取 PROXY 协议 v1 头部，返回真实的客户端地址。
+// 头部以外的数据不会被读取，因此后续可以直接交给 resp 解析器处理。
+// 如果代理使用 UNKNOWN 协议，返回连接自身的地址
+func readProxyHeader(conn net.Conn) (string, error) {
+
+	_ = conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+
+	buf := make([]byte, 0, proxyHeaderMaxLen)
+	b := make([]byte, 1)
+
+	// 逐字节读取，防止读取到头部之后的命令
+	for len(buf) < 2 || buf[len(buf)-2] != '\r' || buf[len(buf)-1] != '\n' {
+		if len(buf) >= proxyHeaderMaxLen {
+			return "", errProxyHeader
+		}
+		if _, err := conn.Read(b); err != nil {
+			return "", err
+		}
+		buf = append(buf, b[0])
+	}
+
+	return parseProxyHeader(string(buf[:len(buf)-2]), conn.RemoteAddr().String())
+}
+
+// parseProxyHeader 解析不包含 \r\n 的 PROXY 协议 v1 头部，格式为：
+// PROXY TCP4|TCP6 srcIP dstIP srcPort dstPort 或者 PROXY UNKNOWN
+func parseProxyHeader(header, fallback string) (string, error) {
+
+	fields := strings.Split(header, " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return "", errProxyHeader
+	}
+
+	if fields[1] == "UNKNOWN" {
+		return fallback, nil
+	}
+
+	if (fields[1] != "TCP4" && fields[1] != "TCP6") || len(fields) != 6 {
+		return "", errProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil || net.ParseIP(fields[3]) == nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return "", errProxyHeader
+	}
+
+	for _, port := range fields[4:] {
+		if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+			return "", errProxyHeader
+		}
+	}
+
+	return net.JoinHostPort(fields[2], fields[4]), nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProxyHeader(t *testing.T) {
+
+	tests := []struct {
+		header   string
+		expected string
+		ok       bool
+	}{
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443", "192.168.0.1:56324", true},
+		{"PROXY TCP6 ::1 ::1 56324 443", "[::1]:56324", true},
+		{"PROXY UNKNOWN", "10.0.0.1:1000", true},
+		{"PROXY UNKNOWN ffff::1 ffff::1 1 2", "10.0.0.1:1000", true},
+		{"PROXY TCP4 ::1 ::1 56324 443", "", false},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324", "", false},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 port 443", "", false},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 70000 443", "", false},
+		{"PROXY UDP4 192.168.0.1 192.168.0.11 56324 443", "", false},
+		{"*1", "", false},
+	}
+
+	for _, test := range tests {
+		addr, err := parseProxyHeader(test.header, "10.0.0.1:1000")
+		assert.Equal(t, test.ok, err == nil, test.header)
+		assert.Equal(t, test.expected, addr, test.header)
+	}
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n*1\r\n$4\r\nping\r\n"))
+		_ = client.Close()
+	}()
+
+	addr, err := readProxyHeader(server)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.168.0.1:56324", addr)
+
+	// 头部之后的数据不会被读取
+	rest, _ := io.ReadAll(server)
+	assert.Equal(t, "*1\r\n$4\r\nping\r\n", string(rest))
+
+	// 超过最大长度的头部
+	server, client = net.Pipe()
+	go func() {
+		_, _ = client.Write([]byte("PROXY " + strings.Repeat("a", 200)))
+		_ = client.Close()
+	}()
+	_, err = readProxyHeader(server)
+	assert.Equal(t, errProxyHeader, err)
+}
+
+func TestServerProxyProtocol(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = ""
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	s.uds = path.Join(s.dir, "memtable.sock")
+	s.proxyProtocol = true
+
+	go s.eventLoop()
+	assert.Nil(t, s.listen())
+
+	dial := func(header string) (net.Conn, *bufio.Reader) {
+		conn, err := net.DialTimeout("unix", s.uds, time.Second)
+		assert.Nil(t, err)
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		_, err = conn.Write([]byte(header))
+		assert.Nil(t, err)
+		return conn, bufio.NewReader(conn)
+	}
+
+	c1, r1 := dial("PROXY TCP4 192.168.0.1 192.168.0.11 56324 6380\r\n*1\r\n$4\r\nping\r\n")
+	defer c1.Close()
+	line, err := r1.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+pong\r\n", line)
+
+	// client list 中显示真实的客户端地址
+	c2, r2 := dial("PROXY TCP4 192.168.0.2 192.168.0.11 40000 6380\r\n*2\r\n$6\r\nclient\r\n$4\r\nlist\r\n")
+	defer c2.Close()
+	line, err = r2.ReadString('\n')
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(line, "$"))
+	list := make([]byte, 0)
+	for len(list) == 0 || !strings.HasSuffix(string(list), "\n\r\n") {
+		b, err := r2.ReadByte()
+		assert.Nil(t, err)
+		list = append(list, b)
+	}
+	assert.Contains(t, string(list), "addr=192.168.0.1:56324 ")
+	assert.Contains(t, string(list), "addr=192.168.0.2:40000 ")
+
+	// 使用真实地址匹配客户端
+	_, err = c2.Write([]byte("*3\r\n$6\r\nclient\r\n$4\r\nkill\r\n$17\r\n192.168.0.1:56324\r\n"))
+	assert.Nil(t, err)
+	line, err = r2.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+OK\r\n", line)
+	_, err = r1.ReadString('\n')
+	assert.NotNil(t, err)
+
+	// 没有 PROXY 头部的连接会被关闭
+	c3, r3 := dial("*1\r\n$4\r\nping\r\n")
+	defer c3.Close()
+	_, err = r3.ReadString('\n')
+	assert.NotNil(t, err)
+
+	s.quit.Store(true)
+	<-s.quitFlag
+}
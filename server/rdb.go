@@ -2,13 +2,17 @@ package server
 
 import (
 	"github.com/hdt3213/rdb/encoder"
+	"github.com/hdt3213/rdb/model"
+	"github.com/hdt3213/rdb/parser"
+	"github.com/tangrc99/MemTable/db"
 	"github.com/tangrc99/MemTable/logger"
-	"io"
 	"os"
 	"os/exec"
 	"path"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -20,8 +24,16 @@ type RDBStatus struct {
 	rdbLock       sync.Mutex // 禁止 rdb 重入锁
 	rdbFileStatus int
 	rdbWaitNum    int
+
+	// 以下字段会在后台协程中修改，用于 info persistence
+	bgsaveInProgress atomic.Bool  // 是否正在执行 bgsave
+	lastSave         atomic.Int64 // 最近一次成功保存的 unix 时间戳
+	lastBgsaveFailed atomic.Bool  // 最近一次 bgsave 是否失败
 }
 
+// rdbWriter 用于写入 rdb 文件，测试时可以替换
+var rdbWriter = writeRDB
+
 func (s *Server) RDB(file string) bool {
 
 	if !s.rdbLock.TryLock() {
@@ -31,6 +43,85 @@ func (s *Server) RDB(file string) bool {
 
 	defer s.rdbLock.Unlock()
 
+	snapshots := s.snapshotDataBases()
+	defer releaseSnapshots(snapshots)
+
+	if !rdbWriter(file, s.rdbAux(), snapshots) {
+		return false
+	}
+	s.dirty.Store(0)
+	s.lastSave.Store(time.Now().Unix())
+	return true
+}
+
+// BGRDB 在当前协程中为每一个数据库创建快照，然后在后台协程中将快照写入 rdb 文件。
+// 快照采用写时复制的方式，后台写入期间不会阻塞其他命令的执行
+func (s *Server) BGRDB() bool {
+
+	if !s.rdbLock.TryLock() {
+		logger.Warning("BGRDB: Try Do RDB When Another RDB Process Executing")
+		return false
+	}
+
+	snapshots := s.snapshotDataBases()
+	aux := s.rdbAux()
+	file := path.Join(s.dir, s.rdbFile)
+
+	// 快照中已经包含了当前的全部修改，写入成功后才能减去，写入期间的修改会保留
+	dirty := s.dirty.Load()
+	s.bgsaveInProgress.Store(true)
+
+	go func() {
+
+		defer s.rdbLock.Unlock()
+		defer releaseSnapshots(snapshots)
+
+		ok := rdbWriter(file, aux, snapshots)
+
+		logger.Info("BGSave Finished")
+
+		if !ok {
+			logger.Error("BGSave Failed")
+		} else {
+			s.dirty.Add(-dirty)
+			s.lastSave.Store(time.Now().Unix())
+		}
+		s.lastBgsaveFailed.Store(!ok)
+		s.bgsaveInProgress.Store(false)
+	}()
+	return true
+}
+
+// rdbAux 返回 rdb 文件中需要写入的辅助字段
+func (s *Server) rdbAux() map[string]string {
+	logger.Info("rdb runid", s.runID)
+	return map[string]string{
+		"redis-ver":    "4.0.6",
+		"redis-bits":   "64",
+		"aof-preamble": "0",
+		"repl-id":      s.runID,
+		"repl-offset":  strconv.FormatUint(s.offset, 10),
+	}
+}
+
+// snapshotDataBases 为每一个数据库创建快照，使用完毕后需要调用 releaseSnapshots 释放
+func (s *Server) snapshotDataBases() []*db.Snapshot {
+	snapshots := make([]*db.Snapshot, len(s.dbs))
+	for i, database := range s.dbs {
+		snapshots[i] = database.Snapshot()
+	}
+	return snapshots
+}
+
+func releaseSnapshots(snapshots []*db.Snapshot) {
+	for _, snapshot := range snapshots {
+		snapshot.Release()
+	}
+}
+
+// writeRDB 将快照中的数据写入到 file 中，写入时先使用临时文件，完成后再进行替换
+func writeRDB(file string, aux map[string]string, snapshots []*db.Snapshot) bool {
+
 	rdbFile, err := os.Create(file + ".tmp")
 
 	if err != nil {
@@ -45,16 +136,8 @@ func (s *Server) RDB(file string) bool {
 		logger.Error("RDB: Write RDB Header Failed", err.Error())
 		return false
 	}
-	auxMap := map[string]string{
-		"redis-ver":    "4.0.6",
-		"redis-bits":   "64",
-		"aof-preamble": "0",
-		"repl-id":      s.runID,
-		"repl-offset":  strconv.FormatUint(s.offset, 10),
-	}
-	logger.Info("rdb runid", s.runID)
 
-	for k, v := range auxMap {
+	for k, v := range aux {
 		err = enc.WriteAux(k, v)
 		if err != nil {
 			logger.Error("RDB: Write RDB Aux Failed", err.Error())
@@ -62,18 +145,22 @@ func (s *Server) RDB(file string) bool {
 		}
 	}
 
-	for index, db := range s.dbs {
+	// 辅助字段需要在所有数据库之前写入
+	for index, snapshot := range snapshots {
+		err = snapshot.EncodeAux(enc, index)
+		if err != nil {
+			logger.Error("RDB: Write RDB Aux Failed", err.Error())
+			return false
+		}
+	}
+
+	for index, snapshot := range snapshots {
 
-		if db.Size() == 0 {
+		if snapshot.Size() == 0 {
 			continue
 		}
 
-		err = enc.WriteDBHeader(uint(index), uint64(db.Size()), uint64(db.TTLSize()))
-		if err != nil {
-			logger.Error("RDB: Write RDB DB Header Failed", err.Error())
-			return false
-		}
-		err = db.Encode(enc)
+		err = snapshot.Encode(enc, index)
 		if err != nil {
 			logger.Error("RDB: Write RDB DB Content Failed", err.Error())
 			return false
@@ -91,58 +178,34 @@ func (s *Server) RDB(file string) bool {
 	return true
 }
 
-// BGRDB 必须借助于 AOF 才能够实现，具体过程是复制一份 aof，然后开启一个 fake server 进行持久化
-func (s *Server) BGRDB() bool {
+// loadRDB 在当前协程中读取 rdb 文件，并将其中的键值对写入到对应的数据库中
+func (s *Server) loadRDB(file string) error {
 
-	if !s.aofEnabled {
-		logger.Error("Can't start bgsave if aof is not enabled")
-		return false
-	}
-
-	// 复制 aof
-	file1, err := os.Open(path.Join(s.dir, s.aofFile))
-	if err != nil {
-		logger.Error("AOF Rewrite: Can't Load AOF File")
-		return false
-	}
-	file2, err := os.OpenFile(path.Join(s.dir, s.aofFile+".tmp"), os.O_WRONLY|os.O_CREATE, os.ModePerm)
+	rdbFile, err := os.Open(file)
 	if err != nil {
-		logger.Error("AOF Rewrite: Can't Create Temporary AOF File")
-		return false
+		return err
 	}
+	defer rdbFile.Close()
 
-	defer file1.Close()
-	defer file2.Close()
-
-	_, err = io.Copy(file2, file1)
-	if err != nil {
-		logger.Error("AOF Rewrite: AOF Copy Error")
-		return false
-	}
-
-	// aof 启动一个 server
-	ws := NewServer()
-	ws.runID = s.runID
-	ws.offset = s.offset
-	ws.rdbOffset = s.rdbOffset
-
-	go func() {
-
-		ws.recoverFromAOF(path.Join(s.dir, s.aofFile+".tmp"))
-		// server 进行恢复后，保存 rdb
-		ok := ws.RDB(path.Join(s.dir, s.rdbFile))
-
-		logger.Info("BGSave Finished")
-
-		if !ok {
-			logger.Error("BGSave Failed")
+	return parser.NewDecoder(rdbFile).WithSpecialOpCode().Parse(func(o model.RedisObject) bool {
+		switch o := o.(type) {
+		case *model.AuxObject:
+			if err := db.DecodeAux(s.dbs, o); err != nil {
+				logger.Warning("RDB: Decode Aux Field", o.GetKey(), "Failed", err.Error())
+			}
+			return true
+		case *model.DBSizeObject:
+			return true
 		}
-
-		// 清理文件
-		_ = os.Remove(s.aofFile + ".tmp")
-
-	}()
-	return true
+		if o.GetDBIndex() >= len(s.dbs) {
+			logger.Warning("RDB: DB Index Out Of Range", o.GetDBIndex())
+			return true
+		}
+		if !s.dbs[o.GetDBIndex()].Decode(o) {
+			logger.Warning("RDB: Unsupported Object Type", o.GetType(), "Of Key", o.GetKey())
+		}
+		return true
+	})
 }
 
 func (s *Server) waitForRDBFinished() {
@@ -151,8 +214,16 @@ func (s *Server) waitForRDBFinished() {
 
 }
 
+// recoverFromRDB 从 rdb 文件中恢复数据。开启 aof 时需要借助 rdb 工具将其转换为 aof 文件，之后的写命令才能追加到完整的 aof 文件中
 func (s *Server) recoverFromRDB(aofFile, rdbFile string) {
 
+	if !s.aofEnabled {
+		if err := s.loadRDB(rdbFile); err != nil {
+			logger.Error("Load RDB:", err.Error())
+		}
+		return
+	}
+
 	arg := []string{"-c", "protocol", "-f", aofFile, rdbFile}
 	cmd := exec.Command("rdb", arg...)
 	output, err := cmd.CombinedOutput()
@@ -167,9 +238,4 @@ func (s *Server) recoverFromRDB(aofFile, rdbFile string) {
 	}
 
 	s.recoverFromAOF(aofFile)
-
-	if !s.aofEnabled {
-		// 删除 aof 文件
-		_ = os.Remove(aofFile)
-	}
 }
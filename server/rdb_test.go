@@ -0,0 +1,108 @@
+package server
+
+import (
+	"github.com/hdt3213/rdb/model"
+	"github.com/hdt3213/rdb/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/logger"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func TestBGRDBSnapshot(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+
+	for i := 0; i < 100; i++ {
+		s.dbs[0].SetKey("k"+strconv.Itoa(i), structure.Slice("v"+strconv.Itoa(i)))
+	}
+	s.dbs[1].SetKey("other", structure.Slice("v"))
+
+	assert.True(t, s.BGRDB())
+
+	// 后台写入期间修改数据不会影响 rdb 文件的内容
+	for i := 0; i < 100; i++ {
+		s.dbs[0].Update(func() {
+			s.dbs[0].SetKey("k"+strconv.Itoa(i), structure.Slice("changed"))
+		})
+	}
+	s.dbs[0].Update(func() {
+		s.dbs[0].SetKey("new", structure.Slice("v"))
+	})
+	s.dbs[1].Update(func() {
+		s.dbs[1].DeleteKey("other")
+	})
+
+	s.waitForRDBFinished()
+
+	file, err := os.Open(path.Join(s.dir, s.rdbFile))
+	assert.Nil(t, err)
+	defer file.Close()
+
+	values := make(map[int]map[string]string)
+	err = parser.NewDecoder(file).Parse(func(o model.RedisObject) bool {
+		if values[o.GetDBIndex()] == nil {
+			values[o.GetDBIndex()] = make(map[string]string)
+		}
+		values[o.GetDBIndex()][o.GetKey()] = string(o.(*model.StringObject).Value)
+		return true
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 100, len(values[0]))
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "v"+strconv.Itoa(i), values[0]["k"+strconv.Itoa(i)])
+	}
+	assert.Equal(t, map[string]string{"other": "v"}, values[1])
+}
+
+func TestRDBStream(t *testing.T) {
+	s := newExecServer(t)
+	s.dir = t.TempDir()
+
+	execString(s, "xadd", "stream", "1-1", "f1", "v1")
+	execString(s, "xadd", "stream", "2-1", "f2", "v2", "f3", "v3")
+	execString(s, "xgroup", "create", "stream", "group", "0")
+	execString(s, "xgroup", "create", "stream", "empty", "$")
+	s.Exec(0, [][]byte{[]byte("xreadgroup"), []byte("group"), []byte("group"), []byte("consumer"),
+		[]byte("count"), []byte("1"), []byte("streams"), []byte("stream"), []byte(">")})
+	execString(s, "expire", "stream", "1000")
+	s.dbs[1].Update(func() {
+		stream := structure.NewStream()
+		stream.Append(structure.StreamID{Ms: 3}, [][]byte{[]byte("f"), []byte("v")})
+		s.dbs[1].SetKey("other", stream)
+	})
+
+	digest := execString(s, "debug", "digest")
+
+	file := path.Join(s.dir, "stream.rdb")
+	assert.True(t, s.RDB(file))
+
+	loaded := NewServer()
+	assert.Nil(t, loaded.loadRDB(file))
+	assert.Equal(t, digest, db.DigestAll(loaded.dbs).String())
+
+	assert.True(t, loaded.dbs[0].GetTTL("stream") > 0)
+
+	v, _ := loaded.dbs[0].GetKey("stream")
+	stream := v.(*structure.Stream)
+	assert.Equal(t, 2, stream.Size())
+	g, ok := stream.Group("group")
+	assert.True(t, ok)
+	assert.Equal(t, structure.StreamID{Ms: 1, Seq: 1}, g.LastDelivered())
+	assert.Equal(t, 1, g.PendingSize())
+	assert.Equal(t, 1, len(g.Consumer("consumer").Pending(structure.MinStreamID, 0)))
+	_, ok = stream.Group("empty")
+	assert.True(t, ok)
+
+	// 损坏的数据无法解析
+	_, err := structure.UnmarshalStream(stream.Marshal()[:5])
+	assert.NotNil(t, err)
+}
@@ -3,10 +3,13 @@ package server
 import (
 	"fmt"
 	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
 	"github.com/tangrc99/MemTable/utils/rand_str"
 	"github.com/tangrc99/MemTable/utils/ring_buffer"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -42,7 +45,8 @@ func (s *ReplicaStatus) updateReplicaStatus(event *Event) {
 	switch s.role {
 
 	case StandAlone:
-		return
+		// 没有 backlog 时也记录传播的命令长度，供之后的部分同步使用
+		s.offset += uint64(len(event.raw))
 
 	case Master:
 
@@ -109,9 +113,15 @@ func (s *ReplicaStatus) changeSlaveOnline(cli *Client, slaveOffset uint64) {
 	cli.blocked = false
 }
 
+// changeReplicationID 生成新的 replication id，之后使用旧 id 的部分同步请求都会失败
+func (s *ReplicaStatus) changeReplicationID() {
+	s.runID = rand_str.RandHexString(40)
+}
+
+// standAloneToMaster 在第一个从节点连接时初始化 backlog，复制历史从新的 replication id 以及 offset 0 开始
 func (s *ReplicaStatus) standAloneToMaster() {
 	s.role = Master
-	s.runID = rand_str.RandHexString(40)
+	s.changeReplicationID()
 	s.backLog.Init(global.RsBackLogCap)
 	s.capacity = global.RsBackLogCap
 	s.rdbOffset = 0
@@ -172,7 +182,7 @@ func (s *ReplicaStatus) sendBackLog() {
 
 		}
 		// 成功写入会更新时间戳
-		cli.UpdateTimestamp(global.Now)
+		cli.UpdateTimestamp(global.Now())
 	}
 
 }
@@ -278,6 +288,211 @@ func (s *Server) StopEvictionNotification() {
 	}
 }
 
+// propagateDel 将键的删除以 del 命令的形式写入 aof 以及 backlog 中，用于键过期以及内存淘汰
+func (s *Server) propagateDel(dbSeq int, key string) {
+
+	// 从服务器中键驱逐以及键过期是被动的，这样才能够保证数据的一致性
+	dbStr := strconv.Itoa(dbSeq)
+	oplog := fmt.Sprintf("*2\r\n$6\r\nselect\r\n$%d\r\n%s\r\n*2\r\n$3\r\ndel\r\n$%d\r\n%s\r\n", len(dbStr), dbStr, len(key), key)
+	s.appendBackLogRaw([]byte(oplog))
+
+	// AOF 文件的过期同样也是使用这种方式来完成的
+	if s.aof != nil {
+		s.aof.append([]byte(oplog))
+	}
+}
+
+// propagateHDel 将 hash 中过期的 field 以 hdel 命令的形式写入 aof 以及 backlog 中
+func (s *Server) propagateHDel(dbSeq int, key string, fields []string) {
+
+	dbStr := strconv.Itoa(dbSeq)
+	hdel := [][]byte{[]byte("hdel"), []byte(key)}
+	for _, field := range fields {
+		hdel = append(hdel, []byte(field))
+	}
+	oplog := append(resp.PlainDataToResp([][]byte{[]byte("select"), []byte(dbStr)}).ToBytes(), resp.PlainDataToResp(hdel).ToBytes()...)
+	s.appendBackLogRaw(oplog)
+
+	if s.aof != nil {
+		s.aof.append(oplog)
+	}
+}
+
+// propagationRewriters 记录执行结果不确定的写命令，这些命令需要改写为确定的命令后再写入 aof 以及 backlog，
+// 否则 aof 恢复以及从节点执行时会得到不同的结果。now 是命令执行时的时间
+var propagationRewriters = map[string]func(cmd [][]byte, res resp.RedisData, now time.Time) [][]byte{
+	"spop":    rewriteSPop,
+	"migrate": rewriteMigrate,
+	"xadd":    rewriteXAdd,
+	"hexpire": rewriteHExpire,
+	"expire":  rewriteExpire,
+	"pexpire": rewriteExpire,
+	"restore": rewriteRestore,
+	"set":     rewriteSet,
+}
+
+// rewriteForPropagation 返回写命令用于传播的 RESP 格式数据，不需要改写时返回 raw，返回空值代表不需要传播
+func rewriteForPropagation(cmd [][]byte, res resp.RedisData, raw []byte, now time.Time) []byte {
+
+	name := strings.ToLower(string(cmd[0]))
+	if c, exist := global.FindCommand(name); exist {
+		name = c.Name()
+	}
+
+	rewriter, ok := propagationRewriters[name]
+	if !ok || (name == "set" && !hasRelativeExpire(cmd)) {
+		return raw
+	}
+
+	rewritten := rewriter(cmd, res, now)
+	if rewritten == nil {
+		return nil
+	}
+	return resp.PlainDataToResp(rewritten).ToBytes()
+}
+
+// rewriteMigrate 将迁移成功并且删除了本地键的 migrate 改写为 del 命令，其余情况不需要传播
+func rewriteMigrate(cmd [][]byte, res resp.RedisData, _ time.Time) [][]byte {
+
+	if r, ok := res.(*resp.StringData); !ok || r.Data() != "OK" {
+		return nil
+	}
+	for _, arg := range cmd[6:] {
+		if strings.ToLower(string(arg)) == "copy" {
+			return nil
+		}
+	}
+	return [][]byte{[]byte("del"), cmd[3]}
+}
+
+// rewriteXAdd 将 xadd 中由服务器生成的 id 替换为实际写入的 id
+func rewriteXAdd(cmd [][]byte, res resp.RedisData, _ time.Time) [][]byte {
+
+	r, ok := res.(*resp.BulkData)
+	if !ok {
+		return nil
+	}
+
+	rewritten := make([][]byte, len(cmd))
+	copy(rewritten, cmd)
+	rewritten[2] = r.Data()
+	return rewritten
+}
+
+// rewriteExpire 将 expire 以及 pexpire 改写为使用绝对时间的 pexpireat 命令，ttl 的精度为秒，
+// 因此绝对时间按照命令执行时计算出的秒级时间戳传播。没有修改过期时间时不需要传播
+func rewriteExpire(cmd [][]byte, res resp.RedisData, now time.Time) [][]byte {
+
+	if r, ok := res.(*resp.IntData); !ok || r.Data() != 1 {
+		return nil
+	}
+
+	when, err := strconv.ParseInt(string(cmd[2]), 10, 64)
+	if err != nil {
+		return nil
+	}
+	if strings.ToLower(string(cmd[0])) == "pexpire" {
+		when /= 1000
+	}
+
+	rewritten := make([][]byte, len(cmd))
+	copy(rewritten, cmd)
+	rewritten[0] = []byte("pexpireat")
+	rewritten[2] = []byte(strconv.FormatInt((now.Unix()+when)*1000, 10))
+	return rewritten
+}
+
+// hasRelativeExpire 判断 set 命令是否使用了相对时间的 EX 或者 PX 选项
+func hasRelativeExpire(cmd [][]byte) bool {
+	for i := 3; i < len(cmd); i++ {
+		if option := strings.ToLower(string(cmd[i])); option == "ex" || option == "px" {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteSet 将 set 中使用相对时间的 EX 以及 PX 选项改写为使用绝对时间的 PXAT 选项，计算方式与 set 相同
+func rewriteSet(cmd [][]byte, _ resp.RedisData, now time.Time) [][]byte {
+
+	rewritten := make([][]byte, len(cmd))
+	copy(rewritten, cmd)
+
+	for i := 3; i+1 < len(cmd); i++ {
+		option := strings.ToLower(string(cmd[i]))
+		if option != "ex" && option != "px" {
+			continue
+		}
+		n, err := strconv.ParseInt(string(cmd[i+1]), 10, 64)
+		if err != nil {
+			return cmd
+		}
+		if option == "px" {
+			n = (n + 999) / 1000
+		}
+		rewritten[i] = []byte("pxat")
+		rewritten[i+1] = []byte(strconv.FormatInt((now.Unix()+n)*1000, 10))
+		i++
+	}
+	return rewritten
+}
+
+// rewriteRestore 将使用相对 ttl 的 restore 改写为使用绝对时间的 restore ... ABSTTL 命令
+func rewriteRestore(cmd [][]byte, _ resp.RedisData, now time.Time) [][]byte {
+
+	ttl, err := strconv.ParseInt(string(cmd[2]), 10, 64)
+	if err != nil || ttl == 0 {
+		return cmd
+	}
+	for _, arg := range cmd[4:] {
+		if strings.ToLower(string(arg)) == "absttl" {
+			return cmd
+		}
+	}
+
+	// 与 restore 相同，不足一秒的部分向上取整
+	rewritten := make([][]byte, len(cmd), len(cmd)+1)
+	copy(rewritten, cmd)
+	rewritten[2] = []byte(strconv.FormatInt((now.Unix()+(ttl+999)/1000)*1000, 10))
+	return append(rewritten, []byte("ABSTTL"))
+}
+
+// rewriteHExpire 将 hexpire 改写为使用绝对时间的 hexpireat 命令，保证从节点以及 aof 恢复时的过期时间不变
+func rewriteHExpire(cmd [][]byte, res resp.RedisData, now time.Time) [][]byte {
+
+	seconds, err := strconv.ParseInt(string(cmd[2]), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	rewritten := make([][]byte, len(cmd))
+	copy(rewritten, cmd)
+	rewritten[0] = []byte("hexpireat")
+	rewritten[2] = []byte(strconv.FormatInt(now.Unix()+seconds, 10))
+	return rewritten
+}
+
+// rewriteSPop 将 spop 改写为删除实际弹出成员的 srem 命令
+func rewriteSPop(cmd [][]byte, res resp.RedisData, _ time.Time) [][]byte {
+
+	rewritten := [][]byte{[]byte("srem"), cmd[1]}
+
+	switch r := res.(type) {
+	case *resp.BulkData:
+		rewritten = append(rewritten, r.Data())
+	case *resp.ArrayData:
+		for _, member := range r.Data() {
+			rewritten = append(rewritten, member.(*resp.BulkData).Data())
+		}
+	}
+
+	// 没有弹出成员时不需要传播
+	if len(rewritten) == 2 {
+		return nil
+	}
+	return rewritten
+}
+
 // handleEvictionNotification 会读取数据库中过期或逐出事件，并写入 aof 以及 backlog 中
 func (s *Server) handleEvictionNotification() {
 
@@ -287,17 +502,20 @@ func (s *Server) handleEvictionNotification() {
 			select {
 			case key := <-e:
 
-				// 从服务器中键驱逐以及键过期是被动的，这样才能够保证数据的一致性
-				dbStr := strconv.Itoa(i)
-				oplog := fmt.Sprintf("*2\r\n$6\r\nselect\r\n$%d\r\n%s\r\n*2\r\n$3\r\ndel\r\n$%d\r\n%s\r\n", len(dbStr), dbStr, len(key), key)
-				s.appendBackLogRaw([]byte(oplog))
+				s.propagateDel(i, key)
 
-				// AOF 文件的过期同样也是使用这种方式来完成的
-				s.aof.append([]byte(oplog))
+				// 过期以及逐出的键同样需要通知 client tracking 的客户端
+				if len(s.tracking.clients) > 0 {
+					s.tracking.invalidate(s, []string{key})
+				}
 
 			default:
 				finished = true
 			}
 		}
+
+		for _, expired := range s.dbs[i].PopExpiredFields() {
+			s.propagateHDel(i, expired.Key, expired.Fields)
+		}
 	}
 }
@@ -315,7 +315,7 @@ func (s *Server) waitMasterNotification(client *Client) {
 	parser := resp.NewParser(client.cnn) // 这里会阻塞等待有数据到达
 	running := true
 
-	for running && !s.quit {
+	for running && !s.quit.Load() {
 
 		for {
 			parsed := parser.Parse()
@@ -365,7 +365,7 @@ func (s *Server) waitMasterNotification(client *Client) {
 	}
 
 	// 如果是读写发生错误，需要通知事件循环来关闭连接
-	if client.status != EXIT && s.role == Slave {
+	if client.getStatus() != EXIT && s.role == Slave {
 		// 说明这是异常退出的
 		logger.Error("Replication: Connection with master lost.")
 		s.masterAlive = false
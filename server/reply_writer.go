@@ -0,0 +1,83 @@
+package server
+
+import (
+	"io"
+)
+
+// replyBufferLimit 是回包缓冲区的软上限，超过该大小时会立即写入到连接中
+const replyBufferLimit = 16 * 1024
+
+// replyWriter 将回包写入到连接中。pipeline 中连续到达的多个回包会先合并到缓冲区中，再通过一次系统调用写入
+type replyWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func newReplyWriter(w io.Writer) *replyWriter {
+	return &replyWriter{
+		w:   w,
+		buf: make([]byte, 0, 4096),
+	}
+}
+
+// buffer 将回包追加到缓冲区中，返回缓冲区是否已经达到上限
+func (rw *replyWriter) buffer(data []byte) bool {
+	rw.buf = append(rw.buf, data...)
+	return len(rw.buf) >= replyBufferLimit
+}
+
+// Write 实现了 io.Writer，数据会追加到缓冲区中，缓冲区达到上限时写入到连接中。
+// 配合 resp.WriteTo 使用时，大回包会被分段写入，不需要完整地生成在内存中
+func (rw *replyWriter) Write(p []byte) (int, error) {
+
+	// 超过上限的数据不需要复制到缓冲区中
+	if len(p) >= replyBufferLimit {
+		if err := rw.flush(); err != nil {
+			return 0, err
+		}
+		if err := writeFull(rw.w, p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if rw.buffer(p) {
+		if err := rw.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush 将缓冲区中的全部数据写入到连接中
+func (rw *replyWriter) flush() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+
+	err := writeFull(rw.w, rw.buf)
+
+	// 缓冲区过大时不再复用，防止大回包一直占用内存
+	if cap(rw.buf) > 4*replyBufferLimit {
+		rw.buf = make([]byte, 0, 4096)
+	} else {
+		rw.buf = rw.buf[:0]
+	}
+	return err
+}
+
+// writeFull 将 data 全部写入到 w 中，发生短写时会继续写入剩余的部分，直到全部写入或者发生错误
+func writeFull(w io.Writer, data []byte) error {
+	for len(data) > 0 {
+		n, err := w.Write(data)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			// 没有任何进展，继续写入只会陷入死循环
+			return io.ErrShortWrite
+		}
+		data = data[n:]
+	}
+	return nil
+}
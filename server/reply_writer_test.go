@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/resp"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// shortWriter 每次最多只写入 n 个字节，用于模拟 TCP 短写
+type shortWriter struct {
+	bytes.Buffer
+	n      int
+	writes int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	return w.Buffer.Write(p)
+}
+
+// errWriter 写入部分数据后返回错误
+type errWriter struct {
+	written int
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.written > 0 {
+		return 0, errors.New("broken pipe")
+	}
+	w.written = len(p) / 2
+	return w.written, nil
+}
+
+func TestWriteFull(t *testing.T) {
+
+	w := &shortWriter{n: 3}
+	reply := []byte("$11\r\nhello world\r\n")
+
+	assert.Nil(t, writeFull(w, reply))
+	assert.Equal(t, reply, w.Bytes())
+	assert.Equal(t, (len(reply)+2)/3, w.writes)
+
+	assert.Equal(t, "broken pipe", writeFull(&errWriter{}, reply).Error())
+
+	// 没有进展的写入不会陷入死循环
+	w = &shortWriter{n: 0}
+	assert.Equal(t, io.ErrShortWrite, writeFull(w, reply))
+}
+
+func TestReplyWriter(t *testing.T) {
+
+	w := &shortWriter{n: 5}
+	rw := newReplyWriter(w)
+
+	// 多个回包会合并后一次性写入
+	replies := []string{"+OK\r\n", ":1\r\n", "$3\r\nabc\r\n"}
+	for _, r := range replies {
+		assert.False(t, rw.buffer([]byte(r)))
+	}
+	assert.Equal(t, 0, w.writes)
+
+	assert.Nil(t, rw.flush())
+	assert.Equal(t, strings.Join(replies, ""), w.String())
+
+	// 缓冲区为空时不会写入
+	writes := w.writes
+	assert.Nil(t, rw.flush())
+	assert.Equal(t, writes, w.writes)
+
+	// 超过上限时需要立即写入
+	w.Reset()
+	large := strings.Repeat("a", replyBufferLimit)
+	assert.True(t, rw.buffer([]byte(large)))
+	assert.Nil(t, rw.flush())
+	assert.Equal(t, large, w.String())
+}
+
+// countWriter 记录单次写入的最大长度
+type countWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.max = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestReplyWriterStream(t *testing.T) {
+
+	elements := make([]resp.RedisData, 50000)
+	for i := range elements {
+		elements[i] = resp.MakeBulkData([]byte("element-" + strconv.Itoa(i)))
+	}
+	data := resp.MakeArrayData(elements)
+
+	// 大数组会分段写入，每次写入的长度不会超过缓冲区的上限太多
+	w := &countWriter{}
+	rw := newReplyWriter(w)
+	_, err := resp.WriteTo(rw, data)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.flush())
+	assert.Equal(t, data.ToBytes(), w.Bytes())
+	assert.Less(t, w.max, replyBufferLimit+64)
+
+	// 超过上限的 value 直接写入，不会复制到缓冲区中
+	w.Reset()
+	large := resp.MakeBulkData([]byte(strings.Repeat("a", 4*replyBufferLimit)))
+	_, err = resp.WriteTo(rw, resp.MakeArrayData([]resp.RedisData{resp.MakeIntData(1), large}))
+	assert.Nil(t, err)
+	assert.Nil(t, rw.flush())
+	assert.Equal(t, "*2\r\n:1\r\n"+string(large.ToBytes()), w.String())
+	assert.Equal(t, 4*replyBufferLimit, w.max)
+	assert.LessOrEqual(t, cap(rw.buf), 4*replyBufferLimit)
+}
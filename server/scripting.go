@@ -667,7 +667,7 @@ func initFlags(L *lua.LState, fName string) {
 	env.randomDirty = false
 	env.running = true
 	env.curScript = fName
-	env.startTime = global.Now
+	env.startTime = global.Now()
 	env.execTime = 0
 }
 
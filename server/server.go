@@ -1,8 +1,8 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 	"github.com/tangrc99/MemTable/config"
 	"github.com/tangrc99/MemTable/db"
@@ -12,11 +12,13 @@ import (
 	"github.com/tangrc99/MemTable/server/global"
 	"github.com/tangrc99/MemTable/utils/gopool"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path"
-	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -28,8 +30,21 @@ type Server struct {
 	listener    net.Listener // listener
 	tlsListener net.Listener // tls listener
 	uListener   net.Listener // uds listener
+	metricsAddr string       // Prometheus 指标的监听地址
+	metrics     *http.Server // Prometheus 指标的 HTTP 服务
 	dir         string       // 工作目录
 
+	proxyProtocol bool  // 是否解析 PROXY 协议头部，用于获取负载均衡之后的真实客户端地址
+	maxInflight   int64 // 单个连接中尚未执行的命令最多占用的字节数
+
+	tcpKeepAlive  time.Duration // TCP keepalive 的间隔，为 0 时关闭
+	keepAlivePing time.Duration // 向开启了 client keepalive 的空闲客户端发送 PING 的间隔，为 0 时不发送
+
+	debugEnabled bool // 是否允许通过 DEBUG 命令修改内部参数
+
+	hz        int          // 每秒执行定时任务的次数
+	cronLoops atomic.Int64 // 定时任务的执行次数
+
 	// 数据库部分
 	dbs          []*db.DataBase // 多个可以用于切换的数据库
 	Chs          *db.Channels   // 订阅发布频道
@@ -45,26 +60,35 @@ type Server struct {
 	tl *TimeEventList // 时间事件链表
 
 	// 退出控制
-	quit     bool
+	quit     atomic.Bool
 	quitFlag chan struct{}
 
 	// 持久化
-	rdbFile    string     // rdb 文件名
-	dirty      int        // 脏数据计数器
-	checkPoint int64      // rdb 时间
-	RDBStatus             // rdb 文件状态
-	aofFile    string     // aof 文件名
-	aof        *aofBuffer // aof 缓冲区
-	aofEnabled bool       // 是否开启 aof
+	rdbFile    string       // rdb 文件名
+	dirty      atomic.Int64 // 脏数据计数器，bgsave 完成时会在后台协程中修改
+	checkPoint int64        // rdb 时间
+	RDBStatus               // rdb 文件状态
+	aofFile    string       // aof 文件名
+	aof        *aofBuffer   // aof 缓冲区
+	aofEnabled bool         // 是否开启 aof
+
+	aofWaiters []*aofWaiter // 阻塞在 WAITAOF 上的客户端
 
 	full bool // 表示已经写满
 	cost int64
 
 	// 慢查询日志
 	slowlog *slowLog
+	latency *latencyMonitor
 	// 监视器
 	monitors *Monitor
 
+	// 客户端缓存
+	tracking *tracker
+
+	// client pause
+	pause pauseState
+
 	// 协程池
 	gopool *gopool.Pool // 用于客户端启动的协程池
 	sts    *Status
@@ -78,22 +102,19 @@ type Server struct {
 	msgPool sync.Pool
 
 	acl *acl.ACL
+
+	// 进程内执行命令使用的客户端
+	execMu  sync.Mutex
+	execCli *Client
 }
 
 func NewServer() *Server {
 	// 配置数据库
 	d := make([]*db.DataBase, config.Conf.DataBases)
 
+	policy, _ := db.ParseEvictPolicy(config.Conf.Eviction)
 	for i := 0; i < config.Conf.DataBases; i++ {
-		switch config.Conf.Eviction {
-		case "no":
-			d[i] = db.NewDataBase(slotNum, db.WithEviction(db.NoEviction))
-		case "lru":
-			d[i] = db.NewDataBase(slotNum, db.WithEviction(db.EvictLRU))
-		case "lfu":
-			d[i] = db.NewDataBase(slotNum, db.WithEviction(db.EvictLFU))
-
-		}
+		d[i] = db.NewDataBase(slotNum, db.WithEviction(policy))
 	}
 
 	s := &Server{
@@ -103,18 +124,19 @@ func NewServer() *Server {
 		clis:       NewClientList(),
 		tl:         NewTimeEventList(),
 		events:     make(chan *Event, 10000),
-		quit:       false,
 		quitFlag:   make(chan struct{}),
 		rdbFile:    config.Conf.RDBFile,
-		dirty:      0,
 		sts:        NewStatus(),
 		cliTimeout: config.Conf.Timeout,
 		maxClients: config.Conf.MaxClients,
 		dir:        config.Conf.Dir,
+		uds:        config.Conf.UnixSocket,
 		aofEnabled: config.Conf.AppendOnly,
 		aofFile:    "appendonly.aof",
 		slowlog:    newSlowLog(config.Conf.SlowLogMaxLen),
+		latency:    newLatencyMonitor(config.Conf.LatencyMonitorThreshold),
 		monitors:   NewMonitor(),
+		tracking:   newTracker(),
 		acl:        acl.NewAccessControlList(config.Conf.ACLFile),
 	}
 
@@ -126,6 +148,21 @@ func NewServer() *Server {
 		s.tlsUrl = fmt.Sprintf("%s:%d", config.Conf.Host, config.Conf.TLSPort)
 	}
 
+	// 位于负载均衡之后时开启
+	s.proxyProtocol = config.Conf.ProxyProtocol
+	s.maxInflight = config.Conf.ClientMaxInflight
+	s.tcpKeepAlive = time.Duration(config.Conf.TCPKeepAlive) * time.Second
+	s.keepAlivePing = time.Duration(config.Conf.KeepAlivePing) * time.Second
+	s.hz = config.Conf.Hz
+	s.debugEnabled = config.Conf.EnableDebugCommand
+	s.metricsAddr = config.Conf.MetricsAddr
+	resp.ProtoMaxBulkLen = config.Conf.ProtoMaxBulkLen
+	global.MaxReplyElements = config.Conf.MaxReplyElements
+	global.CommandTimeBudget = time.Duration(config.Conf.CommandTimeBudget) * time.Millisecond
+	s.changeReplicationID()
+	// 与 redis 相同，没有保存过时使用启动时间
+	s.lastSave.Store(time.Now().Unix())
+
 	evictChannel := make([]chan string, s.dbNum)
 	for i := range evictChannel {
 		evictChannel[i] = make(chan string, 100)
@@ -150,7 +187,7 @@ func (s *Server) InitModules() {
 	// aof 开关
 	if config.Conf.AppendOnly {
 		logger.Debug("Config: AppendOnly Enabled")
-		s.aof = newAOFBuffer(config.Conf.Dir + "appendonly.aof")
+		s.aof = newAOFBufferWithPolicy(config.Conf.Dir+"appendonly.aof", config.Conf.AppendFsync, global.TEAOF)
 	}
 
 	if config.Conf.GoPool {
@@ -166,19 +203,47 @@ func (s *Server) InitModules() {
 func (s *Server) handleRead(conn net.Conn) {
 
 	client := NewClient(conn)
+	s.sts.totalConnectionsReceived.Add(1)
+
+	if err := setKeepAlive(conn, s.tcpKeepAlive); err != nil {
+		logger.Warning("Client", conn.RemoteAddr().String(), "Set Keepalive Error:", err.Error())
+	}
+
+	// 限制连接中尚未执行的命令占用的内存
+	inflight := newInflightReader(conn, s.maxInflight)
+	client.parser = resp.NewParser(inflight)
 
-	logger.Info("New Client", conn.RemoteAddr().String())
+	// 位于负载均衡之后时，从 PROXY 协议头部中获取真实的客户端地址
+	if s.proxyProtocol {
+		addr, err := readProxyHeader(conn)
+		if err != nil {
+			logger.Warning("Client", conn.RemoteAddr().String(), "PROXY Protocol Error:", err.Error())
+			_ = conn.Close()
+			return
+		}
+		client.addr = addr
+	}
+
+	logger.Info("New Client", client.addr)
 
 	// 这里会阻塞等待有数据到达
 	running := true
 
-	req := make(chan *resp.ParsedRes, 10)
+	req := make(chan inflightRequest, 10)
+	// 连接协程退出后通知解析协程，running 只由连接协程读写
+	stopped := make(chan struct{})
+	defer close(stopped)
 
 	ok := s.runInNewGoroutine(func() {
-		for running && !s.quit {
+		for !s.quit.Load() {
 			r := client.ParseStream()
-			req <- r
-			if r.Abort == true {
+			select {
+			case req <- inflightRequest{parsed: r, size: inflight.parsed()}:
+			case <-stopped:
+				return
+			}
+			// 超过上限后连接会被关闭，不需要继续解析
+			if r.Abort == true || r.Err == errInflightExceeded {
 				break
 			}
 		}
@@ -188,10 +253,23 @@ func (s *Server) handleRead(conn net.Conn) {
 		return
 	}
 
-	for running && !s.quit {
+	writer := newReplyWriter(conn)
+
+	for running && !s.quit.Load() {
 
 		select {
-		case parsed := <-req:
+		case r := <-req:
+
+			// 命令交给事件循环之后就不再占用连接的内存
+			parsed := r.parsed
+			inflight.release(r.size)
+
+			if parsed.Err == errInflightExceeded {
+				logger.Warning("Client", client.addr, "Exceeded Max Inflight Bytes")
+				writer.buffer(resp.MakeErrorData(parsed.Err.Error()).ToBytes())
+				running = false
+				break
+			}
 
 			if parsed.Err != nil {
 
@@ -200,14 +278,14 @@ func (s *Server) handleRead(conn net.Conn) {
 				if e == "AGAIN" {
 					continue
 				} else if e == "EOF" {
-					logger.Debugf("Client %s ShutDown Connection", client.cnn.RemoteAddr().String())
+					logger.Debugf("Client %s ShutDown Connection", client.addr)
 
 				} else {
 
 					logger.Info("Client Read Error:", e)
-					matched, _ := regexp.MatchString("Protocol error*", e)
-					if matched {
-						continue
+					// 与 redis 相同，协议错误之后无法确定后续数据的边界，回复错误之后关闭连接
+					if strings.HasPrefix(e, "Protocol error") {
+						writer.buffer(resp.MakeErrorData("ERR " + e).ToBytes())
 					}
 
 				}
@@ -220,6 +298,17 @@ func (s *Server) handleRead(conn net.Conn) {
 				continue
 			}
 
+			// 对端对 keepalive PING 的回复不需要执行
+			if isKeepAlivePong(parsed.Data) {
+				client.pongAt.Store(time.Now().UnixNano())
+				continue
+			}
+
+			// 与 redis 相同，空的 multibulk 以及只有空白字符的 inline 命令会被忽略，不需要回复
+			if isEmptyCommand(parsed.Data) {
+				continue
+			}
+
 			if plain, ok := parsed.Data.(*resp.PlainData); ok {
 
 				client.pipelined = true
@@ -242,25 +331,55 @@ func (s *Server) handleRead(conn net.Conn) {
 
 			client.pipelined = false
 
+		// 阻塞命令的结果直接写入 socket，订阅的消息与命令的回复一样通过 res 发送
+		case m := <-client.msg:
+
+			writer.buffer(m)
+			if err := writer.flush(); err != nil {
+				logger.Warning("Client", client.id, "write Error:", err.Error())
+				running = false
+				break
+			}
+
 		// 使用 select 防止协程无法释放
 		case r := <-client.res:
 
-			// 将主线程的返回值写入到 socket 中
-			_, err := conn.Write((*r).ToBytes())
+			// pipeline 中已经执行完毕的回包会合并后再写入 socket，大回包会分段写入
+			_, err := resp.WriteTo(writer, *r)
+			quit := isQuitReply(*r)
+		batch:
+			for err == nil && !quit {
+				select {
+				case r = <-client.res:
+					_, err = resp.WriteTo(writer, *r)
+					quit = isQuitReply(*r)
+				default:
+					break batch
+				}
+			}
 
+			if err == nil {
+				err = writer.flush()
+			}
 			if err != nil {
-				logger.Warning("Client", client.id, "write Error")
+				logger.Warning("Client", client.id, "write Error:", err.Error())
 				running = false
 				break
 			}
+
+			// quit 的回复发送完毕之后关闭连接
+			if quit {
+				logger.Debugf("Client %s Quit", client.addr)
+				running = false
+			}
 		}
 
 	}
 
 	// 如果是读写发生错误，需要通知事件循环来关闭连接
-	if client.status != EXIT {
+	if client.getStatus() != EXIT {
 		// 说明这是异常退出的
-		client.status = ERROR
+		client.setStatus(ERROR)
 		client.cmd = nil
 		event := ePool.newEvent(client)
 
@@ -274,115 +393,78 @@ sendFinish:
 		select {
 		case r := <-client.res:
 
-			// 将主线程的返回值写入到 socket 中
-			_, err := conn.Write((*r).ToBytes())
-
-			if err != nil {
-				logger.Warning("Client", client.id, "write Error")
+			// 将主线程的返回值写入到缓冲区中
+			if _, err := resp.WriteTo(writer, *r); err != nil {
 				break sendFinish
 			}
+
 		default:
 			break sendFinish
 		}
 
 	}
 
+	if err := writer.flush(); err != nil {
+		logger.Warning("Client", client.id, "write Error:", err.Error())
+	}
+
 	_ = conn.Close()
 
-	logger.Info("Client Shutdown", conn.RemoteAddr().String())
+	logger.Info("Client Shutdown", client.addr)
 
 }
 
 func (s *Server) eventLoop() {
 
 	s.initTimeEvents()
-	timer := time.NewTimer(100 * time.Millisecond)
 
-	for !s.quit {
+	// 定时任务以固定的频率执行，hz 越高后台任务的响应越快
+	ticker := time.NewTicker(time.Second / time.Duration(s.hz))
+	defer ticker.Stop()
+
+	for !s.quit.Load() {
 
 		// 每一次循环都更新一次全局时钟
 		global.UpdateGlobalClock()
 
 		select {
 
-		case <-timer.C:
+		// 没有事件时阻塞等待，后台任务只在定时器触发时执行，避免空转占用 cpu
+		case <-ticker.C:
 
-			timer.Reset(100 * time.Millisecond)
-			// 需要完成定时任务，这里是非阻塞的，可以使用全局时钟
-			s.tl.ExecuteManyDuring(global.Now, 25*time.Millisecond)
+			s.serverCron()
 
 		case event := <-s.events:
 
-			global.UpdateGlobalClock()
-			startTs := global.Now
-
 			cli := event.cli
 			logger.Debug("EventLoop: New Event From Client", cli.id.String())
 
 			// 底层发生异常，需要关闭客户端，或者客户端已经关闭了，那么就不处理请求了
-			if cli.status == ERROR || cli.status == EXIT {
+			if cli.getStatus() == ERROR || cli.getStatus() == EXIT {
 				// 释放客户端资源
 				s.shutdownClient(cli)
 				continue
 			}
 
+			// 执行 quit 之后 pipeline 中剩余的命令直接丢弃
+			if cli.quit {
+				ePool.putEvent(event)
+				continue
+			}
+
 			// 用于判断是否为新连接
 			if s.clis.AddClientIfNotExist(cli) {
 				logger.Debug("EventLoop: New Client", cli.id.String())
 			}
 
-			// 更新时间戳
-			cli.UpdateTimestamp(global.Now)
-
-			// monitor
-			s.monitors.NotifyAll(event)
-
-			// 执行命令
-			res, isWriteCommand := ExecCommand(s, cli, event.cmd, event.raw)
-
-			global.UpdateGlobalClock()
-			endTs := global.Now
-
-			// slow log
-			if config.Conf.SlowLogSlowerThan >= 0 {
-				// this is a slow command
-				if d := endTs.Sub(startTs).Microseconds(); d >= config.Conf.SlowLogSlowerThan {
-					s.slowlog.appendEntry(event.cmd, d)
-				}
-			}
-
-			if res == nil {
+			// 暂停期间的命令在暂停结束之后按顺序执行
+			if s.pause.hold(s, event) {
 				continue
 			}
 
-			// 只有写命令需要完成aof持久化
-			if isWriteCommand && fmt.Sprintf("%T", res) != "*resp.ErrorData" {
-
-				if event.pipelined {
-					event.raw = resp.PlainDataToResp(event.cmd).ToBytes()
-				}
-
-				s.appendAOF(event)
-				s.updateReplicaStatus(event)
-				s.dirty++
-			}
-
-			// 非阻塞状态的客户端写入回包
-			if !cli.blocked {
-				cli.res <- &res
-			}
-
-			// 归还
-			ePool.putEvent(event)
-
-		default:
-
-			// TODO: 选择一些轻量级任务来做
-
-			//if s.aofEnabled {
-			//	s.aof.flush()
-			//}
+			s.processEvent(event)
 		}
+		s.resumePaused()
 		s.handleEvictionNotification()
 
 	}
@@ -391,19 +473,16 @@ func (s *Server) eventLoop() {
 	logger.Info("Server: Ready To Shutdown")
 
 	// 关闭监听
-	if s.listener != nil {
-		_ = s.listener.Close()
-	}
-	if s.tlsListener != nil {
-		_ = s.tlsListener.Close()
-	}
-	if s.uListener != nil {
-		_ = s.uListener.Close()
-	}
+	s.closeListeners()
 
 	// 进行数据持久化
 	s.saveData()
 
+	// 没有开启 aof 持久化时同样需要停止 aof 的后台协程
+	if s.aof != nil {
+		s.aof.quit()
+	}
+
 	// 关闭所有的客户端协程
 	for s.clis.Size() != 0 {
 		front := s.clis.list.FrontNode()
@@ -415,23 +494,147 @@ func (s *Server) eventLoop() {
 	s.quitFlag <- struct{}{}
 }
 
+// processEvent 执行一条客户端命令，并将回包发送给客户端
+func (s *Server) processEvent(event *Event) {
+
+	res := s.processCommand(event)
+	if res == nil {
+		return
+	}
+
+	// 非阻塞状态的客户端写入回包
+	if !event.cli.blocked {
+		event.cli.res <- &res
+	}
+
+	// 归还
+	ePool.putEvent(event)
+}
+
+// ProcessCommand 执行客户端的一条命令，完成命令的查找与检查、持久化、主从复制以及统计，并返回回包。
+// 命令不经过网络连接，回包也不会发送给客户端，必须在事件循环所在的协程中调用。阻塞类命令返回 nil
+func (s *Server) ProcessCommand(cli *Client, cmd [][]byte) resp.RedisData {
+	// 写命令的 resp 格式会在需要时生成
+	return s.processCommand(&Event{cmd: cmd, cli: cli, pipelined: true})
+}
+
+// processCommand 是 ProcessCommand 的实现，event.pipelined 为 true 时写命令的 resp 格式根据 event.cmd 生成
+func (s *Server) processCommand(event *Event) resp.RedisData {
+
+	global.UpdateGlobalClock()
+	startTs := global.Now()
+	cli := event.cli
+
+	// 更新时间戳
+	cli.UpdateTimestamp(global.Now())
+
+	// monitor
+	s.monitors.NotifyAll(event)
+
+	// 执行命令
+	res, isWriteCommand := ExecCommand(s, cli, event.cmd, event.raw)
+
+	global.UpdateGlobalClock()
+	endTs := global.Now()
+
+	// slow log
+	if config.Conf.SlowLogSlowerThan >= 0 {
+		// this is a slow command
+		if d := endTs.Sub(startTs).Microseconds(); d >= config.Conf.SlowLogSlowerThan {
+			s.slowlog.appendEntry(event.cmd, d)
+		}
+	}
+
+	// 延迟统计
+	s.latency.addSample(latencyEventCommand, endTs.Sub(startTs))
+	s.sts.recordCommand(event.cmd, endTs.Sub(startTs), res)
+
+	if res == nil {
+		return nil
+	}
+
+	// 只有写命令需要完成aof持久化
+	if isWriteCommand && fmt.Sprintf("%T", res) != "*resp.ErrorData" {
+
+		if event.pipelined {
+			event.raw = resp.PlainDataToResp(event.cmd).ToBytes()
+		}
+		event.raw = rewriteForPropagation(event.cmd, res, event.raw, startTs)
+
+		s.appendAOF(event)
+		s.updateReplicaStatus(event)
+		s.dirty.Add(1)
+	}
+
+	// always 策略需要在回包之前完成刷盘
+	if s.aof != nil && s.aof.policy == fsyncAlways {
+		s.aof.sync()
+	}
+
+	return res
+}
+
+// activeExpireCycle 对每一个数据库的过期字典进行抽样，删除其中已经过期的键。如果一次抽样中过期键的比例
+// 超过 ExpireCycleAcceptable，说明过期键较多，会继续抽样，直到比例下降、达到最大抽样轮数或超过 deadline。
+// 这样在键数量很多时也只会占用有限的时间，不会阻塞事件循环
+func (s *Server) activeExpireCycle(deadline time.Time) {
+
+	for _, dataBase := range s.dbs {
+		for i := 0; i < global.ExpireCycleMaxLoops; i++ {
+
+			if dataBase.TTLSize() == 0 {
+				break
+			}
+
+			deleted := dataBase.CleanExpiredKeys(global.ExpireCycleSamples)
+
+			// 及时处理过期通知，防止通知队列写满后阻塞
+			s.handleEvictionNotification()
+
+			if deleted*100 <= global.ExpireCycleSamples*global.ExpireCycleAcceptable || time.Now().After(deadline) {
+				break
+			}
+		}
+
+		// hash 中过期的 field 同样需要主动删除
+		dataBase.CleanExpiredFields(global.ExpireCycleSamples)
+		s.handleEvictionNotification()
+
+		if time.Now().After(deadline) {
+			return
+		}
+	}
+}
+
+// serverCron 每秒执行 hz 次，用于完成到期的定时任务
+func (s *Server) serverCron() {
+	s.cronLoops.Add(1)
+	// 需要完成定时任务，这里是非阻塞的，可以使用全局时钟。每一次最多占用四分之一的周期
+	s.tl.ExecuteManyDuring(global.Now(), time.Second/time.Duration(s.hz)/4)
+	// 唤醒等待 aof 刷盘的客户端
+	s.handleAOFWaiters()
+}
+
 // acceptLoop 运行 Acceptor
 func (s *Server) acceptLoop(listener net.Listener) {
 
-	for !s.quit {
+	for !s.quit.Load() {
 		conn, err := listener.Accept()
 		if err != nil {
 			break
 		}
 
-		// 如果客户端数量过多，尝试清理
+		// 如果客户端数量过多，拒绝连接
 		if s.maxClients > 0 && s.clis.Size() >= s.maxClients {
+			s.sts.rejectedConnections.Add(1)
 			_ = conn.Close()
+			continue
 		}
 
 		if ok := s.runInNewGoroutine(func() {
 			s.handleRead(conn)
 		}); !ok {
+			s.sts.rejectedConnections.Add(1)
 			_ = conn.Close()
 		}
 
@@ -445,6 +648,9 @@ func (s *Server) shutdownClient(cli *Client) {
 	// 释放客户端资源
 	logger.Debug("EventLoop: Remove Closed Client", cli.id.String())
 	cli.UnSubscribeAll(s.Chs)
+	s.tracking.disable(cli)
+	s.unblockClient(cli, nil)
+	s.removeAOFWaiters(cli)
 	s.clis.RemoveClient(cli)
 	if cli.monitored {
 		s.monitors.RemoveMonitor(cli)
@@ -464,43 +670,52 @@ func (s *Server) initTimeEvents() {
 
 		s.clis.RemoveLongNotUsed(3, 20, time.Duration(s.cliTimeout)*time.Second)
 
-	}, time.Now().Add(global.TECleanClients).Unix(), global.TECleanClients,
+	}, time.Now().Add(global.TECleanClients).UnixMilli(), global.TECleanClients,
 	))
 
-	// 过期 key 清理
+	// 向空闲的客户端发送 PING，尽快发现已经失效的连接
+	if s.keepAlivePing > 0 {
+		s.tl.AddTimeEvent(NewPeriodTimeEvent(func() {
+			logger.Debug("TimeEvent: Ping Idle Clients")
+
+			s.clis.PingIdle(s.clis.Size(), s.keepAlivePing)
+
+		}, time.Now().Add(s.keepAlivePing/2).UnixMilli(), s.keepAlivePing/2,
+		))
+	}
+
+	// 过期 key 清理，每一次定时任务都会执行
+	cronPeriod := time.Second / time.Duration(s.hz)
 	s.tl.AddTimeEvent(NewPeriodTimeEvent(func() {
 		logger.Debug("TimeEvent: Remove Expired Keys")
 
-		for _, dataBase := range s.dbs {
-			// 抽样 20 个，如果有 5 个过期，则再次删除
-			for dataBase.CleanExpiredKeys(20) >= 5 {
-			}
-		}
+		start := time.Now()
+		s.activeExpireCycle(start.Add(cronPeriod * global.ExpireCycleTimePercent / 100))
+		s.latency.addSample(latencyEventExpireCycle, time.Since(start))
 
-	}, time.Now().Add(global.TEExpireKey).Unix(), global.TEExpireKey,
+	}, time.Now().Add(cronPeriod).UnixMilli(), cronPeriod,
 	))
 
-	// AOF 刷盘
+	// 对命令计数器进行采样，用于计算瞬时速率
 	s.tl.AddTimeEvent(NewPeriodTimeEvent(func() {
-		logger.Debug("TimeEvent: AOF FLUSH")
+		logger.Debug("TimeEvent: Track Metrics")
 
-		if s.aofEnabled {
-			s.aof.flush()
-		}
-		//s.aof.syncToDisk()
+		s.trackMetrics()
 
-	}, time.Now().Add(global.TEAOF).Unix(), global.TEAOF,
+	}, time.Now().Add(global.TEStatsSample).UnixMilli(), global.TEStatsSample,
 	))
 
 	// bgsave 持久化 trigger
 	s.tl.AddTimeEvent(NewPeriodTimeEvent(func() {
 		logger.Debug("TimeEvent: RDB Check")
 
-		if !s.aofEnabled && (s.dirty > 100 || global.Now.Unix()-s.checkPoint > 10) {
-			s.BGRDB()
+		if !s.aofEnabled && !s.bgsaveInProgress.Load() && (s.dirty.Load() > 100 || global.Now().Unix()-s.checkPoint > 10) {
+			if s.BGRDB() {
+				s.checkPoint = global.Now().Unix()
+			}
 		}
 
-	}, time.Now().Add(global.TEBgSave).Unix(), global.TEBgSave,
+	}, time.Now().Add(global.TEBgSave).UnixMilli(), global.TEBgSave,
 	))
 
 	// 更新服务端信息
@@ -509,7 +724,7 @@ func (s *Server) initTimeEvents() {
 
 		s.UpdateStatus()
 
-	}, time.Now().Add(global.TEUpdateStatus).Unix(), global.TEUpdateStatus,
+	}, time.Now().Add(global.TEUpdateStatus).UnixMilli(), global.TEUpdateStatus,
 	))
 
 	// 主从复制相关操作
@@ -518,7 +733,7 @@ func (s *Server) initTimeEvents() {
 
 		s.handleReplicaEvents()
 
-	}, time.Now().Add(global.TEReplica).Unix(), global.TEReplica,
+	}, time.Now().Add(global.TEReplica).UnixMilli(), global.TEReplica,
 	))
 
 	// cluster 相关操作
@@ -527,16 +742,72 @@ func (s *Server) initTimeEvents() {
 
 		s.handleClusterEvents()
 
-	}, time.Now().Add(global.TECluster).Unix(), global.TECluster,
+	}, time.Now().Add(global.TECluster).UnixMilli(), global.TECluster,
 	))
 }
 
+// Start 启动服务器，在收到 SIGINT 或 SIGTERM 信号后退出
 func (s *Server) Start() {
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM) // 接受软中断信号
+	defer stop()
+
+	_ = s.StartContext(ctx)
+}
+
+// StartContext 启动服务器，并阻塞至 ctx 被取消。ctx 取消后会关闭所有监听并停止事件循环，完成持久化后返回。
+// 该函数不会初始化日志，调用者需要提前调用 logger.Init，因此可以将服务器嵌入到其他程序或测试中
+func (s *Server) StartContext(ctx context.Context) error {
+
+	// 先完成监听再开启事务线程，监听失败时不会执行持久化，避免覆盖已有的数据文件
+	if err := s.listen(); err != nil {
+		return err
+	}
+
 	// 开启事务线程
 	go s.eventLoop()
 
-	var err error
+	<-ctx.Done()
+
+	s.stop()
+
+	logger.Info("Server Shutdown...")
+
+	return nil
+}
+
+// stop 通知事件循环在完成任务后退出，防止有任务进行到一半，并等待退出完成
+func (s *Server) stop() {
+	s.quit.Store(true)
+	<-s.quitFlag
+}
+
+// closeListeners 关闭所有已经开启的监听，重复调用不会产生影响
+func (s *Server) closeListeners() {
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	if s.tlsListener != nil {
+		_ = s.tlsListener.Close()
+	}
+	if s.uListener != nil {
+		_ = s.uListener.Close()
+		_ = os.Remove(s.uds)
+	}
+	if s.metrics != nil {
+		_ = s.metrics.Close()
+	}
+}
+
+// listen 创建所有配置的监听器，并为每一个监听器启动 Acceptor，所有连接都会进入同一个 handleRead
+func (s *Server) listen() (err error) {
+
+	// 任意一个监听失败时关闭之前已经开启的监听
+	defer func() {
+		if err != nil {
+			s.closeListeners()
+		}
+	}()
 
 	// start network server
 	if s.url != "" {
@@ -544,7 +815,7 @@ func (s *Server) Start() {
 		s.listener, err = net.Listen("tcp", s.url)
 		if err != nil {
 			logger.Error("Server:", err.Error())
-			return
+			return err
 		}
 
 		logger.Info("Server: Listen at", s.url)
@@ -554,64 +825,49 @@ func (s *Server) Start() {
 	// start tls server
 	if s.tlsUrl != "" {
 
-		// 载入服务端证书和私钥
-		srvCert, err := tls.LoadX509KeyPair(config.Conf.CertFile, config.Conf.KeyFile)
-		if err != nil {
-			logger.Panicf(err.Error())
-		}
-
-		// 载入根证书，用于客户端验证
-		caCertPool := x509.NewCertPool()
-		caCert, err := os.ReadFile(config.Conf.CaCertFile)
+		tlsCfg, err := newTLSConfig(config.Conf.CertFile, config.Conf.KeyFile, config.Conf.CaCertFile, config.Conf.AuthClient)
 		if err != nil {
-			logger.Panicf(err.Error())
-		}
-		if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
-			logger.Panicf("Parse cert error, file: %s", config.Conf.CaCertFile)
-		}
-		tlsCfg := &tls.Config{
-			InsecureSkipVerify: false,
-			ClientAuth:         tls.RequestClientCert,
-			ClientCAs:          caCertPool,
-			Certificates:       []tls.Certificate{srvCert},
-		}
-		if config.Conf.AuthClient {
-			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+			logger.Error("TLS Server:", err.Error())
+			return err
 		}
 
-		s.tlsListener, err = tls.Listen("tcp", s.tlsUrl, tlsCfg)
-
+		listener, err := net.Listen("tcp", s.tlsUrl)
 		if err != nil {
 			logger.Error("TLS Server:", err.Error())
+			return err
 		}
 
+		// tls.Conn 实现了 net.Conn，可以直接交给 handleRead 处理
+		s.tlsListener = tls.NewListener(listener, tlsCfg)
+
 		logger.Info("TLS Server: Listen at", s.tlsUrl)
 		go s.acceptLoop(s.tlsListener)
 	}
 
 	// start unix domain server
 	if s.uds != "" {
+		// 清理上一次异常退出时遗留的 socket 文件
+		_ = os.Remove(s.uds)
+
 		s.uListener, err = net.Listen("unix", s.uds)
 		if err != nil {
 			logger.Error("UDS Server:", err.Error())
-			return
+			return err
 		}
 
-		logger.Info("UDS Server: Listen at", s.url)
+		logger.Info("UDS Server: Listen at", s.uds)
 		go s.acceptLoop(s.uListener)
 	}
 
-	quit := make(chan os.Signal)
-
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM) // 接受软中断信号并且传递到 channel
-
-	<-quit
-
-	// 通知主线程在完成任务后退出，防止有任务进行到一半
-	s.quit = true
-	<-s.quitFlag
+	if s.metricsAddr != "" {
+		if _, err = s.listenMetrics(); err != nil {
+			logger.Error("Metrics Server:", err.Error())
+			return err
+		}
+		logger.Info("Metrics Server: Listen at", s.metricsAddr)
+	}
 
-	logger.Info("Server Shutdown...")
+	return nil
 }
 
 func (s *Server) TryRecover() {
@@ -663,17 +919,65 @@ func (s *Server) collectCost() {
 	logger.Debugf("Server memory cost: %d", s.cost)
 }
 
+// freeMemoryIfNeeded 在内存超出 maxmemory 时按照淘汰策略删除键值对，优先从 dbSeq 对应的数据库中淘汰。
+// 如果淘汰后内存仍然不足，返回 false
+func (s *Server) freeMemoryIfNeeded(dbSeq int) bool {
+
+	need := s.cost - int64(config.Conf.MaxMemory)
+
+	for i := 0; i < s.dbNum && need > 0; i++ {
+		seq := (dbSeq + i) % s.dbNum
+		evicted, freed := s.dbs[seq].Evict(need)
+		for _, key := range evicted {
+			s.propagateDel(seq, key)
+		}
+		need -= freed
+	}
+
+	s.collectCost()
+	return !s.full
+}
+
+// isEmptyCommand 判断解析出的数据是否为空的 multibulk 或者只有空白字符的 inline 命令
+func isEmptyCommand(data resp.RedisData) bool {
+	switch v := data.(type) {
+	case *resp.ArrayData:
+		return len(v.Data()) == 0
+	case *resp.PlainData:
+		return strings.TrimSpace(v.Data()) == ""
+	}
+	return false
+}
+
 // handleReadWithoutGoroutine  不使用额外协程进行解析，在性能较差的机器上会表现较好
 func (s *Server) handleReadWithoutGoroutine(conn net.Conn) {
 
 	client := NewClient(conn)
+	s.sts.totalConnectionsReceived.Add(1)
+
+	if err := setKeepAlive(conn, s.tcpKeepAlive); err != nil {
+		logger.Warning("Client", conn.RemoteAddr().String(), "Set Keepalive Error:", err.Error())
+	}
+
+	// 限制单条命令占用的内存
+	inflight := newInflightReader(conn, s.maxInflight)
+	client.parser = resp.NewParser(inflight)
+	writer := newReplyWriter(conn)
 
 	// 这里会阻塞等待有数据到达
 	running := true
 
-	for running && !s.quit {
+	for running && !s.quit.Load() {
 
 		parsed := client.ParseStream()
+		inflight.release(inflight.parsed())
+
+		if parsed.Err == errInflightExceeded {
+			logger.Warning("Client", client.addr, "Exceeded Max Inflight Bytes")
+			_ = writeFull(conn, resp.MakeErrorData(parsed.Err.Error()).ToBytes())
+			running = false
+			break
+		}
 
 		if parsed.Err != nil {
 
@@ -684,11 +988,19 @@ func (s *Server) handleReadWithoutGoroutine(conn net.Conn) {
 				logger.Debug("Client", client.id, "Peer ShutDown Connection")
 			} else {
 				logger.Error("Client", client.id, "Read Error:", e)
+				if strings.HasPrefix(e, "Protocol error") {
+					_ = writeFull(conn, resp.MakeErrorData("ERR "+e).ToBytes())
+				}
 			}
 			running = false
 			break
 		}
 
+		// 与 redis 相同，空的 multibulk 以及只有空白字符的 inline 命令会被忽略，不需要回复
+		if isEmptyCommand(parsed.Data) {
+			continue
+		}
+
 		if plain, ok := parsed.Data.(*resp.PlainData); ok {
 
 			client.pipelined = true
@@ -717,22 +1029,29 @@ func (s *Server) handleReadWithoutGoroutine(conn net.Conn) {
 		r := <-client.res
 
 		// 将主线程的返回值写入到 socket 中
-		_, err := conn.Write((*r).ToBytes())
-
+		_, err := resp.WriteTo(writer, *r)
+		if err == nil {
+			err = writer.flush()
+		}
 		if err != nil {
-			logger.Warning("Client", client.id, "write Error")
+			logger.Warning("Client", client.id, "write Error:", err.Error())
 			running = false
 			break
 		}
 
+		// quit 的回复发送完毕之后关闭连接
+		if isQuitReply(*r) {
+			running = false
+		}
+
 		client.pipelined = false
 
 	}
 
 	// 如果是读写发生错误，需要通知事件循环来关闭连接
-	if client.status != EXIT {
+	if client.getStatus() != EXIT {
 		// 说明这是异常退出的
-		client.status = ERROR
+		client.setStatus(ERROR)
 		client.cmd = nil
 
 		// 通知顶层
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServerUnixSocket(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = ""
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	s.uds = path.Join(s.dir, "memtable.sock")
+
+	go s.eventLoop()
+	assert.Nil(t, s.listen())
+
+	conn, err := net.DialTimeout("unix", s.uds, time.Second)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("*1\r\n$4\r\nping\r\n"))
+	assert.Nil(t, err)
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+pong\r\n", line)
+
+	// 关闭后需要清理 socket 文件
+	s.quit.Store(true)
+	<-s.quitFlag
+	_, err = os.Stat(s.uds)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServerListenFailure(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = "127.0.0.1:0"
+	s.dir = t.TempDir()
+	s.uds = path.Join(s.dir, "none", "memtable.sock")
+
+	// unix socket 监听失败时，已经开启的 tcp 监听需要被关闭
+	assert.NotNil(t, s.listen())
+	assert.NotNil(t, s.listener)
+	l, err := net.Listen("tcp", s.listener.Addr().String())
+	if assert.Nil(t, err) {
+		_ = l.Close()
+	}
+	_, err = s.listener.Accept()
+	assert.NotNil(t, err)
+}
+
+func TestServerStartContext(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = ""
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	s.uds = path.Join(s.dir, "memtable.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.StartContext(ctx)
+	}()
+
+	// 等待监听完成
+	var conn net.Conn
+	var err error
+	for i := 0; i < 100; i++ {
+		if conn, err = net.Dial("unix", s.uds); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	_ = conn.Close()
+
+	cancel()
+
+	select {
+	case err = <-done:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("StartContext did not return after the context was canceled")
+	}
+
+	_, err = net.Dial("unix", s.uds)
+	assert.NotNil(t, err)
+}
+
+func TestServerStartContextListenError(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.url = ""
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	s.uds = path.Join(s.dir, "none", "memtable.sock")
+
+	// 监听失败时直接返回错误，不需要等待 ctx 取消
+	assert.NotNil(t, s.StartContext(context.Background()))
+
+	// 启动失败时不会生成 rdb 文件
+	_, err := os.Stat(path.Join(s.dir, s.rdbFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServerHz(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	s.hz = 50
+
+	go s.eventLoop()
+	time.Sleep(500 * time.Millisecond)
+	s.stop()
+
+	// 500ms 内大约执行 25 次
+	loops := s.cronLoops.Load()
+	assert.True(t, loops >= 15 && loops <= 30, loops)
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	global.UpdateGlobalClock()
+
+	for i := 0; i < 50000; i++ {
+		s.dbs[0].SetKeyWithTTL("expired"+strconv.Itoa(i), structure.Slice("v"), global.Now().Unix()-1)
+	}
+	for i := 0; i < 10; i++ {
+		s.dbs[0].SetKeyWithTTL("alive"+strconv.Itoa(i), structure.Slice("v"), global.Now().Unix()+100)
+	}
+
+	// 每一次清理都不会超过时间限制太多，并且经过有限次清理后全部过期键都被回收
+	budget := 25 * time.Millisecond
+	cycles := 0
+	for s.dbs[0].TTLSize() > 10 && cycles < 100 {
+		start := time.Now()
+		s.activeExpireCycle(start.Add(budget))
+		assert.Less(t, time.Since(start), budget+50*time.Millisecond)
+		cycles++
+	}
+	assert.Equal(t, 10, s.dbs[0].TTLSize())
+	assert.Equal(t, 10, s.dbs[0].Size())
+	assert.True(t, cycles > 1 && cycles < 100, cycles)
+
+}
+
+func TestServerProcessCommand(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.dir = t.TempDir()
+	s.aofEnabled = false
+	cli := NewFakeClient()
+
+	// 不需要启动事件循环以及网络连接
+	assert.Equal(t, resp.MakeStringData("OK"), s.ProcessCommand(cli, toBytesSlice("set", "k", "v")))
+	assert.Equal(t, resp.MakeBulkData([]byte("v")), s.ProcessCommand(cli, toBytesSlice("get", "k")))
+	assert.Equal(t, resp.MakeStringData("OK"), s.ProcessCommand(cli, toBytesSlice("set", "n", "1")))
+	assert.Equal(t, resp.MakeIntData(3), s.ProcessCommand(cli, toBytesSlice("incrby", "n", "2")))
+
+	assert.Equal(t, resp.UnknownCommandError("nosuchcommand", [][]byte{}), s.ProcessCommand(cli, toBytesSlice("nosuchcommand")))
+	assert.Equal(t, resp.WrongArgsError("get"), s.ProcessCommand(cli, toBytesSlice("get")))
+
+	// 只有执行成功的写命令会修改 dirty，找不到的命令不会计入统计
+	assert.Equal(t, int64(3), s.dirty.Load())
+	assert.Equal(t, int64(5), s.sts.totalCommandsProcessed.Load())
+
+	// 回包直接返回，不会发送给客户端
+	assert.Equal(t, 0, len(cli.res))
+}
+
+func TestServerBinarySafeValue(t *testing.T) {
+	s := newExecServer(t)
+	s.uds = path.Join(s.dir, "memtable.sock")
+	assert.Nil(t, s.listen())
+
+	conn, err := net.DialTimeout("unix", s.uds, time.Second)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// 值中包含 NUL、CRLF、协议的控制字符以及非 UTF-8 的字节
+	value := []byte("a\x00b\r\n$-1\r\n\xff\xfe\x80")
+
+	send := func(args ...[]byte) {
+		_, err := conn.Write(resp.PlainDataToResp(args).ToBytes())
+		assert.Nil(t, err)
+	}
+	parser := resp.NewParser(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	send([]byte("set"), []byte("k\x00\xff"), value)
+	assert.Equal(t, resp.MakeStringData("OK"), parser.Parse().Data)
+
+	send([]byte("get"), []byte("k\x00\xff"))
+	assert.Equal(t, value, parser.Parse().Data.ByteData())
+
+	send([]byte("strlen"), []byte("k\x00\xff"))
+	assert.Equal(t, resp.MakeIntData(int64(len(value))), parser.Parse().Data)
+
+	send([]byte("append"), []byte("k\x00\xff"), []byte("\x00"))
+	assert.Equal(t, resp.MakeIntData(int64(len(value)+1)), parser.Parse().Data)
+
+	send([]byte("getrange"), []byte("k\x00\xff"), []byte("1"), []byte("100"))
+	assert.Equal(t, append(value[1:], 0), parser.Parse().Data.ByteData())
+
+	// 键中的字节同样不会被修改
+	send([]byte("randomkey"))
+	assert.Equal(t, []byte("k\x00\xff"), parser.Parse().Data.ByteData())
+
+	// 序列化之后恢复的值与原来相同
+	send([]byte("dump"), []byte("k\x00\xff"))
+	payload := parser.Parse().Data.ByteData()
+	send([]byte("restore"), []byte("copy"), []byte("0"), payload)
+	assert.Equal(t, resp.MakeStringData("OK"), parser.Parse().Data)
+	send([]byte("get"), []byte("copy"))
+	assert.Equal(t, append(value, 0), parser.Parse().Data.ByteData())
+}
+
+func TestRemoveLongNotUsed(t *testing.T) {
+
+	clients := NewClientList()
+	chs := db.NewChannels()
+
+	idle := NewFakeClient()
+	subscriber := NewFakeClient()
+	blocked := NewFakeClient()
+	for _, cli := range []*Client{idle, subscriber, blocked} {
+		clients.AddClientIfNotExist(cli)
+		cli.UpdateTimestamp(global.Now().Add(-time.Hour))
+	}
+	subscriber.Subscribe(chs, "channel")
+	blocked.blocked = true
+
+	// 超过空闲时间之后只有真正空闲的客户端会被移除
+	clients.RemoveLongNotUsed(3, 10, time.Minute)
+	assert.False(t, clients.CheckIfClientExist(idle.id))
+	assert.True(t, clients.CheckIfClientExist(subscriber.id))
+	assert.True(t, clients.CheckIfClientExist(blocked.id))
+
+	// 收到订阅通知时会更新时间戳，取消订阅之后仍然不会被立即移除
+	assert.Equal(t, 1, chs.Publish("channel", []byte("message")))
+	assert.Equal(t, global.Now(), subscriber.tp)
+	subscriber.UnSubscribeAll(chs)
+	blocked.blocked = false
+	clients.RemoveLongNotUsed(3, 10, time.Minute)
+	assert.True(t, clients.CheckIfClientExist(subscriber.id))
+	assert.False(t, clients.CheckIfClientExist(blocked.id))
+}
+
+func TestServerEmptyCommand(t *testing.T) {
+	s := newExecServer(t)
+	s.uds = path.Join(s.dir, "memtable.sock")
+	assert.Nil(t, s.listen())
+
+	conn, err := net.DialTimeout("unix", s.uds, time.Second)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	// 空的 multibulk、空行以及只有空白字符的 inline 命令没有回复，之后的命令正常执行
+	_, err = conn.Write([]byte("*0\r\n\r\n   \r\n*1\r\n$4\r\nping\r\n"))
+	assert.Nil(t, err)
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+pong\r\n", line)
+
+	// 空白的命令名称返回错误
+	_, err = conn.Write([]byte("*1\r\n$0\r\n\r\n*2\r\n$2\r\n  \r\n$1\r\na\r\n"))
+	assert.Nil(t, err)
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "-ERR unknown command '', with args beginning with: \r\n", line)
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "-ERR unknown command '', with args beginning with: 'a' \r\n", line)
+
+	// 事务中空的 multibulk 不会入队
+	_, err = conn.Write([]byte("*1\r\n$5\r\nmulti\r\n*0\r\n*1\r\n$4\r\nexec\r\n"))
+	assert.Nil(t, err)
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+OK\r\n", line)
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "*0\r\n", line)
+}
+
+func TestServerProtocolError(t *testing.T) {
+	s := newExecServer(t)
+	s.uds = path.Join(s.dir, "memtable.sock")
+	assert.Nil(t, s.listen())
+
+	conn, err := net.DialTimeout("unix", s.uds, time.Second)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte("*3\r\n$3\r\nSET\r\n$4\r\nkeep\r\n$1\r\n1\r\n"))
+	assert.Nil(t, err)
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "+OK\r\n", line)
+
+	// 超过 proto-max-bulk-len 的长度之后的数据不会被当作命令执行，连接会被关闭
+	_, err = conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$600000000\r\nFLUSHALL\r\nDBSIZE\r\n"))
+	assert.Nil(t, err)
+	line, err = reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "-ERR Protocol error: invalid bulk length\r\n", line)
+	_, err = reader.ReadString('\n')
+	assert.NotNil(t, err)
+
+	assert.Equal(t, resp.MakeBulkData([]byte("1")), s.Exec(0, [][]byte{[]byte("get"), []byte("keep")}))
+}
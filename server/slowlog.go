@@ -56,7 +56,7 @@ func (sl *slowLog) appendEntry(command [][]byte, duration int64) {
 
 	ent := slowLogEntry{
 		id:        sl.nid,
-		timestamp: global.Now.Unix(),
+		timestamp: global.Now().Unix(),
 		duration:  duration,
 		command:   command,
 	}
@@ -9,7 +9,7 @@ import (
 
 func TestSlowLog(t *testing.T) {
 
-	now := global.Now
+	now := global.Now()
 
 	sl := newSlowLog(3)
 
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RunStartupFile 在接受连接之前执行 filename 中的命令，每一行是一个 inline 命令，或者是一个 RESP 数组的开始。
+// 空行以及 # 开头的行会被忽略，执行失败的命令会记录行号并继续执行。
+func (s *Server) RunStartupFile(filename string) {
+
+	if filename == "" {
+		return
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		logger.Error("Startup File:", err.Error())
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	client := NewFakeClient()
+
+	line := 0
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		line++
+		return strings.TrimRight(scanner.Text(), "\r"), true
+	}
+
+	for {
+		text, ok := next()
+		if !ok {
+			break
+		}
+		start := line
+
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// 将命令还原为以 CRLF 结尾的格式，交给 RESP 解析器处理
+		chunk := bytes.NewBufferString(text + resp.CRLF)
+		if text[0] == '*' {
+			n, err := strconv.Atoi(text[1:])
+			if err != nil {
+				logger.Errorf("Startup File: line %d: invalid multibulk length", start)
+				continue
+			}
+			for i := 0; i < 2*n; i++ {
+				if text, ok = next(); !ok {
+					break
+				}
+				chunk.WriteString(text + resp.CRLF)
+			}
+		}
+
+		parsed := resp.NewParser(chunk).Parse()
+		if parsed.Err != nil {
+			logger.Errorf("Startup File: line %d: %s", start, parsed.Err.Error())
+			continue
+		}
+
+		var cmd [][]byte
+		switch data := parsed.Data.(type) {
+		case *resp.PlainData:
+			cmd = data.ToCommand()
+		case *resp.ArrayData:
+			cmd = data.ToCommand()
+		default:
+			logger.Errorf("Startup File: line %d: not a command", start)
+			continue
+		}
+
+		ret, dirty := ExecCommand(s, client, cmd, nil)
+		if e, ok := ret.(*resp.ErrorData); ok {
+			logger.Errorf("Startup File: line %d: %s", start, e.ByteData())
+			continue
+		}
+		if dirty {
+			s.dirty.Add(1)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		logger.Error("Startup File:", err.Error())
+	}
+
+	logger.Infof("Startup File: executed %d lines from %s", line, filename)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db/structure"
+	"github.com/tangrc99/MemTable/logger"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRunStartupFile(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+	s.aofEnabled = false
+
+	filename := path.Join(t.TempDir(), "startup.txt")
+	content := "# 初始化数据\n" +
+		"set k1 v1\n" +
+		"\n" +
+		"*3\r\n$3\r\nset\r\n$2\r\nk2\r\n$5\r\nv 2 3\r\n" +
+		"rpush list a b c\n" +
+		// 错误的命令不会影响之后的命令
+		"incr k1\n" +
+		"nosuchcommand\n" +
+		"*x\n" +
+		"select 1\n" +
+		"set k3 v3\n"
+	assert.Nil(t, os.WriteFile(filename, []byte(content), 0666))
+
+	s.RunStartupFile(filename)
+
+	v, ok := s.dbs[0].GetKey("k1")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice("v1"), v)
+
+	v, ok = s.dbs[0].GetKey("k2")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice("v 2 3"), v)
+
+	v, ok = s.dbs[0].GetKey("list")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v.(*structure.List).Size())
+
+	assert.Equal(t, 3, s.dbs[0].Size())
+
+	v, ok = s.dbs[1].GetKey("k3")
+	assert.True(t, ok)
+	assert.Equal(t, structure.Slice("v3"), v)
+
+	// 不存在的文件只会记录错误
+	s.RunStartupFile(path.Join(t.TempDir(), "none.txt"))
+}
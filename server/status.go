@@ -3,10 +3,13 @@ package server
 import (
 	"fmt"
 	"github.com/tangrc99/MemTable/config"
+	"github.com/tangrc99/MemTable/resp"
 	"github.com/tangrc99/MemTable/server/global"
 	"github.com/tangrc99/MemTable/utils/sys_status"
 	"os"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,9 +29,19 @@ type Status struct {
 	maxClients       int
 
 	// Memory
-	usedMemory      int64
-	usedMemoryHuman float64
-	maxMemory       uint64
+	usedMemory        int64
+	usedMemoryHuman   float64
+	usedMemoryDataset int64 // 数据库中键值对占用的内存
+	maxMemory         uint64
+
+	// Stats
+	totalConnectionsReceived atomic.Int64 // 接收的连接总数
+	totalCommandsProcessed   atomic.Int64 // 执行的命令总数
+	rejectedConnections      atomic.Int64 // 因为客户端数量超过上限而拒绝的连接数
+	opsPerSec                instantaneousMetric
+
+	// Commandstats
+	commandStats map[string]*commandStat // 每一个命令的执行统计，只在事件循环中修改
 
 	// Replication
 	role            string
@@ -49,11 +62,13 @@ func NewStatus() *Status {
 		host:      config.Conf.Host,
 		tcpPort:   config.Conf.Port,
 		tlsPort:   config.Conf.TLSPort,
-		time:      global.Now,
+		time:      global.Now(),
 		startTime: time.Now(),
 
 		maxClients: config.Conf.MaxClients,
 		maxMemory:  config.Conf.MaxMemory,
+
+		commandStats: make(map[string]*commandStat),
 	}
 
 	s.UpdateSysStatus()
@@ -61,13 +76,85 @@ func NewStatus() *Status {
 	return s
 }
 
+// commandStat 记录一个命令的调用次数、累计耗时以及返回错误的次数
+type commandStat struct {
+	calls       int64
+	usec        int64
+	failedCalls int64
+}
+
+// recordCommand 记录一次命令的执行，不存在的命令不会被统计
+func (sts *Status) recordCommand(cmd [][]byte, cost time.Duration, res resp.RedisData) {
+	if len(cmd) == 0 {
+		return
+	}
+	// 重命名的命令使用原始名称统计
+	c, ok := global.FindCommand(strings.ToLower(string(cmd[0])))
+	if !ok {
+		return
+	}
+	stat, exist := sts.commandStats[c.Name()]
+	if !exist {
+		stat = &commandStat{}
+		sts.commandStats[c.Name()] = stat
+	}
+	stat.calls++
+	stat.usec += cost.Microseconds()
+	if _, failed := res.(*resp.ErrorData); failed {
+		stat.failedCalls++
+	}
+}
+
+// statsMetricSamples 是计算瞬时速率时使用的采样数量
+const statsMetricSamples = 16
+
+// instantaneousMetric 使用环形数组记录计数器最近的若干次采样速率，瞬时速率为这些采样的平均值
+type instantaneousMetric struct {
+	samples   [statsMetricSamples]float64
+	idx       int
+	lastTime  time.Time
+	lastCount int64
+}
+
+// track 记录一次计数器的采样，并计算与上一次采样之间的速率
+func (m *instantaneousMetric) track(now time.Time, count int64) {
+	if !m.lastTime.IsZero() {
+		rate := 0.0
+		if dt := now.Sub(m.lastTime).Seconds(); dt > 0 {
+			rate = float64(count-m.lastCount) / dt
+		}
+		m.samples[m.idx] = rate
+		m.idx = (m.idx + 1) % statsMetricSamples
+	}
+	m.lastTime = now
+	m.lastCount = count
+}
+
+// value 返回每秒的瞬时速率
+func (m *instantaneousMetric) value() int64 {
+	sum := 0.0
+	for _, sample := range m.samples {
+		sum += sample
+	}
+	return int64(sum / statsMetricSamples)
+}
+
+// trackMetrics 对计数器进行采样，需要由定时任务周期性调用
+func (s *Server) trackMetrics() {
+	s.sts.opsPerSec.track(time.Now(), s.sts.totalCommandsProcessed.Load())
+}
+
 func (s *Server) UpdateStatus() {
 	sts := s.sts
 
-	sts.time = global.Now
+	sts.time = global.Now()
 	sts.connectedClients = s.clis.Size()
 	sts.usedMemory = s.cost
 	sts.usedMemoryHuman = float64(s.cost / 1024 / 1024)
+	sts.usedMemoryDataset = 0
+	for _, d := range s.dbs {
+		sts.usedMemoryDataset += d.Cost()
+	}
 
 	sts.connectedSlaves = len(s.onLineSlaves)
 	sts.backlogSize = s.backLog.HighWaterLevel()
@@ -91,6 +178,7 @@ func (s *Server) Information(section string) string {
 		b.WriteString(fmt.Sprintf("host:%s\n", s.sts.host))
 		b.WriteString(fmt.Sprintf("tcp_port:%d\n", s.sts.tcpPort))
 		b.WriteString(fmt.Sprintf("tls_port:%d\n", s.sts.tlsPort))
+		b.WriteString(fmt.Sprintf("hz:%d\n", s.hz))
 		b.WriteString(fmt.Sprintf("server_time_us:%d\n", s.sts.time.UnixMicro()))
 		b.WriteString(fmt.Sprintf("start_time:%d\n", s.sts.time.Unix()-s.sts.startTime.Unix()))
 		b.WriteString(fmt.Sprintf("start_time_day:%d\n", (s.sts.time.Unix()-s.sts.startTime.Unix())/86400))
@@ -115,11 +203,79 @@ func (s *Server) Information(section string) string {
 		b.WriteString("# Memory\n")
 		b.WriteString(fmt.Sprintf("used_memory:%d\n", s.sts.usedMemory))
 		b.WriteString(fmt.Sprintf("used_memory_human:%.2fM\n", s.sts.usedMemoryHuman))
+		b.WriteString(fmt.Sprintf("used_memory_dataset:%d\n", s.sts.usedMemoryDataset))
 		b.WriteString(fmt.Sprintf("max_memory:%d\n", s.sts.maxMemory))
 		b.WriteString(fmt.Sprintf("used_memory_percent:%.2f%%\n", float64(s.sts.usedMemory)/float64(s.sts.maxMemory)))
 
 	}
 
+	if section == "" || section == "persistence" {
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("# Persistence\n")
+		b.WriteString(fmt.Sprintf("rdb_changes_since_last_save:%d\n", s.dirty.Load()))
+		b.WriteString(fmt.Sprintf("rdb_bgsave_in_progress:%d\n", boolToInt(s.bgsaveInProgress.Load())))
+		b.WriteString(fmt.Sprintf("rdb_last_save_time:%d\n", s.lastSave.Load()))
+		b.WriteString(fmt.Sprintf("rdb_last_bgsave_status:%s\n", statusString(!s.lastBgsaveFailed.Load())))
+		b.WriteString(fmt.Sprintf("aof_enabled:%d\n", boolToInt(s.aofEnabled)))
+		b.WriteString(fmt.Sprintf("aof_last_write_status:%s\n", statusString(s.aof == nil || s.aof.lastWriteOK())))
+	}
+
+	if section == "" || section == "stats" {
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("# Stats\n")
+		b.WriteString(fmt.Sprintf("total_connections_received:%d\n", s.sts.totalConnectionsReceived.Load()))
+		b.WriteString(fmt.Sprintf("total_commands_processed:%d\n", s.sts.totalCommandsProcessed.Load()))
+		b.WriteString(fmt.Sprintf("instantaneous_ops_per_sec:%d\n", s.sts.opsPerSec.value()))
+		b.WriteString(fmt.Sprintf("rejected_connections:%d\n", s.sts.rejectedConnections.Load()))
+		hits, misses := int64(0), int64(0)
+		for _, dataBase := range s.dbs {
+			h, m := dataBase.KeyspaceStats()
+			hits, misses = hits+h, misses+m
+		}
+		b.WriteString(fmt.Sprintf("keyspace_hits:%d\n", hits))
+		b.WriteString(fmt.Sprintf("keyspace_misses:%d\n", misses))
+	}
+
+	// 与 redis 相同，只有明确指定时才返回命令统计
+	if section == "commandstats" {
+
+		names := make([]string, 0, len(s.sts.commandStats))
+		for name := range s.sts.commandStats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		b.WriteString("# Commandstats\n")
+		for _, name := range names {
+			stat := s.sts.commandStats[name]
+			b.WriteString(fmt.Sprintf("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,failed_calls=%d\n",
+				name, stat.calls, stat.usec, float64(stat.usec)/float64(stat.calls), stat.failedCalls))
+		}
+	}
+
+	if section == "" || section == "replication" {
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		// 与 redis 相同，单机模式视为没有从节点的主节点
+		role := "master"
+		if s.role == Slave {
+			role = "slave"
+		}
+		b.WriteString("# Replication\n")
+		b.WriteString(fmt.Sprintf("role:%s\n", role))
+		b.WriteString(fmt.Sprintf("connected_slaves:%d\n", len(s.onLineSlaves)))
+		b.WriteString(fmt.Sprintf("master_replid:%s\n", s.runID))
+		b.WriteString(fmt.Sprintf("master_repl_offset:%d\n", s.offset))
+	}
+
 	if section == "" || section == "system" {
 
 		if b.Len() > 0 {
@@ -136,3 +292,18 @@ func (s *Server) Information(section string) string {
 
 	return b.String()
 }
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// statusString 返回 info 中表示操作结果的字符串
+func statusString(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "err"
+}
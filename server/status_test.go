@@ -0,0 +1,195 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/db"
+	"github.com/tangrc99/MemTable/server/global"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// infoField 返回 info 中字段的整数值，字段不存在时返回 -1
+func infoField(info, field string) int64 {
+	matched := regexp.MustCompile(`(?m)^` + field + `:(\d+)$`).FindStringSubmatch(info)
+	if len(matched) != 2 {
+		return -1
+	}
+	n, _ := strconv.ParseInt(matched[1], 10, 64)
+	return n
+}
+
+func TestInstantaneousMetric(t *testing.T) {
+
+	m := instantaneousMetric{}
+	now := time.Now()
+
+	// 第一次采样只记录计数器
+	m.track(now, 100)
+	assert.Equal(t, int64(0), m.value())
+
+	// 每 100ms 执行 50 条命令，速率为 500/s
+	count := int64(100)
+	for i := 1; i <= statsMetricSamples; i++ {
+		count += 50
+		m.track(now.Add(time.Duration(i)*100*time.Millisecond), count)
+	}
+	assert.Equal(t, int64(500), m.value())
+
+	// 旧的采样会被覆盖
+	for i := 1; i <= statsMetricSamples; i++ {
+		m.track(now.Add(time.Duration(statsMetricSamples+i)*100*time.Millisecond), count)
+	}
+	assert.Equal(t, int64(0), m.value())
+}
+
+func TestInfoStats(t *testing.T) {
+	s := newExecServer(t)
+
+	info := execString(s, "info", "stats")
+	assert.Contains(t, info, "# Stats")
+	assert.NotContains(t, info, "# Memory")
+	before := infoField(info, "total_commands_processed")
+	assert.True(t, before >= 1)
+	assert.Equal(t, int64(0), infoField(info, "instantaneous_ops_per_sec"))
+	assert.Equal(t, int64(0), infoField(info, "rejected_connections"))
+
+	// 持续执行命令，直到定时任务完成若干次采样
+	n := int64(0)
+	start := time.Now()
+	for time.Since(start) < 5*global.TEStatsSample {
+		execString(s, "set", "k", strconv.FormatInt(n, 10))
+		n++
+	}
+	elapsed := time.Since(start).Seconds()
+
+	info = execString(s, "info", "stats")
+	// 包括两次 info 命令本身
+	assert.Equal(t, before+n+1, infoField(info, "total_commands_processed"))
+	// 瞬时速率不会超过实际的平均速率
+	ops := infoField(info, "instantaneous_ops_per_sec")
+	assert.True(t, ops > 0)
+	assert.True(t, float64(ops) <= float64(n+1)/elapsed*2)
+
+	// 新的连接会被计数
+	server, client := net.Pipe()
+	defer client.Close()
+	go s.handleRead(server)
+	assert.Eventually(t, func() bool {
+		return infoField(execString(s, "info", "stats"), "total_connections_received") == 1
+	}, time.Second, 10*time.Millisecond)
+	// 只读命令统计键的命中情况
+	execString(s, "get", "k")
+	execString(s, "get", "none")
+	execString(s, "set", "none2", "v")
+	info = execString(s, "info", "stats")
+	assert.Equal(t, int64(1), infoField(info, "keyspace_hits"))
+	assert.Equal(t, int64(1), infoField(info, "keyspace_misses"))
+
+	// 命令统计只有明确指定时才返回
+	assert.NotContains(t, info, "cmdstat_")
+	execString(s, "hget", "k", "f")
+	info = execString(s, "info", "commandstats")
+	assert.Contains(t, info, "# Commandstats\n")
+	assert.Regexp(t, regexp.MustCompile(`(?m)^cmdstat_get:calls=2,usec=\d+,usec_per_call=\d+\.\d{2},failed_calls=0$`), info)
+	assert.Contains(t, info, "cmdstat_hget:calls=1,")
+	assert.Regexp(t, regexp.MustCompile(`(?m)^cmdstat_hget:.*,failed_calls=1$`), info)
+}
+
+func TestInfoPersistence(t *testing.T) {
+	s := newExecServer(t)
+
+	execString(s, "set", "a", "1")
+	execString(s, "set", "b", "2")
+
+	info := execString(s, "info", "persistence")
+	assert.Contains(t, info, "# Persistence")
+	assert.NotContains(t, info, "# Stats")
+	assert.Equal(t, int64(2), infoField(info, "rdb_changes_since_last_save"))
+	assert.Equal(t, int64(0), infoField(info, "rdb_bgsave_in_progress"))
+	assert.Equal(t, int64(0), infoField(info, "aof_enabled"))
+	assert.Contains(t, info, "rdb_last_bgsave_status:ok\n")
+	assert.Contains(t, info, "aof_last_write_status:ok\n")
+
+	// save 完成后脏数据计数器清零，并更新保存时间
+	before := time.Now().Unix()
+	assert.Equal(t, "OK", execString(s, "save"))
+	info = execString(s, "info", "persistence")
+	assert.Equal(t, int64(0), infoField(info, "rdb_changes_since_last_save"))
+	assert.GreaterOrEqual(t, infoField(info, "rdb_last_save_time"), before)
+
+	// 模拟一次耗时并且失败的 bgsave
+	release := make(chan struct{})
+	rdbWriter = func(string, map[string]string, []*db.Snapshot) bool {
+		<-release
+		return false
+	}
+
+	execString(s, "set", "c", "3")
+	assert.Equal(t, "Background saving started", execString(s, "bgsave"))
+	info = execString(s, "info", "persistence")
+	assert.Equal(t, int64(1), infoField(info, "rdb_bgsave_in_progress"))
+	assert.Equal(t, int64(1), infoField(info, "rdb_changes_since_last_save"))
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return infoField(execString(s, "info", "persistence"), "rdb_bgsave_in_progress") == 0
+	}, time.Second, 10*time.Millisecond)
+	info = execString(s, "info", "persistence")
+	assert.Contains(t, info, "rdb_last_bgsave_status:err\n")
+	assert.GreaterOrEqual(t, infoField(info, "rdb_last_save_time"), before)
+	// 失败时修改仍然没有被保存
+	assert.Equal(t, int64(1), infoField(info, "rdb_changes_since_last_save"))
+
+	// 成功时只减去快照中包含的修改，写入期间的修改会保留
+	release = make(chan struct{})
+	rdbWriter = func(string, map[string]string, []*db.Snapshot) bool {
+		<-release
+		return true
+	}
+	assert.Equal(t, "Background saving started", execString(s, "bgsave"))
+	execString(s, "set", "d", "4")
+	close(release)
+	assert.Eventually(t, func() bool {
+		return infoField(execString(s, "info", "persistence"), "rdb_bgsave_in_progress") == 0
+	}, time.Second, 10*time.Millisecond)
+	rdbWriter = writeRDB
+	info = execString(s, "info", "persistence")
+	assert.Contains(t, info, "rdb_last_bgsave_status:ok\n")
+	assert.Equal(t, int64(1), infoField(info, "rdb_changes_since_last_save"))
+}
+
+func TestInfoReplication(t *testing.T) {
+	s := newExecServer(t)
+	s.debugEnabled = true
+
+	info := execString(s, "info", "replication")
+	assert.Contains(t, info, "# Replication")
+	assert.Contains(t, info, "role:master\n")
+	assert.Equal(t, int64(0), infoField(info, "connected_slaves"))
+	assert.Equal(t, int64(0), infoField(info, "master_repl_offset"))
+	replID := regexp.MustCompile(`master_replid:([0-9a-f]{40})\n`).FindStringSubmatch(info)
+	assert.Len(t, replID, 2)
+
+	// offset 按照传播的写命令长度增加，读命令以及失败的写命令不会传播
+	execString(s, "set", "key", "value")
+	offset := int64(len("*3\r\n$3\r\nset\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"))
+	assert.Equal(t, offset, infoField(execString(s, "info", "replication"), "master_repl_offset"))
+
+	execString(s, "get", "key")
+	execString(s, "incr", "key")
+	assert.Equal(t, offset, infoField(execString(s, "info", "replication"), "master_repl_offset"))
+
+	execString(s, "del", "key")
+	offset += int64(len("*2\r\n$3\r\ndel\r\n$3\r\nkey\r\n"))
+	assert.Equal(t, offset, infoField(execString(s, "info", "replication"), "master_repl_offset"))
+
+	// 更换 replication id 不会影响 offset
+	assert.Equal(t, "OK", execString(s, "debug", "change-repl-id"))
+	info = execString(s, "info", "replication")
+	assert.NotContains(t, info, "master_replid:"+replID[1])
+	assert.Regexp(t, `master_replid:[0-9a-f]{40}\n`, info)
+	assert.Equal(t, offset, infoField(info, "master_repl_offset"))
+}
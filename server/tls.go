@@ -0,0 +1,50 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+// newTLSConfig 使用服务端证书和私钥创建 tls 配置。caFile 为空时不会验证客户端证书，
+// 否则 authClients 为 true 时强制要求客户端提供由 caFile 签发的证书，为 false 时只在客户端提供证书时进行验证
+func newTLSConfig(certFile, keyFile, caFile string, authClients bool) (*tls.Config, error) {
+
+	// 载入服务端证书和私钥
+	srvCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{srvCert},
+		ClientAuth:   tls.NoClientCert,
+	}
+
+	if caFile == "" {
+		if authClients {
+			return nil, errors.New("tls-ca-cert-file is required to authenticate clients")
+		}
+		return cfg, nil
+	}
+
+	// 载入根证书，用于客户端验证
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	caCertPool := x509.NewCertPool()
+	if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
+		return nil, errors.New("parse cert error, file: " + caFile)
+	}
+	cfg.ClientCAs = caCertPool
+
+	if authClients {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/config"
+	"github.com/tangrc99/MemTable/logger"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert 生成一个同时可用于服务端和客户端的自签名证书
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, cert tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "memtable"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	certFile = path.Join(dir, "cert.pem")
+	keyFile = path.Join(dir, "key.pem")
+	assert.Nil(t, os.WriteFile(certFile, certPem, 0600))
+	assert.Nil(t, os.WriteFile(keyFile, keyPem, 0600))
+
+	cert, err = tls.X509KeyPair(certPem, keyPem)
+	assert.Nil(t, err)
+	return certFile, keyFile, cert
+}
+
+func TestServerTLS(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeSelfSignedCert(t, dir)
+
+	old := config.Conf
+	defer func() { config.Conf = old }()
+	config.Conf.CertFile = certFile
+	config.Conf.KeyFile = keyFile
+	config.Conf.CaCertFile = certFile
+	config.Conf.AuthClient = true
+
+	s := NewServer()
+	s.url = ""
+	s.dir = dir
+	s.aofEnabled = false
+	s.tlsUrl = "127.0.0.1:0"
+
+	go s.eventLoop()
+	assert.Nil(t, s.listen())
+	addr := s.tlsListener.Addr().String()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	ping := func(cfg *tls.Config) (string, error) {
+		conn, err := tls.Dial("tcp", addr, cfg)
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		if _, err = conn.Write([]byte("*1\r\n$4\r\nping\r\n")); err != nil {
+			return "", err
+		}
+		return bufio.NewReader(conn).ReadString('\n')
+	}
+
+	line, err := ping(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}})
+	assert.Nil(t, err)
+	assert.Equal(t, "+pong\r\n", line)
+
+	// 开启客户端验证时，没有证书的客户端无法建立连接
+	_, err = ping(&tls.Config{RootCAs: roots})
+	assert.NotNil(t, err)
+
+	s.quit.Store(true)
+	<-s.quitFlag
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile, _ := writeSelfSignedCert(t, t.TempDir())
+
+	cfg, err := newTLSConfig(certFile, keyFile, "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+
+	_, err = newTLSConfig(certFile, keyFile, "", true)
+	assert.NotNil(t, err)
+
+	cfg, err = newTLSConfig(certFile, keyFile, certFile, false)
+	assert.Nil(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+
+	cfg, err = newTLSConfig(certFile, keyFile, certFile, true)
+	assert.Nil(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	_, err = newTLSConfig(certFile, "none", "", false)
+	assert.NotNil(t, err)
+}
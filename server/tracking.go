@@ -0,0 +1,256 @@
+package server
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"github.com/tangrc99/MemTable/server/global"
+	"strings"
+)
+
+// trackingChannel 是 REDIRECT 到 RESP2 客户端时失效消息使用的频道，与 redis 相同
+const trackingChannel = "__redis__:invalidate"
+
+// trackingState 是客户端的 client tracking 设置
+type trackingState struct {
+	on       bool
+	bcast    bool      // 广播模式
+	redirect uuid.UUID // 失效消息的接收者，为空时发送给客户端本身
+	prefixes []string  // 广播模式下关注的键前缀，空字符串匹配全部的键
+}
+
+// tracker 记录开启了 client tracking 的客户端。默认模式下记录客户端读取过的键，键被修改时只通知一次；
+// 广播模式下不记录读取的键，匹配前缀的键每次被修改时都会通知
+type tracker struct {
+	clients  map[*Client]struct{}            // 开启了 tracking 的客户端
+	keys     map[string]map[*Client]struct{} // 默认模式下，每一个键被哪些客户端读取过
+	prefixes map[string]map[*Client]struct{} // 广播模式下，每一个前缀被哪些客户端关注
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		clients:  make(map[*Client]struct{}),
+		keys:     make(map[string]map[*Client]struct{}),
+		prefixes: make(map[string]map[*Client]struct{}),
+	}
+}
+
+// enable 为客户端开启 tracking，已经开启时会追加新的前缀
+func (t *tracker) enable(cli *Client, state trackingState) {
+
+	prefixes := state.prefixes
+	if state.bcast && len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	for _, prefix := range prefixes {
+		if t.prefixes[prefix] == nil {
+			t.prefixes[prefix] = make(map[*Client]struct{})
+		}
+		t.prefixes[prefix][cli] = struct{}{}
+	}
+
+	state.prefixes = prefixes
+	if cli.tracking.on {
+		state.prefixes = append(cli.tracking.prefixes, state.prefixes...)
+	}
+	cli.tracking = state
+	t.clients[cli] = struct{}{}
+}
+
+// disable 为客户端关闭 tracking。默认模式下读取过的键不会立即删除，在键被修改时再清理
+func (t *tracker) disable(cli *Client) {
+
+	if !cli.tracking.on {
+		return
+	}
+
+	for _, prefix := range cli.tracking.prefixes {
+		delete(t.prefixes[prefix], cli)
+		if len(t.prefixes[prefix]) == 0 {
+			delete(t.prefixes, prefix)
+		}
+	}
+
+	delete(t.clients, cli)
+	cli.tracking = trackingState{}
+}
+
+// remember 记录默认模式的客户端读取过的键
+func (t *tracker) remember(cli *Client, keys []string) {
+	for _, key := range keys {
+		if t.keys[key] == nil {
+			t.keys[key] = make(map[*Client]struct{})
+		}
+		t.keys[key][cli] = struct{}{}
+	}
+}
+
+// invalidate 通知关注了这些键的客户端，多个键的失效消息会合并发送
+func (t *tracker) invalidate(server *Server, keys []string) {
+
+	notified := make(map[*Client][]string)
+
+	for _, key := range keys {
+
+		for cli := range t.keys[key] {
+			if cli.tracking.on && !cli.tracking.bcast {
+				notified[cli] = append(notified[cli], key)
+			}
+		}
+		delete(t.keys, key)
+
+		for prefix, clients := range t.prefixes {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			for cli := range clients {
+				notified[cli] = append(notified[cli], key)
+			}
+		}
+	}
+
+	for cli, keys := range notified {
+		data := make([]resp.RedisData, len(keys))
+		for i := range keys {
+			data[i] = resp.MakeBulkData([]byte(keys[i]))
+		}
+		t.send(server, cli, resp.MakeArrayData(data))
+	}
+}
+
+// invalidateAll 在 flushdb 和 flushall 之后通知全部的客户端，失效的键为 null
+func (t *tracker) invalidateAll(server *Server) {
+	t.keys = make(map[string]map[*Client]struct{})
+	for cli := range t.clients {
+		t.send(server, cli, resp.MakeArrayData(nil))
+	}
+}
+
+// send 将失效消息发送给客户端或者 REDIRECT 的目标客户端。RESP3 客户端使用 push 消息，
+// RESP2 客户端使用 trackingChannel 频道的订阅消息，没有 REDIRECT 的 RESP2 客户端无法接收失效消息
+func (t *tracker) send(server *Server, cli *Client, keys resp.RedisData) {
+
+	// 被关闭的客户端不一定经过 shutdownClient，在这里清理
+	if cli.getStatus() == EXIT {
+		t.disable(cli)
+		return
+	}
+
+	target := cli
+	if cli.tracking.redirect != uuid.Nil {
+		node, ok := server.clis.UUIDSet[cli.tracking.redirect]
+		if !ok {
+			return
+		}
+		target = node.Value.(*Client)
+	}
+
+	var msg resp.RedisData
+	if target.protocol == 3 {
+		msg = resp.MakePushData([]resp.RedisData{resp.MakeBulkData([]byte("invalidate")), keys})
+	} else if target != cli {
+		msg = resp.MakeArrayData([]resp.RedisData{
+			resp.MakeBulkData([]byte("message")), resp.MakeBulkData([]byte(trackingChannel)), keys,
+		})
+	} else {
+		return
+	}
+
+	// 不能阻塞事件循环
+	select {
+	case target.res <- &msg:
+	default:
+		logger.Warning("Client", target.addr, "Tracking Invalidation Dropped")
+	}
+}
+
+// trackCommand 在命令执行之后更新 tracking 信息：写命令修改的键会通知关注的客户端，
+// 默认模式的客户端执行读命令时会记录读取的键
+func (s *Server) trackCommand(c global.Command, cli *Client, cmds [][]byte, ret resp.RedisData) {
+
+	if len(s.tracking.clients) == 0 {
+		return
+	}
+	if _, failed := ret.(*resp.ErrorData); failed {
+		return
+	}
+
+	if c.Name() == "flushdb" || c.Name() == "flushall" {
+		s.tracking.invalidateAll(s)
+		return
+	}
+
+	if c.IsWriteCommand() {
+		s.tracking.invalidate(s, commandKeys(c, cmds))
+	} else if cli.tracking.on && !cli.tracking.bcast {
+		s.tracking.remember(cli, commandKeys(c, cmds))
+	}
+}
+
+// clientTracking 命令格式： client tracking on|off [redirect id] [bcast] [prefix prefix ...]
+func clientTracking(server *Server, cli *Client, cmd [][]byte) resp.RedisData {
+
+	if len(cmd) < 3 {
+		return resp.WrongArgsError("client|tracking")
+	}
+
+	on := false
+	switch strings.ToLower(string(cmd[2])) {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return resp.SyntaxError()
+	}
+
+	state := trackingState{on: true}
+	for i := 3; i < len(cmd); i++ {
+		switch strings.ToLower(string(cmd[i])) {
+		case "redirect":
+			if i+1 >= len(cmd) {
+				return resp.SyntaxError()
+			}
+			id, err := uuid.FromString(string(cmd[i+1]))
+			if err != nil {
+				return resp.MakeErrorData("ERR The client ID you want redirect to does not exist")
+			}
+			if _, ok := server.clis.UUIDSet[id]; !ok && id != cli.id {
+				return resp.MakeErrorData("ERR The client ID you want redirect to does not exist")
+			}
+			// 重定向到自身等同于不重定向
+			if id != cli.id {
+				state.redirect = id
+			}
+			i++
+		case "bcast":
+			state.bcast = true
+		case "prefix":
+			if i+1 >= len(cmd) {
+				return resp.SyntaxError()
+			}
+			state.prefixes = append(state.prefixes, string(cmd[i+1]))
+			i++
+		default:
+			return resp.SyntaxError()
+		}
+	}
+
+	if !on {
+		server.tracking.disable(cli)
+		return resp.MakeStringData("OK")
+	}
+
+	if len(state.prefixes) > 0 && !state.bcast {
+		return resp.MakeErrorData("ERR PREFIX option requires BCAST mode to be enabled")
+	}
+	if cli.tracking.on && cli.tracking.bcast != state.bcast {
+		return resp.MakeErrorData("ERR You can't switch BCAST mode on/off before disabling tracking " +
+			"for this client, and then re-enabling it with a different mode.")
+	}
+	if cli.protocol != 3 && state.redirect == uuid.Nil {
+		return resp.MakeErrorData("ERR Client tracking in RESP2 requires REDIRECT to a client subscribed to " + trackingChannel)
+	}
+
+	server.tracking.enable(cli, state)
+	return resp.MakeStringData("OK")
+}
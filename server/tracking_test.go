@@ -0,0 +1,98 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/tangrc99/MemTable/logger"
+	"github.com/tangrc99/MemTable/resp"
+	"testing"
+)
+
+func TestClientTracking(t *testing.T) {
+	_ = logger.Init("", "", logger.WARNING)
+
+	s := NewServer()
+
+	// pushed 返回客户端收到的全部失效消息
+	pushed := func(cli *Client) []string {
+		msgs := make([]string, 0)
+		for {
+			select {
+			case msg := <-cli.res:
+				msgs = append(msgs, string((*msg).ToBytes()))
+			default:
+				return msgs
+			}
+		}
+	}
+
+	tracker := NewFakeClient()
+	tracker.protocol = 3
+	writer := NewFakeClient()
+	s.clis.AddClientIfNotExist(tracker)
+	s.clis.AddClientIfNotExist(writer)
+
+	// 广播模式下，匹配前缀的键每次修改都会收到 push 消息
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, tracker, "client", "tracking", "on", "bcast", "prefix", "user:"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, writer, "set", "user:1", "a"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, writer, "set", "order:1", "a"))
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, writer, "mset", "user:1", "a", "order:2", "b", "user:2", "c"))
+	assert.Equal(t, []string{
+		">2\r\n$10\r\ninvalidate\r\n*1\r\n$6\r\nuser:1\r\n",
+		">2\r\n$10\r\ninvalidate\r\n*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n",
+	}, pushed(tracker))
+
+	// 只读命令以及执行失败的命令不会通知
+	execCmd(s, writer, "set", "user:1", "a")
+	assert.Len(t, pushed(tracker), 1)
+	execCmd(s, writer, "get", "user:1")
+	assert.Equal(t, resp.MakeErrorData("ERR value is not an integer or out of range"), execCmd(s, writer, "incr", "user:1"))
+	assert.Empty(t, pushed(tracker))
+
+	// flushdb 会通知全部的客户端，失效的键为 null
+	execCmd(s, writer, "flushdb")
+	assert.Equal(t, []string{">2\r\n$10\r\ninvalidate\r\n*-1\r\n"}, pushed(tracker))
+
+	// 关闭之后不会再收到消息
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, tracker, "client", "tracking", "off"))
+	execCmd(s, writer, "set", "user:1", "a")
+	assert.Empty(t, pushed(tracker))
+	assert.Empty(t, s.tracking.prefixes)
+
+	// 默认模式下只有读取过的键会通知，并且只通知一次
+	assert.Equal(t, resp.MakeStringData("OK"), execCmd(s, tracker, "client", "tracking", "on"))
+	execCmd(s, tracker, "get", "user:1")
+	execCmd(s, writer, "set", "user:2", "b")
+	assert.Empty(t, pushed(tracker))
+	execCmd(s, writer, "set", "user:1", "b")
+	execCmd(s, writer, "set", "user:1", "c")
+	assert.Equal(t, []string{">2\r\n$10\r\ninvalidate\r\n*1\r\n$6\r\nuser:1\r\n"}, pushed(tracker))
+	assert.Equal(t, resp.MakeErrorData("ERR You can't switch BCAST mode on/off before disabling tracking "+
+		"for this client, and then re-enabling it with a different mode."), execCmd(s, tracker, "client", "tracking", "on", "bcast"))
+	execCmd(s, tracker, "client", "tracking", "off")
+
+	// RESP2 客户端需要 REDIRECT 到订阅了失效频道的客户端
+	legacy := NewFakeClient()
+	s.clis.AddClientIfNotExist(legacy)
+	subscriber := NewFakeClient()
+	s.clis.AddClientIfNotExist(subscriber)
+	execCmd(s, subscriber, "subscribe", trackingChannel)
+
+	assert.Equal(t, resp.MakeErrorData("ERR Client tracking in RESP2 requires REDIRECT to a client subscribed to "+trackingChannel),
+		execCmd(s, legacy, "client", "tracking", "on", "bcast"))
+	assert.Equal(t, resp.MakeErrorData("ERR The client ID you want redirect to does not exist"),
+		execCmd(s, legacy, "client", "tracking", "on", "bcast", "redirect", "1"))
+	assert.Equal(t, resp.MakeErrorData("ERR PREFIX option requires BCAST mode to be enabled"),
+		execCmd(s, legacy, "client", "tracking", "on", "redirect", subscriber.id.String(), "prefix", "user:"))
+	assert.Equal(t, resp.MakeStringData("OK"),
+		execCmd(s, legacy, "client", "tracking", "on", "redirect", subscriber.id.String(), "bcast", "prefix", "user:"))
+
+	execCmd(s, writer, "set", "user:3", "a")
+	assert.Empty(t, pushed(legacy))
+	assert.Equal(t, []string{"*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$6\r\nuser:3\r\n"}, pushed(subscriber))
+
+	// RESET 会关闭 tracking
+	execCmd(s, legacy, "reset")
+	execCmd(s, writer, "set", "user:3", "b")
+	assert.Empty(t, pushed(subscriber))
+	assert.Empty(t, s.tracking.clients)
+}
@@ -37,7 +37,7 @@ func (s *Server) checkAndEvictClientsIfNeeded() (allowed bool) {
 	}
 
 	// 如果超出协程上限，尝试淘汰一个客户端
-	if sz >= 2*s.gopool.Maximum() {
+	if s.gopool != nil && sz >= 2*s.gopool.Maximum() {
 		s.clis.RemoveLongNotUsed(1, 5, time.Second)
 		return 2*s.gopool.Maximum()-s.clis.Size() >= 1
 	}
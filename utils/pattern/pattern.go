@@ -0,0 +1,111 @@
+// Package pattern 实现了与 redis 相同的 glob 风格的字符串匹配
+package pattern
+
+// maxNesting 是 * 的最大递归深度，超过时视为不匹配，防止恶意的模式耗尽栈空间
+const maxNesting = 1000
+
+// Match 判断 s 是否匹配 pattern，语义与 redis 的 stringmatchlen 相同：
+// * 匹配任意数量的字符，? 匹配一个字符，[abc]、[a-z] 匹配集合中的一个字符，[^...] 匹配集合以外的一个字符，
+// \ 用于转义下一个字符。没有闭合的 [ 会将剩余的部分作为字符集合
+func Match(pattern, s []byte) bool {
+	skipLonger := false
+	return match(pattern, s, &skipLonger, 0)
+}
+
+// match 是 Match 的递归实现。当 * 之后的部分无法从 s 的任意位置开始匹配时，skipLonger 会被设置为 true，
+// 此时外层的 * 匹配更长的子串也不可能成功，可以直接返回，避免指数级的回溯
+func match(pattern, s []byte, skipLonger *bool, nesting int) bool {
+
+	if nesting > maxNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(s) > 0 {
+
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(s) > 0 {
+				if match(pattern[1:], s, skipLonger, nesting+1) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+				s = s[1:]
+			}
+			*skipLonger = true
+			return false
+
+		case '?':
+			s = s[1:]
+
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 {
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == s[0] {
+						matched = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end := pattern[0], pattern[2]
+					if start > end {
+						start, end = end, start
+					}
+					if s[0] >= start && s[0] <= end {
+						matched = true
+					}
+					pattern = pattern[2:]
+				} else if pattern[0] == s[0] {
+					matched = true
+				}
+				pattern = pattern[1:]
+			}
+			if not {
+				matched = !matched
+			}
+			if !matched {
+				return false
+			}
+			s = s[1:]
+
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+		}
+
+		// 没有闭合的 [ 已经消耗了全部的模式
+		if len(pattern) > 0 {
+			pattern = pattern[1:]
+		}
+		if len(s) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+
+	return len(pattern) == 0 && len(s) == 0
+}
@@ -0,0 +1,94 @@
+package pattern
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+
+	tests := []struct {
+		pattern string
+		s       string
+		matched bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"a", "", false},
+		// 与 redis 相同，空字符串不匹配任何非空的模式
+		{"*", "", false},
+		{"*", "hello", true},
+		{"h*o", "hello", true},
+		{"h*o", "ho", true},
+		{"h*o", "hell", false},
+		{"h*", "h", true},
+		{"**a", "a", true},
+		{"a**", "a", true},
+		{"*a", "ba", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "aXbY", false},
+		{"*llo*", "hello world", true},
+
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"??", "ab", true},
+		{"??", "abc", false},
+
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h[b-a]llo", "hallo", true},
+		{"[a-c-e]", "d", false},
+		{"[a-c-e]", "-", true},
+		{"[^a-z]", "A", true},
+		{"[^a-z]", "m", false},
+		{"[\\]]", "]", true},
+		{"[\\-]", "-", true},
+		{"[\\^a]", "^", true},
+		{"[]a]", "a", false},
+		{"[a-]", "_", true},
+		{"[a-]", "-", false},
+		// 没有闭合的 [ 会将剩余的部分作为字符集合
+		{"[abc", "a", true},
+		{"[abc", "d", false},
+		{"a[", "a[", false},
+		{"[^", "a", true},
+
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"h\\?llo", "h?llo", true},
+		{"h\\[a\\]", "h[a]", true},
+		{"\\a", "a", true},
+		{"a\\", "a\\", true},
+		{"a\\\\", "a\\", true},
+
+		{"user:*:name", "user:1000:name", true},
+		{"user:*:name", "user:1000:age", false},
+		{"*", "\x00\xff", true},
+		{"?", "\xff", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.matched, Match([]byte(test.pattern), []byte(test.s)), "%q %q", test.pattern, test.s)
+	}
+}
+
+func TestMatchBacktracking(t *testing.T) {
+
+	// 多个 * 不会导致指数级的回溯
+	start := time.Now()
+	s := []byte(strings.Repeat("a", 50000))
+	assert.False(t, Match([]byte(strings.Repeat("a*", 50)+"b"), s))
+	assert.True(t, Match([]byte(strings.Repeat("a*", 50)+"a"), s))
+	assert.Less(t, time.Since(start), time.Second)
+
+	// 递归过深时视为不匹配
+	assert.False(t, Match([]byte(strings.Repeat("*a", 2*maxNesting)), []byte(strings.Repeat("a", 2*maxNesting))))
+}
@@ -1,6 +1,29 @@
 package readline
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+// Command 是解析后的一行命令
+type Command struct {
+	Name string   // 大写的命令名称
+	Args [][]byte // 命令参数，引号已经被去除
+	Raw  []byte   // 用户输入的原始内容
+}
+
+// ParseCommand 将一行输入解析为 Command，如果输入为空，Name == ""
+func ParseCommand(raw []byte) Command {
+	args := SplitRepeatableSeg(raw, ' ')
+	if len(args) == 0 {
+		return Command{Raw: raw}
+	}
+	return Command{
+		Name: strings.ToUpper(string(args[0])),
+		Args: args[1:],
+		Raw:  raw,
+	}
+}
 
 // InternalCommand 是可以被注册在 Terminal 中的命令。如果输入匹配命令，则会直接执行命令，而不会返回 line。
 // args[0] 是 command name, args[1:] 是输入参数
@@ -13,11 +36,14 @@ func commandHelp(_ *Terminal, _ [][]byte) {
 
 	fmt.Printf("This is default helper.\n\n")
 
+	fmt.Printf(format, "[control]+[C]", "cancel current line, press twice to quit.")
 	fmt.Printf(format, "[control]+[R]", "enter search mode or search.")
 	fmt.Printf(format, "[TAB]", "enter completion mode.")
 	fmt.Printf(format, "[LEFT]/[RIGHT]", "select completion.")
 	fmt.Printf(format, "[UP]/[DOWN]", "select history command.")
 	fmt.Printf(format, "[ESC]+[ESC]", "quit search or completion mode.")
+	fmt.Printf(format, "[control]+[]]", "jump to the matching quote or bracket.")
+	fmt.Printf(format, "!!, !n, !prefix", "run previous, nth or latest matched history command.")
 
 	fmt.Printf(format, "\"help\"", "show this helper.")
 	fmt.Printf(format, "\"quit\"", "quit.")
@@ -31,7 +57,7 @@ func commandQuit(t *Terminal, _ [][]byte) {
 func commandHistory(t *Terminal, _ [][]byte) {
 	h := t.histories.histories()
 	for i := range h {
-		fmt.Printf("%s\n", h[i])
+		fmt.Printf("%5d  %s\n", len(h)-i, h[i])
 	}
 }
 
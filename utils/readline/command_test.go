@@ -0,0 +1,25 @@
+package readline
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+
+	tests := []struct {
+		input    string
+		expected Command
+	}{
+		{"get key", Command{"GET", [][]byte{[]byte("key")}, []byte("get key")}},
+		{"  Set  key   value ", Command{"SET", [][]byte{[]byte("key"), []byte("value")}, []byte("  Set  key   value ")}},
+		{`set key "hello world"`, Command{"SET", [][]byte{[]byte("key"), []byte("hello world")}, []byte(`set key "hello world"`)}},
+		{`"client" list`, Command{"CLIENT", [][]byte{[]byte("list")}, []byte(`"client" list`)}},
+		{"ping", Command{"PING", [][]byte{}, []byte("ping")}},
+		{"   ", Command{"", nil, []byte("   ")}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, ParseCommand([]byte(test.input)), test.input)
+	}
+}
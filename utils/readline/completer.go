@@ -3,6 +3,7 @@ package readline
 import (
 	"github.com/tangrc99/MemTable/db/structure"
 	"strings"
+	"sync"
 )
 
 type Hint struct {
@@ -21,30 +22,72 @@ func (h *Hint) Cost() int64 {
 	return int64(len(h.name) + len(h.helper))
 }
 
-// Completer 是基于前缀树的单词补足结构体
+// Completer 是基于前缀树的单词补足结构体，注册和查询可以在不同的 goroutine 中并发进行
 type Completer struct {
-	trieTree *structure.TrieTree
+	mu           sync.RWMutex
+	trieTree     *structure.TrieTree
+	separators   string            // 除空格以外的单词分隔符
+	descriptions map[string]string // 补全项的简短描述，显示在选中的补全项之后
 }
 
 func NewCompleter() *Completer {
 	return &Completer{
-		trieTree: structure.NewTrieTree(),
+		trieTree:     structure.NewTrieTree(),
+		descriptions: make(map[string]string),
 	}
 }
 
+// WithWordSeparators 设置除空格以外的单词分隔符，例如 ":/."，注册的单词应该是分隔符之间的部分
+func (c *Completer) WithWordSeparators(seps string) *Completer {
+	c.separators = seps
+	return c
+}
+
 // Register 将单词注册到 Completer 中
 func (c *Completer) Register(hint *Hint) {
 	if hint.name == "" {
 		return
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.register(hint)
+}
+
+func (c *Completer) register(hint *Hint) {
 	path := strings.Split(hint.name, "")
 	c.trieTree.AddNode(path, hint)
 }
 
+// RegisterWithDescription 将单词以及描述注册到 Completer 中，单词已经存在时只更新描述
+func (c *Completer) RegisterWithDescription(name, description string) {
+	if name == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.trieTree.IsPathExist(strings.Split(name, "")) {
+		c.register(NewHint(name, ""))
+	}
+	if c.descriptions == nil {
+		c.descriptions = make(map[string]string)
+	}
+	c.descriptions[name] = description
+}
+
+// GetDescription 查询补全项的描述
+func (c *Completer) GetDescription(word string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	description, exist := c.descriptions[word]
+	return description, exist && description != ""
+}
+
 // Query 查询以当前单词为前缀的单词，返回这些单词的切片
 func (c *Completer) Query(word string) []string {
 
 	path := strings.Split(word, "")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	nodes := c.trieTree.AllLeafNodeInPathRecursive(path)
 
 	matched := make([]string, 0, len(nodes))
@@ -58,12 +101,16 @@ func (c *Completer) Query(word string) []string {
 // Exist 查询当前单词是否存在
 func (c *Completer) Exist(word string) bool {
 	path := strings.Split(word, "")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.trieTree.IsPathExist(path)
 }
 
 // GetHelper 查询当前命令是否存在帮助
 func (c *Completer) GetHelper(word string) (string, bool) {
 	path := strings.Split(word, "")
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	v, exist := c.trieTree.GetValue(path)
 	if !exist {
 		return "", false
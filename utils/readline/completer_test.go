@@ -2,6 +2,8 @@ package readline
 
 import (
 	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -19,3 +21,36 @@ func TestCompleter(t *testing.T) {
 	assert.Subset(t, []string{"122", "123", "1234", "12356"}, words)
 	assert.Equal(t, 4, len(words))
 }
+
+func TestCompleterConcurrent(t *testing.T) {
+
+	c := NewCompleter()
+	c.Register(&Hint{"key", "static"})
+
+	// 后台注册补全项的同时进行查询，需要使用 -race 检查
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			c.Register(NewHint("key:"+strconv.Itoa(i), ""))
+			c.RegisterWithDescription("desc:"+strconv.Itoa(i), "description")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			c.Query("key")
+			c.Exist("key:" + strconv.Itoa(i))
+			c.GetHelper("key")
+			c.GetDescription("desc:" + strconv.Itoa(i))
+		}
+	}()
+	wg.Wait()
+
+	assert.Len(t, c.Query("key"), 1001)
+	assert.Len(t, c.Query("desc:"), 1000)
+	helper, ok := c.GetHelper("key")
+	assert.True(t, ok)
+	assert.Equal(t, "static", helper)
+}
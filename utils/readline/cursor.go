@@ -0,0 +1,143 @@
+package readline
+
+import "os"
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+type winSize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+// cursor 是终端光标位置的模型，根据写入的内容以及光标移动推算当前位置，避免每次渲染都向终端查询光标位置。
+// 坐标从 1 开始，与终端控制序列保持一致。
+type cursor struct {
+	x, y          int
+	width, height int  // 终端的大小
+	wrap          bool // 光标位于行尾，下一个字符会写到下一行
+	escape        int  // 控制序列的解析状态
+}
+
+const (
+	escapeNone = iota
+	escapeStart
+	escapeCSI
+)
+
+func newCursor(x, y, width, height int) *cursor {
+	if width <= 0 {
+		width = defaultWidth
+	}
+	if height <= 0 {
+		height = defaultHeight
+	}
+	c := &cursor{width: width, height: height}
+	c.moveTo(x, y)
+	return c
+}
+
+// newCursorFromTerminal 向终端查询一次光标位置以及终端大小，用来初始化光标模型
+func newCursorFromTerminal() *cursor {
+	x, y := ReadCursor()
+	width, height, _ := getWinSize(int(os.Stdout.Fd()))
+	return newCursor(x, y, width, height)
+}
+
+// write 根据输出到终端的内容更新光标位置，控制序列不会移动光标
+func (c *cursor) write(content []byte) {
+	for _, b := range content {
+		switch c.escape {
+		case escapeStart:
+			if b == '[' {
+				c.escape = escapeCSI
+			} else {
+				c.escape = escapeNone
+			}
+			continue
+		case escapeCSI:
+			if b >= 0x40 && b <= 0x7e {
+				c.escape = escapeNone
+			}
+			continue
+		}
+
+		switch {
+		case b == ESC:
+			c.escape = escapeStart
+		case b == '\n':
+			c.wrap = false
+			c.x = 1
+			c.lineFeed()
+		case b == '\r':
+			c.wrap = false
+			c.x = 1
+		case b == '\b':
+			c.wrap = false
+			if c.x > 1 {
+				c.x--
+			}
+		case b >= 0x80 && b < 0xC0:
+			// UTF-8 的后续字节不占用列
+		case b >= 32:
+			if c.wrap {
+				c.wrap = false
+				c.x = 1
+				c.lineFeed()
+			}
+			if c.x == c.width {
+				c.wrap = true
+			} else {
+				c.x++
+			}
+		}
+	}
+}
+
+// lineFeed 移动到下一行，如果已经位于最后一行，终端会向上滚动，光标所在的行数不变
+func (c *cursor) lineFeed() {
+	if c.y < c.height {
+		c.y++
+	}
+}
+
+// move 将光标移动指定的偏移量，光标不会超出终端的范围
+func (c *cursor) move(x, y int) {
+	if x == 0 && y == 0 {
+		return
+	}
+	c.moveTo(c.x+x, c.y+y)
+}
+
+// offset 返回光标水平移动 n 列之后的位置，超出行首或者行尾时移动到上一行或者下一行，用于在自动换行的输入中移动。
+// 光标位于行尾等待换行时，视为位于下一行的开头
+func (c *cursor) offset(n int) (x, y int) {
+	pos := (c.y-1)*c.width + c.x - 1
+	if c.wrap {
+		pos++
+	}
+	pos += n
+	if pos < 0 {
+		pos = 0
+	}
+	return pos%c.width + 1, pos/c.width + 1
+}
+
+// moveTo 将光标移动到目标位置，光标不会超出终端的范围
+func (c *cursor) moveTo(x, y int) {
+	c.wrap = false
+	c.x, c.y = clamp(x, 1, c.width), clamp(y, 1, c.height)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	} else if v > max {
+		return max
+	}
+	return v
+}
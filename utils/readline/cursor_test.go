@@ -0,0 +1,64 @@
+package readline
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCursorModel(t *testing.T) {
+
+	c := newCursor(1, 1, 10, 3)
+
+	tests := []struct {
+		op       func()
+		x, y     int
+		describe string
+	}{
+		{func() { c.write([]byte("> ")) }, 3, 1, "write"},
+		{func() { c.write([]byte("\033[47;37mab\033[0m")) }, 5, 1, "escape sequence"},
+		{func() { c.move(-2, 0) }, 3, 1, "move left"},
+		{func() { c.move(-10, 0) }, 1, 1, "move out of range"},
+		{func() { c.write([]byte("0123456789")) }, 10, 1, "write to line end"},
+		{func() { c.write([]byte("a")) }, 2, 2, "wrap"},
+		{func() { c.write([]byte("\n\n")) }, 1, 3, "line feed"},
+		{func() { c.write([]byte("\nab")) }, 3, 3, "scroll"},
+		{func() { c.write([]byte("\b")) }, 2, 3, "backspace"},
+		{func() { c.moveTo(0, 4) }, 1, 3, "move to out of range"},
+		{func() { c.moveTo(5, 2) }, 5, 2, "move to"},
+		{func() { c.write([]byte("\r")) }, 1, 2, "carriage return"},
+	}
+
+	for _, test := range tests {
+		test.op()
+		assert.Equal(t, test.x, c.x, test.describe)
+		assert.Equal(t, test.y, c.y, test.describe)
+	}
+}
+
+func TestTerminalCursorModel(t *testing.T) {
+	output = &bytes.Buffer{}
+
+	term := NewTerminal().WithCompleter(nil)
+	term.cur = newCursor(1, 24, 80, 24)
+	term.flushString(term.prefix)
+
+	for _, b := range []byte("sett") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, []int{7, 24}, []int{term.cur.x, term.cur.y})
+
+	term.moveCursor(-2, 0)
+	assert.Equal(t, []int{5, 24}, []int{term.cur.x, term.cur.y})
+
+	term.handleInput(BACKSPACE)
+	term.moveCursor(10, 0)
+	assert.Equal(t, []byte("stt"), term.bytes())
+	assert.Equal(t, []int{6, 24}, []int{term.cur.x, term.cur.y})
+
+	// 在最后一行显示搜索框时终端会滚动，光标需要回到原来的行
+	term.displaySearch()
+	assert.Equal(t, []int{6, 23}, []int{term.cur.x, term.cur.y})
+	term.maybeClearSearch()
+	assert.Equal(t, []int{6, 23}, []int{term.cur.x, term.cur.y})
+}
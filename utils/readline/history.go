@@ -3,6 +3,8 @@ package readline
 import (
 	"bytes"
 	"container/list"
+	"fmt"
+	"strconv"
 )
 
 // history 是一个历史命令链表，支持命令查询功能，查询的时间复杂度是 O(n)。
@@ -42,7 +44,8 @@ func (h *history) recordCommand(command []byte) {
 	h.resetCursor()
 }
 
-// searchCommand 查询命令
+// searchCommand 从新到旧查询包含 sub 的命令，重复调用会依次返回更旧的匹配命令。
+// 查询到最旧的命令后返回空，下一次查询重新从最新的命令开始。
 func (h *history) searchCommand(sub []byte) []byte {
 
 	if h.commands.Len() <= 1 {
@@ -50,21 +53,28 @@ func (h *history) searchCommand(sub []byte) []byte {
 	}
 
 	if !bytes.Equal(sub, h.searchCache) {
-		h.searchCache = sub
+		h.searchCache = append([]byte{}, sub...)
 		h.resetCursor()
 	}
 	for ; h.cursor != nil; h.cursor = h.cursor.Next() {
 		v := h.cursor.Value.([]byte)
-		if matched := bytes.Contains(v, sub); matched {
+		if matched := bytes.Contains(v, sub); matched && h.cursor != h.sentry {
 			h.cursor = h.cursor.Next()
 			return v
 		}
 	}
+	h.resetCursor()
 	return []byte{}
 }
 
 // moveCursor 执行一次查询游标的移动。如果游标无法移动，返回值 end == true
 func (h *history) moveCursor(older bool) (command []byte, end bool) {
+	return h.moveCursorWithPrefix(older, nil)
+}
+
+// moveCursorWithPrefix 将查询游标移动到下一条以 prefix 开头的命令，向新的方向移动时可以回到哨兵的位置。
+// 如果没有匹配的命令，游标不会移动，返回值 end == true
+func (h *history) moveCursorWithPrefix(older bool, prefix []byte) (command []byte, end bool) {
 
 	if h.commands.Len() <= 1 {
 		return []byte{}, true
@@ -74,21 +84,20 @@ func (h *history) moveCursor(older bool) (command []byte, end bool) {
 		return []byte{}, true
 	}
 
-	if older {
-		if h.cursor.Next() != nil {
-			h.cursor = h.cursor.Next()
-			return h.cursor.Value.([]byte), false
-		} else {
-			return []byte{}, true
+	next := func(e *list.Element) *list.Element {
+		if older {
+			return e.Next()
 		}
+		return e.Prev()
 	}
 
-	if h.cursor.Prev() == nil {
-		return []byte{}, true
-	} else {
-		h.cursor = h.cursor.Prev()
-		return h.cursor.Value.([]byte), false
+	for e := next(h.cursor); e != nil; e = next(e) {
+		if e == h.sentry || bytes.HasPrefix(e.Value.([]byte), prefix) {
+			h.cursor = e
+			return e.Value.([]byte), false
+		}
 	}
+	return []byte{}, true
 }
 
 // resetCursor 重置游标的位置
@@ -115,3 +124,61 @@ func (h *history) histories() [][]byte {
 	}
 	return histories
 }
+
+// expand 展开命令中的历史引用：!! 表示上一条命令，!n 表示第 n 条历史命令，!prefix 表示最近一条以 prefix 开头的命令。
+// 只有位于单词开头并且不在引号内的 ! 会被展开。如果找不到引用的命令，返回 error。
+func (h *history) expand(line []byte) (expanded []byte, changed bool, err error) {
+
+	if bytes.IndexByte(line, '!') < 0 {
+		return line, false, nil
+	}
+
+	histories := h.histories()
+	quoted := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '"' && (i == 0 || line[i-1] != '\\') {
+			quoted = !quoted
+		}
+		if c != '!' || quoted || (i > 0 && line[i-1] != ' ') || i == len(line)-1 || line[i+1] == ' ' {
+			expanded = append(expanded, c)
+			continue
+		}
+
+		j := i + 1
+		var command []byte
+		if line[j] == '!' {
+			j++
+			if len(histories) > 0 {
+				command = histories[0]
+			}
+		} else if line[j] >= '0' && line[j] <= '9' {
+			for j < len(line) && line[j] >= '0' && line[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(string(line[i+1 : j]))
+			if n > 0 && n <= len(histories) {
+				command = histories[len(histories)-n]
+			}
+		} else {
+			for j < len(line) && line[j] != ' ' {
+				j++
+			}
+			for _, history := range histories {
+				if bytes.HasPrefix(history, line[i+1:j]) {
+					command = history
+					break
+				}
+			}
+		}
+
+		if command == nil {
+			return line, false, fmt.Errorf("%s: event not found", line[i:j])
+		}
+		expanded = append(expanded, command...)
+		changed = true
+		i = j - 1
+	}
+	return expanded, changed, nil
+}
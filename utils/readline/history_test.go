@@ -67,4 +67,57 @@ func TestHistorySearch(t *testing.T) {
 	searchRet = h.searchCommand([]byte("5"))
 	assert.Equal(t, []byte{}, searchRet)
 
+	// 查询到最旧的命令后重新开始循环
+	searchRet = h.searchCommand([]byte("5"))
+	assert.Equal(t, []byte("vdf5"), searchRet)
+	searchRet = h.searchCommand([]byte("5"))
+	assert.Equal(t, []byte("2345"), searchRet)
+
+	// 修改查询内容后从最新的命令开始查询
+	searchRet = h.searchCommand([]byte("34"))
+	assert.Equal(t, []byte("34"), searchRet)
+	searchRet = h.searchCommand([]byte("34"))
+	assert.Equal(t, []byte("2345"), searchRet)
+}
+
+func TestHistoryExpand(t *testing.T) {
+
+	h := newHistory(10)
+	h.recordCommand([]byte("set a 1"))
+	h.recordCommand([]byte("get a"))
+	h.recordCommand([]byte("set b 2"))
+
+	tests := []struct {
+		input    string
+		expected string
+		changed  bool
+		err      string
+	}{
+		{"get b", "get b", false, ""},
+		{"!!", "set b 2", true, ""},
+		{"!1", "set a 1", true, ""},
+		{"!2 extra", "get a extra", true, ""},
+		{"!se", "set b 2", true, ""},
+		{"!get", "get a", true, ""},
+		{"echo !! !1", "echo set b 2 set a 1", true, ""},
+		{"set c hi!", "set c hi!", false, ""},
+		{"set c \"!!\"", "set c \"!!\"", false, ""},
+		{"set c !", "set c !", false, ""},
+		{"!del", "", false, "!del: event not found"},
+		{"!4", "", false, "!4: event not found"},
+	}
+
+	for _, test := range tests {
+		expanded, changed, err := h.expand([]byte(test.input))
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.input)
+			continue
+		}
+		assert.Nil(t, err, test.input)
+		assert.Equal(t, test.expected, string(expanded), test.input)
+		assert.Equal(t, test.changed, changed, test.input)
+	}
+
+	_, _, err := newHistory(10).expand([]byte("!!"))
+	assert.EqualError(t, err, "!!: event not found")
 }
@@ -0,0 +1,148 @@
+package readline
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var errReadTimeout = errors.New("read timeout")
+
+// inputReader 在后台读取输入流，使读取操作可以设置超时时间。
+// 超时后未被消费的数据会保留在缓冲区中，由之后的读取操作取出，防止输入丢失。
+type inputReader struct {
+	ch      chan byte
+	pending []byte
+}
+
+func newInputReader(r io.Reader) *inputReader {
+	ir := &inputReader{
+		ch: make(chan byte, 64),
+	}
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Read(buf)
+			for _, b := range buf[:n] {
+				ir.ch <- b
+			}
+			if err != nil {
+				close(ir.ch)
+				return
+			}
+		}
+	}()
+	return ir
+}
+
+// readByte 阻塞读取一个字节，输入流关闭后返回 io.EOF
+func (r *inputReader) readByte() (byte, error) {
+	if len(r.pending) > 0 {
+		b := r.pending[0]
+		r.pending = r.pending[1:]
+		return b, nil
+	}
+	b, ok := <-r.ch
+	if !ok {
+		return 0, io.EOF
+	}
+	return b, nil
+}
+
+// readByteBefore 读取一个字节，如果在 deadline 之前没有数据到达，返回 errReadTimeout
+func (r *inputReader) readByteBefore(deadline *time.Timer) (byte, error) {
+	if len(r.pending) > 0 {
+		return r.readByte()
+	}
+	select {
+	case b, ok := <-r.ch:
+		if !ok {
+			return 0, io.EOF
+		}
+		return b, nil
+	case <-deadline.C:
+		return 0, errReadTimeout
+	}
+}
+
+// unread 将已经读取的字节放回缓冲区头部
+func (r *inputReader) unread(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	r.pending = append(append([]byte{}, b...), r.pending...)
+}
+
+var (
+	input     *inputReader
+	inputOnce sync.Once
+)
+
+// stdin 返回标准输入的 inputReader，只有在第一次使用时才会开始读取标准输入
+func stdin() *inputReader {
+	inputOnce.Do(func() {
+		if input == nil {
+			input = newInputReader(os.Stdin)
+		}
+	})
+	return input
+}
+
+// runeDecoder 将输入的字节组装为完整的 UTF-8 字符，多字节字符的全部字节到达之后才会交给终端处理，
+// 因此一个字符被拆分到多次读取中时也不会被处理一半
+type runeDecoder struct {
+	buf  []byte
+	need int // 当前字符的总字节数
+}
+
+// feed 输入一个字节，组装出完整的字符时返回该字符的全部字节。非法的编码会被丢弃
+func (d *runeDecoder) feed(b byte) ([]byte, bool) {
+
+	if len(d.buf) == 0 {
+		n := utf8SeqLen(b)
+		if n == 1 {
+			return []byte{b}, true
+		} else if n == 0 {
+			return nil, false
+		}
+		d.buf = append(d.buf, b)
+		d.need = n
+		return nil, false
+	}
+
+	// 不是后续字节，丢弃不完整的字符后重新开始
+	if b&0xC0 != 0x80 {
+		d.buf = d.buf[:0]
+		return d.feed(b)
+	}
+
+	d.buf = append(d.buf, b)
+	if len(d.buf) < d.need {
+		return nil, false
+	}
+
+	unit := d.buf
+	d.buf = nil
+	if !utf8.Valid(unit) {
+		return nil, false
+	}
+	return unit, true
+}
+
+// utf8SeqLen 根据首字节返回 UTF-8 字符的字节数，首字节非法时返回 0
+func utf8SeqLen(b byte) int {
+	switch {
+	case b < 0x80:
+		return 1
+	case b >= 0xC2 && b <= 0xDF:
+		return 2
+	case b >= 0xE0 && b <= 0xEF:
+		return 3
+	case b >= 0xF0 && b <= 0xF4:
+		return 4
+	}
+	return 0
+}
@@ -14,11 +14,17 @@ const (
 	SIGTSTP   byte = 26
 	ESC       byte = 27
 	SIGQUIT   byte = 28
+	MATCH     byte = 29 // control-]
 	BACKSPACE byte = 127
 )
 
 var keyHandlerMap = map[byte]keyHandler{}
 
+// raiseSignal 向当前进程发送信号
+var raiseSignal = func(sig syscall.Signal) {
+	_ = syscall.Kill(syscall.Getpid(), sig)
+}
+
 type keyHandler func(terminal *Terminal, input byte)
 
 func keyHandlerESC(t *Terminal, input byte) {
@@ -41,11 +47,6 @@ func keyHandlerESC(t *Terminal, input byte) {
 
 	t.buffer = append(t.buffer, input)
 
-	if len(t.buffer) > 5 {
-		t.buffer = []byte{}
-		return
-	}
-
 	for i := 1; i < len(t.buffer); i++ {
 		if t.buffer[i] == ESC {
 			t.buffer = t.buffer[i:]
@@ -55,6 +56,24 @@ func keyHandlerESC(t *Terminal, input byte) {
 		}
 	}
 
+	// ReadCursor 超时后才到达的光标位置报告不能作为输入，只用来更新已知的光标位置
+	if len(t.buffer) > 2 && isCursorReportPrefix(t.buffer) {
+		if input == 'R' {
+			cursorX, cursorY, _ = parseCursorReport(t.buffer)
+			t.buffer = []byte{}
+		}
+		return
+	} else if len(t.buffer) > 3 && isCursorReportPrefix(t.buffer[:len(t.buffer)-1]) {
+		// 其他带参数的控制序列暂不支持，直接丢弃
+		t.buffer = []byte{}
+		return
+	}
+
+	if len(t.buffer) > 5 {
+		t.buffer = []byte{}
+		return
+	}
+
 	if bytes.Equal(t.buffer, []byte{27, '[', 'D'}) {
 		if t.highlight >= 0 {
 			t.selectCompletion(-1, 0)
@@ -113,7 +132,10 @@ func keyHandlerEnter(t *Terminal, _ byte) {
 func keyHandlerBackspace(t *Terminal, _ byte) {
 
 	if t.inSearchMode() {
-		t.search = t.search[:len(t.search)-1]
+		if len(t.search) > 0 {
+			t.search = t.search[:len(t.search)-1]
+			t.displaySearch()
+		}
 		return
 	}
 
@@ -125,11 +147,18 @@ func keyHandlerBackspace(t *Terminal, _ byte) {
 
 }
 
-// keyHandlerSIGINT 处理信号 control-C
+// keyHandlerSIGINT 处理信号 control-C：丢弃当前输入并显示新的提示符；连续两次输入 control-C 时退出
 func keyHandlerSIGINT(t *Terminal, _ byte) {
 	t.maybeClearCompletion()
 	t.maybeClearHelper()
-	_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	t.maybeClearSearch()
+
+	if !t.interrupted {
+		t.cancel()
+		return
+	}
+
+	raiseSignal(syscall.SIGINT)
 	t.abort()
 }
 
@@ -137,7 +166,7 @@ func keyHandlerSIGINT(t *Terminal, _ byte) {
 func keyHandlerSIGTSTP(t *Terminal, _ byte) {
 	t.maybeClearCompletion()
 	t.maybeClearHelper()
-	_ = syscall.Kill(syscall.Getpid(), syscall.SIGTSTP)
+	raiseSignal(syscall.SIGTSTP)
 	t.finished = true
 	t.abort()
 }
@@ -146,16 +175,13 @@ func keyHandlerSIGTSTP(t *Terminal, _ byte) {
 func keyHandlerSIGQUIT(t *Terminal, _ byte) {
 	t.maybeClearCompletion()
 	t.maybeClearHelper()
-	_ = syscall.Kill(syscall.Getpid(), syscall.SIGQUIT)
+	raiseSignal(syscall.SIGQUIT)
 	t.abort()
 }
 
 func keyHandlerTab(t *Terminal, _ byte) {
 	if !t.showCompletions() {
-		t.insert(' ')
-		t.insert(' ')
-		t.insert(' ')
-		t.insert(' ')
+		t.insert('\t')
 		t.maybeClearHelper()
 	}
 }
@@ -171,6 +197,22 @@ func keyHandlerAlpha(t *Terminal, input byte) {
 	t.maybeClearHelper()
 	t.maybeClearCompletion()
 	t.insert(input)
+	t.maybeHighlightMatch()
+	t.maybeDisplayHelper()
+}
+
+// keyHandlerRune 处理多字节的 UTF-8 字符
+func keyHandlerRune(t *Terminal, r []byte) {
+
+	if t.inSearchMode() {
+		t.search = append(t.search, r...)
+		t.displaySearch()
+		return
+	}
+
+	t.maybeClearHelper()
+	t.maybeClearCompletion()
+	t.insert(r...)
 	t.maybeDisplayHelper()
 }
 
@@ -182,6 +224,14 @@ func keyHandlerSearch(t *Terminal, _ byte) {
 	t.searchHistory()
 }
 
+// keyHandlerMatch 处理 control-]，跳转到与光标处的引号或者括号匹配的位置
+func keyHandlerMatch(t *Terminal, _ byte) {
+	if t.inSearchMode() || t.inCompletionMode() {
+		return
+	}
+	t.jumpToMatch()
+}
+
 func init() {
 	keyHandlerMap[ESC] = keyHandlerESC
 	keyHandlerMap[TAB] = keyHandlerTab
@@ -191,6 +241,7 @@ func init() {
 	keyHandlerMap[SIGTSTP] = keyHandlerSIGTSTP
 	keyHandlerMap[SIGINT] = keyHandlerSIGINT
 	keyHandlerMap[SEARCH] = keyHandlerSearch
+	keyHandlerMap[MATCH] = keyHandlerMatch
 	//keyHandlerMap[] = keyHandler
 
 }
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unicode/utf8"
 )
 
 type Termios syscall.Termios
@@ -30,17 +34,18 @@ func newLineFrom(content []byte) *Line {
 }
 
 // write 将字节写入当前行中，返回当前插入后 offset 以及需要刷新的缓冲区内容
-func (l *Line) write(c byte) (int, []byte) {
+func (l *Line) write(c ...byte) (int, []byte) {
+	start := l.insertPos
 	if l.insertPos == len(l.content) {
-		l.insertPos++
-		l.content = append(l.content, c)
-		return l.insertPos, l.content[l.insertPos-1:]
+		l.insertPos += len(c)
+		l.content = append(l.content, c...)
+		return l.insertPos, l.content[start:]
 	}
-	l.content = append(l.content, byte(0))
-	copy(l.content[l.insertPos+1:], l.content[l.insertPos:])
-	l.content[l.insertPos] = c
-	l.insertPos++
-	return l.insertPos, l.content[l.insertPos-1:]
+	l.content = append(l.content, c...)
+	copy(l.content[l.insertPos+len(c):], l.content[l.insertPos:])
+	copy(l.content[l.insertPos:], c)
+	l.insertPos += len(c)
+	return l.insertPos, l.content[start:]
 }
 
 // delete 删除当前位置下的字符，返回删除后的下标以及要刷新的缓冲区内容
@@ -73,34 +78,91 @@ func (l *Line) tail() int {
 	return len(l.content) - l.insertPos
 }
 
-// firstWord 返回当前行的第一个单词
-func (l *Line) firstWord() []byte {
+// firstWord 返回当前行的第一个单词，seps 是单词的分隔符
+func (l *Line) firstWord(seps string) []byte {
 	for i := 0; i < len(l.content); i++ {
-		if l.content[i] == ' ' {
+		if isSeparator(l.content[i], seps) {
 			return l.content[:i]
 		}
 	}
 	return l.content[:]
 }
 
-// currentWord 返回当前修改的单词
-func (l *Line) currentWord() []byte {
+// currentWord 返回当前修改的单词，seps 是单词的分隔符
+func (l *Line) currentWord(seps string) []byte {
 
 	// 找到当前单词的起点
 	i, j := l.insertPos-1, l.insertPos
 	for ; i >= 0; i-- {
-		if l.content[i] == ' ' {
+		if isSeparator(l.content[i], seps) {
 			break
 		}
 	}
 	for ; j < len(l.content); j++ {
-		if l.content[j] == ' ' {
+		if isSeparator(l.content[j], seps) {
 			break
 		}
 	}
 	return l.content[i+1 : j]
 }
 
+// brackets 记录可以匹配的括号，键为左括号，值为对应的右括号
+var brackets = map[byte]byte{'(': ')', '[': ']', '{': '}'}
+
+// matchBracket 返回 pos 处的引号或者括号所匹配的位置。引号内的括号不参与匹配，引号内的 \ 会转义下一个字符
+func (l *Line) matchBracket(pos int) (int, bool) {
+	if pos < 0 || pos >= len(l.content) {
+		return 0, false
+	}
+
+	var opened []int // 还没有闭合的左括号
+	quote := -1      // 当前所在字符串的左引号位置，不在字符串中时为 -1
+
+	for i := 0; i < len(l.content); i++ {
+		c := l.content[i]
+
+		if quote >= 0 {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				if quote == pos {
+					return i, true
+				} else if i == pos {
+					return quote, true
+				}
+				quote = -1
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			quote = i
+		case '(', '[', '{':
+			opened = append(opened, i)
+		case ')', ']', '}':
+			// 不匹配的右括号直接忽略
+			n := len(opened)
+			if n == 0 || brackets[l.content[opened[n-1]]] != c {
+				continue
+			}
+			open := opened[n-1]
+			opened = opened[:n-1]
+			if open == pos {
+				return i, true
+			} else if i == pos {
+				return open, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// isSeparator 判断 c 是否是单词的分隔符，空格与制表符总是分隔符
+func isSeparator(c byte, seps string) bool {
+	return c == ' ' || c == '\t' || strings.IndexByte(seps, c) >= 0
+}
+
 type TerminalCommand func(input [][]byte, abort bool) int
 
 // Terminal 是对当前终端显示内容的一个抽象，负责维护终端上的光标以及内容
@@ -111,10 +173,17 @@ type Terminal struct {
 	finished bool    // 是否解析完毕
 	aborted  bool    // 因为信号而退出
 
-	histories  *history
-	hauto      bool   // 是否自动存储历史命令
-	search     []byte // 用于搜索的命令
-	searchMode bool
+	interrupted bool // 上一次输入是 control-C
+
+	histories   *history
+	hauto       bool   // 是否自动存储历史命令
+	stash       []byte // 进入历史命令浏览前正在编辑的内容，回到最新位置时恢复
+	search      []byte // 用于搜索的命令
+	searchMode  bool
+	searchStart int // 搜索结果中匹配部分的起始位置
+	searchEnd   int // 搜索结果中匹配部分的结束位置
+
+	matched int // 正在高亮显示的匹配括号的位置，没有时为 -1
 
 	completer    *Completer // 补全器
 	highlight    int        // 补全信息高亮显示的位置
@@ -123,8 +192,26 @@ type Terminal struct {
 	displayLimit int        // 一次最大显示的补全个数
 	displayedLen int        // 已经显示的字符串长度
 
-	prefix string // 输入行的前缀提示符
-	quit   string // 退出控制语句
+	prefix     string // 输入行的前缀提示符
+	quit       string // 退出控制语句
+	separators string // 除空格以外的单词分隔符
+
+	maxLineLen int // 输入内容的最大字节数，为 0 时不限制
+	tabWidth   int // 制表符显示时占用的列数
+
+	terminator byte // 除 \r 以及 \n 以外的行结束符，为 0 时不使用
+	afterCR    bool // 上一个输入是否为 \r，\r\n 只会结束一行
+
+	onKey    func(b byte) bool // 每次输入时的回调函数
+	escaping bool              // 当前输入是否属于控制序列
+
+	cur *cursor // 终端光标位置的模型
+
+	decoder  runeDecoder // 将输入组装为完整的 UTF-8 字符
+	pending  []byte      // 通过 Feed 输入但是还没有处理的字节
+	prompted bool        // 使用 Step 读取时，当前行是否已经输出了提示符
+
+	mu sync.Mutex // 保护输入内容，使 CurrentLine 可以在其他协程中调用
 }
 
 func NewTerminal() *Terminal {
@@ -138,10 +225,13 @@ func NewTerminal() *Terminal {
 		completer:    c,
 		displayLimit: 8,
 		highlight:    -1,
+		matched:      -1,
 		histories:    newHistory(20),
 		hauto:        true,
 		prefix:       "> ",
 		quit:         "quit",
+		tabWidth:     4,
+		cur:          newCursor(1, 1, defaultWidth, defaultHeight),
 	}
 }
 
@@ -149,19 +239,53 @@ func NewTerminal() *Terminal {
 // 如果命令被拦截，cmd == [][]byte{}
 func (t *Terminal) ReadLine() (cmd [][]byte, abort bool) {
 
-	old := DisableTerminal()
+	commands := SplitRepeatableSeg(t.readInput(), ' ')
+
+	if t.tryExecInternalCommand(commands) {
+		return [][]byte{}, t.aborted
+	}
+
+	return commands, t.aborted
+}
 
-	FlushString(t.prefix)
+// ReadCommand 与 ReadLine 相同，但是返回解析后的 Command。如果命令被拦截或者输入为空，cmd.Name == ""
+func (t *Terminal) ReadCommand() (cmd Command, abort bool) {
 
-	input := make([]byte, 1)
+	raw := t.readInput()
+
+	if t.tryExecInternalCommand(SplitRepeatableSeg(raw, ' ')) {
+		return Command{}, t.aborted
+	}
+
+	return ParseCommand(raw), t.aborted
+}
+
+// readInput 阻塞读取一行输入并返回原始内容
+func (t *Terminal) readInput() []byte {
+
+	old := DisableTerminal()
+	t.cur = newCursorFromTerminal()
+
+	t.flushString(t.prefix)
 
 	for !t.finished {
-		if _, err := os.Stdin.Read(input); err == io.EOF {
+		input, err := stdin().readByte()
+		if err == io.EOF {
 			break
 		}
-		t.handleInput(input[0])
+		t.feedByte(input)
 	}
 
+	c := t.takeInput()
+	// 恢复终端设置
+	_ = setTermios(int(os.Stdout.Fd()), old)
+
+	return c
+}
+
+// takeInput 收集已经完成的一行输入，记录历史命令并清除缓存
+func (t *Terminal) takeInput() []byte {
+
 	// 收集每一行字符串
 	var c []byte
 	for _, line := range t.content {
@@ -173,32 +297,64 @@ func (t *Terminal) ReadLine() (cmd [][]byte, abort bool) {
 		t.histories.recordCommand(c)
 	}
 
+	t.mu.Lock()
 	t.clear()
-	// 恢复终端设置
-	_ = setTermios(int(os.Stdout.Fd()), old)
+	t.mu.Unlock()
+
+	return c
+}
+
+// Feed 向终端输入一个字节，字节会被缓存到下一次调用 Step 时处理，用于由外部的事件循环控制读取的场景
+func (t *Terminal) Feed(b byte) {
+	t.pending = append(t.pending, b)
+}
+
+// Step 处理通过 Feed 输入的字节，直到完成一行命令或者缓存的字节全部处理完毕，不会阻塞。
+// 完成一行命令时 done 为 true，cmd 与 ReadLine 的返回值相同，没有处理的字节会保留到下一次调用。
+// 每一行的提示符在该行第一次调用 Step 时输出，终端的模式需要由调用方设置
+func (t *Terminal) Step() (done bool, cmd [][]byte) {
+
+	if !t.prompted {
+		t.flushString(t.prefix)
+		t.prompted = true
+	}
 
-	commands := SplitRepeatableSeg(c, ' ')
+	for len(t.pending) > 0 && !t.finished {
+		input := t.pending[0]
+		t.pending = t.pending[1:]
+		t.feedByte(input)
+	}
+
+	if !t.finished {
+		return false, nil
+	}
 
+	t.prompted = false
+	commands := SplitRepeatableSeg(t.takeInput(), ' ')
 	if t.tryExecInternalCommand(commands) {
-		return [][]byte{}, t.aborted
+		return true, [][]byte{}
 	}
+	return true, commands
+}
 
-	return commands, t.aborted
+// Aborted 返回终端是否因为信号或者退出命令而终止
+func (t *Terminal) Aborted() bool {
+	return t.aborted
 }
 
 // ReadLineAndExec 读取一行命令并且执行；如果执行返回值为 0，记录该命令。
 func (t *Terminal) ReadLineAndExec(f TerminalCommand) {
 
 	old := DisableTerminal()
-	FlushString(t.prefix)
-
-	input := make([]byte, 1)
+	t.cur = newCursorFromTerminal()
+	t.flushString(t.prefix)
 
 	for !t.finished {
-		if _, err := os.Stdin.Read(input); err == io.EOF {
+		input, err := stdin().readByte()
+		if err == io.EOF {
 			break
 		}
-		t.handleInput(input[0])
+		t.feedByte(input)
 	}
 
 	// 收集每一行字符串
@@ -216,11 +372,20 @@ func (t *Terminal) ReadLineAndExec(f TerminalCommand) {
 		t.histories.recordCommand(c)
 	}
 
+	t.mu.Lock()
 	t.clear()
+	t.mu.Unlock()
 	// 恢复终端设置
 	_ = setTermios(int(os.Stdout.Fd()), old)
 }
 
+// CurrentLine 返回当前已经输入但是还没有完成的内容的拷贝，可以在其他协程中调用，例如用于实时预览
+func (t *Terminal) CurrentLine() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bytes()
+}
+
 func (t *Terminal) StoreHistory(line []byte) {
 	t.histories.recordCommand(line)
 }
@@ -255,6 +420,49 @@ func (t *Terminal) WithPrefix(prefix string) *Terminal {
 	return t
 }
 
+// WithWordSeparators 设置除空格以外的单词分隔符，补全时只会替换分隔符之后的部分。
+// 如果没有设置，将使用 Completer 的分隔符。
+func (t *Terminal) WithWordSeparators(seps string) *Terminal {
+	t.separators = seps
+	return t
+}
+
+// WithOnKey 设置每次输入时的回调函数，回调函数会在默认处理之前执行；如果返回 true，代表输入已经被消费，不再执行默认处理。
+// 控制序列中的每个字节也会传递给回调函数，可以通过 InEscapeSequence 判断。
+func (t *Terminal) WithOnKey(f func(b byte) bool) *Terminal {
+	t.onKey = f
+	return t
+}
+
+// WithLineTerminator 设置额外的行结束符。\r、\n 以及 \r\n 总是会作为行结束符，并且只会结束一行
+func (t *Terminal) WithLineTerminator(b byte) *Terminal {
+	t.terminator = b
+	return t
+}
+
+// WithTabWidth 设置制表符显示时占用的列数，输入内容中保存的仍然是制表符；n 小于 1 时使用 1
+func (t *Terminal) WithTabWidth(n int) *Terminal {
+	if n < 1 {
+		n = 1
+	}
+	t.tabWidth = n
+	return t
+}
+
+// InEscapeSequence 判断当前传递给 OnKey 回调函数的字节是否属于控制序列
+func (t *Terminal) InEscapeSequence() bool {
+	return t.escaping
+}
+
+// WithMaxLineLength 设置输入内容的最大字节数，达到上限之后的普通输入会被丢弃并且响铃；n 为 0 时不限制
+func (t *Terminal) WithMaxLineLength(n int) *Terminal {
+	if n < 0 {
+		n = 0
+	}
+	t.maxLineLen = n
+	return t
+}
+
 func (t *Terminal) WithDisplayLimit(limit int) *Terminal {
 	if limit > 0 {
 		t.displayLimit = limit
@@ -279,6 +487,14 @@ func (t *Terminal) currentLine() *Line {
 	return t.content[t.line]
 }
 
+// wordSeparators 返回当前使用的单词分隔符
+func (t *Terminal) wordSeparators() string {
+	if t.separators == "" && t.completer != nil {
+		return t.completer.separators
+	}
+	return t.separators
+}
+
 // MoveCursor 模拟移动光标，x 与 y 是偏移量而非绝对位置
 func (t *Terminal) moveCursor(x, y int) {
 
@@ -289,6 +505,14 @@ func (t *Terminal) moveCursor(x, y int) {
 		x = -t.currentLine().head()
 	}
 
+	// 光标在屏幕上移动的列数与经过的字符有关
+	dx := 0
+	if head := t.currentLine().head(); x > 0 {
+		dx = t.columns(t.currentLine().content[head : head+x])
+	} else if x < 0 {
+		dx = -t.columns(t.currentLine().content[head+x : head])
+	}
+
 	if y+t.line < 0 {
 		y = -t.line
 		t.line = 0
@@ -301,25 +525,46 @@ func (t *Terminal) moveCursor(x, y int) {
 		t.currentLine().moveCursor(x)
 	}
 
-	MoveCursor(x, y)
+	t.cursorMove(dx, y)
 }
 
-// insert 写入数据到终端
-func (t *Terminal) insert(input byte) {
-	_, content := t.currentLine().write(input)
-	Flush(content)
-	MoveCursor(-len(content)+1, 0)
+// insert 写入数据到终端，输入内容达到上限时不会写入。多字节字符需要一次性写入
+func (t *Terminal) insert(input ...byte) {
+	if t.maxLineLen > 0 && t.length()+len(input) > t.maxLineLen {
+		t.bell()
+		return
+	}
+	_, content := t.currentLine().write(input...)
+	t.flush(t.expandTabs(content))
+	// 光标需要回到插入的字符之后
+	t.cursorMove(-t.columns(content)+t.columns(input), 0)
 }
 
 func (t *Terminal) delete() {
 	if t.currentLine().head() == 0 {
 		return
 	}
+	w := t.columns(t.currentLine().content[t.currentLine().head()-1:][:1])
 	_, content := t.currentLine().delete()
 	//os.Stdout.WriteString("\b \b")
-	MoveCursor(-1, 0)
-	Flush(content)
-	MoveCursor(-len(content), 0)
+	t.cursorMove(-w, 0)
+	// 用空格覆盖被删除字符占用的全部列
+	toFlush := append(t.expandTabs(content[:len(content)-1]), bytes.Repeat([]byte{' '}, w)...)
+	t.flush(toFlush)
+	t.cursorMove(-utf8.RuneCount(toFlush), 0)
+}
+
+// expandTabs 返回 content 在终端上显示的内容，制表符会被替换为 tabWidth 个空格
+func (t *Terminal) expandTabs(content []byte) []byte {
+	if bytes.IndexByte(content, '\t') < 0 {
+		return content
+	}
+	return bytes.ReplaceAll(content, []byte{'\t'}, bytes.Repeat([]byte{' '}, t.tabWidth))
+}
+
+// columns 返回 content 在终端上占用的列数，每个字符占用一列，制表符占用 tabWidth 列
+func (t *Terminal) columns(content []byte) int {
+	return utf8.RuneCount(content) + (t.tabWidth-1)*bytes.Count(content, []byte{'\t'})
 }
 
 // lastByte 返回当前行的最后一个字符，如果行为空，返回 0
@@ -331,14 +576,19 @@ func (t *Terminal) lastByte() byte {
 	return c[len(c)-1]
 }
 
-// bytes 返回当前 Terminal 内所有行的缓存内容
-func (t *Terminal) bytes() []byte {
-
+// length 返回当前 Terminal 内所有行的字节数
+func (t *Terminal) length() int {
 	l := 0
 	for i := range t.content {
 		l += len(t.content[i].content)
 	}
-	c := make([]byte, 0, l)
+	return l
+}
+
+// bytes 返回当前 Terminal 内所有行的缓存内容
+func (t *Terminal) bytes() []byte {
+
+	c := make([]byte, 0, t.length())
 	for _, line := range t.content {
 		c = append(c, line.content...)
 	}
@@ -350,12 +600,68 @@ func (t *Terminal) newLine() {
 
 	t.currentLine().delete()
 	t.content = append(t.content, newLine())
-	MoveCursor(-t.currentLine().head()-1, 1)
+	t.cursorMove(-t.currentLine().head()-1, 1)
 	t.line++
 }
 
+// feedByte 将读取到的字节交给解码器，组装出完整的字符后再进行处理
+func (t *Terminal) feedByte(input byte) {
+	unit, ok := t.decoder.feed(input)
+	if !ok {
+		return
+	}
+	if len(unit) == 1 {
+		t.handleInput(unit[0])
+	} else {
+		t.handleRune(unit)
+	}
+}
+
+// handleRune 处理一个多字节的 UTF-8 字符，字符会作为一个整体写入，不会触发 onKey 回调
+func (t *Terminal) handleRune(r []byte) {
+
+	t.interrupted = false
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 控制序列中不会出现多字节字符，丢弃不完整的控制序列
+	t.buffer = []byte{}
+	t.escaping = false
+
+	keyHandlerRune(t, r)
+}
+
 func (t *Terminal) handleInput(input byte) {
 
+	// 统一不同的行结束符，\r\n 中的 \n 直接丢弃，不会产生额外的空行
+	if input == '\n' && t.afterCR {
+		t.afterCR = false
+		return
+	}
+	t.afterCR = input == ENTER
+	if input == '\n' || (t.terminator != 0 && input == t.terminator) {
+		input = ENTER
+	}
+
+	if input != SIGINT {
+		t.interrupted = false
+	}
+
+	t.escaping = len(t.buffer) != 0 || input == ESC
+
+	// 由外部的回调函数先处理输入，如果返回 true，不再执行默认的处理
+	if t.onKey != nil && t.onKey(input) {
+		return
+	}
+
+	// 回调函数中可能会调用 CurrentLine，因此在回调之后再加锁
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 匹配括号的高亮只保持到下一次输入
+	t.maybeClearMatch()
+
 	// 处理控制类型输入
 	if len(t.buffer) != 0 {
 		keyHandlerMap[ESC](t, input)
@@ -384,13 +690,44 @@ func (t *Terminal) clear() {
 	t.helper = ""
 	t.targets = []string{}
 	t.finished = false
+	t.interrupted = false
+	t.matched = -1
 	t.histories.resetCursor()
 }
 
 // finish 表示完成当前行的读取
 func (t *Terminal) finish() {
 	t.finished = true
-	FlushString("\n")
+	t.flushString("\n")
+	if !t.aborted {
+		t.expandHistory()
+	}
+}
+
+// expandHistory 展开当前输入中的历史引用并回显展开后的命令；如果引用的命令不存在，丢弃当前输入
+func (t *Terminal) expandHistory() {
+	expanded, changed, err := t.histories.expand(t.bytes())
+	if err != nil {
+		t.flushString(err.Error() + "\n")
+		t.content = []*Line{newLine()}
+		t.line = 0
+		return
+	}
+	if changed {
+		t.flushString(string(expanded) + "\n")
+		t.content = []*Line{newLineFrom(expanded)}
+		t.line = 0
+	}
+}
+
+// cancel 丢弃当前输入，并在新的一行显示提示符
+func (t *Terminal) cancel() {
+	t.flushString("^C\n" + t.prefix)
+	t.buffer = []byte{}
+	t.content = []*Line{newLine()}
+	t.line = 0
+	t.histories.resetCursor()
+	t.interrupted = true
 }
 
 func (t *Terminal) abort() {
@@ -410,6 +747,60 @@ func (t *Terminal) tryExecInternalCommand(args [][]byte) bool {
 	return true
 }
 
+/* ---------------------------------------------------------------------------
+* Output
+* ------------------------------------------------------------------------- */
+
+// cursorPosition 返回光标模型中的光标位置，不需要向终端查询
+func (t *Terminal) cursorPosition() (x, y int) {
+	return t.cur.x, t.cur.y
+}
+
+func (t *Terminal) cursorMoveTo(x, y int) {
+	MoveCursorTo(x, y)
+	t.cur.moveTo(x, y)
+}
+
+// cursorMove 将光标移动指定的偏移量。水平方向的移动会按照终端的宽度跨越自动换行的行，
+// 因此在折行的输入中编辑时光标能够到达正确的行
+func (t *Terminal) cursorMove(x, y int) {
+	if x == 0 && y == 0 {
+		return
+	}
+	tx, ty := t.cur.offset(x)
+	ty = clamp(ty+y, 1, t.cur.height)
+	MoveCursor(tx-t.cur.x, ty-t.cur.y)
+	t.cur.moveTo(tx, ty)
+}
+
+func (t *Terminal) flush(content []byte) {
+	Flush(content)
+	t.cur.write(content)
+}
+
+func (t *Terminal) flushString(content string) {
+	FlushString(content)
+	t.cur.write([]byte(content))
+}
+
+func (t *Terminal) flushStringWithUnderline(content string) {
+	FlushStringWithUnderline(content)
+	t.cur.write([]byte(content))
+}
+
+// bell 发出一次响铃，不会移动光标
+func (t *Terminal) bell() {
+	FlushString("\a")
+}
+
+// twinkleScreen 闪烁一次屏幕
+func (t *Terminal) twinkleScreen() {
+	x, y := t.cursorPosition()
+	FlushString(fmt.Sprintf("\033[?47h\033[2J\033[%d;%dH", y, x))
+	time.Sleep(5 * time.Millisecond)
+	FlushString("\033[?47l")
+}
+
 /* ---------------------------------------------------------------------------
 * Helper
 * ------------------------------------------------------------------------- */
@@ -420,7 +811,7 @@ func (t *Terminal) maybeDisplayHelper() {
 		return
 	}
 
-	w := string(t.content[0].firstWord())
+	w := string(t.content[0].firstWord(t.wordSeparators()))
 	if w == "" {
 		return
 	}
@@ -430,15 +821,15 @@ func (t *Terminal) maybeDisplayHelper() {
 	}
 
 	// Display
-	x, y := ReadCursor()
-	FlushString(fmt.Sprintf("\n\033[;37m%s\033[0m ", t.helper))
+	x, y := t.cursorPosition()
+	t.flushString(fmt.Sprintf("\n\033[;37m%s\033[0m ", t.helper))
 
 	// 判断终端是否写满
-	_, cy := ReadCursor()
+	_, cy := t.cursorPosition()
 	if cy == y {
-		MoveCursorTo(x, y-1)
+		t.cursorMoveTo(x, y-1)
 	} else {
-		MoveCursorTo(x, y)
+		t.cursorMoveTo(x, y)
 	}
 }
 
@@ -448,12 +839,12 @@ func (t *Terminal) maybeClearHelper() {
 		return
 	}
 
-	x, y := ReadCursor()
-	MoveCursorTo(0, y+1)
+	x, y := t.cursorPosition()
+	t.cursorMoveTo(0, y+1)
 
-	Flush(bytes.Repeat([]byte{' '}, len(t.helper)))
+	t.flush(bytes.Repeat([]byte{' '}, len(t.helper)))
 
-	MoveCursorTo(x, y)
+	t.cursorMoveTo(x, y)
 	t.helper = ""
 }
 
@@ -475,12 +866,12 @@ func (t *Terminal) inCompletionMode() bool {
 // clearCompletion 清除已经显示的补全命令
 func (t *Terminal) clearCompletion() {
 
-	x, y := ReadCursor()
-	MoveCursorTo(0, y+1)
+	x, y := t.cursorPosition()
+	t.cursorMoveTo(0, y+1)
 
-	Flush(bytes.Repeat([]byte{' '}, t.displayedLen))
+	t.flush(bytes.Repeat([]byte{' '}, t.displayedLen))
 
-	MoveCursorTo(x, y)
+	t.cursorMoveTo(x, y)
 	t.targets = []string{}
 	t.highlight = -1
 	t.displayedLen = 0
@@ -491,7 +882,7 @@ func (t *Terminal) selectCompletion(x, y int) {
 
 	// 如果已经移动到头或尾位置，闪烁一次屏幕
 	if (t.highlight == 0 && (x < 0 || y < 0)) || (t.highlight == len(t.targets)-1 && (x > 0 || y > 0)) {
-		TwinkleScreen()
+		t.twinkleScreen()
 		return
 	}
 
@@ -508,39 +899,60 @@ func (t *Terminal) selectCompletion(x, y int) {
 		t.highlight = len(t.targets) - 1
 	}
 
-	ox, oy := ReadCursor()
+	ox, oy := t.cursorPosition()
 
 	// 清理之前的输出
-	MoveCursorTo(0, oy+1)
-	Flush(bytes.Repeat([]byte{' '}, t.displayedLen))
+	t.cursorMoveTo(0, oy+1)
+	t.flush(bytes.Repeat([]byte{' '}, t.displayedLen))
+
+	t.cursorMoveTo(0, oy+1)
+
+	t.displayCompletions()
+
+	t.cursorMoveTo(ox, oy)
+}
 
-	MoveCursorTo(0, oy+1)
+// displayCompletions 在当前位置显示补全选项，选中的选项会高亮显示，并且在之后显示其描述
+func (t *Terminal) displayCompletions() {
 
 	toDisplay := t.targets
 	toHighlight := t.highlight
 	// 防止一次显示过多选项
 	if len(t.targets) > t.displayLimit {
 		start := t.highlight / t.displayLimit
-		toDisplay = t.targets[start*t.displayLimit : (start+1)*t.displayLimit]
+		end := (start + 1) * t.displayLimit
+		if end > len(t.targets) {
+			end = len(t.targets)
+		}
+		toDisplay = t.targets[start*t.displayLimit : end]
 		toHighlight = t.highlight - start*t.displayLimit
 	}
 
 	t.displayedLen = 0
 	for i := range toDisplay {
-		if i == toHighlight {
-			FlushString(fmt.Sprintf("\033[47;37m%s\033[0m ", toDisplay[i]))
-		} else {
-			FlushString(toDisplay[i] + " ")
+		if i != toHighlight {
+			t.flushString(toDisplay[i] + " ")
+			t.displayedLen += len(toDisplay[i]) + 1
+			continue
 		}
+
+		t.flushString(highlightStyle + toDisplay[i] + resetStyle + " ")
 		t.displayedLen += len(toDisplay[i]) + 1
-	}
 
-	MoveCursorTo(ox, oy)
+		// 只显示选中选项的描述，节省空间
+		if t.completer == nil {
+			continue
+		}
+		if description, ok := t.completer.GetDescription(toDisplay[i]); ok {
+			t.flushString(dimStyle + description + resetStyle + " ")
+			t.displayedLen += len(description) + 1
+		}
+	}
 }
 
 // doComplete 补全选中的命令
 func (t *Terminal) doComplete() {
-	word := t.currentLine().currentWord()
+	word := t.currentLine().currentWord(t.wordSeparators())
 	if len(word) == 0 {
 		return
 	}
@@ -560,7 +972,7 @@ func (t *Terminal) showCompletions() bool {
 		return false
 	}
 
-	word := t.currentLine().currentWord()
+	word := t.currentLine().currentWord(t.wordSeparators())
 	if len(word) == 0 {
 		return false
 	}
@@ -585,76 +997,136 @@ func (t *Terminal) showCompletions() bool {
 
 	t.highlight = (t.highlight + 1) % len(t.targets)
 
-	x, y := ReadCursor()
+	x, y := t.cursorPosition()
 
 	t.maybeClearHelper()
 
 	// 切换到下一行，如果写满则换行
-	FlushString("\n")
+	t.flushString("\n")
 	// 清理之前的输出
-	Flush(bytes.Repeat([]byte{' '}, t.displayedLen))
-	MoveCursor(-t.displayedLen, 0)
+	t.flush(bytes.Repeat([]byte{' '}, t.displayedLen))
+	t.cursorMove(-t.displayedLen, 0)
 
-	toDisplay := t.targets
-	toHighlight := t.highlight
-	// 防止一次显示过多选项
-	if len(t.targets) > t.displayLimit {
-		start := t.highlight / t.displayLimit
-		toDisplay = t.targets[start*t.displayLimit : (start+1)*t.displayLimit]
-		toHighlight = t.highlight - start*t.displayLimit
-	}
-
-	t.displayedLen = 0
-	for i := range toDisplay {
-		if i == toHighlight {
-			FlushString(fmt.Sprintf("\033[47;37m%s\033[0m ", toDisplay[i]))
-		} else {
-			FlushString(toDisplay[i] + " ")
-		}
-		t.displayedLen += len(toDisplay[i]) + 1
-	}
+	t.displayCompletions()
 
 	// 判断终端是否写满
-	_, cy := ReadCursor()
+	_, cy := t.cursorPosition()
 	if cy == y {
-		MoveCursorTo(x, y-1)
+		t.cursorMoveTo(x, y-1)
 	} else {
-		MoveCursorTo(x, y)
+		t.cursorMoveTo(x, y)
 	}
 	return true
 }
 
+/* ---------------------------------------------------------------------------
+* Bracket
+* ------------------------------------------------------------------------- */
+
+// jumpToMatch 在光标位于引号或者括号上时，将光标移动到与其匹配的位置。光标位于行尾时使用最后一个字符
+func (t *Terminal) jumpToMatch() {
+	line := t.currentLine()
+	pos := line.head()
+	if pos == len(line.content) {
+		pos--
+	}
+
+	target, ok := line.matchBracket(pos)
+	if !ok {
+		t.bell()
+		return
+	}
+	t.moveCursor(target-line.head(), 0)
+}
+
+// maybeHighlightMatch 在输入右引号或者右括号之后，高亮显示与其匹配的字符
+func (t *Terminal) maybeHighlightMatch() {
+	line := t.currentLine()
+	pos := line.head() - 1
+	if pos < 0 || (line.content[pos] != '"' && strings.IndexByte(")]}", line.content[pos]) < 0) {
+		return
+	}
+
+	// 只有右侧的引号或者括号需要高亮
+	target, ok := line.matchBracket(pos)
+	if !ok || target > pos {
+		return
+	}
+	t.matched = target
+	t.redrawAt(target, highlightStyle)
+}
+
+// maybeClearMatch 清除匹配括号的高亮
+func (t *Terminal) maybeClearMatch() {
+	if t.matched < 0 {
+		return
+	}
+	if t.matched < t.currentLine().head() {
+		t.redrawAt(t.matched, "")
+	}
+	t.matched = -1
+}
+
+// redrawAt 使用 style 重新输出当前行中 pos 处的字符，pos 必须位于光标之前，输出之后光标回到原来的位置
+func (t *Terminal) redrawAt(pos int, style string) {
+	line := t.currentLine()
+	head := line.head()
+
+	t.cursorMove(-t.columns(line.content[pos:head]), 0)
+	if style == "" {
+		t.flush(t.expandTabs(line.content[pos : pos+1]))
+	} else {
+		t.flushString(style + string(t.expandTabs(line.content[pos:pos+1])) + resetStyle)
+	}
+	t.cursorMove(t.columns(line.content[pos+1:head]), 0)
+}
+
 /* ---------------------------------------------------------------------------
 * History
 * ------------------------------------------------------------------------- */
 
 func (t *Terminal) switchHistory(offset int) {
 
+	// 离开正在编辑的行时保存其内容，回到最新位置时恢复。保存的内容不为空时，只浏览以其为前缀的历史命令
+	if t.histories.cursor == t.histories.sentry {
+		t.stash = append([]byte{}, t.currentLine().content...)
+	}
+	prefix := t.stash
+
 	var toDisplay []byte
 	var end = false
 	if offset < 0 {
-		toDisplay, end = t.histories.moveCursor(true)
+		toDisplay, end = t.histories.moveCursorWithPrefix(true, prefix)
 	} else {
-		toDisplay, end = t.histories.moveCursor(false)
+		toDisplay, end = t.histories.moveCursorWithPrefix(false, prefix)
 	}
 
 	if end == true {
-		TwinkleScreen()
+		t.twinkleScreen()
 		return
 	}
 
+	if t.histories.cursor == t.histories.sentry {
+		toDisplay = append([]byte{}, t.stash...)
+	}
+
 	// 清除现有的行，不直接清行，防止自动换行导致无法全部清除
 	head := t.currentLine().head()
 
+	t.cursorMove(-t.columns(t.currentLine().content[:head]), 0)
 	t.currentLine().moveCursor(-head)
-	MoveCursor(-head, 0)
 
-	x, y := ReadCursor()
-	Flush(bytes.Repeat([]byte{' '}, len(t.currentLine().content)))
-	MoveCursorTo(x, y)
+	x, y := t.cursorPosition()
+	t.flush(bytes.Repeat([]byte{' '}, t.columns(t.currentLine().content)))
+	t.cursorMoveTo(x, y)
 
 	t.content[t.line] = newLineFrom(toDisplay)
-	Flush(toDisplay)
+	t.flush(t.expandTabs(toDisplay))
+
+	// 按照前缀浏览时，光标保持在前缀的末尾
+	if len(prefix) > 0 {
+		t.moveCursor(len(prefix)-len(toDisplay), 0)
+	}
 }
 
 func (t *Terminal) inSearchMode() bool {
@@ -667,14 +1139,14 @@ func (t *Terminal) maybeClearSearch() {
 		return
 	}
 
-	x, y := ReadCursor()
-	MoveCursorTo(0, y+1)
+	x, y := t.cursorPosition()
+	t.cursorMoveTo(0, y+1)
 
 	l := 9 + len(t.search)
 
-	Flush(bytes.Repeat([]byte{' '}, l))
+	t.flush(bytes.Repeat([]byte{' '}, l))
 
-	MoveCursorTo(x, y)
+	t.cursorMoveTo(x, y)
 
 	t.search = []byte{}
 	t.searchMode = false
@@ -688,43 +1160,49 @@ func (t *Terminal) displaySearch() {
 
 	// 清理之前显示的
 	if len(t.search) > 0 {
-		x, y := ReadCursor()
-		MoveCursorTo(8, y+1)
-		Flush(bytes.Repeat([]byte{' '}, len(t.search)+1))
-		MoveCursorTo(x, y)
+		x, y := t.cursorPosition()
+		t.cursorMoveTo(8, y+1)
+		t.flush(bytes.Repeat([]byte{' '}, len(t.search)+1))
+		t.cursorMoveTo(x, y)
 	}
 
-	x, y := ReadCursor()
-	FlushString(fmt.Sprintf("\nsearch: %s", t.search))
-	FlushStringWithUnderline(" ")
+	x, y := t.cursorPosition()
+	t.flushString(fmt.Sprintf("\nsearch: %s", t.search))
+	t.flushStringWithUnderline(" ")
 	// 判断终端是否写满
-	_, cy := ReadCursor()
+	_, cy := t.cursorPosition()
 	if cy == y {
-		MoveCursorTo(x, y-1)
+		t.cursorMoveTo(x, y-1)
 	} else {
-		MoveCursorTo(x, y)
+		t.cursorMoveTo(x, y)
 	}
 
 }
 
 func (t *Terminal) searchHistory() {
-	toDisplay := t.histories.searchCommand(t.bytes())
+	toDisplay := t.histories.searchCommand(t.search)
 
 	if len(toDisplay) == 0 {
-		TwinkleScreen()
+		t.twinkleScreen()
 		return
 	}
 
 	// 清除现有的行，不直接清行，防止自动换行导致无法全部清除
 	head := t.currentLine().head()
 
+	t.cursorMove(-t.columns(t.currentLine().content[:head]), 0)
 	t.currentLine().moveCursor(-head)
-	MoveCursor(-head, 0)
 
-	x, y := ReadCursor()
-	Flush(bytes.Repeat([]byte{' '}, len(t.currentLine().content)))
-	MoveCursorTo(x, y)
+	x, y := t.cursorPosition()
+	t.flush(bytes.Repeat([]byte{' '}, t.columns(t.currentLine().content)))
+	t.cursorMoveTo(x, y)
 
-	t.content[t.line] = newLineFrom(toDisplay)
-	Flush(toDisplay)
+	t.content[t.line] = newLineFrom(append([]byte{}, toDisplay...))
+
+	// 高亮显示命令中与查询内容匹配的部分
+	t.searchStart = bytes.Index(toDisplay, t.search)
+	t.searchEnd = t.searchStart + len(t.search)
+	t.flush(t.expandTabs(toDisplay[:t.searchStart]))
+	t.flushString(highlightStyle + string(t.expandTabs(toDisplay[t.searchStart:t.searchEnd])) + resetStyle)
+	t.flush(t.expandTabs(toDisplay[t.searchEnd:]))
 }
@@ -0,0 +1,653 @@
+package readline
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTerminalSearch(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	term := NewTerminal()
+	term.StoreHistory([]byte("set a"))
+	term.StoreHistory([]byte("get a"))
+	term.StoreHistory([]byte("set b"))
+
+	for _, b := range []byte{SEARCH, 's', 'e', 't'} {
+		term.handleInput(b)
+	}
+
+	tests := []struct {
+		expected   string
+		start, end int
+	}{
+		{"set b", 0, 3},
+		{"set a", 0, 3},
+		// 查询到最旧的命令时保持不变
+		{"set a", 0, 3},
+		// 再次查询时重新循环
+		{"set b", 0, 3},
+	}
+
+	for _, test := range tests {
+		term.handleInput(SEARCH)
+		assert.Equal(t, test.expected, string(term.bytes()))
+		assert.Equal(t, test.start, term.searchStart)
+		assert.Equal(t, test.end, term.searchEnd)
+	}
+	assert.Contains(t, out.String(), highlightStyle+"set"+resetStyle+" b")
+
+	// 修改查询内容
+	for _, b := range []byte{BACKSPACE, BACKSPACE, BACKSPACE, ' ', 'a', SEARCH} {
+		term.handleInput(b)
+	}
+	assert.Equal(t, "get a", string(term.bytes()))
+	assert.Equal(t, 3, term.searchStart)
+	assert.Equal(t, 5, term.searchEnd)
+	assert.Contains(t, out.String(), "get"+highlightStyle+" a"+resetStyle)
+}
+
+func TestTerminalHistoryExpand(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	term := NewTerminal()
+	term.StoreHistory([]byte("get a"))
+
+	for _, b := range []byte("!! b") {
+		term.handleInput(b)
+	}
+	term.handleInput(ENTER)
+	assert.True(t, term.finished)
+	assert.Equal(t, "get a b", string(term.bytes()))
+	assert.Contains(t, out.String(), "\nget a b\n")
+
+	// 找不到引用的命令时丢弃当前输入，但不会退出
+	term.clear()
+	for _, b := range []byte("!set") {
+		term.handleInput(b)
+	}
+	term.handleInput(ENTER)
+	assert.True(t, term.finished)
+	assert.False(t, term.aborted)
+	assert.Equal(t, "", string(term.bytes()))
+	assert.Contains(t, out.String(), "!set: event not found\n")
+}
+
+func TestTerminalHistoryStash(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	term := NewTerminal()
+	term.StoreHistory([]byte("set a"))
+	term.StoreHistory([]byte("set b"))
+
+	input := func(bs ...byte) {
+		for _, b := range bs {
+			term.handleInput(b)
+		}
+	}
+	up := []byte{27, '[', 'A'}
+	down := []byte{27, '[', 'B'}
+
+	input([]byte("se")...)
+	input(up...)
+	assert.Equal(t, "set b", string(term.bytes()))
+	input(up...)
+	assert.Equal(t, "set a", string(term.bytes()))
+	input(down...)
+	assert.Equal(t, "set b", string(term.bytes()))
+
+	// 回到最新位置时恢复正在编辑的内容
+	input(down...)
+	assert.Equal(t, "se", string(term.bytes()))
+	input([]byte("t k")...)
+	assert.Equal(t, "set k", string(term.bytes()))
+
+	// 浏览历史命令不会修改历史命令本身
+	assert.Equal(t, [][]byte{[]byte("set b"), []byte("set a")}, term.histories.histories())
+}
+
+func TestTerminalHistoryPrefix(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	term := NewTerminal()
+	for _, command := range []string{"get a", "set a", "hset h f", "set b", "get b"} {
+		term.StoreHistory([]byte(command))
+	}
+
+	input := func(bs ...byte) {
+		for _, b := range bs {
+			term.handleInput(b)
+		}
+	}
+	up := []byte{27, '[', 'A'}
+	down := []byte{27, '[', 'B'}
+
+	// 只浏览以输入内容为前缀的命令，光标保持在前缀的末尾
+	input([]byte("set")...)
+	input(up...)
+	assert.Equal(t, "set b", string(term.bytes()))
+	assert.Equal(t, 3, term.currentLine().insertPos)
+	input(up...)
+	assert.Equal(t, "set a", string(term.bytes()))
+	assert.Equal(t, 3, term.currentLine().insertPos)
+
+	// 没有更旧的匹配命令时保持不变
+	input(up...)
+	assert.Equal(t, "set a", string(term.bytes()))
+	input(down...)
+	assert.Equal(t, "set b", string(term.bytes()))
+	input(down...)
+	assert.Equal(t, "set", string(term.bytes()))
+	assert.Equal(t, 3, term.currentLine().insertPos)
+
+	// 输入为空时浏览全部的历史命令
+	term.clear()
+	input(up...)
+	assert.Equal(t, "get b", string(term.bytes()))
+	input(up...)
+	assert.Equal(t, "set b", string(term.bytes()))
+	input(up...)
+	assert.Equal(t, "hset h f", string(term.bytes()))
+	assert.Equal(t, 8, term.currentLine().insertPos)
+}
+
+func TestTerminalWordSeparators(t *testing.T) {
+	output = &bytes.Buffer{}
+
+	c := NewCompleter()
+	c.Register(NewHint("hget", "key field"))
+	c.Register(NewHint("name", ""))
+	c.Register(NewHint("nickname", ""))
+	c.Register(NewHint("number", ""))
+
+	term := NewTerminal().WithCompleter(c).WithWordSeparators(":")
+
+	// 只补全分隔符之后的部分
+	for _, b := range []byte("hget user:na") {
+		term.handleInput(b)
+	}
+	term.handleInput(TAB)
+	assert.Equal(t, "hget user:name", string(term.bytes()))
+
+	// 多个匹配时选择补全
+	for _, b := range []byte(" user:n") {
+		term.handleInput(b)
+	}
+	term.handleInput(TAB)
+	assert.Equal(t, 3, len(term.targets))
+	target := term.targets[term.highlight]
+	term.handleInput(ENTER)
+	assert.False(t, term.finished)
+	assert.Equal(t, "hget user:name user:"+target, string(term.bytes()))
+
+	// 没有设置时使用 Completer 的分隔符
+	c.WithWordSeparators("/")
+	term = NewTerminal().WithCompleter(c)
+	for _, b := range []byte("hget a/nu") {
+		term.handleInput(b)
+	}
+	term.handleInput(TAB)
+	assert.Equal(t, "hget a/number", string(term.bytes()))
+	assert.Equal(t, []byte("hget"), term.currentLine().firstWord("/"))
+}
+
+func TestTerminalOnKey(t *testing.T) {
+	output = &bytes.Buffer{}
+
+	var keys []byte
+	var escaping []bool
+	term := NewTerminal()
+	term.WithOnKey(func(b byte) bool {
+		keys = append(keys, b)
+		escaping = append(escaping, term.InEscapeSequence())
+		return b == 'x' || b == ENTER
+	})
+
+	for _, b := range []byte("axb\033[Dc\r") {
+		term.handleInput(b)
+	}
+
+	// 被消费的输入不会执行默认处理
+	assert.Equal(t, "acb", string(term.bytes()))
+	assert.False(t, term.finished)
+
+	assert.Equal(t, []byte("axb\033[Dc\r"), keys)
+	assert.Equal(t, []bool{false, false, false, true, true, true, false, false}, escaping)
+}
+
+func TestTerminalCancelLine(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	var signals []syscall.Signal
+	raiseSignal = func(sig syscall.Signal) {
+		signals = append(signals, sig)
+	}
+
+	term := NewTerminal()
+	for _, b := range []byte("get a") {
+		term.handleInput(b)
+	}
+	term.handleInput(SIGINT)
+
+	// control-C 只丢弃当前输入
+	assert.Equal(t, "", string(term.bytes()))
+	assert.False(t, term.aborted)
+	assert.False(t, term.finished)
+	assert.True(t, bytes.HasSuffix(out.Bytes(), []byte("get a^C\n> ")))
+	assert.Empty(t, signals)
+
+	for _, b := range []byte("get b") {
+		term.handleInput(b)
+	}
+	term.handleInput(SIGINT)
+	assert.False(t, term.aborted)
+
+	// 连续两次 control-C 时退出
+	term.handleInput(SIGINT)
+	assert.True(t, term.aborted)
+	assert.True(t, term.finished)
+	assert.Equal(t, []syscall.Signal{syscall.SIGINT}, signals)
+}
+
+func TestTerminalMaxLineLength(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	term := NewTerminal().WithMaxLineLength(5)
+	for _, b := range []byte("get a") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, "get a", string(term.bytes()))
+	assert.NotContains(t, out.String(), "\a")
+
+	// 超过上限的输入被丢弃并且响铃
+	for _, b := range []byte("bc") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, "get a", string(term.bytes()))
+	assert.Equal(t, 2, bytes.Count(out.Bytes(), []byte("\a")))
+
+	// 删除之后可以继续输入
+	term.handleInput(BACKSPACE)
+	term.handleInput('b')
+	assert.Equal(t, "get b", string(term.bytes()))
+
+	// 为 0 时不限制
+	term = NewTerminal().WithMaxLineLength(0)
+	for _, b := range bytes.Repeat([]byte("a"), 1000) {
+		term.handleInput(b)
+	}
+	assert.Equal(t, 1000, len(term.bytes()))
+}
+
+func TestTerminalCompletionDescription(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	c := NewCompleter()
+	c.RegisterWithDescription("get", "get the value of a key")
+	c.RegisterWithDescription("getset", "set a key and return its old value")
+	c.Register(NewHint("getrange", "key start end"))
+
+	description, ok := c.GetDescription("get")
+	assert.True(t, ok)
+	assert.Equal(t, "get the value of a key", description)
+	_, ok = c.GetDescription("getrange")
+	assert.False(t, ok)
+
+	// 已经注册的单词只更新描述
+	c.RegisterWithDescription("getrange", "get a substring")
+	helper, _ := c.GetHelper("getrange")
+	assert.Equal(t, "key start end", helper)
+
+	term := NewTerminal().WithCompleter(c)
+	for _, b := range []byte("ge") {
+		term.handleInput(b)
+	}
+
+	// 只显示选中选项的描述
+	term.handleInput(TAB)
+	assert.Equal(t, 3, len(term.targets))
+	selected := term.targets[term.highlight]
+	selectedDescription, _ := c.GetDescription(selected)
+	assert.Contains(t, out.String(), highlightStyle+selected+resetStyle+" "+dimStyle+selectedDescription+resetStyle)
+	for _, target := range term.targets {
+		if target != selected {
+			other, _ := c.GetDescription(target)
+			assert.NotContains(t, out.String(), other)
+		}
+	}
+
+	// 切换选项之后显示新的描述
+	out.Reset()
+	term.handleInput(TAB)
+	selected = term.targets[term.highlight]
+	selectedDescription, _ = c.GetDescription(selected)
+	assert.Contains(t, out.String(), highlightStyle+selected+resetStyle+" "+dimStyle+selectedDescription+resetStyle)
+}
+
+func TestTerminalCurrentLine(t *testing.T) {
+	output = &bytes.Buffer{}
+
+	term := NewTerminal()
+	input := bytes.Repeat([]byte("set key value"), 50)
+
+	// 在其他协程中读取输入内容
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				line := term.CurrentLine()
+				assert.True(t, bytes.HasPrefix(input, line))
+			}
+		}
+	}()
+
+	for _, b := range input {
+		term.handleInput(b)
+	}
+	close(done)
+	<-finished
+
+	assert.Equal(t, input, term.CurrentLine())
+
+	// 返回的是拷贝，修改不会影响终端的内容
+	line := term.CurrentLine()
+	line[0] = 'x'
+	assert.Equal(t, input, term.CurrentLine())
+}
+
+func TestTerminalStep(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	term := NewTerminal()
+
+	// 第一次调用时输出提示符
+	done, cmd := term.Step()
+	assert.False(t, done)
+	assert.Nil(t, cmd)
+	assert.Equal(t, "> ", out.String())
+
+	// 没有输入结束符之前不会完成
+	for _, b := range []byte("set key value") {
+		term.Feed(b)
+		done, _ = term.Step()
+		assert.False(t, done)
+	}
+	assert.Equal(t, "set key value", string(term.CurrentLine()))
+
+	term.Feed(ENTER)
+	done, cmd = term.Step()
+	assert.True(t, done)
+	assert.Equal(t, [][]byte{[]byte("set"), []byte("key"), []byte("value")}, cmd)
+	assert.False(t, term.Aborted())
+	assert.Equal(t, 0, len(term.CurrentLine()))
+
+	// 一次输入多行时，每次调用只完成一行，剩余的输入保留到下一次调用
+	for _, b := range []byte("get a\rget b\r") {
+		term.Feed(b)
+	}
+	done, cmd = term.Step()
+	assert.True(t, done)
+	assert.Equal(t, [][]byte{[]byte("get"), []byte("a")}, cmd)
+	done, cmd = term.Step()
+	assert.True(t, done)
+	assert.Equal(t, [][]byte{[]byte("get"), []byte("b")}, cmd)
+	done, _ = term.Step()
+	assert.False(t, done)
+
+	// 完成的命令会记录到历史中
+	assert.Equal(t, 3, len(term.histories.histories()))
+}
+
+func TestTerminalLineTerminator(t *testing.T) {
+	output = &bytes.Buffer{}
+
+	tests := []struct {
+		terminator string
+		custom     byte
+	}{
+		{"\r", 0},
+		{"\n", 0},
+		{"\r\n", 0},
+		{";", ';'},
+	}
+
+	for _, test := range tests {
+		term := NewTerminal().WithLineTerminator(test.custom)
+		for _, b := range []byte("get a" + test.terminator + "get b" + test.terminator) {
+			term.Feed(b)
+		}
+
+		// 每一种结束符都只会结束一行，不会产生额外的空行
+		done, cmd := term.Step()
+		assert.True(t, done, test.terminator)
+		assert.Equal(t, [][]byte{[]byte("get"), []byte("a")}, cmd, test.terminator)
+		done, cmd = term.Step()
+		assert.True(t, done, test.terminator)
+		assert.Equal(t, [][]byte{[]byte("get"), []byte("b")}, cmd, test.terminator)
+		done, _ = term.Step()
+		assert.False(t, done, test.terminator)
+		assert.Empty(t, term.pending, test.terminator)
+		assert.Equal(t, 2, len(term.histories.histories()), test.terminator)
+	}
+
+	// 续行时 \r\n 只会换行一次
+	term := NewTerminal()
+	for _, b := range []byte("get \\\r\na\r\n") {
+		term.Feed(b)
+	}
+	done, cmd := term.Step()
+	assert.True(t, done)
+	assert.Equal(t, [][]byte{[]byte("get"), []byte("a")}, cmd)
+	done, _ = term.Step()
+	assert.False(t, done)
+}
+
+// chunkReader 每次 Read 返回一个分片，用于模拟多字节字符被拆分到多次读取中
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func TestTerminalMultibyteInput(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	// "中" 的编码为 e4 b8 ad，"é" 的编码为 c3 a9
+	reader := newInputReader(&chunkReader{chunks: [][]byte{
+		{'a', 0xe4}, {0xb8}, {0xad, 'b', 0xc3}, {0xa9},
+	}})
+
+	term := NewTerminal()
+	x, _ := term.cursorPosition()
+
+	for {
+		b, err := reader.readByte()
+		if err == io.EOF {
+			break
+		}
+		term.feedByte(b)
+		// 字符不会被处理一半
+		assert.True(t, utf8.Valid(term.CurrentLine()))
+	}
+
+	assert.Equal(t, "a中bé", string(term.CurrentLine()))
+	assert.Equal(t, "a中bé", out.String())
+	// 每个字符只占用一列
+	newX, _ := term.cursorPosition()
+	assert.Equal(t, x+4, newX)
+
+	// 非法的编码会被丢弃
+	for _, b := range []byte{0xff, 0xe4, 'c', 0xb8} {
+		term.feedByte(b)
+	}
+	assert.Equal(t, "a中béc", string(term.CurrentLine()))
+}
+
+func TestTerminalTabWidth(t *testing.T) {
+	output = &bytes.Buffer{}
+
+	term := NewTerminal().WithTabWidth(8)
+	term.completer = nil
+
+	for _, b := range []byte("ab\033[D") {
+		term.handleInput(b)
+	}
+	x := term.cur.x
+
+	// 输入内容中保存制表符，显示时占用 tabWidth 列
+	term.handleInput('\t')
+	assert.Equal(t, []byte("a\tb"), term.currentLine().content)
+	assert.Equal(t, x+8, term.cur.x)
+
+	// 光标跨过制表符时移动 tabWidth 列
+	for _, b := range []byte("\033[D") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, x, term.cur.x)
+	for _, b := range []byte("\033[C\033[C") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, x+9, term.cur.x)
+
+	// 删除制表符之后光标回到原来的位置
+	for _, b := range []byte("\033[D\x7f") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, []byte("ab"), term.currentLine().content)
+	assert.Equal(t, x, term.cur.x)
+}
+
+func TestLineMatchBracket(t *testing.T) {
+
+	line := newLineFrom([]byte(`set k "a(\"b" [x {y} (z)] ]`))
+
+	tests := []struct {
+		pos    int
+		target int
+		ok     bool
+	}{
+		{6, 12, true},  // 字符串中的转义引号不会结束字符串
+		{12, 6, true},  // 右引号匹配左引号
+		{8, 0, false},  // 字符串中的括号不参与匹配
+		{14, 24, true}, // 嵌套的括号
+		{17, 19, true},
+		{23, 21, true},
+		{26, 0, false}, // 不匹配的右括号
+		{0, 0, false},
+	}
+
+	for _, test := range tests {
+		target, ok := line.matchBracket(test.pos)
+		assert.Equal(t, test.ok, ok, test.pos)
+		if test.ok {
+			assert.Equal(t, test.target, target, test.pos)
+		}
+	}
+}
+
+func TestTerminalJumpToMatch(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	term := NewTerminal()
+	term.completer = nil
+
+	// 输入右括号时高亮显示匹配的左括号，下一次输入时清除
+	for _, b := range []byte("set k [a b]") {
+		term.handleInput(b)
+	}
+	assert.Contains(t, out.String(), highlightStyle+"["+resetStyle)
+	assert.Equal(t, 6, term.matched)
+	term.handleInput(' ')
+	assert.Equal(t, -1, term.matched)
+
+	for _, b := range []byte("\033[D\033[D\033[D\033[D\033[D\033[D") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, 6, term.currentLine().head())
+	x := term.cur.x
+
+	// 光标位于左括号上时跳转到右括号，再次跳转时回到左括号
+	term.handleInput(MATCH)
+	assert.Equal(t, 10, term.currentLine().head())
+	assert.Equal(t, x+4, term.cur.x)
+	term.handleInput(MATCH)
+	assert.Equal(t, 6, term.currentLine().head())
+	assert.Equal(t, x, term.cur.x)
+
+	// 没有匹配时光标不移动
+	for _, b := range []byte("\033[D") {
+		term.handleInput(b)
+	}
+	term.handleInput(MATCH)
+	assert.Equal(t, 5, term.currentLine().head())
+	assert.Equal(t, []byte("set k [a b] "), term.currentLine().content)
+}
+
+func TestTerminalWrappedLine(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+
+	// 宽度为 10 的终端中，25 个字符的输入占用三行
+	term := NewTerminal().WithCompleter(nil)
+	term.cur = newCursor(1, 1, 10, 24)
+	for _, b := range []byte("0123456789abcdefghijklmno") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, []int{6, 3}, []int{term.cur.x, term.cur.y})
+
+	// 向左移动时跨越行首，回到上一行
+	out.Reset()
+	term.moveCursor(-12, 0)
+	assert.Equal(t, []int{4, 2}, []int{term.cur.x, term.cur.y})
+	assert.Equal(t, "\033[2D\033[1A", out.String())
+
+	// 在中间插入时重新输出之后的内容，光标回到插入的字符之后
+	out.Reset()
+	term.handleInput('X')
+	assert.Equal(t, []byte("0123456789abcXdefghijklmno"), term.bytes())
+	assert.True(t, strings.HasPrefix(out.String(), "Xdefghijklmno"))
+	assert.Equal(t, []int{5, 2}, []int{term.cur.x, term.cur.y})
+
+	term.moveCursor(-5, 0)
+	assert.Equal(t, []int{10, 1}, []int{term.cur.x, term.cur.y})
+
+	// 在第一行删除时后面两行的内容整体前移
+	out.Reset()
+	term.handleInput(BACKSPACE)
+	assert.Equal(t, []byte("012345679abcXdefghijklmno"), term.bytes())
+	assert.True(t, strings.HasPrefix(out.String(), "\033[1D9abcXdefghijklmno "))
+	assert.Equal(t, []int{9, 1}, []int{term.cur.x, term.cur.y})
+
+	// 向右移动时跨越行尾，到达最后一行
+	term.moveCursor(16, 0)
+	assert.Equal(t, []int{5, 3}, []int{term.cur.x, term.cur.y})
+	term.moveCursor(100, 0)
+	assert.Equal(t, []int{6, 3}, []int{term.cur.x, term.cur.y})
+}
@@ -23,3 +23,12 @@ func setTermios(fd int, termios *Termios) error {
 	}
 	return nil
 }
+
+func getWinSize(fd int) (width, height int, err error) {
+	ws := new(winSize)
+	_, _, e := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(ws)), 0, 0, 0)
+	if e != 0 {
+		return 0, 0, e
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
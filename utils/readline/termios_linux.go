@@ -27,3 +27,14 @@ func setTermios(fd int, termios *Termios) error {
 	}
 	return nil
 }
+
+const ioctlGetWinSize = 0x5413 // syscall.TIOCGWINSZ
+
+func getWinSize(fd int) (width, height int, err error) {
+	ws := new(winSize)
+	_, _, e := syscall.Syscall6(syscall.SYS_IOCTL, uintptr(fd), ioctlGetWinSize, uintptr(unsafe.Pointer(ws)), 0, 0, 0)
+	if e != 0 {
+		return 0, 0, e
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
@@ -2,11 +2,27 @@ package readline
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"syscall"
 	"time"
 )
 
+const (
+	highlightStyle = "\033[47;37m" // 高亮显示的颜色
+	dimStyle       = "\033[2m"     // 暗色显示，用于补全项的描述
+	resetStyle     = "\033[0m"
+)
+
+// output 是终端内容的输出目标
+var output io.Writer = os.Stdout
+
+// cursorReportTimeout 是等待终端返回光标位置的最长时间，部分终端或终端复用器不会响应光标位置查询
+var cursorReportTimeout = 100 * time.Millisecond
+
+// cursorX, cursorY 记录最后一次已知的光标位置，在终端没有响应时作为估计值使用
+var cursorX, cursorY = 1, 1
+
 func IsOrdinaryInput(input byte) bool {
 	return input >= 32 && input <= 126
 }
@@ -28,46 +44,111 @@ func ClearLine(y int) {
 	MoveCursorTo(ox, oy)
 }
 
-// ReadCursor 读取当前光标的位置
+// ReadCursor 读取当前光标的位置。如果终端在 cursorReportTimeout 内没有返回光标位置，
+// 将返回最后一次已知的光标位置，而不会一直阻塞。
 func ReadCursor() (x, y int) {
 	FlushString("\033[6n")
-	_, _ = fmt.Scanf("\033[%d;%dR", &y, &x)
-	return x, y
+
+	r := stdin()
+	deadline := time.NewTimer(cursorReportTimeout)
+	defer deadline.Stop()
+
+	// 在光标位置报告之前到达的其他输入需要放回缓冲区
+	var skipped, report []byte
+	for {
+		b, err := r.readByteBefore(deadline)
+		if err != nil {
+			r.unread(append(skipped, report...))
+			return cursorX, cursorY
+		}
+
+		if b == ESC {
+			skipped = append(skipped, report...)
+			report = []byte{ESC}
+			continue
+		}
+		if len(report) == 0 {
+			skipped = append(skipped, b)
+			continue
+		}
+
+		report = append(report, b)
+		if isCursorReportPrefix(report) {
+			if b == 'R' {
+				cursorX, cursorY, _ = parseCursorReport(report)
+				r.unread(skipped)
+				return cursorX, cursorY
+			}
+			continue
+		}
+		skipped = append(skipped, report...)
+		report = nil
+	}
+}
+
+// isCursorReportPrefix 判断 b 是否是光标位置报告 "\033[row;colR" 的前缀
+func isCursorReportPrefix(b []byte) bool {
+	if len(b) < 2 || b[0] != ESC || b[1] != '[' {
+		return len(b) == 1 && b[0] == ESC
+	}
+	semicolon := false
+	for i := 2; i < len(b); i++ {
+		switch {
+		case b[i] >= '0' && b[i] <= '9':
+		case b[i] == ';' && !semicolon && i > 2:
+			semicolon = true
+		case b[i] == 'R' && i == len(b)-1 && semicolon && b[i-1] != ';':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseCursorReport 解析光标位置报告 "\033[row;colR"
+func parseCursorReport(b []byte) (x, y int, ok bool) {
+	if !isCursorReportPrefix(b) || b[len(b)-1] != 'R' {
+		return 0, 0, false
+	}
+	_, err := fmt.Sscanf(string(b), "\033[%d;%dR", &y, &x)
+	return x, y, err == nil
 }
 
 // Flush 输出到屏幕
 func Flush(content []byte) {
-	_, _ = os.Stdout.Write(content)
+	_, _ = output.Write(content)
 }
 
 // FlushString 输出到屏幕
 func FlushString(content string) {
-	_, _ = os.Stdout.WriteString(content)
+	_, _ = io.WriteString(output, content)
 }
 
 func FlushStringWithUnderline(content string) {
-	_, _ = os.Stdout.WriteString("\033[4m" + content + "\033[0m")
+	_, _ = io.WriteString(output, "\033[4m"+content+"\033[0m")
 }
 
 // MoveCursorTo 将光标移动到目标位置
 func MoveCursorTo(dstX, dstY int) {
-	_, _ = os.Stdout.WriteString(fmt.Sprintf("\033[%d;%dH", dstY, dstX))
+	_, _ = io.WriteString(output, fmt.Sprintf("\033[%d;%dH", dstY, dstX))
+	cursorX, cursorY = dstX, dstY
 }
 
 // MoveCursor 将光标移动指定的偏移量
 func MoveCursor(x, y int) {
 
 	if x < 0 {
-		_, _ = os.Stdout.WriteString(fmt.Sprintf("\033[%dD", 0-x))
+		_, _ = io.WriteString(output, fmt.Sprintf("\033[%dD", 0-x))
 	} else if x > 0 {
-		_, _ = os.Stdout.WriteString(fmt.Sprintf("\033[%dC", x))
+		_, _ = io.WriteString(output, fmt.Sprintf("\033[%dC", x))
 	}
 
 	if y < 0 {
-		_, _ = os.Stdout.WriteString(fmt.Sprintf("\033[%dA", -y))
+		_, _ = io.WriteString(output, fmt.Sprintf("\033[%dA", -y))
 	} else if y > 0 {
-		_, _ = os.Stdout.WriteString(fmt.Sprintf("\033[%dB", y))
+		_, _ = io.WriteString(output, fmt.Sprintf("\033[%dB", y))
 	}
+	cursorX, cursorY = cursorX+x, cursorY+y
 }
 
 func DisableTerminal() *Termios {
@@ -95,31 +176,37 @@ func DisableTerminal() *Termios {
 	return &oldState
 }
 
-// SplitRepeatableSeg 会将 s 按照 seg 来进行切割，忽略 "" 之间的 seg
+// SplitRepeatableSeg 会将 s 按照 seg 来进行切割，连续的 seg 视为一个分隔符，开头以及结尾的 seg 会被忽略，
+// 因此结果中不会出现空的片段；s 为空或者只包含 seg 时返回空值。
+// 以 " 开头并且以 " 结尾的片段作为一个整体，其中的 seg 不会被切割，返回的片段不包含两端的 "，"" 会返回一个空的片段。
+// 没有闭合的 " 会将其之后的全部内容作为一个片段，包括结尾的 seg
 func SplitRepeatableSeg(s []byte, seg byte) [][]byte {
 	var splits [][]byte
-	i, j := 0, 0
-	for ; j < len(s); j++ {
+
+	// i 为当前片段的起始位置
+	i := 0
+	for j := 0; j < len(s); j++ {
 		if s[j] == seg {
 			if j > i {
 				splits = append(splits, s[i:j])
-				i = j + 1
-			} else {
-				i++
 			}
-		} else if s[j] == '"' && (j == 0 || s[j-1] == seg) {
+			i = j + 1
+
+		} else if s[j] == '"' && j == i {
+			// 寻找片段结尾的 "，没有找到时剩余的内容都属于该片段
 			k := j + 1
 			for ; k < len(s); k++ {
 				if s[k] == '"' && s[k-1] != '\\' && (k == len(s)-1 || s[k+1] == seg) {
-					splits = append(splits, s[j+1:k])
-					i, j = k+1, k
 					break
 				}
 			}
+			splits = append(splits, s[j+1:k])
+			i, j = k+1, k
 		}
 	}
-	if i < len(s) && j > i {
-		splits = append(splits, s[i:j])
+
+	if i < len(s) {
+		splits = append(splits, s[i:])
 	}
 	return splits
 }
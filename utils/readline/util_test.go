@@ -0,0 +1,107 @@
+package readline
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCursorTimeout(t *testing.T) {
+	out := &bytes.Buffer{}
+	output = out
+	// 终端永远不会返回光标位置
+	r, w := io.Pipe()
+	defer func() { _ = w.Close() }()
+	input = newInputReader(r)
+
+	MoveCursorTo(7, 3)
+
+	start := time.Now()
+	x, y := ReadCursor()
+	assert.Less(t, time.Since(start), 3*cursorReportTimeout)
+	assert.Equal(t, 7, x)
+	assert.Equal(t, 3, y)
+	assert.True(t, strings.HasSuffix(out.String(), "\033[6n"))
+
+	// 使用相对移动后的估计位置
+	MoveCursor(2, -1)
+	x, y = ReadCursor()
+	assert.Equal(t, 9, x)
+	assert.Equal(t, 2, y)
+}
+
+func TestReadCursor(t *testing.T) {
+	output = &bytes.Buffer{}
+	input = newInputReader(strings.NewReader("ab\033[12;34R\033c"))
+
+	x, y := ReadCursor()
+	assert.Equal(t, 34, x)
+	assert.Equal(t, 12, y)
+
+	// 报告之前的输入不会丢失
+	for _, expected := range []byte("ab\033c") {
+		b, err := input.readByte()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, b)
+	}
+	_, err := input.readByte()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLateCursorReport(t *testing.T) {
+	output = &bytes.Buffer{}
+	term := NewTerminal()
+
+	for _, b := range []byte("\033[5;9R") {
+		term.handleInput(b)
+	}
+	assert.Equal(t, 9, cursorX)
+	assert.Equal(t, 5, cursorY)
+
+	term.handleInput('a')
+	assert.Equal(t, []byte("a"), term.bytes())
+}
+
+func TestSplitRepeatableSeg(t *testing.T) {
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{" ", nil},
+		{"  ", nil},
+		{"a", []string{"a"}},
+		{"a ", []string{"a"}},
+		{" a", []string{"a"}},
+		{" a ", []string{"a"}},
+		{"a b", []string{"a", "b"}},
+		{"a  b", []string{"a", "b"}},
+		{"  a   b  ", []string{"a", "b"}},
+		{"set key value", []string{"set", "key", "value"}},
+		{`"a b"`, []string{"a b"}},
+		{`set "a b" c`, []string{"set", "a b", "c"}},
+		{`set  "a  b"  `, []string{"set", "a  b"}},
+		{`""`, []string{""}},
+		{`set "" c`, []string{"set", "", "c"}},
+		{`a"b c"`, []string{`a"b`, `c"`}},
+		{`"a\" b"`, []string{`a\" b`}},
+		{`"a"b c"`, []string{`a"b c`}},
+		{`"a b`, []string{"a b"}},
+		{`"`, []string{""}},
+		{`SET k "abc`, []string{"SET", "k", "abc"}},
+		{`SET k "abc `, []string{"SET", "k", "abc "}},
+		{`SET k "a\" b`, []string{"SET", "k", `a\" b`}},
+	}
+
+	for _, test := range tests {
+		var actual []string
+		for _, split := range SplitRepeatableSeg([]byte(test.input), ' ') {
+			actual = append(actual, string(split))
+		}
+		assert.Equal(t, test.expected, actual, "input: %q", test.input)
+	}
+}